@@ -0,0 +1,57 @@
+// Command scaffold generates a new resource and its service, e.g.
+//
+//	go run ./cmd/scaffold -resource Order
+//
+// writes the proto definitions of OrderService, a repository interface
+// with an in-memory implementation, the service and their tests, and
+// registers the service in internal/app/bootstrap/services.go. Run
+// `make proto` afterwards to generate the gRPC and gateway code the new
+// files use.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	resource := flag.String("resource", "", "resource name in upper camel case, e.g. Order")
+	plural := flag.String("plural", "", "plural of the resource (default derived, e.g. Orders)")
+	root := flag.String("root", ".", "repository root")
+	force := flag.Bool("force", false, "overwrite existing files")
+	dryRun := flag.Bool("dry-run", false, "print the files that would be written")
+	flag.Parse()
+
+	if *resource == "" {
+		fmt.Fprintln(os.Stderr, "scaffold: -resource is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	n, err := newNames(*resource, *plural)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scaffold: %v\n", err)
+		os.Exit(2)
+	}
+
+	paths, err := scaffold(*root, n, *force, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scaffold: %v\n", err)
+		os.Exit(1)
+	}
+	verb := "wrote"
+	if *dryRun {
+		verb = "would write"
+	}
+	for _, path := range paths {
+		fmt.Printf("%s %s\n", verb, path)
+	}
+	fmt.Printf(`
+Next steps:
+  1. make proto
+  2. go test ./internal/repository/ ./internal/service/
+  3. Add the fields of %[1]s to api/proto/v1/%[2]s.proto and update_mask paths to Update%[1]s
+  4. Map the %[1]sService methods to permissions under authz.methods in config.yaml
+  5. List its Create%[1]s, Update%[1]s and Delete%[1]s methods under mutations in config.yaml
+`, n.Resource, n.Snake)
+}
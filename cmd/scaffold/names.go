@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// resourceName matches resource names in upper camel case, e.g. Order or
+// PurchaseOrder. Acronyms are spelled as words, e.g. HttpRoute, so the
+// snake case of the name is unambiguous.
+var resourceName = regexp.MustCompile(`^([A-Z][a-z0-9]+)+$`)
+
+// names are the spellings of a resource the templates use, e.g. for
+// PurchaseOrder
+type names struct {
+	Resource    string // PurchaseOrder
+	Plural      string // PurchaseOrders
+	Snake       string // purchase_order
+	PluralSnake string // purchase_orders
+	Var         string // purchaseOrder
+	PluralVar   string // purchaseOrders
+	Collection  string // purchaseOrders, the collection of its resource names
+	Title       string // purchase order
+	PluralTitle string // purchase orders
+	Article     string // a
+}
+
+// newNames returns the names of resource, with plural as its plural, or
+// a plural derived from it when empty
+func newNames(resource, plural string) (names, error) {
+	if !resourceName.MatchString(resource) {
+		return names{}, fmt.Errorf("invalid resource %q, want upper camel case, e.g. Order or PurchaseOrder", resource)
+	}
+	if plural == "" {
+		plural = pluralize(resource)
+	}
+	if !resourceName.MatchString(plural) || plural == resource {
+		return names{}, fmt.Errorf("invalid plural %q, want upper camel case other than the resource, e.g. Orders", plural)
+	}
+
+	n := names{
+		Resource:    resource,
+		Plural:      plural,
+		Snake:       snake(resource),
+		PluralSnake: snake(plural),
+		Var:         lowerCamel(resource),
+		PluralVar:   lowerCamel(plural),
+		Title:       strings.ReplaceAll(snake(resource), "_", " "),
+		PluralTitle: strings.ReplaceAll(snake(plural), "_", " "),
+		Article:     "a",
+	}
+	n.Collection = n.PluralVar
+	if strings.ContainsRune("aeiou", rune(n.Title[0])) {
+		n.Article = "an"
+	}
+	if token.IsKeyword(n.Var) || token.IsKeyword(n.PluralVar) {
+		return names{}, fmt.Errorf("resource %q is a Go keyword in lower case", resource)
+	}
+	return n, nil
+}
+
+// pluralize returns the regular English plural of a word in camel case
+func pluralize(word string) string {
+	lower := strings.ToLower(word)
+	switch {
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return word[:len(word)-1] + "ies"
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return word + "es"
+	}
+	return word + "s"
+}
+
+// snake converts a word in camel case to snake case
+func snake(word string) string {
+	var b strings.Builder
+	for i, r := range word {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// lowerCamel lowers the first letter of a word in camel case
+func lowerCamel(word string) string {
+	return strings.ToLower(word[:1]) + word[1:]
+}
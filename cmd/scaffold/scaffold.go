@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.tmpl"))
+
+// servicesFile is the file registering the services, relative to the root
+const servicesFile = "internal/app/bootstrap/services.go"
+
+// selectVersions opens the call listing the services in servicesFile
+const selectVersions = "app.SelectVersions("
+
+// modulePath is the import path of the module the templates import from
+const modulePath = "github.com/ChyiYaqing/go-microservice-template"
+
+// serviceImports are the packages serviceLine refers to
+var serviceImports = []string{
+	modulePath + "/api/proto/v1",
+	modulePath + "/internal/app",
+	modulePath + "/internal/repository",
+	modulePath + "/internal/service",
+	modulePath + "/pkg/pagination",
+}
+
+// file is a file to generate from a template
+type file struct {
+	path     string // relative to the root, with the snake case name as %s
+	template string
+}
+
+var files = []file{
+	{"api/proto/v1/%s.proto", "proto.tmpl"},
+	{"internal/repository/%s.go", "repository.go.tmpl"},
+	{"internal/repository/%s_test.go", "repository_test.go.tmpl"},
+	{"internal/service/%s_service.go", "service.go.tmpl"},
+	{"internal/service/%s_service_test.go", "service_test.go.tmpl"},
+}
+
+// generated is a file the scaffold writes
+type generated struct {
+	path    string
+	content []byte
+}
+
+// scaffold generates the files of the resource n under root and registers
+// its service in servicesFile, returning the paths it writes, relative to
+// root. Existing files are only overwritten with force. With dryRun
+// nothing is written.
+func scaffold(root string, n names, force, dryRun bool) ([]string, error) {
+	var out []generated
+	for _, f := range files {
+		path := fmt.Sprintf(f.path, n.Snake)
+		content, err := render(f.template, n)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if _, err := os.Stat(filepath.Join(root, path)); err == nil && !force {
+			return nil, fmt.Errorf("%s already exists, use -force to overwrite it", path)
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		out = append(out, generated{path, content})
+	}
+
+	src, err := os.ReadFile(filepath.Join(root, servicesFile))
+	if err != nil {
+		return nil, err
+	}
+	wired, changed, err := register(src, n)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", servicesFile, err)
+	}
+	if changed {
+		out = append(out, generated{servicesFile, wired})
+	}
+
+	paths := make([]string, 0, len(out))
+	for _, g := range out {
+		paths = append(paths, g.path)
+		if dryRun {
+			continue
+		}
+		path := filepath.Join(root, g.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, g.content, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// render executes the template name for n, formatting Go source
+func render(name string, n names) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, n); err != nil {
+		return nil, err
+	}
+	if !strings.Contains(name, ".go.") {
+		return buf.Bytes(), nil
+	}
+	return format.Source(buf.Bytes())
+}
+
+// serviceLine is the registration of the service of n in the
+// app.SelectVersions call
+func serviceLine(n names) string {
+	return fmt.Sprintf("app.NewService(&apiv1.%[1]sService_ServiceDesc, service.New%[1]sService(repository.NewMemory%[1]sRepository(), pagination.NewTokens([]byte(cfg.Pagination.Secret))), apiv1.Register%[1]sServiceHandler),", n.Resource)
+}
+
+// register adds the service of n to the app.SelectVersions call of src, the
+// source of servicesFile, after the services already listed. It reports
+// whether src changed, as it is left alone when the service is registered.
+func register(src []byte, n names) ([]byte, bool, error) {
+	if bytes.Contains(src, []byte("&apiv1."+n.Resource+"Service_ServiceDesc")) {
+		return src, false, nil
+	}
+	start := bytes.Index(src, []byte(selectVersions))
+	if start < 0 {
+		return nil, false, fmt.Errorf("no %s call to register the service in", selectVersions)
+	}
+	// The call ends at the first line closing it at the indentation of the
+	// statement it begins
+	lineStart := bytes.LastIndexByte(src[:start], '\n') + 1
+	indent := src[lineStart:start]
+	indent = indent[:len(indent)-len(bytes.TrimLeft(indent, " \t"))]
+	closing := append(append([]byte("\n"), indent...), ')')
+	end := bytes.Index(src[start:], closing)
+	if end < 0 {
+		return nil, false, fmt.Errorf("cannot find the end of the %s call", selectVersions)
+	}
+	end += start + 1
+
+	var out bytes.Buffer
+	out.Write(src[:end])
+	fmt.Fprintf(&out, "%s\t%s\n", indent, serviceLine(n))
+	out.Write(src[end:])
+	imported, err := addImports(out.Bytes(), serviceImports)
+	if err != nil {
+		return nil, false, err
+	}
+	formatted, err := format.Source(imported)
+	if err != nil {
+		return nil, false, err
+	}
+	return formatted, true, nil
+}
+
+// addImports adds the paths src does not import yet to its first import
+// block, where format.Source sorts them. api/proto/v1 is imported as
+// apiv1.
+func addImports(src []byte, paths []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	imported := make(map[string]bool, len(f.Imports))
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		imported[path] = true
+	}
+	var missing bytes.Buffer
+	for _, path := range paths {
+		if imported[path] {
+			continue
+		}
+		if strings.HasSuffix(path, "/api/proto/v1") {
+			missing.WriteString("apiv1 ")
+		}
+		fmt.Fprintf(&missing, "%q\n", path)
+	}
+	if missing.Len() == 0 {
+		return src, nil
+	}
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT && d.Lparen.IsValid() {
+			at := fset.Position(d.Lparen).Offset + 1
+			return slices.Concat(src[:at], []byte("\n"), missing.Bytes(), src[at:]), nil
+		}
+	}
+	return nil, errors.New("no import block to add the imports of the service to")
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// servicesSource is a services.go with a SelectVersions call, importing
+// none of the packages the scaffolded service adds
+const servicesSource = `package bootstrap
+
+import (
+	"fmt"
+
+	apiv2 "github.com/ChyiYaqing/go-microservice-template/api/proto/v2"
+)
+
+func (a *App) buildServices() error {
+	cfg := a.cfg
+	versioned, err := app.SelectVersions(cfg.Server.APIVersions,
+		app.NewService(&apiv2.UserService_ServiceDesc, service.NewUserServiceV2(a.userService), apiv2.RegisterUserServiceHandler),
+	)
+	if err != nil {
+		return fmt.Errorf("invalid server.api_versions: %w", err)
+	}
+	return nil
+}
+`
+
+func TestNewNames(t *testing.T) {
+	tests := []struct {
+		resource, plural string
+		want             names
+	}{
+		{"Order", "", names{Resource: "Order", Plural: "Orders", Snake: "order", PluralSnake: "orders", Var: "order", PluralVar: "orders", Collection: "orders", Title: "order", PluralTitle: "orders", Article: "an"}},
+		{"PurchaseOrder", "", names{Resource: "PurchaseOrder", Plural: "PurchaseOrders", Snake: "purchase_order", PluralSnake: "purchase_orders", Var: "purchaseOrder", PluralVar: "purchaseOrders", Collection: "purchaseOrders", Title: "purchase order", PluralTitle: "purchase orders", Article: "a"}},
+		{"Person", "People", names{Resource: "Person", Plural: "People", Snake: "person", PluralSnake: "people", Var: "person", PluralVar: "people", Collection: "people", Title: "person", PluralTitle: "people", Article: "a"}},
+	}
+	for _, tt := range tests {
+		got, err := newNames(tt.resource, tt.plural)
+		if err != nil || got != tt.want {
+			t.Errorf("newNames(%q, %q) = %+v, %v, want %+v", tt.resource, tt.plural, got, err, tt.want)
+		}
+	}
+
+	for word, want := range map[string]string{"Category": "Categories", "Key": "Keys", "Address": "Addresses", "Box": "Boxes", "Batch": "Batches"} {
+		if got := pluralize(word); got != want {
+			t.Errorf("pluralize(%q) = %q, want %q", word, got, want)
+		}
+	}
+
+	for _, resource := range []string{"", "order", "Purchase_Order", "HTTPRoute", "Func"} {
+		if _, err := newNames(resource, ""); err == nil {
+			t.Errorf("newNames(%q) expected error", resource)
+		}
+	}
+	if _, err := newNames("Sheep", "Sheep"); err == nil {
+		t.Error("newNames() with the resource as its plural expected error")
+	}
+}
+
+func TestScaffold(t *testing.T) {
+	root := t.TempDir()
+	servicesPath := filepath.Join(root, servicesFile)
+	if err := os.MkdirAll(filepath.Dir(servicesPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(servicesPath, []byte(servicesSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := newNames("PurchaseOrder", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := scaffold(root, n, false, true)
+	if err != nil || len(paths) != len(files)+1 {
+		t.Fatalf("scaffold() dry run = %v, %v, want every file and services.go", paths, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "api/proto/v1/purchase_order.proto")); err == nil {
+		t.Error("scaffold() dry run wrote files")
+	}
+
+	if _, err := scaffold(root, n, false, false); err != nil {
+		t.Fatalf("scaffold() unexpected error: %v", err)
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if strings.Contains(string(content), "<no value>") {
+			t.Errorf("%s has a template field unset", path)
+		}
+		if strings.HasSuffix(path, ".go") {
+			formatted, err := format.Source(content)
+			if err != nil || !bytes.Equal(formatted, content) {
+				t.Errorf("%s is not valid gofmt'd Go: %v", path, err)
+			}
+		}
+	}
+
+	proto, _ := os.ReadFile(filepath.Join(root, "api/proto/v1/purchase_order.proto"))
+	for _, want := range []string{
+		"service PurchaseOrderService {",
+		"rpc ListPurchaseOrders(ListPurchaseOrdersRequest) returns (CommonResponse)",
+		`patch: "/v1/{purchase_order.name=purchaseOrders/*}"`,
+		`get: "/v1/{name=purchaseOrders/*}"`,
+		"repeated PurchaseOrder purchase_orders = 1;",
+		"// Format: purchaseOrders/{purchase_order_id}",
+	} {
+		if !strings.Contains(string(proto), want) {
+			t.Errorf("proto lacks %q", want)
+		}
+	}
+
+	wired, _ := os.ReadFile(servicesPath)
+	if strings.Count(string(wired), serviceLine(n)) != 1 || !strings.Contains(string(wired), "\t\t"+serviceLine(n)+"\n\t)\n") {
+		t.Errorf("services.go = %s, want the service registered last in SelectVersions", wired)
+	}
+	for _, path := range serviceImports {
+		if !strings.Contains(string(wired), strconv.Quote(path)) {
+			t.Errorf("services.go does not import %s", path)
+		}
+	}
+	if !strings.Contains(string(wired), `apiv1 "`+modulePath+`/api/proto/v1"`) {
+		t.Errorf("services.go = %s, want api/proto/v1 imported as apiv1", wired)
+	}
+
+	// Generated files are not overwritten without force, and the service
+	// is registered once
+	if _, err := scaffold(root, n, false, false); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Errorf("scaffold() again error = %v, want a hint at -force", err)
+	}
+	paths, err = scaffold(root, n, true, false)
+	if err != nil || len(paths) != len(files) {
+		t.Errorf("scaffold() -force = %v, %v, want the files but not services.go", paths, err)
+	}
+	if again, _ := os.ReadFile(servicesPath); !bytes.Equal(again, wired) {
+		t.Errorf("services.go changed registering the service again: %s", again)
+	}
+}
+
+// moduleRoot is the root of the module, relative to this package
+const moduleRoot = "../.."
+
+// stubsDir holds the code make proto generates for the scaffolded Order
+// proto, testdata/order/order.proto. After changing proto.tmpl, scaffold
+// Order into a scratch copy of the repository, run make proto there and
+// copy api/proto/v1/order* here.
+const stubsDir = "testdata/order"
+
+// TestScaffoldCompiles scaffolds Order into a copy of the module, adds
+// the generated stubs of its proto and vets the packages it touches, so
+// the templates cannot drift from the code they build on
+func TestScaffoldCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the module build in short mode")
+	}
+	gotool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not on PATH")
+	}
+	if _, err := os.Stat(filepath.Join(moduleRoot, "api/proto/v1/user.pb.go")); err != nil {
+		t.Skip("the module's proto code is not generated, run make proto")
+	}
+
+	n, err := newNames("Order", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto, err := render("proto.tmpl", n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub, err := os.ReadFile(filepath.Join(stubsDir, "order.proto")); err != nil || !bytes.Equal(stub, proto) {
+		t.Fatalf("%s/order.proto is not what proto.tmpl renders, regenerate the stubs (%v)", stubsDir, err)
+	}
+
+	root := t.TempDir()
+	for _, path := range []string{"go.mod", "go.sum", "api", "docs", "internal", "pkg"} {
+		if err := copyTree(filepath.Join(moduleRoot, path), filepath.Join(root, path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := scaffold(root, n, false, false); err != nil {
+		t.Fatalf("scaffold() unexpected error: %v", err)
+	}
+	for _, name := range []string{"order.pb.go", "order_grpc.pb.go", "order.pb.gw.go"} {
+		if err := copyTree(filepath.Join(stubsDir, name), filepath.Join(root, "api/proto/v1", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(gotool, "vet", "./api/proto/v1", "./internal/repository", "./internal/service", "./internal/app/bootstrap")
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=readonly")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go vet of the scaffolded module failed: %v\n%s", err, out)
+	}
+}
+
+// copyTree copies the file or directory src to dst
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(target, content, 0o644)
+	})
+}
+
+func TestRegisterWithoutSelectVersions(t *testing.T) {
+	n, _ := newNames("Order", "")
+	if _, _, err := register([]byte("package bootstrap\n\nfunc main() {}\n"), n); err == nil {
+		t.Error("register() without a SelectVersions call expected error")
+	}
+}
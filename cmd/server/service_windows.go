@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceName is the event log source the service logs as
+const serviceName = "go-microservice-template"
+
+// Custom service control codes, sent with "sc.exe control <service> <code>"
+const (
+	controlDiagnostics svc.Cmd = 128
+	controlMaintenance svc.Cmd = 129
+)
+
+// runService runs serve under the service control manager, logging to the
+// event log. It reports false when the process was started interactively.
+func runService(serve func(context.Context, logger.Logger)) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, err
+	}
+	log, err := logger.NewEventLogger(serviceName)
+	if err != nil {
+		return true, err
+	}
+	defer log.Close()
+
+	if err := svc.Run(serviceName, &windowsService{serve: serve, log: log}); err != nil {
+		log.Error("Service failed: %v", err)
+		return true, err
+	}
+	return true, nil
+}
+
+// windowsService adapts serve to the service control manager
+type windowsService struct {
+	serve func(context.Context, logger.Logger)
+	log   logger.Logger
+}
+
+// Execute runs the server until it stops on its own or the service control
+// manager stops it
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.serve(ctx, s.log)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				changes <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				stop()
+			case controlDiagnostics:
+				request(diagnosticsRequests)
+			case controlMaintenance:
+				request(maintenanceRequests)
+			default:
+				s.log.Warn("Unexpected service control request %d", r.Cmd)
+			}
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+// Operator requests besides shutdown. On unix they arrive as signals, on
+// Windows as service control codes.
+var (
+	diagnosticsRequests = make(chan struct{}, 1)
+	maintenanceRequests = make(chan struct{}, 1)
+)
+
+// request queues a request on c unless one is already pending
+func request(c chan<- struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// shutdownSignals start a graceful shutdown
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// forwardSignals turns SIGUSR1 into a diagnostic dump request and SIGUSR2
+// into a maintenance mode toggle until ctx is done
+func forwardSignals(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case s := <-sig:
+			if s == syscall.SIGUSR1 {
+				request(diagnosticsRequests)
+			} else {
+				request(maintenanceRequests)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runService reports that the process is not a Windows service
+func runService(func(context.Context, logger.Logger)) (bool, error) {
+	return false, nil
+}
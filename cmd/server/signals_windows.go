@@ -0,0 +1,15 @@
+package main
+
+import (
+	"context"
+	"os"
+)
+
+// shutdownSignals start a graceful shutdown. Windows delivers only
+// os.Interrupt, on Ctrl+C or Ctrl+Break; services are stopped through the
+// service control manager instead.
+var shutdownSignals = []os.Signal{os.Interrupt}
+
+// forwardSignals does nothing: Windows has no user signals. Run as a
+// service, the process takes the same requests as control codes.
+func forwardSignals(ctx context.Context) {}
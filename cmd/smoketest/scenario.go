@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// scenario is the scripted CRUD run shared by both transports
+type scenario struct {
+	client     apiv1.UserServiceClient
+	httpClient *http.Client
+	baseURL    string
+	log        logger.Logger
+}
+
+// restEnvelope is the CommonResponse as rendered by the gateway
+type restEnvelope struct {
+	ErrorCode int32  `json:"errorCode"`
+	ErrorMsg  string `json:"errorMsg"`
+	Data      struct {
+		Result map[string]interface{} `json:"result"`
+	} `json:"data"`
+}
+
+// run executes the full scenario: gRPC CRUD, REST CRUD, then cross-checks
+func (s *scenario) run(ctx context.Context) error {
+	suffix := time.Now().UnixNano()
+	grpcEmail := fmt.Sprintf("smoke-grpc-%d@example.com", suffix)
+	restEmail := fmt.Sprintf("smoke-rest-%d@example.com", suffix)
+
+	var grpcName, restName string
+
+	return runSteps(ctx, s.log, []step{
+		{"health check", func(ctx context.Context) error {
+			resp, err := s.do(ctx, http.MethodGet, "/health", "")
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("status %d", resp.StatusCode)
+			}
+			return nil
+		}},
+		{"gRPC CreateUser", func(ctx context.Context) error {
+			resp, err := s.client.CreateUser(ctx, &apiv1.CreateUserRequest{
+				User: &apiv1.User{Email: grpcEmail, DisplayName: "Smoke gRPC"},
+			})
+			if err := expectCode(resp, err, response.CodeSuccess); err != nil {
+				return err
+			}
+			grpcName = resultString(resp, "name")
+			return expectEqual("email", resultString(resp, "email"), grpcEmail)
+		}},
+		{"gRPC GetUser", func(ctx context.Context) error {
+			resp, err := s.client.GetUser(ctx, &apiv1.GetUserRequest{Name: grpcName})
+			if err := expectCode(resp, err, response.CodeSuccess); err != nil {
+				return err
+			}
+			return expectEqual("email", resultString(resp, "email"), grpcEmail)
+		}},
+		{"gRPC UpdateUser", func(ctx context.Context) error {
+			resp, err := s.client.UpdateUser(ctx, &apiv1.UpdateUserRequest{
+				User:       &apiv1.User{Name: grpcName, DisplayName: "Smoke gRPC Updated"},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"display_name"}},
+			})
+			if err := expectCode(resp, err, response.CodeSuccess); err != nil {
+				return err
+			}
+			return expectEqual("display_name", resultString(resp, "display_name"), "Smoke gRPC Updated")
+		}},
+		{"REST CreateUser", func(ctx context.Context) error {
+			env, err := s.rest(ctx, http.MethodPost, "/v1/users",
+				fmt.Sprintf(`{"email":%q,"display_name":"Smoke REST"}`, restEmail), response.CodeSuccess)
+			if err != nil {
+				return err
+			}
+			restName, _ = env.Data.Result["name"].(string)
+			return expectEqual("email", env.Data.Result["email"], restEmail)
+		}},
+		{"REST GetUser sees gRPC user", func(ctx context.Context) error {
+			env, err := s.rest(ctx, http.MethodGet, "/v1/"+grpcName, "", response.CodeSuccess)
+			if err != nil {
+				return err
+			}
+			return expectEqual("display_name", env.Data.Result["display_name"], "Smoke gRPC Updated")
+		}},
+		{"REST UpdateUser", func(ctx context.Context) error {
+			env, err := s.rest(ctx, http.MethodPatch, "/v1/"+restName+"?update_mask=display_name",
+				`{"display_name":"Smoke REST Updated"}`, response.CodeSuccess)
+			if err != nil {
+				return err
+			}
+			return expectEqual("display_name", env.Data.Result["display_name"], "Smoke REST Updated")
+		}},
+		{"gRPC BatchGetUsers sees REST user", func(ctx context.Context) error {
+			resp, err := s.client.BatchGetUsers(ctx, &apiv1.BatchGetUsersRequest{Names: []string{grpcName, restName}})
+			if err := expectCode(resp, err, response.CodeSuccess); err != nil {
+				return err
+			}
+			users := resp.GetData().GetFields()["result"].GetStructValue().GetFields()["users"].GetListValue().GetValues()
+			return expectEqual("batch size", len(users), 2)
+		}},
+		{"REST ListUsers", func(ctx context.Context) error {
+			_, err := s.rest(ctx, http.MethodGet, "/v1/users?page_size=1", "", response.CodeSuccess)
+			return err
+		}},
+		{"REST DeleteUser", func(ctx context.Context) error {
+			_, err := s.rest(ctx, http.MethodDelete, "/v1/"+restName, "", response.CodeSuccess)
+			return err
+		}},
+		{"soft deleted users are kept", func(ctx context.Context) error {
+			env, err := s.rest(ctx, http.MethodGet, "/v1/"+restName, "", response.CodeSuccess)
+			if err != nil {
+				return err
+			}
+			return expectEqual("state", env.Data.Result["state"], "DELETED")
+		}},
+		{"REST UndeleteUser", func(ctx context.Context) error {
+			env, err := s.rest(ctx, http.MethodPost, "/v1/"+restName+":undelete", "{}", response.CodeSuccess)
+			if err != nil {
+				return err
+			}
+			return expectEqual("state", env.Data.Result["state"], "ACTIVE")
+		}},
+		{"REST DeleteUser force", func(ctx context.Context) error {
+			_, err := s.rest(ctx, http.MethodDelete, "/v1/"+restName+"?force=true", "", response.CodeSuccess)
+			return err
+		}},
+		{"gRPC DeleteUser force", func(ctx context.Context) error {
+			resp, err := s.client.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: grpcName, Force: true})
+			return expectCode(resp, err, response.CodeSuccess)
+		}},
+		{"deleted users are gone", func(ctx context.Context) error {
+			resp, err := s.client.GetUser(ctx, &apiv1.GetUserRequest{Name: restName})
+			if err := expectCode(resp, err, response.CodeNotFound); err != nil {
+				return err
+			}
+			_, err = s.rest(ctx, http.MethodGet, "/v1/"+grpcName, "", response.CodeNotFound)
+			return err
+		}},
+	})
+}
+
+// do sends an HTTP request to the gateway
+func (s *scenario) do(ctx context.Context, method, path, body string) (*http.Response, error) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.baseURL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return s.httpClient.Do(req)
+}
+
+// rest sends a request and decodes the envelope, checking its error code
+func (s *scenario) rest(ctx context.Context, method, path, body string, wantCode int32) (*restEnvelope, error) {
+	resp, err := s.do(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var env restEnvelope
+	if err := json.NewDecoder(bytes.NewReader(raw)).Decode(&env); err != nil {
+		return nil, fmt.Errorf("%s %s: invalid JSON %q: %w", method, path, raw, err)
+	}
+	if env.ErrorCode != wantCode {
+		return nil, fmt.Errorf("%s %s: error_code = %d (%s), want %d", method, path, env.ErrorCode, env.ErrorMsg, wantCode)
+	}
+	return &env, nil
+}
+
+// expectCode checks a gRPC call succeeded at transport level with wantCode
+func expectCode(resp *apiv1.CommonResponse, err error, wantCode int32) error {
+	if err != nil {
+		return err
+	}
+	if resp.GetErrorCode() != wantCode {
+		return fmt.Errorf("error_code = %d (%s), want %d", resp.GetErrorCode(), resp.GetErrorMsg(), wantCode)
+	}
+	return nil
+}
+
+// expectEqual reports a mismatch between got and want
+func expectEqual(field string, got, want interface{}) error {
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		return fmt.Errorf("%s = %v, want %v", field, got, want)
+	}
+	return nil
+}
+
+// resultString returns a string field of data.result
+func resultString(resp *apiv1.CommonResponse, field string) string {
+	return resp.GetData().GetFields()["result"].GetStructValue().GetFields()[field].GetStringValue()
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+)
+
+func TestScenario(t *testing.T) {
+	srv := testutil.NewServer(t)
+
+	s := &scenario{
+		client:     srv.Client,
+		httpClient: srv.HTTPClient,
+		baseURL:    srv.URL,
+		log:        testutil.NopLogger(),
+	}
+	if err := s.run(context.Background()); err != nil {
+		t.Fatalf("scenario failed against a healthy server: %v", err)
+	}
+}
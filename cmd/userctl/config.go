@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is userctl's configuration: named profiles of servers to
+// talk to and how
+type configFile struct {
+	// CurrentProfile is used unless --profile names another
+	CurrentProfile string `yaml:"current_profile,omitempty"`
+
+	Profiles map[string]*profile `yaml:"profiles,omitempty"`
+}
+
+// profile is a server and how to reach it. Unset fields take their
+// defaults, and flags override them.
+type profile struct {
+	// Transport is "grpc" (default) or "rest"
+	Transport string `yaml:"transport,omitempty"`
+
+	// GRPCAddr is the gRPC target (default localhost:9090)
+	GRPCAddr string `yaml:"grpc_addr,omitempty"`
+
+	// HTTPURL is the base URL of the HTTP gateway (default
+	// http://localhost:8080)
+	HTTPURL string `yaml:"http_url,omitempty"`
+
+	// Token is sent as a bearer token. TokenEnv names an environment
+	// variable holding it instead, to keep it out of the file.
+	Token    string `yaml:"token,omitempty"`
+	TokenEnv string `yaml:"token_env,omitempty"`
+
+	// Output is "table" (default) or "json"
+	Output string `yaml:"output,omitempty"`
+
+	// Timeout bounds each command (default 10s)
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// TLS secures gRPC connections; REST uses https URLs
+	TLS *tlsProfile `yaml:"tls,omitempty"`
+}
+
+// tlsProfile configures the TLS of gRPC connections
+type tlsProfile struct {
+	CAFile     string `yaml:"ca_file,omitempty"`
+	CertFile   string `yaml:"cert_file,omitempty"`
+	KeyFile    string `yaml:"key_file,omitempty"`
+	ServerName string `yaml:"server_name,omitempty"`
+}
+
+// defaultConfigPath is $USERCTL_CONFIG, or config.yaml in the userctl
+// directory of the user's configuration directory
+func defaultConfigPath() string {
+	if path := os.Getenv("USERCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "userctl", "config.yaml")
+}
+
+// loadConfig reads the configuration at path. A missing file is an empty
+// configuration.
+func loadConfig(path string) (*configFile, error) {
+	cfg := &configFile{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// save writes cfg to path, readable by the user only since profiles may
+// hold tokens
+func (cfg *configFile) save(path string) error {
+	if path == "" {
+		return errors.New("no config path, set --config or USERCTL_CONFIG")
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return nil
+}
+
+// profile returns the profile name, or the current one when name is
+// empty. Without profiles there is nothing to select, and the defaults
+// apply.
+func (cfg *configFile) profile(name string) (*profile, error) {
+	if name == "" {
+		name = cfg.CurrentProfile
+	}
+	if name == "" {
+		return &profile{}, nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return p, nil
+}
+
+// withDefaults returns p with its unset fields defaulted and its token
+// resolved
+func (p profile) withDefaults() profile {
+	if p.Transport == "" {
+		p.Transport = transportGRPC
+	}
+	if p.GRPCAddr == "" {
+		p.GRPCAddr = "localhost:9090"
+	}
+	if p.HTTPURL == "" {
+		p.HTTPURL = "http://localhost:8080"
+	}
+	if p.Token == "" && p.TokenEnv != "" {
+		p.Token = os.Getenv(p.TokenEnv)
+	}
+	if p.Token == "" {
+		p.Token = os.Getenv("USERCTL_TOKEN")
+	}
+	if p.Output == "" {
+		p.Output = outputTable
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = 10 * time.Second
+	}
+	return p
+}
@@ -0,0 +1,245 @@
+// Command userctl operates the user service from the command line, over
+// gRPC or the REST gateway:
+//
+//	userctl users create --email ada@example.com --display-name Ada
+//	userctl users get users/1
+//	userctl users list --filter 'state = ACTIVE' -o json
+//	userctl users update users/1 --display-name 'Ada Lovelace'
+//	userctl users delete users/1
+//
+// Servers and credentials are kept as named profiles in a config file,
+// managed with `userctl config`.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/status"
+)
+
+func main() {
+	if err := newRootCmd(os.Stdout).Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "userctl: %s\n", errorMessage(err))
+		os.Exit(1)
+	}
+}
+
+// errorMessage describes err, a status by its code and message
+func errorMessage(err error) string {
+	if st, ok := status.FromError(err); ok {
+		return fmt.Sprintf("%s: %s", st.Code(), st.Message())
+	}
+	return err.Error()
+}
+
+// options are the global flags
+type options struct {
+	configPath  string
+	profileName string
+
+	// flags holds the profile fields set by flags, which override the
+	// profile's
+	flags  profile
+	tls    tlsProfile
+	useTLS bool
+}
+
+func newRootCmd(stdout io.Writer) *cobra.Command {
+	return (&options{}).rootCmd(stdout)
+}
+
+// rootCmd returns the root command, setting o from the global flags
+func (o *options) rootCmd(stdout io.Writer) *cobra.Command {
+	root := &cobra.Command{
+		Use:           "userctl",
+		Short:         "Operate the user service over gRPC or REST",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.SetOut(stdout)
+
+	f := root.PersistentFlags()
+	f.StringVar(&o.configPath, "config", defaultConfigPath(), "config file (env USERCTL_CONFIG)")
+	f.StringVarP(&o.profileName, "profile", "p", "", "profile to use instead of the current one")
+	f.StringVar(&o.flags.Transport, "transport", "", "transport: grpc or rest")
+	f.StringVar(&o.flags.GRPCAddr, "grpc-addr", "", "gRPC target (default localhost:9090)")
+	f.StringVar(&o.flags.HTTPURL, "http-url", "", "HTTP gateway URL (default http://localhost:8080)")
+	f.StringVar(&o.flags.Token, "token", "", "bearer token (env USERCTL_TOKEN)")
+	f.StringVar(&o.flags.TokenEnv, "token-env", "", "environment variable holding the bearer token")
+	f.StringVarP(&o.flags.Output, "output", "o", "", "output: table or json")
+	f.DurationVar(&o.flags.Timeout, "timeout", 0, "timeout of each command (default 10s)")
+	f.BoolVar(&o.useTLS, "tls", false, "connect to gRPC with TLS")
+	f.StringVar(&o.tls.CAFile, "ca-file", "", "CA bundle to verify the gRPC server with (implies --tls)")
+	f.StringVar(&o.tls.CertFile, "cert-file", "", "client certificate for mutual TLS (implies --tls)")
+	f.StringVar(&o.tls.KeyFile, "key-file", "", "client key for mutual TLS")
+	f.StringVar(&o.tls.ServerName, "server-name", "", "name the gRPC server's certificate must have")
+
+	root.AddCommand(newUsersCmd(o), newConfigCmd(o))
+	return root
+}
+
+// overrides applies the flags set on cmd to p
+func (o *options) overrides(cmd *cobra.Command, p *profile) {
+	f := cmd.Flags()
+	for name, set := range map[string]func(){
+		"transport": func() { p.Transport = o.flags.Transport },
+		"grpc-addr": func() { p.GRPCAddr = o.flags.GRPCAddr },
+		"http-url":  func() { p.HTTPURL = o.flags.HTTPURL },
+		"token":     func() { p.Token = o.flags.Token },
+		"token-env": func() { p.TokenEnv = o.flags.TokenEnv },
+		"output":    func() { p.Output = o.flags.Output },
+		"timeout":   func() { p.Timeout = o.flags.Timeout },
+	} {
+		if f.Changed(name) {
+			set()
+		}
+	}
+	if o.useTLS || o.tls != (tlsProfile{}) {
+		if p.TLS == nil {
+			p.TLS = &tlsProfile{}
+		}
+		for _, field := range []struct {
+			dst *string
+			src string
+		}{
+			{&p.TLS.CAFile, o.tls.CAFile},
+			{&p.TLS.CertFile, o.tls.CertFile},
+			{&p.TLS.KeyFile, o.tls.KeyFile},
+			{&p.TLS.ServerName, o.tls.ServerName},
+		} {
+			if field.src != "" {
+				*field.dst = field.src
+			}
+		}
+	}
+}
+
+// profile returns the profile cmd runs with: the selected one with the
+// flags applied and defaults filled in
+func (o *options) profile(cmd *cobra.Command) (profile, error) {
+	cfg, err := loadConfig(o.configPath)
+	if err != nil {
+		return profile{}, err
+	}
+	selected, err := cfg.profile(o.profileName)
+	if err != nil {
+		return profile{}, err
+	}
+	p := *selected
+	if p.TLS != nil {
+		tls := *p.TLS
+		p.TLS = &tls
+	}
+	o.overrides(cmd, &p)
+	return p.withDefaults(), nil
+}
+
+// connect returns the profile cmd runs with, a context bounded by its
+// timeout, a transport and a printer
+func (o *options) connect(cmd *cobra.Command) (context.Context, context.CancelFunc, transport, *printer, error) {
+	p, err := o.profile(cmd)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	out, err := newPrinter(cmd.OutOrStdout(), p.Output)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	t, err := newTransport(p)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(cmd.Context(), p.Timeout)
+	return ctx, cancel, t, out, nil
+}
+
+func newConfigCmd(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage connection profiles",
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the profiles, marking the current one",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(o.configPath)
+			if err != nil {
+				return err
+			}
+			names := make([]string, 0, len(cfg.Profiles))
+			for name := range cfg.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				marker := " "
+				if name == cfg.CurrentProfile {
+					marker = "*"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", marker, name)
+			}
+			return nil
+		},
+	}
+
+	use := &cobra.Command{
+		Use:   "use PROFILE",
+		Short: "Make PROFILE the current profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(o.configPath)
+			if err != nil {
+				return err
+			}
+			if _, ok := cfg.Profiles[args[0]]; !ok {
+				return fmt.Errorf("unknown profile %q", args[0])
+			}
+			cfg.CurrentProfile = args[0]
+			return cfg.save(o.configPath)
+		},
+	}
+
+	set := &cobra.Command{
+		Use:   "set PROFILE",
+		Short: "Create PROFILE or update it with the connection flags given",
+		Long: "Create PROFILE or update it with the connection flags given, e.g.\n\n" +
+			"  userctl config set prod --grpc-addr users.example.com:443 --tls --token-env PROD_TOKEN\n\n" +
+			"The first profile becomes the current one.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(o.configPath)
+			if err != nil {
+				return err
+			}
+			if cfg.Profiles == nil {
+				cfg.Profiles = make(map[string]*profile)
+			}
+			p, ok := cfg.Profiles[args[0]]
+			if !ok {
+				p = &profile{}
+				cfg.Profiles[args[0]] = p
+			}
+			o.overrides(cmd, p)
+			if p.Transport != "" && p.Transport != transportGRPC && p.Transport != transportREST {
+				return fmt.Errorf("unknown transport %q, want grpc or rest", p.Transport)
+			}
+			if p.Output != "" && p.Output != outputTable && p.Output != outputJSON {
+				return fmt.Errorf("unknown output %q, want table or json", p.Output)
+			}
+			if cfg.CurrentProfile == "" {
+				cfg.CurrentProfile = args[0]
+			}
+			return cfg.save(o.configPath)
+		},
+	}
+
+	cmd.AddCommand(list, use, set)
+	return cmd
+}
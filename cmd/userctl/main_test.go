@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// userctl runs userctl with args and the config file at configPath,
+// returning its output
+func userctl(t *testing.T, configPath string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	cmd := newRootCmd(&out)
+	cmd.SetArgs(append([]string{"--config", configPath}, args...))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+// tokenRecorder records the authorization of the calls it intercepts
+type tokenRecorder struct {
+	mu     sync.Mutex
+	tokens []string
+}
+
+func (r *tokenRecorder) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.mu.Lock()
+	r.tokens = append(r.tokens, md.Get("authorization")...)
+	r.mu.Unlock()
+	return handler(ctx, req)
+}
+
+// serveGRPC starts a gRPC server with the user service, returning its
+// address
+func serveGRPC(t *testing.T, tokens *tokenRecorder) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(tokens.intercept))
+	apiv1.RegisterUserServiceServer(s, service.NewUserService())
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+// serveHTTP serves the testutil gateway on a real port, since userctl dials
+// its --http-url itself, returning its URL
+func serveHTTP(t *testing.T) string {
+	t.Helper()
+	ts := httptest.NewServer(testutil.NewServer(t).HTTPServer.Handler)
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestUsers(t *testing.T) {
+	tokens := &tokenRecorder{}
+	for transport, args := range map[string][]string{
+		"grpc": {"--transport", "grpc", "--grpc-addr", serveGRPC(t, tokens), "--token", "secret"},
+		"rest": {"--transport", "rest", "--http-url", serveHTTP(t)},
+	} {
+		t.Run(transport, func(t *testing.T) {
+			config := filepath.Join(t.TempDir(), "config.yaml")
+			run := func(cmd ...string) (string, error) {
+				t.Helper()
+				return userctl(t, config, append(args, cmd...)...)
+			}
+
+			out, err := run("users", "create", "--email", "ada@example.com", "--display-name", "Ada", "-o", "json")
+			if err != nil {
+				t.Fatalf("users create unexpected error: %v", err)
+			}
+			var created struct {
+				Name  string `json:"name"`
+				Email string `json:"email"`
+			}
+			if err := json.Unmarshal([]byte(out), &created); err != nil || created.Email != "ada@example.com" {
+				t.Fatalf("users create -o json = %s, want the user as JSON", out)
+			}
+
+			out, err = run("users", "get", strings.TrimPrefix(created.Name, "users/"))
+			if err != nil || !strings.Contains(out, "NAME") || !strings.Contains(out, created.Name+"  ada@example.com  Ada") {
+				t.Errorf("users get = %q, %v, want a table with the user", out, err)
+			}
+			if out, err := run("users", "get", "--email", "ada@example.com"); err != nil || !strings.Contains(out, created.Name) {
+				t.Errorf("users get --email = %q, %v, want the user", out, err)
+			}
+
+			if out, err := run("users", "update", created.Name, "--display-name", "Ada Lovelace"); err != nil || !strings.Contains(out, "Ada Lovelace") {
+				t.Errorf("users update = %q, %v, want the updated user", out, err)
+			}
+			if _, err := run("users", "update", created.Name); err == nil {
+				t.Error("users update without fields expected error")
+			}
+
+			run("users", "create", "--email", "grace@example.com")
+			out, err = run("users", "list", "--page-size", "1")
+			if err != nil || !strings.Contains(out, "ada@example.com") || !strings.Contains(out, "Next page: --page-token ") {
+				t.Errorf("users list --page-size 1 = %q, %v, want a page and its next token", out, err)
+			}
+			out, err = run("users", "list", "--page-size", "1", "--all", "-o", "json")
+			var page struct {
+				Users []json.RawMessage `json:"users"`
+			}
+			if err != nil || json.Unmarshal([]byte(out), &page) != nil || len(page.Users) != 2 {
+				t.Errorf("users list --all -o json = %s, %v, want 2 users", out, err)
+			}
+
+			if out, err := run("users", "delete", created.Name, "--force"); err != nil || out != created.Name+" deleted\n" {
+				t.Errorf("users delete = %q, %v, want %s deleted", out, err, created.Name)
+			}
+			_, err = run("users", "get", created.Name)
+			if status.Code(err) != codes.NotFound {
+				t.Errorf("users get of a deleted user error = %v, want NotFound", err)
+			}
+			if msg := errorMessage(err); !strings.HasPrefix(msg, "NotFound: ") {
+				t.Errorf("errorMessage() = %q, want NotFound: ...", msg)
+			}
+		})
+	}
+
+	for _, token := range tokens.tokens {
+		if token != "Bearer secret" {
+			t.Errorf("gRPC call sent authorization %q, want Bearer secret", token)
+		}
+	}
+	if len(tokens.tokens) == 0 {
+		t.Error("gRPC calls sent no token")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "userctl", "config.yaml")
+
+	if _, err := userctl(t, config, "config", "set", "local", "--grpc-addr", "localhost:9090"); err != nil {
+		t.Fatalf("config set unexpected error: %v", err)
+	}
+	if _, err := userctl(t, config, "config", "set", "prod", "--transport", "rest", "--http-url", "https://users.example.com", "--token-env", "PROD_TOKEN", "-o", "json"); err != nil {
+		t.Fatalf("config set unexpected error: %v", err)
+	}
+	if info, err := os.Stat(config); err != nil {
+		t.Errorf("config file unexpected error: %v", err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("config file mode = %v, want 0600", info.Mode().Perm())
+	}
+	if out, err := userctl(t, config, "config", "list"); err != nil || out != "* local\n  prod\n" {
+		t.Errorf("config list = %q, %v, want local current", out, err)
+	}
+	if _, err := userctl(t, config, "config", "use", "staging"); err == nil {
+		t.Error("config use of an unknown profile expected error")
+	}
+	if _, err := userctl(t, config, "config", "set", "bad", "--transport", "carrier-pigeon"); err == nil {
+		t.Error("config set with an unknown transport expected error")
+	}
+	if _, err := userctl(t, config, "config", "use", "prod"); err != nil {
+		t.Fatalf("config use unexpected error: %v", err)
+	}
+
+	// The current profile applies, with the flags given over it
+	t.Setenv("PROD_TOKEN", "prod-secret")
+	resolve := func(args ...string) profile {
+		t.Helper()
+		o := &options{}
+		root := o.rootCmd(&bytes.Buffer{})
+		cmd, rest, err := root.Find(append([]string{"users", "list", "--config", config}, args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.ParseFlags(rest); err != nil {
+			t.Fatal(err)
+		}
+		p, err := o.profile(cmd)
+		if err != nil {
+			t.Fatalf("profile(%q) unexpected error: %v", args, err)
+		}
+		return p
+	}
+	p := resolve()
+	if p.Transport != "rest" || p.HTTPURL != "https://users.example.com" || p.Token != "prod-secret" || p.Output != "json" || p.GRPCAddr != "localhost:9090" {
+		t.Errorf("current profile = %+v, want prod with defaults", p)
+	}
+	p = resolve("-o", "table", "--token", "flag-secret")
+	if p.Output != "table" || p.Token != "flag-secret" || p.Transport != "rest" {
+		t.Errorf("profile with flags = %+v, want prod with the flags' output and token", p)
+	}
+	p = resolve("--profile", "local", "--ca-file", "ca.crt")
+	if p.Transport != "grpc" || p.GRPCAddr != "localhost:9090" || p.TLS == nil || p.TLS.CAFile != "ca.crt" {
+		t.Errorf("local profile = %+v, want grpc with TLS", p)
+	}
+	if _, err := userctl(t, config, "--profile", "staging", "users", "list"); err == nil {
+		t.Error("users list with an unknown profile expected error")
+	}
+}
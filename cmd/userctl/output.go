@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// printer writes results in an output format
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// newPrinter returns a printer of format to w
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	if format != outputTable && format != outputJSON {
+		return nil, fmt.Errorf("unknown output %q, want table or json", format)
+	}
+	return &printer{w: w, format: format}, nil
+}
+
+// users prints users, and the token of the next page when there is one
+func (p *printer) users(users []*apiv1.User, nextPageToken string) error {
+	if p.format == outputJSON {
+		return p.json(&apiv1.ListUsersResponse{Users: users, NextPageToken: nextPageToken})
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tEMAIL\tDISPLAY NAME\tSTATE\tCREATED")
+	for _, u := range users {
+		created := ""
+		if u.GetCreateTime() != nil {
+			created = u.GetCreateTime().AsTime().Format(time.RFC3339)
+		}
+		state := u.GetState()
+		if state == apiv1.User_STATE_UNSPECIFIED {
+			state = apiv1.User_ACTIVE
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", u.GetName(), u.GetEmail(), u.GetDisplayName(), state, created)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if nextPageToken != "" {
+		_, err := fmt.Fprintf(p.w, "\nNext page: --page-token %s\n", nextPageToken)
+		return err
+	}
+	return nil
+}
+
+// user prints one user
+func (p *printer) user(u *apiv1.User) error {
+	if p.format == outputJSON {
+		return p.json(u)
+	}
+	return p.users([]*apiv1.User{u}, "")
+}
+
+// deleted reports the user name was deleted
+func (p *printer) deleted(name string) error {
+	if p.format == outputJSON {
+		_, err := fmt.Fprintf(p.w, "{\"name\": %q}\n", name)
+		return err
+	}
+	_, err := fmt.Fprintf(p.w, "%s deleted\n", name)
+	return err
+}
+
+// json prints m in protobuf JSON with proto field names
+func (p *printer) json(m proto.Message) error {
+	data, err := protojson.MarshalOptions{Multiline: true, UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(p.w, "%s\n", data)
+	return err
+}
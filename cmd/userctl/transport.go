@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/client"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails" // details of REST errors
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Transports
+const (
+	transportGRPC = "grpc"
+	transportREST = "rest"
+)
+
+// transport calls api.v1.UserService. Errors are gRPC statuses whichever
+// the transport.
+type transport interface {
+	CreateUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.User, error)
+	GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.User, error)
+	GetUserByEmail(ctx context.Context, req *apiv1.GetUserByEmailRequest) (*apiv1.User, error)
+	ListUsers(ctx context.Context, req *apiv1.ListUsersRequest) (*apiv1.ListUsersResponse, error)
+	UpdateUser(ctx context.Context, req *apiv1.UpdateUserRequest) (*apiv1.User, error)
+	DeleteUser(ctx context.Context, req *apiv1.DeleteUserRequest) error
+	Close() error
+}
+
+// newTransport returns the transport of p, which has its defaults
+func newTransport(p profile) (transport, error) {
+	switch p.Transport {
+	case transportGRPC:
+		opts := client.Options{Target: p.GRPCAddr, Token: p.Token, Timeout: p.Timeout}
+		if p.TLS != nil {
+			opts.TLS = &client.TLSOptions{
+				CAFile:     p.TLS.CAFile,
+				CertFile:   p.TLS.CertFile,
+				KeyFile:    p.TLS.KeyFile,
+				ServerName: p.TLS.ServerName,
+			}
+		}
+		c, err := client.New(opts)
+		if err != nil {
+			return nil, err
+		}
+		return grpcTransport{c}, nil
+	case transportREST:
+		u, err := url.Parse(p.HTTPURL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid HTTP URL %q", p.HTTPURL)
+		}
+		return &restTransport{baseURL: strings.TrimSuffix(p.HTTPURL, "/"), token: p.Token, http: &http.Client{Timeout: p.Timeout}}, nil
+	}
+	return nil, fmt.Errorf("unknown transport %q, want grpc or rest", p.Transport)
+}
+
+// grpcTransport calls the service over gRPC with pkg/client
+type grpcTransport struct {
+	c *client.Client
+}
+
+func (t grpcTransport) CreateUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.User, error) {
+	return t.c.CreateUser(ctx, req)
+}
+
+func (t grpcTransport) GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.User, error) {
+	return t.c.GetUser(ctx, req)
+}
+
+func (t grpcTransport) GetUserByEmail(ctx context.Context, req *apiv1.GetUserByEmailRequest) (*apiv1.User, error) {
+	return t.c.GetUserByEmail(ctx, req)
+}
+
+func (t grpcTransport) ListUsers(ctx context.Context, req *apiv1.ListUsersRequest) (*apiv1.ListUsersResponse, error) {
+	return t.c.ListUsers(ctx, req)
+}
+
+func (t grpcTransport) UpdateUser(ctx context.Context, req *apiv1.UpdateUserRequest) (*apiv1.User, error) {
+	return t.c.UpdateUser(ctx, req)
+}
+
+func (t grpcTransport) DeleteUser(ctx context.Context, req *apiv1.DeleteUserRequest) error {
+	return t.c.DeleteUser(ctx, req)
+}
+
+func (t grpcTransport) Close() error {
+	return t.c.Close()
+}
+
+// restTransport calls the service's REST routes on the HTTP gateway
+type restTransport struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func (t *restTransport) CreateUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.User, error) {
+	query := url.Values{}
+	if req.GetRequestId() != "" {
+		query.Set("request_id", req.GetRequestId())
+	}
+	return call(ctx, t, http.MethodPost, "/v1/users", query, req.GetUser(), &apiv1.User{})
+}
+
+func (t *restTransport) GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.User, error) {
+	path, err := userPath(req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return call(ctx, t, http.MethodGet, path, nil, nil, &apiv1.User{})
+}
+
+func (t *restTransport) GetUserByEmail(ctx context.Context, req *apiv1.GetUserByEmailRequest) (*apiv1.User, error) {
+	return call(ctx, t, http.MethodGet, "/v1/users:getByEmail", url.Values{"email": {req.GetEmail()}}, nil, &apiv1.User{})
+}
+
+func (t *restTransport) ListUsers(ctx context.Context, req *apiv1.ListUsersRequest) (*apiv1.ListUsersResponse, error) {
+	query := url.Values{}
+	if req.GetPageSize() != 0 {
+		query.Set("page_size", strconv.Itoa(int(req.GetPageSize())))
+	}
+	for key, value := range map[string]string{"page_token": req.GetPageToken(), "filter": req.GetFilter(), "order_by": req.GetOrderBy()} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if req.GetShowDeleted() {
+		query.Set("show_deleted", "true")
+	}
+	return call(ctx, t, http.MethodGet, "/v1/users", query, nil, &apiv1.ListUsersResponse{})
+}
+
+func (t *restTransport) UpdateUser(ctx context.Context, req *apiv1.UpdateUserRequest) (*apiv1.User, error) {
+	path, err := userPath(req.GetUser().GetName())
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if paths := req.GetUpdateMask().GetPaths(); len(paths) > 0 {
+		query.Set("update_mask", strings.Join(paths, ","))
+	}
+	return call(ctx, t, http.MethodPatch, path, query, req.GetUser(), &apiv1.User{})
+}
+
+func (t *restTransport) DeleteUser(ctx context.Context, req *apiv1.DeleteUserRequest) error {
+	path, err := userPath(req.GetName())
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	if req.GetForce() {
+		query.Set("force", "true")
+	}
+	_, err = t.do(ctx, http.MethodDelete, path, query, nil)
+	return err
+}
+
+func (t *restTransport) Close() error {
+	t.http.CloseIdleConnections()
+	return nil
+}
+
+// call sends a request with body and returns its result in dst
+func call[M proto.Message](ctx context.Context, t *restTransport, method, path string, query url.Values, body proto.Message, dst M) (M, error) {
+	resp, err := t.do(ctx, method, path, query, body)
+	if err != nil {
+		var zero M
+		return zero, err
+	}
+	return client.Decode(resp, dst)
+}
+
+// do sends a request with body, as JSON when set, and returns its
+// response. An error response, a google.rpc.Status or a CommonResponse
+// with an error code, is returned as its status.
+func (t *restTransport) do(ctx context.Context, method, path string, query url.Values, body proto.Message) (*apiv1.CommonResponse, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := protojson.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	target := t.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(response.PayloadHeader, response.PayloadAny)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	unmarshal := protojson.UnmarshalOptions{DiscardUnknown: true}
+	if resp.StatusCode != http.StatusOK {
+		var st spb.Status
+		if err := unmarshal.Unmarshal(data, &st); err == nil && st.GetCode() != 0 {
+			return nil, status.ErrorProto(&st)
+		}
+	}
+	var common apiv1.CommonResponse
+	if err := unmarshal.Unmarshal(data, &common); err != nil {
+		return nil, fmt.Errorf("%s %s: HTTP %d: %s", method, path, resp.StatusCode, bytes.TrimSpace(data))
+	}
+	if err := response.ToStatus(&common).Err(); err != nil {
+		return nil, err
+	}
+	return &common, nil
+}
+
+// userPath returns the REST path of the user name, e.g. /v1/users/1
+func userPath(name string) (string, error) {
+	id, ok := strings.CutPrefix(name, "users/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", fmt.Errorf("invalid user name %q, want users/{user}", name)
+	}
+	return "/v1/users/" + url.PathEscape(id), nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// userName returns the resource name of arg, a name or a bare ID
+func userName(arg string) string {
+	if strings.HasPrefix(arg, "users/") {
+		return arg
+	}
+	return "users/" + arg
+}
+
+// userFlags are the flags setting the fields of a user
+type userFlags struct {
+	email       string
+	displayName string
+	phoneNumber string
+}
+
+// userFields maps the flags of userFlags to the fields they set
+var userFields = map[string]string{
+	"email":        "email",
+	"display-name": "display_name",
+	"phone-number": "phone_number",
+}
+
+func (f *userFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.email, "email", "", "email address")
+	cmd.Flags().StringVar(&f.displayName, "display-name", "", "display name")
+	cmd.Flags().StringVar(&f.phoneNumber, "phone-number", "", "phone number")
+}
+
+func (f *userFlags) user() *apiv1.User {
+	return &apiv1.User{Email: f.email, DisplayName: f.displayName, PhoneNumber: f.phoneNumber}
+}
+
+func newUsersCmd(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "users",
+		Aliases: []string{"user"},
+		Short:   "Create, read, update and delete users",
+	}
+	cmd.AddCommand(
+		newCreateCmd(o),
+		newGetCmd(o),
+		newListCmd(o),
+		newUpdateCmd(o),
+		newDeleteCmd(o),
+	)
+	return cmd
+}
+
+func newCreateCmd(o *options) *cobra.Command {
+	var fields userFlags
+	var requestID string
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a user",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel, t, out, err := o.connect(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			defer t.Close()
+
+			user, err := t.CreateUser(ctx, &apiv1.CreateUserRequest{User: fields.user(), RequestId: requestID})
+			if err != nil {
+				return err
+			}
+			return out.user(user)
+		},
+	}
+	fields.register(cmd)
+	cmd.MarkFlagRequired("email")
+	cmd.Flags().StringVar(&requestID, "request-id", "", "ID making retries of the create safe")
+	return cmd
+}
+
+func newGetCmd(o *options) *cobra.Command {
+	var email string
+	cmd := &cobra.Command{
+		Use:   "get [NAME]",
+		Short: "Get a user by name, e.g. users/1 or 1, or by --email",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 1) == (email != "") {
+				return errors.New("give either a user name or --email")
+			}
+			ctx, cancel, t, out, err := o.connect(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			defer t.Close()
+
+			var user *apiv1.User
+			if email != "" {
+				user, err = t.GetUserByEmail(ctx, &apiv1.GetUserByEmailRequest{Email: email})
+			} else {
+				user, err = t.GetUser(ctx, &apiv1.GetUserRequest{Name: userName(args[0])})
+			}
+			if err != nil {
+				return err
+			}
+			return out.user(user)
+		},
+	}
+	cmd.Flags().StringVar(&email, "email", "", "email address of the user")
+	return cmd
+}
+
+func newListCmd(o *options) *cobra.Command {
+	req := &apiv1.ListUsersRequest{}
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List users",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel, t, out, err := o.connect(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			defer t.Close()
+
+			var users []*apiv1.User
+			for {
+				page, err := t.ListUsers(ctx, req)
+				if err != nil {
+					return err
+				}
+				users = append(users, page.GetUsers()...)
+				if !all || page.GetNextPageToken() == "" {
+					return out.users(users, page.GetNextPageToken())
+				}
+				req.PageToken = page.GetNextPageToken()
+			}
+		},
+	}
+	f := cmd.Flags()
+	f.Int32Var(&req.PageSize, "page-size", 0, "users per page (server default 50)")
+	f.StringVar(&req.PageToken, "page-token", "", "token of the page to list")
+	f.StringVar(&req.Filter, "filter", "", "AIP-160 filter, e.g. 'email:\"*@example.com\"'")
+	f.StringVar(&req.OrderBy, "order-by", "", "sort order, e.g. 'create_time desc'")
+	f.BoolVar(&req.ShowDeleted, "show-deleted", false, "include soft deleted users")
+	f.BoolVar(&all, "all", false, "list every page")
+	return cmd
+}
+
+func newUpdateCmd(o *options) *cobra.Command {
+	var fields userFlags
+	cmd := &cobra.Command{
+		Use:   "update NAME",
+		Short: "Update the fields of a user given by flags",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user := fields.user()
+			user.Name = userName(args[0])
+			mask := &fieldmaskpb.FieldMask{}
+			for flag, field := range userFields {
+				if cmd.Flags().Changed(flag) {
+					mask.Paths = append(mask.Paths, field)
+				}
+			}
+			if len(mask.Paths) == 0 {
+				return errors.New("nothing to update, set --email, --display-name or --phone-number")
+			}
+			mask.Normalize()
+
+			ctx, cancel, t, out, err := o.connect(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			defer t.Close()
+
+			updated, err := t.UpdateUser(ctx, &apiv1.UpdateUserRequest{User: user, UpdateMask: mask})
+			if err != nil {
+				return err
+			}
+			return out.user(updated)
+		},
+	}
+	fields.register(cmd)
+	return cmd
+}
+
+func newDeleteCmd(o *options) *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "delete NAME",
+		Short: "Soft delete a user, or delete it for good with --force",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel, t, out, err := o.connect(cmd)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			defer t.Close()
+
+			name := userName(args[0])
+			if err := t.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: name, Force: force}); err != nil {
+				return err
+			}
+			return out.deleted(name)
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "delete for good instead of soft deleting")
+	return cmd
+}
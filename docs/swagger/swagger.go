@@ -0,0 +1,11 @@
+// Package swagger embeds the Swagger UI page and the OpenAPI specs
+// generated from the protos (make proto), so the server does not depend on
+// its working directory to serve them
+package swagger
+
+import "embed"
+
+// FS holds index.html and the generated *.swagger.json specs
+//
+//go:embed index.html *.swagger.json
+var FS embed.FS
@@ -0,0 +1,225 @@
+// Package app holds the API services the server exposes. Each Service
+// registers itself with the gRPC server, the gRPC-Gateway and the HTTP mux,
+// and a Registry hands them all to the servers, so adding a proto service
+// is one NewService entry in bootstrap.buildServices rather than an edit to
+// every server.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Service is an API service the server exposes
+type Service interface {
+	// Name is the service's full proto name, e.g. api.v1.UserService
+	Name() string
+
+	// RegisterGRPC registers the implementation with the gRPC server
+	RegisterGRPC(s grpc.ServiceRegistrar)
+
+	// RegisterGateway registers the service's REST routes, proxied to the
+	// gRPC server over conn
+	RegisterGateway(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+
+	// RegisterHTTP registers routes served outside the gateway
+	RegisterHTTP(mux *http.ServeMux)
+}
+
+// GatewayFunc registers a service's REST routes, e.g. the generated
+// apiv1.RegisterUserServiceHandler
+type GatewayFunc func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+
+// generated is a Service made of generated registration code
+type generated struct {
+	desc    *grpc.ServiceDesc
+	impl    interface{}
+	gateway GatewayFunc
+}
+
+// NewService adapts a generated service: its descriptor, e.g.
+// &apiv1.UserService_ServiceDesc, its implementation and its gateway
+// registration. gateway may be nil for services without REST routes. The
+// service has no HTTP routes of its own; embed it in a type overriding
+// RegisterHTTP to add some.
+func NewService(desc *grpc.ServiceDesc, impl interface{}, gateway GatewayFunc) Service {
+	return &generated{desc: desc, impl: impl, gateway: gateway}
+}
+
+func (s *generated) Name() string { return s.desc.ServiceName }
+
+func (s *generated) RegisterGRPC(r grpc.ServiceRegistrar) {
+	r.RegisterService(s.desc, s.impl)
+}
+
+func (s *generated) RegisterGateway(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+	if s.gateway == nil {
+		return nil
+	}
+	return s.gateway(ctx, mux, conn)
+}
+
+func (s *generated) RegisterHTTP(*http.ServeMux) {}
+
+// Registry holds the services the server exposes, in registration order.
+// Services are registered before the servers start; it is not safe for
+// concurrent use.
+type Registry struct {
+	services    []Service
+	descriptors []protoreflect.ServiceDescriptor
+}
+
+// NewRegistry creates a Registry holding services
+func NewRegistry(services ...Service) (*Registry, error) {
+	r := &Registry{}
+	for _, s := range services {
+		if err := r.Register(s); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds a service. Names must be unique and name a service in the
+// linked proto files, which the JSON-RPC, Twirp and Connect handlers
+// describe it with.
+func (r *Registry) Register(s Service) error {
+	if s.Name() == "" {
+		return errors.New("app: a service needs a name")
+	}
+	for _, registered := range r.services {
+		if registered.Name() == s.Name() {
+			return fmt.Errorf("app: %q already registered", s.Name())
+		}
+	}
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(s.Name()))
+	if err != nil {
+		return fmt.Errorf("app: %s: %w", s.Name(), err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return fmt.Errorf("app: %s is not a service", s.Name())
+	}
+	r.services = append(r.services, s)
+	r.descriptors = append(r.descriptors, sd)
+	return nil
+}
+
+// Versions returns the API versions of the registered services, e.g. v1
+// and v2, in the order they were first registered
+func (r *Registry) Versions() []string {
+	var versions []string
+	for _, s := range r.services {
+		if v := Version(s); v != "" && !slices.Contains(versions, v) {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// Services returns the registered services
+func (r *Registry) Services() []Service {
+	return r.services
+}
+
+// Descriptors returns the registered services' proto descriptors
+func (r *Registry) Descriptors() []protoreflect.ServiceDescriptor {
+	return r.descriptors
+}
+
+// RegisterGRPC registers every service with the gRPC server
+func (r *Registry) RegisterGRPC(s grpc.ServiceRegistrar) {
+	for _, svc := range r.services {
+		svc.RegisterGRPC(s)
+	}
+}
+
+// RegisterGateway registers every service's REST routes
+func (r *Registry) RegisterGateway(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+	for _, svc := range r.services {
+		if err := svc.RegisterGateway(ctx, mux, conn); err != nil {
+			return fmt.Errorf("register %s gateway: %w", svc.Name(), err)
+		}
+	}
+	return nil
+}
+
+// RegisterHTTP registers every service's HTTP routes
+func (r *Registry) RegisterHTTP(mux *http.ServeMux) {
+	for _, svc := range r.services {
+		svc.RegisterHTTP(mux)
+	}
+}
+
+// versionPattern matches the version prefix of a REST route, e.g. /v2/
+var versionPattern = regexp.MustCompile(`^/(v[0-9]+)/`)
+
+// Version returns the API version of s, the prefix of its REST routes, e.g.
+// v2 for api.v2.UserService under /v2. Services without REST routes, such
+// as health checks, have none.
+func Version(s Service) string {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(s.Name()))
+	if err != nil {
+		return ""
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return ""
+	}
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		rule, ok := proto.GetExtension(methods.Get(i).Options(), annotations.E_Http).(*annotations.HttpRule)
+		if !ok || rule == nil {
+			continue
+		}
+		var path string
+		switch p := rule.GetPattern().(type) {
+		case *annotations.HttpRule_Get:
+			path = p.Get
+		case *annotations.HttpRule_Post:
+			path = p.Post
+		case *annotations.HttpRule_Put:
+			path = p.Put
+		case *annotations.HttpRule_Patch:
+			path = p.Patch
+		case *annotations.HttpRule_Delete:
+			path = p.Delete
+		case *annotations.HttpRule_Custom:
+			path = p.Custom.GetPath()
+		}
+		if m := versionPattern.FindStringSubmatch(path); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// SelectVersions returns the services of the listed API versions, so
+// versions are served side by side and retired one at a time. Services
+// without a version are always kept. Listing a version no service has is
+// an error.
+func SelectVersions(versions []string, services ...Service) ([]Service, error) {
+	for _, v := range versions {
+		if !slices.ContainsFunc(services, func(s Service) bool { return Version(s) == v }) {
+			return nil, fmt.Errorf("app: no service has API version %q", v)
+		}
+	}
+	var selected []Service
+	for _, s := range services {
+		if v := Version(s); v == "" || slices.Contains(versions, v) {
+			selected = append(selected, s)
+		}
+	}
+	return selected, nil
+}
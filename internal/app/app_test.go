@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	apiv2 "github.com/ChyiYaqing/go-microservice-template/api/proto/v2"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// withStatus adds an HTTP route to a generated service
+type withStatus struct {
+	Service
+}
+
+func (s withStatus) RegisterHTTP(mux *http.ServeMux) {
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	users := NewService(&apiv1.UserService_ServiceDesc, apiv1.UnimplementedUserServiceServer{}, apiv1.RegisterUserServiceHandler)
+	tasks := withStatus{NewService(&apiv1.TaskService_ServiceDesc, apiv1.UnimplementedTaskServiceServer{}, nil)}
+	r, err := NewRegistry(users, tasks)
+	if err != nil {
+		t.Fatalf("NewRegistry() unexpected error: %v", err)
+	}
+
+	if err := r.Register(users); err == nil {
+		t.Error("Register() of a registered service expected error")
+	}
+	unknown := NewService(&grpc.ServiceDesc{ServiceName: "api.v1.NoSuchService"}, nil, nil)
+	if err := r.Register(unknown); err == nil {
+		t.Error("Register() of a service missing from the proto files expected error")
+	}
+
+	descriptors := r.Descriptors()
+	if len(descriptors) != 2 || descriptors[0].FullName() != "api.v1.UserService" || descriptors[1].FullName() != "api.v1.TaskService" {
+		t.Errorf("Descriptors() = %v, want UserService and TaskService in order", descriptors)
+	}
+
+	grpcServer := grpc.NewServer()
+	r.RegisterGRPC(grpcServer)
+	if info := grpcServer.GetServiceInfo(); len(info) != 2 {
+		t.Errorf("RegisterGRPC() registered %d services, want 2", len(info))
+	}
+
+	if err := r.RegisterGateway(context.Background(), runtime.NewServeMux(), nil); err != nil {
+		t.Errorf("RegisterGateway() unexpected error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	r.RegisterHTTP(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("GET /status = %d, want the embedding service's route", rec.Code)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	users := NewService(&apiv1.UserService_ServiceDesc, apiv1.UnimplementedUserServiceServer{}, nil)
+	tasks := NewService(&apiv1.TaskService_ServiceDesc, apiv1.UnimplementedTaskServiceServer{}, nil)
+	usersV2 := NewService(&apiv2.UserService_ServiceDesc, apiv2.UnimplementedUserServiceServer{}, nil)
+	health := NewService(&grpc_health_v1.Health_ServiceDesc, nil, nil)
+
+	for s, want := range map[Service]string{users: "v1", usersV2: "v2", health: ""} {
+		if got := Version(s); got != want {
+			t.Errorf("Version(%s) = %q, want %q", s.Name(), got, want)
+		}
+	}
+
+	r, err := NewRegistry(users, usersV2, tasks, health)
+	if err != nil {
+		t.Fatalf("NewRegistry() unexpected error: %v", err)
+	}
+	if got := r.Versions(); !slices.Equal(got, []string{"v1", "v2"}) {
+		t.Errorf("Versions() = %v, want v1 and v2", got)
+	}
+
+	selected, err := SelectVersions([]string{"v2"}, users, usersV2, tasks, health)
+	if err != nil {
+		t.Fatalf("SelectVersions() unexpected error: %v", err)
+	}
+	var names []string
+	for _, s := range selected {
+		names = append(names, s.Name())
+	}
+	if !slices.Equal(names, []string{"api.v2.UserService", "grpc.health.v1.Health"}) {
+		t.Errorf("SelectVersions(v2) = %v, want v2 and the unversioned services", names)
+	}
+	if _, err := SelectVersions([]string{"v3"}, users, usersV2); err == nil {
+		t.Error("SelectVersions() of a version no service has expected error")
+	}
+}
@@ -0,0 +1,121 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/maintenance"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/middleware"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/settings"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/toggle"
+)
+
+// buildAdmin creates what the admin API operates on, maintenance mode,
+// the runtime settings and the debug toggles, and the admin service
+func (a *App) buildAdmin() error {
+	cfg, log := a.cfg, a.log
+
+	// Maintenance mode rejects writes while reads continue. Admin calls are
+	// exempt so it can be turned off again. SIGUSR2, or service control
+	// code 129 on Windows, toggles it too.
+	a.maintenance = maintenance.New(cfg.Maintenance.RetryAfter, nil)
+	if cfg.Maintenance.Enabled {
+		a.maintenance.Set(true, cfg.Maintenance.Reason)
+		log.Warn("Starting in maintenance mode: %s", cfg.Maintenance.Reason)
+	}
+	a.interceptors.Register(middleware.Interceptor{Name: "maintenance", Order: orderMaintenance, Unary: a.maintenance.UnaryServerInterceptor(a.mutations, "/api.v1.AdminService/")})
+	go toggleMaintenanceOnRequest(a.ctx, a.opts.MaintenanceRequests, a.maintenance, cfg.Maintenance.Reason, log)
+
+	var err error
+	if a.settings, err = newSettings(cfg, log, a.maintenance); err != nil {
+		return fmt.Errorf("failed to register runtime settings: %w", err)
+	}
+
+	// Reflection stays registered and is hidden while its toggle is off, so
+	// the admin API can turn it on for a debugging session
+	reflectionToggle := toggle.New("reflection", "gRPC server reflection, for grpcurl and similar tools", !cfg.Server.Reflection.Disabled, cfg.Server.Reflection.MaxTTL, nil)
+	if a.toggles, err = toggle.NewRegistry(reflectionToggle); err != nil {
+		return fmt.Errorf("failed to register debug toggles: %w", err)
+	}
+	a.interceptors.Register(middleware.Interceptor{Name: "reflection", Order: orderReflection, Stream: reflectionToggle.StreamServerInterceptor("/grpc.reflection.")})
+
+	adminOpts := []service.AdminOption{
+		service.WithJobQueue(a.jobQueue),
+		service.WithWebhookQueue(a.webhookQueue),
+		service.WithMaintenanceMode(a.maintenance),
+		service.WithSettings(a.settings),
+		service.WithDebugToggles(a.toggles),
+		service.WithInstanceInfo(a.info),
+		service.WithUserStore(a.userRepo, a.ids),
+	}
+
+	// While the admin API is open to anyone it only reports: every change
+	// is refused, and so is a state dump, which reads every user
+	if a.adminAuth == nil {
+		log.Warn("No admin tokens configured, the admin API is read-only and state dumps are disabled")
+		adminOpts = append(adminOpts, service.WithReadOnly())
+	}
+	a.admin = service.NewAdminService(adminOpts...)
+	return nil
+}
+
+// newSettings registers the settings the admin API can change at runtime
+func newSettings(cfg *config.Config, log logger.Logger, maintenanceMode *maintenance.Mode) (*settings.Registry, error) {
+	reg := settings.NewRegistry()
+	if l, ok := log.(logger.Leveled); ok {
+		err := reg.Register(settings.Setting{
+			Name:        "log_level",
+			Description: "Minimum level logged: debug, info, warn or error",
+			Get:         func() string { return l.Level().String() },
+			Set: func(v string) error {
+				level, err := logger.ParseLevel(v)
+				if err != nil {
+					return err
+				}
+				l.SetLevel(level)
+				return nil
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := reg.Register(settings.Setting{
+		Name:        "maintenance",
+		Description: "Whether writes are rejected for maintenance: true or false",
+		Get:         func() string { return strconv.FormatBool(maintenanceMode.State().Enabled) },
+		Set: func(v string) error {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("maintenance must be true or false")
+			}
+			maintenanceMode.Set(enabled, cfg.Maintenance.Reason)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// toggleMaintenanceOnRequest flips maintenance mode on every request until
+// ctx is done
+func toggleMaintenanceOnRequest(ctx context.Context, requests <-chan struct{}, mode *maintenance.Mode, reason string, log logger.Logger) {
+	for {
+		select {
+		case <-requests:
+			if mode.Toggle(reason).Enabled {
+				log.Warn("Maintenance mode enabled by operator request, writes are rejected")
+			} else {
+				log.Info("Maintenance mode disabled by operator request")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,381 @@
+// Package bootstrap builds the server from its configuration. Each
+// subsystem, from the stores and background jobs to the interceptors, the
+// admin API and the servers, has a builder of its own. New runs them in
+// order and Run starts what they built, serving until shutdown.
+package bootstrap
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/app"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/internal/server"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/audit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/autotune"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/diagnostics"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/events"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/health"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/instance"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lifecycle"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/maintenance"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/metrics"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/middleware"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mutation"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/ratelimit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/scheduler"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/settings"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/shed"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/toggle"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/tracing"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/watchdog"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/worker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Options are what the process passes in besides the configuration
+type Options struct {
+	// ConfigPath is the file the configuration was loaded from, if any. It
+	// names the instance profile and is watched for changes.
+	ConfigPath string
+
+	// Reload loads the configuration again when the config file changes,
+	// keeping environment variables and flags on top of it
+	Reload func() (*config.Config, error)
+
+	// Signals start a graceful shutdown
+	Signals []os.Signal
+
+	// DiagnosticsRequests and MaintenanceRequests carry operator requests
+	// for a diagnostic dump and for toggling maintenance mode
+	DiagnosticsRequests, MaintenanceRequests <-chan struct{}
+}
+
+// App is the server built from a configuration
+type App struct {
+	cfg  *config.Config
+	log  logger.Logger
+	opts Options
+	lc   *lifecycle.Manager
+	ctx  context.Context
+
+	// serverBudget is how long the servers may take to drain
+	serverBudget time.Duration
+
+	info      *instance.Info
+	workers   *worker.Pool
+	auditSink audit.Sink
+	userRepo  repository.UserRepository
+	ids       idgen.Generator
+
+	elector      *lock.Elector
+	jobs         *scheduler.Scheduler
+	jobQueue     *queue.Queue
+	webhookQueue *queue.Queue
+	userEvents   *events.Bus[service.UserEvent]
+	userService  *service.UserService
+
+	interceptors   *middleware.Registry
+	mutations      mutation.Set
+	requests       *diagnostics.Tracker
+	tracer         *tracing.Tracer
+	requestMetrics *metrics.Metrics
+	shedder        *shed.Shedder
+	adminAuth      *auth.TokenAuthenticator
+	rateLimits     *ratelimit.Interceptor
+	httpRateLimits *ratelimit.Interceptor
+	auditLog       *audit.Buffer
+
+	maintenance *maintenance.Mode
+	settings    *settings.Registry
+	toggles     *toggle.Registry
+	admin       *service.AdminService
+
+	dog      *watchdog.Watchdog
+	checker  *health.Checker
+	services *app.Registry
+
+	serveGRPC, serveHTTP bool
+	inProcess            *server.InProcess
+	grpcServer           *grpc.Server
+	gatewayCreds         credentials.TransportCredentials
+	gatewayDialOpts      []grpc.DialOption
+	httpTLS              *tls.Config
+	httpProtocols        http.Protocols
+	httpOpts             []server.HTTPOption
+	drain                *server.DrainState
+	warm                 *server.WarmupState
+	grpcLis, httpLis     net.Listener
+	httpServer           *http.Server
+	gatewayConn          *grpc.ClientConn
+
+	errMu sync.Mutex
+	err   error
+}
+
+// New builds the server cfg describes, logging to log, until parent is
+// done. Nothing serves until Run.
+func New(parent context.Context, cfg *config.Config, log logger.Logger, opts Options) (*App, error) {
+	configureLogger(log, cfg.Log)
+
+	// Components register lifecycle hooks as they are created. They start
+	// together once all are, and stop in reverse on a shutdown signal: the
+	// servers drain first, and whatever they leave of their share of the
+	// budget carries over to the background workers.
+	serverBudget, shutdownTimeout := shutdownBudget(cfg.Shutdown)
+	lc := lifecycle.New(parent, log, lifecycle.Options{
+		Signals:    opts.Signals,
+		DrainDelay: cfg.Shutdown.DrainDelay,
+		Timeout:    shutdownTimeout,
+	})
+	a := &App{cfg: cfg, log: log, opts: opts, lc: lc, ctx: lc.Context(), serverBudget: serverBudget}
+
+	for _, build := range []func() error{
+		a.buildRuntime,
+		a.buildStores,
+		a.buildJobs,
+		a.buildUsers,
+		a.buildInterceptors,
+		a.buildAdmin,
+		a.buildMonitors,
+		a.buildServices,
+		a.buildServers,
+	} {
+		if err := build(); err != nil {
+			// End the goroutines started so far
+			lc.Shutdown()
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Context ends when shutdown begins
+func (a *App) Context() context.Context {
+	return a.ctx
+}
+
+// Run starts the components and servers and serves until parent is done
+// or a shutdown signal arrives, then shuts them down. It returns why the
+// app could not start, or why a server stopped serving early.
+func (a *App) Run() error {
+	if err := a.listen(); err != nil {
+		return err
+	}
+
+	// Start what was registered so far, before the servers take traffic
+	if err := a.lc.Start(); err != nil {
+		a.grpcLis.Close()
+		if a.httpLis != nil {
+			a.httpLis.Close()
+		}
+		return err
+	}
+	if err := a.startServers(); err != nil {
+		a.lc.Shutdown()
+		a.lc.Wait()
+		return err
+	}
+
+	a.log.Info("Server started successfully")
+	if a.serveGRPC {
+		a.log.Info("gRPC server listening on %s", a.grpcLis.Addr())
+	} else {
+		a.log.Info("gRPC server serving the gateway in-process only")
+	}
+	if a.serveHTTP {
+		a.log.Info("HTTP server listening on %s", a.httpLis.Addr())
+		a.log.Info("Swagger UI available at http://%s/swagger/", a.httpLis.Addr())
+	} else {
+		a.log.Info("HTTP server disabled")
+	}
+
+	a.reportReady()
+
+	// Serve until a shutdown signal, then stop in reverse
+	a.lc.Wait()
+
+	a.errMu.Lock()
+	defer a.errMu.Unlock()
+	return a.err
+}
+
+// fail shuts the app down for err, which Run returns
+func (a *App) fail(err error) {
+	a.errMu.Lock()
+	if a.err == nil {
+		a.err = err
+	}
+	a.errMu.Unlock()
+	a.lc.Shutdown()
+}
+
+// configureLogger applies the level and format of cfg to log where it
+// supports them
+func configureLogger(log logger.Logger, cfg config.LogConfig) {
+	if l, ok := log.(logger.Leveled); ok {
+		level, err := logger.ParseLevel(cfg.Level)
+		if err != nil {
+			log.Warn("Invalid log level, logging everything: %v", err)
+		} else {
+			l.SetLevel(level)
+		}
+	}
+	if l, ok := log.(logger.Formatted); ok && cfg.Format != "" {
+		if err := l.SetFormat(cfg.Format); err != nil {
+			log.Warn("Invalid log format, keeping text: %v", err)
+		}
+	}
+}
+
+// buildRuntime sizes the runtime to the container, describes the instance
+// and creates the worker pool
+func (a *App) buildRuntime() error {
+	cfg, log := a.cfg, a.log
+
+	// Size the runtime to the container's CPU and memory limits
+	limits, err := autotune.Detect(os.DirFS("/sys/fs/cgroup"))
+	if err != nil {
+		log.Warn("Failed to read cgroup limits: %v", err)
+	}
+	tuned := autotune.Apply(limits, autotune.Options{
+		GOMAXPROCS:       cfg.Runtime.GOMAXPROCS,
+		MemoryLimit:      cfg.Runtime.MemoryLimit,
+		MemoryLimitRatio: cfg.Runtime.MemoryLimitRatio,
+	})
+	log.Info("Runtime GOMAXPROCS=%d (%s), GOMEMLIMIT=%s (%s)",
+		tuned.GOMAXPROCS, tuned.GOMAXPROCSSource, autotune.FormatBytes(tuned.MemoryLimit), tuned.MemoryLimitSource)
+
+	// Describe this instance for the admin API
+	a.info = instance.New(context.Background(), instance.Options{
+		Profile:           configProfile(cfg.Instance.Profile, a.opts.ConfigPath),
+		ConfigFingerprint: cfg.Fingerprint(),
+		Features:          cfg.Features(),
+		Zone:              cfg.Instance.Zone,
+		Metadata:          cfg.Instance.Metadata,
+	}, nil)
+	log.Info("Config fingerprint %s, version %s, fingerprint %s", a.info.ConfigFingerprint, a.info.Version, a.info.Fingerprint)
+
+	// Background workers
+	a.workers = worker.NewPool(worker.Options{
+		Name:      "default",
+		Workers:   cfg.Worker.Workers,
+		QueueSize: cfg.Worker.QueueSize,
+	}, log)
+	a.lc.Register(lifecycle.Hook{Name: "worker pool", Priority: priorityWorkers, Start: a.workers.Start, Stop: a.workers.Stop})
+	return nil
+}
+
+// configProfile returns profile, or else the name of the config file in
+// args without its extension, or "default" when there is none
+func configProfile(profile string, path string) string {
+	if profile != "" {
+		return profile
+	}
+	if path != "" {
+		base := filepath.Base(path)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return "default"
+}
+
+// Lifecycle hook priorities: components start in ascending order and stop
+// in descending order, those of equal priority together. Consumed commands
+// emit events, event subscribers may enqueue jobs and queued jobs send
+// email, so each drains before what it feeds; stores close last, once
+// nothing uses them.
+const (
+	priorityStores = iota
+	priorityTracing
+	priorityMonitors
+	priorityWorkers
+	priorityScheduler
+	priorityMailer
+	priorityQueues
+	priorityEvents
+	priorityConsumers
+	priorityInternal
+	priorityServers
+	priorityStreams
+)
+
+// Interceptor orders: lower runs first and wraps those after, all between
+// the request ID, logging and response handling of server.NewInterceptors
+// and validation. Metrics count shed calls; authentication comes before
+// what acts on the caller's identity, and normalization right before the
+// handlers.
+const (
+	orderDiagnostics = iota * 10
+	orderTracing
+	orderMetrics
+	orderShed
+	orderAdminAuth
+	orderAuthz
+	orderFreeze
+	orderRateLimit
+	orderTenancy
+	orderRedaction
+	orderAudit
+	orderMaintenance
+	orderReflection
+	orderProfiling
+	orderNormalize
+	orderChaos
+)
+
+// tracingFlushTimeout bounds the export of the last spans at shutdown
+const tracingFlushTimeout = 3 * time.Second
+
+// shutdownBudget returns how long the servers may take to drain and the
+// time allowed for the whole shutdown, which reserves the workers' share
+func shutdownBudget(cfg config.ShutdownConfig) (time.Duration, time.Duration) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	share := min(max(cfg.WorkerShare, 0), 1)
+	servers := time.Duration(float64(timeout) * (1 - share))
+	return servers, timeout
+}
+
+// startFunc adapts a Start method that cannot fail to a lifecycle hook
+func startFunc(start func(context.Context)) func(context.Context) error {
+	return func(ctx context.Context) error {
+		start(ctx)
+		return nil
+	}
+}
+
+// closeFunc adapts a Close method to a lifecycle hook
+func closeFunc(c io.Closer) func(context.Context) error {
+	return func(context.Context) error { return c.Close() }
+}
+
+// serveInternal returns a lifecycle hook serving srv, an internal endpoint
+// for what, whose failure is logged without stopping the app
+func serveInternal(log logger.Logger, what string, srv *http.Server) func(context.Context) error {
+	return func(context.Context) error {
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("Failed to serve %s: %v", what, err)
+			}
+		}()
+		return nil
+	}
+}
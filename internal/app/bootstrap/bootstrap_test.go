@@ -0,0 +1,219 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+)
+
+// testConfig is the default configuration on ephemeral ports, with nothing
+// that reaches outside the process
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Server.Host = "127.0.0.1"
+	cfg.Server.GRPCPort = 0
+	cfg.Server.HTTPPort = 0
+	cfg.Metrics.Enabled = false
+	cfg.Tracing.Enabled = false
+	return cfg
+}
+
+func TestNew(t *testing.T) {
+	a := newTestApp(t, testConfig())
+
+	var names []string
+	for _, s := range a.services.Services() {
+		names = append(names, s.Name())
+	}
+	for _, want := range []string{"api.v1.UserService", "api.v1.AdminService", "api.v1.TaskService", "api.v2.UserService"} {
+		if !strings.Contains(strings.Join(names, " "), want) {
+			t.Errorf("services = %v, missing %s", names, want)
+		}
+	}
+	if a.grpcServer == nil || a.httpOpts == nil {
+		t.Error("New() did not build the servers")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	cfg := testConfig()
+	cfg.Server.Serve = "neither"
+	if _, err := New(t.Context(), cfg, logger.Nop(), Options{}); err == nil || !strings.Contains(err.Error(), "server.serve") {
+		t.Errorf("New() error = %v, want an unknown server.serve error", err)
+	}
+}
+
+// newTestApp builds cfg and shuts it down when the test ends
+func newTestApp(t *testing.T, cfg *config.Config) *App {
+	t.Helper()
+	a, err := New(t.Context(), cfg, logger.Nop(), Options{})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		a.lc.Shutdown()
+		a.lc.Wait()
+	})
+	return a
+}
+
+func TestAdminChangesRequireTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []config.AdminToken
+		want   int32
+	}{
+		{"no tokens", nil, response.CodeUnimplemented},
+		{"tokens", []config.AdminToken{{Name: "ops", Token: "secret"}}, response.CodeSuccess},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Admin.Tokens = tt.tokens
+			a := newTestApp(t, cfg)
+			ctx := t.Context()
+
+			// Each call would succeed on an admin API with tokens
+			job, _ := a.jobQueue.Enqueue(ctx, "noop", nil, queue.WithRunAt(time.Now().Add(time.Hour)))
+			calls := map[string]func() (*apiv1.CommonResponse, error){
+				"CancelJob": func() (*apiv1.CommonResponse, error) {
+					return a.admin.CancelJob(ctx, &apiv1.CancelJobRequest{Name: "jobs/" + job.ID})
+				},
+				"SetMaintenanceMode": func() (*apiv1.CommonResponse, error) {
+					return a.admin.SetMaintenanceMode(ctx, &apiv1.SetMaintenanceModeRequest{Enabled: false})
+				},
+				"UpdateSetting": func() (*apiv1.CommonResponse, error) {
+					return a.admin.UpdateSetting(ctx, &apiv1.UpdateSettingRequest{Setting: &apiv1.Setting{Name: "settings/maintenance", Value: "false"}})
+				},
+				"UpdateDebugToggle": func() (*apiv1.CommonResponse, error) {
+					return a.admin.UpdateDebugToggle(ctx, &apiv1.UpdateDebugToggleRequest{Toggle: &apiv1.DebugToggle{Name: "debugToggles/reflection", Enabled: true}})
+				},
+				"DumpState": func() (*apiv1.CommonResponse, error) { return a.admin.DumpState(ctx, &apiv1.DumpStateRequest{}) },
+				"RestoreState": func() (*apiv1.CommonResponse, error) {
+					return a.admin.RestoreState(ctx, &apiv1.RestoreStateRequest{Snapshot: &apiv1.StateSnapshot{Version: 1}})
+				},
+				"ReindexUsers": func() (*apiv1.CommonResponse, error) {
+					return a.admin.ReindexUsers(ctx, &apiv1.ReindexUsersRequest{})
+				},
+			}
+			for name, call := range calls {
+				if resp, err := call(); err != nil || resp.ErrorCode != tt.want {
+					t.Errorf("%s() = %v, %v, want error_code %d", name, resp, err, tt.want)
+				}
+			}
+
+			// Retries and replays need a dead job, so without tokens they
+			// are refused before the job is looked up, and with tokens
+			// they fail to find it
+			want := int32(response.CodeNotFound)
+			if tt.tokens == nil {
+				want = response.CodeUnimplemented
+			}
+			retry, err := a.admin.RetryJob(ctx, &apiv1.RetryJobRequest{Name: "jobs/404"})
+			if err != nil || retry.ErrorCode != want {
+				t.Errorf("RetryJob() = %v, %v, want error_code %d", retry, err, want)
+			}
+			replay, err := a.admin.ReplayWebhookDelivery(ctx, &apiv1.ReplayWebhookDeliveryRequest{Name: "webhookDeliveries/404"})
+			if err != nil || replay.ErrorCode != want {
+				t.Errorf("ReplayWebhookDelivery() = %v, %v, want error_code %d", replay, err, want)
+			}
+
+			list, err := a.admin.ListSettings(ctx, &apiv1.ListSettingsRequest{})
+			if err != nil || list.ErrorCode != response.CodeSuccess {
+				t.Errorf("ListSettings() = %v, %v, want error_code %d", list, err, response.CodeSuccess)
+			}
+		})
+	}
+}
+
+// indexedRepository is a memory repository whose users were indexed with
+// version
+type indexedRepository struct {
+	*repository.MemoryRepository
+	version int
+}
+
+func (r *indexedRepository) IndexVersion(ctx context.Context) (int, error) {
+	return r.version, nil
+}
+
+func TestReindexOnUpgrade(t *testing.T) {
+	for _, tt := range []struct {
+		version int
+		want    int
+	}{
+		{repository.IndexVersion, 0},
+		{repository.IndexVersion - 1, 1},
+	} {
+		jobQueue := queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})
+		users := &indexedRepository{MemoryRepository: repository.NewMemoryRepository(), version: tt.version}
+		if err := reindexOnUpgrade(t.Context(), logger.Nop(), users, jobQueue); err != nil {
+			t.Fatalf("reindexOnUpgrade() unexpected error: %v", err)
+		}
+		jobs, _, _ := jobQueue.Store().List(t.Context(), queue.StatePending, 0, 10)
+		if len(jobs) != tt.want || (tt.want > 0 && jobs[0].Kind != service.TaskReindexUsers) {
+			t.Errorf("jobs queued for users indexed with version %d = %v, want %d reindexing", tt.version, jobs, tt.want)
+		}
+	}
+}
+
+// freePort returns a port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestRun(t *testing.T) {
+	cfg := testConfig()
+	cfg.Server.HTTPPort = freePort(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	a, err := New(ctx, cfg, logger.Nop(), Options{})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- a.Run() }()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/v1/users", cfg.Server.HTTPPort)
+	var resp *http.Response
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if resp, err = http.Get(url); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("GET /v1/users unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /v1/users status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() unexpected error: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Run() did not return after the context was cancelled")
+	}
+}
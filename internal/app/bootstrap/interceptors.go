@@ -0,0 +1,413 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/server"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/audit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/authz"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/diagnostics"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/freeze"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lifecycle"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/metrics"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/middleware"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mutation"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/normalize"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/profiling"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/ratelimit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/redact"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/shed"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/tenant"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/tracing"
+	"github.com/redis/go-redis/v9"
+)
+
+// buildInterceptors registers the gRPC interceptors, by name and run by
+// their order, which server.interceptors can change
+func (a *App) buildInterceptors() error {
+	cfg, log := a.cfg, a.log
+	a.interceptors = server.NewInterceptors(log)
+
+	// Freeze windows, maintenance mode and the audit log all act on the
+	// configured mutations
+	a.mutations = mutation.NewSet(cfg.Mutations...)
+
+	// Track RPCs in progress for diagnostic dumps
+	a.requests = diagnostics.NewTracker(nil)
+	a.interceptors.Register(middleware.Interceptor{
+		Name: "diagnostics", Order: orderDiagnostics,
+		Unary: a.requests.UnaryServerInterceptor(), Stream: a.requests.StreamServerInterceptor(),
+	})
+
+	// Trace requests, continuing the caller's trace, with the gateway
+	// passing its trace on to the gRPC server
+	if cfg.Tracing.Enabled {
+		tracer, shutdownTracing, err := tracing.Setup(a.ctx, cfg.Tracing)
+		if err != nil {
+			return fmt.Errorf("invalid tracing configuration: %w", err)
+		}
+		a.tracer = tracer
+		// Export the spans of the last requests. A collector that is down
+		// would hold the exporter retrying until the deadline, so it gets
+		// a few seconds at most.
+		a.lc.Register(lifecycle.Hook{Name: "tracing", Priority: priorityTracing, Timeout: tracingFlushTimeout, Stop: shutdownTracing})
+		a.interceptors.Register(middleware.Interceptor{
+			Name: "tracing", Order: orderTracing,
+			Unary: tracer.UnaryServerInterceptor(), Stream: tracer.StreamServerInterceptor(),
+		})
+	}
+
+	// Record request metrics ahead of shedding, so rejected calls count
+	if cfg.Metrics.Enabled {
+		a.requestMetrics = metrics.New(cfg.Metrics.Namespace)
+		a.interceptors.Register(middleware.Interceptor{
+			Name: "metrics", Order: orderMetrics,
+			Unary: a.requestMetrics.UnaryServerInterceptor(), Stream: a.requestMetrics.StreamServerInterceptor(),
+		})
+	}
+
+	// Shed low-priority calls under memory, GC or scheduling pressure,
+	// before any work is spent on them
+	if cfg.Shed.Enabled {
+		shedder, err := newShedder(cfg.Shed, log)
+		if err != nil {
+			return fmt.Errorf("invalid load shedding configuration: %w", err)
+		}
+		a.shedder = shedder
+		a.lc.Register(lifecycle.Hook{Name: "load shedder", Priority: priorityMonitors, Start: startFunc(shedder.Start), Stop: shedder.Stop})
+		a.interceptors.Register(middleware.Interceptor{
+			Name: "shed", Order: orderShed,
+			Unary: shedder.UnaryServerInterceptor(), Stream: shedder.StreamServerInterceptor(),
+		})
+	}
+
+	// Admin calls are authenticated by bearer token, before they are
+	// audited so events carry the caller's identity
+	if len(cfg.Admin.Tokens) > 0 {
+		tokens := make([]auth.Token, 0, len(cfg.Admin.Tokens))
+		for _, t := range cfg.Admin.Tokens {
+			tokens = append(tokens, auth.Token{Name: t.Name, Token: t.Token, Tenant: t.Tenant, Scopes: t.Scopes, Roles: t.Roles})
+		}
+		a.adminAuth = auth.NewTokenAuthenticator(tokens)
+		a.interceptors.Register(middleware.Interceptor{Name: "admin_auth", Order: orderAdminAuth, Unary: a.adminAuth.UnaryServerInterceptor("/api.v1.AdminService/")})
+	} else {
+		log.Warn("No admin tokens configured, the admin API is unauthenticated")
+	}
+
+	// Calls are authorized by the roles of the caller's token, after
+	// authentication so admin calls have been checked for one
+	if cfg.Authz.Enabled {
+		authorizer, err := newAuthorizer(cfg, a.adminAuth)
+		if err != nil {
+			return fmt.Errorf("invalid authz configuration: %w", err)
+		}
+		a.interceptors.Register(middleware.Interceptor{
+			Name: "authz", Order: orderAuthz,
+			Unary: authorizer.UnaryServerInterceptor(), Stream: authorizer.StreamServerInterceptor(),
+		})
+	}
+
+	// Freeze windows block admin changes, after authentication so
+	// overrides are logged with the caller's identity
+	if cfg.Freeze.Enabled {
+		guard, err := newFreezeGuard(cfg.Freeze, a.mutations, log)
+		if err != nil {
+			return fmt.Errorf("invalid freeze configuration: %w", err)
+		}
+		a.interceptors.Register(middleware.Interceptor{Name: "freeze", Order: orderFreeze, Unary: guard.UnaryServerInterceptor()})
+	}
+
+	// Rate limits apply per caller, after authentication so admin callers
+	// are limited by identity rather than address. HTTP rules limit
+	// requests before they reach the gateway. Both are set up without
+	// rules too, so a reloaded config file can add some.
+	if cfg.RateLimit.Enabled {
+		limiter, err := newRateLimiter(cfg)
+		if err == nil {
+			a.rateLimits, err = ratelimit.NewInterceptor(log, limiter, rateLimitRules(cfg.RateLimit.Rules))
+		}
+		if err == nil {
+			a.httpRateLimits, err = ratelimit.NewInterceptor(log, limiter, rateLimitRules(cfg.RateLimit.HTTPRules))
+		}
+		if err != nil {
+			return fmt.Errorf("invalid rate limit configuration: %w", err)
+		}
+		a.interceptors.Register(middleware.Interceptor{
+			Name: "ratelimit", Order: orderRateLimit,
+			Unary: a.rateLimits.UnaryServerInterceptor(), Stream: a.rateLimits.StreamServerInterceptor(),
+		})
+	}
+
+	// Apply changes to the config file without a restart where possible
+	if path := a.opts.ConfigPath; cfg.Reload.Enabled && path != "" {
+		configWatcher, err := watchConfig(path, cfg, log, a.opts.Reload, a.rateLimits, a.httpRateLimits)
+		if err != nil {
+			return fmt.Errorf("failed to watch config file: %w", err)
+		}
+		a.lc.Register(lifecycle.Hook{Name: "config watcher", Priority: priorityStreams, Drain: func() { configWatcher.Close() }})
+		log.Info("Watching %s for changes to the log level and rate limits", path)
+	}
+
+	// Calls are attributed to their tenant after authentication, so the
+	// claim of a valid token can be checked against the tenant named
+	if cfg.Tenancy.Enabled {
+		tenants, err := newTenantResolver(cfg, log, a.adminAuth)
+		if err != nil {
+			return fmt.Errorf("invalid tenancy configuration: %w", err)
+		}
+		a.interceptors.Register(middleware.Interceptor{
+			Name: "tenancy", Order: orderTenancy,
+			Unary: tenants.UnaryServerInterceptor(), Stream: tenants.StreamServerInterceptor(),
+		})
+	}
+
+	// Sensitive fields are stripped from responses for callers without the
+	// scopes revealing them
+	if cfg.Redaction.Enabled {
+		rules := make([]redact.Rule, 0, len(cfg.Redaction.Fields))
+		for _, f := range cfg.Redaction.Fields {
+			rules = append(rules, redact.Rule{Field: f.Field, Scopes: f.Scopes})
+		}
+		filter, err := redact.New(rules, a.adminAuth.Scopes)
+		if err != nil {
+			return fmt.Errorf("invalid redaction configuration: %w", err)
+		}
+		a.interceptors.Register(middleware.Interceptor{
+			Name: "redaction", Order: orderRedaction,
+			Unary: filter.UnaryServerInterceptor(), Stream: filter.StreamServerInterceptor(),
+		})
+	}
+
+	// Audit events are buffered and written in batches off the request path
+	if cfg.Audit.Enabled {
+		a.auditLog = audit.NewBuffer(a.auditSink, log, audit.Options{
+			BatchSize:     cfg.Audit.BatchSize,
+			FlushInterval: cfg.Audit.FlushInterval,
+			Capacity:      cfg.Audit.BufferSize,
+			Block:         cfg.Audit.Block,
+		})
+		a.lc.Register(lifecycle.Hook{Name: "audit log", Priority: priorityInternal, Start: a.auditLog.Start, Stop: a.auditLog.Stop})
+		a.interceptors.Register(middleware.Interceptor{Name: "audit", Order: orderAudit, Unary: audit.UnaryServerInterceptor(a.auditLog, a.mutations)})
+	}
+
+	// Label handlers with their RPC method so profiles break down per RPC,
+	// and serve the profiles on an internal listener for scraping
+	if cfg.Profiling.Enabled {
+		a.interceptors.Register(middleware.Interceptor{
+			Name: "profiling", Order: orderProfiling,
+			Unary: profiling.UnaryServerInterceptor(), Stream: profiling.StreamServerInterceptor(),
+		})
+		if cfg.Profiling.Addr != "" {
+			profileServer := &http.Server{Addr: cfg.Profiling.Addr, Handler: profiling.Handler()}
+			a.lc.Register(lifecycle.Hook{
+				Name:     "profiling server",
+				Priority: priorityInternal,
+				Start:    serveInternal(log, "profiles", profileServer),
+				Stop:     closeFunc(profileServer),
+			})
+			log.Info("Profiling endpoint listening on %s", cfg.Profiling.Addr)
+		}
+	}
+
+	// Requests are normalized last, right before the handlers
+	if cfg.Normalize.Enabled {
+		rules := make([]normalize.Rule, 0, len(cfg.Normalize.Fields))
+		for _, f := range cfg.Normalize.Fields {
+			rules = append(rules, normalize.Rule{
+				Field:           f.Field,
+				Trim:            f.Trim,
+				Lowercase:       f.Lowercase,
+				ResourcePattern: f.ResourcePattern,
+				Default:         f.Default,
+			})
+		}
+		normalizer, err := normalize.New(rules)
+		if err != nil {
+			return fmt.Errorf("invalid normalize configuration: %w", err)
+		}
+		a.interceptors.Register(middleware.Interceptor{
+			Name: "normalize", Order: orderNormalize,
+			Unary: normalizer.UnaryServerInterceptor(), Stream: normalizer.StreamServerInterceptor(),
+		})
+	}
+	return nil
+}
+
+// newFreezeGuard parses the windows in cfg
+func newFreezeGuard(cfg config.FreezeConfig, mutations mutation.Set, log logger.Logger) (*freeze.Guard, error) {
+	opts := freeze.Options{Methods: cfg.Methods, Mutations: mutations}
+	for _, t := range cfg.Overrides {
+		opts.Overrides = append(opts.Overrides, auth.Token{Name: t.Name, Token: t.Token})
+	}
+	for _, w := range cfg.Windows {
+		if w.From != "" || w.To != "" {
+			weekly, err := freeze.Weekly(w.Name, w.From, w.To, w.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", w.Name, err)
+			}
+			opts.Windows = append(opts.Windows, weekly)
+			continue
+		}
+		if !w.End.After(w.Start) {
+			return nil, fmt.Errorf("%s: end must be after start", w.Name)
+		}
+		opts.Windows = append(opts.Windows, freeze.Window{Name: w.Name, Start: w.Start, End: w.End})
+	}
+	return freeze.New(log, opts, nil), nil
+}
+
+// newTenantResolver creates the resolver for cfg.Tenancy. Tenant rate
+// limits are counted by the rate limit backend.
+func newTenantResolver(cfg *config.Config, log logger.Logger, authn *auth.TokenAuthenticator) (*tenant.Resolver, error) {
+	tenants := make([]tenant.Tenant, 0, len(cfg.Tenancy.Tenants))
+	for _, t := range cfg.Tenancy.Tenants {
+		tenants = append(tenants, tenant.Tenant{ID: t.ID, RateLimit: t.RateLimit, RateWindow: t.RateWindow, Features: t.Features})
+	}
+	registry, err := tenant.NewRegistry(tenants...)
+	if err != nil {
+		return nil, err
+	}
+	limiter, err := newRateLimiter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.NewResolver(log, registry, tenant.Options{
+		Sources:  cfg.Tenancy.Sources,
+		Domain:   cfg.Tenancy.Domain,
+		Required: cfg.Tenancy.Required,
+		Exempt:   cfg.Tenancy.Exempt,
+		Gates:    cfg.Tenancy.Gates,
+		Auth:     authn,
+		Limiter:  limiter,
+	})
+}
+
+// newRateLimiter creates the limiter for cfg.RateLimit.Backend. The redis
+// backend counts in the shared redis so every replica sees the same counts.
+func newRateLimiter(cfg *config.Config) (ratelimit.Limiter, error) {
+	switch cfg.RateLimit.Backend {
+	case "memory", "":
+		return ratelimit.NewMemoryLimiter(nil), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		return ratelimit.NewRedisLimiter(client, ratelimit.RedisOptions{Prefix: cfg.RateLimit.KeyPrefix}), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.RateLimit.Backend)
+	}
+}
+
+// watchConfig reloads the config file at path with load when it changes,
+// applying the log level and rate limit rules. Other settings take effect
+// on restart. limits and httpLimits are nil when rate limiting is disabled,
+// which a reload cannot change.
+func watchConfig(path string, cfg *config.Config, log logger.Logger, load func() (*config.Config, error), limits, httpLimits *ratelimit.Interceptor) (*config.Watcher, error) {
+	validate := func(c *config.Config) error {
+		if _, err := logger.ParseLevel(c.Log.Level); err != nil && c.Log.Level != "" {
+			return err
+		}
+		// Rules are checked without counting anything, so they apply
+		// whole or not at all
+		for _, rules := range [][]config.RateLimitRule{c.RateLimit.Rules, c.RateLimit.HTTPRules} {
+			if _, err := ratelimit.NewInterceptor(log, nil, rateLimitRules(rules)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w, err := config.Watch(path, cfg, log, config.WatchOptions{Load: load, Validate: validate, Debounce: cfg.Reload.Debounce})
+	if err != nil {
+		return nil, err
+	}
+
+	if l, ok := log.(logger.Leveled); ok {
+		w.Subscribe(func(c *config.Config) {
+			// Without a level the current one is kept
+			if level, err := logger.ParseLevel(c.Log.Level); err == nil {
+				l.SetLevel(level)
+			}
+		})
+	}
+	w.Subscribe(func(c *config.Config) {
+		if c.RateLimit.Enabled != (limits != nil) {
+			log.Warn("Enabling or disabling rate limits takes effect on restart")
+		}
+		if limits == nil {
+			return
+		}
+		limits.SetRules(rateLimitRules(c.RateLimit.Rules))
+		httpLimits.SetRules(rateLimitRules(c.RateLimit.HTTPRules))
+	})
+	return w, nil
+}
+
+// rateLimitRules converts configured rules
+func rateLimitRules(rules []config.RateLimitRule) []ratelimit.Rule {
+	converted := make([]ratelimit.Rule, 0, len(rules))
+	for _, r := range rules {
+		converted = append(converted, ratelimit.Rule{
+			Method:   r.Method,
+			Limit:    r.Limit,
+			Window:   r.Window,
+			Strategy: r.Strategy,
+			Burst:    r.Burst,
+			By:       r.By,
+		})
+	}
+	return converted
+}
+
+// newShedder parses the priority names in cfg
+func newShedder(cfg config.ShedConfig, log logger.Logger) (*shed.Shedder, error) {
+	opts := shed.Options{
+		Interval:        cfg.Interval,
+		MaxMemoryRatio:  cfg.MaxMemoryRatio,
+		MaxGCFraction:   cfg.MaxGCFraction,
+		MaxSchedLatency: cfg.MaxSchedLatency,
+		Priorities:      make(map[string]shed.Priority, len(cfg.Priorities)),
+	}
+	if cfg.DefaultPriority != "" {
+		p, err := shed.ParsePriority(cfg.DefaultPriority)
+		if err != nil {
+			return nil, err
+		}
+		opts.Default = p
+	}
+	for method, name := range cfg.Priorities {
+		p, err := shed.ParsePriority(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+		opts.Priorities[method] = p
+	}
+	return shed.New(log, opts), nil
+}
+
+// newAuthorizer creates the authorizer of cfg.Authz, giving callers the
+// roles of their admin token. Roles the tokens or anonymous callers are
+// given must be defined.
+func newAuthorizer(cfg *config.Config, adminAuth *auth.TokenAuthenticator) (*authz.Authorizer, error) {
+	authorizer, err := authz.New(authz.Policy{
+		Roles:   cfg.Authz.Roles,
+		Methods: cfg.Authz.Methods,
+	}, authz.TokenRoles(adminAuth, cfg.Authz.AnonymousRoles))
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizer.CheckRoles(cfg.Authz.AnonymousRoles...); err != nil {
+		return nil, fmt.Errorf("anonymous_roles: %w", err)
+	}
+	for _, t := range cfg.Admin.Tokens {
+		if err := authorizer.CheckRoles(t.Roles...); err != nil {
+			return nil, fmt.Errorf("admin token %s: %w", t.Name, err)
+		}
+	}
+	return authorizer, nil
+}
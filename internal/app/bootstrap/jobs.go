@@ -0,0 +1,285 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/consumer"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/audit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/events"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lifecycle"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mailer"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/notify"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/retention"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/scheduler"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/webhook"
+)
+
+// buildJobs creates the scheduler, the job and webhook queues, the mailer
+// and the event bus user events fan out over
+func (a *App) buildJobs() error {
+	cfg, log := a.cfg, a.log
+
+	// Scheduled jobs. Register jobs before Configure so config overrides
+	// can refer to them by name; it runs once the user service, whose soft
+	// deleted users the retention job purges, exists.
+	locker, err := newLocker(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid lock configuration: %w", err)
+	}
+	a.elector = lock.NewElector(lock.WithMetrics(locker, nil), "scheduler/")
+	a.jobs = scheduler.New(log, scheduler.WithLeaderElector(a.elector))
+	if cfg.Outbox.Enabled {
+		if err := registerOutboxRelay(a.jobs, a.lc, cfg, log, repository.OutboxOf(a.userRepo)); err != nil {
+			return fmt.Errorf("invalid outbox configuration: %w", err)
+		}
+	}
+
+	// Create the persistent job queue. Register handlers before Start.
+	if a.jobQueue, err = newJobQueue(cfg, log); err != nil {
+		return fmt.Errorf("invalid queue configuration: %w", err)
+	}
+
+	// Email is sent through the queue so requests never wait on SMTP
+	emailSender, err := newMailer(cfg, log)
+	if err != nil {
+		return fmt.Errorf("invalid mailer configuration: %w", err)
+	}
+	emails := mailer.NewAsync(a.jobQueue, emailSender)
+	if c, ok := emailSender.(io.Closer); ok {
+		a.lc.Register(lifecycle.Hook{Name: "mailer", Priority: priorityMailer, Stop: closeFunc(c)})
+	}
+
+	// Webhooks get their own queue so dead-lettered deliveries can be
+	// listed and replayed apart from other jobs
+	if a.webhookQueue, err = newWebhookQueue(cfg, log); err != nil {
+		return fmt.Errorf("invalid webhook configuration: %w", err)
+	}
+	webhooks := webhook.NewAsync(a.webhookQueue, webhook.NewClient(&http.Client{Timeout: cfg.Webhook.Timeout}))
+
+	// User lifecycle events fan out to subscribers over the event bus
+	a.userEvents = events.NewBus[service.UserEvent](log)
+	a.lc.Register(lifecycle.Hook{Name: "event bus", Priority: priorityEvents, Stop: a.userEvents.Close})
+	if cfg.Notify.Enabled {
+		if err := subscribeUserNotifier(a.userEvents, log, emails, webhooks); err != nil {
+			return fmt.Errorf("failed to subscribe notifier: %w", err)
+		}
+	}
+	return nil
+}
+
+// registerOutboxRelay schedules the relay publishing the user events of
+// store, the outbox of the user repository, to outbox.transport
+func registerOutboxRelay(jobs *scheduler.Scheduler, lc *lifecycle.Manager, cfg *config.Config, log logger.Logger, store outbox.Store) error {
+	// The outbox lives next to the data it describes, so events are
+	// written in the same transaction as the users
+	if store == nil {
+		return fmt.Errorf("storage driver %q keeps no outbox", cfg.Storage.Driver)
+	}
+	pub, closePub, err := outbox.NewPublisher(cfg.Outbox, log)
+	if err != nil {
+		return err
+	}
+	lc.Register(lifecycle.Hook{Name: "outbox transport", Priority: priorityStores, Stop: func(context.Context) error { return closePub() }})
+	relay := outbox.NewRelay(store, pub, log, outbox.Options{
+		BatchSize: cfg.Outbox.BatchSize,
+	})
+	return jobs.Register(scheduler.Job{
+		Name:     "outbox-relay",
+		Schedule: cfg.Outbox.Schedule,
+		Run:      relay.RunOnce,
+	})
+}
+
+func newJobQueue(cfg *config.Config, log logger.Logger) (*queue.Queue, error) {
+	store, err := newQueueStore(cfg, cfg.Queue.KeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return queue.New(store, log, queue.Options{
+		Workers:      cfg.Queue.Workers,
+		PollInterval: cfg.Queue.PollInterval,
+		Lease:        cfg.Queue.Lease,
+		MaxAttempts:  cfg.Queue.MaxAttempts,
+		Backoff: queue.Backoff{
+			Initial: cfg.Queue.BackoffInitial,
+			Max:     cfg.Queue.BackoffMax,
+		},
+	}), nil
+}
+
+func newWebhookQueue(cfg *config.Config, log logger.Logger) (*queue.Queue, error) {
+	store, err := newQueueStore(cfg, cfg.Queue.KeyPrefix+":webhooks")
+	if err != nil {
+		return nil, err
+	}
+	return queue.New(store, log, queue.Options{
+		Workers:      cfg.Webhook.Workers,
+		PollInterval: cfg.Queue.PollInterval,
+		Lease:        cfg.Queue.Lease,
+		MaxAttempts:  cfg.Webhook.MaxAttempts,
+		Backoff: queue.Backoff{
+			Initial: cfg.Webhook.BackoffInitial,
+			Max:     cfg.Webhook.BackoffMax,
+		},
+	}), nil
+}
+
+// newConsumer opens the subscriber of cfg.Consumer and, with a dead-letter
+// topic, the publisher of the dead letters on the same broker
+func newConsumer(cfg *config.Config, log logger.Logger) (*consumer.Consumer, error) {
+	var deadLetter outbox.Publisher
+	var closeDeadLetter func() error
+	if cfg.Consumer.DeadLetterTopic != "" {
+		var err error
+		deadLetter, closeDeadLetter, err = outbox.NewPublisher(config.OutboxConfig{
+			Transport: cfg.Consumer.Transport,
+			NATSURL:   cfg.Consumer.NATSURL,
+		}, log)
+		if err != nil {
+			return nil, fmt.Errorf("dead letters: %w", err)
+		}
+	}
+	sub, err := consumer.NewSubscriber(cfg.Consumer, log)
+	if err != nil {
+		if closeDeadLetter != nil {
+			closeDeadLetter()
+		}
+		return nil, err
+	}
+	if closeDeadLetter != nil {
+		sub = closingSubscriber{Subscriber: sub, close: closeDeadLetter}
+	}
+	return consumer.New(sub, log, consumer.Options{
+		Workers:        cfg.Consumer.Workers,
+		BatchSize:      cfg.Consumer.BatchSize,
+		MaxAttempts:    cfg.Consumer.MaxAttempts,
+		HandlerTimeout: cfg.Consumer.HandlerTimeout,
+		Backoff: queue.Backoff{
+			Initial: cfg.Consumer.BackoffInitial,
+			Max:     cfg.Consumer.BackoffMax,
+		},
+		DeadLetter:      deadLetter,
+		DeadLetterTopic: cfg.Consumer.DeadLetterTopic,
+	}), nil
+}
+
+// closingSubscriber also closes the dead-letter publisher when the
+// consumer closes its subscriber, after the last message is settled
+type closingSubscriber struct {
+	consumer.Subscriber
+	close func() error
+}
+
+func (s closingSubscriber) Close() error {
+	return errors.Join(s.Subscriber.Close(), s.close())
+}
+
+// registerRetention schedules the purge of data past its retention period.
+// Categories are registered for the stores that can purge; configuring any
+// other category is an error. "outbox" purges delivered messages and
+// "deleted_users" the users soft deleted for longer than its period.
+func registerRetention(jobs *scheduler.Scheduler, cfg *config.Config, log logger.Logger, auditSink audit.Sink, outboxStore outbox.Store, users *service.UserService) error {
+	r := retention.New(log, nil, cfg.Retention.DryRun)
+	r.Register("deleted_users", retention.PurgerFunc(users.PurgeDeleted))
+	if p, ok := auditSink.(retention.Purger); ok {
+		r.Register("audit", p)
+	}
+	if p, ok := outboxStore.(retention.Purger); ok {
+		r.Register("outbox", p)
+	}
+
+	categories := make([]string, 0, len(cfg.Retention.MaxAge))
+	for category := range cfg.Retention.MaxAge {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	policies := make([]retention.Policy, 0, len(categories))
+	for _, category := range categories {
+		policies = append(policies, retention.Policy{Category: category, MaxAge: cfg.Retention.MaxAge[category]})
+	}
+	if err := r.Configure(policies); err != nil {
+		return err
+	}
+	return jobs.Register(scheduler.Job{
+		Name:     "retention",
+		Schedule: cfg.Retention.Schedule,
+		Run:      r.Run,
+	})
+}
+
+func newMailer(cfg *config.Config, log logger.Logger) (mailer.Mailer, error) {
+	switch cfg.Mailer.Driver {
+	case "log", "":
+		return mailer.LogMailer(log), nil
+	case "smtp":
+		m, err := mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     cfg.Mailer.Host,
+			Port:     cfg.Mailer.Port,
+			Username: cfg.Mailer.Username,
+			Password: cfg.Mailer.Password,
+			From:     cfg.Mailer.From,
+			TLS:      cfg.Mailer.TLS,
+			PoolSize: cfg.Mailer.PoolSize,
+			Timeout:  cfg.Mailer.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", cfg.Mailer.Driver)
+	}
+}
+
+// subscribeUserNotifier notifies users about changes to their account. It
+// runs on its own subscription so webhooks never hold up requests.
+func subscribeUserNotifier(bus *events.Bus[service.UserEvent], log logger.Logger, emails mailer.Mailer, webhooks webhook.Sender) error {
+	prefs := notify.NewMemoryPreferences()
+	notifier := notify.New(notify.DefaultTemplates(), prefs, log,
+		notify.EmailChannel(emails),
+		notify.WebhookChannel(webhooks),
+		notify.SlackChannel(webhooks),
+	)
+
+	_, err := bus.SubscribeFunc("notify", events.Options{Buffer: 256}, func(ev service.UserEvent) {
+		ctx := context.Background()
+		event := notify.Event{
+			Type:        ev.Type,
+			User:        ev.User.GetName(),
+			Email:       ev.User.GetEmail(),
+			DisplayName: ev.User.GetDisplayName(),
+		}
+		if err := notifier.Notify(ctx, event); err != nil {
+			log.Error("Failed to send %s notification to %s: %v", event.Type, event.User, err)
+		}
+		if event.Type == service.EventUserPurged {
+			prefs.Delete(ctx, event.User)
+		}
+	})
+	return err
+}
+
+// jobCounts returns how many jobs store holds in each state
+func jobCounts(ctx context.Context, store queue.Store) (map[queue.State]int, error) {
+	counts := make(map[queue.State]int)
+	for _, state := range []queue.State{queue.StatePending, queue.StateRunning, queue.StateSucceeded, queue.StateDead, queue.StateCancelled} {
+		_, total, err := store.List(ctx, state, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		counts[state] = total
+	}
+	return counts, nil
+}
@@ -0,0 +1,329 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	apiv2 "github.com/ChyiYaqing/go-microservice-template/api/proto/v2"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/diagnostics"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/discovery"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/health"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lifecycle"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/ratelimit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/systemd"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/warmup"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/watchdog"
+	"github.com/redis/go-redis/v9"
+)
+
+// buildMonitors creates the watchdog, the discovery monitor and the health
+// checker, and dumps diagnostics on operator request
+func (a *App) buildMonitors() error {
+	cfg, log, ctx := a.cfg, a.log, a.ctx
+
+	// Watch the process itself; when terminating on breaches, shut down
+	// gracefully like on SIGTERM
+	if cfg.Watchdog.Enabled {
+		a.dog = newWatchdog(cfg, log, a.userRepo, a.jobQueue, a.lc.Shutdown)
+		a.lc.Register(lifecycle.Hook{Name: "watchdog", Priority: priorityMonitors, Start: startFunc(a.dog.Start), Stop: a.dog.Stop})
+	}
+
+	// Register in discovery and warn when other replicas run a different
+	// configuration or version
+	var fleet *discovery.Monitor
+	if cfg.Discovery.Enabled {
+		registry, err := newRegistry(cfg)
+		if err != nil {
+			return fmt.Errorf("invalid discovery configuration: %w", err)
+		}
+		fleet = discovery.NewMonitor(log, registry, discovery.Member{
+			ID:                fmt.Sprintf("%s-%d", a.info.Hostname, os.Getpid()),
+			Hostname:          a.info.Hostname,
+			Zone:              a.info.Zone,
+			Version:           a.info.Version,
+			ConfigFingerprint: a.info.ConfigFingerprint,
+			Fingerprint:       a.info.Fingerprint,
+		}, discovery.Options{Interval: cfg.Discovery.Interval})
+		a.lc.Register(lifecycle.Hook{Name: "discovery", Priority: priorityMonitors, Start: startFunc(fleet.Start), Stop: fleet.Stop})
+	}
+
+	// SIGUSR1, or service control code 128 on Windows, dumps what is needed
+	// to debug a hung instance
+	go dumpDiagnosticsOnRequest(ctx, a.opts.DiagnosticsRequests, cfg.Diagnostics.Path, log,
+		diagnostics.Text("config fingerprint", cfg.Fingerprint()),
+		diagnostics.Text("fingerprint", a.info.Fingerprint),
+		diagnostics.Value("discovery", func() (any, error) {
+			if fleet == nil {
+				return "disabled", nil
+			}
+			return fleet.Stats(), nil
+		}),
+		diagnostics.Value("users", func() (any, error) { return a.userRepo.Count(ctx) }),
+		diagnostics.Value("jobs", func() (any, error) { return jobCounts(ctx, a.jobQueue.Store()) }),
+		diagnostics.Value("webhooks", func() (any, error) { return jobCounts(ctx, a.webhookQueue.Store()) }),
+		diagnostics.Value("worker pool", func() (any, error) { return a.workers.Stats(), nil }),
+		diagnostics.Value("scheduler", func() (any, error) { return a.jobs.Stats(), nil }),
+		diagnostics.Value("event subscribers", func() (any, error) { return a.userEvents.Stats(), nil }),
+		diagnostics.Value("audit buffer", func() (any, error) {
+			if a.auditLog == nil {
+				return "disabled", nil
+			}
+			return a.auditLog.Stats(), nil
+		}),
+		diagnostics.Value("load shedding", func() (any, error) {
+			if a.shedder == nil {
+				return "disabled", nil
+			}
+			return a.shedder.Stats(), nil
+		}),
+		diagnostics.Value("rate limits", func() (any, error) {
+			if a.rateLimits == nil {
+				return "disabled", nil
+			}
+			return map[string]ratelimit.Stats{"grpc": a.rateLimits.Stats(), "http": a.httpRateLimits.Stats()}, nil
+		}),
+		diagnostics.Value("watchdog", func() (any, error) {
+			if a.dog == nil {
+				return "disabled", nil
+			}
+			return a.dog.Stats(), nil
+		}),
+		a.requests.Section(),
+		diagnostics.Goroutines(),
+	)
+
+	// Report health over grpc.health.v1: nothing serves until warmup is
+	// done, and services stop serving while the stores they need fail
+	a.checker = newHealthChecker(cfg, log, a.userRepo, a.jobQueue)
+	a.lc.Register(lifecycle.Hook{
+		Name:     "health checks",
+		Priority: priorityInternal,
+		Start:    startFunc(a.checker.Start),
+		Drain:    a.checker.Drain,
+		Stop:     a.checker.Stop,
+	})
+	return nil
+}
+
+// reportReady warms up, then reports ready to load balancers and systemd,
+// and keeps the systemd watchdog fed. A warmup that times out only costs
+// latency, so the server becomes ready anyway.
+func (a *App) reportReady() {
+	cfg, log, ctx := a.cfg, a.log, a.ctx
+	go func() {
+		if a.warm != nil {
+			// Synthetic requests go through the REST gateway, when served
+			var handler http.Handler
+			if a.httpServer != nil && cfg.Server.HTTPAPI != "connect" {
+				handler = a.httpServer.Handler
+			}
+			steps := warmupSteps(cfg.Warmup, a.userRepo, a.jobQueue, handler)
+			err := warmup.Run(ctx, log, warmup.Options{Timeout: cfg.Warmup.Timeout}, steps...)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Warn("Warmup incomplete, reporting ready anyway: %v", err)
+			}
+			a.warm.Done()
+		}
+		a.checker.SetReady()
+		if _, err := systemd.Notify(systemd.Ready); err != nil {
+			log.Warn("Failed to notify systemd: %v", err)
+		}
+	}()
+	a.lc.Register(lifecycle.Hook{
+		Name:     "systemd",
+		Priority: priorityStreams,
+		Drain: func() {
+			if _, err := systemd.Notify(systemd.Stopping); err != nil {
+				log.Warn("Failed to notify systemd: %v", err)
+			}
+		},
+	})
+
+	// Keep the systemd watchdog fed while the internal watchdog finds the
+	// process healthy
+	if interval, ok, err := systemd.WatchdogInterval(); err != nil {
+		log.Warn("Systemd watchdog disabled: %v", err)
+	} else if ok {
+		var healthy func() bool
+		if a.dog != nil {
+			healthy = a.dog.Healthy
+		}
+		go func() {
+			if err := systemd.Keepalive(ctx, interval, healthy); err != nil {
+				log.Error("Systemd watchdog keepalive failed: %v", err)
+			}
+		}()
+		log.Info("Sending systemd watchdog keepalives every %v", interval/2)
+	}
+}
+
+// warmupSteps connects to the stores, fills the user cache and sends
+// synthetic reads through handler, so the first real requests find open
+// connections, cached users and warm buffer pools
+func warmupSteps(cfg config.WarmupConfig, users repository.UserRepository, jobQueue *queue.Queue, handler http.Handler) []warmup.Step {
+	return []warmup.Step{
+		{Name: "stores", Run: func(ctx context.Context) error {
+			if _, err := users.Count(ctx); err != nil {
+				return err
+			}
+			_, _, err := jobQueue.Store().List(ctx, queue.StatePending, 0, 0)
+			return err
+		}},
+		{Name: "user cache", Run: func(ctx context.Context) error {
+			if cfg.PreloadUsers <= 0 {
+				return nil
+			}
+			page, err := users.List(ctx, 0, cfg.PreloadUsers)
+			if err != nil || len(page) == 0 {
+				return err
+			}
+			names := make([]string, 0, len(page))
+			for _, u := range page {
+				names = append(names, u.GetName())
+			}
+			_, err = users.BatchGet(ctx, names)
+			return err
+		}},
+		{Name: "synthetic requests", Run: func(ctx context.Context) error {
+			if handler == nil {
+				return nil
+			}
+			for i := 0; i < cfg.Requests; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/v1/users?page_size=10", nil).WithContext(ctx)
+				req.Header.Set("User-Agent", "warmup")
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					return fmt.Errorf("GET /v1/users returned %d", rec.Code)
+				}
+			}
+			return nil
+		}},
+	}
+}
+
+// newRegistry creates the registry for cfg.Discovery.Backend
+func newRegistry(cfg *config.Config) (discovery.Registry, error) {
+	switch cfg.Discovery.Backend {
+	case "memory", "":
+		return discovery.NewMemoryRegistry(cfg.Discovery.TTL, nil), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		return discovery.NewRedisRegistry(client, discovery.RedisOptions{Key: cfg.Discovery.Key, TTL: cfg.Discovery.TTL}), nil
+	default:
+		return nil, fmt.Errorf("unknown discovery backend %q", cfg.Discovery.Backend)
+	}
+}
+
+// newWatchdog checks the user repository and the job store besides the
+// process itself. terminate is called once breaches reach the threshold and
+// cfg.Watchdog.Terminate is set.
+func newWatchdog(cfg *config.Config, log logger.Logger, users repository.UserRepository, jobQueue *queue.Queue, terminate func()) *watchdog.Watchdog {
+	opts := watchdog.Options{
+		Interval:           cfg.Watchdog.Interval,
+		MaxSchedulingDelay: cfg.Watchdog.MaxSchedulingDelay,
+		MaxGoroutines:      cfg.Watchdog.MaxGoroutines,
+		FailureThreshold:   cfg.Watchdog.FailureThreshold,
+	}
+	if cfg.Watchdog.Terminate {
+		opts.OnFatal = func(reason string) {
+			log.Error("Watchdog shutting the server down: %s", reason)
+			terminate()
+		}
+	}
+	return watchdog.New(log, opts, map[string]watchdog.Check{
+		"users": func(ctx context.Context) error {
+			_, err := users.Count(ctx)
+			return err
+		},
+		"jobs": func(ctx context.Context) error {
+			_, _, err := jobQueue.Store().List(ctx, queue.StatePending, 0, 1)
+			return err
+		},
+	})
+}
+
+// newHealthChecker reports the user service not serving while the user
+// repository fails, and the task and admin services while the job store
+// does. The cache is checked too, though reads fall back without it.
+func newHealthChecker(cfg *config.Config, log logger.Logger, users repository.UserRepository, jobQueue *queue.Queue) *health.Checker {
+	opts := health.Options{Interval: cfg.Health.Interval, Timeout: cfg.Health.Timeout}
+	checker := health.New(log, opts,
+		health.Dependency{
+			Name: "users",
+			Check: func(ctx context.Context) error {
+				_, err := users.Count(ctx)
+				return err
+			},
+			Services: []string{apiv1.UserService_ServiceDesc.ServiceName, apiv2.UserService_ServiceDesc.ServiceName},
+		},
+		health.Dependency{
+			Name: "jobs",
+			Check: func(ctx context.Context) error {
+				_, _, err := jobQueue.Store().List(ctx, queue.StatePending, 0, 1)
+				return err
+			},
+			Services: []string{apiv1.TaskService_ServiceDesc.ServiceName, apiv1.AdminService_ServiceDesc.ServiceName},
+		},
+	)
+	if cached, ok := users.(*repository.CachedRepository); ok {
+		checker.Add(health.Dependency{Name: "cache", Check: cached.Ping, Optional: true})
+	}
+	return checker
+}
+
+// dumpDiagnosticsOnRequest writes a diagnostic dump on every request until
+// ctx is done, appending it to path or, when path is empty, logging it
+func dumpDiagnosticsOnRequest(ctx context.Context, requests <-chan struct{}, path string, log logger.Logger, sections ...diagnostics.Section) {
+	for {
+		select {
+		case <-requests:
+			if err := writeDiagnostics(path, log, sections); err != nil {
+				log.Error("Failed to write diagnostic dump: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func writeDiagnostics(path string, log logger.Logger, sections []diagnostics.Section) error {
+	if path == "" {
+		var buf bytes.Buffer
+		if err := diagnostics.Dump(&buf, time.Now(), sections...); err != nil {
+			return err
+		}
+		log.Info("Diagnostic dump requested by operator\n%s", buf.String())
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := diagnostics.Dump(f, time.Now(), sections...); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Info("Diagnostic dump written to %s", path)
+	return nil
+}
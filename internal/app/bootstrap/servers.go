@@ -0,0 +1,365 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/server"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/chaos"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lifecycle"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/metrics"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/middleware"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/systemd"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// buildServers creates the gRPC server and the options of the HTTP server,
+// and the internal endpoints serving Swagger UI and metrics
+func (a *App) buildServers() error {
+	if err := a.buildGRPCServer(); err != nil {
+		return err
+	}
+	return a.buildHTTPServer()
+}
+
+// buildGRPCServer creates the gRPC server. Without a gRPC port it still
+// runs, in memory, so gateway calls keep passing its interceptors.
+func (a *App) buildGRPCServer() error {
+	cfg, log := a.cfg, a.log
+
+	a.serveGRPC, a.serveHTTP = true, true
+	switch cfg.Server.Serve {
+	case "both", "":
+	case "http":
+		a.serveGRPC = false
+	case "grpc":
+		a.serveHTTP = false
+	default:
+		return fmt.Errorf("unknown server.serve %q, expected both, http or grpc", cfg.Server.Serve)
+	}
+	if !a.serveGRPC {
+		a.inProcess = server.NewInProcess()
+		a.gatewayDialOpts = []grpc.DialOption{a.inProcess.DialOption()}
+	}
+
+	// Fault injection for dev/test environments only
+	if cfg.Chaos.Enabled {
+		injector, err := chaos.New(cfg.Chaos)
+		if err != nil {
+			return fmt.Errorf("invalid chaos configuration: %w", err)
+		}
+		a.interceptors.Register(middleware.Interceptor{Name: "chaos", Order: orderChaos, Unary: injector.UnaryServerInterceptor()})
+		log.Warn("Chaos fault injection is ENABLED with %d rule(s), do not use in production", len(cfg.Chaos.Rules))
+	}
+
+	// Apply server.interceptors once every interceptor is registered
+	if err := a.interceptors.Configure(cfg.Server.Interceptors); err != nil {
+		return fmt.Errorf("invalid server.interceptors configuration: %w", err)
+	}
+	chain := a.interceptors.Chain()
+	names := make([]string, 0, len(chain))
+	for _, i := range chain {
+		names = append(names, fmt.Sprintf("%s(%d)", i.Name, i.Order))
+	}
+	log.Info("gRPC interceptors: %s", strings.Join(names, ", "))
+	if len(cfg.Server.Interceptors.Disabled) > 0 {
+		log.Warn("gRPC interceptors disabled by configuration: %s", strings.Join(cfg.Server.Interceptors.Disabled, ", "))
+	}
+
+	var opts []grpc.ServerOption
+
+	// Serve TLS, verifying client certificates under mutual TLS
+	if cfg.Server.TLS.Enabled {
+		tlsConfig, err := tlsconfig.Server(cfg.Server.TLS, true)
+		if err != nil {
+			return fmt.Errorf("invalid server.tls configuration: %w", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	a.grpcServer = server.NewGRPCServer(log, a.services, a.checker, a.interceptors, opts...)
+	return nil
+}
+
+// buildHTTPServer collects the options of the HTTP server with the
+// grpc-gateway. Readiness fails until warmup is done, while a store fails
+// its check, and again once draining starts.
+func (a *App) buildHTTPServer() error {
+	cfg, log := a.cfg, a.log
+
+	a.drain = &server.DrainState{}
+	a.httpOpts = []server.HTTPOption{server.WithDrainState(a.drain), server.WithHealth(a.checker), server.WithFingerprint(a.info.Fingerprint)}
+	if cfg.Warmup.Enabled {
+		a.warm = &server.WarmupState{}
+		a.httpOpts = append(a.httpOpts, server.WithWarmupState(a.warm))
+	}
+	if a.httpRateLimits != nil {
+		a.httpOpts = append(a.httpOpts, server.WithRateLimits(a.httpRateLimits))
+	}
+	if cfg.Server.GraphQL.Enabled {
+		a.httpOpts = append(a.httpOpts, server.WithGraphQL())
+	}
+	if cfg.Server.JSONRPC.Enabled {
+		a.httpOpts = append(a.httpOpts, server.WithJSONRPC())
+	}
+	if t := cfg.Server.Twirp; t.Enabled {
+		prefix := t.Prefix
+		if prefix == "" {
+			prefix = "/twirp"
+		}
+		a.httpOpts = append(a.httpOpts, server.WithTwirp(prefix))
+	}
+
+	// The Swagger UI documents the admin API too, so production keeps it
+	// on an internal listener or behind admin tokens
+	if sw := cfg.Server.Swagger; sw.Addr != "" || sw.RequireAdmin {
+		var authn *auth.TokenAuthenticator
+		if sw.RequireAdmin {
+			if a.adminAuth == nil {
+				return fmt.Errorf("server.swagger.require_admin needs admin.tokens")
+			}
+			authn = a.adminAuth
+		}
+		swaggerUI, err := server.NewSwaggerHandler(authn)
+		if err != nil {
+			return fmt.Errorf("failed to load Swagger UI: %w", err)
+		}
+		if sw.Addr != "" {
+			a.httpOpts = append(a.httpOpts, server.WithoutSwagger())
+			swaggerServer := &http.Server{Addr: sw.Addr, Handler: swaggerUI}
+			a.lc.Register(lifecycle.Hook{
+				Name:     "swagger server",
+				Priority: priorityInternal,
+				Start:    serveInternal(log, "Swagger UI", swaggerServer),
+				Stop:     closeFunc(swaggerServer),
+			})
+			log.Info("Swagger UI listening on %s", sw.Addr)
+		} else {
+			a.httpOpts = append(a.httpOpts, server.WithSwagger(swaggerUI))
+		}
+	}
+
+	if a.tracer != nil {
+		a.httpOpts = append(a.httpOpts, server.WithTracing(a.tracer))
+		a.gatewayDialOpts = append(a.gatewayDialOpts,
+			grpc.WithChainUnaryInterceptor(a.tracer.UnaryClientInterceptor()),
+			grpc.WithChainStreamInterceptor(a.tracer.StreamClientInterceptor()),
+		)
+	}
+
+	// Metrics are scraped from the HTTP port, or from a port of their own
+	// kept off the public network
+	if a.requestMetrics != nil {
+		a.httpOpts = append(a.httpOpts, server.WithMetrics(a.requestMetrics))
+		if cfg.Metrics.Port != 0 {
+			addr := net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Metrics.Port))
+			mux := http.NewServeMux()
+			mux.Handle(metrics.Path, a.requestMetrics.Handler())
+			metricsServer := &http.Server{Addr: addr, Handler: mux}
+			a.lc.Register(lifecycle.Hook{
+				Name:     "metrics server",
+				Priority: priorityInternal,
+				Start:    serveInternal(log, "metrics", metricsServer),
+				Stop:     closeFunc(metricsServer),
+			})
+			log.Info("Metrics endpoint listening on %s", addr)
+		} else if a.serveHTTP {
+			a.httpOpts = append(a.httpOpts, server.WithMetricsEndpoint())
+		} else {
+			log.Warn("Metrics are recorded but not served: set metrics.port to serve them without the HTTP port")
+		}
+	}
+	if !a.serveHTTP {
+		return nil
+	}
+
+	// The gateway connects to the gRPC server over TLS when the gRPC
+	// server serves it
+	a.gatewayCreds = insecure.NewCredentials()
+	if cfg.Server.TLS.Enabled {
+		gatewayTLS, err := tlsconfig.Gateway(cfg.Server.TLS)
+		if err != nil {
+			return fmt.Errorf("invalid server.tls configuration: %w", err)
+		}
+		a.gatewayCreds = credentials.NewTLS(gatewayTLS)
+		if a.httpTLS, err = tlsconfig.Server(cfg.Server.TLS, false); err != nil {
+			return fmt.Errorf("invalid server.tls configuration: %w", err)
+		}
+	}
+
+	if c := cfg.Server.Compression; c.Enabled {
+		a.httpOpts = append(a.httpOpts, server.WithCompression(server.CompressionOptions{
+			Level:   c.Level,
+			MinSize: c.MinSize,
+		}))
+	}
+
+	a.httpProtocols.SetHTTP1(true)
+	switch cfg.Server.HTTPAPI {
+	case "gateway", "":
+	case "connect", "both":
+		a.httpOpts = append(a.httpOpts, server.WithConnect())
+		if cfg.Server.HTTPAPI == "connect" {
+			a.httpOpts = append(a.httpOpts, server.WithoutGateway())
+		}
+		// gRPC clients speak HTTP/2, which needs enabling without TLS
+		a.httpProtocols.SetUnencryptedHTTP2(true)
+	default:
+		return fmt.Errorf("unknown server.http_api %q", cfg.Server.HTTPAPI)
+	}
+	switch cfg.Server.Envelope {
+	case "wrapped", "":
+	case "unwrapped":
+		a.httpOpts = append(a.httpOpts, server.WithUnwrappedEnvelope())
+	default:
+		return fmt.Errorf("unknown server.envelope %q, expected wrapped or unwrapped", cfg.Server.Envelope)
+	}
+	// Over TLS, HTTP/2 is negotiated with ALPN
+	if a.httpTLS != nil {
+		a.httpProtocols.SetHTTP2(true)
+	}
+	return nil
+}
+
+// listen listens on the sockets systemd passed when socket activated,
+// otherwise on the configured ports
+func (a *App) listen() error {
+	cfg, log := a.cfg, a.log
+	activated, err := systemd.Listeners()
+	if err != nil {
+		return fmt.Errorf("failed to take activated sockets: %w", err)
+	}
+	if a.serveGRPC {
+		if a.grpcLis, err = listen(log, activated, "grpc", cfg.Server.Host, cfg.Server.GRPCPort); err != nil {
+			return err
+		}
+	} else {
+		a.grpcLis = a.inProcess.Listener()
+	}
+	if a.serveHTTP {
+		if a.httpLis, err = listen(log, activated, "http", cfg.Server.Host, cfg.Server.HTTPPort); err != nil {
+			a.grpcLis.Close()
+			return err
+		}
+	}
+	for name, l := range activated {
+		log.Warn("Ignoring activated socket %q, expected FileDescriptorName grpc or http", name)
+		l.Close()
+	}
+	return nil
+}
+
+// startServers serves gRPC and, with the gateway connected to it, HTTP.
+// Readiness fails as soon as shutdown begins, while the servers keep
+// serving for the drain delay. Then HTTP drains before gRPC, as the
+// gateway's requests are gRPC calls.
+func (a *App) startServers() error {
+	go func() {
+		if err := a.grpcServer.Serve(a.grpcLis); err != nil {
+			a.fail(fmt.Errorf("failed to serve gRPC: %w", err))
+		}
+	}()
+	a.lc.Register(lifecycle.Hook{
+		Name:     "servers",
+		Priority: priorityServers,
+		Timeout:  a.serverBudget,
+		Drain:    a.drain.Start,
+		Stop: func(ctx context.Context) error {
+			var err error
+			if a.httpServer != nil {
+				err = a.httpServer.Shutdown(ctx)
+				a.gatewayConn.Close()
+			}
+			a.checker.Shutdown()
+			stopGRPCServer(ctx, a.grpcServer, a.log)
+			return err
+		},
+	})
+	if !a.serveHTTP {
+		return nil
+	}
+
+	// Connect the gateway to the gRPC server once, shared by all requests
+	grpcTarget := dialTarget(a.grpcLis.Addr())
+	if a.inProcess != nil {
+		grpcTarget = a.inProcess.Target()
+	}
+	conn, err := server.DialGateway(a.ctx,
+		grpcTarget,
+		server.GatewayOptions{ConnectTimeout: a.cfg.Server.GatewayConnectTimeout},
+		append([]grpc.DialOption{grpc.WithTransportCredentials(a.gatewayCreds)}, a.gatewayDialOpts...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to connect gateway: %w", err)
+	}
+	handler, err := server.NewHTTPHandler(a.ctx, conn, a.log, a.services, a.httpOpts...)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to create HTTP handler: %w", err)
+	}
+	httpServer := &http.Server{
+		Handler:   handler,
+		Protocols: &a.httpProtocols,
+		TLSConfig: a.httpTLS,
+	}
+	a.httpServer, a.gatewayConn = httpServer, conn
+
+	go func() {
+		serve := httpServer.Serve
+		if httpServer.TLSConfig != nil {
+			serve = func(lis net.Listener) error { return httpServer.ServeTLS(lis, "", "") }
+		}
+		if err := serve(a.httpLis); err != nil && err != http.ErrServerClosed {
+			a.fail(fmt.Errorf("failed to serve HTTP: %w", err))
+		}
+	}()
+	return nil
+}
+
+// stopGRPCServer drains in-flight RPCs, closing the remaining connections
+// when ctx ends
+func stopGRPCServer(ctx context.Context, grpcServer *grpc.Server, log logger.Logger) {
+	done := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn("gRPC server drain deadline exceeded, closing open connections")
+		grpcServer.Stop()
+		<-done
+	}
+}
+
+// listen returns the activated socket called name, or listens on host:port
+func listen(log logger.Logger, activated map[string]net.Listener, name, host string, port int) (net.Listener, error) {
+	if l, ok := activated[name]; ok {
+		delete(activated, name)
+		log.Info("Using systemd activated socket %q on %s", name, l.Addr())
+		return l, nil
+	}
+	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	return l, nil
+}
+
+// dialTarget is the gRPC target the gateway dials to reach addr
+func dialTarget(addr net.Addr) string {
+	if addr.Network() == "unix" {
+		return "unix://" + addr.String()
+	}
+	return addr.String()
+}
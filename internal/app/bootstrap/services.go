@@ -0,0 +1,33 @@
+package bootstrap
+
+import (
+	"fmt"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	apiv2 "github.com/ChyiYaqing/go-microservice-template/api/proto/v2"
+	"github.com/ChyiYaqing/go-microservice-template/internal/app"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+)
+
+// buildServices registers the API services, served over gRPC, the gateway
+// and HTTP alike, of the versions server.api_versions lists
+func (a *App) buildServices() error {
+	cfg := a.cfg
+
+	// Each version's gateway routes are under its own prefix, /v1 and /v2,
+	// and its services adapt the same internals, e.g. api.v2.UserService
+	// wraps the v1 UserService
+	versioned, err := app.SelectVersions(cfg.Server.APIVersions,
+		app.NewService(&apiv1.UserService_ServiceDesc, a.userService, apiv1.RegisterUserServiceHandler),
+		app.NewService(&apiv1.AdminService_ServiceDesc, a.admin, apiv1.RegisterAdminServiceHandler),
+		app.NewService(&apiv1.TaskService_ServiceDesc, service.NewTaskService(a.jobQueue), apiv1.RegisterTaskServiceHandler),
+		app.NewService(&apiv2.UserService_ServiceDesc, service.NewUserServiceV2(a.userService), apiv2.RegisterUserServiceHandler),
+	)
+	if err != nil {
+		return fmt.Errorf("invalid server.api_versions: %w", err)
+	}
+	if a.services, err = app.NewRegistry(versioned...); err != nil {
+		return fmt.Errorf("failed to register services: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/audit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/cache"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idempotency"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lifecycle"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/redis/go-redis/v9"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// buildStores opens the user repository and the audit sink, and creates
+// the generator of user IDs
+func (a *App) buildStores() error {
+	cfg := a.cfg
+
+	// The audit sink is written by the audit buffer and purged by the
+	// retention job
+	auditSink, err := newAuditSink(cfg, a.log)
+	if err != nil {
+		return fmt.Errorf("invalid audit configuration: %w", err)
+	}
+	a.auditSink = auditSink
+
+	// Users, and the outbox of their events, which the relay job reads
+	userRepo, closeUserRepo, err := newUserRepository(a.ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open user repository: %w", err)
+	}
+	a.userRepo = userRepo
+	a.lc.Register(lifecycle.Hook{
+		Name:     "user repository",
+		Priority: priorityStores,
+		Stop:     func(context.Context) error { return closeUserRepo() },
+	})
+
+	if a.ids, err = idgen.New(cfg.ID.Strategy); err != nil {
+		return fmt.Errorf("invalid ID configuration: %w", err)
+	}
+	return nil
+}
+
+// newUserRepository opens the user repository of storage.driver, behind
+// the cache when it is enabled, and returns a func closing the connections
+// it opened
+func newUserRepository(ctx context.Context, cfg *config.Config) (repository.UserRepository, func() error, error) {
+	repo, closeRepo, err := repository.Open(ctx, cfg.Storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !cfg.Cache.Enabled {
+		return repo, closeRepo, nil
+	}
+	c, closeCache, err := newCache(cfg)
+	if err != nil {
+		closeRepo()
+		return nil, nil, err
+	}
+	cached := repository.NewCachedRepository(repo, c, repository.CacheOptions{
+		KeyPrefix: cfg.Cache.KeyPrefix,
+		TTL:       cfg.Cache.TTL,
+	})
+	return cached, func() error {
+		return errors.Join(closeCache(), closeRepo())
+	}, nil
+}
+
+// newCache creates the cache of cache.backend, in cache.addr or the shared
+// redis for the redis backend, and a func closing its connection
+func newCache(cfg *config.Config) (cache.Cache, func() error, error) {
+	switch cfg.Cache.Backend {
+	case "redis", "":
+		addr := cfg.Cache.Addr
+		if addr == "" {
+			addr = cfg.Redis.Addr
+		}
+		client := redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		return cache.NewRedisCache(client), client.Close, nil
+	case "memory":
+		return cache.NewMemoryCache(nil), func() error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown cache backend %q", cfg.Cache.Backend)
+	}
+}
+
+func newLocker(cfg *config.Config) (lock.Locker, error) {
+	switch cfg.Lock.Driver {
+	case "memory", "":
+		return lock.NewMemoryLocker(), nil
+	case "redis":
+		addrs := cfg.Lock.RedisAddrs
+		if len(addrs) == 0 {
+			addrs = []string{cfg.Redis.Addr}
+		}
+		clients := make([]redis.UniversalClient, 0, len(addrs))
+		for _, addr := range addrs {
+			clients = append(clients, redis.NewClient(&redis.Options{
+				Addr:     addr,
+				Password: cfg.Redis.Password,
+				DB:       cfg.Redis.DB,
+			}))
+		}
+		return lock.NewRedisLocker(clients, lock.RedisOptions{TTL: cfg.Lock.TTL}), nil
+	case "etcd":
+		client, err := clientv3.New(clientv3.Config{
+			Endpoints:   cfg.Lock.EtcdEndpoints,
+			DialTimeout: 5 * time.Second,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return lock.NewEtcdLocker(client, lock.EtcdOptions{TTL: cfg.Lock.TTL}), nil
+	default:
+		return nil, fmt.Errorf("unknown lock driver %q", cfg.Lock.Driver)
+	}
+}
+
+func newQueueStore(cfg *config.Config, keyPrefix string) (queue.Store, error) {
+	switch cfg.Queue.Driver {
+	case "memory", "":
+		return queue.NewMemoryStore(), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		return queue.NewRedisStore(client, keyPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown queue driver %q", cfg.Queue.Driver)
+	}
+}
+
+// newIdempotencyStore creates the store of cfg.Idempotency.Backend. The
+// redis backend records in the shared redis so a retry is recognized on
+// every replica.
+func newIdempotencyStore(cfg *config.Config) (idempotency.Store, error) {
+	switch cfg.Idempotency.Backend {
+	case "memory", "":
+		return idempotency.NewMemoryStore(nil), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		return idempotency.NewRedisStore(client, cfg.Idempotency.KeyPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown idempotency backend %q", cfg.Idempotency.Backend)
+	}
+}
+
+// newAuditSink returns the configured audit sink, also used when auditing
+// is disabled so the retention job has a single place to purge
+func newAuditSink(cfg *config.Config, log logger.Logger) (audit.Sink, error) {
+	switch cfg.Audit.Sink {
+	case "log", "":
+		return audit.LogSink(log), nil
+	case "memory":
+		return audit.NewMemorySink(), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q", cfg.Audit.Sink)
+	}
+}
@@ -0,0 +1,111 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idempotency"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lifecycle"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/pagination"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+)
+
+// buildUsers creates the user service with its scheduled jobs and
+// consumed commands, and registers the hooks of the scheduler and queues
+// once every job is
+func (a *App) buildUsers() error {
+	cfg, log := a.cfg, a.log
+
+	idempotencyStore, err := newIdempotencyStore(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid idempotency configuration: %w", err)
+	}
+	userOpts := []service.Option{
+		service.WithRepository(a.userRepo),
+		service.WithIDGenerator(a.ids),
+		service.WithEventBus(a.userEvents),
+		service.WithPageTokens(pagination.NewTokens([]byte(cfg.Pagination.Secret))),
+		service.WithIdempotency(idempotency.New(idempotencyStore, idempotency.Options{
+			TTL:        cfg.Idempotency.TTL,
+			PendingTTL: cfg.Idempotency.PendingTTL,
+		})),
+	}
+	if cfg.Pagination.Secret == "" {
+		log.Warn("No pagination secret set, page tokens only work on the replica that issued them")
+	}
+	if cfg.Outbox.Enabled {
+		userOpts = append(userOpts, service.WithOutbox(cfg.Outbox.Topic, cfg.Outbox.Source))
+	}
+	a.userService = service.NewUserService(userOpts...)
+	a.userService.RegisterTasks(a.jobQueue)
+	if err := reindexOnUpgrade(a.ctx, log, a.userRepo, a.jobQueue); err != nil {
+		return err
+	}
+	if cfg.Retention.Enabled {
+		if err := registerRetention(a.jobs, cfg, log, a.auditSink, repository.OutboxOf(a.userRepo), a.userService); err != nil {
+			return fmt.Errorf("invalid retention configuration: %w", err)
+		}
+	}
+	if err := a.jobs.Configure(cfg.Scheduler); err != nil {
+		return fmt.Errorf("invalid scheduler configuration: %w", err)
+	}
+	a.lc.Register(lifecycle.Hook{
+		Name:     "scheduler",
+		Priority: priorityScheduler,
+		Start:    a.jobs.Start,
+		Stop: func(ctx context.Context) error {
+			return errors.Join(a.jobs.Stop(ctx), a.elector.Close(ctx))
+		},
+	})
+	a.lc.Register(lifecycle.Hook{Name: "job queue", Priority: priorityQueues, Start: a.jobQueue.Start, Stop: a.jobQueue.Stop})
+	a.lc.Register(lifecycle.Hook{Name: "webhook queue", Priority: priorityQueues, Start: a.webhookQueue.Start, Stop: a.webhookQueue.Stop})
+
+	// Asynchronous commands from the broker, each handled by one replica
+	if cfg.Consumer.Enabled {
+		commands, err := newConsumer(cfg, log)
+		if err != nil {
+			return fmt.Errorf("invalid consumer configuration: %w", err)
+		}
+		a.userService.RegisterCommands(commands)
+		a.lc.Register(lifecycle.Hook{Name: "consumer", Priority: priorityConsumers, Start: commands.Start, Stop: commands.Stop})
+	}
+
+	// Watch streams never end on their own, so the servers would wait out
+	// their budget for them. Clients reconnect to another instance.
+	a.lc.Register(lifecycle.Hook{
+		Name:     "watch streams",
+		Priority: priorityStreams,
+		Stop:     func(context.Context) error { a.userService.StopWatches(); return nil },
+	})
+	return nil
+}
+
+// reindexOnUpgrade queues a rebuild of the indexes of the stored users when
+// they were indexed with another IndexVersion. Replicas starting together
+// may each queue one; the rebuilds are idempotent.
+func reindexOnUpgrade(ctx context.Context, log logger.Logger, users repository.UserRepository, jobQueue *queue.Queue) error {
+	r, ok := users.(repository.Reindexer)
+	if !ok {
+		return nil
+	}
+	version, err := r.IndexVersion(ctx)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the user index version: %w", err)
+	}
+	if version == repository.IndexVersion {
+		return nil
+	}
+	job, err := service.ScheduleReindex(ctx, jobQueue)
+	if err != nil {
+		return fmt.Errorf("failed to schedule reindexing users: %w", err)
+	}
+	log.Info("Users are indexed with version %d, reindexing them with version %d as task tasks/%s", version, repository.IndexVersion, job.ID)
+	return nil
+}
@@ -0,0 +1,284 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+)
+
+// Handler processes messages of one type. Returning an error has the
+// message redelivered after a backoff, or dead-lettered once it has used
+// up its attempts. Wrap the error with Permanent to dead-letter it right
+// away.
+type Handler func(ctx context.Context, msg *Message) error
+
+// Permanent marks err as one that retrying cannot fix
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Options configures a Consumer
+type Options struct {
+	// Workers is the number of messages handled at once (default 1)
+	Workers int
+
+	// BatchSize is how many messages are received at once (default 10)
+	BatchSize int
+
+	// MaxAttempts is the number of deliveries before a failing message is
+	// dead-lettered (default 5)
+	MaxAttempts int
+
+	// HandlerTimeout bounds each handler call (default 30s)
+	HandlerTimeout time.Duration
+
+	Backoff queue.Backoff
+
+	// DeadLetter receives the messages that failed for good, on
+	// DeadLetterTopic with their original payload. Without it they are
+	// logged and dropped.
+	DeadLetter      outbox.Publisher
+	DeadLetterTopic string
+}
+
+// Consumer receives messages from a Subscriber and runs the handlers
+// registered for their type
+type Consumer struct {
+	sub  Subscriber
+	log  logger.Logger
+	opts Options
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	started  bool
+	stopped  bool
+
+	// receiveCtx ends receiving when Stop is called, ctx is passed to
+	// handlers and cancelled when Stop runs out of time
+	receiveCtx    context.Context
+	stopReceiving context.CancelFunc
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+// New creates a Consumer of sub. Register handlers, then call Start.
+func New(sub Subscriber, log logger.Logger, opts Options) *Consumer {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 10
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.HandlerTimeout <= 0 {
+		opts.HandlerTimeout = 30 * time.Second
+	}
+	if opts.Backoff.Initial <= 0 {
+		opts.Backoff.Initial = time.Second
+	}
+	if opts.Backoff.Max <= 0 {
+		opts.Backoff.Max = 5 * time.Minute
+	}
+
+	receiveCtx, stopReceiving := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Consumer{
+		sub:           sub,
+		log:           log,
+		opts:          opts,
+		handlers:      make(map[string]Handler),
+		receiveCtx:    receiveCtx,
+		stopReceiving: stopReceiving,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Register sets the handler for messages of the given type, see
+// Message.Type
+func (c *Consumer) Register(typ string, h Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[typ] = h
+}
+
+// Start begins receiving messages. Handlers do not inherit ctx, so a
+// cancelled startup context does not abort the drain in Stop.
+func (c *Consumer) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return errors.New("consumer: stopped")
+	}
+	if c.started {
+		return nil
+	}
+	c.started = true
+
+	deliveries := make(chan Delivery)
+	c.wg.Add(1 + c.opts.Workers)
+	go c.receive(deliveries)
+	for i := 0; i < c.opts.Workers; i++ {
+		go c.work(deliveries)
+	}
+	return nil
+}
+
+// Stop stops receiving, waits for running handlers and closes the
+// Subscriber. If ctx ends first, handlers are cancelled and ctx's error is
+// returned; their messages are redelivered.
+func (c *Consumer) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	c.stopReceiving()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c.cancel()
+	<-done
+	return errors.Join(err, c.sub.Close())
+}
+
+// receive hands the received messages to the workers until Stop
+func (c *Consumer) receive(deliveries chan<- Delivery) {
+	defer c.wg.Done()
+	defer close(deliveries)
+
+	for c.receiveCtx.Err() == nil {
+		batch, err := c.sub.Receive(c.receiveCtx, c.opts.BatchSize)
+		if err != nil {
+			c.log.Error("Failed to receive messages: %v", err)
+			select {
+			case <-c.receiveCtx.Done():
+			case <-time.After(c.opts.Backoff.Initial):
+			}
+			continue
+		}
+		for i, d := range batch {
+			select {
+			case deliveries <- d:
+			case <-c.receiveCtx.Done():
+				// Received but not started: give them back right away
+				for _, d := range batch[i:] {
+					c.settle(d.Nak(c.ctx, 0), d)
+				}
+				return
+			}
+		}
+	}
+}
+
+func (c *Consumer) work(deliveries <-chan Delivery) {
+	defer c.wg.Done()
+	for d := range deliveries {
+		c.process(d)
+	}
+}
+
+// process runs the handler of a delivery and settles it by the outcome
+func (c *Consumer) process(d Delivery) {
+	msg := d.Message()
+	msg.parse()
+
+	c.mu.RLock()
+	handler, ok := c.handlers[msg.Type]
+	c.mu.RUnlock()
+
+	var err error
+	if ok {
+		ctx, cancel := context.WithTimeout(c.ctx, c.opts.HandlerTimeout)
+		err = c.run(ctx, handler, msg)
+		cancel()
+	} else {
+		err = Permanent(fmt.Errorf("no handler registered for type %q", msg.Type))
+	}
+
+	// Settle with a fresh context so the outcome is recorded while draining
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	switch {
+	case err == nil:
+		c.settle(d.Ack(ctx), d)
+	case ok && c.ctx.Err() != nil:
+		c.log.Warn("Message %s (%s) interrupted by shutdown, returned to the broker", msg.ID, msg.Type)
+		c.settle(d.Nak(ctx, 0), d)
+	case msg.Attempt >= c.opts.MaxAttempts || errors.As(err, new(*permanentError)):
+		c.deadLetter(ctx, d, msg, err)
+	default:
+		delay := c.opts.Backoff.Delay(msg.Attempt)
+		c.log.Warn("Message %s (%s) failed on attempt %d, retrying in %v: %v", msg.ID, msg.Type, msg.Attempt, delay, err)
+		c.settle(d.Nak(ctx, delay), d)
+	}
+}
+
+// deadLetter publishes a message that failed for good to the dead-letter
+// topic and removes it. If publishing fails the message is redelivered
+// later rather than lost.
+func (c *Consumer) deadLetter(ctx context.Context, d Delivery, msg *Message, cause error) {
+	if c.opts.DeadLetter == nil {
+		c.log.Error("Message %s (%s) dropped after %d attempt(s): %v", msg.ID, msg.Type, msg.Attempt, cause)
+		c.settle(d.Term(ctx), d)
+		return
+	}
+	dead := &outbox.Message{
+		// A new ID, so a broker deduplicating by ID keeps the copy
+		ID:         msg.ID + ".dead",
+		Topic:      c.opts.DeadLetterTopic,
+		Key:        msg.Topic,
+		Payload:    msg.Payload,
+		CreateTime: time.Now(),
+	}
+	if err := c.opts.DeadLetter.Publish(ctx, dead); err != nil {
+		delay := c.opts.Backoff.Delay(msg.Attempt)
+		c.log.Error("Failed to dead-letter message %s (%s), retrying in %v: %v", msg.ID, msg.Type, delay, err)
+		c.settle(d.Nak(ctx, delay), d)
+		return
+	}
+	c.log.Error("Message %s (%s) dead-lettered to %s after %d attempt(s): %v", msg.ID, msg.Type, dead.Topic, msg.Attempt, cause)
+	c.settle(d.Term(ctx), d)
+}
+
+// settle logs the error of settling d. The broker redelivers the message.
+func (c *Consumer) settle(err error, d Delivery) {
+	if err != nil {
+		c.log.Error("Failed to settle message %s: %v", d.Message().ID, err)
+	}
+}
+
+// run calls the handler, turning a panic into an error
+func (c *Consumer) run(ctx context.Context, h Handler, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return h(ctx, msg)
+}
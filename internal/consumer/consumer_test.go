@@ -0,0 +1,248 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+)
+
+func newTestConsumer(t *testing.T, broker *MemoryBroker, dead *MemoryBroker) *Consumer {
+	t.Helper()
+	c := New(broker, logger.Nop(), Options{
+		MaxAttempts:     3,
+		Backoff:         queue.Backoff{Initial: time.Millisecond, Max: time.Millisecond},
+		DeadLetter:      dead,
+		DeadLetterTopic: "dead",
+	})
+	t.Cleanup(func() { c.Stop(context.Background()) })
+	return c
+}
+
+func publishEvent(t *testing.T, broker *MemoryBroker, id, typ string, data any) {
+	t.Helper()
+	raw, _ := json.Marshal(data)
+	msg, err := outbox.NewCloudEvent("commands", id, outbox.CloudEvent{ID: id, Source: "//test", Type: typ, Data: raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker.Publish(context.Background(), msg)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConsumerDispatchesByType(t *testing.T) {
+	broker := NewMemoryBroker()
+	c := newTestConsumer(t, broker, NewMemoryBroker())
+
+	type greet struct {
+		Name string `json:"name"`
+	}
+	var mu sync.Mutex
+	var got []string
+	c.Register("greet", JSON(func(ctx context.Context, g *greet) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, g.Name)
+		return nil
+	}))
+	c.Register("plain", func(ctx context.Context, msg *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, string(msg.Data()))
+		return nil
+	})
+	c.Start(context.Background())
+
+	publishEvent(t, broker, "1", "greet", greet{Name: "ada"})
+	// Payloads that are not CloudEvents are dispatched by topic
+	broker.Publish(context.Background(), &outbox.Message{ID: "2", Topic: "plain", Payload: []byte("raw")})
+
+	waitFor(t, "both messages acked", func() bool { return broker.Len() == 0 })
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got[0] != "ada" || got[1] != "raw" {
+		t.Errorf("handled %v, want [ada raw]", got)
+	}
+}
+
+func TestConsumerRetriesWithBackoff(t *testing.T) {
+	broker, dead := NewMemoryBroker(), NewMemoryBroker()
+	c := newTestConsumer(t, broker, dead)
+
+	var mu sync.Mutex
+	var attempts []int
+	c.Register("flaky", func(ctx context.Context, msg *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, msg.Attempt)
+		if msg.Attempt < 2 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+	c.Start(context.Background())
+	publishEvent(t, broker, "1", "flaky", nil)
+
+	waitFor(t, "message acked", func() bool { return broker.Len() == 0 })
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 2 || attempts[1] != 2 {
+		t.Errorf("attempts = %v, want [1 2]", attempts)
+	}
+	if dead.Len() != 0 {
+		t.Errorf("dead letters = %d, want none", dead.Len())
+	}
+}
+
+func TestConsumerDeadLetters(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      string
+		attempts int
+	}{
+		{"used up attempts", "failing", 3},
+		{"permanent error", "permanent", 1},
+		{"no handler", "unknown", 0},
+		{"undecodable", "decode", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker, dead := NewMemoryBroker(), NewMemoryBroker()
+			c := newTestConsumer(t, broker, dead)
+			var mu sync.Mutex
+			calls := 0
+			count := func() {
+				mu.Lock()
+				defer mu.Unlock()
+				calls++
+			}
+			c.Register("failing", func(ctx context.Context, msg *Message) error {
+				count()
+				return errors.New("broken")
+			})
+			c.Register("permanent", func(ctx context.Context, msg *Message) error {
+				count()
+				return Permanent(errors.New("invalid"))
+			})
+			c.Register("decode", JSON(func(ctx context.Context, v *struct{ N int }) error {
+				count()
+				return nil
+			}))
+			c.Start(context.Background())
+			publishEvent(t, broker, "1", tt.typ, "not an object")
+
+			waitFor(t, "message dead-lettered", func() bool { return broker.Len() == 0 && dead.Len() == 1 })
+			mu.Lock()
+			defer mu.Unlock()
+			if calls != tt.attempts {
+				t.Errorf("handler calls = %d, want %d", calls, tt.attempts)
+			}
+			batch, _ := dead.Receive(context.Background(), 1)
+			if msg := batch[0].Message(); msg.Topic != "dead" || msg.ID != "1.dead" {
+				t.Errorf("dead letter = %+v, want 1.dead on dead", msg)
+			}
+		})
+	}
+}
+
+func TestConsumerKeepsMessageWhenDeadLetteringFails(t *testing.T) {
+	broker := NewMemoryBroker()
+	var mu sync.Mutex
+	tries := 0
+	c := New(broker, logger.Nop(), Options{
+		MaxAttempts: 1,
+		Backoff:     queue.Backoff{Initial: time.Millisecond, Max: time.Millisecond},
+		DeadLetter: outbox.PublisherFunc(func(ctx context.Context, msg *outbox.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			tries++
+			return errors.New("broker down")
+		}),
+		DeadLetterTopic: "dead",
+	})
+	c.Start(context.Background())
+	publishEvent(t, broker, "1", "unknown", nil)
+
+	waitFor(t, "dead-lettering retried", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return tries >= 2
+	})
+	c.Stop(context.Background())
+	if broker.Len() != 1 {
+		t.Errorf("broker holds %d messages, want the one that could not be dead-lettered", broker.Len())
+	}
+}
+
+func TestConsumerStopDrains(t *testing.T) {
+	broker := NewMemoryBroker()
+	c := New(broker, logger.Nop(), Options{})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	c.Register("slow", func(ctx context.Context, msg *Message) error {
+		close(started)
+		<-release
+		return nil
+	})
+	c.Start(context.Background())
+	publishEvent(t, broker, "1", "slow", nil)
+	<-started
+
+	stopped := make(chan error)
+	go func() { stopped <- c.Stop(context.Background()) }()
+	select {
+	case <-stopped:
+		t.Fatal("Stop() returned before the handler finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Errorf("Stop() unexpected error: %v", err)
+	}
+	if broker.Len() != 0 {
+		t.Errorf("broker holds %d messages, want the handled one acked", broker.Len())
+	}
+	if err := c.Start(context.Background()); err == nil {
+		t.Error("Start() after Stop() expected error")
+	}
+}
+
+func TestConsumerStopTimeoutRedelivers(t *testing.T) {
+	broker := NewMemoryBroker()
+	c := New(broker, logger.Nop(), Options{})
+	started := make(chan struct{})
+	c.Register("stuck", func(ctx context.Context, msg *Message) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c.Start(context.Background())
+	publishEvent(t, broker, "1", "stuck", nil)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	batch, _ := broker.Receive(context.Background(), 1)
+	if len(batch) != 1 {
+		t.Fatalf("interrupted message not returned to the broker")
+	}
+}
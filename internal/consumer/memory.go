@@ -0,0 +1,149 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+)
+
+// MemoryBroker is an in-process broker: an outbox.Publisher whose messages
+// are received by its Subscriber side, for tests and single-process
+// development. Messages are lost on restart.
+type MemoryBroker struct {
+	mu      sync.Mutex
+	entries []*memoryEntry
+
+	// wake is closed and replaced when messages become receivable
+	wake chan struct{}
+}
+
+type memoryEntry struct {
+	msg      *outbox.Message
+	attempts int
+	due      time.Time
+	inFlight bool
+}
+
+// NewMemoryBroker creates an empty MemoryBroker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{wake: make(chan struct{})}
+}
+
+// Publish queues msg for delivery
+func (b *MemoryBroker) Publish(ctx context.Context, msg *outbox.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = append(b.entries, &memoryEntry{msg: msg})
+	b.notify()
+	return nil
+}
+
+// Len returns the number of messages not yet acked or terminated
+func (b *MemoryBroker) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.entries)
+}
+
+// Receive returns up to n due messages, waiting for one until ctx ends
+func (b *MemoryBroker) Receive(ctx context.Context, n int) ([]Delivery, error) {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		var out []Delivery
+		var next time.Time
+		for _, e := range b.entries {
+			if e.inFlight {
+				continue
+			}
+			if e.due.After(now) {
+				if next.IsZero() || e.due.Before(next) {
+					next = e.due
+				}
+				continue
+			}
+			if len(out) == n {
+				break
+			}
+			e.inFlight = true
+			e.attempts++
+			out = append(out, &memoryDelivery{broker: b, entry: e})
+		}
+		wake := b.wake
+		b.mu.Unlock()
+		if len(out) > 0 {
+			return out, nil
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+	}
+}
+
+// Close does nothing, the messages stay for the next Receive
+func (b *MemoryBroker) Close() error {
+	return nil
+}
+
+// notify wakes the receivers. b.mu must be held.
+func (b *MemoryBroker) notify() {
+	close(b.wake)
+	b.wake = make(chan struct{})
+}
+
+func (b *MemoryBroker) remove(e *memoryEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, other := range b.entries {
+		if other == e {
+			b.entries = append(b.entries[:i], b.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+type memoryDelivery struct {
+	broker *MemoryBroker
+	entry  *memoryEntry
+}
+
+func (d *memoryDelivery) Message() *Message {
+	msg := d.entry.msg
+	return &Message{ID: msg.ID, Topic: msg.Topic, Payload: msg.Payload, Attempt: d.entry.attempts}
+}
+
+func (d *memoryDelivery) Ack(ctx context.Context) error {
+	d.broker.remove(d.entry)
+	return nil
+}
+
+func (d *memoryDelivery) Nak(ctx context.Context, delay time.Duration) error {
+	d.broker.mu.Lock()
+	defer d.broker.mu.Unlock()
+	d.entry.inFlight = false
+	d.entry.due = time.Now().Add(delay)
+	d.broker.notify()
+	return nil
+}
+
+func (d *memoryDelivery) Term(ctx context.Context) error {
+	d.broker.remove(d.entry)
+	return nil
+}
@@ -0,0 +1,98 @@
+// Package consumer receives messages from a broker topic and dispatches
+// them to handlers registered by message type, retrying failed messages
+// with backoff and dead-lettering those that keep failing.
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Message is a message received from a broker
+type Message struct {
+	ID    string
+	Topic string
+
+	// Payload is the message as received
+	Payload []byte
+
+	// Attempt counts the deliveries of the message, 1 the first time
+	Attempt int
+
+	// Type selects the handler: the type of the CloudEvent the payload
+	// holds, else the topic
+	Type string
+
+	// Event is the CloudEvent in the payload, nil if it holds none
+	Event *outbox.CloudEvent
+}
+
+// parse sets Type and Event from the payload. Payloads in the structured
+// CloudEvents format, as published by the outbox, are dispatched by their
+// event type.
+func (m *Message) parse() {
+	m.Type, m.Event = m.Topic, nil
+	var ev outbox.CloudEvent
+	if json.Unmarshal(m.Payload, &ev) != nil || ev.SpecVersion == "" || ev.Type == "" {
+		return
+	}
+	m.Type, m.Event = ev.Type, &ev
+}
+
+// Data returns the data of the CloudEvent, or the payload of other
+// messages
+func (m *Message) Data() []byte {
+	if m.Event != nil {
+		return m.Event.Data
+	}
+	return m.Payload
+}
+
+// Decode unmarshals Data into v. A proto.Message is decoded from protojson
+// when the data is a JSON object and from the binary wire format otherwise;
+// anything else from JSON. Fields v does not know are ignored, so producers
+// can add them first.
+func (m *Message) Decode(v any) error {
+	data := m.Data()
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return json.Unmarshal(data, v)
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, pm)
+	}
+	return proto.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, pm)
+}
+
+// JSON adapts fn to a Handler decoding the message data as JSON. Data that
+// does not decode fails permanently, retrying would not change it.
+func JSON[T any](fn func(ctx context.Context, v *T) error) Handler {
+	return func(ctx context.Context, msg *Message) error {
+		v := new(T)
+		if err := msg.Decode(v); err != nil {
+			return Permanent(fmt.Errorf("decode %s: %w", msg.Type, err))
+		}
+		return fn(ctx, v)
+	}
+}
+
+// Proto adapts fn to a Handler decoding the message data into a new M, see
+// Message.Decode. Data that does not decode fails permanently.
+func Proto[T any, M interface {
+	*T
+	proto.Message
+}](fn func(ctx context.Context, v M) error) Handler {
+	return func(ctx context.Context, msg *Message) error {
+		v := M(new(T))
+		if err := msg.Decode(v); err != nil {
+			return Permanent(fmt.Errorf("decode %s: %w", msg.Type, err))
+		}
+		return fn(ctx, v)
+	}
+}
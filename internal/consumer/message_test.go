@@ -0,0 +1,53 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMessageDecodeProto(t *testing.T) {
+	want := &apiv1.DeleteUserRequest{Name: "users/1"}
+	binary, _ := proto.Marshal(want)
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"protojson", []byte(`{"name": "users/1", "added_later": true}`)},
+		{"binary", binary},
+		{"cloud event", []byte(`{"specversion": "1.0", "id": "1", "source": "//test", "type": "user.delete", "data": {"name": "users/1"}}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{Topic: "commands", Payload: tt.payload}
+			msg.parse()
+			var got *apiv1.DeleteUserRequest
+			h := Proto(func(ctx context.Context, req *apiv1.DeleteUserRequest) error {
+				got = req
+				return nil
+			})
+			if err := h(context.Background(), msg); err != nil {
+				t.Fatalf("handler unexpected error: %v", err)
+			}
+			if !proto.Equal(got, want) {
+				t.Errorf("decoded %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMessageParse(t *testing.T) {
+	msg := &Message{Topic: "commands", Payload: []byte(`{"specversion": "1.0", "id": "1", "source": "//test", "type": "user.delete"}`)}
+	msg.parse()
+	if msg.Type != "user.delete" || msg.Event == nil {
+		t.Errorf("CloudEvent parsed as type %q, event %v", msg.Type, msg.Event)
+	}
+
+	msg = &Message{Topic: "commands", Payload: []byte(`{"type": "user.delete"}`)}
+	msg.parse()
+	if msg.Type != "commands" || msg.Event != nil || string(msg.Data()) != string(msg.Payload) {
+		t.Errorf("plain JSON parsed as type %q, event %v, want the topic", msg.Type, msg.Event)
+	}
+}
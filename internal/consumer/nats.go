@@ -0,0 +1,109 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/nats-io/nats.go"
+)
+
+func init() {
+	RegisterTransport("nats", openNATS)
+}
+
+// openNATS connects to cfg.NATSURL and binds the durable pull consumer
+// cfg.Group to cfg.Topic. A server that is down at startup is retried in
+// the background rather than failing startup.
+func openNATS(cfg config.ConsumerConfig, log logger.Logger) (Subscriber, error) {
+	nc, err := nats.Connect(cfg.NATSURL,
+		nats.Name("consumer"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Warn("Consumer lost its NATS connection: %v", err)
+			}
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	// Redeliveries are scheduled by the Consumer with Nak, the server only
+	// redelivers messages whose handler died before settling them
+	sub, err := js.PullSubscribe(cfg.Topic, cfg.Group,
+		nats.ManualAck(),
+		nats.AckWait(cfg.HandlerTimeout+30*time.Second),
+		nats.MaxDeliver(-1),
+	)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return &NATSSubscriber{conn: nc, sub: sub}, nil
+}
+
+// NATSSubscriber receives the messages of a JetStream pull consumer. Every
+// replica binding the same durable consumer shares its messages, so each
+// message is handled by one of them.
+type NATSSubscriber struct {
+	conn *nats.Conn
+	sub  *nats.Subscription
+}
+
+// Receive fetches up to n messages, waiting a few seconds at most
+func (s *NATSSubscriber) Receive(ctx context.Context, n int) ([]Delivery, error) {
+	msgs, err := s.sub.Fetch(n, nats.Context(ctx))
+	if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+	out := make([]Delivery, 0, len(msgs))
+	for _, msg := range msgs {
+		out = append(out, natsDelivery{msg: msg})
+	}
+	return out, nil
+}
+
+// Close drains the subscription and closes the connection
+func (s *NATSSubscriber) Close() error {
+	defer s.conn.Close()
+	return s.sub.Drain()
+}
+
+type natsDelivery struct {
+	msg *nats.Msg
+}
+
+func (d natsDelivery) Message() *Message {
+	msg := &Message{ID: d.msg.Header.Get(nats.MsgIdHdr), Topic: d.msg.Subject, Payload: d.msg.Data, Attempt: 1}
+	if meta, err := d.msg.Metadata(); err == nil {
+		msg.Attempt = int(meta.NumDelivered)
+		if msg.ID == "" {
+			msg.ID = fmt.Sprintf("%s/%d", meta.Stream, meta.Sequence.Stream)
+		}
+	}
+	return msg
+}
+
+func (d natsDelivery) Ack(ctx context.Context) error {
+	return d.msg.AckSync(nats.Context(ctx))
+}
+
+func (d natsDelivery) Nak(ctx context.Context, delay time.Duration) error {
+	return d.msg.NakWithDelay(delay, nats.Context(ctx))
+}
+
+func (d natsDelivery) Term(ctx context.Context) error {
+	return d.msg.Term(nats.Context(ctx))
+}
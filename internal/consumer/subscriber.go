@@ -0,0 +1,90 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Delivery is a message received from a Subscriber, to be settled once
+// with Ack, Nak or Term. The broker redelivers a message that is never
+// settled.
+type Delivery interface {
+	Message() *Message
+
+	// Ack removes the message for good
+	Ack(ctx context.Context) error
+
+	// Nak has the message redelivered after delay
+	Nak(ctx context.Context, delay time.Duration) error
+
+	// Term removes the message without it having been handled
+	Term(ctx context.Context) error
+}
+
+// Subscriber receives the messages of a topic
+type Subscriber interface {
+	// Receive waits for up to n messages. It returns what it has, maybe
+	// nothing, once ctx ends or after a broker-defined wait.
+	Receive(ctx context.Context, n int) ([]Delivery, error)
+
+	// Close releases the connection to the broker
+	Close() error
+}
+
+// Transport opens a Subscriber from the consumer configuration
+type Transport func(cfg config.ConsumerConfig, log logger.Logger) (Subscriber, error)
+
+var (
+	transportsMu sync.RWMutex
+	transports   = make(map[string]Transport)
+)
+
+// RegisterTransport makes a transport available by name to NewSubscriber,
+// so brokers such as Kafka plug in without changes here. It panics if the
+// name is taken, like database/sql.Register.
+func RegisterTransport(name string, t Transport) {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if t == nil {
+		panic("consumer: RegisterTransport transport is nil")
+	}
+	if _, dup := transports[name]; dup {
+		panic("consumer: RegisterTransport called twice for transport " + name)
+	}
+	transports[name] = t
+}
+
+// Transports returns the names of the registered transports, sorted
+func Transports() []string {
+	transportsMu.RLock()
+	defer transportsMu.RUnlock()
+	names := make([]string, 0, len(transports))
+	for name := range transports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSubscriber opens the Subscriber of cfg.Transport. An unknown transport
+// fails with the names of the registered ones.
+func NewSubscriber(cfg config.ConsumerConfig, log logger.Logger) (Subscriber, error) {
+	transportsMu.RLock()
+	t, ok := transports[cfg.Transport]
+	transportsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("consumer: unknown transport %q, expected one of %s", cfg.Transport, strings.Join(Transports(), ", "))
+	}
+	sub, err := t(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("consumer: open %s transport: %w", cfg.Transport, err)
+	}
+	return sub, nil
+}
@@ -0,0 +1,587 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Request is a GraphQL request, as sent in a POST body
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is a GraphQL response. Data is absent when the request failed
+// before execution, e.g. to parse or validate.
+type Response struct {
+	Data   *object  `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// Error is a GraphQL error
+type Error struct {
+	Message    string         `json:"message"`
+	Locations  []Location     `json:"locations,omitempty"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// Location is a position in the request document
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// object is a result object, keeping fields in the order they were
+// selected as the spec requires
+type object []objectField
+
+type objectField struct {
+	key string
+	val any
+}
+
+// MarshalJSON encodes o as a JSON object in field order
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		b.Write(key)
+		b.WriteByte(':')
+		val, err := json.Marshal(f.val)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// resolver calls the method behind a root field with its arguments and
+// returns the result shaped as the field's type
+type resolver func(ctx context.Context, f *Field, args map[string]any) (any, error)
+
+// meta fields available on the query root besides the schema's own
+var (
+	schemaField = &Field{Name: "__schema", Type: nonNull(named("__Schema"))}
+	typeField   = &Field{Name: "__type", Type: named("__Type"), Args: []*InputValue{{Name: "name", Type: nonNull(named("String"))}}}
+)
+
+// executor runs one operation
+type executor struct {
+	schema  *Schema
+	intro   *introspection
+	doc     *document
+	vars    map[string]any
+	resolve resolver
+	errors  []*Error
+}
+
+// execute parses, validates and runs req
+func execute(ctx context.Context, s *Schema, intro *introspection, resolve resolver, req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		e := &Error{Message: err.Error()}
+		if pe, ok := err.(*parseError); ok {
+			e.Locations = []Location{{Line: pe.line, Column: pe.col}}
+		}
+		return &Response{Errors: []*Error{e}}
+	}
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	e := &executor{schema: s, intro: intro, doc: doc, resolve: resolve}
+	root := e.rootType(op)
+	if root == nil {
+		return &Response{Errors: []*Error{{Message: fmt.Sprintf("%s operations are not supported", op.kind)}}}
+	}
+	e.validateOperation(op, root)
+	if len(e.errors) > 0 {
+		return &Response{Errors: e.errors}
+	}
+	e.coerceVariables(op, req.Variables)
+	if len(e.errors) > 0 {
+		return &Response{Errors: e.errors}
+	}
+
+	// Root fields run one after another: mutations must, and queries
+	// are cheap enough that it keeps calls predictable
+	data, _ := e.selectObject(ctx, root, nil, op.selections, nil)
+	return &Response{Data: &data, Errors: e.errors}
+}
+
+func selectOperation(doc *document, name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, fmt.Errorf("operationName is required when the document has several operations")
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+func (e *executor) rootType(op *operation) *Type {
+	switch op.kind {
+	case "query":
+		return e.schema.Query
+	case "mutation":
+		return e.schema.Mutation
+	}
+	return nil
+}
+
+// field returns the field name selects on t, including the meta
+// fields every type or the query root has
+func (e *executor) field(t *Type, name string) *Field {
+	if t == e.schema.Query {
+		switch name {
+		case "__schema":
+			return schemaField
+		case "__type":
+			return typeField
+		}
+	}
+	return t.field(name)
+}
+
+// validateOperation checks op against the schema before anything runs
+func (e *executor) validateOperation(op *operation, root *Type) {
+	defined := make(map[string]bool, len(op.variables))
+	for _, v := range op.variables {
+		if defined[v.name] {
+			e.fail(nil, "variable \"$%s\" is defined twice", v.name)
+		}
+		defined[v.name] = true
+		t := e.schema.types[v.typ.unwrap().Name]
+		if t == nil || t.Kind == kindObject {
+			e.fail(nil, "variable \"$%s\" cannot be of non-input type %q", v.name, v.typ.String())
+		}
+	}
+	e.validateSet(root, op.selections, defined, nil)
+}
+
+// validateSet checks selections made on t. fragments holds the fragments
+// being expanded, to catch cycles.
+func (e *executor) validateSet(t *Type, set []selection, defined map[string]bool, fragments []string) {
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *fieldSelection:
+			e.validateDirectives(sel.directives, defined)
+			if sel.name == "__typename" {
+				if len(sel.selections) > 0 {
+					e.fail(sel, "field \"__typename\" must not have a selection")
+				}
+				continue
+			}
+			f := e.field(t, sel.name)
+			if f == nil {
+				e.fail(sel, "cannot query field %q on type %q", sel.name, t.Name)
+				continue
+			}
+			seen := make(map[string]bool, len(sel.args))
+			for _, a := range sel.args {
+				if f.arg(a.name) == nil {
+					e.fail(sel, "unknown argument %q on field \"%s.%s\"", a.name, t.Name, f.Name)
+				}
+				if seen[a.name] {
+					e.fail(sel, "argument %q is given twice", a.name)
+				}
+				seen[a.name] = true
+				e.validateValue(sel, a.val, defined)
+			}
+			for _, a := range f.Args {
+				if a.Type.Kind == kindNonNull && !seen[a.Name] {
+					e.fail(sel, "argument %q of type %q is required", a.Name, a.Type.String())
+				}
+			}
+			fieldType := e.schema.types[f.Type.unwrap().Name]
+			switch {
+			case fieldType.Kind == kindObject && len(sel.selections) == 0:
+				e.fail(sel, "field %q of type %q must have a selection of subfields", sel.name, f.Type.String())
+			case fieldType.Kind != kindObject && len(sel.selections) > 0:
+				e.fail(sel, "field %q must not have a selection since type %q has no subfields", sel.name, f.Type.String())
+			case fieldType.Kind == kindObject:
+				e.validateSet(fieldType, sel.selections, defined, fragments)
+			}
+		case *fragmentSpread:
+			e.validateDirectives(sel.directives, defined)
+			f, ok := e.doc.fragments[sel.name]
+			if !ok {
+				e.fail(nil, "unknown fragment %q", sel.name)
+				continue
+			}
+			for _, name := range fragments {
+				if name == sel.name {
+					e.fail(nil, "fragment %q spreads itself", sel.name)
+					return
+				}
+			}
+			e.validateDirectives(f.directives, defined)
+			if ft := e.fragmentType(f.typeCondition, t); ft != nil {
+				e.validateSet(ft, f.selections, defined, append(fragments, sel.name))
+			}
+		case *inlineFragment:
+			e.validateDirectives(sel.directives, defined)
+			if ft := e.fragmentType(sel.typeCondition, t); ft != nil {
+				e.validateSet(ft, sel.selections, defined, fragments)
+			}
+		}
+	}
+}
+
+// fragmentType returns the type a fragment on condition applies to within
+// t. Without interfaces or unions, that must be t itself.
+func (e *executor) fragmentType(condition string, t *Type) *Type {
+	if condition == "" || condition == t.Name {
+		return t
+	}
+	if e.schema.types[condition] == nil {
+		e.fail(nil, "unknown type %q", condition)
+	} else {
+		e.fail(nil, "fragment on %q cannot be spread within %q", condition, t.Name)
+	}
+	return nil
+}
+
+func (e *executor) validateDirectives(ds []*directive, defined map[string]bool) {
+	for _, d := range ds {
+		if d.name != "skip" && d.name != "include" {
+			e.fail(nil, "unknown directive \"@%s\"", d.name)
+			continue
+		}
+		if len(d.args) != 1 || d.args[0].name != "if" {
+			e.fail(nil, "directive \"@%s\" takes one argument, if", d.name)
+			continue
+		}
+		e.validateValue(nil, d.args[0].val, defined)
+	}
+}
+
+// validateValue checks that the variables v refers to are defined
+func (e *executor) validateValue(sel *fieldSelection, v value, defined map[string]bool) {
+	switch v := v.(type) {
+	case variable:
+		if !defined[string(v)] {
+			e.fail(sel, "variable \"$%s\" is not defined", v)
+		}
+	case []value:
+		for _, item := range v {
+			e.validateValue(sel, item, defined)
+		}
+	case objectValue:
+		for _, a := range v {
+			e.validateValue(sel, a.val, defined)
+		}
+	}
+}
+
+// coerceVariables fills e.vars from the request's variables and the
+// defaults, requiring those of non-null type
+func (e *executor) coerceVariables(op *operation, given map[string]any) {
+	e.vars = make(map[string]any, len(op.variables))
+	for _, v := range op.variables {
+		val, ok := given[v.name]
+		if !ok && v.defaultVal != nil {
+			val, ok = e.value(v.defaultVal), true
+		}
+		if v.typ.Kind == kindNonNull && val == nil {
+			e.fail(nil, "variable \"$%s\" of required type %q was not provided", v.name, v.typ.String())
+			continue
+		}
+		if ok {
+			e.vars[v.name] = val
+		}
+	}
+}
+
+// value converts a literal to its JSON value, substituting variables
+func (e *executor) value(v value) any {
+	switch v := v.(type) {
+	case variable:
+		return e.vars[string(v)]
+	case enumValue:
+		return string(v)
+	case []value:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = e.value(item)
+		}
+		return list
+	case objectValue:
+		obj := make(map[string]any, len(v))
+		for _, a := range v {
+			obj[a.name] = e.value(a.val)
+		}
+		return obj
+	}
+	return v
+}
+
+// included evaluates @skip and @include
+func (e *executor) included(ds []*directive) bool {
+	for _, d := range ds {
+		on, _ := e.value(d.args[0].val).(bool)
+		if (d.name == "skip" && on) || (d.name == "include" && !on) {
+			return false
+		}
+	}
+	return true
+}
+
+// collectFields groups the fields selected on t by response key, expanding
+// fragments and dropping skipped fields
+func (e *executor) collectFields(t *Type, set []selection, keys *[]string, groups map[string][]*fieldSelection) {
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *fieldSelection:
+			if !e.included(sel.directives) {
+				continue
+			}
+			key := sel.responseKey()
+			if _, ok := groups[key]; !ok {
+				*keys = append(*keys, key)
+			}
+			groups[key] = append(groups[key], sel)
+		case *fragmentSpread:
+			if f := e.doc.fragments[sel.name]; e.included(sel.directives) && e.included(f.directives) {
+				e.collectFields(t, f.selections, keys, groups)
+			}
+		case *inlineFragment:
+			if e.included(sel.directives) {
+				e.collectFields(t, sel.selections, keys, groups)
+			}
+		}
+	}
+}
+
+// selectObject resolves the selections on a value of object type t: the
+// root operation type at the empty path, else a map keyed by field name. It returns false
+// when a non-null field is null, making the object itself null.
+func (e *executor) selectObject(ctx context.Context, t *Type, value map[string]any, set []selection, path []any) (object, bool) {
+	var keys []string
+	groups := make(map[string][]*fieldSelection)
+	e.collectFields(t, set, &keys, groups)
+
+	result := make(object, 0, len(keys))
+	for _, key := range keys {
+		sels := groups[key]
+		sel := sels[0]
+		fieldPath := append(append([]any(nil), path...), key)
+		if sel.name == "__typename" {
+			result = append(result, objectField{key, t.Name})
+			continue
+		}
+		f := e.field(t, sel.name)
+
+		var v any
+		switch {
+		case f == schemaField:
+			v = e.intro.schemaValue()
+		case f == typeField:
+			name, _ := e.value(argValue(sel, "name")).(string)
+			v = e.intro.typeValue(name)
+		case len(path) == 0:
+			args := make(map[string]any, len(sel.args))
+			for _, a := range sel.args {
+				if av := e.value(a.val); av != nil {
+					args[a.name] = av
+				}
+			}
+			var err error
+			if v, err = e.resolve(ctx, f, args); err != nil {
+				e.errors = append(e.errors, fieldError(err, sel, fieldPath))
+				result = append(result, objectField{key, nil})
+				continue
+			}
+		default:
+			v = value[f.Name]
+		}
+
+		var subselections []selection
+		for _, s := range sels {
+			subselections = append(subselections, s.selections...)
+		}
+		completed, ok := e.complete(ctx, f.Type, v, subselections, sel, fieldPath)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, objectField{key, completed})
+	}
+	return result, true
+}
+
+// complete shapes v as type t. It returns false when a non-null value is
+// null, which nulls the nearest nullable parent.
+func (e *executor) complete(ctx context.Context, t *TypeRef, v any, set []selection, sel *fieldSelection, path []any) (any, bool) {
+	if t.Kind == kindNonNull {
+		completed, ok := e.complete(ctx, t.OfType, v, set, sel, path)
+		if ok && completed == nil {
+			e.errors = append(e.errors, &Error{
+				Message:   fmt.Sprintf("cannot return null for non-nullable field %q", sel.name),
+				Locations: []Location{{Line: sel.line, Column: sel.col}},
+				Path:      path,
+			})
+			return nil, false
+		}
+		return completed, ok
+	}
+	if v == nil {
+		return nil, true
+	}
+	if t.Kind == kindList {
+		items, _ := v.([]any)
+		list := make([]any, len(items))
+		for i, item := range items {
+			completed, ok := e.complete(ctx, t.OfType, item, set, sel, append(append([]any(nil), path...), i))
+			if !ok {
+				return nil, true
+			}
+			list[i] = completed
+		}
+		return list, true
+	}
+	nt := e.schema.types[t.Name]
+	if nt.Kind != kindObject {
+		return v, true
+	}
+	m, _ := v.(map[string]any)
+	obj, ok := e.selectObject(ctx, nt, m, set, path)
+	if !ok {
+		return nil, true
+	}
+	return obj, true
+}
+
+func argValue(sel *fieldSelection, name string) value {
+	for _, a := range sel.args {
+		if a.name == name {
+			return a.val
+		}
+	}
+	return nil
+}
+
+// fail records a validation error
+func (e *executor) fail(sel *fieldSelection, format string, args ...any) {
+	err := &Error{Message: fmt.Sprintf(format, args...)}
+	if sel != nil {
+		err.Locations = []Location{{Line: sel.line, Column: sel.col}}
+	}
+	e.errors = append(e.errors, err)
+}
+
+// codedError is a resolver error with a code for the error's extensions
+type codedError struct {
+	code string
+	msg  string
+}
+
+func (e *codedError) Error() string { return e.msg }
+
+func fieldError(err error, sel *fieldSelection, path []any) *Error {
+	e := &Error{
+		Message:   err.Error(),
+		Locations: []Location{{Line: sel.line, Column: sel.col}},
+		Path:      path,
+	}
+	if ce, ok := err.(*codedError); ok {
+		e.Extensions = map[string]any{"code": ce.code}
+	}
+	return e
+}
+
+// shape converts a value of the API's JSON, keyed by proto field names,
+// into a value of type t keyed by GraphQL field names. Like protojson,
+// the API leaves out fields with default values; they are filled in, so
+// non-null fields are never missing.
+func (s *Schema) shape(v *structpb.Value, t *TypeRef) any {
+	if t.Kind == kindNonNull {
+		if shaped := s.shape(v, t.OfType); shaped != nil {
+			return shaped
+		}
+		return s.zero(t.OfType)
+	}
+	if v == nil {
+		return nil
+	}
+	if _, ok := v.GetKind().(*structpb.Value_NullValue); ok {
+		return nil
+	}
+	if t.Kind == kindList {
+		values := v.GetListValue().GetValues()
+		list := make([]any, len(values))
+		for i, item := range values {
+			list[i] = s.shape(item, t.OfType)
+		}
+		return list
+	}
+
+	nt := s.types[t.Name]
+	switch {
+	case nt.Kind == kindObject:
+		fields := v.GetStructValue().GetFields()
+		m := make(map[string]any, len(nt.Fields))
+		for _, f := range nt.Fields {
+			m[f.Name] = s.shape(fields[f.protoName], f.Type)
+		}
+		return m
+	case nt.Name == "Int":
+		if n, ok := v.GetKind().(*structpb.Value_NumberValue); ok && n.NumberValue == math.Trunc(n.NumberValue) {
+			return int64(n.NumberValue)
+		}
+	}
+	return v.AsInterface()
+}
+
+// zero is the default value of a non-null type, as proto3 defines it
+func (s *Schema) zero(t *TypeRef) any {
+	if t.Kind == kindList {
+		return []any{}
+	}
+	nt := s.types[t.Name]
+	switch {
+	case nt.Kind == kindEnum:
+		return nt.EnumValues[0]
+	case nt.Name == "Int":
+		return int64(0)
+	case nt.Name == "Float":
+		return float64(0)
+	case nt.Name == "Boolean":
+		return false
+	case nt.Kind == kindScalar && nt.Name != "JSON":
+		return ""
+	}
+	return nil
+}
+
+// screamingSnake converts a gRPC code name such as ResourceExhausted to
+// RESOURCE_EXHAUSTED
+func screamingSnake(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
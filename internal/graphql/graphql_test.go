@@ -0,0 +1,229 @@
+package graphql_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/graphql"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+)
+
+type gqlResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Path       []any          `json:"path"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newEndpoint(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := testutil.NewServer(t)
+	h, err := graphql.NewHandler(srv.Conn, apiv1.File_api_proto_v1_user_proto.Services().ByName("UserService"))
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func post(t *testing.T, ts *httptest.Server, query string, variables map[string]any) (int, gqlResponse) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	resp, err := http.Post(ts.URL+"/graphql", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("POST /graphql: %v", err)
+	}
+	defer resp.Body.Close()
+	var out gqlResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp.StatusCode, out
+}
+
+func TestQueriesAndMutations(t *testing.T) {
+	ts := newEndpoint(t)
+
+	code, out := post(t, ts, `
+		mutation Create($user: UserInput) {
+			createUser(user: $user) { name email displayName isActive }
+		}`, map[string]any{"user": map[string]any{"email": "ada@example.com", "displayName": "Ada"}})
+	if code != http.StatusOK || len(out.Errors) > 0 {
+		t.Fatalf("createUser = %d %+v", code, out.Errors)
+	}
+	created := out.Data["createUser"].(map[string]any)
+	name, _ := created["name"].(string)
+	if name == "" || created["email"] != "ada@example.com" || created["displayName"] != "Ada" {
+		t.Fatalf("createUser = %v", created)
+	}
+	if _, ok := created["isActive"].(bool); !ok {
+		t.Errorf("createUser isActive = %v, want a boolean even when false", created["isActive"])
+	}
+
+	code, out = post(t, ts, `
+		query Read($name: String, $skip: Boolean!) {
+			first: getUser(name: $name) { ...names }
+			listUsers(pageSize: 10) {
+				users { ... on User { email } phoneNumber @skip(if: $skip) }
+				totalSize
+				__typename
+			}
+		}
+		fragment names on User { name displayName }`, map[string]any{"name": name, "skip": true})
+	if code != http.StatusOK || len(out.Errors) > 0 {
+		t.Fatalf("query = %d %+v", code, out.Errors)
+	}
+	if got := out.Data["first"].(map[string]any); got["name"] != name || got["displayName"] != "Ada" {
+		t.Errorf("first = %v", got)
+	}
+	list := out.Data["listUsers"].(map[string]any)
+	if list["totalSize"] != float64(1) || list["__typename"] != "ListUsersResponse" {
+		t.Errorf("listUsers = %v", list)
+	}
+	users := list["users"].([]any)
+	if len(users) != 1 {
+		t.Fatalf("listUsers users = %v, want 1", users)
+	}
+	if u := users[0].(map[string]any); u["email"] != "ada@example.com" || u["phoneNumber"] != nil {
+		t.Errorf("listUsers users[0] = %v, want email and no skipped phoneNumber", u)
+	}
+
+	code, out = post(t, ts, `mutation { deleteUser(name: "`+name+`") }`, nil)
+	if code != http.StatusOK || out.Data["deleteUser"] != true {
+		t.Errorf("deleteUser = %d %v %+v", code, out.Data, out.Errors)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ts := newEndpoint(t)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantData bool
+		wantExt  string
+		wantMsg  string
+	}{
+		{
+			name:     "not found",
+			query:    `{ getUser(name: "users/missing") { name } }`,
+			wantCode: http.StatusOK,
+			wantData: true,
+			wantExt:  "NOT_FOUND",
+		},
+		{
+			name:     "unknown field",
+			query:    `{ getUser(name: "users/1") { nickname } }`,
+			wantCode: http.StatusBadRequest,
+			wantMsg:  `cannot query field "nickname" on type "User"`,
+		},
+		{
+			name:     "syntax error",
+			query:    `{ getUser(name: "users/1") { name }`,
+			wantCode: http.StatusBadRequest,
+			wantMsg:  "syntax error at 1:36",
+		},
+		{
+			name:     "missing selection",
+			query:    `{ getUser(name: "users/1") }`,
+			wantCode: http.StatusBadRequest,
+			wantMsg:  "must have a selection",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, out := post(t, ts, tt.query, nil)
+			if code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+			if len(out.Errors) != 1 {
+				t.Fatalf("errors = %+v, want one", out.Errors)
+			}
+			if (out.Data != nil) != tt.wantData {
+				t.Errorf("data = %v, want data %v", out.Data, tt.wantData)
+			}
+			if tt.wantExt != "" && out.Errors[0].Extensions["code"] != tt.wantExt {
+				t.Errorf("extensions = %v, want code %s", out.Errors[0].Extensions, tt.wantExt)
+			}
+			if !strings.Contains(out.Errors[0].Message, tt.wantMsg) {
+				t.Errorf("message = %q, want it to contain %q", out.Errors[0].Message, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestIntrospectionAndSchema(t *testing.T) {
+	ts := newEndpoint(t)
+
+	_, out := post(t, ts, `{
+		__schema { queryType { name } mutationType { name } }
+		__type(name: "User") { kind fields { name type { kind ofType { name } } } }
+	}`, nil)
+	if len(out.Errors) > 0 {
+		t.Fatalf("introspection errors = %+v", out.Errors)
+	}
+	schema := out.Data["__schema"].(map[string]any)
+	if schema["queryType"].(map[string]any)["name"] != "Query" || schema["mutationType"].(map[string]any)["name"] != "Mutation" {
+		t.Errorf("__schema = %v", schema)
+	}
+	user := out.Data["__type"].(map[string]any)
+	if user["kind"] != "OBJECT" {
+		t.Errorf("__type(User) kind = %v", user["kind"])
+	}
+	email := user["fields"].([]any)[1].(map[string]any)
+	if email["name"] != "email" || email["type"].(map[string]any)["kind"] != "NON_NULL" {
+		t.Errorf("User.email = %v, want a non-null String", email)
+	}
+
+	resp, err := http.Get(ts.URL + "/graphql/schema.graphql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	sdl, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		"getUser(name: String): User",
+		"createUser(user: UserInput, requestId: String): User",
+		"deleteUser(name: String, force: Boolean): Boolean",
+		"undeleteUser(name: String): User",
+		"input UserInput {",
+		"scalar Timestamp",
+	} {
+		if !strings.Contains(string(sdl), want) {
+			t.Errorf("schema.graphql is missing %q:\n%s", want, sdl)
+		}
+	}
+	if strings.Contains(string(sdl), "streamUsers") {
+		t.Error("schema.graphql exposes the streaming StreamUsers method")
+	}
+}
+
+func TestGetRunsQueriesOnly(t *testing.T) {
+	ts := newEndpoint(t)
+
+	get := func(query string) *http.Response {
+		resp, err := http.Get(ts.URL + "/graphql?query=" + url.QueryEscape(query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := get(`{ listUsers { totalSize } }`); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET query = %d, want 200", resp.StatusCode)
+	}
+	resp := get(`mutation { deleteUser(name: "users/1") }`)
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodPost {
+		t.Errorf("GET mutation = %d Allow %q, want 405 Allow POST", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
@@ -0,0 +1,174 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// maxBodySize bounds request bodies
+const maxBodySize = 1 << 20
+
+// forwardedHeaders are passed on to the gRPC server as metadata, like the
+// REST gateway does
+var forwardedHeaders = []string{"Authorization", "X-Freeze-Override", "X-Tenant-Id", "X-Forwarded-Host", "Accept-Language"}
+
+// codeNames name the API's response codes in error extensions, like the
+// gRPC codes of rejected calls
+var codeNames = map[int32]string{
+	response.CodeInvalidArgument:   "INVALID_ARGUMENT",
+	response.CodeNotFound:          "NOT_FOUND",
+	response.CodeInternalError:     "INTERNAL",
+	response.CodeAlreadyExists:     "ALREADY_EXISTS",
+	response.CodePermissionDenied:  "PERMISSION_DENIED",
+	response.CodeUnauthenticated:   "UNAUTHENTICATED",
+	response.CodeResourceExhausted: "RESOURCE_EXHAUSTED",
+	response.CodeUnimplemented:     "UNIMPLEMENTED",
+}
+
+// Handler serves GraphQL requests by calling the gRPC API over conn. POST
+// takes a JSON request; GET takes the query in the URL and runs queries
+// only. The schema is served as SDL under schema.graphql.
+type Handler struct {
+	conn   grpc.ClientConnInterface
+	schema *Schema
+	intro  *introspection
+}
+
+// NewHandler creates a Handler for services, called over conn
+func NewHandler(conn grpc.ClientConnInterface, services ...protoreflect.ServiceDescriptor) (*Handler, error) {
+	s, err := NewSchema(services...)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{conn: conn, schema: s, intro: newIntrospection(s)}, nil
+}
+
+// Schema returns the generated schema
+func (h *Handler) Schema() *Schema {
+	return h.schema
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/schema.graphql") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, h.schema.SDL())
+		return
+	}
+
+	var req Request
+	switch r.Method {
+	case http.MethodPost:
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/json" {
+			http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				http.Error(w, "invalid variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		// GET must not change anything; mutations are only run over POST
+		if doc, err := parse(req.Query); err == nil {
+			if op, err := selectOperation(doc, req.OperationName); err == nil && op.kind == "mutation" {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "mutations must be sent with POST", http.StatusMethodNotAllowed)
+				return
+			}
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return
+	}
+
+	resp := execute(outgoingContext(r), h.schema, h.intro, h.call, req)
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Data == nil {
+		// The request never ran
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	w.Write(body)
+}
+
+// outgoingContext carries the request's credentials and client address to
+// the gRPC server, as the REST gateway forwards them
+func outgoingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for _, name := range forwardedHeaders {
+		if v := r.Header.Get(name); v != "" {
+			md.Set(name, v)
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		fwd := host
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			fwd = prior + ", " + host
+		}
+		md.Set("x-forwarded-for", fwd)
+	}
+	return metadata.NewOutgoingContext(r.Context(), md)
+}
+
+// call invokes the method behind a root field. The arguments are the
+// request message's fields in JSON, so protojson builds the request.
+func (h *Handler) call(ctx context.Context, f *Field, args map[string]any) (any, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	req := dynamicpb.NewMessage(f.method.Input())
+	if err := protojson.Unmarshal(data, req); err != nil {
+		return nil, &codedError{code: "INVALID_ARGUMENT", msg: fmt.Sprintf("invalid arguments: %v", err)}
+	}
+
+	resp := &apiv1.CommonResponse{}
+	method := fmt.Sprintf("/%s/%s", f.method.Parent().FullName(), f.method.Name())
+	if err := h.conn.Invoke(ctx, method, req, resp); err != nil {
+		st := status.Convert(err)
+		return nil, &codedError{code: screamingSnake(st.Code().String()), msg: st.Message()}
+	}
+	if resp.GetErrorCode() != response.CodeSuccess {
+		code, ok := codeNames[resp.GetErrorCode()]
+		if !ok {
+			code = fmt.Sprint(resp.GetErrorCode())
+		}
+		return nil, &codedError{code: code, msg: resp.GetErrorMsg()}
+	}
+
+	if f.Type.unwrap().Name == "Boolean" && strings.HasPrefix(string(f.method.Name()), "Delete") {
+		return true, nil
+	}
+	return h.schema.shape(resp.GetData().GetFields()["result"], f.Type), nil
+}
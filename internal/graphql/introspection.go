@@ -0,0 +1,223 @@
+package graphql
+
+import "sort"
+
+// introspectionTypes are the types introspection queries select from
+func introspectionTypes() []*Type {
+	str, boolean := named("String"), named("Boolean")
+	field := func(name string, t *TypeRef, args ...*InputValue) *Field {
+		return &Field{Name: name, Type: t, Args: args, protoName: name}
+	}
+	includeDeprecated := &InputValue{Name: "includeDeprecated", Type: boolean}
+	typeList := nonNull(listOf(nonNull(named("__Type"))))
+
+	return []*Type{
+		{Kind: kindObject, Name: "__Schema", Fields: []*Field{
+			field("description", str),
+			field("types", typeList),
+			field("queryType", nonNull(named("__Type"))),
+			field("mutationType", named("__Type")),
+			field("subscriptionType", named("__Type")),
+			field("directives", nonNull(listOf(nonNull(named("__Directive"))))),
+		}},
+		{Kind: kindObject, Name: "__Type", Fields: []*Field{
+			field("kind", nonNull(named("__TypeKind"))),
+			field("name", str),
+			field("description", str),
+			field("specifiedByURL", str),
+			field("fields", listOf(nonNull(named("__Field"))), includeDeprecated),
+			field("interfaces", listOf(nonNull(named("__Type")))),
+			field("possibleTypes", listOf(nonNull(named("__Type")))),
+			field("enumValues", listOf(nonNull(named("__EnumValue"))), includeDeprecated),
+			field("inputFields", listOf(nonNull(named("__InputValue"))), includeDeprecated),
+			field("ofType", named("__Type")),
+			field("isOneOf", boolean),
+		}},
+		{Kind: kindObject, Name: "__Field", Fields: []*Field{
+			field("name", nonNull(str)),
+			field("description", str),
+			field("args", nonNull(listOf(nonNull(named("__InputValue")))), includeDeprecated),
+			field("type", nonNull(named("__Type"))),
+			field("isDeprecated", nonNull(boolean)),
+			field("deprecationReason", str),
+		}},
+		{Kind: kindObject, Name: "__InputValue", Fields: []*Field{
+			field("name", nonNull(str)),
+			field("description", str),
+			field("type", nonNull(named("__Type"))),
+			field("defaultValue", str),
+			field("isDeprecated", nonNull(boolean)),
+			field("deprecationReason", str),
+		}},
+		{Kind: kindObject, Name: "__EnumValue", Fields: []*Field{
+			field("name", nonNull(str)),
+			field("description", str),
+			field("isDeprecated", nonNull(boolean)),
+			field("deprecationReason", str),
+		}},
+		{Kind: kindObject, Name: "__Directive", Fields: []*Field{
+			field("name", nonNull(str)),
+			field("description", str),
+			field("locations", nonNull(listOf(nonNull(named("__DirectiveLocation"))))),
+			field("args", nonNull(listOf(nonNull(named("__InputValue")))), includeDeprecated),
+			field("isRepeatable", nonNull(boolean)),
+		}},
+		{Kind: kindEnum, Name: "__TypeKind", EnumValues: []string{
+			kindScalar, kindObject, "INTERFACE", "UNION", kindEnum, kindInputObject, kindList, kindNonNull,
+		}},
+		{Kind: kindEnum, Name: "__DirectiveLocation", EnumValues: []string{
+			"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT", "VARIABLE_DEFINITION",
+			"SCHEMA", "SCALAR", "OBJECT", "FIELD_DEFINITION", "ARGUMENT_DEFINITION", "INTERFACE", "UNION", "ENUM", "ENUM_VALUE",
+			"INPUT_OBJECT", "INPUT_FIELD_DEFINITION",
+		}},
+	}
+}
+
+// introspection builds the values introspection queries select from:
+// every type as a map keyed by its __Type field names. Types refer to each
+// other, so the maps form cycles; selections are finite, so resolving them
+// terminates.
+type introspection struct {
+	schema *Schema
+	types  map[string]map[string]any
+}
+
+func newIntrospection(s *Schema) *introspection {
+	in := &introspection{schema: s, types: make(map[string]map[string]any, len(s.types))}
+	for name, t := range s.types {
+		in.types[name] = map[string]any{
+			"__typename":     "__Type",
+			"kind":           t.Kind,
+			"name":           t.Name,
+			"description":    nullable(t.Description),
+			"specifiedByURL": nil,
+			"fields":         nil,
+			"interfaces":     nil,
+			"possibleTypes":  nil,
+			"enumValues":     nil,
+			"inputFields":    nil,
+			"ofType":         nil,
+			"isOneOf":        nil,
+		}
+	}
+	for name, t := range s.types {
+		m := in.types[name]
+		switch t.Kind {
+		case kindObject:
+			fields := make([]any, len(t.Fields))
+			for i, f := range t.Fields {
+				fields[i] = map[string]any{
+					"__typename":        "__Field",
+					"name":              f.Name,
+					"description":       nullable(f.Description),
+					"args":              in.inputValues(f.Args),
+					"type":              in.typeRef(f.Type),
+					"isDeprecated":      false,
+					"deprecationReason": nil,
+				}
+			}
+			m["fields"] = fields
+			m["interfaces"] = []any{}
+		case kindInputObject:
+			m["inputFields"] = in.inputValues(t.InputFields)
+		case kindEnum:
+			values := make([]any, len(t.EnumValues))
+			for i, v := range t.EnumValues {
+				values[i] = map[string]any{
+					"__typename":        "__EnumValue",
+					"name":              v,
+					"description":       nil,
+					"isDeprecated":      false,
+					"deprecationReason": nil,
+				}
+			}
+			m["enumValues"] = values
+		}
+	}
+	return in
+}
+
+// schemaValue is the value of the __schema field
+func (in *introspection) schemaValue() map[string]any {
+	names := make([]string, 0, len(in.types))
+	for name := range in.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	types := make([]any, len(names))
+	for i, name := range names {
+		types[i] = in.types[name]
+	}
+
+	var mutation any
+	if in.schema.Mutation != nil {
+		mutation = in.types[in.schema.Mutation.Name]
+	}
+	location := []any{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"}
+	ifArg := in.inputValues([]*InputValue{{Name: "if", Type: nonNull(named("Boolean"))}})
+	return map[string]any{
+		"__typename":       "__Schema",
+		"description":      nil,
+		"types":            types,
+		"queryType":        in.types[in.schema.Query.Name],
+		"mutationType":     mutation,
+		"subscriptionType": nil,
+		"directives": []any{
+			map[string]any{"__typename": "__Directive", "name": "include", "description": "Includes the field only when if is true.", "locations": location, "args": ifArg, "isRepeatable": false},
+			map[string]any{"__typename": "__Directive", "name": "skip", "description": "Skips the field when if is true.", "locations": location, "args": ifArg, "isRepeatable": false},
+		},
+	}
+}
+
+// typeValue is the value of the __type field, nil for an unknown name
+func (in *introspection) typeValue(name string) any {
+	if t, ok := in.types[name]; ok {
+		return t
+	}
+	return nil
+}
+
+func (in *introspection) inputValues(values []*InputValue) []any {
+	out := make([]any, len(values))
+	for i, v := range values {
+		out[i] = map[string]any{
+			"__typename":        "__InputValue",
+			"name":              v.Name,
+			"description":       nullable(v.Description),
+			"type":              in.typeRef(v.Type),
+			"defaultValue":      nil,
+			"isDeprecated":      false,
+			"deprecationReason": nil,
+		}
+	}
+	return out
+}
+
+// typeRef resolves named types to their full value and describes lists
+// and non-null wrappers
+func (in *introspection) typeRef(t *TypeRef) map[string]any {
+	if t.isNamed() {
+		return in.types[t.Name]
+	}
+	return map[string]any{
+		"__typename":     "__Type",
+		"kind":           t.Kind,
+		"name":           nil,
+		"description":    nil,
+		"specifiedByURL": nil,
+		"fields":         nil,
+		"interfaces":     nil,
+		"possibleTypes":  nil,
+		"enumValues":     nil,
+		"inputFields":    nil,
+		"ofType":         in.typeRef(t.OfType),
+		"isOneOf":        nil,
+	}
+}
+
+func nullable(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
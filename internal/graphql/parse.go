@@ -0,0 +1,574 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// document is a parsed request document
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	// kind is "query", "mutation" or "subscription"
+	kind       string
+	name       string
+	variables  []*variableDefinition
+	selections []selection
+}
+
+type variableDefinition struct {
+	name       string
+	typ        *TypeRef
+	defaultVal value
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+}
+
+// selection is a *fieldSelection, *fragmentSpread or *inlineFragment
+type selection interface{}
+
+type fieldSelection struct {
+	alias      string
+	name       string
+	args       []*argument
+	directives []*directive
+	selections []selection
+	line, col  int
+}
+
+// responseKey is the key of the field in the result
+func (f *fieldSelection) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+}
+
+type inlineFragment struct {
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+}
+
+type argument struct {
+	name string
+	val  value
+}
+
+type directive struct {
+	name string
+	args []*argument
+}
+
+// value is a literal: nil for null, bool, string, int64, float64, enumValue,
+// variable, []value or objectValue
+type value interface{}
+
+type enumValue string
+
+type variable string
+
+type objectValue []*argument
+
+// parseError is a syntax error at a position in the document
+type parseError struct {
+	msg       string
+	line, col int
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("syntax error at %d:%d: %s", e.line, e.col, e.msg)
+}
+
+// byteOrderMark is ignored like whitespace
+const byteOrderMark = "\uFEFF"
+
+// Token kinds
+const (
+	tokEOF = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind      int
+	text      string
+	line, col int
+}
+
+type parser struct {
+	src       string
+	pos       int
+	line, col int
+	tok       token
+}
+
+// parse parses an executable document
+func parse(src string) (doc *document, err error) {
+	p := &parser{src: src, line: 1, col: 1}
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(*parseError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, pe
+		}
+	}()
+
+	p.next()
+	doc = &document{fragments: make(map[string]*fragment)}
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.peek("{"):
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: p.selectionSet()})
+		case p.peekName("query"), p.peekName("mutation"), p.peekName("subscription"):
+			doc.operations = append(doc.operations, p.operation())
+		case p.peekName("fragment"):
+			f := p.fragmentDefinition()
+			if _, ok := doc.fragments[f.name]; ok {
+				p.fail("fragment %q is defined twice", f.name)
+			}
+			doc.fragments[f.name] = f
+		default:
+			p.fail("unexpected %q", p.tok.text)
+		}
+	}
+	if len(doc.operations) == 0 {
+		p.fail("document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) operation() *operation {
+	op := &operation{kind: p.name()}
+	if p.tok.kind == tokName {
+		op.name = p.name()
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			p.expect("$")
+			v := &variableDefinition{name: p.name()}
+			p.expect(":")
+			v.typ = p.typeRef()
+			if p.skip("=") {
+				v.defaultVal = p.value(true)
+			}
+			p.directives()
+			op.variables = append(op.variables, v)
+		}
+	}
+	p.directives()
+	op.selections = p.selectionSet()
+	return op
+}
+
+func (p *parser) fragmentDefinition() *fragment {
+	p.name()
+	f := &fragment{name: p.name()}
+	if f.name == "on" {
+		p.fail("fragment cannot be named \"on\"")
+	}
+	if !p.peekName("on") {
+		p.fail("expected \"on\"")
+	}
+	p.name()
+	f.typeCondition = p.name()
+	f.directives = p.directives()
+	f.selections = p.selectionSet()
+	return f
+}
+
+func (p *parser) typeRef() *TypeRef {
+	var t *TypeRef
+	if p.skip("[") {
+		t = listOf(p.typeRef())
+		p.expect("]")
+	} else {
+		t = named(p.name())
+	}
+	if p.skip("!") {
+		t = nonNull(t)
+	}
+	return t
+}
+
+func (p *parser) selectionSet() []selection {
+	p.expect("{")
+	var set []selection
+	for !p.skip("}") {
+		if p.skip("...") {
+			switch {
+			case p.peekName("on"):
+				p.name()
+				set = append(set, &inlineFragment{typeCondition: p.name(), directives: p.directives(), selections: p.selectionSet()})
+			case p.tok.kind == tokName:
+				set = append(set, &fragmentSpread{name: p.name(), directives: p.directives()})
+			default:
+				set = append(set, &inlineFragment{directives: p.directives(), selections: p.selectionSet()})
+			}
+			continue
+		}
+		f := &fieldSelection{line: p.tok.line, col: p.tok.col}
+		f.name = p.name()
+		if p.skip(":") {
+			f.alias, f.name = f.name, p.name()
+		}
+		f.args = p.arguments(false)
+		f.directives = p.directives()
+		if p.peek("{") {
+			f.selections = p.selectionSet()
+		}
+		set = append(set, f)
+	}
+	if len(set) == 0 {
+		p.fail("empty selection set")
+	}
+	return set
+}
+
+func (p *parser) arguments(constant bool) []*argument {
+	var args []*argument
+	if !p.skip("(") {
+		return nil
+	}
+	for !p.skip(")") {
+		a := &argument{name: p.name()}
+		p.expect(":")
+		a.val = p.value(constant)
+		args = append(args, a)
+	}
+	return args
+}
+
+func (p *parser) directives() []*directive {
+	var ds []*directive
+	for p.skip("@") {
+		ds = append(ds, &directive{name: p.name(), args: p.arguments(false)})
+	}
+	return ds
+}
+
+// value parses a literal. Constant values, such as variable defaults, may
+// not refer to variables.
+func (p *parser) value(constant bool) value {
+	t := p.tok
+	switch t.kind {
+	case tokPunct:
+		switch t.text {
+		case "$":
+			if constant {
+				p.fail("variable not allowed here")
+			}
+			p.next()
+			return variable(p.name())
+		case "[":
+			p.next()
+			list := []value{}
+			for !p.skip("]") {
+				list = append(list, p.value(constant))
+			}
+			return list
+		case "{":
+			p.next()
+			obj := objectValue{}
+			for !p.skip("}") {
+				a := &argument{name: p.name()}
+				p.expect(":")
+				a.val = p.value(constant)
+				obj = append(obj, a)
+			}
+			return obj
+		}
+	case tokInt:
+		p.next()
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			p.failAt(t, "invalid integer %s", t.text)
+		}
+		return n
+	case tokFloat:
+		p.next()
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.failAt(t, "invalid number %s", t.text)
+		}
+		return f
+	case tokString:
+		p.next()
+		return t.text
+	case tokName:
+		p.next()
+		switch t.text {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return enumValue(t.text)
+	}
+	p.fail("unexpected %q", t.text)
+	return nil
+}
+
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == punct
+}
+
+func (p *parser) peekName(name string) bool {
+	return p.tok.kind == tokName && p.tok.text == name
+}
+
+func (p *parser) skip(punct string) bool {
+	if p.peek(punct) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) {
+	if !p.skip(punct) {
+		p.fail("expected %q, found %q", punct, p.tok.text)
+	}
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokName {
+		p.fail("expected a name, found %q", p.tok.text)
+	}
+	name := p.tok.text
+	p.next()
+	return name
+}
+
+func (p *parser) fail(format string, args ...any) {
+	p.failAt(p.tok, format, args...)
+}
+
+func (p *parser) failAt(t token, format string, args ...any) {
+	panic(&parseError{msg: fmt.Sprintf(format, args...), line: t.line, col: t.col})
+}
+
+// next reads the next token, skipping whitespace, commas and comments
+func (p *parser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.advance(1)
+			}
+			continue
+		}
+		if strings.HasPrefix(p.src[p.pos:], byteOrderMark) {
+			p.advance(len(byteOrderMark))
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.advance(1)
+	}
+	p.tok = token{line: p.line, col: p.col}
+	if p.pos >= len(p.src) {
+		p.tok.kind = tokEOF
+		p.tok.text = "<EOF>"
+		return
+	}
+
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.advance(3)
+		p.tok.kind, p.tok.text = tokPunct, "..."
+	case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+		p.advance(1)
+		p.tok.kind, p.tok.text = tokPunct, string(c)
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.advance(1)
+		}
+		p.tok.kind, p.tok.text = tokName, p.src[start:p.pos]
+	case c == '-' || isDigit(c):
+		p.number()
+	case c == '"':
+		p.tok.kind = tokString
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			p.tok.text = p.blockString()
+		} else {
+			p.tok.text = p.string()
+		}
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.fail("unexpected character %q", r)
+	}
+}
+
+func (p *parser) number() {
+	start := p.pos
+	p.tok.kind = tokInt
+	if p.src[p.pos] == '-' {
+		p.advance(1)
+	}
+	digits := func() {
+		n := 0
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.advance(1)
+			n++
+		}
+		if n == 0 {
+			p.fail("invalid number %q", p.src[start:p.pos])
+		}
+	}
+	digits()
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.tok.kind = tokFloat
+		p.advance(1)
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.tok.kind = tokFloat
+		p.advance(1)
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.advance(1)
+		}
+		digits()
+	}
+	p.tok.text = p.src[start:p.pos]
+}
+
+func (p *parser) string() string {
+	p.advance(1)
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			p.fail("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.advance(1)
+			return b.String()
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				p.fail("unterminated string")
+			}
+			esc := p.src[p.pos+1]
+			p.advance(2)
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					p.fail("invalid unicode escape")
+				}
+				n, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					p.fail("invalid unicode escape")
+				}
+				p.advance(4)
+				b.WriteRune(rune(n))
+			default:
+				p.fail("invalid escape \\%c", esc)
+			}
+		default:
+			_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			b.WriteString(p.src[p.pos : p.pos+size])
+			p.advance(size)
+		}
+	}
+}
+
+// blockString reads a """ string. Common indentation and blank first and
+// last lines are removed, as the spec requires.
+func (p *parser) blockString() string {
+	p.advance(3)
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			p.fail("unterminated block string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			p.advance(3)
+			break
+		}
+		if strings.HasPrefix(p.src[p.pos:], `\"""`) {
+			b.WriteString(`"""`)
+			p.advance(4)
+			continue
+		}
+		b.WriteByte(p.src[p.pos])
+		p.advance(1)
+	}
+
+	lines := strings.Split(strings.ReplaceAll(b.String(), "\r\n", "\n"), "\n")
+	indent := -1
+	for _, l := range lines[1:] {
+		trimmed := strings.TrimLeft(l, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(l) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// advance moves past n bytes, tracking the line and column
+func (p *parser) advance(n int) {
+	for i := 0; i < n && p.pos < len(p.src); i++ {
+		if p.src[p.pos] == '\n' {
+			p.line++
+			p.col = 1
+		} else {
+			p.col++
+		}
+		p.pos++
+	}
+}
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
@@ -0,0 +1,471 @@
+// Package graphql serves a GraphQL endpoint over the gRPC API. The schema is
+// generated from the service descriptors: read methods (Get, List,
+// BatchGet) become query fields and the other unary methods mutations, with
+// the request message's fields as arguments. Calls are made over a gRPC
+// connection, so they pass the same interceptors as gRPC and REST calls.
+//
+// It implements the parts of GraphQL clients rely on: queries and
+// mutations with variables, aliases, fragments, the @skip and @include
+// directives, and introspection. Subscriptions are not supported.
+package graphql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Type kinds, as named by introspection
+const (
+	kindScalar      = "SCALAR"
+	kindObject      = "OBJECT"
+	kindInputObject = "INPUT_OBJECT"
+	kindEnum        = "ENUM"
+	kindList        = "LIST"
+	kindNonNull     = "NON_NULL"
+)
+
+// readPrefixes mark methods exposed as queries rather than mutations
+var readPrefixes = []string{"Get", "List", "BatchGet"}
+
+// Type is a named type of the schema
+type Type struct {
+	Kind        string
+	Name        string
+	Description string
+
+	// Fields of an OBJECT
+	Fields []*Field
+
+	// InputFields of an INPUT_OBJECT
+	InputFields []*InputValue
+
+	// EnumValues of an ENUM
+	EnumValues []string
+}
+
+// field returns the named field of an OBJECT
+func (t *Type) field(name string) *Field {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Field is a field of an OBJECT
+type Field struct {
+	Name        string
+	Description string
+	Args        []*InputValue
+	Type        *TypeRef
+
+	// protoName is the key of the field's value in the API's JSON
+	protoName string
+
+	// method is the gRPC method a root field calls
+	method protoreflect.MethodDescriptor
+}
+
+func (f *Field) arg(name string) *InputValue {
+	for _, a := range f.Args {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// InputValue is an argument or a field of an INPUT_OBJECT
+type InputValue struct {
+	Name        string
+	Description string
+	Type        *TypeRef
+}
+
+// TypeRef refers to a named type, or wraps one as a list or non-null
+type TypeRef struct {
+	Kind   string
+	Name   string
+	OfType *TypeRef
+}
+
+func named(name string) *TypeRef  { return &TypeRef{Name: name} }
+func listOf(t *TypeRef) *TypeRef  { return &TypeRef{Kind: kindList, OfType: t} }
+func nonNull(t *TypeRef) *TypeRef { return &TypeRef{Kind: kindNonNull, OfType: t} }
+func (t *TypeRef) isNamed() bool  { return t.Kind == "" }
+
+func (t *TypeRef) unwrap() *TypeRef {
+	for !t.isNamed() {
+		t = t.OfType
+	}
+	return t
+}
+
+// String formats t as in SDL, e.g. "[User!]!"
+func (t *TypeRef) String() string {
+	switch t.Kind {
+	case kindList:
+		return "[" + t.OfType.String() + "]"
+	case kindNonNull:
+		return t.OfType.String() + "!"
+	}
+	return t.Name
+}
+
+// Schema is the GraphQL schema of one or more gRPC services
+type Schema struct {
+	Query    *Type
+	Mutation *Type
+
+	types map[string]*Type
+}
+
+// builtinScalars are the scalars every schema has, and the custom scalars
+// used for well-known protobuf types
+var builtinScalars = []*Type{
+	{Kind: kindScalar, Name: "String"},
+	{Kind: kindScalar, Name: "Int"},
+	{Kind: kindScalar, Name: "Float"},
+	{Kind: kindScalar, Name: "Boolean"},
+	{Kind: kindScalar, Name: "ID"},
+	{Kind: kindScalar, Name: "Timestamp", Description: "An RFC 3339 timestamp, e.g. \"2025-01-01T00:00:00Z\""},
+	{Kind: kindScalar, Name: "Duration", Description: "A duration in seconds with an \"s\" suffix, e.g. \"1.5s\""},
+	{Kind: kindScalar, Name: "JSON", Description: "Any JSON value"},
+}
+
+// NewSchema generates the schema of services. Streaming methods are left
+// out.
+func NewSchema(services ...protoreflect.ServiceDescriptor) (*Schema, error) {
+	s := &Schema{
+		Query:    &Type{Kind: kindObject, Name: "Query"},
+		Mutation: &Type{Kind: kindObject, Name: "Mutation"},
+		types:    make(map[string]*Type),
+	}
+	for _, t := range builtinScalars {
+		s.types[t.Name] = t
+	}
+	for _, t := range introspectionTypes() {
+		s.types[t.Name] = t
+	}
+
+	for _, svc := range services {
+		methods := svc.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			m := methods.Get(i)
+			if m.IsStreamingClient() || m.IsStreamingServer() {
+				continue
+			}
+			root := s.Mutation
+			if hasAnyPrefix(string(m.Name()), readPrefixes) {
+				root = s.Query
+			}
+			name := lowerFirst(string(m.Name()))
+			if root.field(name) != nil {
+				return nil, fmt.Errorf("graphql: %s is defined by two services", name)
+			}
+			f := &Field{Name: name, Type: s.resultType(m), method: m}
+			fields := m.Input().Fields()
+			for j := 0; j < fields.Len(); j++ {
+				fd := fields.Get(j)
+				f.Args = append(f.Args, &InputValue{Name: fd.JSONName(), Type: s.inputType(fd)})
+			}
+			root.Fields = append(root.Fields, f)
+		}
+	}
+	if len(s.Query.Fields) == 0 {
+		return nil, fmt.Errorf("graphql: no query methods")
+	}
+	s.types[s.Query.Name] = s.Query
+	if len(s.Mutation.Fields) == 0 {
+		s.Mutation = nil
+	} else {
+		s.types[s.Mutation.Name] = s.Mutation
+	}
+	return s, nil
+}
+
+// Type returns the named type
+func (s *Schema) Type(name string) *Type {
+	return s.types[name]
+}
+
+// resultType is the type of what m returns in the response's result: the
+// <Method>Response message when the file defines one, such as
+// ListUsersResponse, else the message the method is named after, such as
+// User for GetUser or UndeleteUser. Deletes return true and anything else
+// JSON.
+func (s *Schema) resultType(m protoreflect.MethodDescriptor) *TypeRef {
+	name := string(m.Name())
+	if strings.HasPrefix(name, "Delete") {
+		return named("Boolean")
+	}
+	messages := m.ParentFile().Messages()
+	if md := messages.ByName(protoreflect.Name(name + "Response")); md != nil {
+		return s.objectType(md)
+	}
+	for _, verb := range []string{"BatchGet", "Get", "Create", "Update", "Undelete"} {
+		if noun, ok := strings.CutPrefix(name, verb); ok {
+			if md := messages.ByName(protoreflect.Name(noun)); md != nil {
+				return s.objectType(md)
+			}
+		}
+	}
+	return named("JSON")
+}
+
+// objectType returns the OBJECT type of md, adding it on first use
+func (s *Schema) objectType(md protoreflect.MessageDescriptor) *TypeRef {
+	name := typeName(md)
+	if _, ok := s.types[name]; ok {
+		return named(name)
+	}
+	t := &Type{Kind: kindObject, Name: name}
+	// Registered before its fields so recursive messages terminate
+	s.types[name] = t
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		t.Fields = append(t.Fields, &Field{Name: fd.JSONName(), Type: s.outputType(fd), protoName: string(fd.Name())})
+	}
+	return named(name)
+}
+
+// outputType maps a field to the type it has in results. Like protojson,
+// proto3 scalars, enums and lists are never null; messages and fields
+// with presence may be.
+func (s *Schema) outputType(fd protoreflect.FieldDescriptor) *TypeRef {
+	if fd.IsMap() {
+		return named("JSON")
+	}
+	var t *TypeRef
+	switch {
+	case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+		if wk, ok := wellKnownType(fd.Message()); ok {
+			t = named(wk)
+		} else {
+			t = s.objectType(fd.Message())
+		}
+		if fd.IsList() {
+			return nonNull(listOf(nonNull(t)))
+		}
+		return t
+	case fd.Kind() == protoreflect.EnumKind:
+		t = s.enumType(fd.Enum())
+	default:
+		t = named(scalarName(fd.Kind()))
+	}
+	if fd.IsList() {
+		return nonNull(listOf(nonNull(t)))
+	}
+	if fd.HasPresence() {
+		return t
+	}
+	return nonNull(t)
+}
+
+// inputType maps a request field to its argument type. Every argument is
+// optional; the service validates what it requires.
+func (s *Schema) inputType(fd protoreflect.FieldDescriptor) *TypeRef {
+	if fd.IsMap() {
+		return named("JSON")
+	}
+	var t *TypeRef
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if wk, ok := wellKnownType(fd.Message()); ok {
+			t = named(wk)
+		} else {
+			t = s.inputObjectType(fd.Message())
+		}
+	case protoreflect.EnumKind:
+		t = s.enumType(fd.Enum())
+	default:
+		t = named(scalarName(fd.Kind()))
+	}
+	if fd.IsList() {
+		return listOf(nonNull(t))
+	}
+	return t
+}
+
+// inputObjectType returns the INPUT_OBJECT type of md, named with an
+// Input suffix, adding it on first use
+func (s *Schema) inputObjectType(md protoreflect.MessageDescriptor) *TypeRef {
+	name := typeName(md) + "Input"
+	if _, ok := s.types[name]; ok {
+		return named(name)
+	}
+	t := &Type{Kind: kindInputObject, Name: name}
+	s.types[name] = t
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		t.InputFields = append(t.InputFields, &InputValue{Name: fd.JSONName(), Type: s.inputType(fd)})
+	}
+	return named(name)
+}
+
+func (s *Schema) enumType(ed protoreflect.EnumDescriptor) *TypeRef {
+	name := string(ed.Name())
+	if _, ok := s.types[name]; ok {
+		return named(name)
+	}
+	t := &Type{Kind: kindEnum, Name: name}
+	values := ed.Values()
+	for i := 0; i < values.Len(); i++ {
+		t.EnumValues = append(t.EnumValues, string(values.Get(i).Name()))
+	}
+	s.types[name] = t
+	return named(name)
+}
+
+// typeName names a message's type. Nested messages are prefixed with their
+// parents, e.g. Outer_Inner.
+func typeName(md protoreflect.MessageDescriptor) string {
+	name := string(md.Name())
+	for p := md.Parent(); p != nil; p = p.Parent() {
+		parent, ok := p.(protoreflect.MessageDescriptor)
+		if !ok {
+			break
+		}
+		name = string(parent.Name()) + "_" + name
+	}
+	return name
+}
+
+// wellKnownType maps well-known messages to the scalar matching their JSON
+// form
+func wellKnownType(md protoreflect.MessageDescriptor) (string, bool) {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return "Timestamp", true
+	case "google.protobuf.Duration":
+		return "Duration", true
+	case "google.protobuf.Struct", "google.protobuf.Value", "google.protobuf.ListValue", "google.protobuf.Any", "google.protobuf.Empty":
+		return "JSON", true
+	case "google.protobuf.FieldMask", "google.protobuf.StringValue", "google.protobuf.BytesValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return "String", true
+	case "google.protobuf.BoolValue":
+		return "Boolean", true
+	case "google.protobuf.Int32Value":
+		return "Int", true
+	case "google.protobuf.UInt32Value", "google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return "Float", true
+	}
+	return "", false
+}
+
+// scalarName maps a scalar field kind to the GraphQL scalar matching its
+// JSON form. 64-bit integers are strings in JSON, and unsigned 32-bit ones
+// do not fit GraphQL's signed Int.
+func scalarName(k protoreflect.Kind) string {
+	switch k {
+	case protoreflect.BoolKind:
+		return "Boolean"
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return "Int"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.FloatKind, protoreflect.DoubleKind:
+		return "Float"
+	}
+	return "String"
+}
+
+// SDL returns the schema in the GraphQL schema definition language
+func (s *Schema) SDL() string {
+	var b strings.Builder
+	names := make([]string, 0, len(s.types))
+	for name, t := range s.types {
+		if strings.HasPrefix(name, "__") || (t.Kind == kindScalar && isBuiltinScalar(name)) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// Root types first, then by name
+		ri, rj := rootOrder(names[i]), rootOrder(names[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		t := s.types[name]
+		if t.Description != "" {
+			fmt.Fprintf(&b, "%q\n", t.Description)
+		}
+		switch t.Kind {
+		case kindScalar:
+			fmt.Fprintf(&b, "scalar %s\n", t.Name)
+		case kindEnum:
+			fmt.Fprintf(&b, "enum %s {\n", t.Name)
+			for _, v := range t.EnumValues {
+				fmt.Fprintf(&b, "  %s\n", v)
+			}
+			b.WriteString("}\n")
+		case kindInputObject:
+			fmt.Fprintf(&b, "input %s {\n", t.Name)
+			for _, f := range t.InputFields {
+				fmt.Fprintf(&b, "  %s: %s\n", f.Name, f.Type)
+			}
+			b.WriteString("}\n")
+		case kindObject:
+			fmt.Fprintf(&b, "type %s {\n", t.Name)
+			for _, f := range t.Fields {
+				fmt.Fprintf(&b, "  %s", f.Name)
+				if len(f.Args) > 0 {
+					args := make([]string, len(f.Args))
+					for j, a := range f.Args {
+						args[j] = a.Name + ": " + a.Type.String()
+					}
+					fmt.Fprintf(&b, "(%s)", strings.Join(args, ", "))
+				}
+				fmt.Fprintf(&b, ": %s\n", f.Type)
+			}
+			b.WriteString("}\n")
+		}
+	}
+	return b.String()
+}
+
+func rootOrder(name string) int {
+	switch name {
+	case "Query":
+		return 0
+	case "Mutation":
+		return 1
+	}
+	return 2
+}
+
+func isBuiltinScalar(name string) bool {
+	switch name {
+	case "String", "Int", "Float", "Boolean", "ID":
+		return true
+	}
+	return false
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
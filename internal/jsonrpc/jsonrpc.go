@@ -0,0 +1,304 @@
+// Package jsonrpc serves the gRPC API over JSON-RPC 2.0, for clients that
+// speak neither gRPC nor REST. Methods are named <Service>.<Method>, such as
+// "UserService.GetUser", or by the service's full name where versions share
+// a name, such as "api.v2.UserService.GetUser". They take the request
+// message's fields by name as params and return the response message, the
+// API's envelope for v1, as result, both in the JSON form the REST gateway
+// uses. Calls are made over a gRPC connection, so they pass the same
+// interceptors as gRPC and REST calls.
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Error codes defined by the JSON-RPC 2.0 specification
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	// CodeServerError reports a call the server rejected; the gRPC status
+	// is in the error's data
+	CodeServerError = -32000
+)
+
+const (
+	// maxBodySize bounds request bodies
+	maxBodySize = 1 << 20
+
+	// maxBatchSize bounds the calls in one batch
+	maxBatchSize = 100
+)
+
+// forwardedHeaders are passed on to the gRPC server as metadata, like the
+// REST gateway does
+var forwardedHeaders = []string{"Authorization", "X-Freeze-Override", "X-Tenant-Id", "X-Forwarded-Host", "Accept-Language"}
+
+// Request is a JSON-RPC request. A request without an ID is a notification,
+// which gets no response.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Response is a JSON-RPC response, carrying either Result or Error
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Error is a JSON-RPC error object
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// StatusData is the data of a CodeServerError error: the gRPC status the
+// call failed with
+type StatusData struct {
+	// Status is the gRPC code's name, e.g. "NOT_FOUND"
+	Status string `json:"status"`
+
+	// Details are the status details, in protojson
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+// Handler serves JSON-RPC requests, single or batched, by calling the gRPC
+// API over conn
+type Handler struct {
+	conn    grpc.ClientConnInterface
+	methods map[string]protoreflect.MethodDescriptor
+}
+
+// NewHandler creates a Handler for the unary methods of services, called
+// over conn. Streaming methods are left out. Every method is named by its
+// service's full name, and by its short name unless an earlier service
+// has it, so api.v1.UserService keeps "UserService.GetUser" when
+// api.v2.UserService is served beside it.
+func NewHandler(conn grpc.ClientConnInterface, services ...protoreflect.ServiceDescriptor) *Handler {
+	h := &Handler{conn: conn, methods: make(map[string]protoreflect.MethodDescriptor)}
+	for _, svc := range services {
+		methods := svc.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			md := methods.Get(i)
+			if md.IsStreamingClient() || md.IsStreamingServer() {
+				continue
+			}
+			h.methods[fmt.Sprintf("%s.%s", svc.FullName(), md.Name())] = md
+			if short := fmt.Sprintf("%s.%s", svc.Name(), md.Name()); h.methods[short] == nil {
+				h.methods[short] = md
+			}
+		}
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	var body json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&body); err != nil {
+		writeJSON(w, errorResponse(nil, CodeParseError, "parse error: "+err.Error()))
+		return
+	}
+
+	ctx := outgoingContext(r)
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+		if resp := h.handle(ctx, body); resp != nil {
+			writeJSON(w, resp)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		writeJSON(w, errorResponse(nil, CodeParseError, "parse error: "+err.Error()))
+		return
+	}
+	switch {
+	case len(batch) == 0:
+		writeJSON(w, errorResponse(nil, CodeInvalidRequest, "empty batch"))
+		return
+	case len(batch) > maxBatchSize:
+		writeJSON(w, errorResponse(nil, CodeInvalidRequest, fmt.Sprintf("batch of %d calls exceeds the limit of %d", len(batch), maxBatchSize)))
+		return
+	}
+	var responses []*Response
+	for _, raw := range batch {
+		if resp := h.handle(ctx, raw); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		// A batch of notifications
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, responses)
+}
+
+// handle runs one call, returning nil for a notification
+func (h *Handler) handle(ctx context.Context, raw json.RawMessage) *Response {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return errorResponse(nil, CodeInvalidRequest, "invalid request: "+err.Error())
+	}
+	if !validID(req.ID) {
+		return errorResponse(nil, CodeInvalidRequest, "invalid request: id must be a string, number or null")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, CodeInvalidRequest, `invalid request: jsonrpc must be "2.0" and method set`)
+	}
+
+	result, rpcErr := h.call(ctx, req)
+	if req.ID == nil {
+		return nil
+	}
+	if rpcErr != nil {
+		return &Response{JSONRPC: "2.0", Error: rpcErr, ID: req.ID}
+	}
+	return &Response{JSONRPC: "2.0", Result: result, ID: req.ID}
+}
+
+// call invokes the method req names, with its params as the request
+// message
+func (h *Handler) call(ctx context.Context, req Request) (json.RawMessage, *Error) {
+	md, ok := h.methods[req.Method]
+	if !ok {
+		return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+	}
+
+	in := dynamicpb.NewMessage(md.Input())
+	if params := bytes.TrimSpace(req.Params); len(params) > 0 && !bytes.Equal(params, []byte("null")) {
+		if params[0] != '{' {
+			return nil, &Error{Code: CodeInvalidParams, Message: "params must be an object"}
+		}
+		if err := protojson.Unmarshal(params, in); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+		}
+	}
+
+	out := dynamicpb.NewMessage(md.Output())
+	method := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+	if err := h.conn.Invoke(ctx, method, in, out); err != nil {
+		return nil, statusError(status.Convert(err))
+	}
+	result, err := protojson.Marshal(out)
+	if err != nil {
+		return nil, &Error{Code: CodeInternalError, Message: err.Error()}
+	}
+	return result, nil
+}
+
+// statusError reports a failed call. Invalid arguments are the caller's
+// params; other codes are server errors with the status in data.
+func statusError(st *status.Status) *Error {
+	code := CodeServerError
+	if st.Code() == codes.InvalidArgument {
+		code = CodeInvalidParams
+	}
+	data := StatusData{Status: screamingSnake(st.Code().String())}
+	for _, d := range st.Proto().GetDetails() {
+		if b, err := protojson.Marshal(d); err == nil {
+			data.Details = append(data.Details, b)
+		}
+	}
+	return &Error{Code: code, Message: st.Message(), Data: data}
+}
+
+// validID reports whether id is absent or a string, number or null
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var v any
+	if err := json.Unmarshal(id, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case nil, string, float64:
+		return true
+	}
+	return false
+}
+
+func errorResponse(id json.RawMessage, code int, msg string) *Response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &Response{JSONRPC: "2.0", Error: &Error{Code: code, Message: msg}, ID: id}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// outgoingContext carries the request's credentials and client address to
+// the gRPC server, as the REST gateway forwards them
+func outgoingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for _, name := range forwardedHeaders {
+		if v := r.Header.Get(name); v != "" {
+			md.Set(name, v)
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		fwd := host
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			fwd = prior + ", " + host
+		}
+		md.Set("x-forwarded-for", fwd)
+	}
+	return metadata.NewOutgoingContext(r.Context(), md)
+}
+
+// screamingSnake converts a gRPC code name such as "NotFound" to the
+// canonical "NOT_FOUND"
+func screamingSnake(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
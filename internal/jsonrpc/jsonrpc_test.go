@@ -0,0 +1,194 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/jsonrpc"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newEndpoint(t *testing.T, opts ...testutil.Option) *httptest.Server {
+	t.Helper()
+	srv := testutil.NewServer(t, opts...)
+	ts := httptest.NewServer(jsonrpc.NewHandler(srv.Conn, apiv1.File_api_proto_v1_user_proto.Services().ByName("UserService")))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func post(t *testing.T, ts *httptest.Server, body string) (int, string) {
+	t.Helper()
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func TestCall(t *testing.T) {
+	ts := newEndpoint(t)
+
+	code, body := post(t, ts, `{"jsonrpc":"2.0","method":"UserService.CreateUser","params":{"user":{"email":"ada@example.com","displayName":"Ada"}},"id":1}`)
+	var created struct {
+		Result struct {
+			Data struct {
+				Result struct {
+					Name  string `json:"name"`
+					Email string `json:"email"`
+				} `json:"result"`
+			} `json:"data"`
+		} `json:"result"`
+		ID    int            `json:"id"`
+		Error *jsonrpc.Error `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &created); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	if code != http.StatusOK || created.Error != nil || created.ID != 1 || created.Result.Data.Result.Email != "ada@example.com" {
+		t.Fatalf("CreateUser = %d %s", code, body)
+	}
+
+	_, body = post(t, ts, `{"jsonrpc":"2.0","method":"UserService.GetUser","params":{"name":"`+created.Result.Data.Result.Name+`"},"id":"a"}`)
+	if !strings.Contains(body, `"id":"a"`) || !strings.Contains(body, `"email":"ada@example.com"`) {
+		t.Errorf("GetUser = %s", body)
+	}
+
+	// A notification runs but gets no response
+	if code, body := post(t, ts, `{"jsonrpc":"2.0","method":"UserService.CreateUser","params":{"user":{"email":"bob@example.com"}}}`); code != http.StatusNoContent || body != "" {
+		t.Errorf("notification = %d %q, want 204 and no body", code, body)
+	}
+	_, body = post(t, ts, `{"jsonrpc":"2.0","method":"UserService.ListUsers","id":2}`)
+	if !strings.Contains(body, `"total_size":2`) {
+		t.Errorf("ListUsers after the notification = %s, want 2 users", body)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	ts := newEndpoint(t)
+
+	code, body := post(t, ts, `[
+		{"jsonrpc":"2.0","method":"UserService.ListUsers","params":{"pageSize":10},"id":1},
+		{"jsonrpc":"2.0","method":"UserService.Nope","id":2},
+		{"jsonrpc":"2.0","method":"UserService.ListUsers"},
+		{"jsonrpc":"2.0","method":"UserService.GetUser","params":["users/1"],"id":3},
+		{"jsonrpc":"1.0","method":"UserService.ListUsers","id":4},
+		1
+	]`)
+	if code != http.StatusOK {
+		t.Fatalf("batch = %d %s", code, body)
+	}
+	var responses []jsonrpc.Response
+	if err := json.Unmarshal([]byte(body), &responses); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	want := []struct {
+		id   string
+		code int
+	}{
+		{"1", 0},
+		{"2", jsonrpc.CodeMethodNotFound},
+		{"3", jsonrpc.CodeInvalidParams},
+		{"4", jsonrpc.CodeInvalidRequest},
+		{"null", jsonrpc.CodeInvalidRequest},
+	}
+	if len(responses) != len(want) {
+		t.Fatalf("batch returned %d responses, want %d: %s", len(responses), len(want), body)
+	}
+	for i, w := range want {
+		r := responses[i]
+		var got int
+		if r.Error != nil {
+			got = r.Error.Code
+		}
+		if string(r.ID) != w.id || got != w.code {
+			t.Errorf("response %d = id %s code %d, want id %s code %d", i, r.ID, got, w.id, w.code)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{"empty batch", `[]`, http.StatusOK, `"code":-32600`},
+		{"parse error", `{"jsonrpc":`, http.StatusOK, `"code":-32700`},
+		{"notifications only", `[{"jsonrpc":"2.0","method":"UserService.ListUsers"}]`, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := post(t, ts, tt.body)
+			if code != tt.wantCode || !strings.Contains(body, tt.want) {
+				t.Errorf("POST %s = %d %s, want %d with %s", tt.body, code, body, tt.wantCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	reject := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return nil, status.Error(codes.PermissionDenied, "admins only")
+	}
+	ts := newEndpoint(t, testutil.WithServerOptions(grpc.ChainUnaryInterceptor(reject)))
+
+	_, body := post(t, ts, `{"jsonrpc":"2.0","method":"UserService.ListUsers","id":1}`)
+	var resp struct {
+		Error struct {
+			Code    int                `json:"code"`
+			Message string             `json:"message"`
+			Data    jsonrpc.StatusData `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	if resp.Error.Code != jsonrpc.CodeServerError || resp.Error.Message != "admins only" || resp.Error.Data.Status != "PERMISSION_DENIED" {
+		t.Errorf("error = %+v, want a server error with status PERMISSION_DENIED", resp.Error)
+	}
+
+	resp2, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d, want 405", resp2.StatusCode)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	srv := testutil.NewServer(t)
+	ts := httptest.NewServer(jsonrpc.NewHandler(srv.Conn, srv.Services.Descriptors()...))
+	t.Cleanup(ts.Close)
+
+	// v2 returns the user itself
+	_, body := post(t, ts, `{"jsonrpc":"2.0","method":"api.v2.UserService.CreateUser","params":{"user":{"email":"ada@example.com"}},"id":1}`)
+	var created struct {
+		Result struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(body), &created); err != nil || created.Result.Email != "ada@example.com" {
+		t.Fatalf("api.v2.UserService.CreateUser = %s, want the user", body)
+	}
+
+	// The short name stays with v1, registered first
+	for _, method := range []string{"UserService.GetUser", "api.v1.UserService.GetUser"} {
+		_, body = post(t, ts, `{"jsonrpc":"2.0","method":"`+method+`","params":{"name":"`+created.Result.Name+`"},"id":2}`)
+		if !strings.Contains(body, `"errorMsg":"success"`) || !strings.Contains(body, `"email":"ada@example.com"`) {
+			t.Errorf("%s = %s, want the v1 envelope", method, body)
+		}
+	}
+}
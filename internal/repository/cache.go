@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/cache"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// CacheOptions configures a CachedRepository
+type CacheOptions struct {
+	// KeyPrefix namespaces the cache keys (default "cache:users")
+	KeyPrefix string
+
+	// TTL bounds how long a cached user may be served (default 5m)
+	TTL time.Duration
+}
+
+// CachedRepository caches single-user reads of another UserRepository,
+// usually in Redis. Gets and batch gets read through the cache; updates and
+// deletes invalidate the user's entry once the backing write succeeds. A
+// cache failure falls back to the backing repository rather than failing
+// reads.
+type CachedRepository struct {
+	next  UserRepository
+	cache cache.Cache
+	opts  CacheOptions
+}
+
+// NewCachedRepository creates a CachedRepository in front of next
+func NewCachedRepository(next UserRepository, c cache.Cache, opts CacheOptions) *CachedRepository {
+	if opts.KeyPrefix == "" {
+		opts.KeyPrefix = "cache:users"
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 5 * time.Minute
+	}
+	return &CachedRepository{next: next, cache: c, opts: opts}
+}
+
+func (r *CachedRepository) key(name string) string {
+	return r.opts.KeyPrefix + ":" + name
+}
+
+// Create stores a new user. It is not cached until it is first read.
+func (r *CachedRepository) Create(ctx context.Context, user *apiv1.User) (*apiv1.User, error) {
+	return r.next.Create(ctx, user)
+}
+
+// Get returns a user from the cache, or from the backing repository on a
+// miss, caching it
+func (r *CachedRepository) Get(ctx context.Context, name string) (*apiv1.User, error) {
+	if data, err := r.cache.Get(ctx, r.key(name)); err == nil {
+		if user, ok := decodeCachedUser(data); ok {
+			return user, nil
+		}
+	}
+
+	user, err := r.next.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	r.store(ctx, user)
+	return user, nil
+}
+
+// GetByEmail reads the backing repository, as entries are cached by name
+func (r *CachedRepository) GetByEmail(ctx context.Context, email string) (*apiv1.User, error) {
+	return r.next.GetByEmail(ctx, email)
+}
+
+// List reads the backing repository, pages are not cached
+func (r *CachedRepository) List(ctx context.Context, offset, limit int) ([]*apiv1.User, error) {
+	return r.next.List(ctx, offset, limit)
+}
+
+// Find reads the backing repository, pages are not cached
+func (r *CachedRepository) Find(ctx context.Context, q Query) ([]*apiv1.User, error) {
+	return r.next.Find(ctx, q)
+}
+
+// Count reads the backing repository
+func (r *CachedRepository) Count(ctx context.Context) (int, error) {
+	return r.next.Count(ctx)
+}
+
+// CountMatching reads the backing repository
+func (r *CachedRepository) CountMatching(ctx context.Context, f filter.Expr) (int, error) {
+	return r.next.CountMatching(ctx, f)
+}
+
+// Update replaces an existing user and invalidates its cache entry. The
+// backing repository checks lastUpdate, as a cached user may be stale.
+func (r *CachedRepository) Update(ctx context.Context, user *apiv1.User, lastUpdate *timestamppb.Timestamp) (*apiv1.User, error) {
+	updated, err := r.next.Update(ctx, user, lastUpdate)
+	if err != nil {
+		return nil, err
+	}
+	r.invalidate(ctx, user.GetName())
+	return updated, nil
+}
+
+// Delete removes a user and invalidates its cache entry
+func (r *CachedRepository) Delete(ctx context.Context, name string) error {
+	if err := r.next.Delete(ctx, name); err != nil {
+		return err
+	}
+	r.invalidate(ctx, name)
+	return nil
+}
+
+// BatchGet returns the existing users among names, reading only the cache
+// misses from the backing repository
+func (r *CachedRepository) BatchGet(ctx context.Context, names []string) ([]*apiv1.User, error) {
+	if len(names) == 0 {
+		return r.next.BatchGet(ctx, names)
+	}
+
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = r.key(name)
+	}
+
+	found := make(map[string]*apiv1.User, len(names))
+	if values, err := r.cache.GetMulti(ctx, keys); err == nil {
+		for i, data := range values {
+			if data == nil {
+				continue
+			}
+			if user, ok := decodeCachedUser(data); ok {
+				found[names[i]] = user
+			}
+		}
+	}
+
+	var misses []string
+	for _, name := range names {
+		if _, ok := found[name]; !ok {
+			misses = append(misses, name)
+		}
+	}
+	if len(misses) > 0 {
+		loaded, err := r.next.BatchGet(ctx, misses)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range loaded {
+			found[user.GetName()] = user
+		}
+		r.store(ctx, loaded...)
+	}
+
+	var users []*apiv1.User
+	for _, name := range names {
+		if user, ok := found[name]; ok {
+			users = append(users, proto.Clone(user).(*apiv1.User))
+		}
+	}
+	return users, nil
+}
+
+// Snapshot returns every user from the backing repository
+func (r *CachedRepository) Snapshot(ctx context.Context) ([]*apiv1.User, error) {
+	s, ok := r.next.(Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("repository: the cached repository cannot be dumped: %w", errors.ErrUnsupported)
+	}
+	return s.Snapshot(ctx)
+}
+
+// Restore replaces every user in the backing repository, then invalidates
+// the cache entries of the users before and after
+func (r *CachedRepository) Restore(ctx context.Context, users []*apiv1.User) error {
+	s, ok := r.next.(Snapshotter)
+	if !ok {
+		return fmt.Errorf("repository: the cached repository cannot be restored: %w", errors.ErrUnsupported)
+	}
+	before, err := s.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.Restore(ctx, users); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(before)+len(users))
+	for _, user := range append(before, users...) {
+		names = append(names, user.GetName())
+	}
+	r.invalidate(ctx, names...)
+	return nil
+}
+
+// IndexVersion returns that of the backing repository
+func (r *CachedRepository) IndexVersion(ctx context.Context) (int, error) {
+	ri, ok := r.next.(Reindexer)
+	if !ok {
+		return 0, fmt.Errorf("repository: the cached repository cannot be reindexed: %w", errors.ErrUnsupported)
+	}
+	return ri.IndexVersion(ctx)
+}
+
+// Reindex rebuilds the indexes of the backing repository. Cached users
+// are unchanged by it.
+func (r *CachedRepository) Reindex(ctx context.Context, progress func(done, total int)) error {
+	ri, ok := r.next.(Reindexer)
+	if !ok {
+		return fmt.Errorf("repository: the cached repository cannot be reindexed: %w", errors.ErrUnsupported)
+	}
+	return ri.Reindex(ctx, progress)
+}
+
+// Outbox returns the outbox of the backing repository, whose writes add
+// the messages of their context
+func (r *CachedRepository) Outbox() outbox.Store {
+	return OutboxOf(r.next)
+}
+
+// Ping reports whether the cache is reachable. Reads still succeed without
+// it, only slower.
+func (r *CachedRepository) Ping(ctx context.Context) error {
+	return r.cache.Ping(ctx)
+}
+
+// store caches users, ignoring failures: the next read goes to the backing
+// repository again
+func (r *CachedRepository) store(ctx context.Context, users ...*apiv1.User) {
+	values := make(map[string][]byte, len(users))
+	for _, user := range users {
+		data, err := proto.Marshal(user)
+		if err != nil {
+			continue
+		}
+		values[r.key(user.GetName())] = data
+	}
+	r.cache.SetMulti(ctx, values, r.opts.TTL)
+}
+
+// invalidate drops cached users. A failed delete leaves the stale entries
+// until their TTL expires.
+func (r *CachedRepository) invalidate(ctx context.Context, names ...string) {
+	if len(names) == 0 {
+		return
+	}
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = r.key(name)
+	}
+	r.cache.Delete(ctx, keys...)
+}
+
+func decodeCachedUser(data []byte) (*apiv1.User, bool) {
+	user := &apiv1.User{}
+	if err := proto.Unmarshal(data, user); err != nil {
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/cache"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// countingRepository counts the reads that reach the backing repository
+type countingRepository struct {
+	UserRepository
+	gets, batchGets int
+}
+
+func (c *countingRepository) Get(ctx context.Context, name string) (*apiv1.User, error) {
+	c.gets++
+	return c.UserRepository.Get(ctx, name)
+}
+
+func (c *countingRepository) BatchGet(ctx context.Context, names []string) ([]*apiv1.User, error) {
+	c.batchGets += len(names)
+	return c.UserRepository.BatchGet(ctx, names)
+}
+
+func newTestCache(t *testing.T) (*CachedRepository, *countingRepository, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	backing := &countingRepository{UserRepository: NewMemoryRepository()}
+	return NewCachedRepository(backing, cache.NewRedisCache(client), CacheOptions{TTL: time.Minute}), backing, mr
+}
+
+func TestCachedRepositoryGet(t *testing.T) {
+	ctx := context.Background()
+	repo, backing, mr := newTestCache(t)
+	repo.Create(ctx, &apiv1.User{Name: "users/1", Email: "old@example.com"})
+
+	for i := 0; i < 3; i++ {
+		if _, err := repo.Get(ctx, "users/1"); err != nil {
+			t.Fatalf("Get() unexpected error: %v", err)
+		}
+	}
+	if backing.gets != 1 {
+		t.Errorf("backing Get() called %d times, want 1", backing.gets)
+	}
+
+	repo.Update(ctx, &apiv1.User{Name: "users/1", Email: "new@example.com"}, nil)
+	if got, _ := repo.Get(ctx, "users/1"); got.GetEmail() != "new@example.com" {
+		t.Errorf("Get() after Update() email = %q, want the new one", got.GetEmail())
+	}
+
+	mr.FastForward(2 * time.Minute)
+	repo.Get(ctx, "users/1")
+	if backing.gets != 3 {
+		t.Errorf("backing Get() called %d times, want 3 after an update and an expiry", backing.gets)
+	}
+
+	repo.Delete(ctx, "users/1")
+	if _, err := repo.Get(ctx, "users/1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestCachedRepositoryUpdateConflict(t *testing.T) {
+	repo, _, _ := newTestCache(t)
+	runUpdateConflictSuite(t, repo)
+}
+
+func TestCachedRepositoryBatchGet(t *testing.T) {
+	ctx := context.Background()
+	repo, backing, _ := newTestCache(t)
+	for _, name := range []string{"users/1", "users/2", "users/3"} {
+		repo.Create(ctx, &apiv1.User{Name: name})
+	}
+	repo.Get(ctx, "users/2")
+
+	users, err := repo.BatchGet(ctx, []string{"users/3", "users/404", "users/2", "users/1"})
+	if err != nil {
+		t.Fatalf("BatchGet() unexpected error: %v", err)
+	}
+	var names []string
+	for _, user := range users {
+		names = append(names, user.GetName())
+	}
+	if len(names) != 3 || names[0] != "users/3" || names[1] != "users/2" || names[2] != "users/1" {
+		t.Errorf("BatchGet() = %v, want the existing users in request order", names)
+	}
+	if backing.batchGets != 3 {
+		t.Errorf("backing BatchGet() read %d names, want the 3 misses", backing.batchGets)
+	}
+
+	repo.BatchGet(ctx, []string{"users/1", "users/2", "users/3"})
+	if backing.batchGets != 3 {
+		t.Errorf("backing BatchGet() read %d names, want no more once cached", backing.batchGets)
+	}
+}
+
+func TestCachedRepositoryRedisDown(t *testing.T) {
+	ctx := context.Background()
+	repo, _, mr := newTestCache(t)
+	repo.Create(ctx, &apiv1.User{Name: "users/1"})
+	if err := repo.Ping(ctx); err != nil {
+		t.Errorf("Ping() unexpected error: %v", err)
+	}
+	mr.Close()
+
+	if err := repo.Ping(ctx); err == nil {
+		t.Error("Ping() with Redis down expected error")
+	}
+
+	if _, err := repo.Get(ctx, "users/1"); err != nil {
+		t.Errorf("Get() with Redis down error = %v, want nil", err)
+	}
+	if users, err := repo.BatchGet(ctx, []string{"users/1"}); err != nil || len(users) != 1 {
+		t.Errorf("BatchGet() with Redis down = %v, %v, want the user", users, err)
+	}
+}
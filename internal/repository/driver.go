@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+)
+
+// defaultConnectTimeout bounds the wait for a database at startup when
+// the configuration sets none
+const defaultConnectTimeout = 5 * time.Second
+
+// Driver opens a UserRepository from the storage configuration, connecting
+// to the database if it has one. The returned func closes the connections
+// it opened.
+type Driver func(ctx context.Context, cfg config.StorageConfig) (UserRepository, func() error, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// RegisterDriver makes a driver available by name to Open. It panics if
+// the name is taken, like database/sql.Register.
+func RegisterDriver(name string, d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if d == nil {
+		panic("repository: RegisterDriver driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("repository: RegisterDriver called twice for driver " + name)
+	}
+	drivers[name] = d
+}
+
+// Drivers returns the names of the registered drivers, sorted
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the repository of cfg.Driver, "memory" when it is empty. An
+// unknown driver fails with the names of the registered ones.
+func Open(ctx context.Context, cfg config.StorageConfig) (UserRepository, func() error, error) {
+	name := cfg.Driver
+	if name == "" {
+		name = "memory"
+	}
+	driversMu.RLock()
+	d, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown storage driver %q, expected one of %s", name, strings.Join(Drivers(), ", "))
+	}
+	repo, closeRepo, err := d(ctx, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open %s storage: %w", name, err)
+	}
+	return repo, closeRepo, nil
+}
+
+// connectTimeout returns cfg's connect timeout, or the default
+func connectTimeout(cfg config.StorageConfig) time.Duration {
+	if cfg.ConnectTimeout > 0 {
+		return cfg.ConnectTimeout
+	}
+	return defaultConnectTimeout
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+)
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	_, _, err := Open(ctx, config.StorageConfig{Driver: "oracle"})
+	if err == nil || !strings.Contains(err.Error(), "memory, mysql, postgres, sqlite") {
+		t.Errorf("Open(oracle) error = %v, want one listing the drivers", err)
+	}
+
+	repo, closeRepo, err := Open(ctx, config.StorageConfig{})
+	if err != nil {
+		t.Fatalf("Open() without a driver unexpected error: %v", err)
+	}
+	if _, ok := repo.(*MemoryRepository); !ok {
+		t.Errorf("Open() without a driver = %T, want *MemoryRepository", repo)
+	}
+	closeRepo()
+}
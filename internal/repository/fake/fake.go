@@ -0,0 +1,219 @@
+// Package fake provides a programmable UserRepository for tests that need to
+// exercise error paths the in-memory repository never produces.
+package fake
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Op identifies a repository method
+type Op string
+
+// Repository operations that can be programmed
+const (
+	OpCreate   Op = "Create"
+	OpGet      Op = "Get"
+	OpList     Op = "List"
+	OpCount    Op = "Count"
+	OpUpdate   Op = "Update"
+	OpDelete   Op = "Delete"
+	OpBatchGet Op = "BatchGet"
+)
+
+// Fault describes what happens on a single call
+type Fault struct {
+	// Latency delays the call, returning early if the context is done
+	Latency time.Duration
+
+	// Err is returned instead of calling the backing repository
+	Err error
+}
+
+// Repository wraps a backing UserRepository and injects faults per call
+type Repository struct {
+	backing repository.UserRepository
+
+	mu     sync.Mutex
+	queued map[Op][]Fault
+	always map[Op]Fault
+	calls  map[Op]int
+}
+
+// NewRepository creates a fake backed by an in-memory repository
+func NewRepository() *Repository {
+	return Wrap(repository.NewMemoryRepository())
+}
+
+// Wrap creates a fake that delegates successful calls to backing
+func Wrap(backing repository.UserRepository) *Repository {
+	return &Repository{
+		backing: backing,
+		queued:  make(map[Op][]Fault),
+		always:  make(map[Op]Fault),
+		calls:   make(map[Op]int),
+	}
+}
+
+// Enqueue programs faults for the next calls of op, one fault per call in
+// order. A zero Fault lets that call through unchanged.
+func (r *Repository) Enqueue(op Op, faults ...Fault) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queued[op] = append(r.queued[op], faults...)
+}
+
+// FailNext makes the next call of op return err
+func (r *Repository) FailNext(op Op, err error) {
+	r.Enqueue(op, Fault{Err: err})
+}
+
+// Always applies fault to every call of op once its queue is drained
+func (r *Repository) Always(op Op, fault Fault) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.always[op] = fault
+}
+
+// SetLatency delays every call of op by d
+func (r *Repository) SetLatency(op Op, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fault := r.always[op]
+	fault.Latency = d
+	r.always[op] = fault
+}
+
+// Calls returns how many times op has been called
+func (r *Repository) Calls(op Op) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[op]
+}
+
+// Reset clears all programmed faults and call counts
+func (r *Repository) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queued = make(map[Op][]Fault)
+	r.always = make(map[Op]Fault)
+	r.calls = make(map[Op]int)
+}
+
+// inject records the call and applies the programmed fault for op
+func (r *Repository) inject(ctx context.Context, op Op) error {
+	r.mu.Lock()
+	r.calls[op]++
+	fault := r.always[op]
+	if q := r.queued[op]; len(q) > 0 {
+		fault = q[0]
+		r.queued[op] = q[1:]
+	}
+	r.mu.Unlock()
+
+	if fault.Latency > 0 {
+		timer := time.NewTimer(fault.Latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return fault.Err
+}
+
+// Create implements repository.UserRepository
+func (r *Repository) Create(ctx context.Context, user *apiv1.User) (*apiv1.User, error) {
+	if err := r.inject(ctx, OpCreate); err != nil {
+		return nil, err
+	}
+	return r.backing.Create(ctx, user)
+}
+
+// Get implements repository.UserRepository
+func (r *Repository) Get(ctx context.Context, name string) (*apiv1.User, error) {
+	if err := r.inject(ctx, OpGet); err != nil {
+		return nil, err
+	}
+	return r.backing.Get(ctx, name)
+}
+
+// GetByEmail implements repository.UserRepository, failing like Get
+func (r *Repository) GetByEmail(ctx context.Context, email string) (*apiv1.User, error) {
+	if err := r.inject(ctx, OpGet); err != nil {
+		return nil, err
+	}
+	return r.backing.GetByEmail(ctx, email)
+}
+
+// List implements repository.UserRepository
+func (r *Repository) List(ctx context.Context, offset, limit int) ([]*apiv1.User, error) {
+	if err := r.inject(ctx, OpList); err != nil {
+		return nil, err
+	}
+	return r.backing.List(ctx, offset, limit)
+}
+
+// Find implements repository.UserRepository, failing like List
+func (r *Repository) Find(ctx context.Context, q repository.Query) ([]*apiv1.User, error) {
+	if err := r.inject(ctx, OpList); err != nil {
+		return nil, err
+	}
+	return r.backing.Find(ctx, q)
+}
+
+// Count implements repository.UserRepository
+func (r *Repository) Count(ctx context.Context) (int, error) {
+	if err := r.inject(ctx, OpCount); err != nil {
+		return 0, err
+	}
+	return r.backing.Count(ctx)
+}
+
+// CountMatching implements repository.UserRepository, failing like Count
+func (r *Repository) CountMatching(ctx context.Context, f filter.Expr) (int, error) {
+	if err := r.inject(ctx, OpCount); err != nil {
+		return 0, err
+	}
+	return r.backing.CountMatching(ctx, f)
+}
+
+// Update implements repository.UserRepository
+func (r *Repository) Update(ctx context.Context, user *apiv1.User, lastUpdate *timestamppb.Timestamp) (*apiv1.User, error) {
+	if err := r.inject(ctx, OpUpdate); err != nil {
+		return nil, err
+	}
+	return r.backing.Update(ctx, user, lastUpdate)
+}
+
+// Delete implements repository.UserRepository
+func (r *Repository) Delete(ctx context.Context, name string) error {
+	if err := r.inject(ctx, OpDelete); err != nil {
+		return err
+	}
+	return r.backing.Delete(ctx, name)
+}
+
+// BatchGet implements repository.UserRepository
+func (r *Repository) BatchGet(ctx context.Context, names []string) ([]*apiv1.User, error) {
+	if err := r.inject(ctx, OpBatchGet); err != nil {
+		return nil, err
+	}
+	return r.backing.BatchGet(ctx, names)
+}
+
+// Outbox implements repository.Outboxer with the backing repository's
+// outbox, which gets the messages of writes that are not failed
+func (r *Repository) Outbox() outbox.Store {
+	return repository.OutboxOf(r.backing)
+}
+
+var _ repository.UserRepository = (*Repository)(nil)
@@ -0,0 +1,393 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MemoryRepository is an in-memory UserRepository. Data is lost on restart,
+// along with its outbox.
+type MemoryRepository struct {
+	mu    sync.RWMutex
+	users map[string]*apiv1.User
+
+	// emails maps the emails in use to the names of their users, so a
+	// write checks and claims an email under the same lock
+	emails map[string]string
+
+	// ordered holds the same users sorted by lessByCreateTime, kept up to
+	// date on every write so List only touches the requested page
+	ordered []*apiv1.User
+
+	// live counts the users of ordered NotDeleted matches, kept up to date
+	// with it, so counting the users a default list shows does not check
+	// every user
+	live int
+
+	// outbox gets the messages of a write under the same lock
+	outbox *outbox.MemoryStore
+}
+
+func init() {
+	RegisterDriver("memory", func(context.Context, config.StorageConfig) (UserRepository, func() error, error) {
+		return NewMemoryRepository(), func() error { return nil }, nil
+	})
+}
+
+// NewMemoryRepository creates a new MemoryRepository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		users:  make(map[string]*apiv1.User),
+		emails: make(map[string]string),
+		outbox: outbox.NewMemoryStore(),
+	}
+}
+
+// Create stores a new user
+func (r *MemoryRepository) Create(ctx context.Context, user *apiv1.User) (*apiv1.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.users[user.GetName()]; exists {
+		return nil, ErrAlreadyExists
+	}
+	if r.emailTaken(user) {
+		return nil, ErrEmailTaken
+	}
+	if err := r.addMessages(ctx); err != nil {
+		return nil, err
+	}
+
+	stored := proto.Clone(user).(*apiv1.User)
+	r.users[user.GetName()] = stored
+	r.insert(stored)
+	r.claimEmail(stored)
+	return proto.Clone(user).(*apiv1.User), nil
+}
+
+// Get returns a user by resource name
+func (r *MemoryRepository) Get(ctx context.Context, name string) (*apiv1.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, exists := r.users[name]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(user).(*apiv1.User), nil
+}
+
+// GetByEmail returns the user with email, found through the email index
+func (r *MemoryRepository) GetByEmail(ctx context.Context, email string) (*apiv1.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name, exists := r.emails[email]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(r.users[name]).(*apiv1.User), nil
+}
+
+// List returns a page of users ordered by creation time
+func (r *MemoryRepository) List(ctx context.Context, offset, limit int) ([]*apiv1.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	total := len(r.ordered)
+	if offset < 0 || offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if limit < 0 || end > total {
+		end = total
+	}
+
+	users := make([]*apiv1.User, 0, end-offset)
+	for _, user := range r.ordered[offset:end] {
+		users = append(users, proto.Clone(user).(*apiv1.User))
+	}
+	return users, nil
+}
+
+// Find returns the users q selects. In creation order the sorted index
+// is searched for q.After and only the page is read; other orders sort a
+// copy of the index first.
+func (r *MemoryRepository) Find(ctx context.Context, q Query) ([]*apiv1.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := orderKeys(q.OrderBy)
+	ordered := r.ordered
+	if !slices.Equal(keys, defaultKeys) {
+		ordered = slices.Clone(r.ordered)
+		slices.SortFunc(ordered, func(a, b *apiv1.User) int { return compareUsers(keys, a, b) })
+	}
+	start := 0
+	if q.After != nil {
+		start = sort.Search(len(ordered), func(i int) bool {
+			return compareUsers(keys, q.After, ordered[i]) < 0
+		})
+	}
+
+	users := []*apiv1.User{}
+	for _, user := range ordered[start:] {
+		if q.Limit >= 0 && len(users) >= q.Limit {
+			break
+		}
+		if filter.Match(q.Filter, user) {
+			users = append(users, proto.Clone(user).(*apiv1.User))
+		}
+	}
+	return users, nil
+}
+
+// Count returns the number of users, tracked by the sorted index
+func (r *MemoryRepository) Count(ctx context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.ordered), nil
+}
+
+// CountMatching returns the number of users f matches, checking each of
+// them unless f is nil or NotDeleted, whose counts are tracked
+func (r *MemoryRepository) CountMatching(ctx context.Context, f filter.Expr) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	switch f {
+	case nil:
+		return len(r.ordered), nil
+	case NotDeleted:
+		return r.live, nil
+	}
+	n := 0
+	for _, user := range r.ordered {
+		if filter.Match(f, user) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Update replaces an existing user last updated at lastUpdate
+func (r *MemoryRepository) Update(ctx context.Context, user *apiv1.User, lastUpdate *timestamppb.Timestamp) (*apiv1.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, exists := r.users[user.GetName()]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if !old.GetUpdateTime().AsTime().Equal(lastUpdate.AsTime()) {
+		return nil, ErrConflict
+	}
+	if r.emailTaken(user) {
+		return nil, ErrEmailTaken
+	}
+	if err := r.addMessages(ctx); err != nil {
+		return nil, err
+	}
+
+	stored := proto.Clone(user).(*apiv1.User)
+	r.users[user.GetName()] = stored
+	r.remove(old)
+	r.insert(stored)
+	delete(r.emails, old.GetEmail())
+	r.claimEmail(stored)
+	return proto.Clone(user).(*apiv1.User), nil
+}
+
+// Delete removes a user
+func (r *MemoryRepository) Delete(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, exists := r.users[name]
+	if !exists {
+		return ErrNotFound
+	}
+	if err := r.addMessages(ctx); err != nil {
+		return err
+	}
+
+	delete(r.users, name)
+	r.remove(old)
+	delete(r.emails, old.GetEmail())
+	return nil
+}
+
+// BatchGet returns the existing users among names
+func (r *MemoryRepository) BatchGet(ctx context.Context, names []string) ([]*apiv1.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []*apiv1.User
+	for _, name := range names {
+		if user, exists := r.users[name]; exists {
+			users = append(users, proto.Clone(user).(*apiv1.User))
+		}
+	}
+	return users, nil
+}
+
+// Snapshot returns every user, ordered by creation time, under one read
+// lock
+func (r *MemoryRepository) Snapshot(ctx context.Context) ([]*apiv1.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]*apiv1.User, 0, len(r.ordered))
+	for _, user := range r.ordered {
+		users = append(users, proto.Clone(user).(*apiv1.User))
+	}
+	return users, nil
+}
+
+// Restore replaces every user with users. The new map and index are built
+// first and swapped in under the write lock, so readers see either the old
+// state or the new one.
+func (r *MemoryRepository) Restore(ctx context.Context, users []*apiv1.User) error {
+	byName := make(map[string]*apiv1.User, len(users))
+	emails := make(map[string]string, len(users))
+	ordered := make([]*apiv1.User, 0, len(users))
+	for _, user := range users {
+		name := user.GetName()
+		if name == "" {
+			return fmt.Errorf("%w: a user has no name", ErrInvalid)
+		}
+		if _, exists := byName[name]; exists {
+			return fmt.Errorf("%w: user %s appears twice", ErrInvalid, name)
+		}
+		if other, exists := emails[user.GetEmail()]; exists {
+			return fmt.Errorf("%w: users %s and %s have the same email", ErrInvalid, other, name)
+		}
+		if user.GetEmail() != "" {
+			emails[user.GetEmail()] = name
+		}
+		stored := proto.Clone(user).(*apiv1.User)
+		byName[name] = stored
+		ordered = append(ordered, stored)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return lessByCreateTime(ordered[i], ordered[j]) })
+	live := 0
+	for _, user := range ordered {
+		if filter.Match(NotDeleted, user) {
+			live++
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users, r.emails, r.ordered, r.live = byName, emails, ordered, live
+	return nil
+}
+
+// IndexVersion returns IndexVersion: the indexes are built as users are
+// stored, and live no longer than they do
+func (r *MemoryRepository) IndexVersion(ctx context.Context) (int, error) {
+	return IndexVersion, nil
+}
+
+// Reindex rebuilds the email index, the creation order and the count of
+// live users from the users, under the write lock
+func (r *MemoryRepository) Reindex(ctx context.Context, progress func(done, total int)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	emails := make(map[string]string, len(r.users))
+	ordered := make([]*apiv1.User, 0, len(r.users))
+	live := 0
+	for _, user := range r.users {
+		if user.GetEmail() != "" {
+			emails[user.GetEmail()] = user.GetName()
+		}
+		ordered = append(ordered, user)
+		if filter.Match(NotDeleted, user) {
+			live++
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool { return lessByCreateTime(ordered[i], ordered[j]) })
+	r.emails, r.ordered, r.live = emails, ordered, live
+	progress(len(ordered), len(ordered))
+	return nil
+}
+
+// Outbox returns the outbox the writes add their messages to
+func (r *MemoryRepository) Outbox() outbox.Store {
+	return r.outbox
+}
+
+// addMessages adds the outbox messages of ctx before a write. r.mu must be
+// held, so the messages are added with the write or not at all.
+func (r *MemoryRepository) addMessages(ctx context.Context) error {
+	for _, msg := range outbox.Messages(ctx) {
+		if err := r.outbox.Add(ctx, msg); err != nil {
+			return fmt.Errorf("repository: %w", err)
+		}
+	}
+	return nil
+}
+
+// emailTaken reports whether another user than user has its email. r.mu
+// must be held.
+func (r *MemoryRepository) emailTaken(user *apiv1.User) bool {
+	owner, taken := r.emails[user.GetEmail()]
+	return taken && owner != user.GetName()
+}
+
+// claimEmail records the email of user, as stored in users, if it has one.
+// r.mu must be held.
+func (r *MemoryRepository) claimEmail(user *apiv1.User) {
+	if user.GetEmail() != "" {
+		r.emails[user.GetEmail()] = user.GetName()
+	}
+}
+
+// insert adds user to ordered at its sorted position
+func (r *MemoryRepository) insert(user *apiv1.User) {
+	i := sort.Search(len(r.ordered), func(i int) bool {
+		return lessByCreateTime(user, r.ordered[i])
+	})
+	r.ordered = append(r.ordered, nil)
+	copy(r.ordered[i+1:], r.ordered[i:])
+	r.ordered[i] = user
+	if filter.Match(NotDeleted, user) {
+		r.live++
+	}
+}
+
+// remove deletes user, as stored in users, from ordered
+func (r *MemoryRepository) remove(user *apiv1.User) {
+	i := sort.Search(len(r.ordered), func(i int) bool {
+		return !lessByCreateTime(r.ordered[i], user)
+	})
+	if i < len(r.ordered) && r.ordered[i] == user {
+		r.ordered = append(r.ordered[:i], r.ordered[i+1:]...)
+		if filter.Match(NotDeleted, user) {
+			r.live--
+		}
+	}
+}
+
+// lessByCreateTime orders users by creation time, breaking ties by name
+func lessByCreateTime(a, b *apiv1.User) bool {
+	at, bt := a.GetCreateTime().AsTime(), b.GetCreateTime().AsTime()
+	if !at.Equal(bt) {
+		return at.Before(bt)
+	}
+	if len(a.GetName()) != len(b.GetName()) {
+		return len(a.GetName()) < len(b.GetName())
+	}
+	return a.GetName() < b.GetName()
+}
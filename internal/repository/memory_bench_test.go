@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// seedMemoryRepository returns a repository holding n users created one
+// second apart
+func seedMemoryRepository(b *testing.B, n int) *MemoryRepository {
+	b.Helper()
+
+	r := NewMemoryRepository()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		user := &apiv1.User{
+			Name:       fmt.Sprintf("users/%d", i),
+			Email:      fmt.Sprintf("user%d@example.com", i),
+			CreateTime: timestamppb.New(start.Add(time.Duration(i) * time.Second)),
+		}
+		if _, err := r.Create(context.Background(), user); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return r
+}
+
+// BenchmarkMemoryRepositoryList lists a 50 user page from the end of the
+// repository. The time per op should not grow with the total.
+func BenchmarkMemoryRepositoryList(b *testing.B) {
+	for _, total := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("total=%d", total), func(b *testing.B) {
+			r := seedMemoryRepository(b, total)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.List(ctx, total-50, 50); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMemoryRepositoryCountNotDeleted counts the users a default
+// ListUsers shows. The time per op should not grow with the total.
+func BenchmarkMemoryRepositoryCountNotDeleted(b *testing.B) {
+	for _, total := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("total=%d", total), func(b *testing.B) {
+			r := seedMemoryRepository(b, total)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.CountMatching(ctx, NotDeleted); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
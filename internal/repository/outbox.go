@@ -0,0 +1,21 @@
+package repository
+
+import "github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+
+// Outboxer is implemented by repositories that keep an outbox beside the
+// users. Create, Update and Delete add the messages of their context, see
+// outbox.WithMessages, in the same transaction as the write, so a message
+// is published if and only if its write was committed.
+type Outboxer interface {
+	// Outbox returns the store the relay reads the messages from, nil if
+	// the repository keeps none
+	Outbox() outbox.Store
+}
+
+// OutboxOf returns the outbox of repo, nil if it keeps none
+func OutboxOf(repo UserRepository) outbox.Store {
+	if o, ok := repo.(Outboxer); ok {
+		return o.Outbox()
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/cache"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// runOutboxSuite checks that the writes of repo add the messages of their
+// context to its outbox, and only when they succeed
+func runOutboxSuite(t *testing.T, repo UserRepository) {
+	t.Helper()
+	ctx := context.Background()
+	store := OutboxOf(repo)
+	if store == nil {
+		t.Fatal("OutboxOf() = nil, want the repository's outbox")
+	}
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	with := func(id string, i int) context.Context {
+		return outbox.WithMessages(ctx, &outbox.Message{ID: id, Topic: "users", Key: "users/1", Payload: []byte(id), CreateTime: base.Add(time.Duration(i) * time.Second)})
+	}
+
+	if _, err := repo.Create(with("created", 0), &apiv1.User{Name: "users/1"}); err != nil {
+		t.Fatalf("Create() unexpected error: %v", err)
+	}
+	if _, err := repo.Create(with("duplicate", 1), &apiv1.User{Name: "users/1"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("Create() duplicate error = %v, want %v", err, ErrAlreadyExists)
+	}
+	if _, err := repo.Update(with("updated", 2), &apiv1.User{Name: "users/1", Email: "new@example.com"}, nil); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	if _, err := repo.Update(with("missing", 3), &apiv1.User{Name: "users/2"}, nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Update() missing error = %v, want %v", err, ErrNotFound)
+	}
+	if err := repo.Delete(with("deleted", 4), "users/1"); err != nil {
+		t.Fatalf("Delete() unexpected error: %v", err)
+	}
+	// Writes without messages add none
+	if _, err := repo.Create(ctx, &apiv1.User{Name: "users/3"}); err != nil {
+		t.Fatalf("Create() unexpected error: %v", err)
+	}
+
+	pending, err := store.Pending(ctx, 10)
+	if err != nil {
+		t.Fatalf("Pending() unexpected error: %v", err)
+	}
+	var ids []string
+	for _, msg := range pending {
+		ids = append(ids, msg.ID)
+	}
+	if len(ids) != 3 || ids[0] != "created" || ids[1] != "updated" || ids[2] != "deleted" {
+		t.Errorf("outbox = %v, want the messages of the successful writes in order", ids)
+	}
+	if !pending[0].CreateTime.Equal(base) || string(pending[0].Payload) != "created" || pending[0].Key != "users/1" {
+		t.Errorf("Pending()[0] = %+v, want the message as added", pending[0])
+	}
+
+	if err := store.MarkFailed(ctx, "created", errors.New("broker down")); err != nil {
+		t.Errorf("MarkFailed() unexpected error: %v", err)
+	}
+	if err := store.MarkDelivered(ctx, "created", base.Add(time.Minute)); err != nil {
+		t.Errorf("MarkDelivered() unexpected error: %v", err)
+	}
+	if err := store.MarkDelivered(ctx, "unknown", base); !errors.Is(err, outbox.ErrNotFound) {
+		t.Errorf("MarkDelivered() unknown error = %v, want %v", err, outbox.ErrNotFound)
+	}
+	pending, _ = store.Pending(ctx, 10)
+	if len(pending) != 2 || pending[0].ID != "updated" {
+		t.Errorf("Pending() after delivery = %v, want updated and deleted", pending)
+	}
+}
+
+func TestMemoryRepositoryOutbox(t *testing.T) {
+	runOutboxSuite(t, NewMemoryRepository())
+}
+
+func TestCachedRepositoryOutbox(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	runOutboxSuite(t, NewCachedRepository(NewMemoryRepository(), cache.NewRedisCache(client), CacheOptions{}))
+}
@@ -0,0 +1,576 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// postgresSchema creates the users, outbox and schema_versions tables. Users are stored
+// whole as protobuf, so fields added to User need no migration; the columns
+// beside it are the ones queries filter and sort on. Filter columns added
+// to an existing table are NULL until backfilled.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	name        text PRIMARY KEY,
+	create_time timestamptz NOT NULL,
+	data        bytea NOT NULL
+);
+CREATE INDEX IF NOT EXISTS users_create_time_idx ON users (create_time, length(name), name);
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS email text,
+	ADD COLUMN IF NOT EXISTS display_name text,
+	ADD COLUMN IF NOT EXISTS is_active boolean,
+	ADD COLUMN IF NOT EXISTS update_time timestamptz,
+	ADD COLUMN IF NOT EXISTS delete_time timestamptz NOT NULL DEFAULT 'epoch';
+CREATE INDEX IF NOT EXISTS users_email_idx ON users (email);
+CREATE INDEX IF NOT EXISTS users_delete_time_idx ON users (delete_time);
+CREATE TABLE IF NOT EXISTS outbox (
+	id           text PRIMARY KEY,
+	topic        text NOT NULL,
+	msg_key      text NOT NULL,
+	payload      bytea NOT NULL,
+	create_time  timestamptz NOT NULL,
+	deliver_time timestamptz,
+	attempts     integer NOT NULL DEFAULT 0,
+	last_error   text NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (create_time, id) WHERE deliver_time IS NULL;
+CREATE TABLE IF NOT EXISTS schema_versions (
+	name    text PRIMARY KEY,
+	version integer NOT NULL
+);
+`
+
+// postgresUniqueEmail makes emails unique once the filter columns are
+// backfilled. Users without one may be many.
+const postgresUniqueEmail = `CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email) WHERE email <> ''`
+
+// uniqueViolation is the SQLSTATE of a duplicate key
+const uniqueViolation = "23505"
+
+// pgDuplicate returns ErrAlreadyExists for a primary key violation,
+// ErrEmailTaken for one of the email index and nil for other errors
+func pgDuplicate(err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation:
+		return nil
+	case pgErr.ConstraintName == "users_email_key":
+		return ErrEmailTaken
+	default:
+		return ErrAlreadyExists
+	}
+}
+
+// PostgresRepository is a UserRepository stored in PostgreSQL, so users
+// survive restarts and are shared by every replica. Its outbox is a table
+// beside the users.
+type PostgresRepository struct {
+	pool *pgxpool.Pool
+}
+
+// pgQuerier is what writes need of a pool or a transaction
+type pgQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func init() {
+	RegisterDriver("postgres", openPostgres)
+}
+
+// openPostgres connects a pool to cfg.DSN, failing startup rather than the
+// first request when the database cannot be reached
+func openPostgres(ctx context.Context, cfg config.StorageConfig) (UserRepository, func() error, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid dsn: %w", err)
+	}
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = int32(cfg.MaxConns)
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, connectTimeout(cfg))
+	defer cancel()
+	if err := pool.Ping(pingCtx); err != nil {
+		pool.Close()
+		return nil, nil, err
+	}
+	repo, err := NewPostgresRepository(ctx, pool)
+	if err != nil {
+		pool.Close()
+		return nil, nil, err
+	}
+	return repo, func() error { pool.Close(); return nil }, nil
+}
+
+// NewPostgresRepository creates a PostgresRepository over pool, creating
+// the users and outbox tables if they do not exist. The caller closes pool.
+func NewPostgresRepository(ctx context.Context, pool *pgxpool.Pool) (*PostgresRepository, error) {
+	if _, err := pool.Exec(ctx, postgresSchema); err != nil {
+		return nil, fmt.Errorf("repository: create schema: %w", err)
+	}
+	r := &PostgresRepository{pool: pool}
+	if err := r.backfill(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := pool.Exec(ctx, postgresUniqueEmail); err != nil {
+		rows, dupErr := pool.Query(ctx, duplicateEmailsQuery)
+		if dupErr != nil {
+			return nil, fmt.Errorf("repository: unique emails: %w", err)
+		}
+		emails, dupErr := pgx.CollectRows(rows, pgx.RowTo[string])
+		if dupErr != nil {
+			return nil, fmt.Errorf("repository: unique emails: %w", err)
+		}
+		return nil, duplicateEmailsError(emails, err)
+	}
+	return r, nil
+}
+
+// postgresFilter renders filters on the users table of PostgresRepository
+var postgresFilter = filter.SQLDialect{
+	Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	Column:      userColumn,
+	Value: func(field string, v any) any {
+		// timestamptz keeps microseconds, the value may have nanoseconds
+		if t, ok := v.(time.Time); ok {
+			return t.Truncate(time.Microsecond)
+		}
+		return v
+	},
+}
+
+// backfill fills the filter columns of the users stored before they
+// existed, which are NULL, from the stored users
+func (r *PostgresRepository) backfill(ctx context.Context) error {
+	for {
+		rows, err := r.pool.Query(ctx, `SELECT data FROM users WHERE email IS NULL LIMIT 500`)
+		if err != nil {
+			return fmt.Errorf("repository: backfill: %w", err)
+		}
+		users, err := collectUsers(rows)
+		if err != nil {
+			return fmt.Errorf("repository: backfill: %w", err)
+		}
+		if len(users) == 0 {
+			return nil
+		}
+		for _, user := range users {
+			_, err := r.pool.Exec(ctx,
+				`UPDATE users SET email = $2, display_name = $3, is_active = $4, update_time = $5 WHERE name = $1`,
+				user.GetName(), user.GetEmail(), user.GetDisplayName(), user.GetIsActive(), user.GetUpdateTime().AsTime())
+			if err != nil {
+				return fmt.Errorf("repository: backfill %s: %w", user.GetName(), err)
+			}
+		}
+	}
+}
+
+// Create stores a new user
+func (r *PostgresRepository) Create(ctx context.Context, user *apiv1.User) (*apiv1.User, error) {
+	data, err := proto.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("repository: marshal %s: %w", user.GetName(), err)
+	}
+	err = r.write(ctx, func(q pgQuerier) error {
+		_, err := q.Exec(ctx,
+			`INSERT INTO users (name, create_time, email, display_name, is_active, update_time, delete_time, data) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			user.GetName(), user.GetCreateTime().AsTime(), user.GetEmail(), user.GetDisplayName(),
+			user.GetIsActive(), user.GetUpdateTime().AsTime(), user.GetDeleteTime().AsTime(), data)
+		if dup := pgDuplicate(err); dup != nil {
+			return dup
+		}
+		if err != nil {
+			return fmt.Errorf("repository: create %s: %w", user.GetName(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(user).(*apiv1.User), nil
+}
+
+// Get returns a user by resource name
+func (r *PostgresRepository) Get(ctx context.Context, name string) (*apiv1.User, error) {
+	var data []byte
+	err := r.pool.QueryRow(ctx, `SELECT data FROM users WHERE name = $1`, name).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: get %s: %w", name, err)
+	}
+	return unmarshalUser(data)
+}
+
+// GetByEmail returns the user with email, looked up in the unique email
+// index, whose condition is repeated for it to be used
+func (r *PostgresRepository) GetByEmail(ctx context.Context, email string) (*apiv1.User, error) {
+	if email == "" {
+		return nil, ErrNotFound
+	}
+	var data []byte
+	err := r.pool.QueryRow(ctx, `SELECT data FROM users WHERE email = $1 AND email <> ''`, email).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: get by email: %w", err)
+	}
+	return unmarshalUser(data)
+}
+
+// List returns a page of users ordered by creation time, in the order
+// MemoryRepository uses. A negative limit returns every user from offset.
+func (r *PostgresRepository) List(ctx context.Context, offset, limit int) ([]*apiv1.User, error) {
+	if offset < 0 {
+		return []*apiv1.User{}, nil
+	}
+	// LIMIT NULL is no limit
+	var limitArg *int
+	if limit >= 0 {
+		limitArg = &limit
+	}
+	rows, err := r.pool.Query(ctx,
+		`SELECT data FROM users ORDER BY create_time, length(name), name OFFSET $1 LIMIT $2`,
+		offset, limitArg)
+	if err != nil {
+		return nil, fmt.Errorf("repository: list: %w", err)
+	}
+	users, err := collectUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("repository: list: %w", err)
+	}
+	return users, nil
+}
+
+// Find returns the users q selects, filtered and sorted by the database.
+// Creation order seeks in the creation time index.
+func (r *PostgresRepository) Find(ctx context.Context, q Query) ([]*apiv1.User, error) {
+	clauses, args := findSQL(postgresFilter, q)
+	// LIMIT NULL is no limit
+	var limitArg *int
+	if q.Limit >= 0 {
+		limitArg = &q.Limit
+	}
+	args = append(args, limitArg)
+	rows, err := r.pool.Query(ctx, `SELECT data FROM users`+clauses+` LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("repository: find: %w", err)
+	}
+	users, err := collectUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("repository: find: %w", err)
+	}
+	return users, nil
+}
+
+// Count returns the number of users. PostgreSQL counts by scanning, so
+// callers listing large tables should skip the total size.
+func (r *PostgresRepository) Count(ctx context.Context) (int, error) {
+	return r.CountMatching(ctx, nil)
+}
+
+// CountMatching returns the number of users f matches, counted by scanning
+// like Count
+func (r *PostgresRepository) CountMatching(ctx context.Context, f filter.Expr) (int, error) {
+	where, args := filter.SQL(f, postgresFilter, nil)
+	var total int
+	if err := r.pool.QueryRow(ctx, `SELECT count(*) FROM users WHERE `+where, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("repository: count: %w", err)
+	}
+	return total, nil
+}
+
+// Update replaces an existing user last updated at lastUpdate, checked in
+// the same statement. Times are stored in microseconds.
+func (r *PostgresRepository) Update(ctx context.Context, user *apiv1.User, lastUpdate *timestamppb.Timestamp) (*apiv1.User, error) {
+	data, err := proto.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("repository: marshal %s: %w", user.GetName(), err)
+	}
+	err = r.write(ctx, func(q pgQuerier) error {
+		tag, err := q.Exec(ctx,
+			`UPDATE users SET create_time = $2, email = $3, display_name = $4, is_active = $5, update_time = $6, delete_time = $7, data = $8 WHERE name = $1 AND update_time = $9`,
+			user.GetName(), user.GetCreateTime().AsTime(), user.GetEmail(), user.GetDisplayName(),
+			user.GetIsActive(), user.GetUpdateTime().AsTime(), user.GetDeleteTime().AsTime(), data,
+			lastUpdate.AsTime())
+		if dup := pgDuplicate(err); dup != nil {
+			return dup
+		}
+		if err != nil {
+			return fmt.Errorf("repository: update %s: %w", user.GetName(), err)
+		}
+		if tag.RowsAffected() == 0 {
+			var found int
+			err := q.QueryRow(ctx, `SELECT 1 FROM users WHERE name = $1`, user.GetName()).Scan(&found)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			if err != nil {
+				return fmt.Errorf("repository: update %s: %w", user.GetName(), err)
+			}
+			return ErrConflict
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(user).(*apiv1.User), nil
+}
+
+// Delete removes a user
+func (r *PostgresRepository) Delete(ctx context.Context, name string) error {
+	return r.write(ctx, func(q pgQuerier) error {
+		tag, err := q.Exec(ctx, `DELETE FROM users WHERE name = $1`, name)
+		if err != nil {
+			return fmt.Errorf("repository: delete %s: %w", name, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// BatchGet returns the existing users among names, in one query
+func (r *PostgresRepository) BatchGet(ctx context.Context, names []string) ([]*apiv1.User, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	rows, err := r.pool.Query(ctx, `SELECT data FROM users WHERE name = ANY($1)`, names)
+	if err != nil {
+		return nil, fmt.Errorf("repository: batch get: %w", err)
+	}
+	found, err := collectUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("repository: batch get: %w", err)
+	}
+
+	byName := make(map[string]*apiv1.User, len(found))
+	for _, user := range found {
+		byName[user.GetName()] = user
+	}
+	var users []*apiv1.User
+	for _, name := range names {
+		if user, exists := byName[name]; exists {
+			users = append(users, proto.Clone(user).(*apiv1.User))
+		}
+	}
+	return users, nil
+}
+
+// write runs fn on the pool or, when ctx carries outbox messages, in a
+// transaction adding them after fn succeeds
+func (r *PostgresRepository) write(ctx context.Context, fn func(q pgQuerier) error) error {
+	msgs := outbox.Messages(ctx)
+	if len(msgs) == 0 {
+		return fn(r.pool)
+	}
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if err := addPostgresMessage(ctx, tx, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// IndexVersion returns the IndexVersion recorded by the last Reindex
+func (r *PostgresRepository) IndexVersion(ctx context.Context) (int, error) {
+	var version int
+	err := r.pool.QueryRow(ctx, `SELECT version FROM schema_versions WHERE name = $1`, usersIndex).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("repository: index version: %w", err)
+	}
+	return version, nil
+}
+
+// Reindex rewrites the filter columns of every user from its data, in
+// batches in name order. A row is only rewritten while its data is the
+// one read, so a user written meanwhile keeps the columns of the write.
+func (r *PostgresRepository) Reindex(ctx context.Context, progress func(done, total int)) error {
+	total, err := r.Count(ctx)
+	if err != nil {
+		return fmt.Errorf("repository: reindex: %w", err)
+	}
+	done, after := 0, ""
+	for {
+		rows, err := r.pool.Query(ctx, `SELECT data FROM users WHERE name > $1 ORDER BY name LIMIT $2`, after, reindexBatch)
+		if err != nil {
+			return fmt.Errorf("repository: reindex: %w", err)
+		}
+		batch, err := pgx.CollectRows(rows, pgx.RowTo[[]byte])
+		if err != nil {
+			return fmt.Errorf("repository: reindex: %w", err)
+		}
+
+		for _, data := range batch {
+			user, err := unmarshalUser(data)
+			if err != nil {
+				return fmt.Errorf("repository: reindex: %w", err)
+			}
+			_, err = r.pool.Exec(ctx,
+				`UPDATE users SET create_time = $1, email = $2, display_name = $3, is_active = $4, update_time = $5, delete_time = $6 WHERE name = $7 AND data = $8`,
+				user.GetCreateTime().AsTime(), user.GetEmail(), user.GetDisplayName(), user.GetIsActive(),
+				user.GetUpdateTime().AsTime(), user.GetDeleteTime().AsTime(), user.GetName(), data)
+			if err != nil {
+				return fmt.Errorf("repository: reindex %s: %w", user.GetName(), err)
+			}
+			after = user.GetName()
+		}
+		done += len(batch)
+		progress(done, max(total, done))
+		if len(batch) < reindexBatch {
+			break
+		}
+	}
+
+	err = pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM schema_versions WHERE name = $1`, usersIndex); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO schema_versions (name, version) VALUES ($1, $2)`, usersIndex, IndexVersion)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("repository: record index version: %w", err)
+	}
+	return nil
+}
+
+// Outbox returns the outbox table the writes add their messages to
+func (r *PostgresRepository) Outbox() outbox.Store {
+	return &postgresOutbox{pool: r.pool}
+}
+
+// postgresOutbox is the outbox table of a PostgresRepository
+type postgresOutbox struct {
+	pool *pgxpool.Pool
+}
+
+func addPostgresMessage(ctx context.Context, q pgQuerier, msg *outbox.Message) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO outbox (id, topic, msg_key, payload, create_time) VALUES ($1, $2, $3, $4, $5)`,
+		msg.ID, msg.Topic, msg.Key, msg.Payload, msg.CreateTime)
+	if err != nil {
+		return fmt.Errorf("repository: add outbox message %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// Add records a new undelivered message
+func (o *postgresOutbox) Add(ctx context.Context, msg *outbox.Message) error {
+	return addPostgresMessage(ctx, o.pool, msg)
+}
+
+// Pending returns up to limit undelivered messages, oldest first
+func (o *postgresOutbox) Pending(ctx context.Context, limit int) ([]*outbox.Message, error) {
+	rows, err := o.pool.Query(ctx,
+		`SELECT id, topic, msg_key, payload, create_time, attempts, last_error FROM outbox
+		WHERE deliver_time IS NULL ORDER BY create_time, id LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository: pending outbox messages: %w", err)
+	}
+	msgs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*outbox.Message, error) {
+		msg := &outbox.Message{}
+		err := row.Scan(&msg.ID, &msg.Topic, &msg.Key, &msg.Payload, &msg.CreateTime, &msg.Attempts, &msg.LastError)
+		return msg, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("repository: pending outbox messages: %w", err)
+	}
+	return msgs, nil
+}
+
+// MarkDelivered records that the message was published at t
+func (o *postgresOutbox) MarkDelivered(ctx context.Context, id string, t time.Time) error {
+	return o.mark(ctx, id, `UPDATE outbox SET deliver_time = $2 WHERE id = $1`, id, t)
+}
+
+// MarkFailed records a failed publish attempt
+func (o *postgresOutbox) MarkFailed(ctx context.Context, id string, err error) error {
+	return o.mark(ctx, id, `UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`, id, err.Error())
+}
+
+func (o *postgresOutbox) mark(ctx context.Context, id, query string, args ...any) error {
+	tag, err := o.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("repository: mark outbox message %s: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return outbox.ErrNotFound
+	}
+	return nil
+}
+
+// Purge deletes the messages delivered before cutoff, or with dryRun only
+// counts them
+func (o *postgresOutbox) Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	if dryRun {
+		var n int
+		err := o.pool.QueryRow(ctx, `SELECT count(*) FROM outbox WHERE deliver_time < $1`, cutoff).Scan(&n)
+		if err != nil {
+			return 0, fmt.Errorf("repository: count delivered outbox messages: %w", err)
+		}
+		return n, nil
+	}
+	tag, err := o.pool.Exec(ctx, `DELETE FROM outbox WHERE deliver_time < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("repository: purge outbox: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// collectUsers unmarshals the data column of every row
+func collectUsers(rows pgx.Rows) ([]*apiv1.User, error) {
+	users := []*apiv1.User{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		user, err := unmarshalUser(data)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func unmarshalUser(data []byte) (*apiv1.User, error) {
+	user := &apiv1.User{}
+	if err := proto.Unmarshal(data, user); err != nil {
+		return nil, fmt.Errorf("repository: unmarshal user: %w", err)
+	}
+	return user, nil
+}
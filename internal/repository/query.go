@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+)
+
+// UserFields are the user fields filters and orderings may name. Every
+// implementation can filter and sort on them, the SQL ones on columns of
+// their own beside the stored user.
+var UserFields = filter.Schema{
+	"name":         filter.String,
+	"email":        filter.String,
+	"display_name": filter.String,
+	"is_active":    filter.Bool,
+	"create_time":  filter.Timestamp,
+	"update_time":  filter.Timestamp,
+	"delete_time":  filter.Timestamp,
+}
+
+// NotDeleted matches the users that are not soft deleted, whose
+// delete_time is unset and so reads as the Unix epoch
+var NotDeleted filter.Expr = &filter.Compare{Field: "delete_time", Op: filter.Equal, Value: time.Unix(0, 0).UTC()}
+
+// DeletedBefore matches the users soft deleted before t
+func DeletedBefore(t time.Time) filter.Expr {
+	return &filter.And{Exprs: []filter.Expr{
+		&filter.Not{Expr: NotDeleted},
+		&filter.Compare{Field: "delete_time", Op: filter.Less, Value: t},
+	}}
+}
+
+// Query selects and orders the users Find returns
+type Query struct {
+	// Filter keeps the users it matches, every user when nil. It must
+	// only name UserFields.
+	Filter filter.Expr
+
+	// OrderBy sorts the users, then creation time and name break ties.
+	// Users are in creation order when it is empty.
+	OrderBy []filter.Order
+
+	// After, when set, starts right after this user in the order, which
+	// need not exist anymore. Only its name and the fields of the order
+	// are read, so it may be a partial copy, as page tokens hold.
+	After *apiv1.User
+
+	// Limit caps the number of users, none when negative
+	Limit int
+}
+
+// orderKeys returns orderBy completed with the tie breakers creation time
+// and name, which make the order total
+func orderKeys(orderBy []filter.Order) []filter.Order {
+	keys := slices.Clone(orderBy)
+	for _, field := range []string{"create_time", "name"} {
+		if !slices.ContainsFunc(keys, func(o filter.Order) bool { return o.Field == field }) {
+			keys = append(keys, filter.Order{Field: field})
+		}
+	}
+	return keys
+}
+
+// defaultKeys is the creation order, the one of lessByCreateTime
+var defaultKeys = orderKeys(nil)
+
+// compareUsers orders a and b by keys. Names compare by length first, so
+// numeric IDs sort by value.
+func compareUsers(keys []filter.Order, a, b *apiv1.User) int {
+	for _, key := range keys {
+		var c int
+		if key.Field == "name" {
+			c = compareNames(a.GetName(), b.GetName())
+		} else {
+			c = filter.CompareValues(filter.Value(a, key.Field), filter.Value(b, key.Field))
+		}
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareNames(a, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// sqlKey is a column of an SQL ordering
+type sqlKey struct {
+	column string
+	desc   bool
+	value  func(user *apiv1.User) any
+}
+
+// sqlKeys returns the columns ordering by keys in d. A name sorts on its
+// length, then itself.
+func sqlKeys(d filter.SQLDialect, keys []filter.Order) []sqlKey {
+	var cols []sqlKey
+	for _, key := range keys {
+		if key.Field == "name" {
+			cols = append(cols,
+				sqlKey{column: "length(name)", desc: key.Desc, value: func(u *apiv1.User) any { return int64(len(u.GetName())) }},
+				sqlKey{column: "name", desc: key.Desc, value: func(u *apiv1.User) any { return u.GetName() }})
+			continue
+		}
+		field := key.Field
+		cols = append(cols, sqlKey{column: d.Column(field), desc: key.Desc, value: func(u *apiv1.User) any {
+			v := filter.Value(u, field)
+			if d.Value != nil {
+				v = d.Value(field, v)
+			}
+			return v
+		}})
+	}
+	return cols
+}
+
+// findSQL returns the WHERE and ORDER BY clauses of q in d, with their
+// arguments. The rows after q.After are selected by comparing the order
+// columns one by one, which works whatever their directions.
+func findSQL(d filter.SQLDialect, q Query) (string, []any) {
+	where, args := filter.SQL(q.Filter, d, nil)
+	cols := sqlKeys(d, orderKeys(q.OrderBy))
+
+	var b strings.Builder
+	b.WriteString(" WHERE " + where)
+	if q.After != nil {
+		b.WriteString(" AND (")
+		for i, col := range cols {
+			if i > 0 {
+				b.WriteString(" OR ")
+			}
+			b.WriteString("(")
+			for _, prev := range cols[:i] {
+				args = append(args, prev.value(q.After))
+				b.WriteString(prev.column + " = " + d.Placeholder(len(args)) + " AND ")
+			}
+			op := " > "
+			if col.desc {
+				op = " < "
+			}
+			args = append(args, col.value(q.After))
+			b.WriteString(col.column + op + d.Placeholder(len(args)) + ")")
+		}
+		b.WriteString(")")
+	}
+
+	b.WriteString(" ORDER BY ")
+	for i, col := range cols {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(col.column)
+		if col.desc {
+			b.WriteString(" DESC")
+		}
+	}
+	return b.String(), args
+}
+
+// userColumn returns the column holding field. The SQL users tables name
+// their columns after UserFields.
+func userColumn(field string) string {
+	return field
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// runFindSuite checks that repo filters, orders and pages users the way
+// MemoryRepository does
+func runFindSuite(t *testing.T, repo UserRepository) {
+	t.Helper()
+	ctx := context.Background()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, u := range []struct {
+		name, email, displayName string
+		active                   bool
+		created                  time.Duration
+	}{
+		{"users/1", "ada@example.com", "Ada", true, 0},
+		{"users/2", "bob@example.com", "Bob", false, time.Second},
+		{"users/3", "carol@test.org", "Carol", true, time.Second},
+		{"users/10", "dave@EXAMPLE.com", "Ada", true, 2 * time.Second},
+	} {
+		user := &apiv1.User{
+			Name:        u.name,
+			Email:       u.email,
+			DisplayName: u.displayName,
+			IsActive:    u.active,
+			CreateTime:  timestamppb.New(base.Add(u.created)),
+			UpdateTime:  timestamppb.New(base.Add(u.created)),
+		}
+		if _, err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create(%s) unexpected error: %v", u.name, err)
+		}
+	}
+
+	names := func(users []*apiv1.User) string {
+		var names []string
+		for _, u := range users {
+			names = append(names, u.GetName())
+		}
+		return fmt.Sprint(names)
+	}
+	tests := []struct {
+		filter, orderBy string
+		want            string
+	}{
+		{"", "", "[users/1 users/2 users/3 users/10]"},
+		{`email : "example.com"`, "", "[users/1 users/2 users/10]"},
+		{"is_active = true AND NOT display_name = Ada", "", "[users/3]"},
+		{"create_time > 2025-01-01T00:00:00Z OR email = ada@example.com", "", "[users/1 users/2 users/3 users/10]"},
+		{"update_time >= 2025-01-01T00:00:01Z", "name desc", "[users/10 users/3 users/2]"},
+		{"", "display_name desc", "[users/3 users/2 users/1 users/10]"},
+		{"", "is_active, create_time desc", "[users/2 users/10 users/3 users/1]"},
+	}
+	for _, tt := range tests {
+		expr, err := filter.Parse(tt.filter, UserFields)
+		if err != nil {
+			t.Fatalf("Parse(%q) unexpected error: %v", tt.filter, err)
+		}
+		orderBy, err := filter.ParseOrder(tt.orderBy, UserFields)
+		if err != nil {
+			t.Fatalf("ParseOrder(%q) unexpected error: %v", tt.orderBy, err)
+		}
+
+		users, err := repo.Find(ctx, Query{Filter: expr, OrderBy: orderBy, Limit: -1})
+		if got := names(users); err != nil || got != tt.want {
+			t.Errorf("Find(filter=%q, order_by=%q) = %s, %v, want %s", tt.filter, tt.orderBy, got, err, tt.want)
+		}
+
+		// Pages of one user continue after the previous one
+		var paged []*apiv1.User
+		q := Query{Filter: expr, OrderBy: orderBy, Limit: 1}
+		for {
+			page, err := repo.Find(ctx, q)
+			if err != nil {
+				t.Fatalf("Find() page unexpected error: %v", err)
+			}
+			if len(page) == 0 || len(paged) > 4 {
+				break
+			}
+			paged = append(paged, page...)
+			q.After = page[0]
+		}
+		if got := names(paged); got != tt.want {
+			t.Errorf("Find(filter=%q, order_by=%q) paged = %s, want %s", tt.filter, tt.orderBy, got, tt.want)
+		}
+
+		if n, err := repo.CountMatching(ctx, expr); err != nil || n != len(users) {
+			t.Errorf("CountMatching(%q) = %d, %v, want %d", tt.filter, n, err, len(users))
+		}
+	}
+
+	// Soft deleted users are told apart by their delete time
+	deleted, _ := repo.Get(ctx, "users/2")
+	deleted.State = apiv1.User_DELETED
+	deleted.DeleteTime = timestamppb.New(base.Add(time.Hour))
+	if _, err := repo.Update(ctx, deleted, deleted.GetUpdateTime()); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		name   string
+		filter filter.Expr
+		want   string
+	}{
+		{"NotDeleted", NotDeleted, "[users/1 users/3 users/10]"},
+		{"DeletedBefore(later)", DeletedBefore(base.Add(2 * time.Hour)), "[users/2]"},
+		{"DeletedBefore(at deletion)", DeletedBefore(base.Add(time.Hour)), "[]"},
+	} {
+		users, err := repo.Find(ctx, Query{Filter: tt.filter, Limit: -1})
+		if got := names(users); err != nil || got != tt.want {
+			t.Errorf("Find(%s) = %s, %v, want %s", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestMemoryRepositoryFind(t *testing.T) {
+	runFindSuite(t, NewMemoryRepository())
+}
@@ -0,0 +1,117 @@
+// Package repository defines the storage abstraction used by the services.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Errors returned by UserRepository implementations
+var (
+	// ErrNotFound is returned when the requested user does not exist
+	ErrNotFound = errors.New("repository: not found")
+
+	// ErrAlreadyExists is returned when creating a user whose name is taken
+	ErrAlreadyExists = errors.New("repository: already exists")
+
+	// ErrEmailTaken is returned when storing a user with the email of
+	// another one. It matches ErrAlreadyExists too.
+	ErrEmailTaken = fmt.Errorf("%w: email taken", ErrAlreadyExists)
+
+	// ErrConflict is returned when a write conflicts with a concurrent change
+	ErrConflict = errors.New("repository: conflict")
+
+	// ErrInvalid is returned when a restore is given users that cannot be
+	// stored together
+	ErrInvalid = errors.New("repository: invalid data")
+)
+
+// UserRepository stores user resources keyed by resource name. Emails are
+// unique too, as stored, but any number of users may have none. Soft
+// deleted users keep theirs until they are deleted for good.
+type UserRepository interface {
+	// Create stores a new user. The user's name must already be set. It
+	// returns ErrEmailTaken if another user has its email.
+	Create(ctx context.Context, user *apiv1.User) (*apiv1.User, error)
+
+	// Get returns the user with the given resource name
+	Get(ctx context.Context, name string) (*apiv1.User, error)
+
+	// GetByEmail returns the user with email, soft deleted or not, looked
+	// up in the email index. No user is found by an empty email.
+	GetByEmail(ctx context.Context, email string) (*apiv1.User, error)
+
+	// List returns up to limit users starting at offset, ordered by creation
+	// time
+	List(ctx context.Context, offset, limit int) ([]*apiv1.User, error)
+
+	// Find returns the users q selects, in its order. Unlike offsets, its
+	// After keeps its place while users are created and deleted.
+	Find(ctx context.Context, q Query) ([]*apiv1.User, error)
+
+	// Count returns the number of users. Implementations should keep it up
+	// to date on writes rather than scan, callers still treat it as costly.
+	Count(ctx context.Context) (int, error)
+
+	// CountMatching returns the number of users f matches, all of them
+	// when f is nil
+	CountMatching(ctx context.Context, f filter.Expr) (int, error)
+
+	// Update replaces the stored user with the same name if its update
+	// time is still lastUpdate, that of the user the change was made to.
+	// It returns ErrConflict if the user was updated since, and
+	// ErrEmailTaken if the new email is another user's.
+	Update(ctx context.Context, user *apiv1.User, lastUpdate *timestamppb.Timestamp) (*apiv1.User, error)
+
+	// Delete removes the user with the given resource name
+	Delete(ctx context.Context, name string) error
+
+	// BatchGet returns the users that exist among names, in request order
+	BatchGet(ctx context.Context, names []string) ([]*apiv1.User, error)
+}
+
+// IndexVersion is the version of the filter columns and indexes users are
+// stored with. Bump it when what they hold of a user changes; servers
+// reindex the stored users when they start.
+const IndexVersion = 1
+
+// reindexBatch is the number of users reindexed at a time
+const reindexBatch = 500
+
+// usersIndex names the IndexVersion of the users in the schema_versions
+// table of the SQL repositories
+const usersIndex = "users_index"
+
+// Reindexer is implemented by repositories whose filter columns and
+// indexes can be rebuilt from the stored users, such as the SQL ones.
+// Implementations that cannot, e.g. because they wrap one that cannot,
+// return an error matching errors.ErrUnsupported.
+type Reindexer interface {
+	// IndexVersion returns the IndexVersion the stored users were last
+	// reindexed with, 0 if they never were
+	IndexVersion(ctx context.Context) (int, error)
+
+	// Reindex rebuilds the indexes of every user, calling progress with
+	// the number of users done and the total as it goes, then records
+	// IndexVersion. Users written meanwhile keep the indexes of the write.
+	Reindex(ctx context.Context, progress func(done, total int)) error
+}
+
+// Snapshotter is implemented by repositories whose complete state can be
+// dumped and restored into another instance, such as MemoryRepository.
+// Implementations that cannot, e.g. because they wrap one that cannot,
+// return an error matching errors.ErrUnsupported.
+type Snapshotter interface {
+	// Snapshot returns every user as of one moment, ordered by creation
+	// time
+	Snapshot(ctx context.Context) ([]*apiv1.User, error)
+
+	// Restore replaces every user with users at once. Names must be set and
+	// unique, and so must emails that are set.
+	Restore(ctx context.Context, users []*apiv1.User) error
+}
@@ -0,0 +1,245 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// runUniqueEmailSuite checks that repo keeps emails unique the way
+// MemoryRepository does
+func runUniqueEmailSuite(t *testing.T, repo UserRepository) {
+	t.Helper()
+	ctx := context.Background()
+
+	ada, err := repo.Create(ctx, &apiv1.User{Name: "users/1", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("Create() unexpected error: %v", err)
+	}
+	if _, err := repo.Create(ctx, &apiv1.User{Name: "users/2", Email: "ada@example.com"}); !errors.Is(err, ErrEmailTaken) || !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Create() with a taken email error = %v, want %v", err, ErrEmailTaken)
+	}
+	if _, err := repo.Create(ctx, &apiv1.User{Name: "users/2", Email: "Ada@example.com"}); err != nil {
+		t.Errorf("Create() with another case unexpected error: %v", err)
+	}
+
+	// Users without an email are not in each other's way
+	for _, name := range []string{"users/3", "users/4"} {
+		if _, err := repo.Create(ctx, &apiv1.User{Name: name}); err != nil {
+			t.Errorf("Create(%s) without an email unexpected error: %v", name, err)
+		}
+	}
+
+	// Users are found by their email as stored, never by an empty one
+	if got, err := repo.GetByEmail(ctx, "ada@example.com"); err != nil || got.GetName() != "users/1" {
+		t.Errorf("GetByEmail() = %v, %v, want users/1", got, err)
+	}
+	for _, email := range []string{"ADA@example.com", "nobody@example.com", ""} {
+		if _, err := repo.GetByEmail(ctx, email); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetByEmail(%q) error = %v, want %v", email, err, ErrNotFound)
+		}
+	}
+
+	// A user keeps its own email on update, but cannot take another's
+	if _, err := repo.Update(ctx, ada, nil); err != nil {
+		t.Errorf("Update() keeping the email unexpected error: %v", err)
+	}
+	if _, err := repo.Update(ctx, &apiv1.User{Name: "users/3", Email: "ada@example.com"}, nil); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Update() to a taken email error = %v, want %v", err, ErrEmailTaken)
+	}
+
+	// Emails are released by changing or deleting their user
+	ada.Email = "ada@example.org"
+	if _, err := repo.Update(ctx, ada, nil); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	if _, err := repo.Update(ctx, &apiv1.User{Name: "users/3", Email: "ada@example.com"}, nil); err != nil {
+		t.Errorf("Update() to a released email unexpected error: %v", err)
+	}
+	if got, err := repo.GetByEmail(ctx, "ada@example.com"); err != nil || got.GetName() != "users/3" {
+		t.Errorf("GetByEmail() of a changed email = %v, %v, want users/3", got, err)
+	}
+	if err := repo.Delete(ctx, "users/1"); err != nil {
+		t.Fatalf("Delete() unexpected error: %v", err)
+	}
+	if _, err := repo.Create(ctx, &apiv1.User{Name: "users/5", Email: "ada@example.org"}); err != nil {
+		t.Errorf("Create() with the email of a deleted user unexpected error: %v", err)
+	}
+
+	// Of concurrent creates with the same email, exactly one succeeds
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.Create(ctx, &apiv1.User{Name: fmt.Sprintf("users/race-%d", i), Email: "race@example.com"})
+			if err != nil && !errors.Is(err, ErrEmailTaken) {
+				t.Errorf("Create() racing unexpected error: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				created++
+			}
+		}()
+	}
+	wg.Wait()
+	if created != 1 {
+		t.Errorf("concurrent Create() with one email created %d users, want 1", created)
+	}
+}
+
+// runUpdateConflictSuite checks that repo refuses a change made to a user
+// that was updated since it was read, the way MemoryRepository does
+func runUpdateConflictSuite(t *testing.T, repo UserRepository) {
+	t.Helper()
+	ctx := context.Background()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 1, time.UTC)
+	read, err := repo.Create(ctx, &apiv1.User{Name: "users/1", Email: "ada@example.com", CreateTime: timestamppb.New(base), UpdateTime: timestamppb.New(base)})
+	if err != nil {
+		t.Fatalf("Create() unexpected error: %v", err)
+	}
+
+	// Of two changes made to the same read, the first is stored and the
+	// second conflicts, so a soft delete is not undone
+	deleted := proto.Clone(read).(*apiv1.User)
+	deleted.State = apiv1.User_DELETED
+	deleted.DeleteTime = timestamppb.New(base.Add(time.Second))
+	deleted.UpdateTime = deleted.DeleteTime
+	if _, err := repo.Update(ctx, deleted, read.GetUpdateTime()); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	renamed := proto.Clone(read).(*apiv1.User)
+	renamed.DisplayName = "Ada"
+	renamed.UpdateTime = timestamppb.New(base.Add(2 * time.Second))
+	if _, err := repo.Update(ctx, renamed, read.GetUpdateTime()); !errors.Is(err, ErrConflict) {
+		t.Errorf("Update() of a stale read error = %v, want %v", err, ErrConflict)
+	}
+	if got, err := repo.Get(ctx, "users/1"); err != nil || got.GetState() != apiv1.User_DELETED || got.GetDisplayName() != "" {
+		t.Errorf("Get() after a conflict = %v, %v, want the soft deleted user", got, err)
+	}
+
+	// Made to the stored user, the change is stored, and storing the same
+	// user again is not mistaken for a conflict
+	renamed.State, renamed.DeleteTime = deleted.State, deleted.DeleteTime
+	if _, err := repo.Update(ctx, renamed, deleted.GetUpdateTime()); err != nil {
+		t.Errorf("Update() of the stored user unexpected error: %v", err)
+	}
+	if _, err := repo.Update(ctx, renamed, renamed.GetUpdateTime()); err != nil {
+		t.Errorf("Update() unchanged unexpected error: %v", err)
+	}
+	if _, err := repo.Update(ctx, &apiv1.User{Name: "users/2"}, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update() missing error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestMemoryRepositoryUpdateConflict(t *testing.T) {
+	runUpdateConflictSuite(t, NewMemoryRepository())
+}
+
+func TestMemoryRepositoryUniqueEmails(t *testing.T) {
+	runUniqueEmailSuite(t, NewMemoryRepository())
+
+	repo := NewMemoryRepository()
+	err := repo.Restore(context.Background(), []*apiv1.User{
+		{Name: "users/1", Email: "ada@example.com"},
+		{Name: "users/2"},
+		{Name: "users/3"},
+		{Name: "users/4", Email: "ada@example.com"},
+	})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Restore() with a shared email error = %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestMemoryRepositoryReindex(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	for i := range 3 {
+		if _, err := repo.Create(ctx, &apiv1.User{Name: fmt.Sprintf("users/%d", i), Email: fmt.Sprintf("u%d@example.com", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Indexes that disagree with the users
+	repo.emails, repo.ordered, repo.live = map[string]string{}, nil, 0
+
+	var done, total int
+	if err := repo.Reindex(ctx, func(d, n int) { done, total = d, n }); err != nil {
+		t.Fatalf("Reindex() unexpected error: %v", err)
+	}
+	if done != 3 || total != 3 {
+		t.Errorf("Reindex() last progress = %d of %d, want 3 of 3", done, total)
+	}
+	if user, err := repo.GetByEmail(ctx, "u1@example.com"); err != nil || user.GetName() != "users/1" {
+		t.Errorf("GetByEmail() after Reindex = %v, %v, want users/1", user, err)
+	}
+	if users, _ := repo.List(ctx, 0, 10); len(users) != 3 || users[0].GetName() != "users/0" {
+		t.Errorf("List() after Reindex = %v, want the 3 users in order", users)
+	}
+	if n, _ := repo.CountMatching(ctx, NotDeleted); n != 3 {
+		t.Errorf("CountMatching(NotDeleted) after Reindex = %d, want 3", n)
+	}
+	if v, _ := repo.IndexVersion(ctx); v != IndexVersion {
+		t.Errorf("IndexVersion() = %d, want %d", v, IndexVersion)
+	}
+}
+
+func TestMemoryRepositoryCountNotDeleted(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	// A copy of NotDeleted is not the tracked filter, so it is counted by
+	// checking every user, which the tracked count must agree with
+	scanned := &filter.And{Exprs: []filter.Expr{NotDeleted}}
+	check := func(step string, want int) {
+		t.Helper()
+		got, err := repo.CountMatching(ctx, NotDeleted)
+		if err != nil || got != want {
+			t.Errorf("after %s CountMatching(NotDeleted) = %d, %v, want %d", step, got, err, want)
+		}
+		if n, _ := repo.CountMatching(ctx, scanned); n != got {
+			t.Errorf("after %s tracked count = %d, but %d users match", step, got, n)
+		}
+	}
+
+	for i := range 3 {
+		if _, err := repo.Create(ctx, &apiv1.User{Name: fmt.Sprintf("users/%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("Create", 3)
+
+	deleted := &apiv1.User{Name: "users/0", DeleteTime: timestamppb.New(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))}
+	if _, err := repo.Update(ctx, deleted, nil); err != nil {
+		t.Fatal(err)
+	}
+	check("a soft delete", 2)
+	if _, err := repo.Update(ctx, deleted, nil); err != nil {
+		t.Fatal(err)
+	}
+	check("updating a soft deleted user", 2)
+	if _, err := repo.Update(ctx, &apiv1.User{Name: "users/0"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	check("an undelete", 3)
+
+	if err := repo.Delete(ctx, "users/1"); err != nil {
+		t.Fatal(err)
+	}
+	check("Delete", 2)
+
+	if err := repo.Restore(ctx, []*apiv1.User{{Name: "users/5"}, deleted}); err != nil {
+		t.Fatal(err)
+	}
+	check("Restore", 1)
+}
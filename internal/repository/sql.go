@@ -0,0 +1,712 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"github.com/go-sql-driver/mysql"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// sqlDialect is what differs between the databases SQLRepository supports.
+// Both store users as protobuf beside the columns queries filter and sort
+// on, like PostgresRepository, with times in Unix nanoseconds.
+type sqlDialect struct {
+	// driver is the database/sql driver name
+	driver string
+
+	// schema creates the users, outbox and schema_versions tables if they
+	// do not exist, one statement at a time
+	schema []string
+
+	// columns adds the filter columns to a users table created before
+	// they existed, in the order they were introduced
+	columns []sqlColumns
+
+	// indexes creates the indexes on the filter columns if they do not
+	// exist, once the columns do
+	indexes []string
+
+	// uniqueEmail makes emails unique once the filter columns are
+	// backfilled. Its stmts run every time when probe is empty.
+	uniqueEmail sqlColumns
+
+	// byEmail selects the data of the user with an email, which is not
+	// empty, through the unique email index
+	byEmail string
+
+	// duplicate returns ErrAlreadyExists for a primary key violation,
+	// ErrEmailTaken for one of the email index and nil for other errors
+	duplicate func(err error) error
+
+	// maxConns, when set, caps the open connections whatever the
+	// configuration says
+	maxConns int
+}
+
+// sqlColumns adds filter columns to an existing users table
+type sqlColumns struct {
+	// probe is a column stmts add, missing until they ran
+	probe string
+	stmts []string
+}
+
+// mysqlDialect serves MySQL 5.7 and later
+var mysqlDialect = sqlDialect{
+	driver: "mysql",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			name         VARCHAR(255) NOT NULL PRIMARY KEY,
+			create_time  BIGINT NOT NULL,
+			email        VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NULL,
+			display_name VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NULL,
+			is_active    BOOLEAN NULL,
+			update_time  BIGINT NULL,
+			delete_time  BIGINT NOT NULL DEFAULT 0,
+			data         LONGBLOB NOT NULL,
+			INDEX users_create_time_idx (create_time, name),
+			INDEX users_email_idx (email),
+			INDEX users_delete_time_idx (delete_time)
+		)`,
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id           VARCHAR(255) NOT NULL PRIMARY KEY,
+			topic        VARCHAR(255) NOT NULL,
+			msg_key      VARCHAR(255) NOT NULL,
+			payload      LONGBLOB NOT NULL,
+			create_time  BIGINT NOT NULL,
+			deliver_time BIGINT NULL,
+			attempts     INT NOT NULL,
+			last_error   TEXT NOT NULL,
+			INDEX outbox_pending_idx (deliver_time, create_time, id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS schema_versions (
+			name    VARCHAR(255) NOT NULL PRIMARY KEY,
+			version INT NOT NULL
+		)`,
+	},
+	columns: []sqlColumns{
+		{probe: "email", stmts: []string{
+			`ALTER TABLE users
+				ADD COLUMN email VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NULL,
+				ADD COLUMN display_name VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NULL,
+				ADD COLUMN is_active BOOLEAN NULL,
+				ADD COLUMN update_time BIGINT NULL,
+				ADD INDEX users_email_idx (email)`,
+		}},
+		{probe: "delete_time", stmts: []string{
+			`ALTER TABLE users
+				ADD COLUMN delete_time BIGINT NOT NULL DEFAULT 0,
+				ADD INDEX users_delete_time_idx (delete_time)`,
+		}},
+	},
+	// MySQL has no partial indexes, so the unique index is on a column
+	// that is NULL rather than empty
+	uniqueEmail: sqlColumns{probe: "email_key", stmts: []string{
+		`ALTER TABLE users
+			ADD COLUMN email_key VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin AS (NULLIF(email, '')) STORED,
+			ADD UNIQUE INDEX users_email_key (email_key)`,
+	}},
+	byEmail: `SELECT data FROM users WHERE email_key = ?`,
+	duplicate: func(err error) error {
+		var mysqlErr *mysql.MySQLError
+		switch {
+		case !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062: // ER_DUP_ENTRY
+			return nil
+		case strings.Contains(mysqlErr.Message, "users_email_key"):
+			return ErrEmailTaken
+		default:
+			return ErrAlreadyExists
+		}
+	},
+}
+
+func init() {
+	RegisterDriver("mysql", openSQL(mysqlDialect))
+}
+
+// openSQL returns the Driver opening d's databases at cfg.DSN
+func openSQL(d sqlDialect) Driver {
+	return func(ctx context.Context, cfg config.StorageConfig) (UserRepository, func() error, error) {
+		db, err := sql.Open(d.driver, cfg.DSN)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case d.maxConns > 0:
+			db.SetMaxOpenConns(d.maxConns)
+		case cfg.MaxConns > 0:
+			db.SetMaxOpenConns(cfg.MaxConns)
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, connectTimeout(cfg))
+		defer cancel()
+		if err := db.PingContext(pingCtx); err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		repo, err := newSQLRepository(ctx, db, d)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return repo, db.Close, nil
+	}
+}
+
+// SQLRepository is a UserRepository stored in SQLite or MySQL through
+// database/sql. SQLite needs a cgo build. Its outbox is a table beside the
+// users.
+type SQLRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// sqlQuerier is what writes need of a *sql.DB or *sql.Tx
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// NewMySQLRepository creates a SQLRepository over a MySQL database opened
+// with the mysql driver, creating the users and outbox tables if they do
+// not exist. The caller closes db.
+func NewMySQLRepository(ctx context.Context, db *sql.DB) (*SQLRepository, error) {
+	return newSQLRepository(ctx, db, mysqlDialect)
+}
+
+func newSQLRepository(ctx context.Context, db *sql.DB, d sqlDialect) (*SQLRepository, error) {
+	for _, stmt := range d.schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("repository: create schema: %w", err)
+		}
+	}
+	var stmts []string
+	for _, cols := range d.columns {
+		if rows, err := db.QueryContext(ctx, `SELECT `+cols.probe+` FROM users WHERE 1 = 0`); err == nil {
+			rows.Close()
+		} else {
+			stmts = append(stmts, cols.stmts...)
+		}
+	}
+	for _, stmt := range slices.Concat(stmts, d.indexes) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("repository: add filter columns: %w", err)
+		}
+	}
+	r := &SQLRepository{db: db, dialect: d}
+	if err := r.backfill(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.uniqueEmails(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// uniqueEmails creates the unique email index if it does not exist. Users
+// stored before it existed may share emails, which are then reported.
+func (r *SQLRepository) uniqueEmails(ctx context.Context) error {
+	cols := r.dialect.uniqueEmail
+	if cols.probe != "" {
+		if rows, err := r.db.QueryContext(ctx, `SELECT `+cols.probe+` FROM users WHERE 1 = 0`); err == nil {
+			rows.Close()
+			return nil
+		}
+	}
+	for _, stmt := range cols.stmts {
+		if _, err := r.db.ExecContext(ctx, stmt); err != nil {
+			rows, dupErr := r.db.QueryContext(ctx, duplicateEmailsQuery)
+			if dupErr != nil {
+				return fmt.Errorf("repository: unique emails: %w", err)
+			}
+			defer rows.Close()
+			var emails []string
+			for rows.Next() {
+				var email string
+				if err := rows.Scan(&email); err != nil {
+					return fmt.Errorf("repository: unique emails: %w", err)
+				}
+				emails = append(emails, email)
+			}
+			return duplicateEmailsError(emails, err)
+		}
+	}
+	return nil
+}
+
+// duplicateEmailsQuery selects some of the emails several users have, in
+// any of the SQL databases
+const duplicateEmailsQuery = `SELECT email FROM users WHERE email <> '' GROUP BY email HAVING COUNT(*) > 1 ORDER BY email LIMIT 10`
+
+// duplicateEmailsError is the error of a unique email index that could
+// not be created, naming the emails in use twice if it found some
+func duplicateEmailsError(emails []string, err error) error {
+	if len(emails) == 0 {
+		return fmt.Errorf("repository: unique emails: %w", err)
+	}
+	return fmt.Errorf("repository: unique emails: several users have the emails %s, change them before upgrading: %w", strings.Join(emails, ", "), err)
+}
+
+// sqlFilter renders filters on the users tables of SQLRepository
+var sqlFilter = filter.SQLDialect{
+	Placeholder: func(int) string { return "?" },
+	Column:      userColumn,
+	Value: func(field string, v any) any {
+		if t, ok := v.(time.Time); ok {
+			return t.UnixNano()
+		}
+		return v
+	},
+}
+
+// backfill fills the filter columns of the users stored before they
+// existed, which are NULL, from the stored users
+func (r *SQLRepository) backfill(ctx context.Context) error {
+	for {
+		rows, err := r.db.QueryContext(ctx, `SELECT data FROM users WHERE email IS NULL LIMIT 500`)
+		if err != nil {
+			return fmt.Errorf("repository: backfill: %w", err)
+		}
+		users, err := scanUsers(rows)
+		if err != nil {
+			return fmt.Errorf("repository: backfill: %w", err)
+		}
+		if len(users) == 0 {
+			return nil
+		}
+		for _, user := range users {
+			_, err := r.db.ExecContext(ctx,
+				`UPDATE users SET email = ?, display_name = ?, is_active = ?, update_time = ? WHERE name = ?`,
+				user.GetEmail(), user.GetDisplayName(), user.GetIsActive(), user.GetUpdateTime().AsTime().UnixNano(), user.GetName())
+			if err != nil {
+				return fmt.Errorf("repository: backfill %s: %w", user.GetName(), err)
+			}
+		}
+	}
+}
+
+// Create stores a new user
+func (r *SQLRepository) Create(ctx context.Context, user *apiv1.User) (*apiv1.User, error) {
+	data, err := proto.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("repository: marshal %s: %w", user.GetName(), err)
+	}
+	err = r.write(ctx, func(q sqlQuerier) error {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO users (name, create_time, email, display_name, is_active, update_time, delete_time, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			user.GetName(), user.GetCreateTime().AsTime().UnixNano(), user.GetEmail(), user.GetDisplayName(),
+			user.GetIsActive(), user.GetUpdateTime().AsTime().UnixNano(), user.GetDeleteTime().AsTime().UnixNano(), data)
+		if dup := r.dialect.duplicate(err); dup != nil {
+			return dup
+		}
+		if err != nil {
+			return fmt.Errorf("repository: create %s: %w", user.GetName(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(user).(*apiv1.User), nil
+}
+
+// Get returns a user by resource name
+func (r *SQLRepository) Get(ctx context.Context, name string) (*apiv1.User, error) {
+	var data []byte
+	err := r.db.QueryRowContext(ctx, `SELECT data FROM users WHERE name = ?`, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: get %s: %w", name, err)
+	}
+	return unmarshalUser(data)
+}
+
+// GetByEmail returns the user with email, looked up in the unique email
+// index
+func (r *SQLRepository) GetByEmail(ctx context.Context, email string) (*apiv1.User, error) {
+	if email == "" {
+		return nil, ErrNotFound
+	}
+	var data []byte
+	err := r.db.QueryRowContext(ctx, r.dialect.byEmail, email).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: get by email: %w", err)
+	}
+	return unmarshalUser(data)
+}
+
+// List returns a page of users ordered by creation time, in the order
+// MemoryRepository uses. A negative limit returns every user from offset.
+func (r *SQLRepository) List(ctx context.Context, offset, limit int) ([]*apiv1.User, error) {
+	if offset < 0 {
+		return []*apiv1.User{}, nil
+	}
+	// Neither database has a portable LIMIT ALL
+	if limit < 0 {
+		limit = math.MaxInt64
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT data FROM users ORDER BY create_time, length(name), name LIMIT ? OFFSET ?`,
+		limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("repository: list: %w", err)
+	}
+	users, err := scanUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("repository: list: %w", err)
+	}
+	return users, nil
+}
+
+// Find returns the users q selects, filtered and sorted by the database.
+// Creation order seeks in the creation time index.
+func (r *SQLRepository) Find(ctx context.Context, q Query) ([]*apiv1.User, error) {
+	clauses, args := findSQL(sqlFilter, q)
+	limit := q.Limit
+	if limit < 0 {
+		limit = math.MaxInt64
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT data FROM users`+clauses+` LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("repository: find: %w", err)
+	}
+	users, err := scanUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("repository: find: %w", err)
+	}
+	return users, nil
+}
+
+// Count returns the number of users, counted by the database
+func (r *SQLRepository) Count(ctx context.Context) (int, error) {
+	return r.CountMatching(ctx, nil)
+}
+
+// CountMatching returns the number of users f matches, counted by the
+// database
+func (r *SQLRepository) CountMatching(ctx context.Context, f filter.Expr) (int, error) {
+	where, args := filter.SQL(f, sqlFilter, nil)
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE `+where, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("repository: count: %w", err)
+	}
+	return total, nil
+}
+
+// Update replaces an existing user last updated at lastUpdate, checked in
+// the same statement
+func (r *SQLRepository) Update(ctx context.Context, user *apiv1.User, lastUpdate *timestamppb.Timestamp) (*apiv1.User, error) {
+	data, err := proto.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("repository: marshal %s: %w", user.GetName(), err)
+	}
+	err = r.write(ctx, func(q sqlQuerier) error {
+		result, err := q.ExecContext(ctx,
+			`UPDATE users SET create_time = ?, email = ?, display_name = ?, is_active = ?, update_time = ?, delete_time = ?, data = ? WHERE name = ? AND update_time = ?`,
+			user.GetCreateTime().AsTime().UnixNano(), user.GetEmail(), user.GetDisplayName(), user.GetIsActive(),
+			user.GetUpdateTime().AsTime().UnixNano(), user.GetDeleteTime().AsTime().UnixNano(), data, user.GetName(),
+			lastUpdate.AsTime().UnixNano())
+		if dup := r.dialect.duplicate(err); dup != nil {
+			return dup
+		}
+		if err != nil {
+			return fmt.Errorf("repository: update %s: %w", user.GetName(), err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			// No row was changed: the user is gone, was updated since, or,
+			// as MySQL counts changed rows rather than matched ones, was
+			// stored with the same bytes
+			var stored int64
+			err := q.QueryRowContext(ctx, `SELECT update_time FROM users WHERE name = ?`, user.GetName()).Scan(&stored)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			if err != nil {
+				return fmt.Errorf("repository: update %s: %w", user.GetName(), err)
+			}
+			if stored != lastUpdate.AsTime().UnixNano() {
+				return ErrConflict
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(user).(*apiv1.User), nil
+}
+
+// Delete removes a user
+func (r *SQLRepository) Delete(ctx context.Context, name string) error {
+	return r.write(ctx, func(q sqlQuerier) error {
+		result, err := q.ExecContext(ctx, `DELETE FROM users WHERE name = ?`, name)
+		if err != nil {
+			return fmt.Errorf("repository: delete %s: %w", name, err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// BatchGet returns the existing users among names, in one query
+func (r *SQLRepository) BatchGet(ctx context.Context, names []string) ([]*apiv1.User, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	rows, err := r.db.QueryContext(ctx, `SELECT data FROM users WHERE name IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("repository: batch get: %w", err)
+	}
+	found, err := scanUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("repository: batch get: %w", err)
+	}
+
+	byName := make(map[string]*apiv1.User, len(found))
+	for _, user := range found {
+		byName[user.GetName()] = user
+	}
+	var users []*apiv1.User
+	for _, name := range names {
+		if user, exists := byName[name]; exists {
+			users = append(users, proto.Clone(user).(*apiv1.User))
+		}
+	}
+	return users, nil
+}
+
+// write runs fn on the database or, when ctx carries outbox messages, in a
+// transaction adding them after fn succeeds
+func (r *SQLRepository) write(ctx context.Context, fn func(q sqlQuerier) error) error {
+	msgs := outbox.Messages(ctx)
+	if len(msgs) == 0 {
+		return fn(r.db)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("repository: begin: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if err := addSQLMessage(ctx, tx, msg); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("repository: commit: %w", err)
+	}
+	return nil
+}
+
+// IndexVersion returns the IndexVersion recorded by the last Reindex
+func (r *SQLRepository) IndexVersion(ctx context.Context) (int, error) {
+	var version int
+	err := r.db.QueryRowContext(ctx, `SELECT version FROM schema_versions WHERE name = ?`, usersIndex).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("repository: index version: %w", err)
+	}
+	return version, nil
+}
+
+// Reindex rewrites the filter columns of every user from its data, in
+// batches in name order. A row is only rewritten while its data is the
+// one read, so a user written meanwhile keeps the columns of the write.
+func (r *SQLRepository) Reindex(ctx context.Context, progress func(done, total int)) error {
+	total, err := r.Count(ctx)
+	if err != nil {
+		return fmt.Errorf("repository: reindex: %w", err)
+	}
+	done, after := 0, ""
+	for {
+		rows, err := r.db.QueryContext(ctx, `SELECT data FROM users WHERE name > ? ORDER BY name LIMIT ?`, after, reindexBatch)
+		if err != nil {
+			return fmt.Errorf("repository: reindex: %w", err)
+		}
+		var batch [][]byte
+		for rows.Next() {
+			var data []byte
+			if err := rows.Scan(&data); err != nil {
+				rows.Close()
+				return fmt.Errorf("repository: reindex: %w", err)
+			}
+			batch = append(batch, data)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("repository: reindex: %w", err)
+		}
+
+		for _, data := range batch {
+			user, err := unmarshalUser(data)
+			if err != nil {
+				return fmt.Errorf("repository: reindex: %w", err)
+			}
+			_, err = r.db.ExecContext(ctx,
+				`UPDATE users SET create_time = ?, email = ?, display_name = ?, is_active = ?, update_time = ?, delete_time = ? WHERE name = ? AND data = ?`,
+				user.GetCreateTime().AsTime().UnixNano(), user.GetEmail(), user.GetDisplayName(), user.GetIsActive(),
+				user.GetUpdateTime().AsTime().UnixNano(), user.GetDeleteTime().AsTime().UnixNano(), user.GetName(), data)
+			if err != nil {
+				return fmt.Errorf("repository: reindex %s: %w", user.GetName(), err)
+			}
+			after = user.GetName()
+		}
+		done += len(batch)
+		progress(done, max(total, done))
+		if len(batch) < reindexBatch {
+			break
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("repository: begin: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_versions WHERE name = ?`, usersIndex); err != nil {
+		return fmt.Errorf("repository: record index version: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_versions (name, version) VALUES (?, ?)`, usersIndex, IndexVersion); err != nil {
+		return fmt.Errorf("repository: record index version: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("repository: commit: %w", err)
+	}
+	return nil
+}
+
+// Outbox returns the outbox table the writes add their messages to
+func (r *SQLRepository) Outbox() outbox.Store {
+	return &sqlOutbox{db: r.db}
+}
+
+// sqlOutbox is the outbox table of a SQLRepository, with times in Unix
+// nanoseconds
+type sqlOutbox struct {
+	db *sql.DB
+}
+
+func addSQLMessage(ctx context.Context, q sqlQuerier, msg *outbox.Message) error {
+	_, err := q.ExecContext(ctx,
+		`INSERT INTO outbox (id, topic, msg_key, payload, create_time, attempts, last_error) VALUES (?, ?, ?, ?, ?, 0, '')`,
+		msg.ID, msg.Topic, msg.Key, msg.Payload, msg.CreateTime.UnixNano())
+	if err != nil {
+		return fmt.Errorf("repository: add outbox message %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// Add records a new undelivered message
+func (o *sqlOutbox) Add(ctx context.Context, msg *outbox.Message) error {
+	return addSQLMessage(ctx, o.db, msg)
+}
+
+// Pending returns up to limit undelivered messages, oldest first
+func (o *sqlOutbox) Pending(ctx context.Context, limit int) ([]*outbox.Message, error) {
+	rows, err := o.db.QueryContext(ctx,
+		`SELECT id, topic, msg_key, payload, create_time, attempts, last_error FROM outbox
+		WHERE deliver_time IS NULL ORDER BY create_time, id LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository: pending outbox messages: %w", err)
+	}
+	defer rows.Close()
+	var msgs []*outbox.Message
+	for rows.Next() {
+		msg := &outbox.Message{}
+		var created int64
+		if err := rows.Scan(&msg.ID, &msg.Topic, &msg.Key, &msg.Payload, &created, &msg.Attempts, &msg.LastError); err != nil {
+			return nil, fmt.Errorf("repository: pending outbox messages: %w", err)
+		}
+		msg.CreateTime = time.Unix(0, created).UTC()
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+// MarkDelivered records that the message was published at t
+func (o *sqlOutbox) MarkDelivered(ctx context.Context, id string, t time.Time) error {
+	return o.mark(ctx, id, `UPDATE outbox SET deliver_time = ? WHERE id = ?`, t.UnixNano(), id)
+}
+
+// MarkFailed records a failed publish attempt
+func (o *sqlOutbox) MarkFailed(ctx context.Context, id string, err error) error {
+	return o.mark(ctx, id, `UPDATE outbox SET attempts = attempts + 1, last_error = ? WHERE id = ?`, err.Error(), id)
+}
+
+func (o *sqlOutbox) mark(ctx context.Context, id, query string, args ...any) error {
+	result, err := o.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("repository: mark outbox message %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return outbox.ErrNotFound
+	}
+	return nil
+}
+
+// Purge deletes the messages delivered before cutoff, or with dryRun only
+// counts them
+func (o *sqlOutbox) Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	if dryRun {
+		var n int
+		err := o.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM outbox WHERE deliver_time IS NOT NULL AND deliver_time < ?`, cutoff.UnixNano()).Scan(&n)
+		if err != nil {
+			return 0, fmt.Errorf("repository: count delivered outbox messages: %w", err)
+		}
+		return n, nil
+	}
+	result, err := o.db.ExecContext(ctx,
+		`DELETE FROM outbox WHERE deliver_time IS NOT NULL AND deliver_time < ?`, cutoff.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("repository: purge outbox: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// scanUsers unmarshals the data column of every row and closes rows
+func scanUsers(rows *sql.Rows) ([]*apiv1.User, error) {
+	defer rows.Close()
+	users := []*apiv1.User{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		user, err := unmarshalUser(data)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,92 @@
+//go:build cgo
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDialect serves SQLite through mattn/go-sqlite3, which needs a cgo
+// build. SQLite has a single writer, and each connection to :memory: is a
+// database of its own, so one connection is kept open.
+var sqliteDialect = sqlDialect{
+	driver: "sqlite3",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			name         TEXT PRIMARY KEY,
+			create_time  INTEGER NOT NULL,
+			email        TEXT,
+			display_name TEXT,
+			is_active    INTEGER,
+			update_time  INTEGER,
+			delete_time  INTEGER NOT NULL DEFAULT 0,
+			data         BLOB NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS users_create_time_idx ON users (create_time, length(name), name)`,
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id           TEXT PRIMARY KEY,
+			topic        TEXT NOT NULL,
+			msg_key      TEXT NOT NULL,
+			payload      BLOB NOT NULL,
+			create_time  INTEGER NOT NULL,
+			deliver_time INTEGER,
+			attempts     INTEGER NOT NULL,
+			last_error   TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (create_time, id) WHERE deliver_time IS NULL`,
+		`CREATE TABLE IF NOT EXISTS schema_versions (
+			name    TEXT PRIMARY KEY,
+			version INTEGER NOT NULL
+		)`,
+	},
+	columns: []sqlColumns{
+		{probe: "email", stmts: []string{
+			`ALTER TABLE users ADD COLUMN email TEXT`,
+			`ALTER TABLE users ADD COLUMN display_name TEXT`,
+			`ALTER TABLE users ADD COLUMN is_active INTEGER`,
+			`ALTER TABLE users ADD COLUMN update_time INTEGER`,
+		}},
+		{probe: "delete_time", stmts: []string{
+			`ALTER TABLE users ADD COLUMN delete_time INTEGER NOT NULL DEFAULT 0`,
+		}},
+	},
+	indexes: []string{
+		`CREATE INDEX IF NOT EXISTS users_email_idx ON users (email)`,
+		`CREATE INDEX IF NOT EXISTS users_delete_time_idx ON users (delete_time)`,
+	},
+	uniqueEmail: sqlColumns{stmts: []string{
+		`CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email) WHERE email <> ''`,
+	}},
+	// The condition of the partial index is repeated for it to be used
+	byEmail: `SELECT data FROM users WHERE email = ? AND email <> ''`,
+	duplicate: func(err error) error {
+		var sqliteErr sqlite3.Error
+		if !errors.As(err, &sqliteErr) {
+			return nil
+		}
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintPrimaryKey:
+			return ErrAlreadyExists
+		case sqlite3.ErrConstraintUnique:
+			return ErrEmailTaken
+		default:
+			return nil
+		}
+	},
+	maxConns: 1,
+}
+
+func init() {
+	RegisterDriver("sqlite", openSQL(sqliteDialect))
+}
+
+// NewSQLiteRepository creates a SQLRepository over a SQLite database opened
+// with the sqlite3 driver, creating the users and outbox tables if they do
+// not exist. The caller closes db.
+func NewSQLiteRepository(ctx context.Context, db *sql.DB) (*SQLRepository, error) {
+	return newSQLRepository(ctx, db, sqliteDialect)
+}
@@ -0,0 +1,18 @@
+//go:build !cgo
+
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+)
+
+// The SQLite driver needs cgo. Builds without it, such as the Docker
+// image, still know the driver so configs naming it get a clear error.
+func init() {
+	RegisterDriver("sqlite", func(context.Context, config.StorageConfig) (UserRepository, func() error, error) {
+		return nil, nil, errors.New("sqlite needs a build with CGO_ENABLED=1")
+	})
+}
@@ -0,0 +1,213 @@
+//go:build cgo
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestSQLiteRepository(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "users.db")
+	repo, closeRepo, err := Open(ctx, config.StorageConfig{Driver: "sqlite", DSN: dsn})
+	if err != nil {
+		t.Fatalf("Open(sqlite) unexpected error: %v", err)
+	}
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"users/10", "users/9", "users/11"} {
+		user := &apiv1.User{Name: name, Email: name + "@example.com", CreateTime: timestamppb.New(base)}
+		if i == 2 {
+			user.CreateTime = timestamppb.New(base.Add(time.Nanosecond))
+		}
+		if _, err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create(%s) unexpected error: %v", name, err)
+		}
+	}
+	if _, err := repo.Create(ctx, &apiv1.User{Name: "users/9"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Create() duplicate error = %v, want %v", err, ErrAlreadyExists)
+	}
+
+	// Ties on create_time are broken as MemoryRepository does, and
+	// nanoseconds survive the round trip
+	users, err := repo.List(ctx, 0, -1)
+	if err != nil || len(users) != 3 || users[0].GetName() != "users/9" || users[1].GetName() != "users/10" || users[2].GetName() != "users/11" {
+		t.Fatalf("List() = %v, %v, want users/9, users/10, users/11", users, err)
+	}
+
+	// Updating with unchanged data still finds the user
+	if _, err := repo.Update(ctx, users[0], users[0].GetUpdateTime()); err != nil {
+		t.Errorf("Update() unchanged unexpected error: %v", err)
+	}
+	if _, err := repo.Update(ctx, &apiv1.User{Name: "users/1"}, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update() missing error = %v, want %v", err, ErrNotFound)
+	}
+
+	// Data survives reopening the file
+	if err := closeRepo(); err != nil {
+		t.Fatalf("close unexpected error: %v", err)
+	}
+	repo, closeRepo, err = Open(ctx, config.StorageConfig{Driver: "sqlite", DSN: dsn})
+	if err != nil {
+		t.Fatalf("reopen unexpected error: %v", err)
+	}
+	t.Cleanup(func() { closeRepo() })
+	if total, err := repo.Count(ctx); err != nil || total != 3 {
+		t.Errorf("Count() after reopening = %d, %v, want 3", total, err)
+	}
+}
+
+func TestSQLiteRepositoryFind(t *testing.T) {
+	repo, closeRepo, err := Open(context.Background(), config.StorageConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "users.db")})
+	if err != nil {
+		t.Fatalf("Open(sqlite) unexpected error: %v", err)
+	}
+	t.Cleanup(func() { closeRepo() })
+	runFindSuite(t, repo)
+}
+
+func TestSQLiteRepositoryUniqueEmails(t *testing.T) {
+	repo, closeRepo, err := Open(context.Background(), config.StorageConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "users.db")})
+	if err != nil {
+		t.Fatalf("Open(sqlite) unexpected error: %v", err)
+	}
+	t.Cleanup(func() { closeRepo() })
+	runUniqueEmailSuite(t, repo)
+}
+
+func TestSQLiteRepositoryUpdateConflict(t *testing.T) {
+	repo, closeRepo, err := Open(context.Background(), config.StorageConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "users.db")})
+	if err != nil {
+		t.Fatalf("Open(sqlite) unexpected error: %v", err)
+	}
+	t.Cleanup(func() { closeRepo() })
+	runUpdateConflictSuite(t, repo)
+}
+
+func TestSQLiteRepositoryDuplicateEmails(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "users.db")
+
+	// A table from before emails were unique, with a shared one
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open() unexpected error: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE users (name TEXT PRIMARY KEY, create_time INTEGER NOT NULL, email TEXT, display_name TEXT, is_active INTEGER, update_time INTEGER, data BLOB NOT NULL)`,
+		`INSERT INTO users VALUES ('users/1', 0, 'ada@example.com', '', 1, 0, x''), ('users/2', 0, 'ada@example.com', '', 1, 0, x''), ('users/3', 0, '', '', 1, 0, x''), ('users/4', 0, '', '', 1, 0, x'')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("Exec(%s) unexpected error: %v", stmt, err)
+		}
+	}
+	db.Close()
+
+	_, _, err = Open(ctx, config.StorageConfig{Driver: "sqlite", DSN: dsn})
+	if err == nil || !strings.Contains(err.Error(), "ada@example.com") {
+		t.Errorf("Open(sqlite) with a shared email error = %v, want one naming it", err)
+	}
+}
+
+func TestSQLiteRepositoryBackfill(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "users.db")
+
+	// A table from before the filter columns
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open() unexpected error: %v", err)
+	}
+	data, _ := proto.Marshal(&apiv1.User{Name: "users/1", Email: "old@example.com", IsActive: true})
+	for _, stmt := range []string{
+		`CREATE TABLE users (name TEXT PRIMARY KEY, create_time INTEGER NOT NULL, data BLOB NOT NULL)`,
+		`INSERT INTO users (name, create_time, data) VALUES ('users/1', 0, x'` + hex.EncodeToString(data) + `')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("Exec(%s) unexpected error: %v", stmt, err)
+		}
+	}
+	db.Close()
+
+	repo, closeRepo, err := Open(ctx, config.StorageConfig{Driver: "sqlite", DSN: dsn})
+	if err != nil {
+		t.Fatalf("Open(sqlite) unexpected error: %v", err)
+	}
+	t.Cleanup(func() { closeRepo() })
+	expr, _ := filter.Parse(`email : "old" AND is_active = true`, UserFields)
+	if users, err := repo.Find(ctx, Query{Filter: expr, Limit: -1}); err != nil || len(users) != 1 {
+		t.Errorf("Find() after upgrade = %v, %v, want the stored user", users, err)
+	}
+}
+
+func TestSQLiteRepositoryReindex(t *testing.T) {
+	ctx := context.Background()
+	repo, closeRepo, err := Open(ctx, config.StorageConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "users.db")})
+	if err != nil {
+		t.Fatalf("Open(sqlite) unexpected error: %v", err)
+	}
+	t.Cleanup(func() { closeRepo() })
+	r := repo.(*SQLRepository)
+	if v, err := r.IndexVersion(ctx); err != nil || v != 0 {
+		t.Errorf("IndexVersion() before Reindex = %d, %v, want 0", v, err)
+	}
+
+	for i := range 3 {
+		if _, err := repo.Create(ctx, &apiv1.User{Name: fmt.Sprintf("users/%d", i), Email: fmt.Sprintf("u%d@example.com", i), IsActive: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Columns that disagree with the stored users
+	if _, err := r.db.ExecContext(ctx, `UPDATE users SET is_active = 0, display_name = 'stale'`); err != nil {
+		t.Fatal(err)
+	}
+	active, _ := filter.Parse(`is_active = true`, UserFields)
+	if n, _ := repo.CountMatching(ctx, active); n != 0 {
+		t.Fatalf("CountMatching(is_active) before Reindex = %d, want 0", n)
+	}
+
+	var done, total int
+	if err := r.Reindex(ctx, func(d, n int) { done, total = d, n }); err != nil {
+		t.Fatalf("Reindex() unexpected error: %v", err)
+	}
+	if done != 3 || total != 3 {
+		t.Errorf("Reindex() last progress = %d of %d, want 3 of 3", done, total)
+	}
+	if n, err := repo.CountMatching(ctx, active); err != nil || n != 3 {
+		t.Errorf("CountMatching(is_active) after Reindex = %d, %v, want 3", n, err)
+	}
+	if v, err := r.IndexVersion(ctx); err != nil || v != IndexVersion {
+		t.Errorf("IndexVersion() after Reindex = %d, %v, want %d", v, err, IndexVersion)
+	}
+}
+
+func TestSQLiteRepositoryOutbox(t *testing.T) {
+	repo, closeRepo, err := Open(context.Background(), config.StorageConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "users.db")})
+	if err != nil {
+		t.Fatalf("Open(sqlite) unexpected error: %v", err)
+	}
+	t.Cleanup(func() { closeRepo() })
+	runOutboxSuite(t, repo)
+
+	p := OutboxOf(repo).(interface {
+		Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error)
+	})
+	cutoff := time.Date(2025, 1, 1, 0, 2, 0, 0, time.UTC)
+	if n, err := p.Purge(context.Background(), cutoff, false); err != nil || n != 1 {
+		t.Errorf("Purge() = %d, %v, want the delivered message", n, err)
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// usersJSON returns a ListUsers-shaped body of n users
+func usersJSON(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"error_code":0,"error_msg":"success","data":{"result":{"users":[`)
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"name":"users/%d","email":"user%d@example.com","display_name":"User %d","is_active":true,"create_time":"2024-05-01T10:%02d:00Z","update_time":"2024-05-01T10:%02d:00Z"}`, i, i, i, i%60, i%60)
+	}
+	fmt.Fprintf(&b, `],"next_page_token":"%d","total_size":%d}}}`, n, n*10)
+	return b.Bytes()
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	large := usersJSON(20)
+	small := usersJSON(1)
+	handler := compressMiddleware(CompressionOptions{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(small)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(large)
+		case "/error":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(large)
+		default:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("ETag", `"abc"`)
+			w.Write(large)
+		}
+	}))
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantGzip       bool
+		wantBody       []byte
+	}{
+		{"large json", "/users", "gzip, deflate, br", true, large},
+		{"no accept-encoding", "/users", "", false, large},
+		{"gzip refused", "/users", "gzip;q=0, *", false, large},
+		{"wildcard", "/users", "*", true, large},
+		{"below cutoff", "/small", "gzip", false, small},
+		{"unlisted type", "/image", "gzip", false, large},
+		{"error status", "/error", "gzip", false, large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			gotGzip := rec.Header().Get("Content-Encoding") == "gzip"
+			if gotGzip != tt.wantGzip {
+				t.Fatalf("gzipped = %v, want %v", gotGzip, tt.wantGzip)
+			}
+			body := rec.Body.Bytes()
+			if gotGzip {
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader() unexpected error: %v", err)
+				}
+				if body, err = io.ReadAll(zr); err != nil {
+					t.Fatalf("reading gzipped body: %v", err)
+				}
+				if etag := rec.Header().Get("ETag"); etag != `W/"abc"` {
+					t.Errorf("ETag = %q, want it weakened", etag)
+				}
+			}
+			if !bytes.Equal(body, tt.wantBody) {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// BenchmarkGzip measures compressing ListUsers bodies of growing size, the
+// basis of DefaultCompressionMinSize. Compare ns/op with the bytes saved
+// (saved_B/op) to pick where compression starts to pay.
+func BenchmarkGzip(b *testing.B) {
+	for _, users := range []int{1, 2, 4, 8, 16, 64} {
+		body := usersJSON(users)
+		b.Run(fmt.Sprintf("json_%dB", len(body)), func(b *testing.B) {
+			for _, level := range []int{gzip.BestSpeed, gzip.DefaultCompression} {
+				b.Run(fmt.Sprintf("level_%d", level), func(b *testing.B) {
+					var out bytes.Buffer
+					zw, _ := gzip.NewWriterLevel(&out, level)
+					b.SetBytes(int64(len(body)))
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						out.Reset()
+						zw.Reset(&out)
+						zw.Write(body)
+						zw.Close()
+					}
+					b.ReportMetric(float64(len(body)-out.Len()), "saved_B/op")
+				})
+			}
+		})
+	}
+}
+
+// BenchmarkCompressMiddleware measures the middleware on a body below and
+// above the JSON cutoff
+func BenchmarkCompressMiddleware(b *testing.B) {
+	for _, users := range []int{1, 16} {
+		body := usersJSON(users)
+		handler := compressMiddleware(CompressionOptions{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+
+		b.Run(fmt.Sprintf("json_%dB", len(body)), func(b *testing.B) {
+			w := discardResponse{header: http.Header{}}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				clear(w.header)
+				handler.ServeHTTP(w, req)
+			}
+		})
+	}
+}
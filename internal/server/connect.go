@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// reservedHeaders belong to the HTTP, Connect, gRPC, gRPC-Web and Twirp
+// protocols rather than the call, so they are not passed on as metadata
+var reservedHeaders = map[string]bool{
+	"accept":           true,
+	"accept-encoding":  true,
+	"connection":       true,
+	"content-type":     true,
+	"content-length":   true,
+	"content-encoding": true,
+	"host":             true,
+	"te":               true,
+	"trailer":          true,
+	"user-agent":       true,
+	"x-grpc-web":       true,
+	"x-user-agent":     true,
+}
+
+// registerConnect serves the methods of services on mux with connectrpc,
+// which speaks the Connect, gRPC and gRPC-Web protocols at
+// /<package.Service>/<Method>. Messages are built from the descriptors and
+// calls proxied over conn, so they pass the gRPC server's interceptors like
+// gateway calls do. Client and bidirectional streams are not served; the
+// API has none.
+func registerConnect(mux *http.ServeMux, conn grpc.ClientConnInterface, services ...protoreflect.ServiceDescriptor) {
+	for _, svc := range services {
+		methods := svc.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			md := methods.Get(i)
+			procedure := fmt.Sprintf("/%s/%s", svc.FullName(), md.Name())
+			opts := []connect.HandlerOption{
+				connect.WithSchema(md),
+				connect.WithRequestInitializer(func(_ connect.Spec, msg any) error {
+					m, ok := msg.(*dynamicpb.Message)
+					if !ok {
+						return fmt.Errorf("unexpected request type %T", msg)
+					}
+					*m = *dynamicpb.NewMessage(md.Input())
+					return nil
+				}),
+			}
+			switch {
+			case md.IsStreamingClient():
+				continue
+			case md.IsStreamingServer():
+				mux.Handle(procedure, connect.NewServerStreamHandler(procedure, connectServerStream(conn, procedure, md), opts...))
+			default:
+				mux.Handle(procedure, connect.NewUnaryHandler(procedure, connectUnary(conn, procedure, md), opts...))
+			}
+		}
+	}
+}
+
+func connectUnary(conn grpc.ClientConnInterface, procedure string, md protoreflect.MethodDescriptor) func(context.Context, *connect.Request[dynamicpb.Message]) (*connect.Response[dynamicpb.Message], error) {
+	return func(ctx context.Context, req *connect.Request[dynamicpb.Message]) (*connect.Response[dynamicpb.Message], error) {
+		ctx, err := forwardContext(ctx, req.Header(), req.Peer().Addr)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+		var header, trailer metadata.MD
+		out := dynamicpb.NewMessage(md.Output())
+		if err := conn.Invoke(ctx, procedure, req.Msg, out, grpc.Header(&header), grpc.Trailer(&trailer)); err != nil {
+			return nil, connectError(err, header, trailer)
+		}
+		res := connect.NewResponse(out)
+		copyMetadata(res.Header(), header)
+		copyMetadata(res.Trailer(), trailer)
+		return res, nil
+	}
+}
+
+func connectServerStream(conn grpc.ClientConnInterface, procedure string, md protoreflect.MethodDescriptor) func(context.Context, *connect.Request[dynamicpb.Message], *connect.ServerStream[dynamicpb.Message]) error {
+	desc := &grpc.StreamDesc{StreamName: string(md.Name()), ServerStreams: true}
+	return func(ctx context.Context, req *connect.Request[dynamicpb.Message], stream *connect.ServerStream[dynamicpb.Message]) error {
+		ctx, err := forwardContext(ctx, req.Header(), req.Peer().Addr)
+		if err != nil {
+			return connect.NewError(connect.CodeInvalidArgument, err)
+		}
+		// Ends the upstream call if the client goes away mid-stream
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		cs, err := conn.NewStream(ctx, desc, procedure)
+		if err != nil {
+			return connectError(err, nil, nil)
+		}
+		if err := cs.SendMsg(req.Msg); err != nil && !errors.Is(err, io.EOF) {
+			return connectError(err, nil, nil)
+		}
+		if err := cs.CloseSend(); err != nil {
+			return connectError(err, nil, nil)
+		}
+		header, err := cs.Header()
+		if err != nil {
+			return connectError(err, nil, cs.Trailer())
+		}
+		copyMetadata(stream.ResponseHeader(), header)
+		for {
+			out := dynamicpb.NewMessage(md.Output())
+			if err := cs.RecvMsg(out); err != nil {
+				if errors.Is(err, io.EOF) {
+					copyMetadata(stream.ResponseTrailer(), cs.Trailer())
+					return nil
+				}
+				return connectError(err, header, cs.Trailer())
+			}
+			if err := stream.Send(out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// forwardContext passes a proxied call's headers on as metadata and appends
+// the client's address to x-forwarded-for, as the gateway does
+func forwardContext(ctx context.Context, h http.Header, remoteAddr string) (context.Context, error) {
+	md := metadata.MD{}
+	for key, values := range h {
+		key = strings.ToLower(key)
+		if reservedHeaders[key] || strings.HasPrefix(key, "connect-") || strings.HasPrefix(key, "grpc-") || strings.HasPrefix(key, "twirp-") {
+			continue
+		}
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				b, err := connect.DecodeBinaryHeader(v)
+				if err != nil {
+					return nil, fmt.Errorf("header %s: %w", key, err)
+				}
+				v = string(b)
+			}
+			md.Append(key, v)
+		}
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		md.Append("x-forwarded-for", host)
+	}
+	return metadata.NewOutgoingContext(ctx, md), nil
+}
+
+// connectError converts a gRPC status to a Connect error with the same
+// code, message and details, carrying the call's metadata
+func connectError(err error, header, trailer metadata.MD) error {
+	st := status.Convert(err)
+	cerr := connect.NewError(connect.Code(st.Code()), errors.New(st.Message()))
+	for _, d := range st.Proto().GetDetails() {
+		if detail, err := connect.NewErrorDetail(d); err == nil {
+			cerr.AddDetail(detail)
+		}
+	}
+	copyMetadata(cerr.Meta(), header)
+	copyMetadata(cerr.Meta(), trailer)
+	return cerr
+}
+
+// copyMetadata adds gRPC metadata to HTTP headers, base64-encoding binary
+// values as the gRPC protocol does
+func copyMetadata(h http.Header, md metadata.MD) {
+	for key, values := range md {
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				v = connect.EncodeBinaryHeader([]byte(v))
+			}
+			h.Add(key, v)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/server"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newConnectServer serves the API with Connect only, over HTTP/1.1 and
+// unencrypted HTTP/2 like the server does
+func newConnectServer(t *testing.T, opts ...testutil.Option) *httptest.Server {
+	t.Helper()
+	srv := testutil.NewServer(t, opts...)
+	handler, err := server.NewHTTPHandler(context.Background(), srv.Conn, testutil.NopLogger(), srv.Services, server.WithConnect(), server.WithoutGateway())
+	if err != nil {
+		t.Fatalf("NewHTTPHandler() error = %v", err)
+	}
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Config.Protocols = &http.Protocols{}
+	ts.Config.Protocols.SetHTTP1(true)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func h2cClient() *http.Client {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+}
+
+func TestConnectProtocols(t *testing.T) {
+	ts := newConnectServer(t)
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		opts   []connect.ClientOption
+	}{
+		{name: "connect", client: http.DefaultClient},
+		{name: "connect json", client: http.DefaultClient, opts: []connect.ClientOption{connect.WithProtoJSON()}},
+		{name: "grpc", client: h2cClient(), opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpc-web", client: http.DefaultClient, opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			wantEmail := strings.ReplaceAll(tt.name, " ", "-") + "@example.com"
+			create := connect.NewClient[apiv1.CreateUserRequest, apiv1.CommonResponse](tt.client, ts.URL+"/api.v1.UserService/CreateUser", tt.opts...)
+			res, err := create.CallUnary(ctx, connect.NewRequest(&apiv1.CreateUserRequest{
+				User: &apiv1.User{Email: wantEmail, DisplayName: "Ada"},
+			}))
+			if err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			if res.Msg.GetErrorCode() != response.CodeSuccess {
+				t.Fatalf("CreateUser() = %d %s", res.Msg.GetErrorCode(), res.Msg.GetErrorMsg())
+			}
+			name := res.Msg.GetData().GetFields()["result"].GetStructValue().GetFields()["name"].GetStringValue()
+
+			get := connect.NewClient[apiv1.GetUserRequest, apiv1.CommonResponse](tt.client, ts.URL+"/api.v1.UserService/GetUser", tt.opts...)
+			res, err = get.CallUnary(ctx, connect.NewRequest(&apiv1.GetUserRequest{Name: name}))
+			if err != nil {
+				t.Fatalf("GetUser() error = %v", err)
+			}
+			email := res.Msg.GetData().GetFields()["result"].GetStructValue().GetFields()["email"].GetStringValue()
+			if email != wantEmail {
+				t.Errorf("GetUser() email = %q", email)
+			}
+
+			stream := connect.NewClient[apiv1.StreamUsersRequest, apiv1.User](tt.client, ts.URL+"/api.v1.UserService/StreamUsers", tt.opts...)
+			users, err := stream.CallServerStream(ctx, connect.NewRequest(&apiv1.StreamUsersRequest{}))
+			if err != nil {
+				t.Fatalf("StreamUsers() error = %v", err)
+			}
+			var found bool
+			for users.Receive() {
+				found = found || users.Msg().GetName() == name
+			}
+			if err := users.Err(); err != nil {
+				t.Fatalf("StreamUsers() error = %v", err)
+			}
+			if !found {
+				t.Errorf("StreamUsers() did not return %s", name)
+			}
+		})
+	}
+}
+
+func TestConnectErrorsAndMetadata(t *testing.T) {
+	reject := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if got := md.Get("x-request-id"); len(got) != 1 || got[0] != "req-1" {
+			return nil, status.Errorf(codes.InvalidArgument, "x-request-id = %v", got)
+		}
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", "3"))
+		return nil, status.Error(codes.ResourceExhausted, "slow down")
+	}
+	ts := newConnectServer(t, testutil.WithServerOptions(grpc.ChainUnaryInterceptor(reject)))
+
+	for _, opt := range []connect.ClientOption{connect.WithProtoJSON(), connect.WithGRPCWeb()} {
+		client := connect.NewClient[apiv1.GetUserRequest, apiv1.CommonResponse](http.DefaultClient, ts.URL+"/api.v1.UserService/GetUser", opt)
+		req := connect.NewRequest(&apiv1.GetUserRequest{Name: "users/1"})
+		req.Header().Set("X-Request-Id", "req-1")
+		_, err := client.CallUnary(context.Background(), req)
+
+		var cerr *connect.Error
+		if !errors.As(err, &cerr) {
+			t.Fatalf("GetUser() error = %v, want a Connect error", err)
+		}
+		if cerr.Code() != connect.CodeResourceExhausted || cerr.Message() != "slow down" {
+			t.Errorf("GetUser() error = %v, want resource_exhausted: slow down", cerr)
+		}
+		if got := cerr.Meta().Get("Retry-After"); got != "3" {
+			t.Errorf("Retry-After = %q, want 3", got)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /v1/users without the gateway = %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,242 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// recordingService records the last request each RPC received
+type recordingService struct {
+	apiv1.UnimplementedUserServiceServer
+
+	mu     sync.Mutex
+	method string
+	req    proto.Message
+}
+
+func (s *recordingService) record(method string, req proto.Message) (*apiv1.CommonResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.method = method
+	s.req = req
+	return response.SuccessEmpty(), nil
+}
+
+func (s *recordingService) last() (string, proto.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.method, s.req
+}
+
+func (s *recordingService) CreateUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.CommonResponse, error) {
+	return s.record("CreateUser", req)
+}
+
+func (s *recordingService) GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.CommonResponse, error) {
+	return s.record("GetUser", req)
+}
+
+func (s *recordingService) GetUserByEmail(ctx context.Context, req *apiv1.GetUserByEmailRequest) (*apiv1.CommonResponse, error) {
+	return s.record("GetUserByEmail", req)
+}
+
+func (s *recordingService) ListUsers(ctx context.Context, req *apiv1.ListUsersRequest) (*apiv1.CommonResponse, error) {
+	return s.record("ListUsers", req)
+}
+
+func (s *recordingService) StreamUsers(req *apiv1.StreamUsersRequest, stream grpc.ServerStreamingServer[apiv1.User]) error {
+	_, err := s.record("StreamUsers", req)
+	return err
+}
+
+func (s *recordingService) WatchUsers(req *apiv1.WatchUsersRequest, stream grpc.ServerStreamingServer[apiv1.UserEvent]) error {
+	_, err := s.record("WatchUsers", req)
+	return err
+}
+
+func (s *recordingService) UpdateUser(ctx context.Context, req *apiv1.UpdateUserRequest) (*apiv1.CommonResponse, error) {
+	return s.record("UpdateUser", req)
+}
+
+func (s *recordingService) DeleteUser(ctx context.Context, req *apiv1.DeleteUserRequest) (*apiv1.CommonResponse, error) {
+	return s.record("DeleteUser", req)
+}
+
+func (s *recordingService) UndeleteUser(ctx context.Context, req *apiv1.UndeleteUserRequest) (*apiv1.CommonResponse, error) {
+	return s.record("UndeleteUser", req)
+}
+
+func (s *recordingService) BatchGetUsers(ctx context.Context, req *apiv1.BatchGetUsersRequest) (*apiv1.CommonResponse, error) {
+	return s.record("BatchGetUsers", req)
+}
+
+// contractCase describes how one HTTP call must bind to an RPC
+type contractCase struct {
+	method  string
+	path    string
+	body    string
+	rpc     string
+	wantReq proto.Message
+}
+
+var contractCases = []contractCase{
+	{
+		method:  http.MethodPost,
+		path:    "/v1/users",
+		body:    `{"email":"a@example.com","display_name":"A","phone_number":"+1"}`,
+		rpc:     "CreateUser",
+		wantReq: &apiv1.CreateUserRequest{User: &apiv1.User{Email: "a@example.com", DisplayName: "A", PhoneNumber: "+1"}},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/v1/users?request_id=r-1",
+		body:    `{"email":"a@example.com"}`,
+		rpc:     "CreateUser",
+		wantReq: &apiv1.CreateUserRequest{User: &apiv1.User{Email: "a@example.com"}, RequestId: "r-1"},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/v1/users/42",
+		rpc:     "GetUser",
+		wantReq: &apiv1.GetUserRequest{Name: "users/42"},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/v1/users:getByEmail?email=a%2Bb@example.com",
+		rpc:     "GetUserByEmail",
+		wantReq: &apiv1.GetUserByEmailRequest{Email: "a+b@example.com"},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/v1/users?page_size=10&page_token=20&filter=is_active%3Dtrue&order_by=create_time&skip_total_size=true&show_deleted=true",
+		rpc:     "ListUsers",
+		wantReq: &apiv1.ListUsersRequest{PageSize: 10, PageToken: "20", Filter: "is_active=true", OrderBy: "create_time", SkipTotalSize: true, ShowDeleted: true},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/v1/users:stream?chunk_size=100",
+		rpc:     "StreamUsers",
+		wantReq: &apiv1.StreamUsersRequest{ChunkSize: 100},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/v1/users:watch?types=user.created&types=user.deleted",
+		rpc:     "WatchUsers",
+		wantReq: &apiv1.WatchUsersRequest{Types: []string{"user.created", "user.deleted"}},
+	},
+	{
+		method: http.MethodPatch,
+		path:   "/v1/users/42?update_mask=display_name",
+		body:   `{"display_name":"B"}`,
+		rpc:    "UpdateUser",
+		wantReq: &apiv1.UpdateUserRequest{
+			User:       &apiv1.User{Name: "users/42", DisplayName: "B"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"display_name"}},
+		},
+	},
+	{
+		method:  http.MethodDelete,
+		path:    "/v1/users/42?force=true",
+		rpc:     "DeleteUser",
+		wantReq: &apiv1.DeleteUserRequest{Name: "users/42", Force: true},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/v1/users/42:undelete",
+		body:    `{}`,
+		rpc:     "UndeleteUser",
+		wantReq: &apiv1.UndeleteUserRequest{Name: "users/42"},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/v1/users:batchGet?names=users/1&names=users/2",
+		rpc:     "BatchGetUsers",
+		wantReq: &apiv1.BatchGetUsersRequest{Names: []string{"users/1", "users/2"}},
+	},
+}
+
+func TestHTTPContract(t *testing.T) {
+	recorder := &recordingService{}
+	srv := testutil.NewServer(t, testutil.WithUserService(recorder))
+
+	for _, tc := range contractCases {
+		t.Run(tc.rpc, func(t *testing.T) {
+			var body io.Reader
+			if tc.body != "" {
+				body = strings.NewReader(tc.body)
+			}
+			req, _ := http.NewRequest(tc.method, srv.URL+tc.path, body)
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := srv.HTTPClient.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s unexpected error: %v", tc.method, tc.path, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("%s %s status = %d, want %d", tc.method, tc.path, resp.StatusCode, http.StatusOK)
+			}
+
+			rpc, got := recorder.last()
+			if rpc != tc.rpc {
+				t.Fatalf("%s %s reached %s, want %s", tc.method, tc.path, rpc, tc.rpc)
+			}
+			if !proto.Equal(got, tc.wantReq) {
+				t.Errorf("%s %s bound request = %v, want %v", tc.method, tc.path, got, tc.wantReq)
+			}
+		})
+	}
+}
+
+// TestHTTPContractCoversAllRoutes fails when an RPC gains or changes its
+// HTTP annotation without a matching contract case
+func TestHTTPContractCoversAllRoutes(t *testing.T) {
+	covered := make(map[string]string)
+	for _, tc := range contractCases {
+		covered[tc.rpc] = tc.method
+	}
+
+	methods := apiv1.File_api_proto_v1_user_proto.Services().ByName("UserService").Methods()
+	for i := 0; i < methods.Len(); i++ {
+		m := methods.Get(i)
+		rule, ok := proto.GetExtension(m.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if !ok || rule == nil {
+			continue
+		}
+
+		var verb string
+		switch rule.GetPattern().(type) {
+		case *annotations.HttpRule_Get:
+			verb = http.MethodGet
+		case *annotations.HttpRule_Post:
+			verb = http.MethodPost
+		case *annotations.HttpRule_Patch:
+			verb = http.MethodPatch
+		case *annotations.HttpRule_Put:
+			verb = http.MethodPut
+		case *annotations.HttpRule_Delete:
+			verb = http.MethodDelete
+		}
+
+		method, ok := covered[string(m.Name())]
+		if !ok {
+			t.Errorf("RPC %s has an HTTP route but no contract case", m.Name())
+			continue
+		}
+		if method != verb {
+			t.Errorf("RPC %s is annotated as %s but its contract case uses %s", m.Name(), verb, method)
+		}
+	}
+}
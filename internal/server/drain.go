@@ -0,0 +1,20 @@
+package server
+
+import "sync/atomic"
+
+// DrainState marks the server as shutting down. Readiness fails once
+// draining starts, so load balancers and Kubernetes endpoints stop sending
+// new requests while the listeners are still open for the ones in flight.
+type DrainState struct {
+	draining atomic.Bool
+}
+
+// Start begins draining. It cannot be undone.
+func (d *DrainState) Start() {
+	d.draining.Store(true)
+}
+
+// Draining reports whether draining has started
+func (d *DrainState) Draining() bool {
+	return d != nil && d.draining.Load()
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// payloadOptions marshal a typed payload the way data.result holds results
+var payloadOptions = protojson.MarshalOptions{UseProtoNames: true, Resolver: response.Resolver}
+
+// envelope is the unwrapped JSON form of CommonResponse
+type envelope struct {
+	ErrorCode int32           `json:"error_code"`
+	ErrorMsg  string          `json:"error_msg"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// envelopeMarshaler sends CommonResponse as plain JSON: error_code,
+// error_msg and data, named like the fields of data. A typed payload is
+// sent as data.result in its message's JSON form, rather than as an Any
+// beside an empty data field. Other values pass through.
+type envelopeMarshaler struct {
+	runtime.Marshaler
+}
+
+func (m *envelopeMarshaler) Marshal(v interface{}) ([]byte, error) {
+	resp, ok := v.(*apiv1.CommonResponse)
+	if !ok {
+		return m.Marshaler.Marshal(v)
+	}
+	data := json.RawMessage("null")
+	switch {
+	case resp.GetPayload() != nil:
+		msg, err := anypb.UnmarshalNew(resp.GetPayload(), proto.UnmarshalOptions{Resolver: response.Resolver})
+		if err != nil {
+			return nil, err
+		}
+		result, err := payloadOptions.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(json.RawMessage(`{"result":`), result...), '}')
+	case resp.GetData() != nil:
+		var err error
+		if data, err = protojson.Marshal(resp.GetData()); err != nil {
+			return nil, err
+		}
+	}
+	// json.Marshal compacts data, whose spacing protojson varies
+	return json.Marshal(envelope{ErrorCode: resp.GetErrorCode(), ErrorMsg: resp.GetErrorMsg(), Data: data})
+}
+
+// envelopeStatus sends the HTTP status matching the error code of a
+// CommonResponse, e.g. 404 for CodeNotFound, instead of 200 for every
+// response
+func envelopeStatus(_ context.Context, w http.ResponseWriter, resp proto.Message) error {
+	if r, ok := resp.(*apiv1.CommonResponse); ok && r.GetErrorCode() != response.CodeSuccess {
+		w.WriteHeader(response.HTTPStatus(r.GetErrorCode()))
+	}
+	return nil
+}
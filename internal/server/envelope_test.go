@@ -0,0 +1,88 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/server"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestUnwrappedEnvelope(t *testing.T) {
+	srv := testutil.NewServer(t, testutil.WithHTTPOptions(server.WithUnwrappedEnvelope()))
+
+	call := func(method, path, body string, header ...string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := srv.HTTPClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var got map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("%s %s returned invalid JSON: %v", method, path, err)
+		}
+		return resp.StatusCode, got
+	}
+
+	status, created := call(http.MethodPost, "/v1/users", `{"email":"ada@example.com","display_name":"Ada"}`)
+	keys := make([]string, 0, len(created))
+	for k := range created {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if status != http.StatusOK || !slices.Equal(keys, []string{"data", "error_code", "error_msg"}) {
+		t.Fatalf("POST /v1/users = %d %v, want 200 with error_code, error_msg and data", status, created)
+	}
+	result, _ := created["data"].(map[string]any)["result"].(map[string]any)
+	if created["error_code"] != float64(0) || result["display_name"] != "Ada" {
+		t.Errorf("POST /v1/users = %v, want error_code 0 and the user", created)
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/v1/users/999", "", http.StatusNotFound},
+		{http.MethodPost, "/v1/users", `{"display_name":"Nobody"}`, http.StatusBadRequest},
+	} {
+		status, got := call(tt.method, tt.path, tt.body)
+		if status != tt.want || got["error_code"] != float64(tt.want) || got["error_msg"] == "" {
+			t.Errorf("%s %s %s = %d %v, want %d with error_code %d", tt.method, tt.path, tt.body, status, got, tt.want, tt.want)
+		}
+	}
+	if _, got := call(http.MethodPost, "/v1/users", `{"display_name":"Nobody"}`); got["data"].(map[string]any)["violations"] == nil {
+		t.Errorf("invalid CreateUser data = %v, want the violations", got["data"])
+	}
+
+	// A typed payload is sent as data.result, in the message's JSON form
+	status, list := call(http.MethodGet, "/v1/users", "", "X-Response-Payload", "any")
+	result, _ = list["data"].(map[string]any)["result"].(map[string]any)
+	if users, _ := result["users"].([]any); status != http.StatusOK || len(users) != 1 || result["total_size"] != float64(1) || list["payload"] != nil {
+		t.Errorf("GET /v1/users with X-Response-Payload = %d %v, want the list in data.result", status, list)
+	}
+
+	// Other encodings get the status too, and MessagePack the same names
+	resp, body := negotiate(t, srv, http.MethodGet, "/v1/users/999", "", server.MIMEMsgpack, nil)
+	var packed struct {
+		ErrorCode int `msgpack:"error_code"`
+	}
+	if err := msgpack.Unmarshal(body, &packed); err != nil || resp.StatusCode != http.StatusNotFound || packed.ErrorCode != 404 {
+		t.Errorf("GET /v1/users/999 as MessagePack = %d %+v (%v), want 404", resp.StatusCode, packed, err)
+	}
+	resp, body = negotiate(t, srv, http.MethodGet, "/v1/users/999", "", server.MIMEProtobuf, nil)
+	var message apiv1.CommonResponse
+	if err := proto.Unmarshal(body, &message); err != nil || resp.StatusCode != http.StatusNotFound || message.GetErrorCode() != 404 {
+		t.Errorf("GET /v1/users/999 as protobuf = %d %v (%v), want 404", resp.StatusCode, &message, err)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/requestid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+	_ "google.golang.org/grpc/health" // client-side health checking
+	"google.golang.org/grpc/keepalive"
+)
+
+// gatewayServiceConfig health-checks the server's liveness, so the connection
+// drops out of READY once the server shuts down but not while it warms up or
+// drains, and retries reads that fail with UNAVAILABLE. Writes are not retried since the server may have
+// applied them; gRPC still retries calls that never left the client.
+const gatewayServiceConfig = `{
+	"healthCheckConfig": {"serviceName": "liveness"},
+	"methodConfig": [{
+		"name": [
+			{"service": "api.v1.UserService", "method": "GetUser"},
+			{"service": "api.v1.UserService", "method": "ListUsers"},
+			{"service": "api.v1.UserService", "method": "BatchGetUsers"},
+			{"service": "api.v2.UserService", "method": "GetUser"},
+			{"service": "api.v2.UserService", "method": "ListUsers"},
+			{"service": "api.v2.UserService", "method": "BatchGetUsers"},
+			{"service": "api.v1.TaskService", "method": "GetTask"},
+			{"service": "api.v1.TaskService", "method": "ListTasks"},
+			{"service": "api.v1.AdminService", "method": "ListJobs"},
+			{"service": "api.v1.AdminService", "method": "ListWebhookDeliveries"},
+			{"service": "api.v1.AdminService", "method": "GetMaintenanceMode"},
+			{"service": "api.v1.AdminService", "method": "ListSettings"},
+			{"service": "api.v1.AdminService", "method": "GetSetting"},
+			{"service": "api.v1.AdminService", "method": "GetInstanceInfo"}
+		],
+		"retryPolicy": {
+			"maxAttempts": 3,
+			"initialBackoff": "0.1s",
+			"maxBackoff": "1s",
+			"backoffMultiplier": 2,
+			"retryableStatusCodes": ["UNAVAILABLE"]
+		}
+	}]
+}`
+
+// GatewayOptions configures the gateway's connection to the gRPC server
+type GatewayOptions struct {
+	// ConnectTimeout bounds the wait for the first connection (default 5s)
+	ConnectTimeout time.Duration
+
+	// MaxBackoff caps the delay between reconnect attempts (default 5s)
+	MaxBackoff time.Duration
+}
+
+// DialGateway creates the connection the gateway shares for all proxied
+// calls. It reconnects with exponential backoff, health-checks the server
+// and returns only once the connection is READY, so a server that cannot be
+// reached fails startup instead of the first request.
+func DialGateway(ctx context.Context, target string, opts GatewayOptions, dialOpts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = 5 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+
+	backoffConfig := backoff.DefaultConfig
+	backoffConfig.BaseDelay = 100 * time.Millisecond
+	backoffConfig.MaxDelay = opts.MaxBackoff
+
+	dialOpts = append([]grpc.DialOption{
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoffConfig,
+			MinConnectTimeout: opts.ConnectTimeout,
+		}),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    30 * time.Second,
+			Timeout: 10 * time.Second,
+		}),
+		grpc.WithDefaultServiceConfig(gatewayServiceConfig),
+		// Calls made for a request carry its ID to the gRPC server
+		grpc.WithChainUnaryInterceptor(requestid.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(requestid.StreamClientInterceptor()),
+	}, dialOpts...)
+
+	conn, err := grpc.NewClient(target, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("create gateway connection: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.ConnectTimeout)
+	defer cancel()
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return conn, nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			conn.Close()
+			return nil, fmt.Errorf("gateway connection to %s not ready after %v, state %s", target, opts.ConnectTimeout, state)
+		}
+	}
+}
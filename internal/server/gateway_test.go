@@ -0,0 +1,300 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/app"
+	"github.com/ChyiYaqing/go-microservice-template/internal/server"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/health"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestDialGatewayFailsFast(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	start := time.Now()
+	_, err = server.DialGateway(context.Background(), addr, server.GatewayOptions{ConnectTimeout: 100 * time.Millisecond},
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err == nil {
+		t.Fatal("DialGateway() to a closed port error = nil, want error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("DialGateway() took %v, want it bounded by the connect timeout", elapsed)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	srv := testutil.NewServer(t)
+
+	get := func() (int, string) {
+		resp, err := srv.HTTPClient.Get(srv.URL + "/ready")
+		if err != nil {
+			t.Fatalf("GET /ready: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get(); code != http.StatusOK || !strings.Contains(body, "READY") {
+		t.Errorf("GET /ready = %d %s, want 200 with the READY state", code, body)
+	}
+
+	srv.GRPCServer.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		code, body := get()
+		if code == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET /ready after the gRPC server stopped = %d %s, want 503", code, body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadinessWarmup(t *testing.T) {
+	srv := testutil.NewServer(t)
+	warmup := &server.WarmupState{}
+	handler, err := server.NewHTTPHandler(context.Background(), srv.Conn, testutil.NopLogger(), srv.Services, server.WithWarmupState(warmup))
+	if err != nil {
+		t.Fatalf("NewHTTPHandler() unexpected error: %v", err)
+	}
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return rec.Code
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /ready while warming up = %d, want 503", code)
+	}
+	warmup.Done()
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("GET /ready after warmup = %d, want 200", code)
+	}
+}
+
+func TestReadinessDraining(t *testing.T) {
+	srv := testutil.NewServer(t)
+	drain := &server.DrainState{}
+	handler, err := server.NewHTTPHandler(context.Background(), srv.Conn, testutil.NopLogger(), srv.Services, server.WithDrainState(drain))
+	if err != nil {
+		t.Fatalf("NewHTTPHandler() unexpected error: %v", err)
+	}
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+
+	get := func(path string) int {
+		resp, err := httpServer.Client().Get(httpServer.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get("/ready"); code != http.StatusOK {
+		t.Errorf("GET /ready before draining = %d, want 200", code)
+	}
+	drain.Start()
+	if code := get("/ready"); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /ready while draining = %d, want 503", code)
+	}
+	if code := get("/v1/users"); code != http.StatusOK {
+		t.Errorf("GET /v1/users while draining = %d, want requests still served", code)
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	srv := testutil.NewServer(t)
+	var usersDown atomic.Bool
+	checker := health.New(testutil.NopLogger(), health.Options{Interval: 10 * time.Millisecond},
+		health.Dependency{Name: "users", Check: func(ctx context.Context) error {
+			if usersDown.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		}},
+		health.Dependency{Name: "cache", Optional: true, Check: func(ctx context.Context) error {
+			return errors.New("redis down")
+		}},
+	)
+	checker.Start(context.Background())
+	t.Cleanup(func() { checker.Stop(context.Background()) })
+	handler, err := server.NewHTTPHandler(context.Background(), srv.Conn, testutil.NopLogger(), srv.Services, server.WithHealth(checker))
+	if err != nil {
+		t.Fatalf("NewHTTPHandler() unexpected error: %v", err)
+	}
+
+	type report struct {
+		Status string
+		Checks map[string]struct{ Status, Error string }
+	}
+	get := func(path string) (int, report) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var r report
+		json.NewDecoder(rec.Body).Decode(&r)
+		return rec.Code, r
+	}
+	// waitFor polls /readyz until the checks have run with the wanted
+	// outcome for users
+	waitFor := func(users string) (int, report) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			code, r := get("/readyz")
+			if r.Checks["users"].Status == users && r.Checks["cache"].Status == "failing" {
+				return code, r
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("GET /readyz = %d %+v, want users %s", code, r, users)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// A failing optional check is reported without failing readiness
+	if code, r := waitFor("ok"); code != http.StatusOK || r.Status != "ready" || r.Checks["gateway"].Status != "ok" || r.Checks["cache"].Error != "redis down" {
+		t.Errorf("GET /readyz = %d %+v, want ready with the cache failing", code, r)
+	}
+	usersDown.Store(true)
+	if code, r := waitFor("failing"); code != http.StatusServiceUnavailable || r.Status != "not ready" || r.Checks["users"].Error != "connection refused" {
+		t.Errorf("GET /readyz with users failing = %d %+v, want 503", code, r)
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want 200", code)
+	}
+	checker.Shutdown()
+	if code, _ := get("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /healthz after shutdown = %d, want 503", code)
+	}
+}
+
+func TestFingerprintHeader(t *testing.T) {
+	srv := testutil.NewServer(t)
+	handler, err := server.NewHTTPHandler(context.Background(), srv.Conn, testutil.NopLogger(), srv.Services, server.WithFingerprint("0123456789ab"))
+	if err != nil {
+		t.Fatalf("NewHTTPHandler() unexpected error: %v", err)
+	}
+	for _, path := range []string{"/health", "/v1/users"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := rec.Header().Get("X-Instance-Fingerprint"); got != "0123456789ab" {
+			t.Errorf("GET %s X-Instance-Fingerprint = %q, want 0123456789ab", path, got)
+		}
+	}
+}
+
+func TestInProcess(t *testing.T) {
+	services, err := app.NewRegistry(app.NewService(&apiv1.UserService_ServiceDesc, service.NewUserService(), apiv1.RegisterUserServiceHandler))
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	inProcess := server.NewInProcess()
+	grpcServer := server.NewGRPCServer(testutil.NopLogger(), services, nil, nil)
+	go grpcServer.Serve(inProcess.Listener())
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := server.DialGateway(context.Background(), inProcess.Target(), server.GatewayOptions{},
+		grpc.WithTransportCredentials(insecure.NewCredentials()), inProcess.DialOption())
+	if err != nil {
+		t.Fatalf("DialGateway() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	handler, err := server.NewHTTPHandler(context.Background(), conn, testutil.NopLogger(), services)
+	if err != nil {
+		t.Fatalf("NewHTTPHandler() error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"errorMsg":"success"`) {
+		t.Errorf("GET /v1/users in-process = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestTypedPayload(t *testing.T) {
+	srv := testutil.NewServer(t)
+	if _, err := srv.Client.CreateUser(context.Background(), &apiv1.CreateUserRequest{User: &apiv1.User{Email: "a@example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(header string) map[string]any {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/users?page_size=1", nil)
+		if header != "" {
+			req.Header.Set("X-Response-Payload", header)
+		}
+		resp, err := srv.HTTPClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	if body := get(""); body["payload"] != nil || body["data"] == nil {
+		t.Errorf("GET /v1/users = %v, want data.result and no payload", body)
+	}
+	body := get("any")
+	payload, _ := body["payload"].(map[string]any)
+	if payload["@type"] != "type.googleapis.com/api.v1.ListUsersResponse" || body["data"] != nil {
+		t.Fatalf("GET /v1/users with X-Response-Payload = %v, want a typed payload", body)
+	}
+	if users, _ := payload["users"].([]any); len(users) != 1 || payload["totalSize"] != float64(1) {
+		t.Errorf("payload = %v, want one user and totalSize 1", payload)
+	}
+}
+
+func TestIdempotencyKeyHeader(t *testing.T) {
+	srv := testutil.NewServer(t)
+
+	create := func(key, email string) string {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v2/users", strings.NewReader(`{"email":"`+email+`"}`))
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := srv.HTTPClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var user struct{ Name string }
+		if err := json.NewDecoder(resp.Body).Decode(&user); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST /v2/users = %d, %v", resp.StatusCode, err)
+		}
+		return user.Name
+	}
+
+	first := create("key-1", "a@example.com")
+	if retry := create("key-1", "a@example.com"); retry != first {
+		t.Errorf("POST /v2/users retry created %s, want %s again", retry, first)
+	}
+	if other := create("key-2", "b@example.com"); other == first {
+		t.Errorf("POST /v2/users with another key returned %s, want a new user", other)
+	}
+}
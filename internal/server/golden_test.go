@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/pagination"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// goldenTime is the fixed clock time so timestamps in golden files are stable
+var goldenTime = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// goldenResponse is what gets recorded for each HTTP call
+type goldenResponse struct {
+	Status int         `json:"status"`
+	Body   interface{} `json:"body"`
+}
+
+func TestGatewayGolden(t *testing.T) {
+	svc := service.NewUserService(
+		service.WithClock(clock.NewFake(goldenTime)),
+		service.WithPageTokens(pagination.NewTokens([]byte("golden"))),
+	)
+	srv := testutil.NewServer(t, testutil.WithUserService(svc))
+
+	// Seed users so reads have something to return
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		do(t, srv, http.MethodPost, "/v1/users", fmt.Sprintf(`{"email":%q,"display_name":"Seed"}`, email))
+	}
+
+	// Cases run in order and share state, e.g. delete_user_not_found relies
+	// on delete_user_force having removed users/1
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "create_user", method: http.MethodPost, path: "/v1/users", body: `{"email":"carol@example.com","display_name":"Carol","phone_number":"+1234567890"}`},
+		{name: "create_user_missing_email", method: http.MethodPost, path: "/v1/users", body: `{"display_name":"Nobody"}`},
+		{name: "create_user_invalid_fields", method: http.MethodPost, path: "/v1/users", body: `{"email":"not-an-email","phone_number":"+1 (555) 0100 0100 0100 0100 0100 0100"}`},
+		{name: "create_user_malformed_body", method: http.MethodPost, path: "/v1/users", body: `{"email":`},
+		{name: "get_user", method: http.MethodGet, path: "/v1/users/1"},
+		{name: "get_user_not_found", method: http.MethodGet, path: "/v1/users/999"},
+		{name: "list_users", method: http.MethodGet, path: "/v1/users"},
+		{name: "list_users_paged", method: http.MethodGet, path: "/v1/users?page_size=1"},
+		{name: "update_user", method: http.MethodPatch, path: "/v1/users/2", body: `{"display_name":"Bobby","is_active":true}`},
+		{name: "batch_get_users", method: http.MethodGet, path: "/v1/users:batchGet?names=users/1&names=users/999"},
+		{name: "delete_user", method: http.MethodDelete, path: "/v1/users/1"},
+		{name: "undelete_user", method: http.MethodPost, path: "/v1/users/1:undelete", body: `{}`},
+		{name: "delete_user_force", method: http.MethodDelete, path: "/v1/users/1?force=true"},
+		{name: "delete_user_not_found", method: http.MethodDelete, path: "/v1/users/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := do(t, srv, tt.method, tt.path, tt.body)
+			assertGolden(t, tt.name, got)
+		})
+	}
+}
+
+// do performs an HTTP call and returns the canonical recorded response
+func do(t *testing.T, srv *testutil.Server, method, path, body string) []byte {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := srv.HTTPClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s unexpected error: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var decoded interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("%s %s returned invalid JSON: %v", method, path, err)
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(goldenResponse{
+		Status: resp.StatusCode,
+		Body:   decoded,
+	}); err != nil {
+		t.Fatalf("failed to marshal response: %v", err)
+	}
+	return out.Bytes()
+}
+
+// assertGolden compares got against testdata/golden/<name>.json, rewriting
+// the file instead when -update is set
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("response mismatch for %s\n--- got ---\n%s\n--- want ---\n%s", path, got, want)
+	}
+}
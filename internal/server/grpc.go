@@ -0,0 +1,84 @@
+package server
+
+import (
+	"slices"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/app"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/health"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/middleware"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/requestid"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/validate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// Orders of the interceptors NewInterceptors registers. Other interceptors
+// go between OrderResponse and OrderValidate: after the request has an ID
+// and a logger, before it is validated and handled.
+const (
+	OrderRequestID = -40
+	OrderLogging   = -30
+	OrderRecovery  = -20
+	OrderResponse  = -10
+	OrderValidate  = 1000
+)
+
+// NewInterceptors returns a registry holding the interceptors every server
+// runs: calls get a request ID, which their log lines carry, panics become
+// INTERNAL errors, error messages are translated into the language callers
+// ask for, and requests are checked against their buf.validate rules right
+// before the handlers.
+func NewInterceptors(log logger.Logger) *middleware.Registry {
+	validator := validate.Default()
+	recovery := middleware.Recovery(log)
+	recovery.Order = OrderRecovery
+
+	r := middleware.NewRegistry()
+	r.Register(middleware.Interceptor{Name: "requestid", Order: OrderRequestID, Unary: requestid.UnaryServerInterceptor(), Stream: requestid.StreamServerInterceptor()})
+	r.Register(middleware.Interceptor{Name: "logging", Order: OrderLogging, Unary: loggingInterceptor(log)})
+	r.Register(recovery)
+	r.Register(middleware.Interceptor{Name: "response", Order: OrderResponse, Unary: response.UnaryServerInterceptor()})
+	r.Register(middleware.Interceptor{Name: "validate", Order: OrderValidate, Unary: validator.UnaryServerInterceptor(), Stream: validator.StreamServerInterceptor()})
+	return r
+}
+
+// NewGRPCServer creates a gRPC server with the registered services, health
+// and reflection, running the chain of interceptors, NewInterceptors when
+// nil. Interceptors of opts run within the chain, right before those from
+// OrderValidate on. checker reports the health of the services; a nil
+// checker reports them all serving.
+func NewGRPCServer(log logger.Logger, services *app.Registry, checker *health.Checker, interceptors *middleware.Registry, opts ...grpc.ServerOption) *grpc.Server {
+	if interceptors == nil {
+		interceptors = NewInterceptors(log)
+	}
+	chain := interceptors.Chain()
+	last := slices.IndexFunc(chain, func(i middleware.Interceptor) bool { return i.Order >= OrderValidate })
+	if last < 0 {
+		last = len(chain)
+	}
+	opts = slices.Concat(middleware.ServerOptions(chain[:last]), opts, middleware.ServerOptions(chain[last:]))
+
+	grpcServer := grpc.NewServer(opts...)
+
+	// Register services
+	services.RegisterGRPC(grpcServer)
+
+	// Register the health service, checked by the gateway connection and
+	// by probes
+	if checker == nil {
+		checker = health.New(log, health.Options{})
+		checker.SetReady()
+	}
+	names := make([]string, 0, len(services.Services()))
+	for _, svc := range services.Services() {
+		names = append(names, svc.Name())
+	}
+	checker.Register(grpcServer, names...)
+
+	// Register reflection service for grpcurl
+	reflection.Register(grpcServer)
+
+	return grpcServer
+}
@@ -0,0 +1,470 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/app"
+	"github.com/ChyiYaqing/go-microservice-template/internal/graphql"
+	"github.com/ChyiYaqing/go-microservice-template/internal/jsonrpc"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/freeze"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/health"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idempotency"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/maintenance"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/metrics"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/ratelimit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/requestid"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/tenant"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/tracing"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// HTTPOption configures the handler created by NewHTTPHandler
+type HTTPOption func(*httpOptions)
+
+type httpOptions struct {
+	compression *CompressionOptions
+	drain       *DrainState
+	warmup      *WarmupState
+	fingerprint string
+	graphql     bool
+	jsonrpc     bool
+	twirpPrefix string
+	connect     bool
+	noGateway   bool
+	unwrap      bool
+	swagger     http.Handler
+	noSwagger   bool
+	metrics     *metrics.Metrics
+	metricsPath bool
+	tracer      *tracing.Tracer
+	health      *health.Checker
+	rateLimits  *ratelimit.Interceptor
+}
+
+// WithCompression gzips API and Swagger responses for clients that accept
+// it, once they reach the cutoff for their content type
+func WithCompression(opts CompressionOptions) HTTPOption {
+	return func(o *httpOptions) {
+		o.compression = &opts
+	}
+}
+
+// WithDrainState fails readiness once drain starts, ahead of shutdown
+func WithDrainState(drain *DrainState) HTTPOption {
+	return func(o *httpOptions) {
+		o.drain = drain
+	}
+}
+
+// WithWarmupState fails readiness until warmup is done
+func WithWarmupState(warmup *WarmupState) HTTPOption {
+	return func(o *httpOptions) {
+		o.warmup = warmup
+	}
+}
+
+// WithHealth reports the checker's dependency checks on /readyz, failing
+// readiness while a required one fails, and fails /healthz once the checker
+// shuts down
+func WithHealth(c *health.Checker) HTTPOption {
+	return func(o *httpOptions) {
+		o.health = c
+	}
+}
+
+// WithRateLimits limits requests by the interceptor's rules on URL paths
+// before they reach the gateway
+func WithRateLimits(limits *ratelimit.Interceptor) HTTPOption {
+	return func(o *httpOptions) {
+		o.rateLimits = limits
+	}
+}
+
+// WithFingerprint sends fingerprint in the X-Instance-Fingerprint header of
+// every response, so callers can tell which build and configuration served
+// them
+func WithFingerprint(fingerprint string) HTTPOption {
+	return func(o *httpOptions) {
+		o.fingerprint = fingerprint
+	}
+}
+
+// WithGraphQL serves a GraphQL endpoint over the UserService RPCs at
+// /graphql, with its schema at /graphql/schema.graphql
+func WithGraphQL() HTTPOption {
+	return func(o *httpOptions) {
+		o.graphql = true
+	}
+}
+
+// WithJSONRPC serves the API's unary methods over JSON-RPC 2.0 at /rpc
+func WithJSONRPC() HTTPOption {
+	return func(o *httpOptions) {
+		o.jsonrpc = true
+	}
+}
+
+// WithTwirp serves the API's unary methods with the Twirp protocol under
+// prefix, e.g. /twirp/api.v1.UserService/GetUser
+func WithTwirp(prefix string) HTTPOption {
+	return func(o *httpOptions) {
+		o.twirpPrefix = prefix
+	}
+}
+
+// WithConnect serves the API with connectrpc, over the Connect, gRPC and
+// gRPC-Web protocols at /<package.Service>/<Method>. gRPC clients need the
+// server to accept HTTP/2 without TLS.
+func WithConnect() HTTPOption {
+	return func(o *httpOptions) {
+		o.connect = true
+	}
+}
+
+// WithoutGateway leaves out the gRPC-Gateway's REST routes, for servers
+// exposing the API with Connect only
+func WithoutGateway() HTTPOption {
+	return func(o *httpOptions) {
+		o.noGateway = true
+	}
+}
+
+// WithUnwrappedEnvelope sends the REST gateway's CommonResponse bodies as
+// plain JSON, with top-level error_code, error_msg and data, and with the
+// HTTP status of the error code instead of 200
+func WithUnwrappedEnvelope() HTTPOption {
+	return func(o *httpOptions) {
+		o.unwrap = true
+	}
+}
+
+// WithSwagger serves h at /swagger/ in place of the open Swagger UI, e.g.
+// one from NewSwaggerHandler that requires admin tokens
+func WithSwagger(h http.Handler) HTTPOption {
+	return func(o *httpOptions) {
+		o.swagger = h
+	}
+}
+
+// WithoutSwagger leaves out the Swagger UI, for servers serving it on an
+// internal listener
+func WithoutSwagger() HTTPOption {
+	return func(o *httpOptions) {
+		o.noSwagger = true
+	}
+}
+
+// WithMetrics records the requests the handler serves in m
+func WithMetrics(m *metrics.Metrics) HTTPOption {
+	return func(o *httpOptions) {
+		o.metrics = m
+	}
+}
+
+// WithMetricsEndpoint serves the metrics recorded by WithMetrics at
+// /metrics. Leave it out when they are served on a port of their own.
+func WithMetricsEndpoint() HTTPOption {
+	return func(o *httpOptions) {
+		o.metricsPath = true
+	}
+}
+
+// WithTracing traces the requests the handler serves, continuing the
+// caller's trace. Dial the gateway connection with the tracer's client
+// interceptors to carry it on to the gRPC server.
+func WithTracing(t *tracing.Tracer) HTTPOption {
+	return func(o *httpOptions) {
+		o.tracer = t
+	}
+}
+
+// NewHTTPHandler creates the HTTP handler serving the registered services'
+// gRPC-Gateway and HTTP routes, Swagger UI and health check, proxying API
+// calls over conn
+func NewHTTPHandler(ctx context.Context, conn *grpc.ClientConn, log logger.Logger, services *app.Registry, opts ...HTTPOption) (http.Handler, error) {
+	var o httpOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	compress := func(next http.Handler) http.Handler {
+		if o.compression == nil {
+			return next
+		}
+		return compressMiddleware(*o.compression, next)
+	}
+
+	// Create HTTP mux for the API and additional routes
+	httpMux := http.NewServeMux()
+
+	if !o.noGateway {
+		// Create gRPC-Gateway mux. MessagePack and events are JSON in
+		// another form, so they unwrap envelopes like JSON does.
+		var jsonMarshaler, bodyMarshaler runtime.Marshaler = gatewayMarshaler.Marshaler, gatewayMarshaler
+		var muxOpts []runtime.ServeMuxOption
+		if o.unwrap {
+			jsonMarshaler = &envelopeMarshaler{Marshaler: jsonMarshaler}
+			bodyMarshaler = &envelopeMarshaler{Marshaler: bodyMarshaler}
+			muxOpts = append(muxOpts, runtime.WithForwardResponseOption(envelopeStatus))
+		}
+		mux := runtime.NewServeMux(append(muxOpts,
+			runtime.WithMarshalerOption(runtime.MIMEWildcard, bodyMarshaler),
+			runtime.WithMarshalerOption(MIMEProtobuf, &protobufMarshaler{}),
+			runtime.WithMarshalerOption(MIMEMsgpack, &msgpackMarshaler{json: jsonMarshaler}),
+			runtime.WithMarshalerOption(MIMEEventStream, &eventStreamMarshaler{Marshaler: jsonMarshaler}),
+			runtime.WithErrorHandler(customErrorHandler),
+			runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+			runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
+		)...)
+
+		// Register service handlers
+		if err := services.RegisterGateway(ctx, mux, conn); err != nil {
+			return nil, fmt.Errorf("failed to register gateway: %w", err)
+		}
+
+		// Streams bypass the ETag and compression middleware, which would
+		// buffer them whole. Each API version has its own, under its prefix.
+		var users []string
+		for _, version := range services.Versions() {
+			users = append(users, "/"+version+"/users")
+			httpMux.Handle("/"+version+"/users:stream", varyAccept(mux))
+			httpMux.Handle("/"+version+"/users:watch", varyAccept(mux))
+		}
+
+		// API routes. User reads carry an ETag so clients can revalidate
+		// with If-None-Match.
+		// Compression wraps the ETag middleware so the tag is taken from the
+		// uncompressed body.
+		// Clients pick JSON, protobuf or MessagePack with Accept and
+		// Content-Type, and streams may also be server-sent events.
+		httpMux.Handle("/", compress(etagMiddleware(users, varyAccept(mux))))
+	}
+
+	// Connect negotiates its own compression, so it is not wrapped
+	if o.connect {
+		registerConnect(httpMux, conn, services.Descriptors()...)
+	}
+
+	if o.twirpPrefix != "" {
+		registerTwirp(httpMux, conn, o.twirpPrefix, services.Descriptors()...)
+	}
+
+	// Swagger UI
+	if !o.noSwagger {
+		swaggerUI := o.swagger
+		if swaggerUI == nil {
+			var err error
+			if swaggerUI, err = NewSwaggerHandler(nil); err != nil {
+				return nil, fmt.Errorf("failed to load Swagger UI: %w", err)
+			}
+		}
+		httpMux.Handle("/swagger/", compress(swaggerUI))
+	}
+
+	if o.graphql {
+		gql, err := graphql.NewHandler(conn, apiv1.File_api_proto_v1_user_proto.Services().ByName("UserService"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GraphQL schema: %w", err)
+		}
+		httpMux.Handle("/graphql", compress(gql))
+		httpMux.Handle("/graphql/schema.graphql", compress(gql))
+	}
+
+	if o.jsonrpc {
+		httpMux.Handle("/rpc", compress(jsonrpc.NewHandler(conn, services.Descriptors()...)))
+	}
+
+	// Routes the services serve outside the gateway
+	services.RegisterHTTP(httpMux)
+
+	if o.metrics != nil && o.metricsPath {
+		httpMux.Handle(metrics.Path, o.metrics.Handler())
+	}
+
+	// Liveness, and readiness of the connection to the gRPC server and the
+	// dependencies. /health and /ready are kept for existing probes.
+	liveness := livenessHandler(o.health)
+	readiness := readinessHandler(conn, o.drain, o.warmup, o.health)
+	httpMux.HandleFunc("/healthz", liveness)
+	httpMux.HandleFunc("/health", liveness)
+	httpMux.HandleFunc("/readyz", readiness)
+	httpMux.HandleFunc("/ready", readiness)
+
+	var routes http.Handler = httpMux
+	if o.rateLimits != nil {
+		routes = o.rateLimits.Middleware(routes)
+	}
+	handler := requestid.Middleware(corsMiddleware(loggingMiddleware(log, forwardedHost(routes))))
+	if o.metrics != nil {
+		handler = o.metrics.Middleware(handler)
+	}
+	if o.tracer != nil {
+		handler = o.tracer.Middleware(handler)
+	}
+	if o.fingerprint != "" {
+		handler = fingerprintMiddleware(o.fingerprint, handler)
+	}
+	return handler, nil
+}
+
+// gatewayMarshaler is the gateway's default JSON marshaler, resolving typed
+// payloads with the registry of payload types as well as linked types
+var gatewayMarshaler = &runtime.HTTPBodyMarshaler{
+	Marshaler: &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{
+			EmitUnpopulated: true,
+			Resolver:        response.Resolver,
+		},
+		UnmarshalOptions: protojson.UnmarshalOptions{
+			DiscardUnknown: true,
+		},
+	},
+}
+
+// customErrorHandler handles errors from gRPC-Gateway
+func customErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+}
+
+// incomingHeaderMatcher forwards the freeze override, payload, tenant,
+// language, request ID and idempotency key headers as metadata, alongside
+// the headers the gateway forwards by default
+func incomingHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, idempotency.Header) {
+		return idempotency.Header, true
+	}
+	if strings.EqualFold(key, requestid.Header) {
+		return requestid.Header, true
+	}
+	if strings.EqualFold(key, response.LanguageHeader) {
+		return response.LanguageHeader, true
+	}
+	if strings.EqualFold(key, tenant.Header) {
+		return tenant.Header, true
+	}
+	if strings.EqualFold(key, freeze.OverrideHeader) {
+		return freeze.OverrideHeader, true
+	}
+	if strings.EqualFold(key, response.PayloadHeader) {
+		return response.PayloadHeader, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeaderMatcher forwards the maintenance retry delay as a standard
+// Retry-After header, the language of translated error messages as
+// Content-Language, and other response metadata with the gateway's
+// Grpc-Metadata- prefix. The request ID is left out, X-Request-Id is set
+// already.
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if key == requestid.Header {
+		return "", false
+	}
+	if key == maintenance.RetryAfterHeader {
+		return "Retry-After", true
+	}
+	if key == response.ContentLanguageHeader {
+		return "Content-Language", true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// livenessHandler reports the process alive until checker, when set, shuts
+// down
+func livenessHandler(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if checker != nil && !checker.Live() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"stopped"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ok"}`))
+	}
+}
+
+// readinessReport is the body of readiness responses
+type readinessReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkReport `json:"checks"`
+}
+
+// checkReport is the outcome of one readiness check: "ok", "failing", or
+// "pending" until it first runs
+type checkReport struct {
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	State    string     `json:"state,omitempty"`
+	Optional bool       `json:"optional,omitempty"`
+	Since    *time.Time `json:"since,omitempty"`
+}
+
+// readinessHandler reports ready while the gateway connection is READY, the
+// required dependency checks of checker pass and the server is neither
+// warming up nor draining. Every check is reported so a failing probe says
+// why.
+func readinessHandler(conn *grpc.ClientConn, drain *DrainState, warmup *WarmupState, checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := readinessReport{Status: "ready", Checks: make(map[string]checkReport)}
+
+		state := conn.GetState()
+		if state == connectivity.Idle {
+			// Idle connections reconnect lazily, start now so the next
+			// probe can pass
+			conn.Connect()
+		}
+		gateway := checkReport{Status: "ok", State: state.String()}
+		if state != connectivity.Ready {
+			gateway.Status = "failing"
+			report.Status = "not ready"
+		}
+		report.Checks["gateway"] = gateway
+
+		if checker != nil {
+			for _, result := range checker.Results() {
+				check := checkReport{Status: "ok", Optional: result.Optional}
+				switch {
+				case !result.Checked:
+					check.Status = "pending"
+				case !result.Healthy():
+					check.Status = "failing"
+					check.Error = result.Err.Error()
+					if !result.Optional {
+						report.Status = "not ready"
+					}
+				}
+				if result.Checked {
+					since := result.Since
+					check.Since = &since
+				}
+				report.Checks[result.Name] = check
+			}
+		}
+
+		switch {
+		case drain.Draining():
+			report.Status = "draining"
+		case warmup.Warming():
+			report.Status = "warming up"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != "ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
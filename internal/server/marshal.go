@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Media types REST clients may send in Content-Type, or ask for in Accept,
+// instead of JSON
+const (
+	MIMEProtobuf    = "application/x-protobuf"
+	MIMEMsgpack     = "application/msgpack"
+	MIMEEventStream = "text/event-stream"
+)
+
+// protobufMarshaler sends messages in the protobuf binary format. Bodies
+// the gateway binds to a single field are decoded as that field's message.
+// Stream chunks are not messages and fail to marshal, so streams are served
+// as JSON or MessagePack only.
+type protobufMarshaler struct {
+	runtime.ProtoMarshaller
+}
+
+// ContentType names the protobuf media type clients asked for, rather than
+// ProtoMarshaller's application/octet-stream
+func (*protobufMarshaler) ContentType(_ interface{}) string {
+	return MIMEProtobuf
+}
+
+// Marshal is deterministic, so the ETag of a body does not depend on the
+// order of its map entries
+func (*protobufMarshaler) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.New("unable to marshal non proto field")
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+func (m *protobufMarshaler) Unmarshal(data []byte, v interface{}) error {
+	msg, err := protoTarget(v)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+func (m *protobufMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return m.Unmarshal(data, v)
+	})
+}
+
+// protoTarget returns the message v decodes into: v itself, or the message
+// v points to, allocated if nil
+func protoTarget(v interface{}) (proto.Message, error) {
+	if msg, ok := v.(proto.Message); ok {
+		return msg, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		if msg, ok := rv.Elem().Interface().(proto.Message); ok {
+			return msg, nil
+		}
+	}
+	return nil, errors.New("unable to unmarshal non proto field")
+}
+
+// msgpackMarshaler sends the gateway's JSON representation as MessagePack:
+// the same fields and names, in a smaller binary form. Integers stay
+// integers; int64 values are strings, as in JSON.
+type msgpackMarshaler struct {
+	json runtime.Marshaler
+}
+
+func (*msgpackMarshaler) ContentType(_ interface{}) string {
+	return MIMEMsgpack
+}
+
+func (m *msgpackMarshaler) Marshal(v interface{}) ([]byte, error) {
+	data, err := m.json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	// Sorted keys keep the body, and so its ETag, the same from call to call
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(jsonNumbers(value)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (m *msgpackMarshaler) Unmarshal(data []byte, v interface{}) error {
+	var value interface{}
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return m.fromValue(value, v)
+}
+
+func (m *msgpackMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	dec := msgpack.NewDecoder(r)
+	return runtime.DecoderFunc(func(v interface{}) error {
+		value, err := dec.DecodeInterface()
+		if err != nil {
+			return err
+		}
+		return m.fromValue(value, v)
+	})
+}
+
+func (m *msgpackMarshaler) NewEncoder(w io.Writer) runtime.Encoder {
+	return runtime.EncoderFunc(func(v interface{}) error {
+		data, err := m.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// Delimiter is empty: MessagePack values are self-delimiting, so stream
+// chunks are written back to back
+func (*msgpackMarshaler) Delimiter() []byte {
+	return nil
+}
+
+// eventStreamMarshaler serves streams as server-sent events, for browsers'
+// EventSource: each chunk the gateway sends, {"result": ...} or {"error":
+// ...}, is the JSON data of one event. Anything else is JSON, as requests
+// asking for events have no body to decode.
+type eventStreamMarshaler struct {
+	runtime.Marshaler
+}
+
+func (*eventStreamMarshaler) ContentType(_ interface{}) string {
+	return MIMEEventStream
+}
+
+// Marshal prefixes the JSON with the data field. The gateway's JSON is on
+// one line, so it is a single field.
+func (m *eventStreamMarshaler) Marshal(v interface{}) ([]byte, error) {
+	data, err := m.Marshaler.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("data: "), data...), nil
+}
+
+// Delimiter ends an event with a blank line
+func (*eventStreamMarshaler) Delimiter() []byte {
+	return []byte("\n\n")
+}
+
+// fromValue decodes a MessagePack value into v through its JSON form
+func (m *msgpackMarshaler) fromValue(value, v interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return m.json.Unmarshal(data, v)
+}
+
+// jsonNumbers replaces the json.Numbers in v with integers where they fit
+// and floats otherwise
+func jsonNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonNumbers(e)
+		}
+	}
+	return v
+}
+
+// varyAccept marks responses as depending on Accept and Accept-Language,
+// so caches keep the JSON and binary forms of a resource, and its error
+// messages in each language, apart
+func varyAccept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,164 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/server"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/events"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+func negotiate(t *testing.T, srv *testutil.Server, method, path, contentType, accept string, body []byte) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(method, srv.URL+path, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := srv.HTTPClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, b
+}
+
+func TestProtobufContent(t *testing.T) {
+	srv := testutil.NewServer(t)
+
+	user, _ := proto.Marshal(&apiv1.User{Email: "ada@example.com", DisplayName: "Ada"})
+	resp, body := negotiate(t, srv, http.MethodPost, "/v1/users", server.MIMEProtobuf, "", user)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != server.MIMEProtobuf {
+		t.Fatalf("POST /v1/users = %d %q %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	var created apiv1.CommonResponse
+	if err := proto.Unmarshal(body, &created); err != nil {
+		t.Fatalf("decode CreateUser response: %v", err)
+	}
+	name := created.GetData().GetFields()["result"].GetStructValue().GetFields()["name"].GetStringValue()
+	if created.GetErrorCode() != 0 || name == "" {
+		t.Fatalf("CreateUser = %v, want a user", &created)
+	}
+
+	// JSON in, protobuf out
+	resp, body = negotiate(t, srv, http.MethodGet, "/v1/"+name, "application/json", server.MIMEProtobuf, nil)
+	var got apiv1.CommonResponse
+	if err := proto.Unmarshal(body, &got); err != nil {
+		t.Fatalf("decode GetUser response: %v", err)
+	}
+	if email := got.GetData().GetFields()["result"].GetStructValue().GetFields()["email"].GetStringValue(); email != "ada@example.com" {
+		t.Errorf("GetUser email = %q, want ada@example.com", email)
+	}
+	if vary := resp.Header.Values("Vary"); !slices.Contains(vary, "Accept") {
+		t.Errorf("Vary = %q, want Accept", vary)
+	}
+
+	_, again := negotiate(t, srv, http.MethodGet, "/v1/"+name, "", server.MIMEProtobuf, nil)
+	if !bytes.Equal(body, again) {
+		t.Error("GetUser protobuf bodies differ between calls, want a stable encoding for ETags")
+	}
+}
+
+func TestMsgpackContent(t *testing.T) {
+	srv := testutil.NewServer(t)
+
+	user, _ := msgpack.Marshal(map[string]any{"email": "ada@example.com", "displayName": "Ada"})
+	resp, body := negotiate(t, srv, http.MethodPost, "/v1/users", server.MIMEMsgpack, "", user)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != server.MIMEMsgpack {
+		t.Fatalf("POST /v1/users = %d %q %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	var created struct {
+		ErrorCode *int `msgpack:"errorCode"`
+		Data      struct {
+			Result struct {
+				Name        string `msgpack:"name"`
+				DisplayName string `msgpack:"display_name"`
+			} `msgpack:"result"`
+		} `msgpack:"data"`
+	}
+	if err := msgpack.Unmarshal(body, &created); err != nil {
+		t.Fatalf("decode CreateUser response: %v", err)
+	}
+	if created.ErrorCode == nil || *created.ErrorCode != 0 || created.Data.Result.DisplayName != "Ada" {
+		t.Fatalf("CreateUser = %+v, want errorCode 0 and the user", created)
+	}
+
+	// Entity tags depend on the body, so repeated reads must encode the
+	// same way
+	resp, body = negotiate(t, srv, http.MethodGet, "/v1/users", "", server.MIMEMsgpack, nil)
+	_, again := negotiate(t, srv, http.MethodGet, "/v1/users", "", server.MIMEMsgpack, nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, again) {
+		t.Errorf("GET /v1/users = %d, bodies equal %v, want 200 and a stable encoding", resp.StatusCode, bytes.Equal(body, again))
+	}
+	var list map[string]any
+	if err := msgpack.Unmarshal(body, &list); err != nil {
+		t.Fatalf("decode ListUsers response: %v", err)
+	}
+
+	resp, _ = negotiate(t, srv, http.MethodPost, "/v1/users", server.MIMEMsgpack, "", []byte{0xc1})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /v1/users with malformed MessagePack = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	bus := events.NewBus[service.UserEvent](logger.Nop())
+	srv := testutil.NewServer(t, testutil.WithUserService(service.NewUserService(service.WithEventBus(bus))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/users:watch?types=user.created", nil)
+	req.Header.Set("Accept", server.MIMEEventStream)
+	resps := make(chan *http.Response, 1)
+	go func() {
+		resp, err := srv.HTTPClient.Do(req)
+		if err != nil {
+			t.Errorf("GET /v1/users:watch: %v", err)
+			close(resps)
+			return
+		}
+		resps <- resp
+	}()
+	for len(bus.Stats()) == 0 {
+		if ctx.Err() != nil {
+			t.Fatal("GET /v1/users:watch did not subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := srv.Client.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada@example.com"}}); err != nil {
+		t.Fatalf("CreateUser() unexpected error: %v", err)
+	}
+	resp, ok := <-resps
+	if !ok {
+		return
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != server.MIMEEventStream {
+		t.Errorf("Content-Type = %q, want %s", ct, server.MIMEEventStream)
+	}
+
+	// An event is a data line followed by a blank line
+	r := bufio.NewReader(resp.Body)
+	line, _ := r.ReadString('\n')
+	blank, _ := r.ReadString('\n')
+	if !strings.HasPrefix(line, `data: {"result":{"type":"user.created"`) || !strings.Contains(line, "ada@example.com") || blank != "\n" {
+		t.Errorf("event = %q%q, want a data line with the user.created event", line, blank)
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/requestid"
+	"google.golang.org/grpc"
+)
+
+// loggingInterceptor logs gRPC requests, and puts a logger with the
+// request's method and ID in its context
+func loggingInterceptor(log logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		reqLog := log.WithFields(logger.Fields{"method": info.FullMethod, "request_id": requestid.FromContext(ctx)})
+		start := time.Now()
+		resp, err := handler(logger.WithContext(ctx, reqLog), req)
+		duration := time.Since(start)
+
+		reqLog = reqLog.WithFields(logger.Fields{"duration": duration.String()})
+		if err != nil {
+			reqLog.Error("gRPC %s failed: %v", info.FullMethod, err)
+		} else {
+			reqLog.Info("gRPC %s succeeded", info.FullMethod)
+		}
+
+		return resp, err
+	}
+}
+
+// loggingMiddleware logs HTTP requests, and puts a logger with the request's
+// method, path and ID in its context
+func loggingMiddleware(log logger.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqLog := log.WithFields(logger.Fields{"http_method": r.Method, "path": r.URL.Path, "request_id": requestid.FromContext(r.Context())})
+		start := time.Now()
+		next.ServeHTTP(w, r.WithContext(logger.WithContext(r.Context(), reqLog)))
+		duration := time.Since(start)
+		reqLog.WithFields(logger.Fields{"duration": duration.String()}).Info("HTTP %s %s", r.Method, r.URL.Path)
+	})
+}
+
+// CORS header values, shared by every response instead of allocated by
+// Header.Set. Their capacity equals their length, so a later Header.Add
+// copies rather than writing into them.
+var (
+	corsAllowOrigin  = []string{"*"}
+	corsAllowMethods = []string{"GET, POST, PATCH, DELETE, OPTIONS"}
+	corsAllowHeaders = []string{"Content-Type, Authorization, Connect-Protocol-Version, Connect-Timeout-Ms, Grpc-Timeout, X-Grpc-Web, X-User-Agent, X-Tenant-Id, X-Request-Id"}
+
+	// Browser gRPC-Web clients read the status from these headers, and
+	// any client the request ID
+	corsExposeHeaders = []string{"Grpc-Status, Grpc-Message, Grpc-Status-Details-Bin, X-Request-Id"}
+)
+
+// forwardedHost records the host the client called in X-Forwarded-Host,
+// unless a proxy in front already did, so the tenant's subdomain reaches
+// the gRPC server however the request is proxied
+func forwardedHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Forwarded-Host") == "" && r.Host != "" {
+			r.Header.Set("X-Forwarded-Host", r.Host)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsMiddleware adds CORS headers
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h["Access-Control-Allow-Origin"] = corsAllowOrigin
+		h["Access-Control-Allow-Methods"] = corsAllowMethods
+		h["Access-Control-Allow-Headers"] = corsAllowHeaders
+		h["Access-Control-Expose-Headers"] = corsExposeHeaders
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// fingerprintMiddleware adds the X-Instance-Fingerprint header
+func fingerprintMiddleware(fingerprint string, next http.Handler) http.Handler {
+	value := []string{fingerprint}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["X-Instance-Fingerprint"] = value
+		next.ServeHTTP(w, r)
+	})
+}
+
+// etagMiddleware adds an ETag derived from the body to successful GET
+// responses under one of prefixes, and answers 304 Not Modified when it
+// matches the request's If-None-Match
+func etagMiddleware(prefixes []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !slices.ContainsFunc(prefixes, func(prefix string) bool { return strings.HasPrefix(r.URL.Path, prefix) }) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := bufferedResponses.Get().(*bufferedResponse)
+		rec.header, rec.status = w.Header(), http.StatusOK
+		defer rec.release()
+		next.ServeHTTP(rec, r)
+
+		if rec.status != http.StatusOK {
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+			return
+		}
+
+		etag := bodyETag(rec.body.Bytes())
+		w.Header()["Etag"] = []string{etag}
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+// bodyETag returns a strong ETag of the first 128 bits of body's SHA-256
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	var tag [34]byte
+	tag[0], tag[33] = '"', '"'
+	hex.Encode(tag[1:33], sum[:16])
+	return string(tag[:])
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison RFC 9110 requires for If-None-Match
+func etagMatches(header, etag string) bool {
+	for header != "" {
+		var candidate string
+		candidate, header, _ = strings.Cut(header, ",")
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// maxPooledBody bounds the buffers kept for reuse, so one large response
+// does not pin its memory in the pool
+const maxPooledBody = 64 << 10
+
+// bufferedResponses holds response buffers for reuse across requests
+var bufferedResponses = sync.Pool{
+	New: func() interface{} { return new(bufferedResponse) },
+}
+
+// bufferedResponse holds a response back so headers can still be changed
+// once the body is known
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// release returns b to the pool
+func (b *bufferedResponse) release() {
+	if b.body.Cap() > maxPooledBody {
+		return
+	}
+	b.header = nil
+	b.body.Reset()
+	bufferedResponses.Put(b)
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(status int) { b.status = status }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+func TestETagMiddleware(t *testing.T) {
+	body := `{"error_code":0,"data":{"result":{"name":"users/1"}}}`
+	handler := etagMiddleware([]string{"/v1/users"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/users/404" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/v1/users/1", nil))
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Body.String() != body {
+		t.Fatalf("first GET = %d with ETag %q and body %q, want 200 with an ETag and the body", first.Code, etag, first.Body)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		ifNoneMatch string
+		wantCode    int
+		wantETag    bool
+	}{
+		{"matching", http.MethodGet, "/v1/users/1", etag, http.StatusNotModified, true},
+		{"weak and listed", http.MethodGet, "/v1/users/1", `"other", W/` + etag, http.StatusNotModified, true},
+		{"wildcard", http.MethodGet, "/v1/users/1", "*", http.StatusNotModified, true},
+		{"stale", http.MethodGet, "/v1/users/1", `"other"`, http.StatusOK, true},
+		{"error status", http.MethodGet, "/v1/users/404", etag, http.StatusNotFound, false},
+		{"not a GET", http.MethodPatch, "/v1/users/1", etag, http.StatusOK, false},
+		{"other route", http.MethodGet, "/v1/jobs", etag, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("ETag") != ""; got != tt.wantETag {
+				t.Errorf("has ETag = %v, want %v", got, tt.wantETag)
+			}
+			if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("304 body = %q, want empty", rec.Body)
+			}
+		})
+	}
+}
+
+// BenchmarkHTTPMiddleware measures the per-request overhead of the
+// middleware chain around a cacheable user read
+func BenchmarkHTTPMiddleware(b *testing.B) {
+	body := []byte(`{"error_code":0,"error_msg":"success","data":{"result":{"name":"users/1","email":"alice@example.com","display_name":"Alice"}}}`)
+	handler := corsMiddleware(loggingMiddleware(logger.Nop(), etagMiddleware([]string{"/v1/users"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))))
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/1", nil)
+	w := discardResponse{header: http.Header{}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		handler.ServeHTTP(w, req)
+	}
+}
+
+// discardResponse is a ResponseWriter that keeps nothing but headers
+type discardResponse struct {
+	header http.Header
+}
+
+func (d discardResponse) Header() http.Header { return d.header }
+
+func (d discardResponse) Write(p []byte) (int, error) { return len(p), nil }
+
+func (d discardResponse) WriteHeader(int) {}
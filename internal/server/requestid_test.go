@@ -0,0 +1,75 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/requestid"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestID(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen string
+	)
+	record := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		mu.Lock()
+		seen = requestid.FromContext(ctx)
+		mu.Unlock()
+		return handler(ctx, req)
+	}
+	srv := testutil.NewServer(t, testutil.WithServerOptions(grpc.ChainUnaryInterceptor(record)))
+
+	tests := []struct {
+		name string
+		sent string
+		// keep is whether the sent ID is used rather than a new one
+		keep bool
+	}{
+		{name: "sent", sent: "req-1", keep: true},
+		{name: "none"},
+		{name: "with spaces", sent: "req 1"},
+		{name: "too long", sent: strings.Repeat("a", 129)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/users", nil)
+			if tt.sent != "" {
+				req.Header.Set("X-Request-Id", tt.sent)
+			}
+			resp, err := srv.HTTPClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			got := resp.Header.Values("X-Request-Id")
+			if len(got) != 1 || !requestid.Valid(got[0]) || (got[0] == tt.sent) != tt.keep {
+				t.Fatalf("X-Request-Id = %q for %q sent, want one ID, the sent one: %v", got, tt.sent, tt.keep)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if seen != got[0] {
+				t.Errorf("request ID in the gRPC handler = %q, want %q", seen, got[0])
+			}
+		})
+	}
+
+	// gRPC clients get the ID back in the response header, and calls made
+	// while serving a request carry its ID
+	var header metadata.MD
+	ctx := requestid.WithID(context.Background(), "req-2")
+	if _, err := srv.Client.ListUsers(ctx, &apiv1.ListUsersRequest{}, grpc.Header(&header)); err != nil {
+		t.Fatalf("ListUsers() error = %v", err)
+	}
+	if got := header.Get(requestid.Header); len(got) != 1 || got[0] != "req-2" || seen != "req-2" {
+		t.Errorf("x-request-id = %q, in the handler %q, want req-2", got, seen)
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/ChyiYaqing/go-microservice-template/docs/swagger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// mergedSpec is the spec protoc-gen-openapiv2 merges the protos into
+const mergedSpec = "api.swagger.json"
+
+// adminTag tags the AdminService operations, which get a spec of their own
+const adminTag = "Admin"
+
+// swaggerSpec is an entry of the Swagger UI's spec dropdown
+type swaggerSpec struct {
+	URL  string `json:"url"`
+	Name string `json:"name"`
+}
+
+// NewSwaggerHandler serves the embedded Swagger UI at /swagger/ with a
+// dropdown of specs: v1, the public API, and admin, the AdminService,
+// split from the merged spec, then any other generated spec by its file
+// name, e.g. v2 for v2.swagger.json. The merged spec stays at
+// /swagger/api.swagger.json. With authn, every request needs an admin
+// token, as a bearer token or as the password of HTTP basic auth, which
+// browsers prompt for.
+func NewSwaggerHandler(authn *auth.TokenAuthenticator) (http.Handler, error) {
+	index, err := fs.ReadFile(swagger.FS, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	config, specs, err := loadSpecs(swagger.FS)
+	if err != nil {
+		return nil, err
+	}
+	assets := http.StripPrefix("/swagger", http.FileServerFS(swaggerFiles.FS))
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/swagger/")
+		switch {
+		case name == "" || name == "index.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(index)
+		case name == "swagger-config.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(config)
+		case specs[name] != nil:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(specs[name])
+		default:
+			assets.ServeHTTP(w, r)
+		}
+	})
+	if authn != nil {
+		handler = requireAdminToken(authn, handler)
+	}
+	return handler, nil
+}
+
+// loadSpecs reads the generated specs in fsys. It returns the Swagger UI
+// configuration listing them, and the specs by their path under /swagger/.
+func loadSpecs(fsys fs.FS) ([]byte, map[string][]byte, error) {
+	names, err := fs.Glob(fsys, "*.swagger.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	specs := make(map[string][]byte, len(names)+2)
+	var urls, adminURLs []swaggerSpec
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		specs[name] = data
+		if name != mergedSpec {
+			urls = append(urls, swaggerSpec{URL: "/swagger/" + name, Name: strings.TrimSuffix(name, ".swagger.json")})
+			continue
+		}
+
+		public, admin, err := splitSpec(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to split %s: %w", name, err)
+		}
+		specs["specs/v1.json"], specs["specs/admin.json"] = public, admin
+		urls = append([]swaggerSpec{{URL: "/swagger/specs/v1.json", Name: "v1"}}, urls...)
+		adminURLs = append(adminURLs, swaggerSpec{URL: "/swagger/specs/admin.json", Name: "admin"})
+	}
+
+	config, err := json.Marshal(map[string]interface{}{
+		"urls":             append(urls, adminURLs...),
+		"urls.primaryName": "v1",
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, specs, nil
+}
+
+// splitSpec splits a spec into the operations not tagged adminTag and the
+// ones that are. Both keep every definition.
+func splitSpec(data []byte) (public, admin []byte, err error) {
+	var spec map[string]json.RawMessage
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, nil, err
+	}
+	var paths map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(spec["paths"], &paths); err != nil {
+		return nil, nil, err
+	}
+
+	publicPaths := make(map[string]map[string]json.RawMessage)
+	adminPaths := make(map[string]map[string]json.RawMessage)
+	for path, item := range paths {
+		for method, op := range item {
+			var tagged struct {
+				Tags []string `json:"tags"`
+			}
+			if err := json.Unmarshal(op, &tagged); err != nil {
+				return nil, nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			target := publicPaths
+			for _, tag := range tagged.Tags {
+				if tag == adminTag {
+					target = adminPaths
+				}
+			}
+			if target[path] == nil {
+				target[path] = make(map[string]json.RawMessage)
+			}
+			target[path][method] = op
+		}
+	}
+
+	withPaths := func(paths map[string]map[string]json.RawMessage) ([]byte, error) {
+		raw, err := json.Marshal(paths)
+		if err != nil {
+			return nil, err
+		}
+		spec["paths"] = raw
+		return json.Marshal(spec)
+	}
+	if public, err = withPaths(publicPaths); err != nil {
+		return nil, nil, err
+	}
+	if admin, err = withPaths(adminPaths); err != nil {
+		return nil, nil, err
+	}
+	return public, admin, nil
+}
+
+// requireAdminToken rejects requests without one of authn's tokens, sent
+// as a bearer token or as the password of HTTP basic auth
+func requireAdminToken(authn *auth.TokenAuthenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if _, password, ok := r.BasicAuth(); ok {
+			token = password
+		} else if scheme, t, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "bearer") {
+			token = t
+		}
+		if _, ok := authn.Lookup(token); !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="API documentation"`)
+			http.Error(w, "an admin token is required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
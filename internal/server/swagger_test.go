@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+)
+
+func TestLoadSpecs(t *testing.T) {
+	merged := `{"swagger": "2.0", "paths": {
+		"/v1/users": {"get": {"tags": ["Users"]}, "post": {"tags": ["Users"]}},
+		"/v1/maintenance": {"get": {"tags": ["Admin"]}}
+	}, "definitions": {"v1User": {}}}`
+	config, specs, err := loadSpecs(fstest.MapFS{
+		"api.swagger.json": {Data: []byte(merged)},
+		"v2.swagger.json":  {Data: []byte(`{"swagger": "2.0"}`)},
+	})
+	if err != nil {
+		t.Fatalf("loadSpecs() unexpected error: %v", err)
+	}
+
+	var got struct {
+		URLs []swaggerSpec `json:"urls"`
+	}
+	json.Unmarshal(config, &got)
+	want := []string{"v1", "v2", "admin"}
+	if len(got.URLs) != len(want) {
+		t.Fatalf("config urls = %+v, want %v", got.URLs, want)
+	}
+	for i, name := range want {
+		if got.URLs[i].Name != name || specs[strings.TrimPrefix(got.URLs[i].URL, "/swagger/")] == nil {
+			t.Errorf("config urls[%d] = %+v, want %s with a spec", i, got.URLs[i], name)
+		}
+	}
+
+	paths := func(name string) map[string]map[string]json.RawMessage {
+		var spec struct {
+			Paths       map[string]map[string]json.RawMessage `json:"paths"`
+			Definitions map[string]json.RawMessage            `json:"definitions"`
+		}
+		json.Unmarshal(specs[name], &spec)
+		if spec.Definitions["v1User"] == nil {
+			t.Errorf("%s has no definitions, want them all kept", name)
+		}
+		return spec.Paths
+	}
+	if p := paths("specs/v1.json"); len(p) != 1 || len(p["/v1/users"]) != 2 {
+		t.Errorf("v1 paths = %v, want the user operations only", p)
+	}
+	if p := paths("specs/admin.json"); len(p) != 1 || p["/v1/maintenance"] == nil {
+		t.Errorf("admin paths = %v, want the admin operations only", p)
+	}
+}
+
+func TestSwaggerHandler(t *testing.T) {
+	handler, err := NewSwaggerHandler(nil)
+	if err != nil {
+		t.Fatalf("NewSwaggerHandler() unexpected error: %v", err)
+	}
+	for path, wantType := range map[string]string{
+		"/swagger/":                     "text/html; charset=utf-8",
+		"/swagger/swagger-config.json":  "application/json",
+		"/swagger/specs/admin.json":     "application/json",
+		"/swagger/api.swagger.json":     "application/json",
+		"/swagger/swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != wantType {
+			t.Errorf("GET %s = %d %q, want 200 %q", path, rec.Code, rec.Header().Get("Content-Type"), wantType)
+		}
+	}
+}
+
+func TestSwaggerHandlerAuth(t *testing.T) {
+	handler, err := NewSwaggerHandler(auth.NewTokenAuthenticator([]auth.Token{{Name: "ops", Token: "s3cret"}}))
+	if err != nil {
+		t.Fatalf("NewSwaggerHandler() unexpected error: %v", err)
+	}
+	tests := []struct {
+		name       string
+		setAuth    func(*http.Request)
+		wantStatus int
+	}{
+		{"none", func(*http.Request) {}, http.StatusUnauthorized},
+		{"basic", func(r *http.Request) { r.SetBasicAuth("anyone", "s3cret") }, http.StatusOK},
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusOK},
+		{"wrong token", func(r *http.Request) { r.SetBasicAuth("ops", "guess") }, http.StatusUnauthorized},
+		{"empty password", func(r *http.Request) { r.SetBasicAuth("ops", "") }, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/swagger/specs/admin.json", nil)
+			tt.setAuth(req)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code == http.StatusUnauthorized && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic") {
+				t.Errorf("WWW-Authenticate = %q, want a basic auth challenge", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
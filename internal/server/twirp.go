@@ -0,0 +1,138 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/twitchtv/twirp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// twirpMaxBodySize matches the gRPC server's default message size limit
+const twirpMaxBodySize = 4 << 20
+
+// twirpCodes maps gRPC codes to Twirp's
+var twirpCodes = map[codes.Code]twirp.ErrorCode{
+	codes.Canceled:           twirp.Canceled,
+	codes.Unknown:            twirp.Unknown,
+	codes.InvalidArgument:    twirp.InvalidArgument,
+	codes.DeadlineExceeded:   twirp.DeadlineExceeded,
+	codes.NotFound:           twirp.NotFound,
+	codes.AlreadyExists:      twirp.AlreadyExists,
+	codes.PermissionDenied:   twirp.PermissionDenied,
+	codes.ResourceExhausted:  twirp.ResourceExhausted,
+	codes.FailedPrecondition: twirp.FailedPrecondition,
+	codes.Aborted:            twirp.Aborted,
+	codes.OutOfRange:         twirp.OutOfRange,
+	codes.Unimplemented:      twirp.Unimplemented,
+	codes.Internal:           twirp.Internal,
+	codes.Unavailable:        twirp.Unavailable,
+	codes.DataLoss:           twirp.DataLoss,
+	codes.Unauthenticated:    twirp.Unauthenticated,
+}
+
+// twirpJSON marshals like Twirp's generated servers: proto field names,
+// with default values included
+var twirpJSON = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// registerTwirp serves the unary methods of services on mux with the Twirp
+// protocol: POST <prefix>/<package.Service>/<Method> with a protobuf or
+// JSON body. Like Connect, messages are built from the descriptors and
+// calls proxied over conn. Twirp has no streaming, so streaming methods are
+// left out.
+func registerTwirp(mux *http.ServeMux, conn grpc.ClientConnInterface, prefix string, services ...protoreflect.ServiceDescriptor) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	for _, svc := range services {
+		methods := svc.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			md := methods.Get(i)
+			if md.IsStreamingClient() || md.IsStreamingServer() {
+				continue
+			}
+			procedure := fmt.Sprintf("/%s/%s", svc.FullName(), md.Name())
+			mux.Handle(prefix+procedure, twirpHandler(conn, procedure, md))
+		}
+		// Unknown methods of a known service get Twirp's bad_route error
+		// rather than the mux's plain text 404
+		mux.HandleFunc(fmt.Sprintf("%s/%s/", prefix, svc.FullName()), func(w http.ResponseWriter, r *http.Request) {
+			twirp.WriteError(w, twirp.NewErrorf(twirp.BadRoute, "no handler for path %q", r.URL.Path))
+		})
+	}
+}
+
+func twirpHandler(conn grpc.ClientConnInterface, procedure string, md protoreflect.MethodDescriptor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			twirp.WriteError(w, twirp.NewErrorf(twirp.BadRoute, "unsupported method %q (only POST is allowed)", r.Method))
+			return
+		}
+		ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if ct != "application/json" && ct != "application/protobuf" {
+			twirp.WriteError(w, twirp.NewErrorf(twirp.BadRoute, "unexpected Content-Type: %q", r.Header.Get("Content-Type")))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, twirpMaxBodySize))
+		if err != nil {
+			twirp.WriteError(w, twirp.NewErrorf(twirp.Malformed, "failed to read request body: %v", err))
+			return
+		}
+		in := dynamicpb.NewMessage(md.Input())
+		if ct == "application/json" {
+			err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, in)
+		} else {
+			err = proto.Unmarshal(body, in)
+		}
+		if err != nil {
+			twirp.WriteError(w, twirp.NewErrorf(twirp.Malformed, "the request could not be decoded: %v", err))
+			return
+		}
+
+		ctx, err := forwardContext(r.Context(), r.Header, r.RemoteAddr)
+		if err != nil {
+			twirp.WriteError(w, twirp.NewError(twirp.Malformed, err.Error()))
+			return
+		}
+		var header metadata.MD
+		out := dynamicpb.NewMessage(md.Output())
+		err = conn.Invoke(ctx, procedure, in, out, grpc.Header(&header))
+		copyMetadata(w.Header(), header)
+		if err != nil {
+			twirp.WriteError(w, twirpError(status.Convert(err)))
+			return
+		}
+
+		var resp []byte
+		if ct == "application/json" {
+			resp, err = twirpJSON.Marshal(out)
+		} else {
+			resp, err = proto.Marshal(out)
+		}
+		if err != nil {
+			twirp.WriteError(w, twirp.InternalErrorWith(err))
+			return
+		}
+		w.Header().Set("Content-Type", ct)
+		w.Write(resp)
+	})
+}
+
+// twirpError converts a gRPC status to the Twirp error with the same code
+// and message
+func twirpError(st *status.Status) twirp.Error {
+	code, ok := twirpCodes[st.Code()]
+	if !ok {
+		code = twirp.Unknown
+	}
+	return twirp.NewError(code, st.Message())
+}
@@ -0,0 +1,133 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/server"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTwirpServer(t *testing.T, opts ...testutil.Option) *httptest.Server {
+	t.Helper()
+	srv := testutil.NewServer(t, opts...)
+	handler, err := server.NewHTTPHandler(context.Background(), srv.Conn, testutil.NopLogger(), srv.Services, server.WithTwirp("/twirp"))
+	if err != nil {
+		t.Fatalf("NewHTTPHandler() error = %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func twirpPost(t *testing.T, url, contentType string, body []byte) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, b
+}
+
+func TestTwirp(t *testing.T) {
+	ts := newTwirpServer(t)
+
+	resp, body := twirpPost(t, ts.URL+"/twirp/api.v1.UserService/CreateUser", "application/json",
+		[]byte(`{"user": {"email": "ada@example.com", "display_name": "Ada"}}`))
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("CreateUser = %d %s", resp.StatusCode, body)
+	}
+	var created struct {
+		ErrorCode *int `json:"error_code"`
+		Data      struct {
+			Result struct {
+				Name string `json:"name"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	if created.ErrorCode == nil || *created.ErrorCode != 0 || created.Data.Result.Name == "" {
+		t.Fatalf("CreateUser = %s, want error_code 0 included and a user", body)
+	}
+
+	req, _ := proto.Marshal(&apiv1.GetUserRequest{Name: created.Data.Result.Name})
+	resp, body = twirpPost(t, ts.URL+"/twirp/api.v1.UserService/GetUser", "application/protobuf", req)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/protobuf" {
+		t.Fatalf("GetUser = %d %s", resp.StatusCode, body)
+	}
+	var got apiv1.CommonResponse
+	if err := proto.Unmarshal(body, &got); err != nil {
+		t.Fatalf("decode GetUser response: %v", err)
+	}
+	if email := got.GetData().GetFields()["result"].GetStructValue().GetFields()["email"].GetStringValue(); email != "ada@example.com" {
+		t.Errorf("GetUser email = %q", email)
+	}
+}
+
+func TestTwirpErrors(t *testing.T) {
+	reject := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if info.FullMethod == "/api.v1.UserService/ListUsers" {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", "3"))
+			return nil, status.Error(codes.ResourceExhausted, "slow down")
+		}
+		return handler(ctx, req)
+	}
+	ts := newTwirpServer(t, testutil.WithServerOptions(grpc.ChainUnaryInterceptor(reject)))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    string
+	}{
+		{"rejected", http.MethodPost, "/twirp/api.v1.UserService/ListUsers", "application/json", `{}`, http.StatusTooManyRequests, "resource_exhausted"},
+		{"malformed", http.MethodPost, "/twirp/api.v1.UserService/GetUser", "application/json", `{"name":`, http.StatusBadRequest, "malformed"},
+		{"unknown method", http.MethodPost, "/twirp/api.v1.UserService/Nope", "application/json", `{}`, http.StatusNotFound, "bad_route"},
+		{"streaming method", http.MethodPost, "/twirp/api.v1.UserService/StreamUsers", "application/json", `{}`, http.StatusNotFound, "bad_route"},
+		{"GET", http.MethodGet, "/twirp/api.v1.UserService/GetUser", "application/json", ``, http.StatusNotFound, "bad_route"},
+		{"content type", http.MethodPost, "/twirp/api.v1.UserService/GetUser", "text/plain", `{}`, http.StatusNotFound, "bad_route"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var twerr struct {
+				Code string `json:"code"`
+				Msg  string `json:"msg"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&twerr); err != nil {
+				t.Fatalf("decode error body: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus || twerr.Code != tt.wantCode {
+				t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.path, resp.StatusCode, twerr.Code, tt.wantStatus, tt.wantCode)
+			}
+			if tt.name == "rejected" && (twerr.Msg != "slow down" || resp.Header.Get("Retry-After") != "3") {
+				t.Errorf("rejected call = %q Retry-After %q, want slow down and 3", twerr.Msg, resp.Header.Get("Retry-After"))
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUsersV2(t *testing.T) {
+	srv := testutil.NewServer(t)
+
+	call := func(method, path, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := srv.HTTPClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var got map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("%s %s returned invalid JSON: %v", method, path, err)
+		}
+		return resp.StatusCode, got
+	}
+
+	// Resources come back as they are, without an envelope, in the
+	// gateway's JSON like the streams
+	httpStatus, created := call(http.MethodPost, "/v2/users", `{"email":"ada@example.com","display_name":"Ada"}`)
+	name, _ := created["name"].(string)
+	if httpStatus != http.StatusOK || name == "" || created["displayName"] != "Ada" || created["error_code"] != nil {
+		t.Fatalf("POST /v2/users = %d %v, want 200 and the user", httpStatus, created)
+	}
+	httpStatus, list := call(http.MethodGet, "/v2/users", "")
+	if users, _ := list["users"].([]any); httpStatus != http.StatusOK || len(users) != 1 || list["totalSize"] != float64(1) {
+		t.Errorf("GET /v2/users = %d %v, want the user", httpStatus, list)
+	}
+
+	// v1 serves the same users
+	httpStatus, v1 := call(http.MethodGet, "/v1/"+name, "")
+	if result, _ := v1["data"].(map[string]any)["result"].(map[string]any); httpStatus != http.StatusOK || result["email"] != "ada@example.com" {
+		t.Errorf("GET /v1/%s = %d %v, want the user created over v2", name, httpStatus, v1)
+	}
+
+	// Errors are a google.rpc.Status with the matching HTTP status
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+		wantDetail         string
+	}{
+		{http.MethodGet, "/v2/users/999", "", http.StatusNotFound, "type.googleapis.com/google.rpc.ResourceInfo"},
+		{http.MethodGet, "/v2/users?page_token=x", "", http.StatusBadRequest, "type.googleapis.com/google.rpc.BadRequest"},
+		{http.MethodPost, "/v2/users", `{"display_name":"Nobody"}`, http.StatusBadRequest, "type.googleapis.com/google.rpc.BadRequest"},
+	} {
+		httpStatus, got := call(tt.method, tt.path, tt.body)
+		details, _ := got["details"].([]any)
+		if httpStatus != tt.want || got["message"] == "" || len(details) == 0 || details[0].(map[string]any)["@type"] != tt.wantDetail {
+			t.Errorf("%s %s %s = %d %v, want %d with a %s", tt.method, tt.path, tt.body, httpStatus, got, tt.want, tt.wantDetail)
+		}
+	}
+
+	if httpStatus, got := call(http.MethodDelete, "/v2/"+name, ""); httpStatus != http.StatusOK || len(got) != 0 {
+		t.Errorf("DELETE /v2/%s = %d %v, want 200 and an empty body", name, httpStatus, got)
+	}
+	if httpStatus, got := call(http.MethodPost, "/v2/"+name+":undelete", "{}"); httpStatus != http.StatusOK || got["state"] != "ACTIVE" {
+		t.Errorf("POST /v2/%s:undelete = %d %v, want 200 and the active user", name, httpStatus, got)
+	}
+	if httpStatus, got := call(http.MethodPost, "/v2/"+name+":undelete", "{}"); httpStatus != http.StatusConflict {
+		t.Errorf("POST /v2/%s:undelete of an active user = %d %v, want 409", name, httpStatus, got)
+	}
+	if httpStatus, got := call(http.MethodDelete, "/v2/"+name+"?force=true", ""); httpStatus != http.StatusOK {
+		t.Errorf("DELETE /v2/%s?force=true = %d %v, want 200", name, httpStatus, got)
+	}
+
+	// Over gRPC the status codes are those of the errors
+	_, err := srv.ClientV2.GetUser(context.Background(), &apiv1.GetUserRequest{Name: name})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetUser() of a deleted user error = %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,19 @@
+package server
+
+import "sync/atomic"
+
+// WarmupState marks the server as warming up. Readiness fails until Done,
+// so load balancers send no traffic to a cold instance.
+type WarmupState struct {
+	done atomic.Bool
+}
+
+// Done ends warmup
+func (w *WarmupState) Done() {
+	w.done.Store(true)
+}
+
+// Warming reports whether warmup is still running
+func (w *WarmupState) Warming() bool {
+	return w != nil && !w.done.Load()
+}
@@ -0,0 +1,598 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/audit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/instance"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/maintenance"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/settings"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/toggle"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/webhook"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AdminService implements the AdminServiceServer interface. The RPCs of a
+// dependency it was not given answer UNIMPLEMENTED, as do its changes and
+// state dumps when it is read-only.
+type AdminService struct {
+	apiv1.UnimplementedAdminServiceServer
+	readOnly    bool
+	jobs        *queue.Queue
+	webhooks    *queue.Queue
+	maintenance *maintenance.Mode
+	settings    *settings.Registry
+	toggles     *toggle.Registry
+	instance    *instance.Info
+	users       repository.UserRepository
+	ids         idgen.Generator
+	clock       clock.Clock
+}
+
+// AdminOption configures an AdminService
+type AdminOption func(*AdminService)
+
+// WithReadOnly makes the service only report, for an admin API open to
+// anyone. Every RPC that changes something answers UNIMPLEMENTED, and so
+// does DumpState, which reads every user.
+func WithReadOnly() AdminOption {
+	return func(s *AdminService) {
+		s.readOnly = true
+	}
+}
+
+// WithJobQueue sets the job queue whose jobs are listed, retried and
+// cancelled, and which runs reindexing tasks
+func WithJobQueue(q *queue.Queue) AdminOption {
+	return func(s *AdminService) {
+		s.jobs = q
+	}
+}
+
+// WithWebhookQueue sets the queue of webhook deliveries to list and replay
+func WithWebhookQueue(q *queue.Queue) AdminOption {
+	return func(s *AdminService) {
+		s.webhooks = q
+	}
+}
+
+// WithMaintenanceMode sets the maintenance mode to report and change
+func WithMaintenanceMode(m *maintenance.Mode) AdminOption {
+	return func(s *AdminService) {
+		s.maintenance = m
+	}
+}
+
+// WithSettings sets the runtime settings to list and change
+func WithSettings(reg *settings.Registry) AdminOption {
+	return func(s *AdminService) {
+		s.settings = reg
+	}
+}
+
+// WithDebugToggles sets the debug toggles to list and turn on or off
+func WithDebugToggles(reg *toggle.Registry) AdminOption {
+	return func(s *AdminService) {
+		s.toggles = reg
+	}
+}
+
+// WithInstanceInfo sets the description of the instance GetInstanceInfo
+// returns
+func WithInstanceInfo(info *instance.Info) AdminOption {
+	return func(s *AdminService) {
+		s.instance = info
+	}
+}
+
+// WithUserStore sets the users DumpState and RestoreState dump and
+// restore and ReindexUsers reindexes, and the generator of their IDs,
+// whose counter is dumped too when it has one. ids may be nil.
+func WithUserStore(users repository.UserRepository, ids idgen.Generator) AdminOption {
+	return func(s *AdminService) {
+		s.users = users
+		s.ids = ids
+	}
+}
+
+// WithAdminClock sets the clock used for the create time of state dumps
+func WithAdminClock(c clock.Clock) AdminOption {
+	return func(s *AdminService) {
+		s.clock = c
+	}
+}
+
+// NewAdminService creates a new AdminService with the dependencies opts
+// give it, and the real clock unless one is given
+func NewAdminService(opts ...AdminOption) *AdminService {
+	s := &AdminService{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.clock == nil {
+		s.clock = clock.Real()
+	}
+	return s
+}
+
+// ListJobs lists jobs in one state, dead-lettered jobs by default
+func (s *AdminService) ListJobs(ctx context.Context, req *apiv1.ListJobsRequest) (*apiv1.CommonResponse, error) {
+	if s.jobs == nil {
+		return unavailable("the job queue"), nil
+	}
+	jobs, next, total, errResp := listQueue(ctx, s.jobs, req.GetState(), queue.StateDead, req.GetPageSize(), req.GetPageToken())
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	result := make([]*apiv1.Job, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, jobToProto(job))
+	}
+
+	return response.Success(map[string]interface{}{
+		"jobs":            result,
+		"next_page_token": next,
+		"total_size":      total,
+	})
+}
+
+// RetryJob moves a dead-lettered job back to the queue
+func (s *AdminService) RetryJob(ctx context.Context, req *apiv1.RetryJobRequest) (*apiv1.CommonResponse, error) {
+	if s.readOnly {
+		return unavailable("retrying jobs"), nil
+	}
+	if s.jobs == nil {
+		return unavailable("the job queue"), nil
+	}
+	job, errResp := transition(ctx, req.GetName(), "jobs/", "job", s.jobs.Retry, "is not dead")
+	if errResp != nil {
+		return errResp, nil
+	}
+	return response.Typed(ctx, jobToProto(job))
+}
+
+// CancelJob cancels a job that has not started yet
+func (s *AdminService) CancelJob(ctx context.Context, req *apiv1.CancelJobRequest) (*apiv1.CommonResponse, error) {
+	if s.readOnly {
+		return unavailable("cancelling jobs"), nil
+	}
+	if s.jobs == nil {
+		return unavailable("the job queue"), nil
+	}
+	job, errResp := transition(ctx, req.GetName(), "jobs/", "job", s.jobs.Cancel, "is not pending")
+	if errResp != nil {
+		return errResp, nil
+	}
+	return response.Typed(ctx, jobToProto(job))
+}
+
+// ListWebhookDeliveries lists webhook deliveries in one state, dead-lettered
+// ones by default
+func (s *AdminService) ListWebhookDeliveries(ctx context.Context, req *apiv1.ListWebhookDeliveriesRequest) (*apiv1.CommonResponse, error) {
+	if s.webhooks == nil {
+		return unavailable("the webhook queue"), nil
+	}
+	jobs, next, total, errResp := listQueue(ctx, s.webhooks, req.GetState(), queue.StateDead, req.GetPageSize(), req.GetPageToken())
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	result := make([]*apiv1.WebhookDelivery, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, deliveryToProto(job))
+	}
+
+	return response.Success(map[string]interface{}{
+		"deliveries":      result,
+		"next_page_token": next,
+		"total_size":      total,
+	})
+}
+
+// ReplayWebhookDelivery queues a dead-lettered delivery again
+func (s *AdminService) ReplayWebhookDelivery(ctx context.Context, req *apiv1.ReplayWebhookDeliveryRequest) (*apiv1.CommonResponse, error) {
+	if s.readOnly {
+		return unavailable("replaying webhook deliveries"), nil
+	}
+	if s.webhooks == nil {
+		return unavailable("the webhook queue"), nil
+	}
+	job, errResp := transition(ctx, req.GetName(), "webhookDeliveries/", "webhook delivery", s.webhooks.Retry, "is not dead")
+	if errResp != nil {
+		return errResp, nil
+	}
+	return response.Typed(ctx, deliveryToProto(job))
+}
+
+// GetMaintenanceMode returns the maintenance mode
+func (s *AdminService) GetMaintenanceMode(ctx context.Context, req *apiv1.GetMaintenanceModeRequest) (*apiv1.CommonResponse, error) {
+	if s.maintenance == nil {
+		return unavailable("maintenance mode"), nil
+	}
+	return response.Typed(ctx, s.maintenanceToProto(s.maintenance.State()))
+}
+
+// SetMaintenanceMode turns maintenance mode on or off
+func (s *AdminService) SetMaintenanceMode(ctx context.Context, req *apiv1.SetMaintenanceModeRequest) (*apiv1.CommonResponse, error) {
+	if s.readOnly {
+		return unavailable("changing maintenance mode"), nil
+	}
+	if s.maintenance == nil {
+		return unavailable("maintenance mode"), nil
+	}
+	return response.Typed(ctx, s.maintenanceToProto(s.maintenance.Set(req.GetEnabled(), req.GetReason())))
+}
+
+// ListSettings lists the runtime settings
+func (s *AdminService) ListSettings(ctx context.Context, req *apiv1.ListSettingsRequest) (*apiv1.CommonResponse, error) {
+	if s.settings == nil {
+		return unavailable("runtime settings"), nil
+	}
+	values := s.settings.List()
+	result := make([]*apiv1.Setting, 0, len(values))
+	for _, v := range values {
+		result = append(result, settingToProto(v))
+	}
+	return response.Success(map[string]interface{}{
+		"settings": result,
+	})
+}
+
+// GetSetting returns a runtime setting
+func (s *AdminService) GetSetting(ctx context.Context, req *apiv1.GetSettingRequest) (*apiv1.CommonResponse, error) {
+	if s.settings == nil {
+		return unavailable("runtime settings"), nil
+	}
+	id, errResp := settingID(req.GetName())
+	if errResp != nil {
+		return errResp, nil
+	}
+	v, err := s.settings.Get(id)
+	if err != nil {
+		return response.NotFound(fmt.Sprintf("setting %s not found", req.GetName())), nil
+	}
+	return response.Typed(ctx, settingToProto(v))
+}
+
+// UpdateSetting changes a runtime setting. The old and new values are added
+// to the call's audit event.
+func (s *AdminService) UpdateSetting(ctx context.Context, req *apiv1.UpdateSettingRequest) (*apiv1.CommonResponse, error) {
+	if s.readOnly {
+		return unavailable("changing runtime settings"), nil
+	}
+	if s.settings == nil {
+		return unavailable("runtime settings"), nil
+	}
+	id, errResp := settingID(req.GetSetting().GetName())
+	if errResp != nil {
+		return errResp, nil
+	}
+	old, updated, err := s.settings.Set(id, req.GetSetting().GetValue())
+	switch {
+	case errors.Is(err, settings.ErrNotFound):
+		return response.NotFound(fmt.Sprintf("setting %s not found", req.GetSetting().GetName())), nil
+	case err != nil:
+		return response.InvalidArgument(err.Error()), nil
+	}
+	audit.AddDetail(ctx, "old_value", old.Value)
+	audit.AddDetail(ctx, "new_value", updated.Value)
+	return response.Typed(ctx, settingToProto(updated))
+}
+
+// ListDebugToggles lists the debug toggles
+func (s *AdminService) ListDebugToggles(ctx context.Context, req *apiv1.ListDebugTogglesRequest) (*apiv1.CommonResponse, error) {
+	if s.toggles == nil {
+		return unavailable("debug toggles"), nil
+	}
+	states := s.toggles.List()
+	result := make([]*apiv1.DebugToggle, 0, len(states))
+	for _, state := range states {
+		result = append(result, toggleToProto(state))
+	}
+	return response.Success(map[string]interface{}{
+		"toggles": result,
+	})
+}
+
+// UpdateDebugToggle turns a debug toggle on or off until its TTL passes.
+// The old and new states are added to the call's audit event.
+func (s *AdminService) UpdateDebugToggle(ctx context.Context, req *apiv1.UpdateDebugToggleRequest) (*apiv1.CommonResponse, error) {
+	if s.readOnly {
+		return unavailable("changing debug toggles"), nil
+	}
+	if s.toggles == nil {
+		return unavailable("debug toggles"), nil
+	}
+	id, ok := strings.CutPrefix(req.GetToggle().GetName(), "debugToggles/")
+	if !ok || id == "" {
+		return response.InvalidArgument("name must have the form debugToggles/{id}"), nil
+	}
+	t, err := s.toggles.Get(id)
+	if err != nil {
+		return response.NotFound(fmt.Sprintf("debug toggle %s not found", req.GetToggle().GetName())), nil
+	}
+	old := t.State()
+	updated, err := t.Set(req.GetToggle().GetEnabled(), req.GetToggle().GetTtl().AsDuration())
+	if err != nil {
+		return response.InvalidArgument(err.Error()), nil
+	}
+	audit.AddDetail(ctx, "old_enabled", strconv.FormatBool(old.Enabled))
+	audit.AddDetail(ctx, "new_enabled", strconv.FormatBool(updated.Enabled))
+	if !updated.Until.IsZero() {
+		audit.AddDetail(ctx, "expire_time", updated.Until.UTC().Format(time.RFC3339))
+	}
+	return response.Typed(ctx, toggleToProto(updated))
+}
+
+// GetInstanceInfo describes the instance serving the call
+func (s *AdminService) GetInstanceInfo(ctx context.Context, req *apiv1.GetInstanceInfoRequest) (*apiv1.CommonResponse, error) {
+	info := s.instance
+	if info == nil {
+		return unavailable("instance info"), nil
+	}
+	return response.Typed(ctx, &apiv1.InstanceInfo{
+		Hostname:          info.Hostname,
+		Zone:              info.Zone,
+		StartTime:         timestamppb.New(info.StartTime),
+		Uptime:            durationpb.New(info.Uptime().Truncate(time.Second)),
+		Profile:           info.Profile,
+		ConfigFingerprint: info.ConfigFingerprint,
+		Version:           info.Version,
+		GoVersion:         info.GoVersion,
+		Features:          info.Features,
+		Fingerprint:       info.Fingerprint,
+	})
+}
+
+// snapshotVersion is the StateSnapshot format DumpState writes
+const snapshotVersion = 1
+
+// usersCounter names the counter of user IDs in snapshots
+const usersCounter = "users"
+
+// DumpState snapshots the users and the user ID counter. The counter is
+// read after the users, so it is never behind an ID in the snapshot.
+func (s *AdminService) DumpState(ctx context.Context, req *apiv1.DumpStateRequest) (*apiv1.CommonResponse, error) {
+	if s.readOnly {
+		return unavailable("state dump"), nil
+	}
+	if s.users == nil {
+		return unavailable("state dump"), nil
+	}
+	store, ok := s.users.(repository.Snapshotter)
+	if !ok {
+		return response.Error(response.CodeUnimplemented, "the user repository cannot be dumped"), nil
+	}
+	users, err := store.Snapshot(ctx)
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		return response.Error(response.CodeUnimplemented, "the user repository cannot be dumped"), nil
+	case err != nil:
+		return response.InternalError(""), nil
+	}
+
+	snapshot := &apiv1.StateSnapshot{
+		Version:    snapshotVersion,
+		CreateTime: timestamppb.New(s.clock.Now()),
+		Users:      users,
+	}
+	if counter, ok := s.ids.(idgen.Counter); ok {
+		snapshot.Counters = map[string]int64{usersCounter: counter.Last()}
+	}
+	return response.Typed(ctx, snapshot)
+}
+
+// RestoreState replaces the users with the snapshot's. The ID counter moves
+// past the snapshot's counter and user IDs first, so users created during
+// the restore cannot take a restored name. The number of users is added to
+// the call's audit event.
+func (s *AdminService) RestoreState(ctx context.Context, req *apiv1.RestoreStateRequest) (*apiv1.CommonResponse, error) {
+	if s.readOnly {
+		return unavailable("state restore"), nil
+	}
+	snapshot := req.GetSnapshot()
+	if snapshot == nil {
+		return response.InvalidArgument("snapshot is required"), nil
+	}
+	if v := snapshot.GetVersion(); v != snapshotVersion {
+		return response.InvalidArgument(fmt.Sprintf("unsupported snapshot version %d", v)), nil
+	}
+	if s.users == nil {
+		return unavailable("state restore"), nil
+	}
+	store, ok := s.users.(repository.Snapshotter)
+	if !ok {
+		return response.Error(response.CodeUnimplemented, "the user repository cannot be restored"), nil
+	}
+
+	if counter, ok := s.ids.(idgen.Counter); ok {
+		last := snapshot.GetCounters()[usersCounter]
+		for _, user := range snapshot.GetUsers() {
+			id, err := strconv.ParseInt(strings.TrimPrefix(user.GetName(), "users/"), 10, 64)
+			if err == nil && id > last {
+				last = id
+			}
+		}
+		counter.Continue(last)
+	}
+
+	err := store.Restore(ctx, snapshot.GetUsers())
+	switch {
+	case errors.Is(err, repository.ErrInvalid):
+		return response.InvalidArgument(err.Error()), nil
+	case errors.Is(err, errors.ErrUnsupported):
+		return response.Error(response.CodeUnimplemented, "the user repository cannot be restored"), nil
+	case err != nil:
+		return response.InternalError(""), nil
+	}
+	audit.AddDetail(ctx, "users", strconv.Itoa(len(snapshot.GetUsers())))
+	return response.Success(map[string]interface{}{
+		"user_count": len(snapshot.GetUsers()),
+	})
+}
+
+// ReindexUsers starts a task rebuilding the indexes of the stored users and
+// returns it, to poll through the task service for progress
+func (s *AdminService) ReindexUsers(ctx context.Context, req *apiv1.ReindexUsersRequest) (*apiv1.CommonResponse, error) {
+	if s.readOnly {
+		return unavailable("reindexing users"), nil
+	}
+	if s.jobs == nil || s.users == nil {
+		return unavailable("reindexing users"), nil
+	}
+	if _, ok := s.users.(repository.Reindexer); !ok {
+		return response.Error(response.CodeUnimplemented, "the user repository cannot be reindexed"), nil
+	}
+	job, err := ScheduleReindex(ctx, s.jobs)
+	if err != nil {
+		return response.InternalError(""), nil
+	}
+	return response.Typed(ctx, taskToProto(job))
+}
+
+// unavailable is the response of an RPC whose dependency, what, the
+// service was not given
+func unavailable(what string) *apiv1.CommonResponse {
+	return response.Error(response.CodeUnimplemented, what+" is not available on this server")
+}
+
+// settingID returns the setting ID of a settings/{id} name, or an error
+// response
+func settingID(name string) (string, *apiv1.CommonResponse) {
+	id, ok := strings.CutPrefix(name, "settings/")
+	if !ok || id == "" {
+		return "", response.InvalidArgument("name must have the form settings/{id}")
+	}
+	return id, nil
+}
+
+// listQueue returns one page of jobs in state, defaultState when it is
+// empty, or an error response for an invalid request
+func listQueue(ctx context.Context, q *queue.Queue, stateName string, defaultState queue.State, pageSize int32, pageToken string) ([]*queue.Job, string, int, *apiv1.CommonResponse) {
+	state := queue.State(stateName)
+	switch state {
+	case "":
+		state = defaultState
+	case queue.StatePending, queue.StateRunning, queue.StateSucceeded, queue.StateDead, queue.StateCancelled:
+	default:
+		return nil, "", 0, response.InvalidArgument(fmt.Sprintf("invalid state %q", stateName))
+	}
+
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+	if pageSize > 1000 {
+		pageSize = 1000
+	}
+
+	start, err := parsePageToken(pageToken)
+	if err != nil {
+		return nil, "", 0, response.InvalidArgument(err.Error())
+	}
+
+	jobs, total, err := q.Store().List(ctx, state, start, int(pageSize))
+	if err != nil {
+		return nil, "", 0, response.InternalError("")
+	}
+
+	var nextPageToken string
+	if end := start + len(jobs); end < total {
+		nextPageToken = fmt.Sprintf("%d", end)
+	}
+	return jobs, nextPageToken, total, nil
+}
+
+// transition applies a state change to the named job. invalidMsg describes
+// the job when it is in the wrong state for the change.
+func transition(ctx context.Context, name, prefix, resource string, apply func(context.Context, string) (*queue.Job, error), invalidMsg string) (*queue.Job, *apiv1.CommonResponse) {
+	id, ok := strings.CutPrefix(name, prefix)
+	if !ok || id == "" {
+		return nil, response.InvalidArgument(fmt.Sprintf("name must have the form %s{id}", prefix))
+	}
+
+	job, err := apply(ctx, id)
+	switch {
+	case errors.Is(err, queue.ErrNotFound):
+		return nil, response.NotFound(fmt.Sprintf("%s %s not found", resource, name))
+	case errors.Is(err, queue.ErrInvalidState):
+		return nil, response.InvalidArgument(fmt.Sprintf("%s %s %s", resource, name, invalidMsg))
+	case err != nil:
+		return nil, response.InternalError("")
+	}
+	return job, nil
+}
+
+func jobToProto(job *queue.Job) *apiv1.Job {
+	return &apiv1.Job{
+		Name:        "jobs/" + job.ID,
+		Kind:        job.Kind,
+		State:       string(job.State),
+		Attempts:    int32(job.Attempts),
+		MaxAttempts: int32(job.MaxAttempts),
+		LastError:   job.LastError,
+		Payload:     job.Payload,
+		RunTime:     timestamppb.New(job.RunAt),
+		CreateTime:  timestamppb.New(job.CreateTime),
+		UpdateTime:  timestamppb.New(job.UpdateTime),
+	}
+}
+
+func (s *AdminService) maintenanceToProto(state maintenance.State) *apiv1.MaintenanceMode {
+	return &apiv1.MaintenanceMode{
+		Enabled:           state.Enabled,
+		Reason:            state.Reason,
+		UpdateTime:        timestamppb.New(state.Since),
+		RetryAfterSeconds: int32(s.maintenance.RetryAfter() / time.Second),
+	}
+}
+
+func settingToProto(v settings.Value) *apiv1.Setting {
+	return &apiv1.Setting{
+		Name:        "settings/" + v.Name,
+		Value:       v.Value,
+		Description: v.Description,
+	}
+}
+
+func toggleToProto(state toggle.State) *apiv1.DebugToggle {
+	t := &apiv1.DebugToggle{
+		Name:        "debugToggles/" + state.Name,
+		Enabled:     state.Enabled,
+		Description: state.Description,
+	}
+	if !state.Until.IsZero() {
+		t.ExpireTime = timestamppb.New(state.Until)
+	}
+	return t
+}
+
+func deliveryToProto(job *queue.Job) *apiv1.WebhookDelivery {
+	// Payloads are written by webhook.Async, a decode failure leaves the
+	// delivery details empty but still lists it
+	var d webhook.Delivery
+	job.Decode(&d)
+	return &apiv1.WebhookDelivery{
+		Name:       "webhookDeliveries/" + job.ID,
+		Url:        d.URL,
+		Event:      d.Event,
+		State:      string(job.State),
+		Attempts:   int32(job.Attempts),
+		LastError:  job.LastError,
+		Body:       string(d.Body),
+		CreateTime: timestamppb.New(job.CreateTime),
+		UpdateTime: timestamppb.New(job.UpdateTime),
+	}
+}
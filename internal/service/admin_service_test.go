@@ -0,0 +1,568 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository/fake"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/instance"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/maintenance"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/settings"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/toggle"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/webhook"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestAdminServiceJobs(t *testing.T) {
+	ctx := context.Background()
+	store := queue.NewMemoryStore()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.Add(ctx, &queue.Job{ID: "1", Kind: "email", State: queue.StateDead, Attempts: 5, MaxAttempts: 5, LastError: "smtp down", RunAt: now})
+	store.Add(ctx, &queue.Job{ID: "2", Kind: "webhook", State: queue.StatePending, MaxAttempts: 5, RunAt: now})
+
+	svc := NewAdminService(
+		WithJobQueue(queue.New(store, logger.Nop(), queue.Options{})),
+		WithWebhookQueue(queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})),
+		WithMaintenanceMode(maintenance.New(0, nil)),
+		WithSettings(settings.NewRegistry()),
+	)
+
+	resp, err := svc.ListJobs(ctx, &apiv1.ListJobsRequest{})
+	if err != nil || resp.ErrorCode != response.CodeSuccess {
+		t.Fatalf("ListJobs() = %v, %v", resp, err)
+	}
+	result := resp.GetData().GetFields()["result"].GetStructValue().GetFields()
+	jobs := result["jobs"].GetListValue().GetValues()
+	if len(jobs) != 1 || jobs[0].GetStructValue().GetFields()["name"].GetStringValue() != "jobs/1" {
+		t.Errorf("ListJobs() jobs = %v, want only jobs/1", jobs)
+	}
+
+	tests := []struct {
+		name          string
+		call          func() (*apiv1.CommonResponse, error)
+		wantErrorCode int32
+	}{
+		{
+			name:          "invalid state",
+			call:          func() (*apiv1.CommonResponse, error) { return svc.ListJobs(ctx, &apiv1.ListJobsRequest{State: "lost"}) },
+			wantErrorCode: response.CodeInvalidArgument,
+		},
+		{
+			name: "invalid page token",
+			call: func() (*apiv1.CommonResponse, error) {
+				return svc.ListJobs(ctx, &apiv1.ListJobsRequest{PageToken: "x"})
+			},
+			wantErrorCode: response.CodeInvalidArgument,
+		},
+		{
+			name:          "retry invalid name",
+			call:          func() (*apiv1.CommonResponse, error) { return svc.RetryJob(ctx, &apiv1.RetryJobRequest{Name: "1"}) },
+			wantErrorCode: response.CodeInvalidArgument,
+		},
+		{
+			name: "retry missing job",
+			call: func() (*apiv1.CommonResponse, error) {
+				return svc.RetryJob(ctx, &apiv1.RetryJobRequest{Name: "jobs/404"})
+			},
+			wantErrorCode: response.CodeNotFound,
+		},
+		{
+			name: "retry pending job",
+			call: func() (*apiv1.CommonResponse, error) {
+				return svc.RetryJob(ctx, &apiv1.RetryJobRequest{Name: "jobs/2"})
+			},
+			wantErrorCode: response.CodeInvalidArgument,
+		},
+		{
+			name: "retry dead job",
+			call: func() (*apiv1.CommonResponse, error) {
+				return svc.RetryJob(ctx, &apiv1.RetryJobRequest{Name: "jobs/1"})
+			},
+			wantErrorCode: response.CodeSuccess,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.call()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.ErrorCode != tt.wantErrorCode {
+				t.Errorf("error_code = %d, want %d", resp.ErrorCode, tt.wantErrorCode)
+			}
+		})
+	}
+
+	job, _ := store.Get(ctx, "1")
+	if job.State != queue.StatePending || job.Attempts != 0 {
+		t.Errorf("retried job = %+v, want pending with no attempts", job)
+	}
+}
+
+func TestAdminServiceWebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	store := queue.NewMemoryStore()
+	payload := []byte(`{"url":"https://example.com/hook","event":"user.created","body":{"user":"users/1"}}`)
+	store.Add(ctx, &queue.Job{ID: "7", Kind: webhook.TaskDeliver, Payload: payload, State: queue.StateDead, Attempts: 1, MaxAttempts: 5, LastError: "410 Gone"})
+
+	svc := NewAdminService(
+		WithJobQueue(queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})),
+		WithWebhookQueue(queue.New(store, logger.Nop(), queue.Options{})),
+		WithMaintenanceMode(maintenance.New(0, nil)),
+		WithSettings(settings.NewRegistry()),
+	)
+
+	resp, err := svc.ListWebhookDeliveries(ctx, &apiv1.ListWebhookDeliveriesRequest{})
+	if err != nil || resp.ErrorCode != response.CodeSuccess {
+		t.Fatalf("ListWebhookDeliveries() = %v, %v", resp, err)
+	}
+	deliveries := resp.GetData().GetFields()["result"].GetStructValue().GetFields()["deliveries"].GetListValue().GetValues()
+	if len(deliveries) != 1 {
+		t.Fatalf("ListWebhookDeliveries() deliveries = %v, want 1", deliveries)
+	}
+	got := deliveries[0].GetStructValue().GetFields()
+	if got["name"].GetStringValue() != "webhookDeliveries/7" || got["url"].GetStringValue() != "https://example.com/hook" || got["body"].GetStringValue() != `{"user":"users/1"}` {
+		t.Errorf("delivery = %v, want webhookDeliveries/7 with its url and body", got)
+	}
+
+	tests := []struct {
+		name          string
+		req           *apiv1.ReplayWebhookDeliveryRequest
+		wantErrorCode int32
+	}{
+		{"job name", &apiv1.ReplayWebhookDeliveryRequest{Name: "jobs/7"}, response.CodeInvalidArgument},
+		{"missing", &apiv1.ReplayWebhookDeliveryRequest{Name: "webhookDeliveries/8"}, response.CodeNotFound},
+		{"dead", &apiv1.ReplayWebhookDeliveryRequest{Name: "webhookDeliveries/7"}, response.CodeSuccess},
+		{"already replayed", &apiv1.ReplayWebhookDeliveryRequest{Name: "webhookDeliveries/7"}, response.CodeInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svc.ReplayWebhookDelivery(ctx, tt.req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.ErrorCode != tt.wantErrorCode {
+				t.Errorf("error_code = %d, want %d", resp.ErrorCode, tt.wantErrorCode)
+			}
+		})
+	}
+}
+
+func TestAdminServiceMaintenanceMode(t *testing.T) {
+	ctx := context.Background()
+	mode := maintenance.New(30*time.Second, nil)
+	svc := NewAdminService(
+		WithJobQueue(queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})),
+		WithWebhookQueue(queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})),
+		WithMaintenanceMode(mode),
+		WithSettings(settings.NewRegistry()),
+	)
+
+	resp, err := svc.SetMaintenanceMode(ctx, &apiv1.SetMaintenanceModeRequest{Enabled: true, Reason: "migrating users"})
+	if err != nil || resp.ErrorCode != response.CodeSuccess {
+		t.Fatalf("SetMaintenanceMode() = %v, %v", resp, err)
+	}
+	if state := mode.State(); !state.Enabled || state.Reason != "migrating users" {
+		t.Errorf("mode after SetMaintenanceMode() = %+v, want enabled with the reason", state)
+	}
+
+	resp, _ = svc.GetMaintenanceMode(ctx, &apiv1.GetMaintenanceModeRequest{})
+	result := resp.GetData().GetFields()["result"].GetStructValue().GetFields()
+	if !result["enabled"].GetBoolValue() || result["retry_after_seconds"].GetNumberValue() != 30 {
+		t.Errorf("GetMaintenanceMode() = %v, want enabled with a 30s retry delay", result)
+	}
+}
+
+func TestAdminServiceInstanceInfo(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("ZONE", "europe-west1-b")
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	info := instance.New(ctx, instance.Options{Profile: "production", ConfigFingerprint: "abc123", Features: []string{"watchdog", "audit"}}, fake)
+	svc := NewAdminService(
+		WithJobQueue(queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})),
+		WithWebhookQueue(queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})),
+		WithMaintenanceMode(maintenance.New(0, nil)),
+		WithSettings(settings.NewRegistry()),
+		WithInstanceInfo(info),
+	)
+
+	fake.Advance(90 * time.Minute)
+	resp, err := svc.GetInstanceInfo(ctx, &apiv1.GetInstanceInfoRequest{})
+	if err != nil || resp.ErrorCode != response.CodeSuccess {
+		t.Fatalf("GetInstanceInfo() = %v, %v", resp, err)
+	}
+	result := resp.GetData().GetFields()["result"].GetStructValue().GetFields()
+	want := map[string]string{
+		"zone":               "europe-west1-b",
+		"profile":            "production",
+		"config_fingerprint": "abc123",
+		"start_time":         "2025-01-01T00:00:00Z",
+		"uptime":             "5400s",
+		"fingerprint":        instance.Fingerprint("abc123", info.Version),
+	}
+	for field, v := range want {
+		if got := result[field].GetStringValue(); got != v {
+			t.Errorf("GetInstanceInfo() %s = %q, want %q", field, got, v)
+		}
+	}
+	features := result["features"].GetListValue().GetValues()
+	if len(features) != 2 || features[0].GetStringValue() != "audit" {
+		t.Errorf("GetInstanceInfo() features = %v, want [audit watchdog]", features)
+	}
+}
+
+func TestAdminServiceSettings(t *testing.T) {
+	ctx := context.Background()
+	reg := settings.NewRegistry()
+	level := "info"
+	reg.Register(settings.Setting{
+		Name: "log_level",
+		Get:  func() string { return level },
+		Set: func(v string) error {
+			if v != "debug" && v != "info" {
+				return fmt.Errorf("unknown level %q", v)
+			}
+			level = v
+			return nil
+		},
+	})
+	svc := NewAdminService(
+		WithJobQueue(queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})),
+		WithWebhookQueue(queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})),
+		WithMaintenanceMode(maintenance.New(0, nil)),
+		WithSettings(reg),
+	)
+
+	tests := []struct {
+		name          string
+		call          func() (*apiv1.CommonResponse, error)
+		wantErrorCode int32
+	}{
+		{
+			name:          "list",
+			call:          func() (*apiv1.CommonResponse, error) { return svc.ListSettings(ctx, &apiv1.ListSettingsRequest{}) },
+			wantErrorCode: response.CodeSuccess,
+		},
+		{
+			name: "get",
+			call: func() (*apiv1.CommonResponse, error) {
+				return svc.GetSetting(ctx, &apiv1.GetSettingRequest{Name: "settings/log_level"})
+			},
+			wantErrorCode: response.CodeSuccess,
+		},
+		{
+			name: "get invalid name",
+			call: func() (*apiv1.CommonResponse, error) {
+				return svc.GetSetting(ctx, &apiv1.GetSettingRequest{Name: "log_level"})
+			},
+			wantErrorCode: response.CodeInvalidArgument,
+		},
+		{
+			name: "update missing",
+			call: func() (*apiv1.CommonResponse, error) {
+				return svc.UpdateSetting(ctx, &apiv1.UpdateSettingRequest{Setting: &apiv1.Setting{Name: "settings/missing", Value: "x"}})
+			},
+			wantErrorCode: response.CodeNotFound,
+		},
+		{
+			name: "update invalid value",
+			call: func() (*apiv1.CommonResponse, error) {
+				return svc.UpdateSetting(ctx, &apiv1.UpdateSettingRequest{Setting: &apiv1.Setting{Name: "settings/log_level", Value: "loud"}})
+			},
+			wantErrorCode: response.CodeInvalidArgument,
+		},
+		{
+			name: "update",
+			call: func() (*apiv1.CommonResponse, error) {
+				return svc.UpdateSetting(ctx, &apiv1.UpdateSettingRequest{Setting: &apiv1.Setting{Name: "settings/log_level", Value: "debug"}})
+			},
+			wantErrorCode: response.CodeSuccess,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.call()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.ErrorCode != tt.wantErrorCode {
+				t.Errorf("error_code = %d, want %d", resp.ErrorCode, tt.wantErrorCode)
+			}
+		})
+	}
+
+	if level != "debug" {
+		t.Errorf("log_level = %q after UpdateSetting(), want debug", level)
+	}
+}
+
+func TestAdminServiceReadOnly(t *testing.T) {
+	ctx := context.Background()
+	store := queue.NewMemoryStore()
+	store.Add(ctx, &queue.Job{ID: "1", Kind: "email", State: queue.StateDead, Attempts: 5, MaxAttempts: 5})
+	deliveries := queue.NewMemoryStore()
+	deliveries.Add(ctx, &queue.Job{ID: "1", Kind: "webhook", State: queue.StateDead, Attempts: 5, MaxAttempts: 5})
+	reg := settings.NewRegistry()
+	level := "info"
+	reg.Register(settings.Setting{
+		Name: "log_level",
+		Get:  func() string { return level },
+		Set: func(v string) error {
+			level = v
+			return nil
+		},
+	})
+	reflection := toggle.New("reflection", "gRPC reflection", false, time.Hour, nil)
+	toggles, _ := toggle.NewRegistry(reflection)
+	mode := maintenance.New(0, nil)
+	users := repository.NewMemoryRepository()
+	users.Create(ctx, &apiv1.User{Name: "users/1", Email: "a@example.com"})
+
+	svc := NewAdminService(
+		WithReadOnly(),
+		WithJobQueue(queue.New(store, logger.Nop(), queue.Options{})),
+		WithWebhookQueue(queue.New(deliveries, logger.Nop(), queue.Options{})),
+		WithMaintenanceMode(mode),
+		WithSettings(reg),
+		WithDebugToggles(toggles),
+		WithUserStore(users, nil),
+	)
+
+	refused := map[string]func() (*apiv1.CommonResponse, error){
+		"RetryJob": func() (*apiv1.CommonResponse, error) {
+			return svc.RetryJob(ctx, &apiv1.RetryJobRequest{Name: "jobs/1"})
+		},
+		"CancelJob": func() (*apiv1.CommonResponse, error) {
+			return svc.CancelJob(ctx, &apiv1.CancelJobRequest{Name: "jobs/1"})
+		},
+		"ReplayWebhookDelivery": func() (*apiv1.CommonResponse, error) {
+			return svc.ReplayWebhookDelivery(ctx, &apiv1.ReplayWebhookDeliveryRequest{Name: "webhookDeliveries/1"})
+		},
+		"SetMaintenanceMode": func() (*apiv1.CommonResponse, error) {
+			return svc.SetMaintenanceMode(ctx, &apiv1.SetMaintenanceModeRequest{Enabled: true})
+		},
+		"UpdateSetting": func() (*apiv1.CommonResponse, error) {
+			return svc.UpdateSetting(ctx, &apiv1.UpdateSettingRequest{Setting: &apiv1.Setting{Name: "settings/log_level", Value: "debug"}})
+		},
+		"UpdateDebugToggle": func() (*apiv1.CommonResponse, error) {
+			return svc.UpdateDebugToggle(ctx, &apiv1.UpdateDebugToggleRequest{Toggle: &apiv1.DebugToggle{Name: "debugToggles/reflection", Enabled: true}})
+		},
+		"DumpState": func() (*apiv1.CommonResponse, error) { return svc.DumpState(ctx, &apiv1.DumpStateRequest{}) },
+		"RestoreState": func() (*apiv1.CommonResponse, error) {
+			return svc.RestoreState(ctx, &apiv1.RestoreStateRequest{Snapshot: &apiv1.StateSnapshot{Version: 1}})
+		},
+		"ReindexUsers": func() (*apiv1.CommonResponse, error) {
+			return svc.ReindexUsers(ctx, &apiv1.ReindexUsersRequest{})
+		},
+	}
+	for name, call := range refused {
+		if resp, err := call(); err != nil || resp.ErrorCode != response.CodeUnimplemented {
+			t.Errorf("%s() on a read-only service = %v, %v, want error_code %d", name, resp, err, response.CodeUnimplemented)
+		}
+	}
+
+	if job, _ := store.Get(ctx, "1"); job.State != queue.StateDead {
+		t.Errorf("job state = %s after a read-only RetryJob(), want %s", job.State, queue.StateDead)
+	}
+	if job, _ := deliveries.Get(ctx, "1"); job.State != queue.StateDead {
+		t.Errorf("delivery state = %s after a read-only ReplayWebhookDelivery(), want %s", job.State, queue.StateDead)
+	}
+	if mode.State().Enabled {
+		t.Error("maintenance enabled by a read-only SetMaintenanceMode()")
+	}
+	if level != "info" {
+		t.Errorf("log_level = %q after a read-only UpdateSetting(), want info", level)
+	}
+	if reflection.State().Enabled {
+		t.Error("reflection enabled by a read-only UpdateDebugToggle()")
+	}
+	if _, total, _ := store.List(ctx, queue.StatePending, 0, 0); total != 0 {
+		t.Errorf("%d pending jobs after a read-only ReindexUsers(), want 0", total)
+	}
+	if count, _ := users.Count(ctx); count != 1 {
+		t.Errorf("%d users after a read-only RestoreState(), want 1", count)
+	}
+
+	reads := map[string]func() (*apiv1.CommonResponse, error){
+		"ListJobs": func() (*apiv1.CommonResponse, error) { return svc.ListJobs(ctx, &apiv1.ListJobsRequest{}) },
+		"GetMaintenanceMode": func() (*apiv1.CommonResponse, error) {
+			return svc.GetMaintenanceMode(ctx, &apiv1.GetMaintenanceModeRequest{})
+		},
+		"ListSettings": func() (*apiv1.CommonResponse, error) { return svc.ListSettings(ctx, &apiv1.ListSettingsRequest{}) },
+		"ListDebugToggles": func() (*apiv1.CommonResponse, error) {
+			return svc.ListDebugToggles(ctx, &apiv1.ListDebugTogglesRequest{})
+		},
+	}
+	for name, call := range reads {
+		if resp, err := call(); err != nil || resp.ErrorCode != response.CodeSuccess {
+			t.Errorf("%s() on a read-only service = %v, %v, want error_code %d", name, resp, err, response.CodeSuccess)
+		}
+	}
+}
+
+func TestAdminServiceDebugToggles(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	reflection := toggle.New("reflection", "gRPC reflection", false, time.Hour, fake)
+	toggles, _ := toggle.NewRegistry(reflection)
+	svc := NewAdminService(
+		WithJobQueue(queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})),
+		WithWebhookQueue(queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})),
+		WithMaintenanceMode(maintenance.New(0, nil)),
+		WithSettings(settings.NewRegistry()),
+		WithDebugToggles(toggles),
+	)
+
+	update := func(name string, enabled bool, ttl time.Duration) *apiv1.CommonResponse {
+		resp, err := svc.UpdateDebugToggle(ctx, &apiv1.UpdateDebugToggleRequest{Toggle: &apiv1.DebugToggle{Name: name, Enabled: enabled, Ttl: durationpb.New(ttl)}})
+		if err != nil {
+			t.Fatalf("UpdateDebugToggle(%s) unexpected error: %v", name, err)
+		}
+		return resp
+	}
+	if resp := update("reflection", true, time.Minute); resp.ErrorCode != response.CodeInvalidArgument {
+		t.Errorf("UpdateDebugToggle() without the collection error_code = %d, want %d", resp.ErrorCode, response.CodeInvalidArgument)
+	}
+	if resp := update("debugToggles/missing", true, time.Minute); resp.ErrorCode != response.CodeNotFound {
+		t.Errorf("UpdateDebugToggle() missing error_code = %d, want %d", resp.ErrorCode, response.CodeNotFound)
+	}
+	if resp := update("debugToggles/reflection", true, 2*time.Hour); resp.ErrorCode != response.CodeInvalidArgument {
+		t.Errorf("UpdateDebugToggle() over the maximum TTL error_code = %d, want %d", resp.ErrorCode, response.CodeInvalidArgument)
+	}
+
+	resp := update("debugToggles/reflection", true, 15*time.Minute)
+	result := resp.GetData().GetFields()["result"].GetStructValue().GetFields()
+	if resp.ErrorCode != response.CodeSuccess || !result["enabled"].GetBoolValue() || result["expire_time"].GetStringValue() != "2025-01-01T00:15:00Z" {
+		t.Fatalf("UpdateDebugToggle() = %v, want enabled until 00:15", resp)
+	}
+
+	fake.Advance(15 * time.Minute)
+	resp, _ = svc.ListDebugToggles(ctx, &apiv1.ListDebugTogglesRequest{})
+	listed := resp.GetData().GetFields()["result"].GetStructValue().GetFields()["toggles"].GetListValue().GetValues()
+	if len(listed) != 1 || listed[0].GetStructValue().GetFields()["enabled"].GetBoolValue() {
+		t.Errorf("ListDebugToggles() after the TTL = %v, want reflection off again", listed)
+	}
+}
+
+func TestAdminServiceState(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newService := func(repo repository.UserRepository, ids idgen.Generator) *AdminService {
+		return NewAdminService(WithUserStore(repo, ids), WithAdminClock(clock.NewFake(now)))
+	}
+
+	blue := repository.NewMemoryRepository()
+	blueIDs := idgen.NewSequential()
+	for i := 0; i < 3; i++ {
+		blue.Create(ctx, &apiv1.User{Name: "users/" + blueIDs.NewID(), Email: fmt.Sprintf("u%d@example.com", i)})
+	}
+	resp, err := newService(blue, blueIDs).DumpState(ctx, &apiv1.DumpStateRequest{})
+	if err != nil || resp.ErrorCode != response.CodeSuccess {
+		t.Fatalf("DumpState() = %v, %v, want success", resp, err)
+	}
+	raw, _ := resp.GetData().GetFields()["result"].MarshalJSON()
+	var snapshot apiv1.StateSnapshot
+	if err := protojson.Unmarshal(raw, &snapshot); err != nil {
+		t.Fatalf("DumpState() result %s is not a snapshot: %v", raw, err)
+	}
+	if snapshot.GetVersion() != 1 || len(snapshot.GetUsers()) != 3 || snapshot.GetCounters()["users"] != 3 {
+		t.Fatalf("DumpState() = %v, want version 1, 3 users and the counter at 3", &snapshot)
+	}
+	if got := snapshot.GetCreateTime().AsTime(); !got.Equal(now) {
+		t.Errorf("DumpState() create_time = %v, want %v", got, now)
+	}
+
+	green := repository.NewMemoryRepository()
+	greenIDs := idgen.NewSequential()
+	svc := newService(green, greenIDs)
+	if resp, _ := svc.RestoreState(ctx, &apiv1.RestoreStateRequest{Snapshot: &apiv1.StateSnapshot{Version: 2}}); resp.ErrorCode != response.CodeInvalidArgument {
+		t.Errorf("RestoreState() of version 2 error_code = %d, want %d", resp.ErrorCode, response.CodeInvalidArgument)
+	}
+	duplicate := &apiv1.StateSnapshot{Version: 1, Users: []*apiv1.User{{Name: "users/1"}, {Name: "users/1"}}}
+	if resp, _ := svc.RestoreState(ctx, &apiv1.RestoreStateRequest{Snapshot: duplicate}); resp.ErrorCode != response.CodeInvalidArgument {
+		t.Errorf("RestoreState() with duplicate names error_code = %d, want %d", resp.ErrorCode, response.CodeInvalidArgument)
+	}
+
+	resp, _ = svc.RestoreState(ctx, &apiv1.RestoreStateRequest{Snapshot: &snapshot})
+	if resp.ErrorCode != response.CodeSuccess || resp.GetData().GetFields()["result"].GetStructValue().GetFields()["user_count"].GetNumberValue() != 3 {
+		t.Fatalf("RestoreState() = %v, want 3 users restored", resp)
+	}
+	users, _ := green.List(ctx, 0, 10)
+	if len(users) != 3 || users[1].GetEmail() != "u1@example.com" {
+		t.Errorf("restored users = %v, want the 3 dumped", users)
+	}
+	if id := greenIDs.NewID(); id != "4" {
+		t.Errorf("NewID() after restore = %s, want 4", id)
+	}
+
+	if resp, _ := newService(nil, nil).DumpState(ctx, &apiv1.DumpStateRequest{}); resp.ErrorCode != response.CodeUnimplemented {
+		t.Errorf("DumpState() without a repository error_code = %d, want %d", resp.ErrorCode, response.CodeUnimplemented)
+	}
+}
+
+func TestAdminServiceReindexUsers(t *testing.T) {
+	ctx := context.Background()
+	jobs := queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{})
+
+	resp, err := NewAdminService(WithJobQueue(jobs), WithUserStore(repository.NewMemoryRepository(), nil)).ReindexUsers(ctx, &apiv1.ReindexUsersRequest{})
+	if err != nil || resp.ErrorCode != response.CodeSuccess {
+		t.Fatalf("ReindexUsers() = %v, %v, want success", resp, err)
+	}
+	task := resp.GetData().GetFields()["result"].GetStructValue().GetFields()
+	name := task["name"].GetStringValue()
+	if task["kind"].GetStringValue() != TaskReindexUsers || task["state"].GetStringValue() != string(queue.StatePending) {
+		t.Errorf("ReindexUsers() task = %v, want a pending %s task", task, TaskReindexUsers)
+	}
+	if job, err := jobs.Store().Get(ctx, strings.TrimPrefix(name, "tasks/")); err != nil || job.Kind != TaskReindexUsers {
+		t.Errorf("job of task %s = %v, %v, want a queued %s job", name, job, err, TaskReindexUsers)
+	}
+
+	resp, _ = NewAdminService(WithJobQueue(jobs), WithUserStore(fake.NewRepository(), nil)).ReindexUsers(ctx, &apiv1.ReindexUsersRequest{})
+	if resp.ErrorCode != response.CodeUnimplemented {
+		t.Errorf("ReindexUsers() of a repository that cannot be reindexed error_code = %d, want %d", resp.ErrorCode, response.CodeUnimplemented)
+	}
+	resp, _ = NewAdminService(WithUserStore(repository.NewMemoryRepository(), nil)).ReindexUsers(ctx, &apiv1.ReindexUsersRequest{})
+	if resp.ErrorCode != response.CodeUnimplemented {
+		t.Errorf("ReindexUsers() without a job queue error_code = %d, want %d", resp.ErrorCode, response.CodeUnimplemented)
+	}
+}
+
+func TestAdminServiceWithoutDependencies(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAdminService()
+
+	calls := map[string]func() (*apiv1.CommonResponse, error){
+		"ListJobs": func() (*apiv1.CommonResponse, error) { return svc.ListJobs(ctx, &apiv1.ListJobsRequest{}) },
+		"ListWebhookDeliveries": func() (*apiv1.CommonResponse, error) {
+			return svc.ListWebhookDeliveries(ctx, &apiv1.ListWebhookDeliveriesRequest{})
+		},
+		"GetMaintenanceMode": func() (*apiv1.CommonResponse, error) {
+			return svc.GetMaintenanceMode(ctx, &apiv1.GetMaintenanceModeRequest{})
+		},
+		"ListSettings": func() (*apiv1.CommonResponse, error) { return svc.ListSettings(ctx, &apiv1.ListSettingsRequest{}) },
+		"ListDebugToggles": func() (*apiv1.CommonResponse, error) {
+			return svc.ListDebugToggles(ctx, &apiv1.ListDebugTogglesRequest{})
+		},
+		"GetInstanceInfo": func() (*apiv1.CommonResponse, error) {
+			return svc.GetInstanceInfo(ctx, &apiv1.GetInstanceInfoRequest{})
+		},
+	}
+	for name, call := range calls {
+		if resp, err := call(); err != nil || resp.ErrorCode != response.CodeUnimplemented {
+			t.Errorf("%s() without its dependency = %v, %v, want error_code %d", name, resp, err, response.CodeUnimplemented)
+		}
+	}
+}
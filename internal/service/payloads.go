@@ -0,0 +1,25 @@
+package service
+
+import (
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+)
+
+// The messages the services return as typed payloads
+func init() {
+	if err := response.RegisterPayload(
+		&apiv1.User{},
+		&apiv1.ListUsersResponse{},
+		&apiv1.BatchGetUsersResponse{},
+		&apiv1.Job{},
+		&apiv1.WebhookDelivery{},
+		&apiv1.MaintenanceMode{},
+		&apiv1.Setting{},
+		&apiv1.InstanceInfo{},
+		&apiv1.DebugToggle{},
+		&apiv1.StateSnapshot{},
+		&apiv1.Task{},
+	); err != nil {
+		panic(err)
+	}
+}
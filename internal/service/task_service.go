@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TaskService implements the TaskServiceServer interface. Tasks are the jobs
+// of the job queue, seen by the clients that started them.
+type TaskService struct {
+	apiv1.UnimplementedTaskServiceServer
+	jobs *queue.Queue
+}
+
+// NewTaskService creates a new TaskService over the job queue
+func NewTaskService(jobs *queue.Queue) *TaskService {
+	return &TaskService{jobs: jobs}
+}
+
+// GetTask returns the status of a task
+func (s *TaskService) GetTask(ctx context.Context, req *apiv1.GetTaskRequest) (*apiv1.CommonResponse, error) {
+	name := req.GetName()
+	id, ok := strings.CutPrefix(name, "tasks/")
+	if !ok || id == "" {
+		return response.InvalidArgument("name must have the form tasks/{id}"), nil
+	}
+
+	job, err := s.jobs.Store().Get(ctx, id)
+	if errors.Is(err, queue.ErrNotFound) {
+		return response.NotFound(fmt.Sprintf("task %s not found", name)), nil
+	}
+	if err != nil {
+		return response.InternalError(""), nil
+	}
+	return response.Typed(ctx, taskToProto(job))
+}
+
+// ListTasks lists tasks in one state, running tasks by default
+func (s *TaskService) ListTasks(ctx context.Context, req *apiv1.ListTasksRequest) (*apiv1.CommonResponse, error) {
+	jobs, next, total, errResp := listQueue(ctx, s.jobs, req.GetState(), queue.StateRunning, req.GetPageSize(), req.GetPageToken())
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	result := make([]*apiv1.Task, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, taskToProto(job))
+	}
+
+	return response.Success(map[string]interface{}{
+		"tasks":           result,
+		"next_page_token": next,
+		"total_size":      total,
+	})
+}
+
+func taskToProto(job *queue.Job) *apiv1.Task {
+	return &apiv1.Task{
+		Name:            "tasks/" + job.ID,
+		Kind:            job.Kind,
+		State:           string(job.State),
+		Progress:        int32(job.Progress),
+		ProgressMessage: job.ProgressMessage,
+		Result:          string(job.Result),
+		Error:           job.LastError,
+		Attempts:        int32(job.Attempts),
+		MaxAttempts:     int32(job.MaxAttempts),
+		CreateTime:      timestamppb.New(job.CreateTime),
+		UpdateTime:      timestamppb.New(job.UpdateTime),
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+)
+
+func TestTaskService(t *testing.T) {
+	ctx := context.Background()
+	store := queue.NewMemoryStore()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.Add(ctx, &queue.Job{ID: "1", Kind: "import", State: queue.StateRunning, Progress: 40, ProgressMessage: "4 of 10", MaxAttempts: 3, RunAt: now})
+	store.Add(ctx, &queue.Job{ID: "2", Kind: "import", State: queue.StateSucceeded, Progress: 100, Result: []byte(`{"imported":10}`), RunAt: now})
+	store.Add(ctx, &queue.Job{ID: "3", Kind: "import", State: queue.StateDead, LastError: "bad row", RunAt: now})
+
+	svc := NewTaskService(queue.New(store, logger.Nop(), queue.Options{}))
+
+	resp, err := svc.ListTasks(ctx, &apiv1.ListTasksRequest{})
+	if err != nil || resp.ErrorCode != response.CodeSuccess {
+		t.Fatalf("ListTasks() = %v, %v", resp, err)
+	}
+	tasks := resp.GetData().GetFields()["result"].GetStructValue().GetFields()["tasks"].GetListValue().GetValues()
+	if len(tasks) != 1 || tasks[0].GetStructValue().GetFields()["name"].GetStringValue() != "tasks/1" {
+		t.Errorf("ListTasks() tasks = %v, want only the running tasks/1", tasks)
+	}
+
+	tests := []struct {
+		name          string
+		task          string
+		wantErrorCode int32
+		wantField     string
+		want          interface{}
+	}{
+		{"running", "tasks/1", response.CodeSuccess, "progress", float64(40)},
+		{"succeeded", "tasks/2", response.CodeSuccess, "result", `{"imported":10}`},
+		{"dead", "tasks/3", response.CodeSuccess, "error", "bad row"},
+		{"invalid name", "jobs/1", response.CodeInvalidArgument, "", nil},
+		{"missing", "tasks/404", response.CodeNotFound, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svc.GetTask(ctx, &apiv1.GetTaskRequest{Name: tt.task})
+			if err != nil {
+				t.Fatalf("GetTask() unexpected error: %v", err)
+			}
+			if resp.ErrorCode != tt.wantErrorCode {
+				t.Fatalf("GetTask() error code = %d, want %d", resp.ErrorCode, tt.wantErrorCode)
+			}
+			if tt.wantField == "" {
+				return
+			}
+			got := resp.GetData().GetFields()["result"].GetStructValue().GetFields()[tt.wantField].AsInterface()
+			if got != tt.want {
+				t.Errorf("GetTask() %s = %v, want %v", tt.wantField, got, tt.want)
+			}
+		})
+	}
+}
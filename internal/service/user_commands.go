@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/consumer"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/validate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Asynchronous commands handled by RegisterCommands, by message type. The
+// data of create and delete is the request of the matching RPC, as
+// protojson or binary protobuf; that of deactivate is {"name": "users/..."}.
+const (
+	CommandCreateUser     = "user.create"
+	CommandDeleteUser     = "user.delete"
+	CommandDeactivateUser = "user.deactivate"
+)
+
+// RegisterCommands registers the handlers for user commands on c. Commands
+// do not pass the gRPC server, so they are validated here; invalid ones are
+// dead-lettered.
+func (s *UserService) RegisterCommands(c *consumer.Consumer) {
+	c.Register(CommandCreateUser, consumer.Proto(func(ctx context.Context, req *apiv1.CreateUserRequest) error {
+		if err := validate.Default().Validate(req); err != nil {
+			return consumer.Permanent(err)
+		}
+		_, err := s.createUser(ctx, req)
+		return commandError(err)
+	}))
+	c.Register(CommandDeleteUser, consumer.Proto(func(ctx context.Context, req *apiv1.DeleteUserRequest) error {
+		if err := validate.Default().Validate(req); err != nil {
+			return consumer.Permanent(err)
+		}
+		return commandError(s.deleteUser(ctx, req.GetName(), req.GetForce()))
+	}))
+	c.Register(CommandDeactivateUser, consumer.JSON(func(ctx context.Context, task *deactivateUserTask) error {
+		return s.deactivate(ctx, task.Name)
+	}))
+}
+
+// commandError makes the errors a redelivery cannot fix permanent, so the
+// command is dead-lettered rather than retried
+func commandError(err error) error {
+	switch status.Code(err) {
+	case codes.OK:
+		return nil
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.FailedPrecondition:
+		return consumer.Permanent(err)
+	default:
+		return err
+	}
+}
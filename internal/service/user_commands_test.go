@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/consumer"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil/builder"
+)
+
+func TestUserCommands(t *testing.T) {
+	ctx := context.Background()
+	svc := NewUserService()
+	broker, dead := consumer.NewMemoryBroker(), consumer.NewMemoryBroker()
+	c := consumer.New(broker, logger.Nop(), consumer.Options{
+		Backoff:         queue.Backoff{Initial: time.Millisecond, Max: time.Millisecond},
+		DeadLetter:      dead,
+		DeadLetterTopic: "dead",
+	})
+	svc.RegisterCommands(c)
+	c.Start(ctx)
+	defer c.Stop(ctx)
+
+	deactivated := builder.CreateUser(t, svc, builder.NewUserBuilder())
+	deleted := builder.CreateUser(t, svc, builder.NewUserBuilder())
+	send := func(typ, data string) {
+		msg, err := outbox.NewCloudEvent("users.commands", "", outbox.CloudEvent{
+			ID: typ + data, Source: "//test", Type: typ, Data: []byte(data),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		broker.Publish(ctx, msg)
+	}
+	send(CommandCreateUser, `{"user": {"email": "async@example.com", "displayName": "Async"}}`)
+	send(CommandDeactivateUser, `{"name": "`+deactivated.GetName()+`"}`)
+	send(CommandDeleteUser, `{"name": "`+deleted.GetName()+`"}`)
+	// Invalid commands are dead-lettered rather than retried
+	send(CommandCreateUser, `{"user": {"email": "not-an-email"}}`)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for broker.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d commands still pending", broker.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if dead.Len() != 1 {
+		t.Errorf("dead letters = %d, want the invalid command", dead.Len())
+	}
+	if user, _ := svc.repo.Get(ctx, deactivated.GetName()); user.GetIsActive() {
+		t.Errorf("user %s is still active", deactivated.GetName())
+	}
+	if user, _ := svc.repo.Get(ctx, deleted.GetName()); user.GetState() != apiv1.User_DELETED {
+		t.Errorf("user %s was not deleted", deleted.GetName())
+	}
+	users, err := svc.repo.List(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("List() unexpected error: %v", err)
+	}
+	var created *apiv1.User
+	for _, u := range users {
+		if u.GetEmail() == "async@example.com" {
+			created = u
+		}
+	}
+	if created == nil {
+		t.Error("user.create command created no user")
+	}
+}
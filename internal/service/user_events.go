@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/events"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// User lifecycle event types
+const (
+	EventUserCreated     = "user.created"
+	EventUserUpdated     = "user.updated"
+	EventUserDeactivated = "user.deactivated"
+	EventUserDeleted     = "user.deleted"
+	EventUserUndeleted   = "user.undeleted"
+
+	// EventUserPurged follows the deletion of a user for good, by a forced
+	// delete or the retention job. Data kept about the user goes with it.
+	EventUserPurged = "user.purged"
+)
+
+// UserEvent describes a change to a user
+type UserEvent struct {
+	Type string
+
+	// User is the user after the change, or before it for purges
+	User *apiv1.User
+	Time time.Time
+}
+
+// WithEventBus sets the bus user lifecycle events are published to.
+// Subscribers such as notifications and webhooks react to them without the
+// service knowing about them.
+func WithEventBus(bus *events.Bus[UserEvent]) Option {
+	return func(s *UserService) {
+		s.bus = bus
+	}
+}
+
+// outboxTarget is where WithOutbox publishes user lifecycle events
+type outboxTarget struct {
+	topic, source string
+	ids           idgen.Generator
+}
+
+// WithOutbox records user lifecycle events as CloudEvents in the outbox of
+// the repository, with the write they describe, for the outbox relay to
+// publish on topic. The event type is that of UserEvent, the subject the
+// user's name and the data the user as JSON. The repository must keep an
+// outbox, see repository.Outboxer.
+func WithOutbox(topic, source string) Option {
+	return func(s *UserService) {
+		s.outbox = &outboxTarget{topic: topic, source: source, ids: idgen.NewUUID()}
+	}
+}
+
+// withOutbox returns ctx carrying the outbox messages of events of typs
+// about user, for the repository to add with the write
+func (s *UserService) withOutbox(ctx context.Context, user *apiv1.User, typs ...string) (context.Context, error) {
+	if s.outbox == nil {
+		return ctx, nil
+	}
+	data, err := protojson.Marshal(user)
+	if err != nil {
+		return nil, status.Error(codes.Internal, response.MsgInternalError)
+	}
+	msgs := make([]*outbox.Message, 0, len(typs))
+	for _, typ := range typs {
+		msg, err := outbox.NewCloudEvent(s.outbox.topic, user.GetName(), outbox.CloudEvent{
+			ID:      s.outbox.ids.NewID(),
+			Source:  s.outbox.source,
+			Type:    typ,
+			Subject: user.GetName(),
+			Time:    s.clock.Now(),
+			Data:    data,
+		})
+		if err != nil {
+			return nil, status.Error(codes.Internal, response.MsgInternalError)
+		}
+		msgs = append(msgs, msg)
+	}
+	return outbox.WithMessages(ctx, msgs...), nil
+}
+
+func (s *UserService) emit(typ string, user *apiv1.User) {
+	if s.bus == nil {
+		return
+	}
+	s.bus.Publish(UserEvent{
+		Type: typ,
+		User: proto.Clone(user).(*apiv1.User),
+		Time: s.clock.Now(),
+	})
+}
+
+// watchBuffer is the number of events a watcher may fall behind by before
+// it is disconnected
+const watchBuffer = 256
+
+// WatchUsers sends an event for each change to a user from the time of the
+// call until the client goes away. Watchers that fall behind are
+// disconnected with ABORTED rather than silently miss events, and all
+// watchers end with UNAVAILABLE once StopWatches is called, so clients
+// reconnect to another instance.
+func (s *UserService) WatchUsers(req *apiv1.WatchUsersRequest, stream grpc.ServerStreamingServer[apiv1.UserEvent]) error {
+	if s.bus == nil {
+		return status.Error(codes.Unimplemented, "user events are not enabled")
+	}
+	sub, err := s.bus.Subscribe("watch", events.Options{Buffer: watchBuffer, Policy: events.Disconnect})
+	if err != nil {
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	defer sub.Close()
+
+	// Send headers now, so clients know they are subscribed before the
+	// first event
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.stopWatches:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case ev, ok := <-sub.C:
+			if !ok {
+				return status.Error(codes.Aborted, "watcher fell behind, list users and watch again")
+			}
+			if len(req.GetTypes()) > 0 && !slices.Contains(req.GetTypes(), ev.Type) {
+				continue
+			}
+			if err := stream.Send(&apiv1.UserEvent{Type: ev.Type, User: ev.User, Time: timestamppb.New(ev.Time)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StopWatches ends every WatchUsers stream, current and future. Call it
+// before shutting the servers down, which would otherwise wait for the
+// streams to end on their own.
+func (s *UserService) StopWatches() {
+	s.stopOnce.Do(func() {
+		close(s.stopWatches)
+	})
+}
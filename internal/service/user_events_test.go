@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository/fake"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/events"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil/builder"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestUserLifecycleEvents(t *testing.T) {
+	ctx := context.Background()
+	bus := events.NewBus[UserEvent](logger.Nop())
+	sub, _ := bus.Subscribe("test", events.Options{})
+	svc := NewUserService(WithEventBus(bus))
+
+	user := builder.CreateUser(t, svc, builder.NewUserBuilder())
+	svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{
+		User:       &apiv1.User{Name: user.GetName(), IsActive: false},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"is_active"}},
+	})
+	svc.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: user.GetName()})
+
+	// Failed and repeated mutations emit nothing
+	svc.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: user.GetName()})
+	svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{User: &apiv1.User{Name: user.GetName(), DisplayName: "Gone"}})
+
+	svc.UndeleteUser(ctx, &apiv1.UndeleteUserRequest{Name: user.GetName()})
+	svc.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: user.GetName(), Force: true})
+
+	sub.Close()
+	var got []string
+	for ev := range sub.C {
+		got = append(got, ev.Type)
+		if ev.User.GetName() != user.GetName() || ev.User.GetEmail() != user.GetEmail() {
+			t.Errorf("%s event user = %v, want %s", ev.Type, ev.User, user.GetName())
+		}
+	}
+	want := []string{EventUserCreated, EventUserUpdated, EventUserDeactivated, EventUserDeleted,
+		EventUserUndeleted, EventUserDeleted, EventUserPurged}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestOutboxEvents(t *testing.T) {
+	ctx := context.Background()
+	repo := fake.NewRepository()
+	svc := NewUserService(WithRepository(repo), WithOutbox("users", "//users"))
+
+	user := builder.CreateUser(t, svc, builder.NewUserBuilder())
+	svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{
+		User:       &apiv1.User{Name: user.GetName(), IsActive: false},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"is_active"}},
+	})
+	// A failed write records nothing
+	repo.FailNext(fake.OpUpdate, repository.ErrConflict)
+	svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{User: &apiv1.User{Name: user.GetName(), DisplayName: "Lost"}})
+	svc.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: user.GetName()})
+
+	pending, err := repository.OutboxOf(repo).Pending(ctx, 10)
+	if err != nil {
+		t.Fatalf("Pending() unexpected error: %v", err)
+	}
+	var got []string
+	for _, msg := range pending {
+		var ev outbox.CloudEvent
+		if err := json.Unmarshal(msg.Payload, &ev); err != nil {
+			t.Fatalf("payload %s is not a CloudEvent: %v", msg.Payload, err)
+		}
+		got = append(got, ev.Type)
+		if msg.Topic != "users" || msg.Key != user.GetName() || ev.ID != msg.ID || ev.Source != "//users" || ev.Subject != user.GetName() {
+			t.Errorf("%s message = %+v, event %+v, want one about %s on users", ev.Type, msg, ev, user.GetName())
+		}
+		if !strings.Contains(string(ev.Data), user.GetEmail()) {
+			t.Errorf("%s data = %s, want the user", ev.Type, ev.Data)
+		}
+	}
+	want := []string{EventUserCreated, EventUserUpdated, EventUserDeactivated, EventUserDeleted}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("outbox events = %v, want %v", got, want)
+	}
+}
+
+type eventStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *apiv1.UserEvent
+}
+
+func (s *eventStream) Context() context.Context { return s.ctx }
+
+func (s *eventStream) SendHeader(metadata.MD) error { return nil }
+
+func (s *eventStream) Send(ev *apiv1.UserEvent) error {
+	s.events <- ev
+	return nil
+}
+
+// watch starts WatchUsers on stream and waits for it to subscribe,
+// returning the channel its result is sent on
+func watch(t *testing.T, svc *UserService, bus *events.Bus[UserEvent], req *apiv1.WatchUsersRequest, stream *eventStream) chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.WatchUsers(req, stream)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); len(bus.Stats()) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("WatchUsers() did not subscribe")
+		}
+	}
+	return done
+}
+
+func TestWatchUsers(t *testing.T) {
+	ctx := context.Background()
+	bus := events.NewBus[UserEvent](logger.Nop())
+	svc := NewUserService(WithEventBus(bus))
+	stream := &eventStream{ctx: ctx, events: make(chan *apiv1.UserEvent, 16)}
+	done := watch(t, svc, bus, &apiv1.WatchUsersRequest{Types: []string{EventUserCreated, EventUserDeleted}}, stream)
+
+	user := builder.CreateUser(t, svc, builder.NewUserBuilder())
+	svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{User: &apiv1.User{Name: user.GetName(), DisplayName: "Ada"}})
+	svc.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: user.GetName()})
+
+	for _, want := range []string{EventUserCreated, EventUserDeleted} {
+		ev := <-stream.events
+		if ev.GetType() != want || ev.GetUser().GetName() != user.GetName() || ev.GetTime() == nil {
+			t.Errorf("event = %v, want %s of %s", ev, want, user.GetName())
+		}
+	}
+
+	svc.StopWatches()
+	if err := <-done; status.Code(err) != codes.Unavailable {
+		t.Errorf("WatchUsers() after StopWatches error = %v, want code %s", err, codes.Unavailable)
+	}
+	if len(stream.events) > 0 {
+		t.Errorf("WatchUsers() sent %v, filtered out by type", <-stream.events)
+	}
+	if len(bus.Stats()) != 0 {
+		t.Error("WatchUsers() left its subscription open")
+	}
+}
+
+func TestWatchUsersFallsBehind(t *testing.T) {
+	bus := events.NewBus[UserEvent](logger.Nop())
+	svc := NewUserService(WithEventBus(bus))
+	// Sends block until the test reads them
+	stream := &eventStream{ctx: context.Background(), events: make(chan *apiv1.UserEvent)}
+	done := watch(t, svc, bus, &apiv1.WatchUsersRequest{}, stream)
+
+	for i := 0; i < watchBuffer+2; i++ {
+		bus.Publish(UserEvent{Type: EventUserUpdated})
+	}
+	// The watcher still sends what was buffered before it fell behind
+	for {
+		select {
+		case <-stream.events:
+		case err := <-done:
+			if status.Code(err) != codes.Aborted {
+				t.Errorf("WatchUsers() behind error = %v, want code %s", err, codes.Aborted)
+			}
+			return
+		}
+	}
+}
+
+func TestWatchUsersWithoutEvents(t *testing.T) {
+	err := NewUserService().WatchUsers(&apiv1.WatchUsersRequest{}, &eventStream{ctx: context.Background()})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("WatchUsers() without an event bus error = %v, want code %s", err, codes.Unimplemented)
+	}
+}
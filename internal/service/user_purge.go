@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// purgeBatch is the number of expired users read from storage at a time
+const purgeBatch = 500
+
+// PurgeDeleted deletes for good the users soft deleted before cutoff, with
+// a user.purged event for each, and returns how many it deleted. With
+// dryRun it only counts them. It is the retention.Purger of soft deleted
+// users.
+func (s *UserService) PurgeDeleted(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	expired := repository.DeletedBefore(cutoff)
+	if dryRun {
+		return s.repo.CountMatching(ctx, expired)
+	}
+
+	purged := 0
+	q := repository.Query{Filter: expired, Limit: purgeBatch}
+	for {
+		users, err := s.repo.Find(ctx, q)
+		if err != nil {
+			return purged, err
+		}
+		for _, user := range users {
+			err := s.purgeUser(ctx, user)
+			if status.Code(err) == codes.NotFound {
+				// Purged by another replica in the meantime
+				continue
+			}
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		if len(users) < purgeBatch {
+			return purged, nil
+		}
+		q.After = users[len(users)-1]
+	}
+}
+
+// purgeUser deletes user for good. Users that were not soft deleted first
+// are reported deleted as well as purged.
+func (s *UserService) purgeUser(ctx context.Context, user *apiv1.User) error {
+	typs := []string{EventUserPurged}
+	if !isDeleted(user) {
+		typs = []string{EventUserDeleted, EventUserPurged}
+	}
+	ctx, err := s.withOutbox(ctx, user, typs...)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, user.Name); err != nil {
+		return repositoryError(err, user.Name)
+	}
+	for _, typ := range typs {
+		s.emit(typ, user)
+	}
+	return nil
+}
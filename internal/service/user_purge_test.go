@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil/builder"
+)
+
+func TestPurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	svc := NewUserService(WithClock(clk))
+	builder.SeedUsers(t, svc, 3, nil)
+
+	svc.deleteUser(ctx, "users/1", false)
+	clk.Advance(2 * time.Hour)
+	svc.deleteUser(ctx, "users/2", false)
+	cutoff := now.Add(time.Hour)
+
+	if n, err := svc.PurgeDeleted(ctx, cutoff, true); err != nil || n != 1 {
+		t.Errorf("PurgeDeleted(dryRun) = %d, %v, want 1", n, err)
+	}
+	if _, err := svc.repo.Get(ctx, "users/1"); err != nil {
+		t.Errorf("dry run purged users/1: %v", err)
+	}
+
+	if n, err := svc.PurgeDeleted(ctx, cutoff, false); err != nil || n != 1 {
+		t.Errorf("PurgeDeleted() = %d, %v, want 1", n, err)
+	}
+	if _, err := svc.repo.Get(ctx, "users/1"); err != repository.ErrNotFound {
+		t.Errorf("Get(users/1) after purge error = %v, want %v", err, repository.ErrNotFound)
+	}
+	for name, want := range map[string]apiv1.User_State{"users/2": apiv1.User_DELETED, "users/3": apiv1.User_ACTIVE} {
+		if user, err := svc.repo.Get(ctx, name); err != nil || user.GetState() != want {
+			t.Errorf("Get(%s) after purge = %v, %v, want it %s", name, user, err, want)
+		}
+	}
+}
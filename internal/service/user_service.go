@@ -2,142 +2,407 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
+	"time"
 
 	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/events"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/filter"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idempotency"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/pagination"
 	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/tenant"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// UserService implements the UserServiceServer interface
+// UserService implements the UserServiceServer interface. Requests reach
+// it checked against the buf.validate rules of api/proto/v1/user.proto by
+// the gRPC server, so handlers only check what those rules cannot.
 type UserService struct {
 	apiv1.UnimplementedUserServiceServer
-	users map[string]*apiv1.User
-	mu    sync.RWMutex
-	nextID int
+	repo  repository.UserRepository
+	clock clock.Clock
+	ids   idgen.Generator
+	bus   *events.Bus[UserEvent]
+
+	// pageTokens signs the cursors of ListUsers pages
+	pageTokens *pagination.Tokens
+
+	// idempotency records the users created by request ID
+	idempotency *idempotency.Guard
+
+	// outbox, when set, gets the events with the writes
+	outbox *outboxTarget
+
+	// stopWatches is closed by StopWatches to end WatchUsers streams
+	stopWatches chan struct{}
+	stopOnce    sync.Once
 }
 
-// NewUserService creates a new UserService
-func NewUserService() *UserService {
-	return &UserService{
-		users: make(map[string]*apiv1.User),
-		nextID: 1,
+// Option configures a UserService
+type Option func(*UserService)
+
+// WithRepository sets the repository used to store users
+func WithRepository(repo repository.UserRepository) Option {
+	return func(s *UserService) {
+		s.repo = repo
 	}
 }
 
-// CreateUser creates a new user
-func (s *UserService) CreateUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.CommonResponse, error) {
-	if req.GetUser() == nil {
-		return response.InvalidArgument("user is required"), nil
+// WithClock sets the clock used for create and update timestamps
+func WithClock(c clock.Clock) Option {
+	return func(s *UserService) {
+		s.clock = c
 	}
+}
 
-	if req.GetUser().GetEmail() == "" {
-		return response.InvalidArgument("email is required"), nil
+// WithIDGenerator sets the generator for new user IDs
+func WithIDGenerator(gen idgen.Generator) Option {
+	return func(s *UserService) {
+		s.ids = gen
 	}
+}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// WithPageTokens sets the signer of ListUsers page tokens. Replicas must
+// share its key for a page token to work on any of them.
+func WithPageTokens(t *pagination.Tokens) Option {
+	return func(s *UserService) {
+		s.pageTokens = t
+	}
+}
 
-	// Generate resource name
-	userID := fmt.Sprintf("%d", s.nextID)
-	s.nextID++
+// WithIdempotency sets where the users created by request ID are
+// recorded. Replicas must share its store for a retry to be recognized on
+// any of them.
+func WithIdempotency(g *idempotency.Guard) Option {
+	return func(s *UserService) {
+		s.idempotency = g
+	}
+}
 
-	now := timestamppb.Now()
-	user := &apiv1.User{
-		Name:        fmt.Sprintf("users/%s", userID),
-		Email:       req.GetUser().GetEmail(),
-		DisplayName: req.GetUser().GetDisplayName(),
-		PhoneNumber: req.GetUser().GetPhoneNumber(),
-		CreateTime:  now,
-		UpdateTime:  now,
-		IsActive:    true,
+// NewUserService creates a new UserService. Unless overridden it uses an
+// in-memory repository, the real clock, sequential IDs, and page tokens
+// and request IDs only this instance knows.
+func NewUserService(opts ...Option) *UserService {
+	s := &UserService{stopWatches: make(chan struct{})}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.repo == nil {
+		s.repo = repository.NewMemoryRepository()
+	}
+	if s.clock == nil {
+		s.clock = clock.Real()
+	}
+	if s.ids == nil {
+		s.ids = idgen.NewSequential()
 	}
+	if s.pageTokens == nil {
+		s.pageTokens = pagination.NewTokens(nil)
+	}
+	if s.idempotency == nil {
+		s.idempotency = idempotency.New(idempotency.NewMemoryStore(s.clock), idempotency.Options{})
+	}
+	return s
+}
 
-	s.users[user.Name] = user
-	return response.Success(user)
+// CreateUser creates a new user
+func (s *UserService) CreateUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.CommonResponse, error) {
+	user, err := s.createUser(ctx, req)
+	if err != nil {
+		return statusResponse(err), nil
+	}
+	return response.Typed(ctx, user)
 }
 
 // GetUser retrieves a user by resource name
 func (s *UserService) GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.CommonResponse, error) {
-	if req.GetName() == "" {
-		return response.InvalidArgument("name is required"), nil
+	user, err := s.getUser(ctx, req.GetName())
+	if err != nil {
+		return statusResponse(err), nil
 	}
+	return response.Typed(ctx, user)
+}
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	user, exists := s.users[req.GetName()]
-	if !exists {
-		return response.NotFound(fmt.Sprintf("user %s not found", req.GetName())), nil
+// GetUserByEmail retrieves a user by email address
+func (s *UserService) GetUserByEmail(ctx context.Context, req *apiv1.GetUserByEmailRequest) (*apiv1.CommonResponse, error) {
+	user, err := s.getUserByEmail(ctx, req.GetEmail())
+	if err != nil {
+		return statusResponse(err), nil
 	}
-
-	return response.Success(user)
+	return response.Typed(ctx, user)
 }
 
 // ListUsers lists users with pagination
 func (s *UserService) ListUsers(ctx context.Context, req *apiv1.ListUsersRequest) (*apiv1.CommonResponse, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	list, err := s.listUsers(ctx, req)
+	if err != nil {
+		return statusResponse(err), nil
+	}
+	if response.PayloadRequested(ctx) {
+		return response.Payload(list)
+	}
+
+	result := map[string]interface{}{
+		"users":           list.GetUsers(),
+		"next_page_token": list.GetNextPageToken(),
+	}
+	if !req.GetSkipTotalSize() {
+		result["total_size"] = int(list.GetTotalSize())
+	}
+	return response.Success(result)
+}
 
-	pageSize := req.GetPageSize()
-	if pageSize <= 0 {
-		pageSize = 50
+// StreamUsers sends every user but the soft deleted ones in creation order.
+// The repository is read a chunk at a time, so memory stays flat however
+// many users are stored. Chunks continue after the last user sent, so users
+// created during the stream are sent at the end and deletions skip no one.
+func (s *UserService) StreamUsers(req *apiv1.StreamUsersRequest, stream grpc.ServerStreamingServer[apiv1.User]) error {
+	chunkSize := req.GetChunkSize()
+	if chunkSize <= 0 {
+		chunkSize = 500
 	}
-	if pageSize > 1000 {
-		pageSize = 1000
+	if chunkSize > 1000 {
+		chunkSize = 1000
 	}
 
-	// Convert map to slice
-	var allUsers []*apiv1.User
-	for _, user := range s.users {
-		allUsers = append(allUsers, user)
+	ctx := stream.Context()
+	var after *apiv1.User
+	for {
+		users, err := s.repo.Find(ctx, repository.Query{Filter: repository.NotDeleted, After: after, Limit: int(chunkSize)})
+		if err != nil {
+			return status.Error(codes.Internal, "failed to list users")
+		}
+		for _, user := range users {
+			if err := stream.Send(user); err != nil {
+				return err
+			}
+		}
+		if len(users) < int(chunkSize) {
+			return nil
+		}
+		after = users[len(users)-1]
 	}
+}
 
-	// Simple pagination (in production, use a more robust approach)
-	start := 0
-	if req.GetPageToken() != "" {
-		// Parse page token (simplified)
-		fmt.Sscanf(req.GetPageToken(), "%d", &start)
+// UpdateUser updates a user
+func (s *UserService) UpdateUser(ctx context.Context, req *apiv1.UpdateUserRequest) (*apiv1.CommonResponse, error) {
+	user, err := s.updateUser(ctx, req)
+	if err != nil {
+		return statusResponse(err), nil
 	}
+	return response.Typed(ctx, user)
+}
 
-	end := start + int(pageSize)
-	if end > len(allUsers) {
-		end = len(allUsers)
+// DeleteUser soft deletes a user, or deletes it for good with force
+func (s *UserService) DeleteUser(ctx context.Context, req *apiv1.DeleteUserRequest) (*apiv1.CommonResponse, error) {
+	if err := s.deleteUser(ctx, req.GetName(), req.GetForce()); err != nil {
+		return statusResponse(err), nil
 	}
+	return response.SuccessEmpty(), nil
+}
 
-	users := allUsers[start:end]
+// UndeleteUser restores a soft deleted user
+func (s *UserService) UndeleteUser(ctx context.Context, req *apiv1.UndeleteUserRequest) (*apiv1.CommonResponse, error) {
+	user, err := s.undeleteUser(ctx, req.GetName())
+	if err != nil {
+		return statusResponse(err), nil
+	}
+	return response.Typed(ctx, user)
+}
 
-	var nextPageToken string
-	if end < len(allUsers) {
-		nextPageToken = fmt.Sprintf("%d", end)
+// BatchGetUsers retrieves multiple users
+func (s *UserService) BatchGetUsers(ctx context.Context, req *apiv1.BatchGetUsersRequest) (*apiv1.CommonResponse, error) {
+	users, err := s.batchGetUsers(ctx, req.GetNames())
+	if err != nil {
+		return statusResponse(err), nil
 	}
 
+	if response.PayloadRequested(ctx) {
+		return response.Payload(&apiv1.BatchGetUsersResponse{Users: users})
+	}
 	return response.Success(map[string]interface{}{
-		"users":           users,
-		"next_page_token": nextPageToken,
-		"total_size":      len(allUsers),
+		"users": users,
 	})
 }
 
-// UpdateUser updates a user
-func (s *UserService) UpdateUser(ctx context.Context, req *apiv1.UpdateUserRequest) (*apiv1.CommonResponse, error) {
-	if req.GetUser() == nil {
-		return response.InvalidArgument("user is required"), nil
+// The handlers below are shared by api.v1, which sends their errors in a
+// CommonResponse, and api.v2, which returns them as they are. Errors are
+// gRPC statuses.
+
+// createUser creates the user of req once per request ID, the request_id
+// field or else the Idempotency-Key header. A retry returns the user as
+// the first request created it.
+func (s *UserService) createUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.User, error) {
+	requestID := req.GetRequestId()
+	if requestID == "" {
+		requestID = idempotency.FromIncoming(ctx)
+	}
+	if requestID == "" {
+		return s.insertUser(ctx, req)
 	}
 
-	if req.GetUser().GetName() == "" {
-		return response.InvalidArgument("user.name is required"), nil
+	created, err := s.idempotency.Do(ctx, idempotencyKey(ctx, "CreateUser", requestID), requestFingerprint(req), func(ctx context.Context) ([]byte, error) {
+		user, err := s.insertUser(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(user)
+	})
+	switch {
+	case errors.Is(err, idempotency.ErrMismatch):
+		return nil, invalidField("request_id", fmt.Sprintf("request_id %s was used for a different request", requestID))
+	case errors.Is(err, idempotency.ErrInProgress):
+		return nil, status.Errorf(codes.Aborted, "a request with request_id %s is in progress, retry later", requestID)
+	case err != nil:
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Error(codes.Internal, response.MsgInternalError)
+	}
+	user := &apiv1.User{}
+	if err := proto.Unmarshal(created, user); err != nil {
+		return nil, status.Error(codes.Internal, response.MsgInternalError)
 	}
+	return user, nil
+}
+
+func (s *UserService) insertUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.User, error) {
+	// Generate resource name
+	userID := s.ids.NewID()
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	now := timestamppb.New(s.clock.Now())
+	user := &apiv1.User{
+		Name:        fmt.Sprintf("users/%s", userID),
+		Email:       req.GetUser().GetEmail(),
+		DisplayName: req.GetUser().GetDisplayName(),
+		PhoneNumber: req.GetUser().GetPhoneNumber(),
+		CreateTime:  now,
+		UpdateTime:  now,
+		IsActive:    true,
+		State:       apiv1.User_ACTIVE,
+	}
 
-	user, exists := s.users[req.GetUser().GetName()]
-	if !exists {
-		return response.NotFound(fmt.Sprintf("user %s not found", req.GetUser().GetName())), nil
+	ctx, err := s.withOutbox(ctx, user, EventUserCreated)
+	if err != nil {
+		return nil, err
 	}
+	created, err := s.repo.Create(ctx, user)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		return nil, emailTaken(user.Email)
+	}
+	if err != nil {
+		return nil, repositoryError(err, user.Name)
+	}
+	s.emit(EventUserCreated, created)
+	return created, nil
+}
+
+func (s *UserService) getUser(ctx context.Context, name string) (*apiv1.User, error) {
+	user, err := s.repo.Get(ctx, name)
+	if err != nil {
+		return nil, repositoryError(err, name)
+	}
+	return user, nil
+}
+
+// getUserByEmail returns the user with email. Soft deleted users are found
+// too, as by name, since they keep their email.
+func (s *UserService) getUserByEmail(ctx context.Context, email string) (*apiv1.User, error) {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, userStatus(codes.NotFound, "", "no user has email %s", email)
+	}
+	if err != nil {
+		return nil, repositoryError(err, "")
+	}
+	return user, nil
+}
+
+func (s *UserService) listUsers(ctx context.Context, req *apiv1.ListUsersRequest) (*apiv1.ListUsersResponse, error) {
+	pageSize := pagination.PageSize(req.GetPageSize(), 50, 1000)
+	expr, err := filter.Parse(req.GetFilter(), repository.UserFields)
+	if err != nil {
+		return nil, invalidField("filter", fmt.Sprintf("invalid filter: %v", err))
+	}
+	orderBy, err := filter.ParseOrder(req.GetOrderBy(), repository.UserFields)
+	if err != nil {
+		return nil, invalidField("order_by", fmt.Sprintf("invalid order_by: %v", err))
+	}
+
+	if !req.GetShowDeleted() {
+		expr = and(expr, repository.NotDeleted)
+	}
+
+	// Pages continue after the last user of the previous one, so users
+	// created or deleted in between neither repeat nor go missing
+	params := listParams(req)
+	q := repository.Query{Filter: expr, OrderBy: orderBy, Limit: pageSize + 1}
+	if token := req.GetPageToken(); token != "" {
+		var cursor json.RawMessage
+		after := &apiv1.User{}
+		if err := s.pageTokens.Decode(token, params, &cursor); err != nil || protojson.Unmarshal(cursor, after) != nil {
+			return nil, invalidField("page_token", "invalid page_token, pass the next_page_token of a previous page with the same filter and order_by")
+		}
+		q.After = after
+	}
+
+	// Read one extra user to learn whether there is a next page without
+	// counting
+	users, err := s.repo.Find(ctx, q)
+	if err != nil {
+		return nil, repositoryError(err, "")
+	}
+
+	list := &apiv1.ListUsersResponse{Users: users}
+	if len(users) > pageSize {
+		list.Users = users[:pageSize]
+		cursor, err := protojson.Marshal(pageCursor(list.Users[pageSize-1], orderBy))
+		if err != nil {
+			return nil, status.Error(codes.Internal, response.MsgInternalError)
+		}
+		token, err := s.pageTokens.Encode(params, json.RawMessage(cursor))
+		if err != nil {
+			return nil, status.Error(codes.Internal, response.MsgInternalError)
+		}
+		list.NextPageToken = token
+	}
+	if !req.GetSkipTotalSize() {
+		total, err := s.repo.CountMatching(ctx, expr)
+		if err != nil {
+			return nil, repositoryError(err, "")
+		}
+		list.TotalSize = int32(total)
+	}
+	return list, nil
+}
+
+func (s *UserService) updateUser(ctx context.Context, req *apiv1.UpdateUserRequest) (*apiv1.User, error) {
+	user, err := s.repo.Get(ctx, req.GetUser().GetName())
+	if err != nil {
+		return nil, repositoryError(err, req.GetUser().GetName())
+	}
+	if isDeleted(user) {
+		return nil, userStatus(codes.NotFound, user.Name, "user %s is deleted, undelete it first", user.Name)
+	}
+	wasActive := user.IsActive
 
 	// Apply field mask if provided
 	if req.GetUpdateMask() != nil {
@@ -156,50 +421,233 @@ func (s *UserService) UpdateUser(ctx context.Context, req *apiv1.UpdateUserReque
 		user.IsActive = req.GetUser().GetIsActive()
 	}
 
-	user.UpdateTime = timestamppb.Now()
-	return response.Success(user)
+	lastUpdate := s.touch(user)
+
+	typs := []string{EventUserUpdated}
+	if wasActive && !user.IsActive {
+		typs = append(typs, EventUserDeactivated)
+	}
+	ctx, err = s.withOutbox(ctx, user, typs...)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.repo.Update(ctx, user, lastUpdate)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		return nil, emailTaken(user.Email)
+	}
+	if err != nil {
+		return nil, repositoryError(err, user.Name)
+	}
+	s.emit(EventUserUpdated, updated)
+	if wasActive && !updated.IsActive {
+		s.emit(EventUserDeactivated, updated)
+	}
+	return updated, nil
 }
 
-// DeleteUser deletes a user
-func (s *UserService) DeleteUser(ctx context.Context, req *apiv1.DeleteUserRequest) (*apiv1.CommonResponse, error) {
-	if req.GetName() == "" {
-		return response.InvalidArgument("name is required"), nil
+// deleteUser soft deletes the named user, keeping it until the retention
+// job purges it, or with force deletes it for good. Soft deleting a soft
+// deleted user changes nothing, so its retention period is not extended.
+func (s *UserService) deleteUser(ctx context.Context, name string, force bool) error {
+	user, err := s.repo.Get(ctx, name)
+	if err != nil {
+		return repositoryError(err, name)
+	}
+	if force {
+		return s.purgeUser(ctx, user)
+	}
+	if isDeleted(user) {
+		return nil
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	lastUpdate := s.touch(user)
+	user.State = apiv1.User_DELETED
+	user.DeleteTime = timestamppb.New(s.clock.Now())
+	if ctx, err = s.withOutbox(ctx, user, EventUserDeleted); err != nil {
+		return err
+	}
+	deleted, err := s.repo.Update(ctx, user, lastUpdate)
+	if err != nil {
+		return repositoryError(err, name)
+	}
+	s.emit(EventUserDeleted, deleted)
+	return nil
+}
 
-	if _, exists := s.users[req.GetName()]; !exists {
-		return response.NotFound(fmt.Sprintf("user %s not found", req.GetName())), nil
+// undeleteUser restores the named soft deleted user
+func (s *UserService) undeleteUser(ctx context.Context, name string) (*apiv1.User, error) {
+	user, err := s.repo.Get(ctx, name)
+	if err != nil {
+		return nil, repositoryError(err, name)
+	}
+	if !isDeleted(user) {
+		return nil, userStatus(codes.AlreadyExists, name, "user %s is not deleted", name)
 	}
 
-	delete(s.users, req.GetName())
-	return response.SuccessEmpty(), nil
+	lastUpdate := s.touch(user)
+	user.State = apiv1.User_ACTIVE
+	user.DeleteTime = nil
+	if ctx, err = s.withOutbox(ctx, user, EventUserUndeleted); err != nil {
+		return nil, err
+	}
+	undeleted, err := s.repo.Update(ctx, user, lastUpdate)
+	if err != nil {
+		return nil, repositoryError(err, name)
+	}
+	s.emit(EventUserUndeleted, undeleted)
+	return undeleted, nil
 }
 
-// BatchGetUsers retrieves multiple users
-func (s *UserService) BatchGetUsers(ctx context.Context, req *apiv1.BatchGetUsersRequest) (*apiv1.CommonResponse, error) {
-	if len(req.GetNames()) == 0 {
-		return response.InvalidArgument("names is required"), nil
+// touch sets the update time of user, read to be changed, to now, but at
+// least a microsecond, the finest time every repository stores, after its
+// last update. Update is given the last update time it returns, so a
+// concurrent change is not overwritten.
+func (s *UserService) touch(user *apiv1.User) *timestamppb.Timestamp {
+	lastUpdate := user.GetUpdateTime()
+	now := s.clock.Now()
+	if next := lastUpdate.AsTime().Add(time.Microsecond); now.Before(next) {
+		now = next
 	}
+	user.UpdateTime = timestamppb.New(now)
+	return lastUpdate
+}
 
-	if len(req.GetNames()) > 1000 {
-		return response.InvalidArgument("cannot retrieve more than 1000 users at once"), nil
+func (s *UserService) batchGetUsers(ctx context.Context, names []string) ([]*apiv1.User, error) {
+	users, err := s.repo.BatchGet(ctx, names)
+	if err != nil {
+		return nil, repositoryError(err, "")
 	}
+	return users, nil
+}
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// userResourceType names users in ResourceInfo error details
+const userResourceType = "api.v1.User"
+
+// repositoryError maps a repository error to a status. Errors about a
+// user carry a ResourceInfo naming it; a concurrent modification is
+// ABORTED, so clients know to read the user again and retry.
+func repositoryError(err error, name string) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return userStatus(codes.NotFound, name, "user %s not found", name)
+	case errors.Is(err, repository.ErrAlreadyExists):
+		return userStatus(codes.AlreadyExists, name, "user %s already exists", name)
+	case errors.Is(err, repository.ErrConflict):
+		return userStatus(codes.Aborted, name, "user %s was modified concurrently", name)
+	default:
+		return status.Error(codes.Internal, response.MsgInternalError)
+	}
+}
 
-	var users []*apiv1.User
-	for _, name := range req.GetNames() {
-		if user, exists := s.users[name]; exists {
-			users = append(users, user)
-		}
+// userStatus returns a status about the named user, with a ResourceInfo
+// naming it
+func userStatus(code codes.Code, name, format string, args ...any) error {
+	st := status.Newf(code, format, args...)
+	if withInfo, err := st.WithDetails(&errdetails.ResourceInfo{ResourceType: userResourceType, ResourceName: name}); err == nil {
+		st = withInfo
 	}
+	return st.Err()
+}
 
-	return response.Success(map[string]interface{}{
-		"users": users,
-	})
+// idempotencyKey scopes a request ID to the method and the caller's
+// tenant, so tenants cannot replay each other's responses
+func idempotencyKey(ctx context.Context, method, requestID string) string {
+	t, _ := tenant.FromContext(ctx)
+	return method + "/" + t.ID + "/" + requestID
+}
+
+// requestFingerprint identifies req but for its request ID, so a request
+// ID reused for another request is told apart from a retry
+func requestFingerprint(req proto.Message) string {
+	req = proto.Clone(req)
+	if field := req.ProtoReflect().Descriptor().Fields().ByName("request_id"); field != nil {
+		req.ProtoReflect().Clear(field)
+	}
+	b, _ := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// isDeleted reports whether user is soft deleted
+func isDeleted(user *apiv1.User) bool {
+	return user.GetState() == apiv1.User_DELETED
+}
+
+// and returns the filter matching what both a and b match. a may be nil.
+func and(a, b filter.Expr) filter.Expr {
+	if a == nil {
+		return b
+	}
+	return &filter.And{Exprs: []filter.Expr{a, b}}
+}
+
+// emailTaken returns the ALREADY_EXISTS status of a write giving a user
+// the email of another one. Its BadRequest detail names the field, so
+// forms can show the error beside it.
+func emailTaken(email string) error {
+	st := status.Newf(codes.AlreadyExists, "email %s is already taken", email)
+	if withViolation, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+		{Field: "user.email", Description: "email is already taken"},
+	}}); err == nil {
+		st = withViolation
+	}
+	return st.Err()
+}
+
+// invalidField returns an INVALID_ARGUMENT status whose BadRequest detail
+// names the field at fault
+func invalidField(field, description string) error {
+	st := status.New(codes.InvalidArgument, description)
+	if withViolation, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+		{Field: field, Description: description},
+	}}); err == nil {
+		st = withViolation
+	}
+	return st.Err()
+}
+
+// statusResponse converts an error of the shared handlers to a response
+func statusResponse(err error) *apiv1.CommonResponse {
+	return response.FromStatus(status.Convert(err))
+}
+
+// parsePageToken parses an offset page token. An empty token starts at zero.
+func parsePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	// Only accept the canonical form we issue, e.g. reject "+5" and "007"
+	offset, err := strconv.Atoi(token)
+	if err != nil || offset < 0 || strconv.Itoa(offset) != token {
+		return 0, fmt.Errorf("invalid page_token %q", token)
+	}
+	return offset, nil
+}
+
+// pageCursor returns the part of user, the last of a page, its page token
+// keeps: the fields of orderBy the next page continues after, then its
+// creation time and name, which break ties
+func pageCursor(user *apiv1.User, orderBy []filter.Order) *apiv1.User {
+	cursor := &apiv1.User{Name: user.GetName(), CreateTime: user.GetCreateTime()}
+	src, dst := user.ProtoReflect(), cursor.ProtoReflect()
+	for _, o := range orderBy {
+		fd := src.Descriptor().Fields().ByName(protoreflect.Name(o.Field))
+		dst.Set(fd, src.Get(fd))
+	}
+	return cursor
+}
+
+// listParams returns the parameters of req a page token is bound to: those
+// selecting and ordering the users, but not the page size, which may change
+// from page to page. show_deleted is only added when set, so tokens issued
+// before it existed still work.
+func listParams(req *apiv1.ListUsersRequest) string {
+	params := req.GetFilter() + "\x00" + req.GetOrderBy()
+	if req.GetShowDeleted() {
+		params += "\x00show_deleted"
+	}
+	return params
 }
 
 // updateUserWithMask updates user fields based on field mask
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil/builder"
+)
+
+// seedUsers creates n users and returns their resource names
+func seedUsers(b *testing.B, svc *UserService, n int) []string {
+	b.Helper()
+
+	names := make([]string, 0, n)
+	for _, user := range builder.SeedUsers(b, svc, n, nil) {
+		names = append(names, user.GetName())
+	}
+	return names
+}
+
+func BenchmarkCreateUser(b *testing.B) {
+	svc := NewUserService()
+	ctx := context.Background()
+	req := &apiv1.CreateUserRequest{
+		User: &apiv1.User{
+			Email:       "bench@example.com",
+			DisplayName: "Bench User",
+			PhoneNumber: "+1234567890",
+		},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := svc.CreateUser(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetUser(b *testing.B) {
+	svc := NewUserService()
+	names := seedUsers(b, svc, 1000)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := svc.GetUser(ctx, &apiv1.GetUserRequest{Name: names[i%len(names)]}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkListUsers(b *testing.B) {
+	for _, total := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("total=%d", total), func(b *testing.B) {
+			svc := NewUserService()
+			seedUsers(b, svc, total)
+			ctx := context.Background()
+			req := &apiv1.ListUsersRequest{PageSize: 50}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := svc.ListUsers(ctx, req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParallelGetUser(b *testing.B) {
+	svc := NewUserService()
+	names := seedUsers(b, svc, 1000)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := svc.GetUser(ctx, &apiv1.GetUserRequest{Name: names[i%len(names)]}); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func FuzzParsePageToken(f *testing.F) {
+	for _, seed := range []string{"", "0", "10", "-1", "1e3", "abc", "9999999999999999999999", " 5", "5abc"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, token string) {
+		offset, err := parsePageToken(token)
+		if err != nil {
+			return
+		}
+		if offset < 0 {
+			t.Fatalf("parsePageToken(%q) = %d, want non-negative", token, offset)
+		}
+		if token != "" && strconv.Itoa(offset) != token {
+			t.Fatalf("parsePageToken(%q) = %d, accepted a non-canonical token", token, offset)
+		}
+	})
+}
+
+func FuzzListUsers(f *testing.F) {
+	f.Add("", "", int32(0))
+	f.Add("2", "is_active = true", int32(2))
+	f.Add("-5", `email : "example.com"`, int32(-1))
+	f.Add("abc", "((", int32(2000))
+
+	svc := NewUserService()
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		resp, err := svc.CreateUser(ctx, &apiv1.CreateUserRequest{
+			User: &apiv1.User{Email: fmt.Sprintf("fuzz%d@example.com", i)},
+		})
+		if err != nil {
+			f.Fatalf("CreateUser() unexpected error: %v", err)
+		}
+		if resp.ErrorCode != response.CodeSuccess {
+			f.Fatalf("CreateUser() error_code = %d, msg = %s, want success", resp.ErrorCode, resp.ErrorMsg)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, pageToken, filter string, pageSize int32) {
+		resp, err := svc.ListUsers(ctx, &apiv1.ListUsersRequest{
+			PageSize:  pageSize,
+			PageToken: pageToken,
+			Filter:    filter,
+		})
+		if err != nil {
+			t.Fatalf("ListUsers() unexpected error: %v", err)
+		}
+		if resp.ErrorCode != response.CodeSuccess && resp.ErrorCode != response.CodeInvalidArgument {
+			t.Fatalf("ListUsers() error_code = %d, want success or invalid argument", resp.ErrorCode)
+		}
+	})
+}
+
+func FuzzUpdateUserWithMask(f *testing.F) {
+	f.Add("email", "new@example.com", "New Name", "+100", true)
+	f.Add("display_name,phone_number", "", "", "", false)
+	f.Add("name,create_time", "x", "y", "z", true)
+	f.Add(",,unknown,", "a", "b", "c", false)
+
+	f.Fuzz(func(t *testing.T, paths, email, displayName, phone string, active bool) {
+		dst := &apiv1.User{
+			Name:        "users/1",
+			Email:       "old@example.com",
+			DisplayName: "Old",
+			PhoneNumber: "+000",
+			IsActive:    !active,
+		}
+		src := &apiv1.User{
+			Name:        "users/2",
+			Email:       email,
+			DisplayName: displayName,
+			PhoneNumber: phone,
+			IsActive:    active,
+		}
+		before := proto.Clone(dst).(*apiv1.User)
+
+		mask := &fieldmaskpb.FieldMask{}
+		start := 0
+		for i := 0; i <= len(paths); i++ {
+			if i == len(paths) || paths[i] == ',' {
+				mask.Paths = append(mask.Paths, paths[start:i])
+				start = i + 1
+			}
+		}
+
+		updateUserWithMask(dst, src, mask)
+
+		if dst.Name != before.Name {
+			t.Fatalf("updateUserWithMask changed name to %q", dst.Name)
+		}
+		inMask := map[string]bool{}
+		for _, p := range mask.Paths {
+			inMask[p] = true
+		}
+		check := func(field string, got, old, want interface{}) {
+			if inMask[field] && got != want {
+				t.Fatalf("%s = %v, want %v from mask", field, got, want)
+			}
+			if !inMask[field] && got != old {
+				t.Fatalf("%s = %v changed without being in mask", field, got)
+			}
+		}
+		check("email", dst.Email, before.Email, src.Email)
+		check("display_name", dst.DisplayName, before.DisplayName, src.DisplayName)
+		check("phone_number", dst.PhoneNumber, before.PhoneNumber, src.PhoneNumber)
+		check("is_active", dst.IsActive, before.IsActive, src.IsActive)
+	})
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository/fake"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil/builder"
+)
+
+// Stress tests are most useful with the race detector: go test -race
+const (
+	stressWorkers    = 8
+	stressIterations = 200
+)
+
+func TestStressConcurrentCreateUniqueIDs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping stress test in short mode")
+	}
+
+	svc := NewUserService()
+	ctx := context.Background()
+	responses := make(chan *apiv1.CommonResponse, stressWorkers*stressIterations)
+
+	var wg sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stressIterations; i++ {
+				resp, _ := svc.CreateUser(ctx, builder.NewUserBuilder().CreateRequest())
+				responses <- resp
+			}
+		}()
+	}
+	wg.Wait()
+	close(responses)
+
+	// Decode on the test goroutine since builder helpers call t.Fatal
+	seen := make(map[string]bool)
+	for resp := range responses {
+		name := builder.DecodeUser(t, resp).GetName()
+		if seen[name] {
+			t.Fatalf("duplicate user name %s", name)
+		}
+		seen[name] = true
+	}
+	if len(seen) != stressWorkers*stressIterations {
+		t.Errorf("created %d unique users, want %d", len(seen), stressWorkers*stressIterations)
+	}
+}
+
+func TestStressMixedOperations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping stress test in short mode")
+	}
+
+	// Writes are slowed down so updates and deletes of a user overlap
+	repo := fake.NewRepository()
+	repo.SetLatency(fake.OpUpdate, 50*time.Microsecond)
+	svc := NewUserService(WithRepository(repo))
+	ctx := context.Background()
+	seeded := builder.SeedUsers(t, svc, 100, nil)
+
+	var wg sync.WaitGroup
+	pages := make(chan *apiv1.CommonResponse, stressWorkers*stressIterations/10)
+	errs := make(chan error, stressWorkers*4)
+	report := func(format string, args ...interface{}) {
+		select {
+		case errs <- fmt.Errorf(format, args...):
+		default:
+		}
+	}
+
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(4)
+
+		// Creators
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stressIterations; i++ {
+				resp, err := svc.CreateUser(ctx, builder.NewUserBuilder().CreateRequest())
+				if err != nil || resp.ErrorCode != response.CodeSuccess {
+					report("CreateUser() = %v, %v", resp, err)
+				}
+			}
+		}()
+
+		// Updaters race with deleters on the seeded users. An update of a
+		// user deleted since it was read conflicts, rather than bringing
+		// the user back.
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < stressIterations; i++ {
+				user := seeded[(w+i)%len(seeded)]
+				resp, err := svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{
+					User: &apiv1.User{Name: user.GetName(), DisplayName: fmt.Sprintf("worker %d", w)},
+				})
+				if err != nil || !slices.Contains([]int32{response.CodeSuccess, response.CodeNotFound, response.CodeAlreadyExists}, resp.ErrorCode) {
+					report("UpdateUser() = %v, %v", resp, err)
+				}
+			}
+		}(w)
+
+		// Deleters soft delete the first half of the seeded users, trying
+		// again when a concurrent update gets in first
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(seeded)/2; i += stressWorkers {
+				for {
+					resp, err := svc.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: seeded[i].GetName()})
+					if err == nil && resp.ErrorCode == response.CodeAlreadyExists {
+						continue
+					}
+					if err != nil || resp.ErrorCode != response.CodeSuccess {
+						report("DeleteUser() = %v, %v", resp, err)
+					}
+					break
+				}
+			}
+		}(w)
+
+		// Listers capture pages taken under contention
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stressIterations/10; i++ {
+				resp, err := svc.ListUsers(ctx, &apiv1.ListUsersRequest{PageSize: 25})
+				if err != nil {
+					report("ListUsers() unexpected error: %v", err)
+					continue
+				}
+				pages <- resp
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	close(pages)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Each page taken under contention must be internally consistent
+	for resp := range pages {
+		list := builder.DecodeUserList(t, resp)
+		if len(list.GetUsers()) > int(list.GetTotalSize()) {
+			t.Errorf("ListUsers() returned %d users with total_size %d", len(list.GetUsers()), list.GetTotalSize())
+		}
+		seen := make(map[string]bool)
+		for _, u := range list.GetUsers() {
+			if seen[u.GetName()] {
+				t.Errorf("ListUsers() page contains %s twice", u.GetName())
+			}
+			seen[u.GetName()] = true
+		}
+	}
+
+	// Once quiescent, paging must visit every remaining user exactly once
+	want := len(seeded) - len(seeded)/2 + stressWorkers*stressIterations
+	seen := make(map[string]bool)
+	token := ""
+	for {
+		resp, _ := svc.ListUsers(ctx, &apiv1.ListUsersRequest{PageSize: 100, PageToken: token})
+		list := builder.DecodeUserList(t, resp)
+		for _, u := range list.GetUsers() {
+			if seen[u.GetName()] {
+				t.Fatalf("paging returned %s twice", u.GetName())
+			}
+			seen[u.GetName()] = true
+		}
+		token = list.GetNextPageToken()
+		if token == "" {
+			break
+		}
+	}
+	if len(seen) != want {
+		t.Errorf("paging visited %d users, want %d", len(seen), want)
+	}
+	for _, u := range seeded[:len(seeded)/2] {
+		if seen[u.GetName()] {
+			t.Errorf("deleted user %s still listed", u.GetName())
+		}
+		if user, err := svc.getUser(ctx, u.GetName()); err != nil || user.GetState() != apiv1.User_DELETED {
+			t.Errorf("getUser(%s) = %v, %v, want it soft deleted", u.GetName(), user, err)
+		}
+	}
+}
@@ -2,10 +2,25 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository/fake"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idempotency"
 	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/tenant"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil/builder"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil/snapshot"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestCreateUser(t *testing.T) {
@@ -27,20 +42,6 @@ func TestCreateUser(t *testing.T) {
 			},
 			wantErrorCode: response.CodeSuccess,
 		},
-		{
-			name: "missing email",
-			req: &apiv1.CreateUserRequest{
-				User: &apiv1.User{
-					DisplayName: "Test User",
-				},
-			},
-			wantErrorCode: response.CodeInvalidArgument,
-		},
-		{
-			name:          "nil user",
-			req:           &apiv1.CreateUserRequest{},
-			wantErrorCode: response.CodeInvalidArgument,
-		},
 	}
 
 	for _, tt := range tests {
@@ -63,26 +64,63 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+func TestCreateUserIdempotency(t *testing.T) {
+	repo := fake.NewRepository()
+	svc := NewUserService(WithRepository(repo))
+	ctx := context.Background()
+	create := func(ctx context.Context, requestID, email string) (*apiv1.User, error) {
+		return svc.createUser(ctx, &apiv1.CreateUserRequest{RequestId: requestID, User: &apiv1.User{Email: email}})
+	}
+
+	first, err := create(ctx, "req-1", "ada@example.com")
+	if err != nil {
+		t.Fatalf("createUser() unexpected error: %v", err)
+	}
+	retry, err := create(ctx, "req-1", "ada@example.com")
+	if err != nil || retry.GetName() != first.GetName() || repo.Calls(fake.OpCreate) != 1 {
+		t.Errorf("createUser() retry = %s, %v after %d creates, want %s after 1", retry.GetName(), err, repo.Calls(fake.OpCreate), first.GetName())
+	}
+
+	// The Idempotency-Key header stands in for the field
+	headerCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(idempotency.Header, "req-1"))
+	if got, err := create(headerCtx, "", "ada@example.com"); err != nil || got.GetName() != first.GetName() {
+		t.Errorf("createUser() with the header = %s, %v, want %s", got.GetName(), err, first.GetName())
+	}
+
+	if _, err := create(ctx, "req-1", "bob@example.com"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("createUser() reusing the request ID error = %v, want InvalidArgument", err)
+	}
+
+	// Another tenant's request ID is its own
+	tenantCtx := tenant.WithTenant(ctx, tenant.Tenant{ID: "acme"})
+	if got, err := create(tenantCtx, "req-1", "ada@example.net"); err != nil || got.GetName() == first.GetName() {
+		t.Errorf("createUser() for another tenant = %s, %v, want a new user", got.GetName(), err)
+	}
+
+	// Failed requests are not recorded, so they can be retried
+	repo.FailNext(fake.OpCreate, errors.New("disk full"))
+	if _, err := create(ctx, "req-2", "carol@example.com"); status.Code(err) != codes.Internal {
+		t.Errorf("createUser() storage failure error = %v, want Internal", err)
+	}
+	if _, err := create(ctx, "req-2", "carol@example.com"); err != nil {
+		t.Errorf("createUser() retry after a failure unexpected error: %v", err)
+	}
+
+	// Without a request ID a retry creates the user again, and so fails
+	if _, err := create(ctx, "", "dave@example.com"); err != nil {
+		t.Fatalf("createUser() without a request ID unexpected error: %v", err)
+	}
+	if _, err := create(ctx, "", "dave@example.com"); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("createUser() retry without a request ID error = %v, want AlreadyExists", err)
+	}
+}
+
 func TestGetUser(t *testing.T) {
 	svc := NewUserService()
 	ctx := context.Background()
 
 	// Create a user first
-	createResp, _ := svc.CreateUser(ctx, &apiv1.CreateUserRequest{
-		User: &apiv1.User{
-			Email:       "test@example.com",
-			DisplayName: "Test User",
-		},
-	})
-
-	var userName string
-	if createResp != nil && createResp.Data != nil {
-		if result, ok := createResp.Data.Fields["result"]; ok {
-			if userStruct, ok := result.GetStructValue().Fields["name"]; ok {
-				userName = userStruct.GetStringValue()
-			}
-		}
-	}
+	userName := builder.CreateUser(t, svc, builder.NewUserBuilder()).GetName()
 
 	tests := []struct {
 		name          string
@@ -103,11 +141,6 @@ func TestGetUser(t *testing.T) {
 			},
 			wantErrorCode: response.CodeNotFound,
 		},
-		{
-			name:          "empty name",
-			req:           &apiv1.GetUserRequest{},
-			wantErrorCode: response.CodeInvalidArgument,
-		},
 	}
 
 	for _, tt := range tests {
@@ -132,14 +165,7 @@ func TestListUsers(t *testing.T) {
 	ctx := context.Background()
 
 	// Create some users
-	for i := 0; i < 5; i++ {
-		svc.CreateUser(ctx, &apiv1.CreateUserRequest{
-			User: &apiv1.User{
-				Email:       "test@example.com",
-				DisplayName: "Test User",
-			},
-		})
-	}
+	builder.SeedUsers(t, svc, 5, nil)
 
 	tests := []struct {
 		name          string
@@ -183,27 +209,208 @@ func TestListUsers(t *testing.T) {
 	}
 }
 
-func TestUpdateUser(t *testing.T) {
-	svc := NewUserService()
+func TestListUsersTotalSize(t *testing.T) {
+	repo := fake.NewRepository()
+	svc := NewUserService(WithRepository(repo))
+	builder.SeedUsers(t, svc, 3, nil)
 	ctx := context.Background()
 
-	// Create a user first
-	createResp, _ := svc.CreateUser(ctx, &apiv1.CreateUserRequest{
-		User: &apiv1.User{
-			Email:       "test@example.com",
-			DisplayName: "Test User",
+	tests := []struct {
+		name          string
+		req           *apiv1.ListUsersRequest
+		wantTotal     bool
+		wantNextToken bool
+	}{
+		{
+			name:          "total by default",
+			req:           &apiv1.ListUsersRequest{PageSize: 2},
+			wantTotal:     true,
+			wantNextToken: true,
+		},
+		{
+			name:      "total skipped on request",
+			req:       &apiv1.ListUsersRequest{PageSize: 2, SkipTotalSize: true},
+			wantTotal: false,
 		},
+	}
+
+	var token string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each case continues from the page of the previous one
+			tt.req.PageToken = token
+			counts := repo.Calls(fake.OpCount)
+			resp, _ := svc.ListUsers(ctx, tt.req)
+			if resp.GetErrorCode() != response.CodeSuccess {
+				t.Fatalf("ListUsers() error_code = %d, want %d", resp.GetErrorCode(), response.CodeSuccess)
+			}
+			fields := resp.GetData().GetFields()["result"].GetStructValue().GetFields()
+			if _, ok := fields["total_size"]; ok != tt.wantTotal {
+				t.Errorf("ListUsers() has total_size = %v, want %v", ok, tt.wantTotal)
+			}
+			if counted := repo.Calls(fake.OpCount) > counts; counted != tt.wantTotal {
+				t.Errorf("repository Count() called = %v, want %v", counted, tt.wantTotal)
+			}
+			token = fields["next_page_token"].GetStringValue()
+			if (token != "") != tt.wantNextToken {
+				t.Errorf("ListUsers() next_page_token = %q, want one = %v", token, tt.wantNextToken)
+			}
+		})
+	}
+}
+
+func TestListUsersPageTokens(t *testing.T) {
+	svc := NewUserService(WithClock(clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))))
+	builder.SeedUsers(t, svc, 5, nil)
+	ctx := context.Background()
+
+	page := func(token string) *apiv1.ListUsersResponse {
+		t.Helper()
+		list, err := svc.listUsers(ctx, &apiv1.ListUsersRequest{PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatalf("ListUsers(page_token=%q) unexpected error: %v", token, err)
+		}
+		return list
+	}
+	names := func(list *apiv1.ListUsersResponse) []string {
+		var names []string
+		for _, u := range list.GetUsers() {
+			names = append(names, u.GetName())
+		}
+		return names
+	}
+
+	first := page("")
+	if got := names(first); fmt.Sprint(got) != "[users/1 users/2]" {
+		t.Fatalf("first page = %v, want [users/1 users/2]", got)
+	}
+
+	// Users deleted from earlier pages or created meanwhile do not shift
+	// later ones
+	if err := svc.deleteUser(ctx, "users/1", false); err != nil {
+		t.Fatalf("deleteUser() unexpected error: %v", err)
+	}
+	builder.CreateUser(t, svc, builder.NewUserBuilder())
+	second := page(first.GetNextPageToken())
+	if got := names(second); fmt.Sprint(got) != "[users/3 users/4]" {
+		t.Errorf("second page = %v, want [users/3 users/4]", got)
+	}
+	last := page(second.GetNextPageToken())
+	if got := names(last); fmt.Sprint(got) != "[users/5 users/6]" || last.GetNextPageToken() != "" {
+		t.Errorf("last page = %v with next_page_token %q, want [users/5 users/6] and none", got, last.GetNextPageToken())
+	}
+
+	for name, req := range map[string]*apiv1.ListUsersRequest{
+		"offset":       {PageToken: "2"},
+		"forged":       {PageToken: first.GetNextPageToken() + "A"},
+		"other filter": {PageToken: first.GetNextPageToken(), Filter: "is_active = true"},
+		"show deleted": {PageToken: first.GetNextPageToken(), ShowDeleted: true},
+	} {
+		if _, err := svc.listUsers(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("ListUsers() with %s page token error = %v, want %v", name, err, codes.InvalidArgument)
+		}
+	}
+}
+
+func TestListUsersFilter(t *testing.T) {
+	svc := NewUserService(WithClock(clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))))
+	builder.SeedUsers(t, svc, 4, func(i int, b *builder.UserBuilder) {
+		b.WithEmail(fmt.Sprintf("user%d@%s", i, []string{"example.com", "test.org"}[i%2])).WithDisplayName(fmt.Sprintf("User %d", i))
 	})
+	ctx := context.Background()
 
-	var userName string
-	if createResp != nil && createResp.Data != nil {
-		if result, ok := createResp.Data.Fields["result"]; ok {
-			if userStruct, ok := result.GetStructValue().Fields["name"]; ok {
-				userName = userStruct.GetStringValue()
+	// Pages keep the filter and ordering, and total_size counts matches
+	req := &apiv1.ListUsersRequest{Filter: `email : "example.com"`, OrderBy: "display_name desc", PageSize: 1}
+	var got []string
+	for {
+		list, err := svc.listUsers(ctx, req)
+		if err != nil {
+			t.Fatalf("ListUsers() unexpected error: %v", err)
+		}
+		if list.GetTotalSize() != 2 {
+			t.Errorf("ListUsers() total_size = %d, want 2", list.GetTotalSize())
+		}
+		for _, u := range list.GetUsers() {
+			got = append(got, u.GetEmail())
+		}
+		if req.PageToken = list.GetNextPageToken(); req.PageToken == "" {
+			break
+		}
+	}
+	if fmt.Sprint(got) != "[user2@example.com user0@example.com]" {
+		t.Errorf("ListUsers() pages = %v, want user2 then user0 of example.com", got)
+	}
+
+	for _, tt := range []struct {
+		req       *apiv1.ListUsersRequest
+		wantField string
+	}{
+		{&apiv1.ListUsersRequest{Filter: "phone_number = 1"}, "filter"},
+		{&apiv1.ListUsersRequest{Filter: "is_active = maybe"}, "filter"},
+		{&apiv1.ListUsersRequest{OrderBy: "email sideways"}, "order_by"},
+	} {
+		_, err := svc.listUsers(ctx, tt.req)
+		var field string
+		for _, d := range status.Convert(err).Details() {
+			if bad, ok := d.(*errdetails.BadRequest); ok && len(bad.GetFieldViolations()) > 0 {
+				field = bad.GetFieldViolations()[0].GetField()
 			}
 		}
+		if status.Code(err) != codes.InvalidArgument || field != tt.wantField {
+			t.Errorf("ListUsers(%v) error = %v, want %v on %s", tt.req, err, codes.InvalidArgument, tt.wantField)
+		}
+	}
+}
+
+// userStream collects the users sent on a server stream
+type userStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	users []*apiv1.User
+}
+
+func (s *userStream) Context() context.Context { return s.ctx }
+
+func (s *userStream) Send(user *apiv1.User) error {
+	s.users = append(s.users, user)
+	return nil
+}
+
+func TestStreamUsers(t *testing.T) {
+	repo := fake.NewRepository()
+	svc := NewUserService(WithRepository(repo))
+	seeded := builder.SeedUsers(t, svc, 7, nil)
+
+	stream := &userStream{ctx: context.Background()}
+	if err := svc.StreamUsers(&apiv1.StreamUsersRequest{ChunkSize: 3}, stream); err != nil {
+		t.Fatalf("StreamUsers() unexpected error: %v", err)
+	}
+	if len(stream.users) != len(seeded) {
+		t.Fatalf("StreamUsers() sent %d users, want %d", len(stream.users), len(seeded))
+	}
+	for i, user := range stream.users {
+		if user.GetName() != seeded[i].GetName() {
+			t.Errorf("user %d = %s, want %s in creation order", i, user.GetName(), seeded[i].GetName())
+		}
+	}
+	if calls := repo.Calls(fake.OpList); calls != 3 {
+		t.Errorf("repository List() called %d times, want 3 chunks of at most 3", calls)
 	}
 
+	repo.FailNext(fake.OpList, errors.New("disk failure"))
+	err := svc.StreamUsers(&apiv1.StreamUsersRequest{}, &userStream{ctx: context.Background()})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("StreamUsers() with a failing repository error = %v, want code %s", err, codes.Internal)
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	svc := NewUserService()
+	ctx := context.Background()
+
+	// Create a user first
+	userName := builder.CreateUser(t, svc, builder.NewUserBuilder()).GetName()
+
 	tests := []struct {
 		name          string
 		req           *apiv1.UpdateUserRequest
@@ -230,11 +437,6 @@ func TestUpdateUser(t *testing.T) {
 			},
 			wantErrorCode: response.CodeNotFound,
 		},
-		{
-			name:          "nil user",
-			req:           &apiv1.UpdateUserRequest{},
-			wantErrorCode: response.CodeInvalidArgument,
-		},
 	}
 
 	for _, tt := range tests {
@@ -259,21 +461,7 @@ func TestDeleteUser(t *testing.T) {
 	ctx := context.Background()
 
 	// Create a user first
-	createResp, _ := svc.CreateUser(ctx, &apiv1.CreateUserRequest{
-		User: &apiv1.User{
-			Email:       "test@example.com",
-			DisplayName: "Test User",
-		},
-	})
-
-	var userName string
-	if createResp != nil && createResp.Data != nil {
-		if result, ok := createResp.Data.Fields["result"]; ok {
-			if userStruct, ok := result.GetStructValue().Fields["name"]; ok {
-				userName = userStruct.GetStringValue()
-			}
-		}
-	}
+	userName := builder.CreateUser(t, svc, builder.NewUserBuilder()).GetName()
 
 	tests := []struct {
 		name          string
@@ -294,11 +482,6 @@ func TestDeleteUser(t *testing.T) {
 			},
 			wantErrorCode: response.CodeNotFound,
 		},
-		{
-			name:          "empty name",
-			req:           &apiv1.DeleteUserRequest{},
-			wantErrorCode: response.CodeInvalidArgument,
-		},
 	}
 
 	for _, tt := range tests {
@@ -319,27 +502,71 @@ func TestDeleteUser(t *testing.T) {
 	}
 }
 
+func TestSoftDelete(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc := NewUserService(WithClock(clock.NewFake(now)))
+	builder.SeedUsers(t, svc, 3, nil)
+	ctx := context.Background()
+
+	if err := svc.deleteUser(ctx, "users/2", false); err != nil {
+		t.Fatalf("deleteUser() unexpected error: %v", err)
+	}
+	deleted, err := svc.getUser(ctx, "users/2")
+	if err != nil || deleted.GetState() != apiv1.User_DELETED || !deleted.GetDeleteTime().AsTime().Equal(now) {
+		t.Errorf("getUser() of a soft deleted user = %v, %v, want it DELETED at %v", deleted, err, now)
+	}
+
+	names := func(req *apiv1.ListUsersRequest) string {
+		t.Helper()
+		list, err := svc.listUsers(ctx, req)
+		if err != nil {
+			t.Fatalf("listUsers() unexpected error: %v", err)
+		}
+		var names []string
+		for _, u := range list.GetUsers() {
+			names = append(names, u.GetName())
+		}
+		return fmt.Sprintf("%v %d", names, list.GetTotalSize())
+	}
+	if got := names(&apiv1.ListUsersRequest{}); got != "[users/1 users/3] 2" {
+		t.Errorf("ListUsers() = %s, want [users/1 users/3] 2", got)
+	}
+	if got := names(&apiv1.ListUsersRequest{ShowDeleted: true}); got != "[users/1 users/2 users/3] 3" {
+		t.Errorf("ListUsers(show_deleted) = %s, want [users/1 users/2 users/3] 3", got)
+	}
+	if got := names(&apiv1.ListUsersRequest{ShowDeleted: true, Filter: "delete_time > 1970-01-01T00:00:00Z"}); got != "[users/2] 1" {
+		t.Errorf("ListUsers(show_deleted, deleted only) = %s, want [users/2] 1", got)
+	}
+
+	_, err = svc.updateUser(ctx, &apiv1.UpdateUserRequest{User: &apiv1.User{Name: "users/2", DisplayName: "Ghost"}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("updateUser() of a soft deleted user error = %v, want %v", err, codes.NotFound)
+	}
+
+	restored, err := svc.undeleteUser(ctx, "users/2")
+	if err != nil || restored.GetState() != apiv1.User_ACTIVE || restored.GetDeleteTime() != nil {
+		t.Errorf("undeleteUser() = %v, %v, want it ACTIVE", restored, err)
+	}
+	if _, err := svc.undeleteUser(ctx, "users/2"); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("undeleteUser() of an active user error = %v, want %v", err, codes.AlreadyExists)
+	}
+
+	if err := svc.deleteUser(ctx, "users/2", true); err != nil {
+		t.Fatalf("deleteUser(force) unexpected error: %v", err)
+	}
+	if _, err := svc.undeleteUser(ctx, "users/2"); status.Code(err) != codes.NotFound {
+		t.Errorf("undeleteUser() of a user deleted for good error = %v, want %v", err, codes.NotFound)
+	}
+}
+
 func TestBatchGetUsers(t *testing.T) {
 	svc := NewUserService()
 	ctx := context.Background()
 
 	// Create some users
 	var userNames []string
-	for i := 0; i < 3; i++ {
-		createResp, _ := svc.CreateUser(ctx, &apiv1.CreateUserRequest{
-			User: &apiv1.User{
-				Email:       "test@example.com",
-				DisplayName: "Test User",
-			},
-		})
-
-		if createResp != nil && createResp.Data != nil {
-			if result, ok := createResp.Data.Fields["result"]; ok {
-				if userStruct, ok := result.GetStructValue().Fields["name"]; ok {
-					userNames = append(userNames, userStruct.GetStringValue())
-				}
-			}
-		}
+	for _, user := range builder.SeedUsers(t, svc, 3, nil) {
+		userNames = append(userNames, user.GetName())
 	}
 
 	tests := []struct {
@@ -354,11 +581,6 @@ func TestBatchGetUsers(t *testing.T) {
 			},
 			wantErrorCode: response.CodeSuccess,
 		},
-		{
-			name:          "empty names",
-			req:           &apiv1.BatchGetUsersRequest{},
-			wantErrorCode: response.CodeInvalidArgument,
-		},
 		{
 			name: "mixed existing and non-existing",
 			req: &apiv1.BatchGetUsersRequest{
@@ -384,3 +606,149 @@ func TestBatchGetUsers(t *testing.T) {
 		})
 	}
 }
+
+func TestUserServiceRepositoryErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		program       func(repo *fake.Repository)
+		call          func(svc *UserService) (*apiv1.CommonResponse, error)
+		wantErrorCode int32
+	}{
+		{
+			name: "create storage failure",
+			program: func(repo *fake.Repository) {
+				repo.FailNext(fake.OpCreate, errors.New("disk full"))
+			},
+			call: func(svc *UserService) (*apiv1.CommonResponse, error) {
+				return svc.CreateUser(ctx, &apiv1.CreateUserRequest{
+					User: &apiv1.User{Email: "test@example.com"},
+				})
+			},
+			wantErrorCode: response.CodeInternalError,
+		},
+		{
+			name: "create conflict",
+			program: func(repo *fake.Repository) {
+				repo.FailNext(fake.OpCreate, repository.ErrAlreadyExists)
+			},
+			call: func(svc *UserService) (*apiv1.CommonResponse, error) {
+				return svc.CreateUser(ctx, &apiv1.CreateUserRequest{
+					User: &apiv1.User{Email: "test@example.com"},
+				})
+			},
+			wantErrorCode: response.CodeAlreadyExists,
+		},
+		{
+			name: "update concurrent modification",
+			program: func(repo *fake.Repository) {
+				repo.FailNext(fake.OpUpdate, repository.ErrConflict)
+			},
+			call: func(svc *UserService) (*apiv1.CommonResponse, error) {
+				return svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{
+					User: &apiv1.User{Name: "users/1", DisplayName: "Updated"},
+				})
+			},
+			wantErrorCode: response.CodeAlreadyExists,
+		},
+		{
+			name: "list storage failure",
+			program: func(repo *fake.Repository) {
+				repo.Always(fake.OpList, fake.Fault{Err: errors.New("connection reset")})
+			},
+			call: func(svc *UserService) (*apiv1.CommonResponse, error) {
+				return svc.ListUsers(ctx, &apiv1.ListUsersRequest{})
+			},
+			wantErrorCode: response.CodeInternalError,
+		},
+		{
+			name: "get deadline exceeded",
+			program: func(repo *fake.Repository) {
+				repo.SetLatency(fake.OpGet, time.Second)
+			},
+			call: func(svc *UserService) (*apiv1.CommonResponse, error) {
+				ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+				defer cancel()
+				return svc.GetUser(ctx, &apiv1.GetUserRequest{Name: "users/1"})
+			},
+			wantErrorCode: response.CodeInternalError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := fake.NewRepository()
+			svc := NewUserService(WithRepository(repo))
+			builder.CreateUser(t, svc, builder.NewUserBuilder())
+
+			tt.program(repo)
+			resp, err := tt.call(svc)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if resp == nil {
+				t.Fatalf("returned nil response")
+			}
+			if resp.ErrorCode != tt.wantErrorCode {
+				t.Errorf("error_code = %d, want %d, msg = %s", resp.ErrorCode, tt.wantErrorCode, resp.ErrorMsg)
+			}
+		})
+	}
+}
+
+func TestUserTimestamps(t *testing.T) {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	clk := clock.NewFake(created)
+	svc := NewUserService(WithClock(clk))
+	ctx := context.Background()
+
+	user := builder.CreateUser(t, svc, builder.NewUserBuilder())
+	if got := user.GetCreateTime().AsTime(); !got.Equal(created) {
+		t.Errorf("create_time = %v, want %v", got, created)
+	}
+	if got := user.GetUpdateTime().AsTime(); !got.Equal(created) {
+		t.Errorf("update_time = %v, want %v", got, created)
+	}
+
+	clk.Advance(time.Hour)
+	resp, _ := svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{
+		User: &apiv1.User{Name: user.GetName(), DisplayName: "Later"},
+	})
+	updated := builder.DecodeUser(t, resp)
+	if got := updated.GetCreateTime().AsTime(); !got.Equal(created) {
+		t.Errorf("create_time after update = %v, want %v", got, created)
+	}
+	if got, want := updated.GetUpdateTime().AsTime(), created.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("update_time after update = %v, want %v", got, want)
+	}
+}
+
+func TestUserResponsesSnapshot(t *testing.T) {
+	svc := NewUserService()
+	ctx := context.Background()
+
+	builder.SeedUsers(t, svc, 2, func(i int, b *builder.UserBuilder) {
+		b.WithEmail(fmt.Sprintf("snap%d@example.com", i)).WithDisplayName("Snap")
+	})
+
+	resp, _ := svc.GetUser(ctx, &apiv1.GetUserRequest{Name: "users/2"})
+	snapshot.AssertResponse(t, resp, `{
+		"error_code": 0,
+		"error_msg": "success",
+		"data": {"result": {
+			"name": "users/2",
+			"email": "snap1@example.com",
+			"display_name": "Snap",
+			"is_active": true,
+			"state": "ACTIVE",
+			"create_time": "<masked>",
+			"update_time": "<masked>"
+		}},
+		"payload": null
+	}`)
+
+	// Page tokens are signed with a random key
+	resp, _ = svc.ListUsers(ctx, &apiv1.ListUsersRequest{PageSize: 1})
+	snapshot.Match(t, "list_users_first_page", resp, snapshot.WithMaskedFields(append(snapshot.DefaultMaskedFields, "next_page_token")...))
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	apiv2 "github.com/ChyiYaqing/go-microservice-template/api/proto/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// UserServiceV2 implements api.v2.UserService over a UserService, so both
+// versions serve the same users and events. It returns the resources
+// themselves, and errors as gRPC statuses with google.rpc details.
+type UserServiceV2 struct {
+	apiv2.UnimplementedUserServiceServer
+	users *UserService
+}
+
+// NewUserServiceV2 serves users over api.v2
+func NewUserServiceV2(users *UserService) *UserServiceV2 {
+	return &UserServiceV2{users: users}
+}
+
+// CreateUser creates a new user
+func (s *UserServiceV2) CreateUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.User, error) {
+	return s.users.createUser(ctx, req)
+}
+
+// GetUser retrieves a user by resource name
+func (s *UserServiceV2) GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.User, error) {
+	return s.users.getUser(ctx, req.GetName())
+}
+
+// GetUserByEmail retrieves a user by email address
+func (s *UserServiceV2) GetUserByEmail(ctx context.Context, req *apiv1.GetUserByEmailRequest) (*apiv1.User, error) {
+	return s.users.getUserByEmail(ctx, req.GetEmail())
+}
+
+// ListUsers lists users with pagination
+func (s *UserServiceV2) ListUsers(ctx context.Context, req *apiv1.ListUsersRequest) (*apiv1.ListUsersResponse, error) {
+	return s.users.listUsers(ctx, req)
+}
+
+// StreamUsers sends every user in creation order, as the v1 method does
+func (s *UserServiceV2) StreamUsers(req *apiv1.StreamUsersRequest, stream grpc.ServerStreamingServer[apiv1.User]) error {
+	return s.users.StreamUsers(req, stream)
+}
+
+// WatchUsers sends an event for each change to a user, as the v1 method
+// does
+func (s *UserServiceV2) WatchUsers(req *apiv1.WatchUsersRequest, stream grpc.ServerStreamingServer[apiv1.UserEvent]) error {
+	return s.users.WatchUsers(req, stream)
+}
+
+// UpdateUser updates a user
+func (s *UserServiceV2) UpdateUser(ctx context.Context, req *apiv1.UpdateUserRequest) (*apiv1.User, error) {
+	return s.users.updateUser(ctx, req)
+}
+
+// DeleteUser soft deletes a user, or deletes it for good with force
+func (s *UserServiceV2) DeleteUser(ctx context.Context, req *apiv1.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := s.users.deleteUser(ctx, req.GetName(), req.GetForce()); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// UndeleteUser restores a soft deleted user
+func (s *UserServiceV2) UndeleteUser(ctx context.Context, req *apiv1.UndeleteUserRequest) (*apiv1.User, error) {
+	return s.users.undeleteUser(ctx, req.GetName())
+}
+
+// BatchGetUsers retrieves multiple users
+func (s *UserServiceV2) BatchGetUsers(ctx context.Context, req *apiv1.BatchGetUsersRequest) (*apiv1.BatchGetUsersResponse, error) {
+	users, err := s.users.batchGetUsers(ctx, req.GetNames())
+	if err != nil {
+		return nil, err
+	}
+	return &apiv1.BatchGetUsersResponse{Users: users}, nil
+}
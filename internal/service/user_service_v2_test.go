@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository/fake"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestUserServiceV2(t *testing.T) {
+	users := NewUserService()
+	svc := NewUserServiceV2(users)
+	ctx := context.Background()
+
+	created, err := svc.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada@example.com", DisplayName: "Ada"}})
+	if err != nil || created.GetName() == "" || created.GetDisplayName() != "Ada" {
+		t.Fatalf("CreateUser() = %v, %v, want the new user", created, err)
+	}
+	if _, err := svc.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "grace@example.com"}}); err != nil {
+		t.Fatalf("CreateUser() unexpected error: %v", err)
+	}
+
+	got, err := svc.GetUser(ctx, &apiv1.GetUserRequest{Name: created.GetName()})
+	if err != nil || got.GetEmail() != "ada@example.com" {
+		t.Errorf("GetUser() = %v, %v, want the created user", got, err)
+	}
+	got, err = svc.GetUserByEmail(ctx, &apiv1.GetUserByEmailRequest{Email: "ada@example.com"})
+	if err != nil || got.GetName() != created.GetName() {
+		t.Errorf("GetUserByEmail() = %v, %v, want the created user", got, err)
+	}
+
+	list, err := svc.ListUsers(ctx, &apiv1.ListUsersRequest{PageSize: 1})
+	if err != nil || len(list.GetUsers()) != 1 || list.GetNextPageToken() == "" || list.GetTotalSize() != 2 {
+		t.Errorf("ListUsers(page_size=1) = %v, %v, want one user of two and a next page", list, err)
+	}
+
+	updated, err := svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{
+		User:       &apiv1.User{Name: created.GetName(), DisplayName: "Ada L."},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"display_name"}},
+	})
+	if err != nil || updated.GetDisplayName() != "Ada L." || !updated.GetIsActive() {
+		t.Errorf("UpdateUser() = %v, %v, want the new display name only", updated, err)
+	}
+
+	batch, err := svc.BatchGetUsers(ctx, &apiv1.BatchGetUsersRequest{Names: []string{created.GetName(), "users/999"}})
+	if err != nil || len(batch.GetUsers()) != 1 {
+		t.Errorf("BatchGetUsers() = %v, %v, want the existing user", batch, err)
+	}
+
+	if _, err := svc.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: created.GetName()}); err != nil {
+		t.Errorf("DeleteUser() unexpected error: %v", err)
+	}
+
+	// Both versions serve the same users
+	resp, _ := users.GetUser(ctx, &apiv1.GetUserRequest{Name: created.GetName()})
+	if state := resp.GetData().GetFields()["result"].GetStructValue().GetFields()["state"].GetStringValue(); state != "DELETED" {
+		t.Errorf("v1 GetUser() of a user deleted over v2 has state %q, want DELETED", state)
+	}
+
+	undeleted, err := svc.UndeleteUser(ctx, &apiv1.UndeleteUserRequest{Name: created.GetName()})
+	if err != nil || undeleted.GetState() != apiv1.User_ACTIVE || undeleted.GetDeleteTime() != nil {
+		t.Errorf("UndeleteUser() = %v, %v, want the active user", undeleted, err)
+	}
+	if _, err := svc.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: created.GetName(), Force: true}); err != nil {
+		t.Errorf("DeleteUser(force) unexpected error: %v", err)
+	}
+	resp, _ = users.GetUser(ctx, &apiv1.GetUserRequest{Name: created.GetName()})
+	if resp.GetErrorCode() != response.CodeNotFound {
+		t.Errorf("v1 GetUser() of a user deleted for good over v2 = %d, want %d", resp.GetErrorCode(), response.CodeNotFound)
+	}
+}
+
+func TestUserServiceV2Errors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		program  func(repo *fake.Repository)
+		call     func(svc *UserServiceV2) error
+		wantCode codes.Code
+		// wantV1 is the error code v1 sends for the same failure
+		wantV1 int32
+	}{
+		{
+			name: "get missing user",
+			call: func(svc *UserServiceV2) error {
+				_, err := svc.GetUser(ctx, &apiv1.GetUserRequest{Name: "users/999"})
+				return err
+			},
+			wantCode: codes.NotFound,
+			wantV1:   response.CodeNotFound,
+		},
+		{
+			name: "create conflict",
+			program: func(repo *fake.Repository) {
+				repo.FailNext(fake.OpCreate, repository.ErrAlreadyExists)
+			},
+			call: func(svc *UserServiceV2) error {
+				_, err := svc.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "test@example.com"}})
+				return err
+			},
+			wantCode: codes.AlreadyExists,
+			wantV1:   response.CodeAlreadyExists,
+		},
+		{
+			name: "get by unknown email",
+			call: func(svc *UserServiceV2) error {
+				_, err := svc.GetUserByEmail(ctx, &apiv1.GetUserByEmailRequest{Email: "nobody@example.com"})
+				return err
+			},
+			wantCode: codes.NotFound,
+			wantV1:   response.CodeNotFound,
+		},
+		{
+			name: "create with a taken email",
+			call: func(svc *UserServiceV2) error {
+				_, err := svc.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "seed@example.com"}})
+				return err
+			},
+			wantCode: codes.AlreadyExists,
+			wantV1:   response.CodeAlreadyExists,
+		},
+		{
+			name: "update to a taken email",
+			program: func(repo *fake.Repository) {
+				repo.FailNext(fake.OpUpdate, repository.ErrEmailTaken)
+			},
+			call: func(svc *UserServiceV2) error {
+				_, err := svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{User: &apiv1.User{Name: "users/1", Email: "taken@example.com"}})
+				return err
+			},
+			wantCode: codes.AlreadyExists,
+			wantV1:   response.CodeAlreadyExists,
+		},
+		{
+			name: "update concurrent modification",
+			program: func(repo *fake.Repository) {
+				repo.FailNext(fake.OpUpdate, repository.ErrConflict)
+			},
+			call: func(svc *UserServiceV2) error {
+				_, err := svc.UpdateUser(ctx, &apiv1.UpdateUserRequest{User: &apiv1.User{Name: "users/1", DisplayName: "Updated"}})
+				return err
+			},
+			wantCode: codes.Aborted,
+			wantV1:   response.CodeAlreadyExists,
+		},
+		{
+			name: "invalid page token",
+			call: func(svc *UserServiceV2) error {
+				_, err := svc.ListUsers(ctx, &apiv1.ListUsersRequest{PageToken: "+5"})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+			wantV1:   response.CodeInvalidArgument,
+		},
+		{
+			name: "delete storage failure",
+			program: func(repo *fake.Repository) {
+				repo.FailNext(fake.OpDelete, errors.New("disk full"))
+			},
+			call: func(svc *UserServiceV2) error {
+				_, err := svc.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: "users/1", Force: true})
+				return err
+			},
+			wantCode: codes.Internal,
+			wantV1:   response.CodeInternalError,
+		},
+		{
+			name: "undelete active user",
+			call: func(svc *UserServiceV2) error {
+				_, err := svc.UndeleteUser(ctx, &apiv1.UndeleteUserRequest{Name: "users/1"})
+				return err
+			},
+			wantCode: codes.AlreadyExists,
+			wantV1:   response.CodeAlreadyExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := fake.NewRepository()
+			svc := NewUserServiceV2(NewUserService(WithRepository(repo)))
+			if _, err := svc.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "seed@example.com"}}); err != nil {
+				t.Fatalf("CreateUser() unexpected error: %v", err)
+			}
+			if tt.program != nil {
+				tt.program(repo)
+			}
+
+			err := tt.call(svc)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("error = %v, want %v", err, tt.wantCode)
+			}
+			if v1 := statusResponse(err).GetErrorCode(); v1 != tt.wantV1 {
+				t.Errorf("v1 error_code = %d, want %d", v1, tt.wantV1)
+			}
+		})
+	}
+}
+
+func TestUserServiceV2ErrorDetails(t *testing.T) {
+	svc := NewUserServiceV2(NewUserService())
+	ctx := context.Background()
+
+	_, err := svc.GetUser(ctx, &apiv1.GetUserRequest{Name: "users/999"})
+	var info *errdetails.ResourceInfo
+	for _, d := range status.Convert(err).Details() {
+		if i, ok := d.(*errdetails.ResourceInfo); ok {
+			info = i
+		}
+	}
+	if info.GetResourceType() != "api.v1.User" || info.GetResourceName() != "users/999" {
+		t.Errorf("GetUser() of a missing user details = %v, want a ResourceInfo naming it", status.Convert(err).Details())
+	}
+
+	_, err = svc.ListUsers(ctx, &apiv1.ListUsersRequest{PageToken: "007"})
+	var bad *errdetails.BadRequest
+	for _, d := range status.Convert(err).Details() {
+		if b, ok := d.(*errdetails.BadRequest); ok {
+			bad = b
+		}
+	}
+	if len(bad.GetFieldViolations()) != 1 || bad.GetFieldViolations()[0].GetField() != "page_token" {
+		t.Errorf("ListUsers() with an invalid token details = %v, want a BadRequest for page_token", status.Convert(err).Details())
+	}
+
+	svc.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada@example.com"}})
+	_, err = svc.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada@example.com"}})
+	bad = nil
+	for _, d := range status.Convert(err).Details() {
+		if b, ok := d.(*errdetails.BadRequest); ok {
+			bad = b
+		}
+	}
+	if len(bad.GetFieldViolations()) != 1 || bad.GetFieldViolations()[0].GetField() != "user.email" {
+		t.Errorf("CreateUser() with a taken email details = %v, want a BadRequest for user.email", status.Convert(err).Details())
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+)
+
+// TaskDeactivateUser is the job kind that deactivates a user
+const TaskDeactivateUser = "user.deactivate"
+
+// TaskReindexUsers is the job kind that rebuilds the indexes of the stored
+// users
+const TaskReindexUsers = "user.reindex"
+
+// deactivateUserTask is the payload of a TaskDeactivateUser job
+type deactivateUserTask struct {
+	Name string `json:"name"`
+}
+
+// RegisterTasks registers the handlers for user tasks on q
+func (s *UserService) RegisterTasks(q *queue.Queue) {
+	q.Register(TaskDeactivateUser, s.deactivateUser)
+	q.Register(TaskReindexUsers, s.reindexUsers)
+}
+
+// ScheduleDeactivation schedules the named user to be deactivated at t. The
+// returned job's ID can be used to cancel it.
+func ScheduleDeactivation(ctx context.Context, q *queue.Queue, name string, t time.Time) (*queue.Job, error) {
+	return q.Enqueue(ctx, TaskDeactivateUser, deactivateUserTask{Name: name}, queue.WithRunAt(t))
+}
+
+// ScheduleReindex queues a rebuild of the indexes of the stored users. Its
+// job's progress is that of the rebuild.
+func ScheduleReindex(ctx context.Context, q *queue.Queue) (*queue.Job, error) {
+	return q.Enqueue(ctx, TaskReindexUsers, struct{}{})
+}
+
+func (s *UserService) deactivateUser(ctx context.Context, job *queue.Job) error {
+	var task deactivateUserTask
+	if err := job.Decode(&task); err != nil {
+		return fmt.Errorf("decode task: %w", err)
+	}
+	return s.deactivate(ctx, task.Name)
+}
+
+// deactivate deactivates the named user unless it is inactive, deleted or
+// gone
+func (s *UserService) deactivate(ctx context.Context, name string) error {
+	user, err := s.repo.Get(ctx, name)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Deleted in the meantime, nothing left to do
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.IsActive || isDeleted(user) {
+		return nil
+	}
+
+	user.IsActive = false
+	lastUpdate := s.touch(user)
+	if ctx, err = s.withOutbox(ctx, user, EventUserDeactivated); err != nil {
+		return err
+	}
+	updated, err := s.repo.Update(ctx, user, lastUpdate)
+	if err != nil {
+		return err
+	}
+	s.emit(EventUserDeactivated, updated)
+	return nil
+}
+
+// reindexUsers rebuilds the indexes of the stored users, reporting how
+// many are done, and sets the number reindexed as the job's result
+func (s *UserService) reindexUsers(ctx context.Context, job *queue.Job) error {
+	r, ok := s.repo.(repository.Reindexer)
+	if !ok {
+		return queue.Permanent(errors.New("the user repository cannot be reindexed"))
+	}
+	reindexed := 0
+	err := r.Reindex(ctx, func(done, total int) {
+		reindexed = done
+		percent := 100
+		if total > 0 {
+			percent = done * 100 / total
+		}
+		queue.ReportProgress(ctx, percent, fmt.Sprintf("%d of %d users reindexed", done, total))
+	})
+	if errors.Is(err, errors.ErrUnsupported) {
+		return queue.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	return job.SetResult(map[string]int{"user_count": reindexed})
+}
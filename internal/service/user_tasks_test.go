@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository/fake"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil/builder"
+)
+
+func TestScheduleDeactivation(t *testing.T) {
+	ctx := context.Background()
+	svc := NewUserService()
+	store := queue.NewMemoryStore()
+	q := queue.New(store, logger.Nop(), queue.Options{PollInterval: time.Millisecond})
+	svc.RegisterTasks(q)
+	q.Start(ctx)
+	defer q.Stop(ctx)
+
+	active := builder.CreateUser(t, svc, builder.NewUserBuilder())
+	kept := builder.CreateUser(t, svc, builder.NewUserBuilder())
+
+	job, err := ScheduleDeactivation(ctx, q, active.GetName(), time.Now())
+	if err != nil {
+		t.Fatalf("ScheduleDeactivation() unexpected error: %v", err)
+	}
+	cancelled, _ := ScheduleDeactivation(ctx, q, kept.GetName(), time.Now().Add(time.Hour))
+	if _, err := q.Cancel(ctx, cancelled.ID); err != nil {
+		t.Fatalf("Cancel() unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := store.Get(ctx, job.ID)
+		if got.State == queue.StateSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deactivation job state = %s, want %s", got.State, queue.StateSucceeded)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if user, _ := svc.repo.Get(ctx, active.GetName()); user.IsActive {
+		t.Errorf("user %s is still active", active.GetName())
+	}
+	if user, _ := svc.repo.Get(ctx, kept.GetName()); !user.IsActive {
+		t.Errorf("user %s was deactivated despite cancellation", kept.GetName())
+	}
+}
+
+func TestScheduleReindex(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name        string
+		svc         *UserService
+		wantState   queue.State
+		wantMessage string
+		wantResult  string
+	}{
+		{"reindexer", NewUserService(), queue.StateSucceeded, "2 of 2 users reindexed", `{"user_count":2}`},
+		{"not a reindexer", NewUserService(WithRepository(fake.NewRepository())), queue.StateDead, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := queue.NewMemoryStore()
+			q := queue.New(store, logger.Nop(), queue.Options{PollInterval: time.Millisecond})
+			tt.svc.RegisterTasks(q)
+			builder.CreateUser(t, tt.svc, builder.NewUserBuilder())
+			builder.CreateUser(t, tt.svc, builder.NewUserBuilder())
+			q.Start(ctx)
+			defer q.Stop(ctx)
+
+			job, err := ScheduleReindex(ctx, q)
+			if err != nil {
+				t.Fatalf("ScheduleReindex() unexpected error: %v", err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			got, _ := store.Get(ctx, job.ID)
+			for got.State != tt.wantState {
+				if time.Now().After(deadline) {
+					t.Fatalf("reindex job state = %s, want %s", got.State, tt.wantState)
+				}
+				time.Sleep(time.Millisecond)
+				got, _ = store.Get(ctx, job.ID)
+			}
+			if got.ProgressMessage != tt.wantMessage || string(got.Result) != tt.wantResult {
+				t.Errorf("reindex job progress %q, result %s, want %q, %s", got.ProgressMessage, got.Result, tt.wantMessage, tt.wantResult)
+			}
+		})
+	}
+}
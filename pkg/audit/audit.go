@@ -0,0 +1,129 @@
+// Package audit records who changed what. Events are buffered in memory and
+// written to a Sink in batches, off the request path.
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Event is one audited action
+type Event struct {
+	Time time.Time `json:"time"`
+
+	// Actor identifies the caller, e.g. its user or peer address
+	Actor string `json:"actor"`
+
+	// Method is the full gRPC method name
+	Method string `json:"method"`
+
+	// Resource is the resource name acted on, when the request has one
+	Resource string `json:"resource,omitempty"`
+
+	// Code is the response error code, 0 on success
+	Code  int32  `json:"code"`
+	Error string `json:"error,omitempty"`
+
+	// Details are added by the handler with AddDetail, e.g. a setting's
+	// old and new values
+	Details map[string]string `json:"details,omitempty"`
+}
+
+type detailsKey struct{}
+
+// details collects what a handler adds with AddDetail
+type details struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// AddDetail records key and value on the audit event of the call ctx
+// belongs to. It does nothing outside an audited call.
+func AddDetail(ctx context.Context, key, value string) {
+	d, ok := ctx.Value(detailsKey{}).(*details)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.values == nil {
+		d.values = make(map[string]string)
+	}
+	d.values[key] = value
+}
+
+// Sink stores batches of events. Write must not keep the slice after it
+// returns.
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+}
+
+// SinkFunc adapts a function to the Sink interface
+type SinkFunc func(ctx context.Context, events []Event) error
+
+// Write calls f(ctx, events)
+func (f SinkFunc) Write(ctx context.Context, events []Event) error {
+	return f(ctx, events)
+}
+
+// LogSink writes events to the log
+func LogSink(log logger.Logger) Sink {
+	return SinkFunc(func(ctx context.Context, events []Event) error {
+		for _, ev := range events {
+			if len(ev.Details) > 0 {
+				log.Info("Audit: %s called %s on %q (code %d) %v", ev.Actor, ev.Method, ev.Resource, ev.Code, ev.Details)
+				continue
+			}
+			log.Info("Audit: %s called %s on %q (code %d)", ev.Actor, ev.Method, ev.Resource, ev.Code)
+		}
+		return nil
+	})
+}
+
+// MemorySink keeps events in memory, for tests and local development
+type MemorySink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewMemorySink creates an empty MemorySink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Write appends events
+func (m *MemorySink) Write(ctx context.Context, events []Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, events...)
+	return nil
+}
+
+// Events returns a copy of the stored events
+func (m *MemorySink) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Event(nil), m.events...)
+}
+
+// Purge deletes events recorded before cutoff and returns how many it
+// deleted. With dryRun it only counts them.
+func (m *MemorySink) Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.events[:0:0]
+	for _, ev := range m.events {
+		if !ev.Time.Before(cutoff) {
+			kept = append(kept, ev)
+		}
+	}
+	purged := len(m.events) - len(kept)
+	if !dryRun {
+		m.events = kept
+	}
+	return purged, nil
+}
@@ -0,0 +1,249 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mutation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// batchSink records the size of every write
+type batchSink struct {
+	mu      sync.Mutex
+	batches []int
+	events  int
+	fail    atomic.Bool
+}
+
+func (s *batchSink) Write(ctx context.Context, events []Event) error {
+	if s.fail.Load() {
+		return errors.New("sink down")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, len(events))
+	s.events += len(events)
+	return nil
+}
+
+func (s *batchSink) written() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBufferFlushesFullBatches(t *testing.T) {
+	sink := &batchSink{}
+	b := NewBuffer(sink, logger.Nop(), Options{BatchSize: 3, FlushInterval: time.Hour})
+	b.Start(context.Background())
+
+	for i := 0; i < 7; i++ {
+		if err := b.Record(context.Background(), Event{Method: "/api.v1.UserService/CreateUser"}); err != nil {
+			t.Fatalf("Record() unexpected error: %v", err)
+		}
+	}
+	waitFor(t, "two full batches", func() bool { return sink.written() == 6 })
+
+	// Stop flushes the partial batch
+	if err := b.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() unexpected error: %v", err)
+	}
+	if want := []int{3, 3, 1}; len(sink.batches) != 3 || sink.batches[2] != 1 {
+		t.Errorf("batches = %v, want %v", sink.batches, want)
+	}
+	stats := b.Stats()
+	if stats.Recorded != 7 || stats.Flushed != 7 || stats.Pending != 0 {
+		t.Errorf("Stats() = %+v, want 7 recorded and flushed", stats)
+	}
+	if err := b.Record(context.Background(), Event{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Record() after Stop() error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestBufferFlushesOnInterval(t *testing.T) {
+	sink := &batchSink{}
+	b := NewBuffer(sink, logger.Nop(), Options{BatchSize: 100, FlushInterval: time.Millisecond})
+	b.Start(context.Background())
+	defer b.Stop(context.Background())
+
+	b.Record(context.Background(), Event{})
+	waitFor(t, "interval flush", func() bool { return sink.written() == 1 })
+}
+
+func TestBufferRetriesAndAppliesBackpressure(t *testing.T) {
+	sink := &batchSink{}
+	sink.fail.Store(true)
+	b := NewBuffer(sink, logger.Nop(), Options{BatchSize: 2, Capacity: 2, FlushInterval: time.Millisecond})
+	b.Start(context.Background())
+	defer b.Stop(context.Background())
+
+	// The flusher holds one failing batch of 2, the channel holds 2 more
+	var dropped int
+	for i := 0; i < 6; i++ {
+		if errors.Is(b.Record(context.Background(), Event{}), ErrBufferFull) {
+			dropped++
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if dropped != 2 {
+		t.Errorf("dropped %d events, want 2", dropped)
+	}
+	if stats := b.Stats(); stats.FailedWrites == 0 || stats.Dropped != 2 {
+		t.Errorf("Stats() = %+v, want failed writes and 2 dropped", stats)
+	}
+
+	sink.fail.Store(false)
+	waitFor(t, "retried batches", func() bool { return sink.written() == 4 })
+}
+
+func TestBufferBlockWaitsForRoom(t *testing.T) {
+	sink := &batchSink{}
+	sink.fail.Store(true)
+	b := NewBuffer(sink, logger.Nop(), Options{BatchSize: 1, Capacity: 1, FlushInterval: time.Millisecond, Block: true})
+	b.Start(context.Background())
+	defer b.Stop(context.Background())
+
+	b.Record(context.Background(), Event{})
+	waitFor(t, "first write attempt", func() bool { return b.Stats().FailedWrites > 0 })
+	b.Record(context.Background(), Event{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Record(ctx, Event{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Record() on a full buffer error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- b.Record(context.Background(), Event{}) }()
+	sink.fail.Store(false)
+	if err := <-done; err != nil {
+		t.Errorf("Record() after the sink recovered error = %v, want nil", err)
+	}
+}
+
+func TestBufferStopDeadline(t *testing.T) {
+	sink := SinkFunc(func(ctx context.Context, events []Event) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	b := NewBuffer(sink, logger.Nop(), Options{BatchSize: 1, WriteTimeout: time.Hour})
+	b.Start(context.Background())
+	b.Record(context.Background(), Event{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if stats := b.Stats(); stats.Dropped != 1 || stats.Pending != 0 {
+		t.Errorf("Stats() = %+v, want the unwritten event counted as dropped", stats)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	sink := NewMemorySink()
+	b := NewBuffer(sink, logger.Nop(), Options{})
+	b.Start(context.Background())
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}})
+	intercept := UnaryServerInterceptor(b, mutation.NewSet(
+		"/api.v1.UserService/UpdateUser", "/api.v1.UserService/DeleteUser", "/api.v1.AdminService/RetryJob"))
+	call := func(method string, req interface{}, resp interface{}, err error) {
+		intercept(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return resp, err
+		})
+	}
+
+	call("/api.v1.UserService/GetUser", &apiv1.GetUserRequest{Name: "users/1"}, &apiv1.CommonResponse{}, nil)
+	call("/api.v1.UserService/ListUsers", &apiv1.ListUsersRequest{}, &apiv1.CommonResponse{}, nil)
+	call("/api.v1.UserService/UpdateUser", &apiv1.UpdateUserRequest{User: &apiv1.User{Name: "users/1"}}, &apiv1.CommonResponse{}, nil)
+	call("/api.v1.UserService/DeleteUser", &apiv1.DeleteUserRequest{Name: "users/2"}, &apiv1.CommonResponse{ErrorCode: 404, ErrorMsg: "not found"}, nil)
+	call("/api.v1.AdminService/RetryJob", &apiv1.RetryJobRequest{Name: "jobs/3"}, nil, status.Error(codes.Unavailable, "down"))
+	b.Stop(context.Background())
+
+	events := sink.Events()
+	if len(events) != 3 {
+		t.Fatalf("recorded %d events, want 3 mutations: %+v", len(events), events)
+	}
+	tests := []struct {
+		resource string
+		code     int32
+	}{
+		{"users/1", 0},
+		{"users/2", 404},
+		{"jobs/3", int32(codes.Unavailable)},
+	}
+	for i, tt := range tests {
+		ev := events[i]
+		if ev.Resource != tt.resource || ev.Code != tt.code || ev.Actor != "10.0.0.1:5000" {
+			t.Errorf("event %d = %+v, want resource %s, code %d from 10.0.0.1:5000", i, ev, tt.resource, tt.code)
+		}
+	}
+}
+
+func TestUnaryServerInterceptorIdentityAndDetails(t *testing.T) {
+	sink := NewMemorySink()
+	b := NewBuffer(sink, logger.Nop(), Options{})
+	b.Start(context.Background())
+
+	ctx := auth.WithIdentity(context.Background(), "ops")
+	UnaryServerInterceptor(b, mutation.NewSet("/api.v1.AdminService/UpdateSetting"))(ctx, &apiv1.UpdateSettingRequest{Setting: &apiv1.Setting{Name: "settings/log_level"}},
+		&grpc.UnaryServerInfo{FullMethod: "/api.v1.AdminService/UpdateSetting"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			AddDetail(ctx, "old_value", "info")
+			AddDetail(ctx, "new_value", "debug")
+			return &apiv1.CommonResponse{}, nil
+		})
+	b.Stop(context.Background())
+
+	events := sink.Events()
+	if len(events) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(events))
+	}
+	ev := events[0]
+	if ev.Actor != "ops" || ev.Resource != "settings/log_level" || ev.Details["old_value"] != "info" || ev.Details["new_value"] != "debug" {
+		t.Errorf("event = %+v, want ops changing settings/log_level from info to debug", ev)
+	}
+}
+
+func TestMemorySinkPurge(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink := NewMemorySink()
+	sink.Write(context.Background(), []Event{
+		{Time: now.Add(-2 * time.Hour), Method: "old"},
+		{Time: now, Method: "new"},
+	})
+
+	if n, _ := sink.Purge(context.Background(), now.Add(-time.Hour), true); n != 1 || len(sink.Events()) != 2 {
+		t.Errorf("dry run Purge() = %d with %d events left, want 1 with 2 left", n, len(sink.Events()))
+	}
+	if n, _ := sink.Purge(context.Background(), now.Add(-time.Hour), false); n != 1 {
+		t.Errorf("Purge() = %d, want 1", n)
+	}
+	if events := sink.Events(); len(events) != 1 || events[0].Method != "new" {
+		t.Errorf("events after Purge() = %+v, want only the new one", events)
+	}
+}
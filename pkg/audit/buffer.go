@@ -0,0 +1,266 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+var (
+	// ErrBufferFull is returned by Record when the buffer is full and the
+	// event was dropped
+	ErrBufferFull = errors.New("audit: buffer full")
+
+	// ErrClosed is returned by Record after Stop
+	ErrClosed = errors.New("audit: buffer closed")
+)
+
+// Options configures a Buffer
+type Options struct {
+	// BatchSize flushes once this many events are buffered (default 100)
+	BatchSize int
+
+	// FlushInterval flushes a partial batch this often (default 1s)
+	FlushInterval time.Duration
+
+	// Capacity is the number of events held while the sink is slow or
+	// down (default 10000)
+	Capacity int
+
+	// Block makes Record wait for room when the buffer is full, until its
+	// context ends, instead of dropping the event
+	Block bool
+
+	// WriteTimeout bounds each write to the sink (default 5s)
+	WriteTimeout time.Duration
+}
+
+// Stats is a snapshot of buffer activity
+type Stats struct {
+	Recorded uint64
+	Flushed  uint64
+	Dropped  uint64
+
+	// FailedWrites counts sink writes that returned an error
+	FailedWrites uint64
+	Pending      int
+}
+
+// Buffer batches events for a Sink. When the sink fails, the current batch
+// is kept and retried on the next flush; new events queue up to Capacity,
+// beyond which Record drops or blocks.
+type Buffer struct {
+	sink Sink
+	log  logger.Logger
+	opts Options
+
+	events chan Event
+	quit   chan struct{}
+	done   chan struct{}
+
+	// ctx bounds sink writes and is cancelled when Stop runs out of time
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.RWMutex
+	started  bool
+	closed   bool
+	stopOnce sync.Once
+
+	recorded     atomic.Uint64
+	flushed      atomic.Uint64
+	dropped      atomic.Uint64
+	failedWrites atomic.Uint64
+	pending      atomic.Int64
+}
+
+// NewBuffer creates a Buffer. Call Start to begin flushing.
+func NewBuffer(sink Sink, log logger.Logger, opts Options) *Buffer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = 10000
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 5 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Buffer{
+		sink:   sink,
+		log:    log,
+		opts:   opts,
+		events: make(chan Event, opts.Capacity),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Record buffers ev without waiting for the sink
+func (b *Buffer) Record(ctx context.Context, ev Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrClosed
+	}
+
+	select {
+	case b.events <- ev:
+		b.recorded.Add(1)
+		b.pending.Add(1)
+		return nil
+	default:
+	}
+
+	if !b.opts.Block {
+		if b.dropped.Add(1) == 1 {
+			b.log.Warn("Audit buffer is full, dropping events")
+		}
+		return ErrBufferFull
+	}
+	select {
+	case b.events <- ev:
+		b.recorded.Add(1)
+		b.pending.Add(1)
+		return nil
+	case <-ctx.Done():
+		b.dropped.Add(1)
+		return ctx.Err()
+	}
+}
+
+// Start launches the flush goroutine
+func (b *Buffer) Start(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	if !b.started {
+		b.started = true
+		go b.run()
+	}
+	return nil
+}
+
+// Stop stops accepting events and flushes what is buffered. If ctx ends
+// first, the pending write is cancelled, remaining events are lost and
+// ctx's error is returned.
+func (b *Buffer) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	started := b.started
+	b.mu.Unlock()
+	if !started {
+		b.cancel()
+		return nil
+	}
+	b.stopOnce.Do(func() { close(b.quit) })
+
+	select {
+	case <-b.done:
+		b.cancel()
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-b.done
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of buffer activity
+func (b *Buffer) Stats() Stats {
+	return Stats{
+		Recorded:     b.recorded.Load(),
+		Flushed:      b.flushed.Load(),
+		Dropped:      b.dropped.Load(),
+		FailedWrites: b.failedWrites.Load(),
+		Pending:      int(b.pending.Load()),
+	}
+}
+
+func (b *Buffer) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, b.opts.BatchSize)
+	for {
+		// While a full batch cannot be written, stop taking events so the
+		// channel fills up and Record applies backpressure
+		events := b.events
+		if len(batch) >= b.opts.BatchSize {
+			events = nil
+		}
+
+		select {
+		case ev := <-events:
+			batch = append(batch, ev)
+			if len(batch) >= b.opts.BatchSize {
+				batch = b.flush(batch)
+			}
+		case <-ticker.C:
+			batch = b.flush(batch)
+		case <-b.quit:
+			b.drain(batch)
+			return
+		}
+	}
+}
+
+// drain writes the remaining events in batches, giving up at the first
+// failure since nothing will retry it
+func (b *Buffer) drain(batch []Event) {
+	for {
+		select {
+		case ev := <-b.events:
+			batch = append(batch, ev)
+			if len(batch) < b.opts.BatchSize {
+				continue
+			}
+		default:
+		}
+
+		if batch = b.flush(batch); len(batch) > 0 {
+			lost := int64(len(batch) + len(b.events))
+			b.dropped.Add(uint64(lost))
+			b.pending.Add(-lost)
+			b.log.Error("Audit buffer stopped with %d unwritten event(s)", lost)
+			return
+		}
+		if len(b.events) == 0 {
+			return
+		}
+	}
+}
+
+// flush writes batch to the sink. It returns the emptied batch on success
+// and the unchanged batch on failure, to be retried.
+func (b *Buffer) flush(batch []Event) []Event {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, b.opts.WriteTimeout)
+	defer cancel()
+	if err := b.sink.Write(ctx, batch); err != nil {
+		b.failedWrites.Add(1)
+		b.log.Error("Failed to write %d audit event(s), will retry: %v", len(batch), err)
+		return batch
+	}
+
+	b.flushed.Add(uint64(len(batch)))
+	b.pending.Add(-int64(len(batch)))
+	return batch[:0]
+}
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mutation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// UnaryServerInterceptor records an event for every call to one of the
+// mutations. Recording never fails the call; events dropped under
+// backpressure show up in the buffer's stats.
+func UnaryServerInterceptor(b *Buffer, mutations mutation.Set) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !mutations.Contains(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		d := &details{}
+		resp, err := handler(context.WithValue(ctx, detailsKey{}, d), req)
+
+		d.mu.Lock()
+		ev := Event{
+			Time:     time.Now(),
+			Actor:    actor(ctx),
+			Method:   info.FullMethod,
+			Resource: ResourceName(req),
+			Details:  d.values,
+		}
+		d.mu.Unlock()
+		switch {
+		case err != nil:
+			ev.Code = int32(status.Code(err))
+			ev.Error = err.Error()
+		default:
+			if r, ok := resp.(interface {
+				GetErrorCode() int32
+				GetErrorMsg() string
+			}); ok {
+				ev.Code = r.GetErrorCode()
+				ev.Error = r.GetErrorMsg()
+			}
+		}
+		b.Record(ctx, ev)
+
+		return resp, err
+	}
+}
+
+// actor identifies the caller by its authenticated identity, or by its
+// peer address for unauthenticated calls
+func actor(ctx context.Context) string {
+	if name, ok := auth.IdentityFromContext(ctx); ok {
+		return name
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
+
+// ResourceName returns the resource the request targets: its name or
+// parent field, or the name of a message field such as UpdateUserRequest's
+// user
+func ResourceName(req interface{}) string {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return ""
+	}
+	msg := m.ProtoReflect()
+	if name := stringField(msg, "name"); name != "" {
+		return name
+	}
+	if parent := stringField(msg, "parent"); parent != "" {
+		return parent
+	}
+
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		if f.Kind() == protoreflect.MessageKind && f.Cardinality() != protoreflect.Repeated && msg.Has(f) {
+			if name := stringField(msg.Get(f).Message(), "name"); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func stringField(msg protoreflect.Message, name protoreflect.Name) string {
+	f := msg.Descriptor().Fields().ByName(name)
+	if f == nil || f.Kind() != protoreflect.StringKind || f.Cardinality() == protoreflect.Repeated {
+		return ""
+	}
+	return msg.Get(f).String()
+}
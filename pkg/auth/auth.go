@@ -0,0 +1,150 @@
+// Package auth authenticates callers of privileged RPCs with static bearer
+// tokens and carries their identity in the request context.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying the authenticated caller's name
+func WithIdentity(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, identityKey{}, name)
+}
+
+// IdentityFromContext returns the authenticated caller's name, if any
+func IdentityFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(identityKey{}).(string)
+	return name, ok
+}
+
+// Token is a bearer token and the identity it authenticates
+type Token struct {
+	Name  string
+	Token string
+
+	// Tenant is the tenant the holder belongs to, its tenant claim. Empty
+	// for operators acting across tenants.
+	Tenant string
+
+	// Scopes are what the holder may see or do beyond anonymous callers,
+	// e.g. "users:pii"
+	Scopes []string
+
+	// Roles are the holder's authorization roles, e.g. "admin"
+	Roles []string
+}
+
+// TokenAuthenticator authenticates callers by the bearer token in their
+// authorization metadata. The HTTP gateway forwards the Authorization
+// header as that metadata.
+type TokenAuthenticator struct {
+	tokens []Token
+}
+
+// NewTokenAuthenticator creates a TokenAuthenticator accepting tokens.
+// Tokens with an empty secret are ignored.
+func NewTokenAuthenticator(tokens []Token) *TokenAuthenticator {
+	a := &TokenAuthenticator{}
+	for _, t := range tokens {
+		if t.Token != "" {
+			a.tokens = append(a.tokens, t)
+		}
+	}
+	return a
+}
+
+// Authenticate returns the identity of the caller presenting the bearer
+// token in ctx's incoming metadata
+func (a *TokenAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+	t, found := a.Lookup(token)
+	if !found {
+		return "", status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	return t.Name, nil
+}
+
+// Lookup returns the token matching secret, for callers that do not send
+// it as gRPC metadata or need its claims
+func (a *TokenAuthenticator) Lookup(secret string) (Token, bool) {
+	// Compare against every token so the time taken does not reveal which
+	// one nearly matched
+	var match Token
+	var found bool
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(t.Token)) == 1 {
+			match, found = t, true
+		}
+	}
+	return match, found
+}
+
+// Scopes returns the scopes of the bearer token in ctx's incoming metadata,
+// none when there is no valid token or a is nil
+func (a *TokenAuthenticator) Scopes(ctx context.Context) []string {
+	if a == nil {
+		return nil
+	}
+	secret, ok := BearerToken(ctx)
+	if !ok {
+		return nil
+	}
+	t, _ := a.Lookup(secret)
+	return t.Scopes
+}
+
+// BearerToken returns the bearer token in ctx's incoming metadata, if any
+func BearerToken(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", false
+	}
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// UnaryServerInterceptor requires a valid token for methods under any of
+// prefixes, e.g. "/api.v1.AdminService/", and adds the caller's identity to
+// their context. Other methods pass through.
+func (a *TokenAuthenticator) UnaryServerInterceptor(prefixes ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !hasAnyPrefix(info.FullMethod, prefixes) {
+			return handler(ctx, req)
+		}
+		name, err := a.Authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(WithIdentity(ctx, name), req)
+	}
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenAuthenticator(t *testing.T) {
+	a := NewTokenAuthenticator([]Token{
+		{Name: "ops", Token: "s3cret"},
+		{Name: "disabled", Token: ""},
+	})
+	intercept := a.UnaryServerInterceptor("/api.v1.AdminService/")
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		wantCode      codes.Code
+		wantIdentity  string
+	}{
+		{"valid token", "/api.v1.AdminService/ListJobs", "Bearer s3cret", codes.OK, "ops"},
+		{"scheme is case insensitive", "/api.v1.AdminService/ListJobs", "bearer s3cret", codes.OK, "ops"},
+		{"missing", "/api.v1.AdminService/ListJobs", "", codes.Unauthenticated, ""},
+		{"wrong scheme", "/api.v1.AdminService/ListJobs", "Basic s3cret", codes.Unauthenticated, ""},
+		{"wrong token", "/api.v1.AdminService/ListJobs", "Bearer guess", codes.Unauthenticated, ""},
+		{"empty token never matches", "/api.v1.AdminService/ListJobs", "Bearer ", codes.Unauthenticated, ""},
+		{"unprotected method", "/api.v1.UserService/GetUser", "", codes.OK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.authorization != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.authorization))
+			}
+			var identity string
+			_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				identity, _ = IdentityFromContext(ctx)
+				return nil, nil
+			})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("status code = %v, want %v (err: %v)", got, tt.wantCode, err)
+			}
+			if identity != tt.wantIdentity {
+				t.Errorf("identity = %q, want %q", identity, tt.wantIdentity)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Package authz authorizes RPCs by role.
+//
+// Roles grant permissions such as "users.delete", or patterns of them such
+// as "users.*" or "*". A grant can be narrowed to resources by appending
+// "@" and a resource pattern: "users.update@users/42" lets its holder update
+// that user only. Patterns follow path.Match, so "*" stops at a slash.
+//
+// The interceptors require the permission configured for each method,
+// checked against the resource the request targets, and put the caller's
+// roles in the context so services can check permissions of their own with
+// Allowed and Require.
+package authz
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/audit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policy is what an Authorizer enforces
+type Policy struct {
+	// Roles map role names to the permissions they grant
+	Roles map[string][]string
+
+	// Methods map full gRPC methods, or prefixes of them ending in "/",
+	// to the permission they require. The longest match applies; methods
+	// matching none are not checked.
+	Methods map[string]string
+}
+
+// RoleSource returns the roles of the caller of ctx. It fails with an
+// Unauthenticated status when the caller presents invalid credentials.
+type RoleSource func(ctx context.Context) ([]string, error)
+
+// TokenRoles returns a RoleSource giving callers the roles of their bearer
+// token in a, and callers without one the anonymous roles. a may be nil
+// when no tokens are configured.
+func TokenRoles(a *auth.TokenAuthenticator, anonymous []string) RoleSource {
+	return func(ctx context.Context) ([]string, error) {
+		secret, ok := auth.BearerToken(ctx)
+		if !ok {
+			return anonymous, nil
+		}
+		if a != nil {
+			if t, found := a.Lookup(secret); found {
+				return t.Roles, nil
+			}
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+}
+
+// grant is a permission pattern, narrowed to a resource pattern when
+// resource is not empty
+type grant struct {
+	permission string
+	resource   string
+}
+
+// Authorizer checks callers' permissions against a Policy
+type Authorizer struct {
+	roles   map[string][]grant
+	methods map[string]string
+
+	// prefixes are the method prefixes, longest first
+	prefixes []string
+
+	source RoleSource
+}
+
+// New creates an Authorizer enforcing p, with the callers' roles read from
+// source
+func New(p Policy, source RoleSource) (*Authorizer, error) {
+	a := &Authorizer{
+		roles:   make(map[string][]grant, len(p.Roles)),
+		methods: make(map[string]string, len(p.Methods)),
+		source:  source,
+	}
+	for role, permissions := range p.Roles {
+		for _, perm := range permissions {
+			g, err := parseGrant(perm)
+			if err != nil {
+				return nil, fmt.Errorf("role %s: %w", role, err)
+			}
+			a.roles[role] = append(a.roles[role], g)
+		}
+		if _, ok := a.roles[role]; !ok {
+			a.roles[role] = nil
+		}
+	}
+	for method, perm := range p.Methods {
+		if !strings.HasPrefix(method, "/") {
+			return nil, fmt.Errorf("method %q must start with /", method)
+		}
+		if perm == "" {
+			return nil, fmt.Errorf("method %s: empty permission", method)
+		}
+		a.methods[method] = perm
+		if strings.HasSuffix(method, "/") {
+			a.prefixes = append(a.prefixes, method)
+		}
+	}
+	sort.Slice(a.prefixes, func(i, j int) bool { return len(a.prefixes[i]) > len(a.prefixes[j]) })
+	return a, nil
+}
+
+func parseGrant(s string) (grant, error) {
+	perm, resource, _ := strings.Cut(s, "@")
+	if perm == "" {
+		return grant{}, fmt.Errorf("grant %q: empty permission", s)
+	}
+	for _, pattern := range []string{perm, resource} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return grant{}, fmt.Errorf("grant %q: %w", s, err)
+		}
+	}
+	return grant{permission: perm, resource: resource}, nil
+}
+
+// CheckRoles reports an error naming the first of roles the policy does
+// not define, so configuration mistakes fail startup rather than requests
+func (a *Authorizer) CheckRoles(roles ...string) error {
+	for _, role := range roles {
+		if _, ok := a.roles[role]; !ok {
+			return fmt.Errorf("unknown role %q", role)
+		}
+	}
+	return nil
+}
+
+// Permission returns the permission method requires, if any
+func (a *Authorizer) Permission(method string) (string, bool) {
+	if perm, ok := a.methods[method]; ok {
+		return perm, true
+	}
+	for _, prefix := range a.prefixes {
+		if strings.HasPrefix(method, prefix) {
+			return a.methods[prefix], true
+		}
+	}
+	return "", false
+}
+
+// Allowed reports whether any of roles grants permission on resource.
+// resource is empty for permissions that are not about one resource.
+func (a *Authorizer) Allowed(roles []string, permission, resource string) bool {
+	for _, role := range roles {
+		for _, g := range a.roles[role] {
+			if ok, _ := path.Match(g.permission, permission); !ok {
+				continue
+			}
+			if g.resource == "" {
+				return true
+			}
+			if ok, _ := path.Match(g.resource, resource); ok && resource != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UnaryServerInterceptor requires the permission of the called method on
+// the resource the request targets
+func (a *Authorizer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authorize(ctx, info.FullMethod, audit.ResourceName(req))
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor requires the permission of the called method.
+// Streams are checked before their first message, without a resource.
+func (a *Authorizer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authorize(ss.Context(), info.FullMethod, "")
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authorize resolves the caller's roles, checks them against the method's
+// permission and returns a context carrying them
+func (a *Authorizer) authorize(ctx context.Context, method, resource string) (context.Context, error) {
+	roles, err := a.source(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if perm, ok := a.Permission(method); ok && !a.Allowed(roles, perm, resource) {
+		return nil, denied(perm, resource)
+	}
+	return context.WithValue(ctx, subjectKey{}, &subject{authz: a, roles: roles}), nil
+}
+
+// authorizedStream hands the handler the context carrying the roles
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context { return s.ctx }
+
+type subjectKey struct{}
+
+// subject is the authorized caller of a request
+type subject struct {
+	authz *Authorizer
+	roles []string
+}
+
+// Roles returns the roles of the caller of ctx, once the interceptors have
+// authorized it
+func Roles(ctx context.Context) []string {
+	if s, ok := ctx.Value(subjectKey{}).(*subject); ok {
+		return s.roles
+	}
+	return nil
+}
+
+// Allowed reports whether the caller of ctx has permission on resource.
+// Without authorization configured every caller is allowed.
+func Allowed(ctx context.Context, permission, resource string) bool {
+	s, ok := ctx.Value(subjectKey{}).(*subject)
+	if !ok {
+		return true
+	}
+	return s.authz.Allowed(s.roles, permission, resource)
+}
+
+// Require returns a PermissionDenied error unless the caller of ctx has
+// permission on resource
+func Require(ctx context.Context, permission, resource string) error {
+	if !Allowed(ctx, permission, resource) {
+		return denied(permission, resource)
+	}
+	return nil
+}
+
+func denied(permission, resource string) error {
+	if resource == "" {
+		return status.Errorf(codes.PermissionDenied, "permission %s required", permission)
+	}
+	return status.Errorf(codes.PermissionDenied, "permission %s required on %s", permission, resource)
+}
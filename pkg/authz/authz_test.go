@@ -0,0 +1,147 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testPolicy = Policy{
+	Roles: map[string][]string{
+		"admin":  {"*"},
+		"user":   {"users.read", "users.create"},
+		"owner":  {"users.update@users/42"},
+		"nobody": {},
+	},
+	Methods: map[string]string{
+		"/api.v1.UserService/GetUser":    "users.read",
+		"/api.v1.UserService/UpdateUser": "users.update",
+		"/api.v1.UserService/DeleteUser": "users.delete",
+		"/api.v1.AdminService/":          "admin",
+	},
+}
+
+func TestAuthorizerAllowed(t *testing.T) {
+	a, err := New(testPolicy, nil)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		roles      []string
+		permission string
+		resource   string
+		want       bool
+	}{
+		{[]string{"admin"}, "users.delete", "users/1", true},
+		{[]string{"user"}, "users.read", "users/1", true},
+		{[]string{"user"}, "users.delete", "users/1", false},
+		{[]string{"owner"}, "users.update", "users/42", true},
+		{[]string{"owner"}, "users.update", "users/43", false},
+		{[]string{"owner"}, "users.update", "", false},
+		{[]string{"nobody", "user"}, "users.create", "", true},
+		{[]string{"undefined"}, "users.read", "", false},
+		{nil, "users.read", "", false},
+	}
+	for _, tt := range tests {
+		if got := a.Allowed(tt.roles, tt.permission, tt.resource); got != tt.want {
+			t.Errorf("Allowed(%v, %s, %q) = %v, want %v", tt.roles, tt.permission, tt.resource, got, tt.want)
+		}
+	}
+
+	if err := a.CheckRoles("user", "nobody"); err != nil {
+		t.Errorf("CheckRoles() of defined roles unexpected error: %v", err)
+	}
+	if err := a.CheckRoles("user", "root"); err == nil {
+		t.Error("CheckRoles() of an undefined role expected error")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for name, p := range map[string]Policy{
+		"bad pattern":        {Roles: map[string][]string{"r": {"users.["}}},
+		"empty permission":   {Roles: map[string][]string{"r": {"@users/1"}}},
+		"relative method":    {Methods: map[string]string{"api.v1.UserService/GetUser": "users.read"}},
+		"method without one": {Methods: map[string]string{"/api.v1.UserService/GetUser": ""}},
+	} {
+		if _, err := New(p, nil); err == nil {
+			t.Errorf("New() with a %s expected error", name)
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tokens := auth.NewTokenAuthenticator([]auth.Token{
+		{Name: "ops", Token: "ops-token", Roles: []string{"admin"}},
+		{Name: "alice", Token: "alice-token", Roles: []string{"user", "owner"}},
+	})
+	a, err := New(testPolicy, TokenRoles(tokens, []string{"user"}))
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	intercept := a.UnaryServerInterceptor()
+
+	tests := []struct {
+		name     string
+		token    string
+		method   string
+		req      interface{}
+		wantCode codes.Code
+	}{
+		{"anonymous read", "", "/api.v1.UserService/GetUser", &apiv1.GetUserRequest{Name: "users/1"}, codes.OK},
+		{"anonymous delete", "", "/api.v1.UserService/DeleteUser", &apiv1.DeleteUserRequest{Name: "users/1"}, codes.PermissionDenied},
+		{"admin delete", "ops-token", "/api.v1.UserService/DeleteUser", &apiv1.DeleteUserRequest{Name: "users/1"}, codes.OK},
+		{"owner updates own user", "alice-token", "/api.v1.UserService/UpdateUser", &apiv1.UpdateUserRequest{User: &apiv1.User{Name: "users/42"}}, codes.OK},
+		{"owner updates another user", "alice-token", "/api.v1.UserService/UpdateUser", &apiv1.UpdateUserRequest{User: &apiv1.User{Name: "users/7"}}, codes.PermissionDenied},
+		{"admin API by prefix", "alice-token", "/api.v1.AdminService/ListJobs", nil, codes.PermissionDenied},
+		{"unlisted method", "", "/api.v1.UserService/ListUsers", nil, codes.OK},
+		{"invalid token", "guess", "/api.v1.UserService/ListUsers", nil, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tt.token))
+			}
+			_, err := intercept(ctx, tt.req, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("code = %v, want %v (%v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	if err := Require(context.Background(), "users.delete", "users/1"); err != nil {
+		t.Errorf("Require() without authorization configured unexpected error: %v", err)
+	}
+
+	a, err := New(testPolicy, TokenRoles(nil, []string{"owner"}))
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	var handlerCtx context.Context
+	a.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/api.v1.TaskService/GetTask"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			handlerCtx = ctx
+			return nil, nil
+		})
+
+	if roles := Roles(handlerCtx); len(roles) != 1 || roles[0] != "owner" {
+		t.Errorf("Roles() = %v, want the anonymous roles", roles)
+	}
+	if err := Require(handlerCtx, "users.update", "users/42"); err != nil {
+		t.Errorf("Require() on the granted resource unexpected error: %v", err)
+	}
+	if err := Require(handlerCtx, "users.update", "users/1"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Require() on another resource = %v, want PermissionDenied", err)
+	}
+}
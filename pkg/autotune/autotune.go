@@ -0,0 +1,180 @@
+// Package autotune sizes the Go runtime to the container it runs in. It reads
+// the cgroup CPU and memory limits and sets GOMAXPROCS and GOMEMLIMIT from
+// them, so an instance under quota neither runs more threads than it gets
+// CPU for nor grows its heap past the point where it is OOM-killed.
+package autotune
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// unlimitedV1 is the smallest cgroup v1 memory limit treated as no limit.
+// Unlimited cgroups report the largest page-aligned int64.
+const unlimitedV1 = 1 << 62
+
+// Limits are the resources available to the process
+type Limits struct {
+	// CPU is the CPU quota in cores, 0 when unlimited
+	CPU float64
+
+	// Memory is the memory limit in bytes, 0 when unlimited
+	Memory int64
+}
+
+// Detect reads the cgroup limits from fsys, the cgroup filesystem usually
+// mounted at /sys/fs/cgroup. cgroup v2 is tried first, then v1. Missing
+// files mean no limit.
+func Detect(fsys fs.FS) (Limits, error) {
+	var l Limits
+
+	// cgroup v2: cpu.max is "<quota> <period>" or "max <period>"
+	if data, err := fs.ReadFile(fsys, "cpu.max"); err == nil {
+		quota, period, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+		if quota != "max" {
+			cpu, err := ratio(quota, period)
+			if err != nil {
+				return Limits{}, err
+			}
+			l.CPU = cpu
+		}
+	} else if data, err := fs.ReadFile(fsys, "cpu/cpu.cfs_quota_us"); err == nil {
+		// cgroup v1: a quota of -1 means unlimited
+		quota := strings.TrimSpace(string(data))
+		if quota != "-1" {
+			period, err := fs.ReadFile(fsys, "cpu/cpu.cfs_period_us")
+			if err != nil {
+				return Limits{}, err
+			}
+			cpu, err := ratio(quota, strings.TrimSpace(string(period)))
+			if err != nil {
+				return Limits{}, err
+			}
+			l.CPU = cpu
+		}
+	}
+
+	if data, err := fs.ReadFile(fsys, "memory.max"); err == nil {
+		if v := strings.TrimSpace(string(data)); v != "max" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return Limits{}, err
+			}
+			l.Memory = n
+		}
+	} else if data, err := fs.ReadFile(fsys, "memory/memory.limit_in_bytes"); err == nil {
+		n, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return Limits{}, err
+		}
+		if n < unlimitedV1 {
+			l.Memory = n
+		}
+	}
+
+	return l, nil
+}
+
+func ratio(quota, period string) (float64, error) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return 0, err
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil {
+		return 0, err
+	}
+	if p <= 0 {
+		return 0, errors.New("autotune: cgroup CPU period must be positive")
+	}
+	return q / p, nil
+}
+
+// Options override what Apply derives from the limits
+type Options struct {
+	// GOMAXPROCS, when positive, is used instead of the CPU quota
+	GOMAXPROCS int
+
+	// MemoryLimit, when positive, is the GOMEMLIMIT in bytes instead of
+	// MemoryLimitRatio of the cgroup limit
+	MemoryLimit int64
+
+	// MemoryLimitRatio is the share of the cgroup memory limit used as
+	// GOMEMLIMIT, leaving the rest for non-heap memory (default 0.9)
+	MemoryLimitRatio float64
+}
+
+// Result is what Apply chose. Source says where each value came from:
+// "env", "config", "cgroup" or "default".
+type Result struct {
+	GOMAXPROCS       int
+	GOMAXPROCSSource string
+
+	// MemoryLimit is math.MaxInt64 when there is no limit
+	MemoryLimit       int64
+	MemoryLimitSource string
+}
+
+// Apply sets GOMAXPROCS and GOMEMLIMIT from opts and limits. The GOMAXPROCS
+// and GOMEMLIMIT environment variables always win. Without an override the
+// runtime's own GOMAXPROCS is kept: since Go 1.25 it already follows the
+// cgroup CPU quota, and keeps following it as the quota changes.
+func Apply(limits Limits, opts Options) Result {
+	var r Result
+
+	switch {
+	case os.Getenv("GOMAXPROCS") != "":
+		r.GOMAXPROCSSource = "env"
+	case opts.GOMAXPROCS > 0:
+		runtime.GOMAXPROCS(opts.GOMAXPROCS)
+		r.GOMAXPROCSSource = "config"
+	case limits.CPU > 0:
+		r.GOMAXPROCSSource = "cgroup"
+	default:
+		r.GOMAXPROCSSource = "default"
+	}
+	r.GOMAXPROCS = runtime.GOMAXPROCS(0)
+
+	if opts.MemoryLimitRatio <= 0 || opts.MemoryLimitRatio > 1 {
+		opts.MemoryLimitRatio = 0.9
+	}
+	switch {
+	case os.Getenv("GOMEMLIMIT") != "":
+		r.MemoryLimitSource = "env"
+	case opts.MemoryLimit > 0:
+		debug.SetMemoryLimit(opts.MemoryLimit)
+		r.MemoryLimitSource = "config"
+	case limits.Memory > 0:
+		debug.SetMemoryLimit(int64(float64(limits.Memory) * opts.MemoryLimitRatio))
+		r.MemoryLimitSource = "cgroup"
+	default:
+		r.MemoryLimitSource = "default"
+	}
+	// A negative input reads the limit without changing it
+	r.MemoryLimit = debug.SetMemoryLimit(-1)
+
+	return r
+}
+
+// FormatBytes formats a memory limit for logs, "unlimited" for none
+func FormatBytes(n int64) string {
+	if n == math.MaxInt64 {
+		return "unlimited"
+	}
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(n)/float64(div), 'f', 1, 64) + string("KMGTP"[exp]) + "iB"
+}
@@ -0,0 +1,108 @@
+package autotune
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  Limits
+	}{
+		{
+			name:  "cgroup v2 limited",
+			files: map[string]string{"cpu.max": "150000 100000\n", "memory.max": "536870912\n"},
+			want:  Limits{CPU: 1.5, Memory: 512 << 20},
+		},
+		{
+			name:  "cgroup v2 unlimited",
+			files: map[string]string{"cpu.max": "max 100000\n", "memory.max": "max\n"},
+			want:  Limits{},
+		},
+		{
+			name: "cgroup v1 limited",
+			files: map[string]string{
+				"cpu/cpu.cfs_quota_us":         "200000\n",
+				"cpu/cpu.cfs_period_us":        "100000\n",
+				"memory/memory.limit_in_bytes": "1073741824\n",
+			},
+			want: Limits{CPU: 2, Memory: 1 << 30},
+		},
+		{
+			name: "cgroup v1 unlimited",
+			files: map[string]string{
+				"cpu/cpu.cfs_quota_us":         "-1\n",
+				"memory/memory.limit_in_bytes": "9223372036854771712\n",
+			},
+			want: Limits{},
+		},
+		{
+			name:  "no cgroup files",
+			files: map[string]string{},
+			want:  Limits{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for name, data := range tt.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(data)}
+			}
+			got, err := Detect(fsys)
+			if err != nil {
+				t.Fatalf("Detect() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Detect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Detect(fstest.MapFS{"cpu.max": {Data: []byte("lots 100000")}}); err == nil {
+		t.Errorf("Detect() with a malformed cpu.max expected error")
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Setenv("GOMAXPROCS", "")
+	t.Setenv("GOMEMLIMIT", "")
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(-1))
+
+	r := Apply(Limits{CPU: 2, Memory: 1 << 30}, Options{})
+	if r.MemoryLimit != 966367641 || r.MemoryLimitSource != "cgroup" || r.GOMAXPROCSSource != "cgroup" {
+		t.Errorf("Apply() from cgroup = %+v, want 90%% of 1GiB", r)
+	}
+
+	r = Apply(Limits{CPU: 2, Memory: 1 << 30}, Options{GOMAXPROCS: 3, MemoryLimit: 256 << 20})
+	if r.GOMAXPROCS != 3 || r.MemoryLimit != 256<<20 || r.GOMAXPROCSSource != "config" || r.MemoryLimitSource != "config" {
+		t.Errorf("Apply() with overrides = %+v, want the configured values", r)
+	}
+
+	t.Setenv("GOMEMLIMIT", "100MiB")
+	if r = Apply(Limits{Memory: 1 << 30}, Options{}); r.MemoryLimitSource != "env" {
+		t.Errorf("Apply() with GOMEMLIMIT set source = %s, want env", r.MemoryLimitSource)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{512, "512B"},
+		{966367641, "921.6MiB"},
+		{1 << 30, "1.0GiB"},
+		{math.MaxInt64, "unlimited"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Package cache stores byte values under string keys for a bounded time.
+// The memory backend caches in process memory, for a single replica; the
+// Redis backend shares entries between replicas, so an entry one replica
+// invalidates is gone for all of them.
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned by Get for a key without a live entry
+var ErrMiss = errors.New("cache: miss")
+
+// Cache stores values by key until their TTL expires
+type Cache interface {
+	// Get returns the value under key, or ErrMiss
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// GetMulti returns the values under keys in order, nil for misses
+	GetMulti(ctx context.Context, keys []string) ([][]byte, error)
+
+	// Set stores value under key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// SetMulti stores each value under its key for ttl
+	SetMulti(ctx context.Context, values map[string][]byte, ttl time.Duration) error
+
+	// Delete drops the entries under keys, missing ones included
+	Delete(ctx context.Context, keys ...string) error
+
+	// Ping reports whether the cache is reachable
+	Ping(ctx context.Context) error
+}
@@ -0,0 +1,83 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/cache"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCache(t *testing.T) {
+	backends := []struct {
+		name string
+		// open returns a cache and a func advancing its time
+		open func(t *testing.T) (cache.Cache, func(time.Duration))
+	}{
+		{
+			name: "memory",
+			open: func(t *testing.T) (cache.Cache, func(time.Duration)) {
+				c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+				return cache.NewMemoryCache(c), c.Advance
+			},
+		},
+		{
+			name: "redis",
+			open: func(t *testing.T) (cache.Cache, func(time.Duration)) {
+				mr := miniredis.RunT(t)
+				client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+				t.Cleanup(func() { client.Close() })
+				return cache.NewRedisCache(client), mr.FastForward
+			},
+		},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, advance := b.open(t)
+
+			if _, err := c.Get(ctx, "a"); !errors.Is(err, cache.ErrMiss) {
+				t.Errorf("Get() of a missing key error = %v, want %v", err, cache.ErrMiss)
+			}
+			if err := c.Set(ctx, "a", []byte("1"), time.Minute); err != nil {
+				t.Fatalf("Set() unexpected error: %v", err)
+			}
+			if err := c.SetMulti(ctx, map[string][]byte{"b": []byte("2"), "c": []byte("3")}, 2*time.Minute); err != nil {
+				t.Fatalf("SetMulti() unexpected error: %v", err)
+			}
+			if got, err := c.Get(ctx, "a"); err != nil || string(got) != "1" {
+				t.Errorf("Get(a) = %q, %v, want 1", got, err)
+			}
+
+			got, err := c.GetMulti(ctx, []string{"c", "x", "a"})
+			if err != nil || len(got) != 3 || string(got[0]) != "3" || got[1] != nil || string(got[2]) != "1" {
+				t.Errorf("GetMulti(c, x, a) = %q, %v, want 3, nil, 1", got, err)
+			}
+
+			if err := c.Delete(ctx, "b", "x"); err != nil {
+				t.Errorf("Delete() unexpected error: %v", err)
+			}
+			if _, err := c.Get(ctx, "b"); !errors.Is(err, cache.ErrMiss) {
+				t.Errorf("Get() of a deleted key error = %v, want %v", err, cache.ErrMiss)
+			}
+
+			// Entries expire after their own TTL
+			advance(90 * time.Second)
+			if _, err := c.Get(ctx, "a"); !errors.Is(err, cache.ErrMiss) {
+				t.Errorf("Get() of an expired key error = %v, want %v", err, cache.ErrMiss)
+			}
+			if got, err := c.Get(ctx, "c"); err != nil || string(got) != "3" {
+				t.Errorf("Get(c) before its TTL = %q, %v, want 3", got, err)
+			}
+
+			if err := c.Ping(ctx); err != nil {
+				t.Errorf("Ping() unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+)
+
+// sweepEvery is how many writes pass between sweeps of expired entries
+const sweepEvery = 1024
+
+// MemoryCache caches in process memory. Each replica has its own entries,
+// so a write on one replica leaves the others serving the old value until
+// it expires.
+type MemoryCache struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]entry
+	writes  int
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache creates a MemoryCache. A nil clock uses the real one.
+func NewMemoryCache(c clock.Clock) *MemoryCache {
+	if c == nil {
+		c = clock.Real()
+	}
+	return &MemoryCache{clock: c, entries: make(map[string]entry)}
+}
+
+// Get returns the value under key, or ErrMiss
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if value, ok := c.get(key); ok {
+		return value, nil
+	}
+	return nil, ErrMiss
+}
+
+// GetMulti returns the values under keys in order, nil for misses
+func (c *MemoryCache) GetMulti(ctx context.Context, keys []string) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i], _ = c.get(key)
+	}
+	return values, nil
+}
+
+// Set stores value under key for ttl
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.SetMulti(ctx, map[string][]byte{key: value}, ttl)
+}
+
+// SetMulti stores each value under its key for ttl
+func (c *MemoryCache) SetMulti(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, value := range values {
+		c.entries[key] = entry{value: append([]byte(nil), value...), expires: now.Add(ttl)}
+	}
+	c.writes++
+	if c.writes%sweepEvery == 0 {
+		for key, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete drops the entries under keys
+func (c *MemoryCache) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+	return nil
+}
+
+// Ping always succeeds
+func (c *MemoryCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+// get returns a copy of the live value under key. c.mu must be held.
+func (c *MemoryCache) get(key string) ([]byte, bool) {
+	e, ok := c.entries[key]
+	if !ok || !c.clock.Now().Before(e.expires) {
+		return nil, false
+	}
+	return append([]byte(nil), e.value...), true
+}
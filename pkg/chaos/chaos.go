@@ -0,0 +1,130 @@
+// Package chaos provides a fault injection interceptor for testing clients
+// against realistic failure modes. It is intended for dev and test only.
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxDropHold bounds how long a dropped response holds the call when the
+// client set no deadline
+const maxDropHold = 30 * time.Second
+
+// Injector applies chaos rules to gRPC calls
+type Injector struct {
+	rules   []rule
+	float64 func() float64
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+type rule struct {
+	config.ChaosRule
+	code codes.Code
+}
+
+// New creates an Injector from configuration. Rules are matched in order and
+// the first matching rule applies.
+func New(cfg config.ChaosConfig) (*Injector, error) {
+	inj := &Injector{
+		float64: rand.Float64,
+		sleep:   sleep,
+	}
+
+	for _, r := range cfg.Rules {
+		if r.Method == "" {
+			return nil, fmt.Errorf("chaos: rule method is required")
+		}
+		if r.ErrorRate < 0 || r.ErrorRate > 1 || r.DropRate < 0 || r.DropRate > 1 {
+			return nil, fmt.Errorf("chaos: rates for %s must be between 0 and 1", r.Method)
+		}
+
+		code := codes.Unavailable
+		if r.ErrorCode != "" {
+			if err := code.UnmarshalJSON([]byte(fmt.Sprintf("%q", strings.ToUpper(r.ErrorCode)))); err != nil {
+				return nil, fmt.Errorf("chaos: invalid error_code %q for %s", r.ErrorCode, r.Method)
+			}
+		}
+		inj.rules = append(inj.rules, rule{ChaosRule: r, code: code})
+	}
+
+	return inj, nil
+}
+
+// UnaryServerInterceptor returns an interceptor injecting faults per method
+func (i *Injector) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		r, ok := i.match(info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		if latency := i.latency(r); latency > 0 {
+			if err := i.sleep(ctx, latency); err != nil {
+				return nil, status.FromContextError(err).Err()
+			}
+		}
+
+		if r.ErrorRate > 0 && i.float64() < r.ErrorRate {
+			return nil, status.Errorf(r.code, "chaos: injected %s failure", r.code)
+		}
+
+		resp, err := handler(ctx, req)
+
+		if r.DropRate > 0 && i.float64() < r.DropRate {
+			hold := maxDropHold
+			if deadline, ok := ctx.Deadline(); ok {
+				hold = time.Until(deadline)
+			}
+			if err := i.sleep(ctx, hold); err != nil {
+				return nil, status.FromContextError(err).Err()
+			}
+			return nil, status.Error(codes.Unavailable, "chaos: response dropped")
+		}
+
+		return resp, err
+	}
+}
+
+// match returns the first rule applying to method
+func (i *Injector) match(method string) (rule, bool) {
+	for _, r := range i.rules {
+		switch {
+		case r.Method == "*", r.Method == method:
+			return r, true
+		case strings.HasSuffix(r.Method, "/") && strings.HasPrefix(method, r.Method):
+			return r, true
+		}
+	}
+	return rule{}, false
+}
+
+// latency returns the delay for a call, including random jitter
+func (i *Injector) latency(r rule) time.Duration {
+	d := r.Latency
+	if r.LatencyJitter > 0 {
+		d += time.Duration(i.float64() * float64(r.LatencyJitter))
+	}
+	return d
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
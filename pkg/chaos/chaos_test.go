@@ -0,0 +1,109 @@
+package chaos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInjector(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     config.ChaosRule
+		method   func(ctx context.Context, c apiv1.UserServiceClient) error
+		wantCode codes.Code
+		wantUser bool
+	}{
+		{
+			name: "injected error",
+			rule: config.ChaosRule{Method: "/api.v1.UserService/CreateUser", ErrorRate: 1, ErrorCode: "resource_exhausted"},
+			method: func(ctx context.Context, c apiv1.UserServiceClient) error {
+				_, err := c.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "a@example.com"}})
+				return err
+			},
+			wantCode: codes.ResourceExhausted,
+		},
+		{
+			name: "latency exceeds deadline",
+			rule: config.ChaosRule{Method: "*", Latency: time.Second},
+			method: func(ctx context.Context, c apiv1.UserServiceClient) error {
+				_, err := c.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "a@example.com"}})
+				return err
+			},
+			wantCode: codes.DeadlineExceeded,
+		},
+		{
+			name: "dropped response still runs handler",
+			rule: config.ChaosRule{Method: "/api.v1.UserService/", DropRate: 1},
+			method: func(ctx context.Context, c apiv1.UserServiceClient) error {
+				_, err := c.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "a@example.com"}})
+				return err
+			},
+			wantCode: codes.DeadlineExceeded,
+			wantUser: true,
+		},
+		{
+			name: "non-matching method passes through",
+			rule: config.ChaosRule{Method: "/api.v1.UserService/DeleteUser", ErrorRate: 1},
+			method: func(ctx context.Context, c apiv1.UserServiceClient) error {
+				_, err := c.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "a@example.com"}})
+				return err
+			},
+			wantCode: codes.OK,
+			wantUser: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inj, err := New(config.ChaosConfig{Enabled: true, Rules: []config.ChaosRule{tt.rule}})
+			if err != nil {
+				t.Fatalf("New() unexpected error: %v", err)
+			}
+			svc := service.NewUserService()
+			srv := testutil.NewServer(t,
+				testutil.WithUserService(svc),
+				testutil.WithServerOptions(grpc.ChainUnaryInterceptor(inj.UnaryServerInterceptor())),
+			)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err = tt.method(ctx, srv.Client)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("status code = %v, want %v (err: %v)", got, tt.wantCode, err)
+			}
+
+			resp, _ := svc.GetUser(context.Background(), &apiv1.GetUserRequest{Name: "users/1"})
+			if gotUser := resp.GetData() != nil; gotUser != tt.wantUser {
+				t.Errorf("user created = %v, want %v", gotUser, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		rule config.ChaosRule
+	}{
+		{name: "missing method", rule: config.ChaosRule{ErrorRate: 0.5}},
+		{name: "rate out of range", rule: config.ChaosRule{Method: "*", DropRate: 1.5}},
+		{name: "unknown code", rule: config.ChaosRule{Method: "*", ErrorCode: "teapot"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(config.ChaosConfig{Rules: []config.ChaosRule{tt.rule}}); err == nil {
+				t.Errorf("New() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+// Package client connects other services to the user service over gRPC.
+// New dials a target with TLS, retries, per-call timeouts and client-side
+// load balancing, and the Client's methods call api.v1.UserService,
+// returning the results of its CommonResponse as typed messages and its
+// errors as gRPC statuses.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/requestid"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Load balancing policies
+const (
+	// RoundRobin spreads calls over every address the target resolves to
+	RoundRobin = "round_robin"
+
+	// PickFirst sends every call to the first address that connects
+	PickFirst = "pick_first"
+)
+
+// Options configures a Client
+type Options struct {
+	// Target is the gRPC target of the server, e.g. "localhost:9090", or
+	// "dns:///users.internal:9090" to balance calls over every address
+	// the name resolves to
+	Target string
+
+	// TLS secures the connection. Nil connects in plaintext.
+	TLS *TLSOptions
+
+	// Token is sent with every call as a bearer token
+	Token string
+
+	// Timeout bounds each unary call, its retries included (default 10s).
+	// An earlier deadline of the call's context wins.
+	Timeout time.Duration
+
+	// Retry retries failed calls that are safe to repeat
+	Retry RetryOptions
+
+	// LoadBalancing is RoundRobin (default) or PickFirst
+	LoadBalancing string
+
+	// DialOptions are added after the client's own
+	DialOptions []grpc.DialOption
+}
+
+// TLSOptions configures the TLS of a connection
+type TLSOptions struct {
+	// CAFile is a PEM bundle of the CAs to trust instead of the system's
+	CAFile string
+
+	// CertFile and KeyFile are the client certificate presented for
+	// mutual TLS
+	CertFile string
+	KeyFile  string
+
+	// ServerName is the name the server's certificate must have, by
+	// default the host of Target
+	ServerName string
+}
+
+// RetryOptions configures the retries of calls. gRPC retries calls that
+// fail with one of Codes after an exponential backoff: a random delay up
+// to InitialBackoff, growing by BackoffMultiplier each attempt to at most
+// MaxBackoff. Reads are retried, and CreateUser, which the Client makes
+// idempotent with a request ID; other writes are not, since a failed
+// attempt may have been applied.
+type RetryOptions struct {
+	// MaxAttempts counts the first attempt (default 3, at most 5). 1
+	// disables retries.
+	MaxAttempts int
+
+	// InitialBackoff defaults to 100ms and MaxBackoff to 1s
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// BackoffMultiplier defaults to 2
+	BackoffMultiplier float64
+
+	// Codes default to UNAVAILABLE
+	Codes []codes.Code
+}
+
+// Client calls api.v1.UserService over a connection it owns
+type Client struct {
+	conn  *grpc.ClientConn
+	users apiv1.UserServiceClient
+}
+
+// New creates a Client for opts.Target. The connection is made by the
+// first call, and remade with backoff whenever it breaks.
+func New(opts Options) (*Client, error) {
+	if opts.Target == "" {
+		return nil, errors.New("client: a target is required")
+	}
+	serviceConfig, err := buildServiceConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := insecure.NewCredentials()
+	if opts.TLS != nil {
+		tlsConfig, err := tlsconfig.Client(opts.TLS.CAFile, opts.TLS.CertFile, opts.TLS.KeyFile, opts.TLS.ServerName)
+		if err != nil {
+			return nil, fmt.Errorf("client: %w", err)
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	unary := []grpc.UnaryClientInterceptor{requestid.UnaryClientInterceptor()}
+	stream := []grpc.StreamClientInterceptor{requestid.StreamClientInterceptor()}
+	if opts.Token != "" {
+		unary = append(unary, tokenUnaryInterceptor(opts.Token))
+		stream = append(stream, tokenStreamInterceptor(opts.Token))
+	}
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		// Calls made while handling a request carry its ID
+		grpc.WithChainUnaryInterceptor(unary...),
+		grpc.WithChainStreamInterceptor(stream...),
+	}, opts.DialOptions...)
+
+	conn, err := grpc.NewClient(opts.Target, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
+	}
+	return &Client{conn: conn, users: apiv1.NewUserServiceClient(conn)}, nil
+}
+
+// Conn returns the client's connection, e.g. for other services of the
+// same server
+func (c *Client) Conn() *grpc.ClientConn {
+	return c.conn
+}
+
+// Users returns the generated client the typed methods call, for the
+// streaming methods
+func (c *Client) Users() apiv1.UserServiceClient {
+	return c.users
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// The unary methods of api.v1.UserService, by whether retrying them is safe
+var (
+	retriedMethods = []string{"CreateUser", "GetUser", "GetUserByEmail", "ListUsers", "BatchGetUsers"}
+	otherMethods   = []string{"UpdateUser", "DeleteUser", "UndeleteUser"}
+)
+
+// serviceConfig is the JSON of a gRPC service config
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+	MethodConfig        []methodConfig        `json:"methodConfig"`
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	Timeout     string       `json:"timeout"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// buildServiceConfig returns the service config applying the load
+// balancing, timeout and retries of opts
+func buildServiceConfig(opts Options) (string, error) {
+	policy := opts.LoadBalancing
+	if policy == "" {
+		policy = RoundRobin
+	}
+	if balancer.Get(policy) == nil {
+		return "", fmt.Errorf("client: unknown load balancing policy %q", policy)
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	retried := methodConfig{Name: methodNames(retriedMethods), Timeout: duration(timeout)}
+	retry, err := buildRetryPolicy(opts.Retry)
+	if err != nil {
+		return "", err
+	}
+	retried.RetryPolicy = retry
+
+	config, err := json.Marshal(serviceConfig{
+		LoadBalancingConfig: []map[string]struct{}{{policy: {}}},
+		MethodConfig: []methodConfig{
+			retried,
+			{Name: methodNames(otherMethods), Timeout: duration(timeout)},
+		},
+	})
+	return string(config), err
+}
+
+// buildRetryPolicy returns the retry policy of opts, nil when retries are
+// disabled
+func buildRetryPolicy(opts RetryOptions) (*retryPolicy, error) {
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = 3
+	}
+	if opts.MaxAttempts == 1 {
+		return nil, nil
+	}
+	if opts.MaxAttempts < 0 || opts.MaxAttempts > 5 {
+		return nil, fmt.Errorf("client: retry max attempts %d, want 1 to 5", opts.MaxAttempts)
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Second
+	}
+	if opts.BackoffMultiplier <= 0 {
+		opts.BackoffMultiplier = 2
+	}
+	if len(opts.Codes) == 0 {
+		opts.Codes = []codes.Code{codes.Unavailable}
+	}
+
+	policy := &retryPolicy{
+		MaxAttempts:       opts.MaxAttempts,
+		InitialBackoff:    duration(opts.InitialBackoff),
+		MaxBackoff:        duration(opts.MaxBackoff),
+		BackoffMultiplier: opts.BackoffMultiplier,
+	}
+	for _, c := range opts.Codes {
+		if c == codes.OK {
+			return nil, errors.New("client: OK is not a retryable code")
+		}
+		policy.RetryableStatusCodes = append(policy.RetryableStatusCodes, codeName(c))
+	}
+	return policy, nil
+}
+
+// codeName returns the name of c in a service config, its name in upper
+// snake case, e.g. DEADLINE_EXCEEDED
+func codeName(c codes.Code) string {
+	if c == codes.Canceled {
+		return "CANCELLED"
+	}
+	var name []rune
+	for i, r := range c.String() {
+		if unicode.IsUpper(r) && i > 0 {
+			name = append(name, '_')
+		}
+		name = append(name, unicode.ToUpper(r))
+	}
+	return string(name)
+}
+
+func methodNames(methods []string) []methodName {
+	names := make([]methodName, len(methods))
+	for i, m := range methods {
+		names[i] = methodName{Service: apiv1.UserService_ServiceDesc.ServiceName, Method: m}
+	}
+	return names
+}
+
+// duration formats d as a protobuf JSON duration, e.g. "0.1s"
+func duration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// tokenUnaryInterceptor sends token as a bearer token with every call
+func tokenUnaryInterceptor(token string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withToken(ctx, token), method, req, reply, cc, opts...)
+	}
+}
+
+// tokenStreamInterceptor sends token as a bearer token with every stream
+func tokenStreamInterceptor(token string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withToken(ctx, token), desc, cc, method, opts...)
+	}
+}
+
+// withToken adds token to ctx's outgoing metadata unless the call carries
+// its own authorization
+func withToken(ctx context.Context, token string) context.Context {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
@@ -0,0 +1,272 @@
+package client_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/client"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// serve starts a gRPC server with srv as its user service, returning its
+// address
+func serve(t *testing.T, srv apiv1.UserServiceServer) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	apiv1.RegisterUserServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func newClient(t *testing.T, opts client.Options) *client.Client {
+	t.Helper()
+	c, err := client.New(opts)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, client.Options{Target: serve(t, service.NewUserService())})
+
+	created, err := c.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada@example.com", DisplayName: "Ada"}})
+	if err != nil || created.GetName() == "" || created.GetEmail() != "ada@example.com" {
+		t.Fatalf("CreateUser() = %v, %v, want the created user", created, err)
+	}
+	if got, err := c.GetUser(ctx, &apiv1.GetUserRequest{Name: created.GetName()}); err != nil || got.GetDisplayName() != "Ada" {
+		t.Errorf("GetUser() = %v, %v, want the created user", got, err)
+	}
+	if got, err := c.GetUserByEmail(ctx, &apiv1.GetUserByEmailRequest{Email: "ada@example.com"}); err != nil || got.GetName() != created.GetName() {
+		t.Errorf("GetUserByEmail() = %v, %v, want the created user", got, err)
+	}
+
+	updated, err := c.UpdateUser(ctx, &apiv1.UpdateUserRequest{
+		User:       &apiv1.User{Name: created.GetName(), DisplayName: "Ada Lovelace"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"display_name"}},
+	})
+	if err != nil || updated.GetDisplayName() != "Ada Lovelace" {
+		t.Errorf("UpdateUser() = %v, %v, want the updated user", updated, err)
+	}
+	if list, err := c.ListUsers(ctx, &apiv1.ListUsersRequest{}); err != nil || len(list.GetUsers()) != 1 || list.GetTotalSize() != 1 {
+		t.Errorf("ListUsers() = %v, %v, want the user", list, err)
+	}
+	if users, err := c.BatchGetUsers(ctx, &apiv1.BatchGetUsersRequest{Names: []string{created.GetName()}}); err != nil || len(users) != 1 {
+		t.Errorf("BatchGetUsers() = %v, %v, want the user", users, err)
+	}
+
+	if err := c.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: created.GetName()}); err != nil {
+		t.Errorf("DeleteUser() unexpected error: %v", err)
+	}
+	if got, err := c.UndeleteUser(ctx, &apiv1.UndeleteUserRequest{Name: created.GetName()}); err != nil || got.GetState() != apiv1.User_ACTIVE {
+		t.Errorf("UndeleteUser() = %v, %v, want the active user", got, err)
+	}
+
+	// Error codes of the responses come back as statuses
+	if _, err := c.GetUser(ctx, &apiv1.GetUserRequest{Name: "users/missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetUser() of a missing user error = %v, want NotFound", err)
+	}
+	if _, err := c.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada@example.com"}}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("CreateUser() with a taken email error = %v, want AlreadyExists", err)
+	}
+}
+
+// resultServer answers GetUser in data.result, like servers that send no
+// typed payloads
+type resultServer struct {
+	apiv1.UnimplementedUserServiceServer
+}
+
+func (resultServer) GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.CommonResponse, error) {
+	return response.Success(&apiv1.User{Name: req.GetName(), Email: "ada@example.com"})
+}
+
+func TestClientDecodesResult(t *testing.T) {
+	c := newClient(t, client.Options{Target: serve(t, resultServer{})})
+	got, err := c.GetUser(context.Background(), &apiv1.GetUserRequest{Name: "users/1"})
+	if err != nil || got.GetName() != "users/1" || got.GetEmail() != "ada@example.com" {
+		t.Errorf("GetUser() = %v, %v, want users/1", got, err)
+	}
+}
+
+// flakyServer fails the first calls of each method with UNAVAILABLE
+type flakyServer struct {
+	apiv1.UnimplementedUserServiceServer
+	failures int
+
+	mu         sync.Mutex
+	calls      map[string]int
+	requestIDs []string
+	tokens     []string
+}
+
+func (s *flakyServer) call(ctx context.Context, method string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.tokens = append(s.tokens, md.Get("authorization")...)
+	s.calls[method]++
+	if s.calls[method] <= s.failures {
+		return status.Error(codes.Unavailable, "try again")
+	}
+	return nil
+}
+
+func (s *flakyServer) CreateUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.CommonResponse, error) {
+	s.mu.Lock()
+	s.requestIDs = append(s.requestIDs, req.GetRequestId())
+	s.mu.Unlock()
+	if err := s.call(ctx, "CreateUser"); err != nil {
+		return nil, err
+	}
+	return response.Success(req.GetUser())
+}
+
+func (s *flakyServer) GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.CommonResponse, error) {
+	if err := s.call(ctx, "GetUser"); err != nil {
+		return nil, err
+	}
+	return response.Success(&apiv1.User{Name: req.GetName()})
+}
+
+func (s *flakyServer) UpdateUser(ctx context.Context, req *apiv1.UpdateUserRequest) (*apiv1.CommonResponse, error) {
+	if err := s.call(ctx, "UpdateUser"); err != nil {
+		return nil, err
+	}
+	return response.Success(req.GetUser())
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	srv := &flakyServer{failures: 2, calls: make(map[string]int)}
+	c := newClient(t, client.Options{
+		Target: serve(t, srv),
+		Token:  "secret",
+		Retry:  client.RetryOptions{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+	})
+
+	if _, err := c.GetUser(ctx, &apiv1.GetUserRequest{Name: "users/1"}); err != nil || srv.calls["GetUser"] != 3 {
+		t.Errorf("GetUser() error = %v after %d calls, want success after 3", err, srv.calls["GetUser"])
+	}
+
+	// The attempts of a create share the request ID the client chose
+	if _, err := c.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada@example.com"}}); err != nil {
+		t.Errorf("CreateUser() unexpected error: %v", err)
+	}
+	if len(srv.requestIDs) != 3 || srv.requestIDs[0] == "" || srv.requestIDs[0] != srv.requestIDs[2] {
+		t.Errorf("CreateUser() sent request IDs %q, want one ID 3 times", srv.requestIDs)
+	}
+
+	if _, err := c.UpdateUser(ctx, &apiv1.UpdateUserRequest{User: &apiv1.User{Name: "users/1"}}); status.Code(err) != codes.Unavailable || srv.calls["UpdateUser"] != 1 {
+		t.Errorf("UpdateUser() error = %v after %d calls, want Unavailable after 1", err, srv.calls["UpdateUser"])
+	}
+
+	for _, token := range srv.tokens {
+		if token != "Bearer secret" {
+			t.Errorf("call sent authorization %q, want Bearer secret", token)
+		}
+	}
+	if len(srv.tokens) != 7 {
+		t.Errorf("calls sent %d tokens, want 7", len(srv.tokens))
+	}
+
+	// Without retries the first failure is returned
+	srv = &flakyServer{failures: 1, calls: make(map[string]int)}
+	c = newClient(t, client.Options{Target: serve(t, srv), Retry: client.RetryOptions{MaxAttempts: 1}})
+	if _, err := c.GetUser(ctx, &apiv1.GetUserRequest{Name: "users/1"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("GetUser() without retries error = %v, want Unavailable", err)
+	}
+}
+
+// slowServer answers GetUser after delay
+type slowServer struct {
+	apiv1.UnimplementedUserServiceServer
+	delay time.Duration
+}
+
+func (s slowServer) GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.CommonResponse, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+	}
+	return response.Success(&apiv1.User{Name: req.GetName()})
+}
+
+func TestTimeout(t *testing.T) {
+	c := newClient(t, client.Options{Target: serve(t, slowServer{delay: time.Second}), Timeout: 50 * time.Millisecond})
+	start := time.Now()
+	if _, err := c.GetUser(context.Background(), &apiv1.GetUserRequest{Name: "users/1"}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("GetUser() error = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("GetUser() returned after %v, want about 50ms", elapsed)
+	}
+}
+
+// countingServer counts its GetUser calls
+type countingServer struct {
+	apiv1.UnimplementedUserServiceServer
+	calls atomic.Int32
+}
+
+func (s *countingServer) GetUser(ctx context.Context, req *apiv1.GetUserRequest) (*apiv1.CommonResponse, error) {
+	s.calls.Add(1)
+	return response.Success(&apiv1.User{Name: req.GetName()})
+}
+
+func TestLoadBalancing(t *testing.T) {
+	servers := []*countingServer{{}, {}}
+	r := manual.NewBuilderWithScheme("test")
+	r.InitialState(resolver.State{Addresses: []resolver.Address{
+		{Addr: serve(t, servers[0])},
+		{Addr: serve(t, servers[1])},
+	}})
+
+	c := newClient(t, client.Options{Target: "test:///users", DialOptions: []grpc.DialOption{grpc.WithResolvers(r)}})
+	for range 10 {
+		if _, err := c.GetUser(context.Background(), &apiv1.GetUserRequest{Name: "users/1"}); err != nil {
+			t.Fatalf("GetUser() unexpected error: %v", err)
+		}
+	}
+	for i, s := range servers {
+		if got := s.calls.Load(); got == 0 {
+			t.Errorf("server %d got no calls, want some of 10", i)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for name, opts := range map[string]client.Options{
+		"no target":              {},
+		"unknown policy":         {Target: "localhost:9090", LoadBalancing: "random"},
+		"too many attempts":      {Target: "localhost:9090", Retry: client.RetryOptions{MaxAttempts: 6}},
+		"OK retried":             {Target: "localhost:9090", Retry: client.RetryOptions{Codes: []codes.Code{codes.OK}}},
+		"missing client key":     {Target: "localhost:9090", TLS: &client.TLSOptions{CertFile: "client.crt"}},
+		"missing CA bundle file": {Target: "localhost:9090", TLS: &client.TLSOptions{CAFile: "missing.crt"}},
+	} {
+		if c, err := client.New(opts); err == nil {
+			c.Close()
+			t.Errorf("New() with %s expected error", name)
+		}
+	}
+}
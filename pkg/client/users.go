@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// CreateUser creates req's user. A request without a request_id gets a
+// new one, so the retries of the call create the user once.
+func (c *Client) CreateUser(ctx context.Context, req *apiv1.CreateUserRequest, opts ...grpc.CallOption) (*apiv1.User, error) {
+	if req.GetRequestId() == "" {
+		req = proto.Clone(req).(*apiv1.CreateUserRequest)
+		req.RequestId = idgen.NewUUID().NewID()
+	}
+	resp, err := c.users.CreateUser(typed(ctx), req, opts...)
+	return unwrap(resp, err, &apiv1.User{})
+}
+
+// GetUser retrieves a user by resource name
+func (c *Client) GetUser(ctx context.Context, req *apiv1.GetUserRequest, opts ...grpc.CallOption) (*apiv1.User, error) {
+	resp, err := c.users.GetUser(typed(ctx), req, opts...)
+	return unwrap(resp, err, &apiv1.User{})
+}
+
+// GetUserByEmail retrieves a user by email address
+func (c *Client) GetUserByEmail(ctx context.Context, req *apiv1.GetUserByEmailRequest, opts ...grpc.CallOption) (*apiv1.User, error) {
+	resp, err := c.users.GetUserByEmail(typed(ctx), req, opts...)
+	return unwrap(resp, err, &apiv1.User{})
+}
+
+// ListUsers lists a page of users
+func (c *Client) ListUsers(ctx context.Context, req *apiv1.ListUsersRequest, opts ...grpc.CallOption) (*apiv1.ListUsersResponse, error) {
+	resp, err := c.users.ListUsers(typed(ctx), req, opts...)
+	return unwrap(resp, err, &apiv1.ListUsersResponse{})
+}
+
+// UpdateUser updates a user
+func (c *Client) UpdateUser(ctx context.Context, req *apiv1.UpdateUserRequest, opts ...grpc.CallOption) (*apiv1.User, error) {
+	resp, err := c.users.UpdateUser(typed(ctx), req, opts...)
+	return unwrap(resp, err, &apiv1.User{})
+}
+
+// DeleteUser soft deletes a user, or deletes it for good with force
+func (c *Client) DeleteUser(ctx context.Context, req *apiv1.DeleteUserRequest, opts ...grpc.CallOption) error {
+	resp, err := c.users.DeleteUser(ctx, req, opts...)
+	if err != nil {
+		return err
+	}
+	return response.ToStatus(resp).Err()
+}
+
+// UndeleteUser restores a soft deleted user
+func (c *Client) UndeleteUser(ctx context.Context, req *apiv1.UndeleteUserRequest, opts ...grpc.CallOption) (*apiv1.User, error) {
+	resp, err := c.users.UndeleteUser(typed(ctx), req, opts...)
+	return unwrap(resp, err, &apiv1.User{})
+}
+
+// BatchGetUsers retrieves the users of req in its order
+func (c *Client) BatchGetUsers(ctx context.Context, req *apiv1.BatchGetUsersRequest, opts ...grpc.CallOption) ([]*apiv1.User, error) {
+	resp, err := c.users.BatchGetUsers(typed(ctx), req, opts...)
+	batch, err := unwrap(resp, err, &apiv1.BatchGetUsersResponse{})
+	return batch.GetUsers(), err
+}
+
+// typed asks the server for results as typed payloads
+func typed(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, response.PayloadHeader, response.PayloadAny)
+}
+
+// unwrap returns the result of a call returning resp and err in dst
+func unwrap[M proto.Message](resp *apiv1.CommonResponse, err error, dst M) (M, error) {
+	if err != nil {
+		var zero M
+		return zero, err
+	}
+	return Decode(resp, dst)
+}
+
+// Decode returns the result of resp in dst: its typed payload, or
+// data.result from servers that do not send one, e.g. responses of the
+// HTTP gateway. An error code in resp is returned as its gRPC status.
+func Decode[M proto.Message](resp *apiv1.CommonResponse, dst M) (M, error) {
+	var zero M
+	if err := response.ToStatus(resp).Err(); err != nil {
+		return zero, err
+	}
+
+	if payload := resp.GetPayload(); payload != nil {
+		if err := payload.UnmarshalTo(dst); err != nil {
+			return zero, fmt.Errorf("client: decode payload: %w", err)
+		}
+		return dst, nil
+	}
+	result := resp.GetData().GetFields()["result"]
+	if result == nil {
+		return zero, fmt.Errorf("client: response without a %s", dst.ProtoReflect().Descriptor().FullName())
+	}
+	data, err := protojson.Marshal(result)
+	if err != nil {
+		return zero, fmt.Errorf("client: decode result: %w", err)
+	}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, dst); err != nil {
+		return zero, fmt.Errorf("client: decode result: %w", err)
+	}
+	return dst, nil
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// setting is a configuration field that environment variables and flags
+// can set. Settings are named by their YAML path, e.g. server.grpc_port,
+// which is the -server.grpc_port flag and the SERVER_GRPC_PORT variable
+// unless an env tag lists other variables, e.g. `env:"SERVER_HTTP_PORT,PORT"`.
+type setting struct {
+	path  string
+	env   []string
+	index []int
+	typ   reflect.Type
+}
+
+// settings lists the fields of Config that can be set from a string:
+// strings, numbers, booleans, durations and lists of strings. Maps and
+// lists of objects can only be set in the file.
+var settings = sync.OnceValue(func() []setting {
+	return collect(reflect.TypeOf(Config{}), "", nil)
+})
+
+func collect(t reflect.Type, prefix string, index []int) []setting {
+	var out []setting
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		path := prefix + name
+		idx := append(append([]int(nil), index...), i)
+
+		if f.Type.Kind() == reflect.Struct {
+			out = append(out, collect(f.Type, path+".", idx)...)
+			continue
+		}
+		if !settable(f.Type) {
+			continue
+		}
+		env := []string{strings.ToUpper(strings.ReplaceAll(path, ".", "_"))}
+		if tag := f.Tag.Get("env"); tag != "" {
+			env = strings.Split(tag, ",")
+		}
+		out = append(out, setting{path: path, env: env, index: idx, typ: f.Type})
+	}
+	return out
+}
+
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// set parses s into the setting's field of cfg. Lists are comma-separated.
+func (s setting) set(cfg *Config, value string) error {
+	v := reflect.ValueOf(cfg).Elem().FieldByIndex(s.index)
+	switch {
+	case s.typ == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case s.typ.Kind() == reflect.String:
+		v.SetString(value)
+	case s.typ.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.CanInt():
+		n, err := strconv.ParseInt(value, 10, s.typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.CanUint():
+		n, err := strconv.ParseUint(value, 10, s.typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case v.CanFloat():
+		f, err := strconv.ParseFloat(value, s.typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case s.typ.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items).Convert(s.typ))
+	}
+	return nil
+}
+
+// LoadWithOverrides loads the configuration of a command line, args being
+// the arguments after the program name: flags, then optionally the config
+// file. It returns the configuration and the file's path, empty without
+// one.
+//
+// Each layer overrides the previous one: Default, the file, environment
+// variables read with lookupEnv and flags. Empty variables are ignored.
+// So that containers need no config file baked into the image, any
+// setting can be given as a variable or flag named after its YAML path,
+// e.g. SERVER_GRPC_PORT=9091 or -server.grpc_port=9091.
+//
+// Unknown flags, -h and values that fail to parse are errors; for -h the
+// error is flag.ErrHelp, once the usage is printed to stderr.
+func LoadWithOverrides(args []string, lookupEnv func(string) (string, bool)) (*Config, string, error) {
+	type override struct {
+		s     setting
+		value string
+	}
+	var flagged []override
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: server [flags] [config.yaml]\n\nSettings, also read from the environment variables named:\n")
+		fs.PrintDefaults()
+	}
+	for _, s := range settings() {
+		usage := fmt.Sprintf("set %s ($%s)", s.path, strings.Join(s.env, ", $"))
+		apply := func(value string) error {
+			// Check the value now, so the error names the flag
+			if err := s.set(Default(), value); err != nil {
+				return err
+			}
+			flagged = append(flagged, override{s, value})
+			return nil
+		}
+		if s.typ.Kind() == reflect.Bool {
+			fs.BoolFunc(s.path, usage, apply)
+		} else {
+			fs.Func(s.path, usage, apply)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() > 1 {
+		return nil, "", fmt.Errorf("unexpected arguments after the config file: %q", fs.Args()[1:])
+	}
+
+	cfg := Default()
+	path := fs.Arg(0)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read config file: %w", err)
+		}
+		if cfg, err = parse(data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, s := range settings() {
+		for _, name := range s.env {
+			value, ok := lookupEnv(name)
+			if !ok || value == "" {
+				continue
+			}
+			if err := s.set(cfg, value); err != nil {
+				return nil, "", fmt.Errorf("invalid $%s: %w", name, err)
+			}
+			break
+		}
+	}
+	for _, o := range flagged {
+		o.s.set(cfg, o.value)
+	}
+	return cfg, path, nil
+}
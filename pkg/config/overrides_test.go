@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestLoadWithOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, `
+server:
+  grpc_port: 7000
+  http_port: 7001
+  host: "file"
+shed:
+  priorities:
+    "/api.v1.UserService/ListUsers": low
+`)
+
+	cfg, gotPath, err := LoadWithOverrides(
+		[]string{"-server.host=flag", "-reload.enabled", "-tenancy.sources", "a, b,", path},
+		env(map[string]string{
+			"SERVER_GRPC_PORT":      "7100",
+			"SERVER_HOST":           "env",
+			"PORT":                  "7101",
+			"LOG_LEVEL":             "",
+			"STORAGE_DSN":           "",
+			"DATABASE_URL":          "postgres://db/users",
+			"WATCHDOG_INTERVAL":     "1m",
+			"SHED_MAX_MEMORY_RATIO": "0.5",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("LoadWithOverrides() unexpected error: %v", err)
+	}
+	if gotPath != path {
+		t.Errorf("path = %q, want %q", gotPath, path)
+	}
+	for name, got := range map[string]struct{ got, want any }{
+		"env over file":        {cfg.Server.GRPCPort, 7100},
+		"alternate env":        {cfg.Server.HTTPPort, 7101},
+		"flag over env":        {cfg.Server.Host, "flag"},
+		"empty env ignored":    {cfg.Log.Level, "info"},
+		"second env name":      {cfg.Storage.DSN, "postgres://db/users"},
+		"duration":             {cfg.Watchdog.Interval, time.Minute},
+		"float":                {cfg.Shed.MaxMemoryRatio, 0.5},
+		"bool flag":            {cfg.Reload.Enabled, true},
+		"list":                 {cfg.Tenancy.Sources, []string{"a", "b"}},
+		"default":              {cfg.Queue.Workers, 2},
+		"map entry from file":  {cfg.Shed.Priorities["/api.v1.UserService/ListUsers"], "low"},
+		"map entry by default": {cfg.Shed.Priorities["/api.v1.AdminService/"], "critical"},
+	} {
+		if !reflect.DeepEqual(got.got, got.want) {
+			t.Errorf("%s = %v, want %v", name, got.got, got.want)
+		}
+	}
+
+	cfg, gotPath, err = LoadWithOverrides(nil, env(nil))
+	if err != nil || gotPath != "" || !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("LoadWithOverrides() without a file = %q, %v, want the defaults", gotPath, err)
+	}
+}
+
+func TestLoadWithOverridesInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "log: [")
+
+	for name, tt := range map[string]struct {
+		args []string
+		env  map[string]string
+	}{
+		"unknown flag":   {args: []string{"-server.port=1"}},
+		"bad flag value": {args: []string{"-server.grpc_port=x"}},
+		"bad env value":  {env: map[string]string{"WATCHDOG_INTERVAL": "10"}},
+		"two files":      {args: []string{"a.yaml", "b.yaml"}},
+		"missing file":   {args: []string{filepath.Join(t.TempDir(), "missing.yaml")}},
+		"invalid file":   {args: []string{path}},
+	} {
+		if _, _, err := LoadWithOverrides(tt.args, env(tt.env)); err == nil {
+			t.Errorf("LoadWithOverrides() with %s expected error", name)
+		}
+	}
+}
+
+func TestLoadWithOverridesHelp(t *testing.T) {
+	if _, _, err := LoadWithOverrides([]string{"-h"}, env(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("LoadWithOverrides(-h) error = %v, want flag.ErrHelp", err)
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchOptions configures a Watcher
+type WatchOptions struct {
+	// Load builds the configuration once the file changes, e.g. to apply
+	// overrides on top of it. By default the file is parsed as Load does.
+	Load func() (*Config, error)
+
+	// Validate rejects a reloaded configuration before subscribers see it,
+	// for checks this package cannot make, such as parsing the log level
+	Validate func(*Config) error
+
+	// Debounce is how long the file must be left alone before it is read,
+	// so the several writes of one save reload once (default 100ms)
+	Debounce time.Duration
+}
+
+// Watcher reloads a configuration file when it changes and hands each
+// valid version to its subscribers. A file that fails to parse or validate
+// is logged and ignored: the last good configuration stays in effect.
+//
+// The directory is watched rather than the file, as editors and Kubernetes
+// ConfigMap volumes replace the file instead of writing to it.
+type Watcher struct {
+	path string
+	log  logger.Logger
+	opts WatchOptions
+	fs   *fsnotify.Watcher
+	done chan struct{}
+
+	mu      sync.Mutex
+	current *Config
+	subs    []func(*Config)
+
+	// sum is the hash of the contents last read, so events that leave the
+	// file as it was, such as writes to other files, do not reload it
+	sum [sha256.Size]byte
+}
+
+// Watch starts watching the file at path, which current was loaded from
+func Watch(path string, current *Config, log logger.Logger, opts WatchOptions) (*Watcher, error) {
+	if opts.Debounce <= 0 {
+		opts.Debounce = 100 * time.Millisecond
+	}
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch config file: %w", err)
+	}
+	if err := fs.Add(filepath.Dir(path)); err != nil {
+		fs.Close()
+		return nil, fmt.Errorf("failed to watch config file: %w", err)
+	}
+	w := &Watcher{path: path, log: log, opts: opts, fs: fs, done: make(chan struct{}), current: current}
+	if data, err := os.ReadFile(path); err == nil {
+		w.sum = sha256.Sum256(data)
+	}
+	go w.run()
+	return w, nil
+}
+
+// Subscribe calls fn with each configuration reloaded from now on. fn
+// applies what it can change at runtime and ignores the rest.
+func (w *Watcher) Subscribe(fn func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subs = append(w.subs, fn)
+}
+
+// Current returns the configuration in effect
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Close stops watching. Subscribers are not called after it returns.
+func (w *Watcher) Close() error {
+	err := w.fs.Close()
+	<-w.done
+	return err
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	var settle <-chan time.Time
+	for {
+		select {
+		case _, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			settle = time.After(w.opts.Debounce)
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			w.log.Warn("Config file watcher error: %v", err)
+		case <-settle:
+			settle = nil
+			w.reload()
+		}
+	}
+}
+
+// reload reads the file and, if it changed and is valid, passes it on
+func (w *Watcher) reload() {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		w.log.Warn("Failed to read changed config file, keeping the current configuration: %v", err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	if sum == w.sum {
+		return
+	}
+	w.sum = sum
+
+	var cfg *Config
+	if w.opts.Load != nil {
+		cfg, err = w.opts.Load()
+	} else {
+		cfg, err = parse(data)
+	}
+	if err == nil && w.opts.Validate != nil {
+		err = w.opts.Validate(cfg)
+	}
+	if err != nil {
+		w.log.Error("Ignoring changed config file %s, keeping the current configuration: %v", w.path, err)
+		return
+	}
+
+	w.mu.Lock()
+	w.current = cfg
+	subs := slices.Clone(w.subs)
+	w.mu.Unlock()
+	for _, fn := range subs {
+		fn(cfg)
+	}
+	w.log.Info("Reloaded config file %s (fingerprint %s)", w.path, cfg.Fingerprint())
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "log:\n  level: info\n")
+	current, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := Watch(path, current, logger.Nop(), WatchOptions{
+		Validate: func(c *Config) error {
+			if c.Log.Level == "loud" {
+				return errors.New("unknown log level")
+			}
+			return nil
+		},
+		Debounce: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Watch() unexpected error: %v", err)
+	}
+	defer w.Close()
+	reloaded := make(chan *Config, 10)
+	w.Subscribe(func(c *Config) { reloaded <- c })
+
+	next := func() *Config {
+		t.Helper()
+		select {
+		case c := <-reloaded:
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatal("config was not reloaded")
+			return nil
+		}
+	}
+
+	writeFile(t, path, "log:\n  level: debug\n")
+	if c := next(); c.Log.Level != "debug" || w.Current() != c {
+		t.Errorf("reloaded log level = %q, want debug", c.Log.Level)
+	}
+
+	// Invalid files are ignored, and the next valid one applies
+	writeFile(t, path, "log: [")
+	writeFile(t, filepath.Join(filepath.Dir(path), "other.yaml"), "log:\n  level: warn\n")
+	time.Sleep(50 * time.Millisecond)
+	writeFile(t, path, "log:\n  level: loud\n")
+	time.Sleep(50 * time.Millisecond)
+	if w.Current().Log.Level != "debug" {
+		t.Errorf("current log level = %q after invalid files, want debug", w.Current().Log.Level)
+	}
+
+	// Editors and ConfigMaps replace the file
+	tmp := path + ".tmp"
+	writeFile(t, tmp, "log:\n  level: error\n")
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if c := next(); c.Log.Level != "error" {
+		t.Errorf("reloaded log level = %q, want error", c.Log.Level)
+	}
+	if len(reloaded) > 0 {
+		t.Errorf("subscriber called with %v, want one call per valid change", (<-reloaded).Log)
+	}
+}
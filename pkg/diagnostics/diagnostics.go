@@ -0,0 +1,66 @@
+// Package diagnostics writes a snapshot of a running process, its goroutine
+// stacks, configuration, component statistics and in-flight requests, for
+// debugging a hung instance without attaching a debugger.
+package diagnostics
+
+import (
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"time"
+)
+
+// Section is one titled part of a dump
+type Section struct {
+	Name  string
+	Write func(w io.Writer) error
+}
+
+// Dump writes a header stamped with now followed by every section. A
+// failing section is noted and the dump continues, so one broken store
+// does not hide the rest.
+func Dump(w io.Writer, now time.Time, sections ...Section) error {
+	if _, err := fmt.Fprintf(w, "=== diagnostic dump at %s ===\n", now.UTC().Format(time.RFC3339Nano)); err != nil {
+		return err
+	}
+	for _, s := range sections {
+		if _, err := fmt.Fprintf(w, "\n--- %s ---\n", s.Name); err != nil {
+			return err
+		}
+		if err := s.Write(w); err != nil {
+			if _, err := fmt.Fprintf(w, "error: %v\n", err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Text is a section with a fixed value, such as the config fingerprint
+func Text(name, value string) Section {
+	return Section{Name: name, Write: func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, value)
+		return err
+	}}
+}
+
+// Value is a section printing what get returns, typically a Stats snapshot.
+// A returned error is reported as the section's error.
+func Value(name string, get func() (any, error)) Section {
+	return Section{Name: name, Write: func(w io.Writer) error {
+		v, err := get()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%+v\n", v)
+		return err
+	}}
+}
+
+// Goroutines is a section with every goroutine's stack, in the format of
+// an unrecovered panic
+func Goroutines() Section {
+	return Section{Name: "goroutines", Write: func(w io.Writer) error {
+		return pprof.Lookup("goroutine").WriteTo(w, 2)
+	}}
+}
@@ -0,0 +1,80 @@
+package diagnostics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"google.golang.org/grpc"
+)
+
+func TestDump(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	err := Dump(&buf, now,
+		Text("config fingerprint", "abc123"),
+		Value("users", func() (any, error) { return 3, nil }),
+		Value("jobs", func() (any, error) { return nil, errors.New("connection refused") }),
+		Goroutines(),
+	)
+	if err != nil {
+		t.Fatalf("Dump() unexpected error: %v", err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"=== diagnostic dump at 2025-01-01T12:00:00Z ===",
+		"--- config fingerprint ---\nabc123\n",
+		"--- users ---\n3\n",
+		"--- jobs ---\nerror: connection refused\n",
+		"--- goroutines ---\ngoroutine ",
+		"TestDump",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Dump() output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	tracker := NewTracker(fake)
+	intercept := tracker.UnaryServerInterceptor()
+
+	_, err := intercept(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/api.v1.UserService/ListUsers"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			fake.Advance(1500 * time.Millisecond)
+			_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/api.v1.UserService/GetUser"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					fake.Advance(time.Second)
+
+					var buf bytes.Buffer
+					if err := tracker.Section().Write(&buf); err != nil {
+						return nil, err
+					}
+					want := "2 in flight\n" +
+						"/api.v1.UserService/ListUsers from unknown, running 2.5s\n" +
+						"/api.v1.UserService/GetUser from unknown, running 1s\n"
+					if buf.String() != want {
+						t.Errorf("Section() = %q, want %q", buf.String(), want)
+					}
+					return nil, nil
+				})
+			return nil, err
+		})
+	if err != nil {
+		t.Fatalf("interceptor unexpected error: %v", err)
+	}
+
+	if got := tracker.InFlight(); len(got) != 0 {
+		t.Errorf("InFlight() after the calls = %v, want none", got)
+	}
+	if err := tracker.Section().Write(io.Discard); err != nil {
+		t.Errorf("Section() unexpected error: %v", err)
+	}
+}
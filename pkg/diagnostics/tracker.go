@@ -0,0 +1,101 @@
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// Request is an RPC in progress
+type Request struct {
+	Method  string
+	Peer    string
+	Started time.Time
+}
+
+// Tracker records the RPCs in progress
+type Tracker struct {
+	clock clock.Clock
+
+	mu       sync.Mutex
+	next     uint64
+	requests map[uint64]Request
+}
+
+// NewTracker creates a Tracker. A nil clock uses the real one.
+func NewTracker(c clock.Clock) *Tracker {
+	if c == nil {
+		c = clock.Real()
+	}
+	return &Tracker{clock: c, requests: make(map[uint64]Request)}
+}
+
+// InFlight returns the RPCs in progress, oldest first
+func (t *Tracker) InFlight() []Request {
+	t.mu.Lock()
+	requests := make([]Request, 0, len(t.requests))
+	for _, r := range t.requests {
+		requests = append(requests, r)
+	}
+	t.mu.Unlock()
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Started.Before(requests[j].Started) })
+	return requests
+}
+
+// Section lists the RPCs in progress and how long each has been running
+func (t *Tracker) Section() Section {
+	return Section{Name: "in-flight requests", Write: func(w io.Writer) error {
+		requests := t.InFlight()
+		if _, err := fmt.Fprintf(w, "%d in flight\n", len(requests)); err != nil {
+			return err
+		}
+		now := t.clock.Now()
+		for _, r := range requests {
+			if _, err := fmt.Fprintf(w, "%s from %s, running %v\n", r.Method, r.Peer, now.Sub(r.Started).Round(time.Millisecond)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+}
+
+// UnaryServerInterceptor tracks unary RPCs
+func (t *Tracker) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		defer t.track(ctx, info.FullMethod)()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor tracks streaming RPCs
+func (t *Tracker) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		defer t.track(ss.Context(), info.FullMethod)()
+		return handler(srv, ss)
+	}
+}
+
+// track records an RPC and returns the func that forgets it
+func (t *Tracker) track(ctx context.Context, method string) func() {
+	r := Request{Method: method, Peer: "unknown", Started: t.clock.Now()}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.Peer = p.Addr.String()
+	}
+	t.mu.Lock()
+	id := t.next
+	t.next++
+	t.requests[id] = r
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		delete(t.requests, id)
+		t.mu.Unlock()
+	}
+}
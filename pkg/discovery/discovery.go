@@ -0,0 +1,102 @@
+// Package discovery registers running replicas in a shared store, so each
+// can see the others and what they run. Replicas renew their registration
+// periodically; one that stops renewing drops out after the TTL.
+package discovery
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+)
+
+// Member is a registered replica
+type Member struct {
+	// ID is unique per running process
+	ID       string `json:"id"`
+	Hostname string `json:"hostname"`
+	Zone     string `json:"zone,omitempty"`
+	Version  string `json:"version"`
+
+	// ConfigFingerprint identifies the effective configuration and
+	// Fingerprint the configuration and binary version together
+	ConfigFingerprint string `json:"config_fingerprint"`
+	Fingerprint       string `json:"fingerprint"`
+
+	// LastSeen is when the member last registered
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Registry stores the members
+type Registry interface {
+	// Register adds or renews m, setting its LastSeen
+	Register(ctx context.Context, m Member) error
+
+	// Deregister removes the member with id
+	Deregister(ctx context.Context, id string) error
+
+	// Members returns the members seen within the TTL, sorted by ID
+	Members(ctx context.Context) ([]Member, error)
+}
+
+// MemoryRegistry keeps members in process memory. It only sees replicas in
+// the same process, so use it for single-replica deployments and tests.
+type MemoryRegistry struct {
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu      sync.Mutex
+	members map[string]Member
+}
+
+// NewMemoryRegistry creates a MemoryRegistry expiring members after ttl
+// (default 45s). A nil clock uses the real one.
+func NewMemoryRegistry(ttl time.Duration, c clock.Clock) *MemoryRegistry {
+	if ttl <= 0 {
+		ttl = 45 * time.Second
+	}
+	if c == nil {
+		c = clock.Real()
+	}
+	return &MemoryRegistry{ttl: ttl, clock: c, members: make(map[string]Member)}
+}
+
+// Register adds or renews m
+func (r *MemoryRegistry) Register(ctx context.Context, m Member) error {
+	m.LastSeen = r.clock.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.members[m.ID] = m
+	return nil
+}
+
+// Deregister removes the member with id
+func (r *MemoryRegistry) Deregister(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.members, id)
+	return nil
+}
+
+// Members returns the live members, dropping expired ones
+func (r *MemoryRegistry) Members(ctx context.Context) ([]Member, error) {
+	cutoff := r.clock.Now().Add(-r.ttl)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	members := make([]Member, 0, len(r.members))
+	for id, m := range r.members {
+		if m.LastSeen.Before(cutoff) {
+			delete(r.members, id)
+			continue
+		}
+		members = append(members, m)
+	}
+	sortMembers(members)
+	return members, nil
+}
+
+func sortMembers(members []Member) {
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+}
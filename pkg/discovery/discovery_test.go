@@ -0,0 +1,143 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// warnings records warning logs
+type warnings struct {
+	logger.Logger
+
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (w *warnings) Warn(msg string, args ...interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.msgs = append(w.msgs, fmt.Sprintf(msg, args...))
+}
+
+func (w *warnings) take() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	msgs := w.msgs
+	w.msgs = nil
+	return msgs
+}
+
+func TestRegistries(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, newRegistry := range map[string]func(*clock.Fake) Registry{
+		"memory": func(fake *clock.Fake) Registry {
+			return NewMemoryRegistry(time.Minute, fake)
+		},
+		"redis": func(fake *clock.Fake) Registry {
+			client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+			t.Cleanup(func() { client.Close() })
+			return NewRedisRegistry(client, RedisOptions{TTL: time.Minute, Clock: fake})
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fake := clock.NewFake(start)
+			r := newRegistry(fake)
+			ctx := context.Background()
+
+			for _, id := range []string{"b", "a"} {
+				if err := r.Register(ctx, Member{ID: id, Fingerprint: "f1"}); err != nil {
+					t.Fatalf("Register(%s) unexpected error: %v", id, err)
+				}
+			}
+			fake.Advance(40 * time.Second)
+			if err := r.Register(ctx, Member{ID: "a", Fingerprint: "f2"}); err != nil {
+				t.Fatalf("Register(a) unexpected error: %v", err)
+			}
+			members, err := r.Members(ctx)
+			if err != nil {
+				t.Fatalf("Members() unexpected error: %v", err)
+			}
+			if len(members) != 2 || members[0].ID != "a" || members[0].Fingerprint != "f2" || !members[0].LastSeen.Equal(fake.Now()) {
+				t.Errorf("Members() = %+v, want a renewed with f2, then b", members)
+			}
+
+			// b was last seen 60s ago, past the TTL
+			fake.Advance(30 * time.Second)
+			members, _ = r.Members(ctx)
+			if len(members) != 1 || members[0].ID != "a" {
+				t.Errorf("Members() after b expired = %+v, want only a", members)
+			}
+
+			if err := r.Deregister(ctx, "a"); err != nil {
+				t.Fatalf("Deregister() unexpected error: %v", err)
+			}
+			if members, _ := r.Members(ctx); len(members) != 0 {
+				t.Errorf("Members() after Deregister = %+v, want none", members)
+			}
+		})
+	}
+}
+
+func TestMonitorDrift(t *testing.T) {
+	registry := NewMemoryRegistry(time.Minute, nil)
+	log := &warnings{Logger: logger.Nop()}
+	self := Member{ID: "a", Fingerprint: "f1", Version: "v1", ConfigFingerprint: "c1"}
+	m := NewMonitor(log, registry, self, Options{})
+	ctx := context.Background()
+
+	registry.Register(ctx, Member{ID: "b", Fingerprint: "f1"})
+	m.check(ctx)
+	if stats := m.Stats(); stats.Members != 2 || len(stats.Drifted) != 0 {
+		t.Errorf("Stats() with matching replicas = %+v, want 2 members without drift", stats)
+	}
+	if msgs := log.take(); len(msgs) != 0 {
+		t.Errorf("warnings with matching replicas = %q, want none", msgs)
+	}
+
+	// c was rolled out with a new config
+	registry.Register(ctx, Member{ID: "c", Hostname: "host-c", Fingerprint: "f2", Version: "v1", ConfigFingerprint: "c2"})
+	m.check(ctx)
+	if stats := m.Stats(); !reflect.DeepEqual(stats.Drifted, []string{"c"}) {
+		t.Errorf("Stats().Drifted = %q, want [c]", stats.Drifted)
+	}
+	msgs := log.take()
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "host-c") || !strings.Contains(msgs[0], "config c2") {
+		t.Errorf("warnings = %q, want one naming c's host and config", msgs)
+	}
+
+	// The drift is reported once, not on every check
+	m.check(ctx)
+	if msgs := log.take(); len(msgs) != 0 {
+		t.Errorf("warnings on the next check = %q, want none", msgs)
+	}
+}
+
+func TestMonitorStartStop(t *testing.T) {
+	registry := NewMemoryRegistry(time.Minute, nil)
+	m := NewMonitor(logger.Nop(), registry, Member{ID: "a"}, Options{Interval: time.Hour})
+	m.Start(context.Background())
+
+	deadline := time.Now().Add(time.Second)
+	for m.Stats().Members == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Monitor did not register on Start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() unexpected error: %v", err)
+	}
+	if members, _ := registry.Members(context.Background()); len(members) != 0 {
+		t.Errorf("Members() after Stop = %+v, want deregistered", members)
+	}
+}
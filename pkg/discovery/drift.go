@@ -0,0 +1,144 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Options configures a Monitor
+type Options struct {
+	// Interval is how often the registration is renewed and the members
+	// compared (default 15s). It should be well under the registry's TTL.
+	Interval time.Duration
+}
+
+// Stats is a snapshot of the fleet as last seen
+type Stats struct {
+	Members int
+
+	// Drifted lists the IDs of members whose fingerprint differs from
+	// this replica's
+	Drifted []string
+
+	LastCheck time.Time
+	Errors    uint64
+}
+
+// Monitor keeps this replica registered and warns when other members run
+// a different fingerprint, as when a configuration or version rollout has
+// only reached part of the fleet
+type Monitor struct {
+	log      logger.Logger
+	registry Registry
+	self     Member
+	opts     Options
+
+	mu      sync.Mutex
+	stats   Stats
+	drifted map[string]bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMonitor creates a Monitor registering self in registry
+func NewMonitor(log logger.Logger, registry Registry, self Member, opts Options) *Monitor {
+	if opts.Interval <= 0 {
+		opts.Interval = 15 * time.Second
+	}
+	return &Monitor{log: log, registry: registry, self: self, opts: opts, drifted: make(map[string]bool)}
+}
+
+// Start registers and checks now, then every Interval until Stop is called
+// or ctx is done
+func (m *Monitor) Start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.opts.Interval)
+		defer ticker.Stop()
+		for {
+			m.check(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the checks and deregisters, so the rest of the fleet stops
+// comparing against this replica at once rather than after the TTL
+func (m *Monitor) Stop(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return m.registry.Deregister(ctx, m.self.ID)
+}
+
+// Stats returns a snapshot of the fleet
+func (m *Monitor) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stats
+	s.Drifted = append([]string(nil), s.Drifted...)
+	return s
+}
+
+// check renews the registration and compares fingerprints. Each member is
+// reported when it starts to differ and when it matches again, not on
+// every check.
+func (m *Monitor) check(ctx context.Context) {
+	err := m.registry.Register(ctx, m.self)
+	var members []Member
+	if err == nil {
+		members, err = m.registry.Members(ctx)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			m.log.Warn("Discovery: %v", err)
+			m.mu.Lock()
+			m.stats.Errors++
+			m.mu.Unlock()
+		}
+		return
+	}
+
+	drifted := make(map[string]bool)
+	var ids []string
+	for _, member := range members {
+		if member.ID == m.self.ID || member.Fingerprint == m.self.Fingerprint {
+			continue
+		}
+		drifted[member.ID] = true
+		ids = append(ids, member.ID)
+		if !m.drifted[member.ID] {
+			m.log.Warn("Discovery: replica %s on %s runs fingerprint %s (version %s, config %s), this replica %s (version %s, config %s)",
+				member.ID, member.Hostname, member.Fingerprint, member.Version, member.ConfigFingerprint,
+				m.self.Fingerprint, m.self.Version, m.self.ConfigFingerprint)
+		}
+	}
+	for id := range m.drifted {
+		if !drifted[id] {
+			m.log.Info("Discovery: replica %s matches again or has left", id)
+		}
+	}
+	m.drifted = drifted
+
+	m.mu.Lock()
+	m.stats.Members = len(members)
+	m.stats.Drifted = ids
+	m.stats.LastCheck = time.Now()
+	m.mu.Unlock()
+}
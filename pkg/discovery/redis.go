@@ -0,0 +1,86 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisOptions configures a RedisRegistry
+type RedisOptions struct {
+	// Key is the hash members are stored in (default "discovery:members")
+	Key string
+
+	// TTL is how long a member stays without renewing (default 45s)
+	TTL time.Duration
+
+	// Clock stamps registrations (default the real clock)
+	Clock clock.Clock
+}
+
+// RedisRegistry stores members as JSON in a Redis hash shared by the
+// fleet. Hash fields cannot expire on their own, so expired members are
+// removed by whoever lists them; a member renewing at that moment is back
+// on its next renewal.
+type RedisRegistry struct {
+	client redis.UniversalClient
+	opts   RedisOptions
+}
+
+// NewRedisRegistry creates a RedisRegistry
+func NewRedisRegistry(client redis.UniversalClient, opts RedisOptions) *RedisRegistry {
+	if opts.Key == "" {
+		opts.Key = "discovery:members"
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 45 * time.Second
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.Real()
+	}
+	return &RedisRegistry{client: client, opts: opts}
+}
+
+// Register adds or renews m
+func (r *RedisRegistry) Register(ctx context.Context, m Member) error {
+	m.LastSeen = r.opts.Clock.Now()
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, r.opts.Key, m.ID, data).Err()
+}
+
+// Deregister removes the member with id
+func (r *RedisRegistry) Deregister(ctx context.Context, id string) error {
+	return r.client.HDel(ctx, r.opts.Key, id).Err()
+}
+
+// Members returns the live members, removing expired and unreadable ones
+func (r *RedisRegistry) Members(ctx context.Context) ([]Member, error) {
+	all, err := r.client.HGetAll(ctx, r.opts.Key).Result()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := r.opts.Clock.Now().Add(-r.opts.TTL)
+	members := make([]Member, 0, len(all))
+	var expired []string
+	for id, data := range all {
+		var m Member
+		if err := json.Unmarshal([]byte(data), &m); err != nil || m.LastSeen.Before(cutoff) {
+			expired = append(expired, id)
+			continue
+		}
+		members = append(members, m)
+	}
+	if len(expired) > 0 {
+		if err := r.client.HDel(ctx, r.opts.Key, expired...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	sortMembers(members)
+	return members, nil
+}
@@ -0,0 +1,248 @@
+// Package events is an in-process publish/subscribe bus. Publishing never
+// blocks: each subscriber has its own buffer and a policy for when it falls
+// behind.
+package events
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// ErrClosed is returned when subscribing to a closed bus
+var ErrClosed = errors.New("events: bus closed")
+
+// Policy decides what happens to an event when a subscriber's buffer is full
+type Policy int
+
+const (
+	// DropNewest discards the event for that subscriber
+	DropNewest Policy = iota
+
+	// DropOldest discards the oldest buffered event to make room
+	DropOldest
+
+	// Disconnect closes the subscription, for subscribers that must see
+	// every event and resync when they cannot
+	Disconnect
+)
+
+// Options configures a subscription
+type Options struct {
+	// Buffer is the number of events held for the subscriber (default 64)
+	Buffer int
+
+	// Policy applies when the buffer is full (default DropNewest)
+	Policy Policy
+}
+
+// Stats describes a subscriber
+type Stats struct {
+	Name     string
+	Buffered int
+	Dropped  uint64
+}
+
+// Bus delivers events of type T to its subscribers
+type Bus[T any] struct {
+	log logger.Logger
+
+	mu     sync.RWMutex
+	subs   map[*Subscription[T]]struct{}
+	closed bool
+
+	// handlers tracks SubscribeFunc goroutines so Close can wait for them
+	handlers sync.WaitGroup
+}
+
+// NewBus creates a Bus
+func NewBus[T any](log logger.Logger) *Bus[T] {
+	return &Bus[T]{log: log, subs: make(map[*Subscription[T]]struct{})}
+}
+
+// Subscription receives events on C until it is closed, either by the
+// subscriber or, under the Disconnect policy, by the bus
+type Subscription[T any] struct {
+	// C delivers events. It is closed when the subscription ends.
+	C <-chan T
+
+	bus     *Bus[T]
+	name    string
+	policy  Policy
+	dropped atomic.Uint64
+
+	// mu serializes sends with close so a send never hits a closed channel
+	mu     sync.Mutex
+	ch     chan T
+	closed bool
+}
+
+// Subscribe registers a subscriber. The caller must drain C and Close the
+// subscription when done.
+func (b *Bus[T]) Subscribe(name string, opts Options) (*Subscription[T], error) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	ch := make(chan T, opts.Buffer)
+	s := &Subscription[T]{C: ch, bus: b, name: name, policy: opts.Policy, ch: ch}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	b.subs[s] = struct{}{}
+	return s, nil
+}
+
+// SubscribeFunc calls fn for each event on its own goroutine. fn runs until
+// the subscription or the bus is closed, after draining buffered events.
+func (b *Bus[T]) SubscribeFunc(name string, opts Options, fn func(T)) (*Subscription[T], error) {
+	s, err := b.Subscribe(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	b.handlers.Add(1)
+	go func() {
+		defer b.handlers.Done()
+		for ev := range s.C {
+			b.handle(name, fn, ev)
+		}
+	}()
+	return s, nil
+}
+
+func (b *Bus[T]) handle(name string, fn func(T), ev T) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.log.Error("Event subscriber %s panicked: %v", name, r)
+		}
+	}()
+	fn(ev)
+}
+
+// Publish delivers ev to every subscriber without blocking
+func (b *Bus[T]) Publish(ev T) {
+	var disconnected []*Subscription[T]
+	b.mu.RLock()
+	for s := range b.subs {
+		if !s.send(ev) {
+			disconnected = append(disconnected, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	if len(disconnected) > 0 {
+		b.mu.Lock()
+		for _, s := range disconnected {
+			delete(b.subs, s)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Stats returns per-subscriber stats sorted by name
+func (b *Bus[T]) Stats() []Stats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := make([]Stats, 0, len(b.subs))
+	for s := range b.subs {
+		stats = append(stats, Stats{Name: s.name, Buffered: len(s.ch), Dropped: s.Dropped()})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Close ends every subscription and waits for SubscribeFunc handlers to
+// drain their buffers. If ctx expires first Close returns ctx.Err().
+func (b *Bus[T]) Close(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	for s := range b.subs {
+		s.close()
+		delete(b.subs, s)
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped returns the number of events the subscriber missed
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes. Buffered events can still be read from C.
+func (s *Subscription[T]) Close() {
+	s.bus.mu.Lock()
+	delete(s.bus.subs, s)
+	s.bus.mu.Unlock()
+	s.close()
+}
+
+func (s *Subscription[T]) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// send delivers ev according to the subscriber's policy. It reports false
+// once the subscription is closed.
+func (s *Subscription[T]) send(ev T) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+
+	select {
+	case s.ch <- ev:
+		return true
+	default:
+	}
+
+	// Warn on the first drop only, a slow subscriber drops in bursts
+	first := s.dropped.Add(1) == 1
+	switch s.policy {
+	case DropOldest:
+		if first {
+			s.bus.log.Warn("Event subscriber %s is full, dropping its oldest events", s.name)
+		}
+		select {
+		case <-s.ch:
+		default:
+		}
+		select {
+		case s.ch <- ev:
+		default:
+		}
+	case Disconnect:
+		s.bus.log.Warn("Event subscriber %s fell behind and was disconnected", s.name)
+		s.closed = true
+		close(s.ch)
+		return false
+	default:
+		if first {
+			s.bus.log.Warn("Event subscriber %s is full, dropping events", s.name)
+		}
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// drain reads the events buffered in s without blocking
+func drain(s *Subscription[int]) []int {
+	var got []int
+	for {
+		select {
+		case ev, ok := <-s.C:
+			if !ok {
+				return got
+			}
+			got = append(got, ev)
+		default:
+			return got
+		}
+	}
+}
+
+func TestBusFanOut(t *testing.T) {
+	bus := NewBus[int](logger.Nop())
+	a, _ := bus.Subscribe("a", Options{})
+	b, _ := bus.Subscribe("b", Options{})
+
+	bus.Publish(1)
+	bus.Publish(2)
+
+	for _, s := range []*Subscription[int]{a, b} {
+		if got := drain(s); !reflect.DeepEqual(got, []int{1, 2}) {
+			t.Errorf("subscriber %s got %v, want [1 2]", s.name, got)
+		}
+	}
+
+	a.Close()
+	bus.Publish(3)
+	if _, ok := <-a.C; ok {
+		t.Error("closed subscription still receives events")
+	}
+	if got := drain(b); !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("subscriber b got %v, want [3]", got)
+	}
+}
+
+func TestBusSlowSubscriberPolicies(t *testing.T) {
+	tests := []struct {
+		policy      Policy
+		want        []int
+		wantDropped uint64
+		wantStats   int
+	}{
+		{DropNewest, []int{1, 2}, 2, 1},
+		{DropOldest, []int{3, 4}, 2, 1},
+		{Disconnect, []int{1, 2}, 1, 0},
+	}
+	for _, tt := range tests {
+		bus := NewBus[int](logger.Nop())
+		s, _ := bus.Subscribe("slow", Options{Buffer: 2, Policy: tt.policy})
+		for i := 1; i <= 4; i++ {
+			bus.Publish(i)
+		}
+		if got := drain(s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("policy %d: got %v, want %v", tt.policy, got, tt.want)
+		}
+		if s.Dropped() != tt.wantDropped {
+			t.Errorf("policy %d: Dropped() = %d, want %d", tt.policy, s.Dropped(), tt.wantDropped)
+		}
+		if got := len(bus.Stats()); got != tt.wantStats {
+			t.Errorf("policy %d: %d subscribers left, want %d", tt.policy, got, tt.wantStats)
+		}
+	}
+}
+
+func TestBusSubscribeFunc(t *testing.T) {
+	bus := NewBus[int](logger.Nop())
+
+	var mu sync.Mutex
+	var got []int
+	bus.SubscribeFunc("handler", Options{}, func(ev int) {
+		if ev == 2 {
+			panic("bad event")
+		}
+		mu.Lock()
+		got = append(got, ev)
+		mu.Unlock()
+	})
+	for i := 1; i <= 3; i++ {
+		bus.Publish(i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := bus.Close(ctx); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("handler got %v, want [1 3] after draining past the panic", got)
+	}
+
+	if _, err := bus.Subscribe("late", Options{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Subscribe() after Close() error = %v, want %v", err, ErrClosed)
+	}
+	bus.Publish(4)
+}
+
+func TestBusCloseDeadline(t *testing.T) {
+	bus := NewBus[int](logger.Nop())
+	release := make(chan struct{})
+	defer close(release)
+	bus.SubscribeFunc("stuck", Options{}, func(int) { <-release })
+	bus.Publish(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bus.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestBusConcurrentPublishAndClose(t *testing.T) {
+	bus := NewBus[int](logger.Nop())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		s, _ := bus.Subscribe("sub", Options{Buffer: 1, Policy: Policy(i % 3)})
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				bus.Publish(j)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range s.C {
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond)
+	bus.Close(context.Background())
+	wg.Wait()
+}
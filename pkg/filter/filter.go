@@ -0,0 +1,410 @@
+// Package filter parses the filter expressions and order_by lists of list
+// RPCs, in the style of AIP-160 and AIP-132, e.g.
+// `is_active = true AND email : "example.com"` and
+// `display_name, create_time desc`. Both are checked against a Schema of
+// the fields a resource lets clients name. A parsed Expr is evaluated on
+// protobuf messages with Match, or rendered as a SQL condition with SQL,
+// so each storage applies the same filter.
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the type of a field, which decides the literals and operators
+// it takes
+type Kind int
+
+// Field kinds
+const (
+	// String fields take quoted or bare strings and =, != and :, which is
+	// a case-insensitive substring match
+	String Kind = iota + 1
+
+	// Bool fields take true or false and = and !=
+	Bool
+
+	// Int fields take integers and every operator but :
+	Int
+
+	// Timestamp fields take RFC 3339 times, e.g. 2025-01-01T00:00:00Z, and
+	// every operator but :
+	Timestamp
+)
+
+func (k Kind) String() string {
+	switch k {
+	case String:
+		return "string"
+	case Bool:
+		return "bool"
+	case Int:
+		return "int"
+	case Timestamp:
+		return "timestamp"
+	default:
+		return "unknown"
+	}
+}
+
+// allows reports whether op applies to fields of kind k
+func (k Kind) allows(op Op) bool {
+	switch k {
+	case String:
+		return op == Equal || op == NotEqual || op == Has
+	case Bool:
+		return op == Equal || op == NotEqual
+	default:
+		return op != Has
+	}
+}
+
+// parse converts a literal to the Go type of k: string, bool, int64 or
+// time.Time
+func (k Kind) parse(lit string) (any, error) {
+	switch k {
+	case String:
+		return lit, nil
+	case Bool:
+		switch lit {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, errors.New("want true or false")
+	case Int:
+		return strconv.ParseInt(lit, 10, 64)
+	case Timestamp:
+		return time.Parse(time.RFC3339Nano, lit)
+	default:
+		return nil, errors.New("unknown kind")
+	}
+}
+
+// Schema maps the fields filters and orderings may name, by their proto
+// names, to their kinds
+type Schema map[string]Kind
+
+// names returns the fields of s, sorted
+func (s Schema) names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Op is a comparison operator
+type Op string
+
+// Comparison operators
+const (
+	Equal        Op = "="
+	NotEqual     Op = "!="
+	Less         Op = "<"
+	LessEqual    Op = "<="
+	Greater      Op = ">"
+	GreaterEqual Op = ">="
+	Has          Op = ":"
+)
+
+// ops lists the operators longest first, the order they are lexed in
+var ops = []Op{NotEqual, LessEqual, GreaterEqual, Equal, Less, Greater, Has}
+
+// Expr is a parsed filter: an *And, *Or, *Not or *Compare. A nil Expr is
+// the empty filter, which matches everything.
+type Expr interface {
+	expr()
+}
+
+// And matches what all of its expressions match
+type And struct {
+	Exprs []Expr
+}
+
+// Or matches what any of its expressions matches
+type Or struct {
+	Exprs []Expr
+}
+
+// Not matches what its expression does not
+type Not struct {
+	Expr Expr
+}
+
+// Compare compares a field with a literal. Value has the Go type of the
+// field's kind: string, bool, int64 or time.Time.
+type Compare struct {
+	Field string
+	Op    Op
+	Value any
+}
+
+func (*And) expr()     {}
+func (*Or) expr()      {}
+func (*Not) expr()     {}
+func (*Compare) expr() {}
+
+// Error is a syntax or schema error in a filter or ordering. Pos is the
+// byte offset it was found at.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// maxDepth bounds the nesting of parentheses and NOT, so a hostile filter
+// cannot exhaust the stack
+const maxDepth = 32
+
+// Parse parses filter, naming only the fields of schema. Terms are
+// comparisons such as `email : "example.com"`, combined with AND, OR and
+// NOT and grouped with parentheses; terms side by side are ANDed. AND
+// binds tighter than OR. An empty filter returns a nil Expr.
+func Parse(filter string, schema Schema) (Expr, error) {
+	p := &parser{src: filter, schema: schema}
+	p.skipSpace()
+	if p.eof() {
+		return nil, nil
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return e, nil
+}
+
+// parser is a recursive descent parser over a filter string
+type parser struct {
+	src    string
+	pos    int
+	schema Schema
+	depth  int
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	e, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	exprs := []Expr{e}
+	for p.keyword("OR") {
+		e, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return &Or{Exprs: exprs}, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	e, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	exprs := []Expr{e}
+	for {
+		p.skipSpace()
+		if p.eof() || p.src[p.pos] == ')' || p.atKeyword("OR") {
+			break
+		}
+		p.keyword("AND")
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return &And{Exprs: exprs}, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	p.skipSpace()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	if p.keyword("NOT") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: e}, nil
+	}
+	if !p.eof() && p.src[p.pos] == '(' {
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.eof() || p.src[p.pos] != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return e, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (*Compare, error) {
+	start := p.pos
+	field := p.identifier()
+	if field == "" {
+		return nil, p.errorf("expected a field")
+	}
+	kind, ok := p.schema[field]
+	if !ok {
+		return nil, &Error{Pos: start, Msg: fmt.Sprintf("unknown field %q, expected one of %v", field, p.schema.names())}
+	}
+
+	p.skipSpace()
+	opPos := p.pos
+	var op Op
+	for _, o := range ops {
+		if strings.HasPrefix(p.src[p.pos:], string(o)) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return nil, p.errorf("expected a comparison after %s", field)
+	}
+	if !kind.allows(op) {
+		return nil, &Error{Pos: opPos, Msg: fmt.Sprintf("operator %s does not apply to %s field %s", op, kind, field)}
+	}
+	p.pos += len(op)
+
+	p.skipSpace()
+	valuePos := p.pos
+	lit, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	value, err := kind.parse(lit)
+	if err != nil {
+		return nil, &Error{Pos: valuePos, Msg: fmt.Sprintf("invalid %s %q for %s", kind, lit, field)}
+	}
+	return &Compare{Field: field, Op: op, Value: value}, nil
+}
+
+// identifier consumes a field name
+func (p *parser) identifier() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.src[p.pos]
+		if c != '_' && c != '.' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// literal consumes a value: a string in double or single quotes, with
+// backslash escapes, or a bare word running to white space or a
+// parenthesis, so times such as 2025-01-01T00:00:00Z need no quotes
+func (p *parser) literal() (string, error) {
+	if p.eof() {
+		return "", p.errorf("expected a value")
+	}
+	if q := p.src[p.pos]; q == '"' || q == '\'' {
+		start := p.pos
+		var b strings.Builder
+		for p.pos++; !p.eof(); p.pos++ {
+			c := p.src[p.pos]
+			switch {
+			case c == q:
+				p.pos++
+				return b.String(), nil
+			case c == '\\' && p.pos+1 < len(p.src):
+				p.pos++
+				b.WriteByte(p.src[p.pos])
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", &Error{Pos: start, Msg: "unterminated string"}
+	}
+	start := p.pos
+	for !p.eof() && !isSpace(p.src[p.pos]) && p.src[p.pos] != '(' && p.src[p.pos] != ')' {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a value")
+	}
+	return p.src[start:p.pos], nil
+}
+
+// keyword consumes the keyword kw if it comes next
+func (p *parser) keyword(kw string) bool {
+	if !p.atKeyword(kw) {
+		return false
+	}
+	p.skipSpace()
+	p.pos += len(kw)
+	return true
+}
+
+// atKeyword reports whether the keyword kw, which is case sensitive, comes
+// next as a word of its own
+func (p *parser) atKeyword(kw string) bool {
+	p.skipSpace()
+	rest := p.src[p.pos:]
+	if !strings.HasPrefix(rest, kw) {
+		return false
+	}
+	return len(rest) == len(kw) || isSpace(rest[len(kw)]) || rest[len(kw)] == '('
+}
+
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > maxDepth {
+		return p.errorf("filter nested deeper than %d", maxDepth)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && isSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &Error{Pos: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,145 @@
+package filter
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var schema = Schema{
+	"name":        String,
+	"email":       String,
+	"is_active":   Bool,
+	"create_time": Timestamp,
+}
+
+// sqlite renders conditions with ? placeholders on columns named as the
+// fields
+var sqlite = SQLDialect{
+	Placeholder: func(int) string { return "?" },
+	Column:      func(field string) string { return field },
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		filter   string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{"", "1 = 1", nil},
+		{"is_active = true", "is_active = ?", []any{true}},
+		{`email : "Example.com"`, "lower(email) LIKE ? ESCAPE '!'", []any{"%example.com%"}},
+		{`email:100%_off`, "lower(email) LIKE ? ESCAPE '!'", []any{"%100!%!_off%"}},
+		{`is_active = true AND email != 'a\'b'`, "(is_active = ? AND email <> ?)", []any{true, "a'b"}},
+		{"is_active = true email = a", "(is_active = ? AND email = ?)", []any{true, "a"}},
+		{"email = a OR email = b AND is_active = false", "(email = ? OR (email = ? AND is_active = ?))", []any{"a", "b", false}},
+		{"NOT (email = a OR email = b)", "NOT ((email = ? OR email = ?))", []any{"a", "b"}},
+		{"create_time >= 2025-01-01T00:00:00Z", "create_time >= ?", []any{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			e, err := Parse(tt.filter, schema)
+			if err != nil {
+				t.Fatalf("Parse() unexpected error: %v", err)
+			}
+			sql, args := SQL(e, sqlite, nil)
+			if sql != tt.wantSQL || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("SQL() = %q, %v, want %q, %v", sql, args, tt.wantSQL, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		filter  string
+		wantPos int
+		wantMsg string
+	}{
+		{"emial = a", 0, "unknown field"},
+		{"is_active : true", 10, "does not apply"},
+		{"is_active = yes", 12, "invalid bool"},
+		{"create_time > yesterday", 14, "invalid timestamp"},
+		{"email", 5, "expected a comparison"},
+		{"email =", 7, "expected a value"},
+		{`email = "open`, 8, "unterminated string"},
+		{"(email = a", 10, "missing )"},
+		{"email = a)", 9, "unexpected"},
+		{"email = a AND", 13, "expected a field"},
+		{strings.Repeat("(", 100), 32, "nested deeper"},
+		{strings.Repeat("NOT ", 100), 128, "nested deeper"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			_, err := Parse(tt.filter, schema)
+			var ferr *Error
+			if !errors.As(err, &ferr) || ferr.Pos != tt.wantPos || !strings.Contains(ferr.Msg, tt.wantMsg) {
+				t.Errorf("Parse() error = %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	user := &apiv1.User{
+		Name:       "users/1",
+		Email:      "Ada@Example.com",
+		IsActive:   true,
+		CreateTime: timestamppb.New(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	tests := map[string]bool{
+		"":                                    true,
+		"is_active = true":                    true,
+		"is_active != true":                   false,
+		`email : "example.COM"`:               true,
+		"email : gmail":                       false,
+		"email = Ada@Example.com":             true,
+		"email = ada@example.com":             false,
+		"NOT email : gmail":                   true,
+		"email : gmail OR is_active = true":   true,
+		"email : ada is_active = false":       false,
+		"create_time < 2025-01-01T00:00:01Z":  true,
+		"create_time > 2025-01-01T00:00:00Z":  false,
+		"create_time >= 2025-01-01T00:00:00Z": true,
+	}
+	for filter, want := range tests {
+		e, err := Parse(filter, schema)
+		if err != nil {
+			t.Fatalf("Parse(%q) unexpected error: %v", filter, err)
+		}
+		if got := Match(e, user); got != want {
+			t.Errorf("Match(%q) = %v, want %v", filter, got, want)
+		}
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	got, err := ParseOrder(" email desc,create_time ,  name ASC", schema)
+	want := []Order{{Field: "email", Desc: true}, {Field: "create_time"}, {Field: "name"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseOrder() = %v, %v, want %v", got, err, want)
+	}
+	if got, err := ParseOrder("  ", schema); err != nil || got != nil {
+		t.Errorf("ParseOrder(empty) = %v, %v, want none", got, err)
+	}
+
+	for orderBy, wantPos := range map[string]int{
+		"phone":             0,
+		"email, emial":      7,
+		"email up":          0,
+		"email desc, email": 12,
+		"email,,name":       6,
+		"email desc nulls":  0,
+	} {
+		_, err := ParseOrder(orderBy, schema)
+		var ferr *Error
+		if !errors.As(err, &ferr) || ferr.Pos != wantPos {
+			t.Errorf("ParseOrder(%q) error = %v, want one at position %d", orderBy, err, wantPos)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package filter
+
+import (
+	"cmp"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Match reports whether msg satisfies e, reading fields by their proto
+// names. A nil Expr matches every message.
+func Match(e Expr, msg proto.Message) bool {
+	switch e := e.(type) {
+	case nil:
+		return true
+	case *And:
+		for _, x := range e.Exprs {
+			if !Match(x, msg) {
+				return false
+			}
+		}
+		return true
+	case *Or:
+		for _, x := range e.Exprs {
+			if Match(x, msg) {
+				return true
+			}
+		}
+		return false
+	case *Not:
+		return !Match(e.Expr, msg)
+	case *Compare:
+		v := Value(msg, e.Field)
+		if e.Op == Has {
+			s, _ := v.(string)
+			sub, _ := e.Value.(string)
+			return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+		}
+		c := CompareValues(v, e.Value)
+		switch e.Op {
+		case Equal:
+			return c == 0
+		case NotEqual:
+			return c != 0
+		case Less:
+			return c < 0
+		case LessEqual:
+			return c <= 0
+		case Greater:
+			return c > 0
+		case GreaterEqual:
+			return c >= 0
+		}
+	}
+	return false
+}
+
+// Value returns the field of msg with the proto name field as the Go type
+// of its kind: string, bool, int64 or time.Time for a Timestamp, which is
+// the Unix epoch when unset. It returns nil for other fields.
+func Value(msg proto.Message, field string) any {
+	m := msg.ProtoReflect()
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(field))
+	if fd == nil || fd.IsList() || fd.IsMap() {
+		return nil
+	}
+	v := m.Get(fd)
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return v.String()
+	case protoreflect.BoolKind:
+		return v.Bool()
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+		return v.Int()
+	case protoreflect.EnumKind:
+		return int64(v.Enum())
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return int64(v.Uint())
+	case protoreflect.MessageKind:
+		if ts, ok := v.Message().Interface().(*timestamppb.Timestamp); ok {
+			return ts.AsTime()
+		}
+	}
+	return nil
+}
+
+// CompareValues orders two values of the same kind, as returned by Value:
+// -1, 0 or +1. false sorts before true. Values of different types compare
+// equal.
+func CompareValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0
+			case b:
+				return -1
+			default:
+				return 1
+			}
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			return cmp.Compare(a, b)
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Order is one key of an ordering
+type Order struct {
+	Field string
+	Desc  bool
+}
+
+// ParseOrder parses an order_by list such as "display_name, create_time
+// desc", naming only the fields of schema, each at most once. Keys sort
+// ascending unless followed by desc. An empty list returns no keys.
+func ParseOrder(orderBy string, schema Schema) ([]Order, error) {
+	if strings.TrimSpace(orderBy) == "" {
+		return nil, nil
+	}
+	var orders []Order
+	seen := make(map[string]bool)
+	pos := 0
+	for _, part := range strings.Split(orderBy, ",") {
+		words := strings.Fields(part)
+		at := pos + strings.Index(part, strings.TrimSpace(part))
+		pos += len(part) + 1
+
+		if len(words) == 0 || len(words) > 2 {
+			return nil, &Error{Pos: at, Msg: fmt.Sprintf("invalid ordering %q, want a field optionally followed by asc or desc", strings.TrimSpace(part))}
+		}
+		order := Order{Field: words[0]}
+		if _, ok := schema[order.Field]; !ok {
+			return nil, &Error{Pos: at, Msg: fmt.Sprintf("unknown field %q, expected one of %v", order.Field, schema.names())}
+		}
+		if seen[order.Field] {
+			return nil, &Error{Pos: at, Msg: fmt.Sprintf("field %q ordered twice", order.Field)}
+		}
+		seen[order.Field] = true
+		if len(words) == 2 {
+			switch strings.ToLower(words[1]) {
+			case "asc":
+			case "desc":
+				order.Desc = true
+			default:
+				return nil, &Error{Pos: at, Msg: fmt.Sprintf("invalid direction %q for %s, want asc or desc", words[1], order.Field)}
+			}
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
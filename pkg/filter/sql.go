@@ -0,0 +1,84 @@
+package filter
+
+import (
+	"strings"
+)
+
+// SQLDialect adapts the conditions SQL renders to a database and table
+type SQLDialect struct {
+	// Placeholder returns the placeholder of the nth argument, counted
+	// from 1, e.g. "?" or "$1"
+	Placeholder func(n int) string
+
+	// Column returns the column holding field
+	Column func(field string) string
+
+	// Value, when set, converts a literal to what the column of field
+	// stores, e.g. a time.Time to Unix nanoseconds
+	Value func(field string, v any) any
+}
+
+// likeEscape escapes the wildcards of LIKE patterns. Backslash is not
+// used since MySQL and SQLite disagree on escaping it in literals.
+const likeEscape = "!"
+
+// SQL renders e as a condition on d's columns, appending its arguments to
+// args, and returns both. A nil Expr renders as a condition every row
+// meets. The : operator renders as a LIKE on lowercased columns, which on
+// SQLite lowercases ASCII letters only.
+func SQL(e Expr, d SQLDialect, args []any) (string, []any) {
+	var b strings.Builder
+	args = d.render(&b, e, args)
+	return b.String(), args
+}
+
+func (d SQLDialect) render(b *strings.Builder, e Expr, args []any) []any {
+	switch e := e.(type) {
+	case nil:
+		b.WriteString("1 = 1")
+	case *And:
+		args = d.join(b, " AND ", e.Exprs, args)
+	case *Or:
+		args = d.join(b, " OR ", e.Exprs, args)
+	case *Not:
+		b.WriteString("NOT (")
+		args = d.render(b, e.Expr, args)
+		b.WriteString(")")
+	case *Compare:
+		col := d.Column(e.Field)
+		if e.Op == Has {
+			sub, _ := e.Value.(string)
+			args = append(args, "%"+escapeLike(strings.ToLower(sub))+"%")
+			b.WriteString("lower(" + col + ") LIKE " + d.Placeholder(len(args)) + " ESCAPE '" + likeEscape + "'")
+			break
+		}
+		v := e.Value
+		if d.Value != nil {
+			v = d.Value(e.Field, v)
+		}
+		args = append(args, v)
+		op := string(e.Op)
+		if e.Op == NotEqual {
+			op = "<>"
+		}
+		b.WriteString(col + " " + op + " " + d.Placeholder(len(args)))
+	}
+	return args
+}
+
+func (d SQLDialect) join(b *strings.Builder, sep string, exprs []Expr, args []any) []any {
+	b.WriteString("(")
+	for i, x := range exprs {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		args = d.render(b, x, args)
+	}
+	b.WriteString(")")
+	return args
+}
+
+// escapeLike escapes the LIKE wildcards in s, so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_").Replace(s)
+}
@@ -0,0 +1,222 @@
+// Package freeze enforces deployment freeze windows: periods, such as year
+// end or weekends, in which operators must not change the running system.
+// During a window admin mutations are rejected unless the caller presents
+// an override token, and every override is logged.
+package freeze
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mutation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// OverrideHeader is the request metadata carrying an override token. The
+// HTTP gateway forwards the X-Freeze-Override header as it.
+const OverrideHeader = "x-freeze-override"
+
+// Window is a freeze period, either fixed from Start to End or recurring
+// every week
+type Window struct {
+	Name string
+
+	// Start and End bound a fixed window
+	Start, End time.Time
+
+	// weekly windows run from and to offsets since Sunday midnight in loc,
+	// wrapping past Saturday when to is before from
+	weekly   bool
+	from, to time.Duration
+	loc      *time.Location
+}
+
+// Weekly returns a window recurring every week from from to to, each a day
+// and time such as "Fri 16:00", in the IANA time zone tz (default UTC). A
+// window ending before it starts, such as "Fri 16:00" to "Mon 08:00", spans
+// the weekend.
+func Weekly(name, from, to, tz string) (Window, error) {
+	loc := time.UTC
+	if tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return Window{}, err
+		}
+	}
+	f, err := weekOffset(from)
+	if err != nil {
+		return Window{}, err
+	}
+	t, err := weekOffset(to)
+	if err != nil {
+		return Window{}, err
+	}
+	if f == t {
+		return Window{}, fmt.Errorf("freeze window %q is empty", name)
+	}
+	return Window{Name: name, weekly: true, from: f, to: t, loc: loc}, nil
+}
+
+// weekOffset parses "Mon 15:04" into the time since Sunday midnight
+func weekOffset(s string) (time.Duration, error) {
+	day, clockTime, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return 0, fmt.Errorf("%q must be a day and time, e.g. \"Fri 16:00\"", s)
+	}
+	d := -1
+	for i := time.Sunday; i <= time.Saturday; i++ {
+		if strings.EqualFold(day, i.String()[:3]) || strings.EqualFold(day, i.String()) {
+			d = int(i)
+		}
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("unknown day %q", day)
+	}
+	tod, err := time.Parse("15:04", clockTime)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", clockTime)
+	}
+	return time.Duration(d)*24*time.Hour + time.Duration(tod.Hour())*time.Hour + time.Duration(tod.Minute())*time.Minute, nil
+}
+
+// Active reports whether t falls in the window, and if so when the window
+// ends
+func (w Window) Active(t time.Time) (time.Time, bool) {
+	if !w.weekly {
+		return w.End, !t.Before(w.Start) && t.Before(w.End)
+	}
+	// Offsets are wall clock times, so windows keep their local hours
+	// across daylight saving changes
+	local := t.In(w.loc)
+	offset := time.Duration(local.Weekday())*24*time.Hour +
+		time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+	y, m, d := local.Date()
+	at := func(weeks int, offset time.Duration) time.Time {
+		day := d - int(local.Weekday()) + 7*weeks + int(offset/(24*time.Hour))
+		tod := offset % (24 * time.Hour)
+		return time.Date(y, m, day, int(tod/time.Hour), int(tod%time.Hour/time.Minute), 0, 0, w.loc)
+	}
+
+	switch {
+	case w.from < w.to && offset >= w.from && offset < w.to:
+		return at(0, w.to), true
+	case w.from > w.to && offset >= w.from:
+		return at(1, w.to), true
+	case w.from > w.to && offset < w.to:
+		return at(0, w.to), true
+	}
+	return time.Time{}, false
+}
+
+// Options configures a Guard
+type Options struct {
+	Windows []Window
+
+	// Methods are the full methods or prefixes guarded, e.g.
+	// "/api.v1.AdminService/". Only their mutations are rejected.
+	Methods []string
+
+	// Mutations are the methods that change the system. Every other
+	// method is served during a freeze.
+	Mutations mutation.Set
+
+	// Overrides are tokens that let a call through during a freeze. Their
+	// names are logged when used.
+	Overrides []auth.Token
+}
+
+// Guard rejects guarded mutations during freeze windows
+type Guard struct {
+	log   logger.Logger
+	opts  Options
+	clock clock.Clock
+}
+
+// New creates a Guard. A nil clock uses the real one.
+func New(log logger.Logger, opts Options, c clock.Clock) *Guard {
+	if c == nil {
+		c = clock.Real()
+	}
+	var overrides []auth.Token
+	for _, t := range opts.Overrides {
+		if t.Token != "" {
+			overrides = append(overrides, t)
+		}
+	}
+	opts.Overrides = overrides
+	return &Guard{log: log, opts: opts, clock: c}
+}
+
+// Active returns the window in force now, if any, and when it ends. Of
+// overlapping windows the one ending last is returned.
+func (g *Guard) Active() (Window, time.Time, bool) {
+	now := g.clock.Now()
+	var active Window
+	var until time.Time
+	var found bool
+	for _, w := range g.opts.Windows {
+		if end, ok := w.Active(now); ok && end.After(until) {
+			active, until, found = w, end, true
+		}
+	}
+	return active, until, found
+}
+
+// UnaryServerInterceptor rejects guarded mutations during a freeze unless
+// they carry an override token. Place it after authentication so overrides
+// are logged with the caller's identity.
+func (g *Guard) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !hasAnyPrefix(info.FullMethod, g.opts.Methods) || !g.opts.Mutations.Contains(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		w, until, ok := g.Active()
+		if !ok {
+			return handler(ctx, req)
+		}
+		if name, ok := g.override(ctx); ok {
+			caller, _ := auth.IdentityFromContext(ctx)
+			g.log.Warn("Freeze %q overridden with token %q by %q for %s", w.Name, name, caller, info.FullMethod)
+			return handler(ctx, req)
+		}
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"deployment freeze %q in effect until %s, changes need an override token", w.Name, until.UTC().Format(time.RFC3339))
+	}
+}
+
+// override returns the name of the override token presented, if valid
+func (g *Guard) override(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(OverrideHeader)
+	if len(values) == 0 || values[0] == "" {
+		return "", false
+	}
+	// Compare against every token so the time taken does not reveal which
+	// one nearly matched
+	var name string
+	var found bool
+	for _, t := range g.opts.Overrides {
+		if subtle.ConstantTimeCompare([]byte(values[0]), []byte(t.Token)) == 1 {
+			name, found = t.Name, true
+		}
+	}
+	return name, found
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
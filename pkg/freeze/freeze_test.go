@@ -0,0 +1,172 @@
+package freeze_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/freeze"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mutation"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestWeekly(t *testing.T) {
+	weekend, err := freeze.Weekly("weekend", "Fri 16:00", "Mon 08:00", "Europe/Berlin")
+	if err != nil {
+		t.Fatalf("Weekly() unexpected error: %v", err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 3, day, hour, minute, 0, 0, berlin)
+	}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		wantOn    bool
+		wantUntil time.Time
+	}{
+		{name: "thursday", now: at(27, 12, 0)},
+		{name: "friday before", now: at(28, 15, 59)},
+		{name: "friday start", now: at(28, 16, 0), wantOn: true, wantUntil: at(31, 8, 0)},
+		// Clocks go forward on 30 March; the window still ends at 08:00
+		{name: "sunday", now: at(30, 12, 0), wantOn: true, wantUntil: at(31, 8, 0)},
+		{name: "monday before end", now: at(31, 7, 59), wantOn: true, wantUntil: at(31, 8, 0)},
+		{name: "monday end", now: at(31, 8, 0)},
+		{name: "utc friday evening", now: time.Date(2025, 3, 28, 15, 30, 0, 0, time.UTC), wantOn: true, wantUntil: at(31, 8, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, on := weekend.Active(tt.now)
+			if on != tt.wantOn || (on && !until.Equal(tt.wantUntil)) {
+				t.Errorf("Active(%v) = %v, %v, want %v until %v", tt.now, until, on, tt.wantOn, tt.wantUntil)
+			}
+		})
+	}
+
+	for _, bad := range [][2]string{{"Fri", "Mon 08:00"}, {"Fun 16:00", "Mon 08:00"}, {"Fri 25:00", "Mon 08:00"}, {"Fri 16:00", "Fri 16:00"}} {
+		if _, err := freeze.Weekly("bad", bad[0], bad[1], ""); err == nil {
+			t.Errorf("Weekly(%q, %q) returned no error", bad[0], bad[1])
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	start := time.Date(2025, 12, 20, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start.Add(-time.Hour))
+	g := freeze.New(logger.Nop(), freeze.Options{
+		Windows:   []freeze.Window{{Name: "year-end", Start: start, End: start.Add(16 * 24 * time.Hour)}},
+		Methods:   []string{"/api.v1.AdminService/"},
+		Mutations: mutation.NewSet("/api.v1.AdminService/RetryJob", "/api.v1.UserService/UpdateUser"),
+		Overrides: []auth.Token{{Name: "incident", Token: "s3cret"}},
+	}, fake)
+	intercept := g.UnaryServerInterceptor()
+	call := func(ctx context.Context, method string) error {
+		_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		return err
+	}
+	ctx := context.Background()
+
+	if err := call(ctx, "/api.v1.AdminService/RetryJob"); err != nil {
+		t.Errorf("RetryJob before the freeze error = %v, want served", err)
+	}
+
+	fake.Advance(2 * time.Hour)
+	err := call(ctx, "/api.v1.AdminService/RetryJob")
+	if st := status.Convert(err); st.Code() != codes.FailedPrecondition || !strings.Contains(st.Message(), "year-end") {
+		t.Errorf("RetryJob during the freeze error = %v, want %v naming the window", err, codes.FailedPrecondition)
+	}
+	for _, method := range []string{"/api.v1.AdminService/ListJobs", "/api.v1.AdminService/DumpState", "/api.v1.UserService/UpdateUser"} {
+		if err := call(ctx, method); err != nil {
+			t.Errorf("%s during the freeze error = %v, want reads and unguarded methods served", method, err)
+		}
+	}
+
+	wrong := metadata.NewIncomingContext(ctx, metadata.Pairs(freeze.OverrideHeader, "guess"))
+	if err := call(wrong, "/api.v1.AdminService/RetryJob"); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("RetryJob with a wrong override error = %v, want %v", err, codes.FailedPrecondition)
+	}
+	override := metadata.NewIncomingContext(ctx, metadata.Pairs(freeze.OverrideHeader, "s3cret"))
+	if err := call(override, "/api.v1.AdminService/RetryJob"); err != nil {
+		t.Errorf("RetryJob with the override error = %v, want served", err)
+	}
+
+	fake.Advance(16 * 24 * time.Hour)
+	if err := call(ctx, "/api.v1.AdminService/RetryJob"); err != nil {
+		t.Errorf("RetryJob after the freeze error = %v, want served", err)
+	}
+}
+
+func TestGuardDefaultMutations(t *testing.T) {
+	cfg := config.Default()
+	g := freeze.New(logger.Nop(), freeze.Options{
+		Windows:   []freeze.Window{{Name: "always", Start: time.Unix(0, 0), End: time.Now().Add(time.Hour)}},
+		Methods:   cfg.Freeze.Methods,
+		Mutations: mutation.NewSet(cfg.Mutations...),
+	}, nil)
+	intercept := g.UnaryServerInterceptor()
+	call := func(method string) error {
+		_, err := intercept(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		return err
+	}
+
+	for _, method := range []string{"/api.v1.AdminService/DumpState", "/api.v1.AdminService/GetInstanceInfo", "/api.v1.AdminService/ListSettings"} {
+		if err := call(method); err != nil {
+			t.Errorf("%s during the freeze error = %v, want served", method, err)
+		}
+	}
+	for _, method := range []string{"/api.v1.AdminService/RestoreState", "/api.v1.AdminService/UpdateSetting", "/api.v1.AdminService/SetMaintenanceMode"} {
+		if err := call(method); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("%s during the freeze error = %v, want %v", method, err, codes.FailedPrecondition)
+		}
+	}
+}
+
+func TestGuardGatewayOverride(t *testing.T) {
+	g := freeze.New(logger.Nop(), freeze.Options{
+		Windows:   []freeze.Window{{Name: "always", Start: time.Unix(0, 0), End: time.Now().Add(time.Hour)}},
+		Methods:   []string{"/api.v1.UserService/"},
+		Mutations: mutation.NewSet("/api.v1.UserService/CreateUser"),
+		Overrides: []auth.Token{{Name: "incident", Token: "s3cret"}},
+	}, nil)
+	srv := testutil.NewServer(t, testutil.WithServerOptions(grpc.ChainUnaryInterceptor(g.UnaryServerInterceptor())))
+
+	post := func(override string) int {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/users", strings.NewReader(`{"user":{"email":"a@example.com","display_name":"A"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		if override != "" {
+			req.Header.Set("X-Freeze-Override", override)
+		}
+		resp, err := srv.HTTPClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /v1/users unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post(""); code != http.StatusBadRequest {
+		t.Errorf("POST /v1/users during the freeze = %d, want 400", code)
+	}
+	if code := post("s3cret"); code != http.StatusOK {
+		t.Errorf("POST /v1/users with X-Freeze-Override = %d, want 200", code)
+	}
+
+	if _, err := srv.Client.ListUsers(context.Background(), &apiv1.ListUsersRequest{}); err != nil {
+		t.Errorf("ListUsers() during the freeze error = %v, want served", err)
+	}
+}
@@ -0,0 +1,351 @@
+// Package health reports the serving status of the gRPC server over the
+// standard grpc.health.v1 protocol, so Kubernetes gRPC probes and clients
+// doing client-side health checks can use it.
+//
+// The server as a whole, the empty service name, and every service serve
+// once the Checker is ready and until it drains. A service stops serving
+// while a dependency it needs fails its check, or while it is turned off
+// with SetServing. Liveness serves until Shutdown whatever the rest reports,
+// for liveness probes and connections that must not drop during warmup or
+// drain.
+//
+// Optional dependencies are only reported: Results returns the outcome of
+// every check, for the HTTP readiness endpoint to show.
+package health
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Liveness is the service name that serves for as long as the process
+// does
+const Liveness = "liveness"
+
+// Dependency is something services cannot serve without, such as a store
+type Dependency struct {
+	// Name identifies the dependency in logs
+	Name string
+
+	// Check reports whether the dependency is healthy
+	Check func(ctx context.Context) error
+
+	// Services stop serving while the check fails. Empty means the server
+	// as a whole.
+	Services []string
+
+	// Optional dependencies, such as a cache with a fallback, are checked
+	// and reported but stop nothing from serving
+	Optional bool
+}
+
+// Result is the outcome of the last check of a dependency
+type Result struct {
+	Name     string
+	Optional bool
+
+	// Checked is false until the first check completes
+	Checked bool
+
+	// Err is the error of the last check, nil when it passed
+	Err error
+
+	// Since is when the check started passing or failing
+	Since time.Time
+}
+
+// Healthy reports whether the dependency passed its last check, or has not
+// been checked yet
+func (r Result) Healthy() bool {
+	return r.Err == nil
+}
+
+// Options configures the dependency checks
+type Options struct {
+	// Interval between checks (default 10s)
+	Interval time.Duration
+
+	// Timeout bounds each check (default 2s)
+	Timeout time.Duration
+}
+
+// Checker manages the statuses the health service reports
+type Checker struct {
+	log    logger.Logger
+	opts   Options
+	server *grpchealth.Server
+
+	mu       sync.Mutex
+	services map[string]bool   // services registered, and whether turned on
+	results  map[string]Result // last check of each dependency
+	deps     []Dependency
+	ready    bool
+	draining bool
+	stopped  bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a Checker that reports nothing serving but Liveness until
+// SetReady. deps are checked once Start is called.
+func New(log logger.Logger, opts Options, deps ...Dependency) *Checker {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	c := &Checker{
+		log:      log,
+		opts:     opts,
+		deps:     deps,
+		server:   grpchealth.NewServer(),
+		services: map[string]bool{"": true},
+		results:  make(map[string]Result),
+	}
+	c.update()
+	return c
+}
+
+// Add registers more dependencies, checked from the next round on, for
+// components set up after the Checker
+func (c *Checker) Add(deps ...Dependency) {
+	c.mu.Lock()
+	c.deps = append(c.deps, deps...)
+	c.mu.Unlock()
+}
+
+// Register registers the health service with s and reports the status of
+// services from now on
+func (c *Checker) Register(s grpc.ServiceRegistrar, services ...string) {
+	c.mu.Lock()
+	for _, service := range services {
+		if _, ok := c.services[service]; !ok {
+			c.services[service] = true
+		}
+	}
+	c.mu.Unlock()
+	c.update()
+	healthpb.RegisterHealthServer(s, c.server)
+}
+
+// SetReady reports the server serving, once started and warmed up
+func (c *Checker) SetReady() {
+	c.mu.Lock()
+	c.ready = true
+	c.mu.Unlock()
+	c.update()
+}
+
+// Drain reports the server and its services not serving ahead of shutdown,
+// so probes and load balancers stop routing new calls here
+func (c *Checker) Drain() {
+	c.mu.Lock()
+	c.draining = true
+	c.mu.Unlock()
+	c.update()
+}
+
+// SetServing turns service on or off, for services that find themselves
+// unable to serve. The empty name turns the whole server off.
+func (c *Checker) SetServing(service string, serving bool) {
+	c.mu.Lock()
+	c.services[service] = serving
+	c.mu.Unlock()
+	c.update()
+}
+
+// Shutdown reports everything, Liveness included, not serving for good.
+// Call it just before stopping the gRPC server.
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	c.server.Shutdown()
+}
+
+// Live reports whether the process is serving at all, false once Shutdown
+// has been called
+func (c *Checker) Live() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.stopped
+}
+
+// Results returns the last check of every dependency, in the order they
+// were added
+func (c *Checker) Results() []Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	results := make([]Result, 0, len(c.deps))
+	for _, dep := range c.deps {
+		r, ok := c.results[dep.Name]
+		if !ok {
+			r = Result{Name: dep.Name, Optional: dep.Optional}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// Status returns the status reported for service
+func (c *Checker) Status(service string) healthpb.HealthCheckResponse_ServingStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status(service)
+}
+
+// Start checks the dependencies right away and then every Interval until
+// Stop is called or ctx is done
+func (c *Checker) Start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	go c.run(ctx)
+}
+
+// Stop ends the checks, waiting for one in progress until ctx is done
+func (c *Checker) Stop(ctx context.Context) error {
+	if c.cancel == nil {
+		return nil
+	}
+	c.cancel()
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Checker) run(ctx context.Context) {
+	defer close(c.done)
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		c.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs every dependency check once and reports the services that
+// depend on failing ones not serving
+func (c *Checker) check(ctx context.Context) {
+	c.mu.Lock()
+	deps := c.deps
+	c.mu.Unlock()
+
+	changed := false
+	for _, dep := range deps {
+		checkCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+		err := dep.Check(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.mu.Lock()
+		prev, checked := c.results[dep.Name]
+		was := checked && !prev.Healthy()
+		r := Result{Name: dep.Name, Optional: dep.Optional, Checked: true, Err: err, Since: prev.Since}
+		if !checked || was != (err != nil) {
+			r.Since = time.Now()
+		}
+		c.results[dep.Name] = r
+		c.mu.Unlock()
+		switch {
+		case err != nil && !was && dep.Optional:
+			c.log.Warn("Health: optional %s failing: %v", dep.Name, err)
+		case err != nil && !was:
+			c.log.Warn("Health: %s failing, %s not serving: %v", dep.Name, describe(dep.Services), err)
+			changed = true
+		case err == nil && was && dep.Optional:
+			c.log.Info("Health: optional %s recovered", dep.Name)
+		case err == nil && was:
+			c.log.Info("Health: %s recovered, %s serving again", dep.Name, describe(dep.Services))
+			changed = true
+		}
+	}
+	if changed {
+		c.update()
+	}
+}
+
+// update pushes the status of every service to the health server
+func (c *Checker) update() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	c.server.SetServingStatus(Liveness, healthpb.HealthCheckResponse_SERVING)
+	for _, service := range c.names() {
+		c.server.SetServingStatus(service, c.status(service))
+	}
+}
+
+// status returns the status of service. c.mu must be held.
+func (c *Checker) status(service string) healthpb.HealthCheckResponse_ServingStatus {
+	if c.stopped {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	if service == Liveness {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	on, ok := c.services[service]
+	if !ok {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	if !on || !c.ready || c.draining || !c.services[""] {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	for _, dep := range c.deps {
+		if !dep.Optional && !c.results[dep.Name].Healthy() && dependsOn(dep, service) {
+			return healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+// names returns the registered services in order. c.mu must be held.
+func (c *Checker) names() []string {
+	names := make([]string, 0, len(c.services))
+	for name := range c.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dependsOn reports whether service cannot serve without dep. A dependency
+// of the whole server is one of every service.
+func dependsOn(dep Dependency, service string) bool {
+	if len(dep.Services) == 0 {
+		return true
+	}
+	for _, s := range dep.Services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(services []string) string {
+	if len(services) == 0 {
+		return "the server"
+	}
+	return strings.Join(services, ", ")
+}
@@ -0,0 +1,164 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	users = "api.v1.UserService"
+	tasks = "api.v1.TaskService"
+)
+
+func wantStatus(t *testing.T, c *Checker, want map[string]healthpb.HealthCheckResponse_ServingStatus) {
+	t.Helper()
+	for service, status := range want {
+		if got := c.Status(service); got != status {
+			t.Errorf("Status(%q) = %v, want %v", service, got, status)
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	c := New(logger.Nop(), Options{})
+	c.Register(grpc.NewServer(), users, tasks)
+
+	const (
+		serving    = healthpb.HealthCheckResponse_SERVING
+		notServing = healthpb.HealthCheckResponse_NOT_SERVING
+	)
+	wantStatus(t, c, map[string]healthpb.HealthCheckResponse_ServingStatus{
+		"": notServing, users: notServing, Liveness: serving,
+		"api.v1.Unknown": healthpb.HealthCheckResponse_SERVICE_UNKNOWN,
+	})
+
+	c.SetReady()
+	wantStatus(t, c, map[string]healthpb.HealthCheckResponse_ServingStatus{"": serving, users: serving, tasks: serving})
+
+	c.SetServing(users, false)
+	wantStatus(t, c, map[string]healthpb.HealthCheckResponse_ServingStatus{"": serving, users: notServing, tasks: serving})
+	c.SetServing(users, true)
+
+	c.Drain()
+	wantStatus(t, c, map[string]healthpb.HealthCheckResponse_ServingStatus{"": notServing, users: notServing, Liveness: serving})
+
+	c.Shutdown()
+	wantStatus(t, c, map[string]healthpb.HealthCheckResponse_ServingStatus{Liveness: notServing})
+}
+
+func TestDependencies(t *testing.T) {
+	var failing atomic.Bool
+	c := New(logger.Nop(), Options{}, Dependency{
+		Name: "users",
+		Check: func(ctx context.Context) error {
+			if failing.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+		Services: []string{users},
+	})
+	c.Register(grpc.NewServer(), users, tasks)
+	c.SetReady()
+
+	failing.Store(true)
+	c.check(context.Background())
+	wantStatus(t, c, map[string]healthpb.HealthCheckResponse_ServingStatus{
+		"":    healthpb.HealthCheckResponse_SERVING,
+		users: healthpb.HealthCheckResponse_NOT_SERVING,
+		tasks: healthpb.HealthCheckResponse_SERVING,
+	})
+
+	failing.Store(false)
+	c.check(context.Background())
+	wantStatus(t, c, map[string]healthpb.HealthCheckResponse_ServingStatus{users: healthpb.HealthCheckResponse_SERVING})
+}
+
+func TestOptional(t *testing.T) {
+	c := New(logger.Nop(), Options{}, Dependency{
+		Name:     "cache",
+		Check:    func(ctx context.Context) error { return errors.New("redis down") },
+		Optional: true,
+	})
+	c.Register(grpc.NewServer(), users)
+	c.SetReady()
+
+	if results := c.Results(); len(results) != 1 || results[0].Checked {
+		t.Fatalf("Results() before a check = %+v, want cache pending", results)
+	}
+	c.check(context.Background())
+	wantStatus(t, c, map[string]healthpb.HealthCheckResponse_ServingStatus{"": healthpb.HealthCheckResponse_SERVING, users: healthpb.HealthCheckResponse_SERVING})
+
+	c.Add(Dependency{Name: "users", Check: func(ctx context.Context) error { return nil }})
+	c.check(context.Background())
+	results := c.Results()
+	if len(results) != 2 || results[0].Healthy() || !results[0].Optional || !results[1].Checked || !results[1].Healthy() {
+		t.Errorf("Results() = %+v, want the cache failing and users passing", results)
+	}
+}
+
+// TestWatch follows a client watching a service through startup, a
+// failing dependency and drain
+func TestWatch(t *testing.T) {
+	var failing atomic.Bool
+	c := New(logger.Nop(), Options{Interval: 10 * time.Millisecond}, Dependency{
+		Name: "users",
+		Check: func(ctx context.Context) error {
+			if failing.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	})
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	c.Register(s, users)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	c.Start(context.Background())
+	t.Cleanup(func() { c.Stop(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	watch, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{Service: users})
+	if err != nil {
+		t.Fatalf("Watch() unexpected error: %v", err)
+	}
+	next := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		resp, err := watch.Recv()
+		if err != nil {
+			t.Fatalf("Recv() unexpected error: %v", err)
+		}
+		if resp.GetStatus() != want {
+			t.Fatalf("status = %v, want %v", resp.GetStatus(), want)
+		}
+	}
+
+	next(healthpb.HealthCheckResponse_NOT_SERVING)
+	c.SetReady()
+	next(healthpb.HealthCheckResponse_SERVING)
+	failing.Store(true)
+	next(healthpb.HealthCheckResponse_NOT_SERVING)
+	failing.Store(false)
+	next(healthpb.HealthCheckResponse_SERVING)
+	c.Drain()
+	next(healthpb.HealthCheckResponse_NOT_SERVING)
+}
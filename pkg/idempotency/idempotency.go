@@ -0,0 +1,125 @@
+// Package idempotency lets clients retry a request without it taking
+// effect twice. A request carries a key, e.g. the request_id of AIP-155 or
+// an Idempotency-Key header; the first request under a key runs and its
+// response is recorded, and later ones with the same key get that response
+// back instead of running again. The memory store keeps keys in process
+// memory, for a single replica; the Redis store shares them between
+// replicas, so a retry may land on any of them.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Header is the metadata key carrying an idempotency key. The HTTP gateway
+// forwards the Idempotency-Key header as it.
+const Header = "idempotency-key"
+
+var (
+	// ErrInProgress is returned by Do while the first request under a key
+	// is still running
+	ErrInProgress = errors.New("idempotency: request in progress")
+
+	// ErrMismatch is returned by Do for a key first used with a different
+	// request
+	ErrMismatch = errors.New("idempotency: key reused with a different request")
+)
+
+// Record is what a Store keeps under a key
+type Record struct {
+	// Fingerprint identifies the request the key was first used with
+	Fingerprint string `json:"fingerprint"`
+
+	// Done reports whether the request finished, with Response
+	Done     bool   `json:"done"`
+	Response []byte `json:"response,omitempty"`
+}
+
+// Store keeps records by key until their TTL expires
+type Store interface {
+	// Claim stores rec under key for ttl unless the key holds a live
+	// record, which it returns instead. A nil record means rec was stored.
+	Claim(ctx context.Context, key string, rec Record, ttl time.Duration) (*Record, error)
+
+	// Complete replaces the record under key with rec for ttl
+	Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error
+
+	// Release drops the record under key if it is still claimed, the one
+	// Claim stored
+	Release(ctx context.Context, key string, claimed Record) error
+}
+
+// Options configures a Guard
+type Options struct {
+	// TTL is how long a response is replayed (default 24h)
+	TTL time.Duration
+
+	// PendingTTL bounds how long a key stays claimed by a request that
+	// never finished, e.g. on a replica that crashed (default 1m). It must
+	// exceed the longest request.
+	PendingTTL time.Duration
+}
+
+// Guard runs each request once per key
+type Guard struct {
+	store Store
+	opts  Options
+}
+
+// New creates a Guard recording responses in store
+func New(store Store, opts Options) *Guard {
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.PendingTTL <= 0 {
+		opts.PendingTTL = time.Minute
+	}
+	return &Guard{store: store, opts: opts}
+}
+
+// Do calls fn unless a request ran under key already, whose response it
+// returns instead. fingerprint identifies the request, so a key reused
+// for a different one fails with ErrMismatch, and a duplicate arriving
+// while the first one runs fails with ErrInProgress. Errors of fn are not
+// recorded, the request may be retried under the same key. A response that
+// cannot be recorded is still returned.
+func (g *Guard) Do(ctx context.Context, key, fingerprint string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	claim := Record{Fingerprint: fingerprint}
+	rec, err := g.store.Claim(ctx, key, claim, g.opts.PendingTTL)
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil {
+		switch {
+		case rec.Fingerprint != fingerprint:
+			return nil, ErrMismatch
+		case !rec.Done:
+			return nil, ErrInProgress
+		}
+		return rec.Response, nil
+	}
+
+	// The outcome is recorded even if the caller gave up meanwhile
+	ctx = context.WithoutCancel(ctx)
+	response, err := fn(ctx)
+	if err != nil {
+		g.store.Release(ctx, key, claim)
+		return nil, err
+	}
+	g.store.Complete(ctx, key, Record{Fingerprint: fingerprint, Done: true, Response: response}, g.opts.TTL)
+	return response, nil
+}
+
+// FromIncoming returns the idempotency key of the call in ctx, empty when
+// it has none
+func FromIncoming(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(Header); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
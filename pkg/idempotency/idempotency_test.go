@@ -0,0 +1,108 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idempotency"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGuard(t *testing.T) {
+	backends := []struct {
+		name string
+		// open returns a store and a func advancing its time
+		open func(t *testing.T) (idempotency.Store, func(time.Duration))
+	}{
+		{
+			name: "memory",
+			open: func(t *testing.T) (idempotency.Store, func(time.Duration)) {
+				c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+				return idempotency.NewMemoryStore(c), c.Advance
+			},
+		},
+		{
+			name: "redis",
+			open: func(t *testing.T) (idempotency.Store, func(time.Duration)) {
+				mr := miniredis.RunT(t)
+				client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+				t.Cleanup(func() { client.Close() })
+				return idempotency.NewRedisStore(client, ""), mr.FastForward
+			},
+		},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, advance := b.open(t)
+			g := idempotency.New(store, idempotency.Options{TTL: time.Hour, PendingTTL: time.Minute})
+
+			calls := 0
+			respond := func(response string) func(context.Context) ([]byte, error) {
+				return func(context.Context) ([]byte, error) {
+					calls++
+					return []byte(response), nil
+				}
+			}
+
+			if got, err := g.Do(ctx, "k1", "req", respond("first")); err != nil || string(got) != "first" {
+				t.Fatalf("Do() = %q, %v, want first", got, err)
+			}
+			// A retry replays the first response
+			if got, err := g.Do(ctx, "k1", "req", respond("second")); err != nil || string(got) != "first" || calls != 1 {
+				t.Errorf("Do() retry = %q, %v after %d calls, want first after 1", got, err, calls)
+			}
+			if _, err := g.Do(ctx, "k1", "other", respond("second")); !errors.Is(err, idempotency.ErrMismatch) {
+				t.Errorf("Do() with another request error = %v, want %v", err, idempotency.ErrMismatch)
+			}
+
+			// Failures are not recorded, so the request can be retried
+			failure := errors.New("boom")
+			if _, err := g.Do(ctx, "k2", "req", func(context.Context) ([]byte, error) { return nil, failure }); !errors.Is(err, failure) {
+				t.Errorf("Do() error = %v, want %v", err, failure)
+			}
+			if got, err := g.Do(ctx, "k2", "req", respond("retried")); err != nil || string(got) != "retried" {
+				t.Errorf("Do() after a failure = %q, %v, want retried", got, err)
+			}
+
+			// A duplicate arriving while the first request runs is refused
+			g.Do(ctx, "k3", "req", func(ctx context.Context) ([]byte, error) {
+				if _, err := g.Do(ctx, "k3", "req", respond("nested")); !errors.Is(err, idempotency.ErrInProgress) {
+					t.Errorf("Do() while running error = %v, want %v", err, idempotency.ErrInProgress)
+				}
+				return nil, nil
+			})
+
+			// A claim left by a request that never finished expires
+			if rec, err := store.Claim(ctx, "k4", idempotency.Record{Fingerprint: "req"}, time.Minute); rec != nil || err != nil {
+				t.Fatalf("Claim() = %v, %v, want nil", rec, err)
+			}
+			advance(2 * time.Minute)
+			if got, err := g.Do(ctx, "k4", "req", respond("recovered")); err != nil || string(got) != "recovered" {
+				t.Errorf("Do() after an expired claim = %q, %v, want recovered", got, err)
+			}
+
+			// Responses are replayed for the TTL only
+			advance(2 * time.Hour)
+			if got, err := g.Do(ctx, "k1", "other", respond("fresh")); err != nil || string(got) != "fresh" {
+				t.Errorf("Do() after the TTL = %q, %v, want fresh", got, err)
+			}
+		})
+	}
+}
+
+func TestFromIncoming(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(idempotency.Header, "abc"))
+	if got := idempotency.FromIncoming(ctx); got != "abc" {
+		t.Errorf("FromIncoming() = %q, want abc", got)
+	}
+	if got := idempotency.FromIncoming(context.Background()); got != "" {
+		t.Errorf("FromIncoming() without metadata = %q, want empty", got)
+	}
+}
@@ -0,0 +1,79 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+)
+
+// sweepEvery is how many claims pass between sweeps of expired records
+const sweepEvery = 1024
+
+// MemoryStore keeps records in process memory. Each replica has its own,
+// so a retry reaching another replica runs again.
+type MemoryStore struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	records map[string]entry
+	claims  int
+}
+
+type entry struct {
+	rec     Record
+	expires time.Time
+}
+
+// NewMemoryStore creates a MemoryStore. A nil clock uses the real one.
+func NewMemoryStore(c clock.Clock) *MemoryStore {
+	if c == nil {
+		c = clock.Real()
+	}
+	return &MemoryStore{clock: c, records: make(map[string]entry)}
+}
+
+// Claim stores rec under key for ttl unless the key holds a live record
+func (s *MemoryStore) Claim(ctx context.Context, key string, rec Record, ttl time.Duration) (*Record, error) {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.records[key]; ok && now.Before(e.expires) {
+		found := e.rec
+		found.Response = append([]byte(nil), e.rec.Response...)
+		return &found, nil
+	}
+	s.records[key] = entry{rec: rec, expires: now.Add(ttl)}
+	s.claims++
+	if s.claims%sweepEvery == 0 {
+		for key, e := range s.records {
+			if !now.Before(e.expires) {
+				delete(s.records, key)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Complete replaces the record under key with rec for ttl
+func (s *MemoryStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	rec.Response = append([]byte(nil), rec.Response...)
+	expires := s.clock.Now().Add(ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = entry{rec: rec, expires: expires}
+	return nil
+}
+
+// Release drops the record under key if it is still claimed
+func (s *MemoryStore) Release(ctx context.Context, key string, claimed Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.records[key]; ok && !e.rec.Done && e.rec.Fingerprint == claimed.Fingerprint {
+		delete(s.records, key)
+	}
+	return nil
+}
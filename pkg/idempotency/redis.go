@@ -0,0 +1,85 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// releaseScript deletes the record only if it is still the claim
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// claimAttempts bounds the retries of a claim whose record expired between
+// SET NX and GET
+const claimAttempts = 3
+
+// RedisStore keeps records in Redis, shared by every replica using it
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore creates a RedisStore on client. prefix is prepended to
+// keys (default "idempotency:").
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "idempotency:"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Claim stores rec under key for ttl unless the key holds a live record
+func (s *RedisStore) Claim(ctx context.Context, key string, rec Record, ttl time.Duration) (*Record, error) {
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	for range claimAttempts {
+		ok, err := s.client.SetNX(ctx, s.prefix+key, value, ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return nil, nil
+		}
+		found, err := s.client.Get(ctx, s.prefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var existing Record
+		if err := json.Unmarshal(found, &existing); err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	return nil, errors.New("idempotency: claim kept expiring")
+}
+
+// Complete replaces the record under key with rec for ttl
+func (s *RedisStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+// Release drops the record under key if it is still claimed
+func (s *RedisStore) Release(ctx context.Context, key string, claimed Record) error {
+	value, err := json.Marshal(claimed)
+	if err != nil {
+		return err
+	}
+	return releaseScript.Run(ctx, s.client, []string{s.prefix + key}, value).Err()
+}
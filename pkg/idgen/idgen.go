@@ -0,0 +1,121 @@
+// Package idgen provides strategies for generating resource IDs.
+package idgen
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+)
+
+// Supported strategies
+const (
+	StrategySequential = "sequential"
+	StrategyUUID       = "uuid"
+	StrategyULID       = "ulid"
+)
+
+// Generator generates unique IDs
+type Generator interface {
+	NewID() string
+}
+
+// Counter is a Generator counting up, whose position must move with the
+// data it named, e.g. when state is restored into another instance
+type Counter interface {
+	Generator
+
+	// Last returns the last ID issued, 0 before the first
+	Last() int64
+
+	// Continue issues IDs after last from now on, unless the counter is
+	// already past it
+	Continue(last int64)
+}
+
+// New creates a Generator for the named strategy
+func New(strategy string) (Generator, error) {
+	switch strings.ToLower(strategy) {
+	case StrategySequential:
+		return NewSequential(), nil
+	case StrategyUUID, "":
+		return NewUUID(), nil
+	case StrategyULID:
+		return NewULID(clock.Real()), nil
+	default:
+		return nil, fmt.Errorf("idgen: unknown strategy %q", strategy)
+	}
+}
+
+// Sequential generates increasing integers starting at 1. IDs are
+// predictable, so use it for tests and demos only.
+type Sequential struct {
+	next atomic.Int64
+}
+
+// NewSequential creates a Sequential generator
+func NewSequential() *Sequential {
+	return &Sequential{}
+}
+
+// NewID returns the next integer ID
+func (g *Sequential) NewID() string {
+	return strconv.FormatInt(g.next.Add(1), 10)
+}
+
+// Last returns the last ID issued
+func (g *Sequential) Last() int64 {
+	return g.next.Load()
+}
+
+// Continue issues IDs after last, unless they are already past it
+func (g *Sequential) Continue(last int64) {
+	for {
+		current := g.next.Load()
+		if current >= last || g.next.CompareAndSwap(current, last) {
+			return
+		}
+	}
+}
+
+// UUID generates random version 4 UUIDs
+type UUID struct{}
+
+// NewUUID creates a UUID generator
+func NewUUID() UUID {
+	return UUID{}
+}
+
+// NewID returns a new random UUID
+func (UUID) NewID() string {
+	return uuid.NewString()
+}
+
+// ULID generates lexicographically sortable ULIDs, monotonic within the same
+// millisecond
+type ULID struct {
+	clock   clock.Clock
+	mu      sync.Mutex
+	entropy *ulid.MonotonicEntropy
+}
+
+// NewULID creates a ULID generator using c for the timestamp component
+func NewULID(c clock.Clock) *ULID {
+	return &ULID{
+		clock:   c,
+		entropy: ulid.Monotonic(rand.Reader, 0),
+	}
+}
+
+// NewID returns a new lowercase ULID
+func (g *ULID) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return strings.ToLower(ulid.MustNew(ulid.Timestamp(g.clock.Now()), g.entropy).String())
+}
@@ -0,0 +1,79 @@
+package idgen
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+)
+
+func TestNew(t *testing.T) {
+	for _, strategy := range []string{"sequential", "uuid", "ULID", ""} {
+		if _, err := New(strategy); err != nil {
+			t.Errorf("New(%q) unexpected error: %v", strategy, err)
+		}
+	}
+	if _, err := New("snowflake"); err == nil {
+		t.Errorf("New(%q) expected error", "snowflake")
+	}
+}
+
+func TestGeneratorsUnique(t *testing.T) {
+	generators := map[string]Generator{
+		"sequential": NewSequential(),
+		"uuid":       NewUUID(),
+		"ulid":       NewULID(clock.NewFake(time.Unix(0, 0))),
+	}
+
+	for name, gen := range generators {
+		t.Run(name, func(t *testing.T) {
+			seen := make(map[string]bool)
+			for i := 0; i < 1000; i++ {
+				id := gen.NewID()
+				if seen[id] {
+					t.Fatalf("NewID() returned duplicate %q", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+}
+
+func TestSequential(t *testing.T) {
+	gen := NewSequential()
+	for _, want := range []string{"1", "2", "3"} {
+		if got := gen.NewID(); got != want {
+			t.Errorf("NewID() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestULIDSortable(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	gen := NewULID(clk)
+
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, gen.NewID())
+		if i%10 == 0 {
+			clk.Advance(time.Millisecond)
+		}
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("ULIDs are not in generation order: %v", ids)
+	}
+}
+
+func TestSequentialContinue(t *testing.T) {
+	gen := NewSequential()
+	gen.NewID()
+	gen.Continue(41)
+	if got := gen.NewID(); got != "42" {
+		t.Errorf("NewID() after Continue(41) = %q, want %q", got, "42")
+	}
+	gen.Continue(7)
+	if got := gen.Last(); got != 42 {
+		t.Errorf("Last() after Continue(7) = %d, want the counter kept at 42", got)
+	}
+}
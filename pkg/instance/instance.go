@@ -0,0 +1,127 @@
+// Package instance describes the running server instance: where it runs,
+// since when, and what it was built and configured with. Replicas report it
+// so differences between them can be traced to host, zone or configuration.
+package instance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+)
+
+// ZoneEnv are the environment variables checked for the zone, in order
+var ZoneEnv = []string{"ZONE", "TOPOLOGY_ZONE", "AVAILABILITY_ZONE"}
+
+// Info describes the instance. Its fields do not change after New; Uptime
+// is computed on each call.
+type Info struct {
+	Hostname          string
+	Zone              string
+	StartTime         time.Time
+	Profile           string
+	ConfigFingerprint string
+	Version           string
+	GoVersion         string
+	Features          []string
+
+	// Fingerprint combines ConfigFingerprint and Version
+	Fingerprint string
+
+	clock clock.Clock
+}
+
+// Options are the parts of Info that come from the caller
+type Options struct {
+	// Profile names the configuration, e.g. "production"
+	Profile           string
+	ConfigFingerprint string
+
+	// Features are the optional features enabled, stored sorted
+	Features []string
+
+	// Zone overrides the zone from the environment and metadata server
+	Zone string
+
+	// Metadata is the cloud metadata server asked for the zone when the
+	// environment does not name one: "gce", "aws" or empty for none
+	Metadata string
+}
+
+// New describes the running process, started now. The metadata server is
+// only asked when no zone is configured or set in the environment, and
+// not at all outside that cloud, bounded by ctx.
+func New(ctx context.Context, opts Options, c clock.Clock) *Info {
+	if c == nil {
+		c = clock.Real()
+	}
+	hostname, _ := os.Hostname()
+	features := append([]string(nil), opts.Features...)
+	sort.Strings(features)
+
+	info := &Info{
+		Hostname:          hostname,
+		Zone:              opts.Zone,
+		StartTime:         c.Now(),
+		Profile:           opts.Profile,
+		ConfigFingerprint: opts.ConfigFingerprint,
+		Version:           version(),
+		GoVersion:         runtime.Version(),
+		Features:          features,
+		clock:             c,
+	}
+	info.Fingerprint = Fingerprint(info.ConfigFingerprint, info.Version)
+	if info.Zone == "" {
+		info.Zone = zoneFromEnv()
+	}
+	if info.Zone == "" && opts.Metadata != "" {
+		info.Zone, _ = zoneFromMetadata(ctx, opts.Metadata)
+	}
+	return info
+}
+
+// Uptime returns how long the instance has been running
+func (i *Info) Uptime() time.Duration {
+	return i.clock.Now().Sub(i.StartTime)
+}
+
+// Fingerprint hashes a configuration fingerprint and binary version, so
+// replicas match only when they run the same build with the same settings
+func Fingerprint(configFingerprint, version string) string {
+	sum := sha256.Sum256([]byte(configFingerprint + "\x00" + version))
+	return hex.EncodeToString(sum[:6])
+}
+
+func zoneFromEnv() string {
+	for _, name := range ZoneEnv {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// version returns the main module's version, or the VCS revision it was
+// built from when the version is unknown, as in go run or a plain build of
+// an untagged tree
+func version() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := bi.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" && s.Value != "" {
+			return s.Value
+		}
+	}
+	return "(devel)"
+}
@@ -0,0 +1,60 @@
+package instance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewZone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/computeMetadata/v1/instance/zone" && r.Header.Get("Metadata-Flavor") == "Google":
+			w.Write([]byte("projects/123/zones/us-central1-a"))
+		case r.URL.Path == "/latest/api/token" && r.Method == http.MethodPut:
+			w.Write([]byte("token"))
+		case r.URL.Path == "/latest/meta-data/placement/availability-zone" && r.Header.Get("X-aws-ec2-metadata-token") == "token":
+			w.Write([]byte("eu-west-1a"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(host string) { metadataHost = host }(metadataHost)
+	metadataHost = srv.URL
+
+	tests := []struct {
+		name string
+		env  string
+		opts Options
+		want string
+	}{
+		{name: "none"},
+		{name: "env", env: "zone-a", opts: Options{Metadata: "gce"}, want: "zone-a"},
+		{name: "config", env: "zone-a", opts: Options{Zone: "zone-b"}, want: "zone-b"},
+		{name: "gce", opts: Options{Metadata: "gce"}, want: "us-central1-a"},
+		{name: "aws", opts: Options{Metadata: "aws"}, want: "eu-west-1a"},
+		{name: "unknown provider", opts: Options{Metadata: "azure"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ZONE", tt.env)
+			if got := New(context.Background(), tt.opts, nil).Zone; got != tt.want {
+				t.Errorf("New().Zone = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	fp := Fingerprint("abc123", "v1.2.0")
+	if len(fp) != 12 || fp != Fingerprint("abc123", "v1.2.0") {
+		t.Errorf("Fingerprint() = %q, want 12 stable hex digits", fp)
+	}
+	for _, other := range []string{Fingerprint("abc124", "v1.2.0"), Fingerprint("abc123", "v1.2.1")} {
+		if other == fp {
+			t.Errorf("Fingerprint() = %q for a different config or version, want it to differ", other)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package instance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// metadataTimeout bounds each metadata request, so startup outside the
+// cloud is not held up
+const metadataTimeout = time.Second
+
+// metadataHost is the link-local address of the GCE and AWS metadata servers
+var metadataHost = "http://169.254.169.254"
+
+// zoneFromMetadata asks the cloud metadata server for the zone
+func zoneFromMetadata(ctx context.Context, provider string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*metadataTimeout)
+	defer cancel()
+	client := &http.Client{Timeout: metadataTimeout}
+
+	switch provider {
+	case "gce":
+		// Returns projects/{number}/zones/{zone}
+		zone, err := metadataGet(ctx, client, http.MethodGet, "/computeMetadata/v1/instance/zone", map[string]string{"Metadata-Flavor": "Google"})
+		if err != nil {
+			return "", err
+		}
+		return zone[strings.LastIndex(zone, "/")+1:], nil
+	case "aws":
+		// IMDSv2 needs a session token first
+		token, err := metadataGet(ctx, client, http.MethodPut, "/latest/api/token", map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+		if err != nil {
+			return "", err
+		}
+		return metadataGet(ctx, client, http.MethodGet, "/latest/meta-data/placement/availability-zone", map[string]string{"X-aws-ec2-metadata-token": token})
+	default:
+		return "", fmt.Errorf("unknown metadata provider %q", provider)
+	}
+}
+
+func metadataGet(ctx context.Context, client *http.Client, method, path string, headers map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, metadataHost+path, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata %s: %s", path, resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,270 @@
+// Package lifecycle starts the components of a server in order and, once a
+// shutdown signal arrives, stops them in reverse within a time budget:
+// readiness fails first, in-flight traffic is served for a drain delay,
+// then each priority stops in turn, reporting the hooks that ran out of
+// time.
+package lifecycle
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Hook is how a component takes part in the lifecycle. Every function is
+// optional.
+type Hook struct {
+	Name string
+
+	// Priority orders hooks: lower priorities start first and stop last.
+	// Hooks of equal priority start in the order registered and stop
+	// concurrently.
+	Priority int
+
+	// Timeout bounds Stop. Without one, Stop can use what is left of the
+	// shutdown budget.
+	Timeout time.Duration
+
+	// Start runs at Start, with Context, which ends when shutdown begins.
+	// It must not block.
+	Start func(ctx context.Context) error
+
+	// Drain runs as soon as shutdown begins, before the drain delay, to
+	// fail readiness or refuse new work while requests are still served
+	Drain func()
+
+	// Stop finishes in-flight work, giving up when ctx ends
+	Stop func(ctx context.Context) error
+}
+
+// Options configures a Manager
+type Options struct {
+	// Signals begin shutdown, e.g. os.Interrupt and syscall.SIGTERM. Once
+	// shutdown has begun they are no longer trapped, so a second one ends
+	// the process at once.
+	Signals []os.Signal
+
+	// DrainDelay is how long requests are still served after the Drain
+	// hooks, so load balancers stop routing here before anything stops
+	DrainDelay time.Duration
+
+	// Timeout bounds the Stop hooks altogether (default 10s). It starts
+	// after the drain delay.
+	Timeout time.Duration
+}
+
+// Result is how a hook stopped
+type Result struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+
+	// TimedOut is set when the hook's timeout or the shutdown budget ran
+	// out before Stop returned. Stop may still be running. Hooks reached
+	// once the budget is spent are stopped all the same and time out.
+	TimedOut bool
+}
+
+// Report lists the stopped hooks in the order they stopped
+type Report struct {
+	Hooks []Result
+}
+
+// TimedOut returns the names of the hooks that ran out of time
+func (r Report) TimedOut() []string {
+	var names []string
+	for _, h := range r.Hooks {
+		if h.TimedOut {
+			names = append(names, h.Name)
+		}
+	}
+	return names
+}
+
+// Err joins the errors of the hooks that failed
+func (r Report) Err() error {
+	var errs []error
+	for _, h := range r.Hooks {
+		if h.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.Name, h.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Manager runs the hooks registered with it
+type Manager struct {
+	log    logger.Logger
+	opts   Options
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	hooks []Hook
+}
+
+// New returns a manager whose Context ends when parent does, a signal
+// arrives or Shutdown is called
+func New(parent context.Context, log logger.Logger, opts Options) *Manager {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if len(opts.Signals) > 0 {
+		ctx, cancel = signal.NotifyContext(ctx, opts.Signals...)
+	}
+	ctx, cancelCtx := context.WithCancel(ctx)
+	return &Manager{log: log, opts: opts, ctx: ctx, cancel: func() {
+		cancelCtx()
+		cancel()
+	}}
+}
+
+// Context ends when shutdown begins. Components run until it does.
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Shutdown begins shutdown, as a signal would, for components that decide
+// the server must stop
+func (m *Manager) Shutdown() {
+	m.cancel()
+}
+
+// Register adds a hook. Hooks registered after Start are stopped but not
+// started.
+func (m *Manager) Register(h Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, h)
+}
+
+// Start runs the Start hooks registered so far by priority. When one
+// fails, the hooks already started are stopped and its error returned.
+func (m *Manager) Start() error {
+	m.mu.Lock()
+	hooks := m.ordered()
+	m.mu.Unlock()
+
+	for i, h := range hooks {
+		if h.Start == nil {
+			continue
+		}
+		if err := h.Start(m.ctx); err != nil {
+			m.cancel()
+			m.stop(hooks[:i])
+			return fmt.Errorf("failed to start %s: %w", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// Wait blocks until shutdown begins, then drains and stops every hook and
+// reports how each stopped
+func (m *Manager) Wait() Report {
+	<-m.ctx.Done()
+	m.cancel()
+
+	m.mu.Lock()
+	hooks := m.ordered()
+	m.mu.Unlock()
+
+	for _, h := range slices.Backward(hooks) {
+		if h.Drain != nil {
+			h.Drain()
+		}
+	}
+	if m.opts.DrainDelay > 0 {
+		m.log.Info("Serving in-flight traffic for %v before shutdown", m.opts.DrainDelay)
+		time.Sleep(m.opts.DrainDelay)
+	}
+	return m.stop(hooks)
+}
+
+// ordered returns the hooks in start order. m.mu must be held.
+func (m *Manager) ordered() []Hook {
+	hooks := slices.Clone(m.hooks)
+	slices.SortStableFunc(hooks, func(a, b Hook) int { return cmp.Compare(a.Priority, b.Priority) })
+	return hooks
+}
+
+// stop runs the Stop hooks of hooks, given in start order, from the
+// highest priority down within the shutdown budget
+func (m *Manager) stop(hooks []Hook) Report {
+	m.log.Info("Shutting down, %v allowed", m.opts.Timeout)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), m.opts.Timeout)
+	defer cancel()
+
+	var report Report
+	for end := len(hooks); end > 0; {
+		begin := end - 1
+		for begin > 0 && hooks[begin-1].Priority == hooks[end-1].Priority {
+			begin--
+		}
+		report.Hooks = append(report.Hooks, m.stopAll(ctx, hooks[begin:end])...)
+		end = begin
+	}
+
+	if timedOut := report.TimedOut(); len(timedOut) > 0 {
+		m.log.Warn("Shutdown hooks timed out: %s", strings.Join(timedOut, ", "))
+	}
+	m.log.Info("Shutdown complete in %v", time.Since(start).Round(time.Millisecond))
+	return report
+}
+
+// stopAll stops hooks of the same priority concurrently
+func (m *Manager) stopAll(ctx context.Context, hooks []Hook) []Result {
+	hooks = slices.DeleteFunc(slices.Clone(hooks), func(h Hook) bool { return h.Stop == nil })
+	results := make([]Result, len(hooks))
+	var wg sync.WaitGroup
+	for i, h := range hooks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = m.stopOne(ctx, h)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// stopOne runs a Stop hook, leaving it behind if it outlasts its time
+func (m *Manager) stopOne(ctx context.Context, h Hook) Result {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- h.Stop(ctx) }()
+
+	r := Result{Name: h.Name}
+	select {
+	case r.Err = <-done:
+		r.TimedOut = ctx.Err() != nil
+	case <-ctx.Done():
+		r.TimedOut = true
+	}
+	r.Duration = time.Since(start)
+
+	switch {
+	case r.TimedOut:
+		m.log.Warn("Shutdown hook %s timed out after %v", h.Name, r.Duration.Round(time.Millisecond))
+	case r.Err != nil:
+		m.log.Error("Shutdown hook %s failed: %v", h.Name, r.Err)
+	default:
+		m.log.Debug("Stopped %s in %v", h.Name, r.Duration.Round(time.Millisecond))
+	}
+	return r
+}
@@ -0,0 +1,142 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// recorder records the order hooks run in
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) record(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) hook(name string, priority int) Hook {
+	return Hook{
+		Name:     name,
+		Priority: priority,
+		Start:    func(context.Context) error { r.record("start " + name); return nil },
+		Drain:    func() { r.record("drain " + name) },
+		Stop:     func(context.Context) error { r.record("stop " + name); return nil },
+	}
+}
+
+func TestManager(t *testing.T) {
+	var r recorder
+	m := New(context.Background(), logger.Nop(), Options{})
+	m.Register(r.hook("servers", 2))
+	m.Register(r.hook("store", 0))
+	m.Register(r.hook("queue", 1))
+	m.Register(r.hook("mailer", 1))
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	m.Register(Hook{Name: "late", Priority: 3, Stop: func(context.Context) error { return errors.New("boom") }})
+	if m.Context().Err() != nil {
+		t.Fatal("Context() ended before shutdown")
+	}
+
+	m.Shutdown()
+	report := m.Wait()
+	if m.Context().Err() == nil {
+		t.Error("Context() still running after Shutdown()")
+	}
+
+	want := []string{
+		"start store", "start queue", "start mailer", "start servers",
+		"drain servers", "drain mailer", "drain queue", "drain store",
+		"stop servers",
+	}
+	// Hooks of equal priority stop concurrently
+	if got := r.calls[:len(want)]; !slices.Equal(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+	if got := r.calls[len(want):]; !slices.Equal(got, []string{"stop queue", "stop mailer", "stop store"}) &&
+		!slices.Equal(got, []string{"stop mailer", "stop queue", "stop store"}) {
+		t.Errorf("calls after the servers = %v, want the queue and mailer, then the store", got)
+	}
+
+	var names []string
+	for _, h := range report.Hooks {
+		names = append(names, h.Name)
+	}
+	if !slices.Equal(names, []string{"late", "servers", "queue", "mailer", "store"}) {
+		t.Errorf("report = %v, want hooks in stop order", names)
+	}
+	if err := report.Err(); err == nil || err.Error() != "late: boom" {
+		t.Errorf("report.Err() = %v, want late: boom", err)
+	}
+	if timedOut := report.TimedOut(); len(timedOut) != 0 {
+		t.Errorf("report.TimedOut() = %v, want none", timedOut)
+	}
+}
+
+func TestManagerTimeouts(t *testing.T) {
+	m := New(context.Background(), logger.Nop(), Options{Timeout: 100 * time.Millisecond})
+	hung := make(chan struct{})
+	defer close(hung)
+	m.Register(Hook{Name: "hung", Priority: 2, Stop: func(context.Context) error { <-hung; return nil }})
+	m.Register(Hook{Name: "tracing", Priority: 1, Timeout: 10 * time.Millisecond, Stop: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	m.Register(Hook{Name: "store", Priority: 0, Stop: func(context.Context) error { return nil }})
+
+	m.Shutdown()
+	start := time.Now()
+	report := m.Wait()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Wait() took %v, want it to give up on the hung hook", elapsed)
+	}
+	// The store is still stopped once the budget is spent, to release what
+	// it can, and counts as timed out
+	if got := report.TimedOut(); !slices.Equal(got, []string{"hung", "tracing", "store"}) {
+		t.Errorf("report.TimedOut() = %v, want hung, tracing and store", got)
+	}
+}
+
+func TestManagerDrainDelay(t *testing.T) {
+	var drained, stopped time.Time
+	m := New(context.Background(), logger.Nop(), Options{DrainDelay: 50 * time.Millisecond})
+	m.Register(Hook{
+		Name:  "servers",
+		Drain: func() { drained = time.Now() },
+		Stop:  func(context.Context) error { stopped = time.Now(); return nil },
+	})
+	m.Shutdown()
+	m.Wait()
+	if d := stopped.Sub(drained); d < 50*time.Millisecond {
+		t.Errorf("servers stopped %v after draining, want the drain delay", d)
+	}
+}
+
+func TestManagerStartFailure(t *testing.T) {
+	var r recorder
+	m := New(context.Background(), logger.Nop(), Options{})
+	m.Register(r.hook("store", 0))
+	m.Register(Hook{Name: "queue", Priority: 1, Start: func(context.Context) error { return errors.New("no database") }})
+	m.Register(r.hook("servers", 2))
+
+	err := m.Start()
+	if err == nil || err.Error() != "failed to start queue: no database" {
+		t.Errorf("Start() error = %v, want the queue's error", err)
+	}
+	if !slices.Equal(r.calls, []string{"start store", "stop store"}) {
+		t.Errorf("calls = %v, want the store started and stopped again", r.calls)
+	}
+	if m.Context().Err() == nil {
+		t.Error("Context() still running after a failed start")
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+func TestManagerSignal(t *testing.T) {
+	m := New(context.Background(), logger.Nop(), Options{Signals: []os.Signal{syscall.SIGUSR1}})
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-m.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Context() not done after the signal")
+	}
+	m.Wait()
+}
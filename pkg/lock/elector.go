@@ -0,0 +1,62 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Elector elects a leader per job by holding a lock for it, so each job runs
+// on exactly one replica. It satisfies scheduler.LeaderElector.
+type Elector struct {
+	locker Locker
+	prefix string
+
+	mu   sync.Mutex
+	held map[string]Lock
+}
+
+// NewElector creates an Elector whose lock keys start with prefix
+func NewElector(l Locker, prefix string) *Elector {
+	return &Elector{locker: l, prefix: prefix, held: make(map[string]Lock)}
+}
+
+// IsLeader reports whether this replica leads job, trying to take over
+// leadership if nobody holds it. Leadership is kept until the lock is lost
+// or Close is called.
+func (e *Elector) IsLeader(ctx context.Context, job string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if l, ok := e.held[job]; ok {
+		select {
+		case <-l.Lost():
+			delete(e.held, job)
+		default:
+			return true, nil
+		}
+	}
+
+	l, err := e.locker.TryAcquire(ctx, e.prefix+job)
+	if errors.Is(err, ErrNotAcquired) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	e.held[job] = l
+	return true, nil
+}
+
+// Close gives up leadership of every job
+func (e *Elector) Close(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var errs []error
+	for job, l := range e.held {
+		errs = append(errs, l.Release(ctx))
+		delete(e.held, job)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,79 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// EtcdOptions configures an EtcdLocker
+type EtcdOptions struct {
+	// TTL is how long a lock survives after its holder stops renewing it
+	// (default 30s, rounded to whole seconds)
+	TTL time.Duration
+
+	// Prefix is prepended to lock keys (default "/locks/")
+	Prefix string
+}
+
+// EtcdLocker takes locks using etcd leases, which the client keeps alive
+// until the lock is released
+type EtcdLocker struct {
+	client *clientv3.Client
+	opts   EtcdOptions
+}
+
+// NewEtcdLocker creates an EtcdLocker
+func NewEtcdLocker(client *clientv3.Client, opts EtcdOptions) *EtcdLocker {
+	if opts.TTL < time.Second {
+		opts.TTL = 30 * time.Second
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "/locks/"
+	}
+	return &EtcdLocker{client: client, opts: opts}
+}
+
+// TryAcquire takes the lock for key if it is free
+func (l *EtcdLocker) TryAcquire(ctx context.Context, key string) (Lock, error) {
+	session, err := concurrency.NewSession(l.client,
+		concurrency.WithTTL(int(l.opts.TTL/time.Second)),
+		concurrency.WithContext(context.WithoutCancel(ctx)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mu := concurrency.NewMutex(session, l.opts.Prefix+key)
+	if err := mu.TryLock(ctx); err != nil {
+		session.Close()
+		if errors.Is(err, concurrency.ErrLocked) {
+			return nil, ErrNotAcquired
+		}
+		return nil, err
+	}
+	return &etcdLock{key: key, session: session, mu: mu}, nil
+}
+
+type etcdLock struct {
+	key     string
+	session *concurrency.Session
+	mu      *concurrency.Mutex
+}
+
+func (e *etcdLock) Key() string {
+	return e.key
+}
+
+// Lost fires when the session's lease can no longer be kept alive
+func (e *etcdLock) Lost() <-chan struct{} {
+	return e.session.Done()
+}
+
+func (e *etcdLock) Release(ctx context.Context) error {
+	err := e.mu.Unlock(ctx)
+	return errors.Join(err, e.session.Close())
+}
@@ -0,0 +1,54 @@
+// Package lock provides distributed locks for work that must not run
+// concurrently across replicas.
+package lock
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotAcquired is returned by TryAcquire when the lock is held elsewhere
+var ErrNotAcquired = errors.New("lock: not acquired")
+
+// Locker hands out named locks
+type Locker interface {
+	// TryAcquire takes the lock for key without waiting. It returns
+	// ErrNotAcquired if the lock is held by someone else. The lock is renewed
+	// automatically until released.
+	TryAcquire(ctx context.Context, key string) (Lock, error)
+}
+
+// Lock is a held lock
+type Lock interface {
+	Key() string
+
+	// Lost is closed when renewal failed and the lock may now be held by
+	// someone else. Work protected by the lock should stop.
+	Lost() <-chan struct{}
+
+	// Release gives up the lock and stops renewing it
+	Release(ctx context.Context) error
+}
+
+// Run calls fn while holding the lock for key. fn's context is cancelled if
+// the lock is lost. It returns ErrNotAcquired without calling fn if the lock
+// is held elsewhere.
+func Run(ctx context.Context, l Locker, key string, fn func(ctx context.Context) error) error {
+	held, err := l.TryAcquire(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer held.Release(context.WithoutCancel(ctx))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-held.Lost():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return fn(ctx)
+}
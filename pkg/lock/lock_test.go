@@ -0,0 +1,190 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryLocker(t *testing.T) {
+	testLocker(t, func(t *testing.T) Locker { return NewMemoryLocker() })
+}
+
+func TestRedisLocker(t *testing.T) {
+	testLocker(t, func(t *testing.T) Locker {
+		return NewRedisLocker(redisClients(t, 1), RedisOptions{TTL: time.Second})
+	})
+}
+
+func TestRedisLockerQuorum(t *testing.T) {
+	testLocker(t, func(t *testing.T) Locker {
+		return NewRedisLocker(redisClients(t, 3), RedisOptions{TTL: time.Second})
+	})
+}
+
+func redisClients(t *testing.T, n int) []redis.UniversalClient {
+	t.Helper()
+	var clients []redis.UniversalClient
+	for i := 0; i < n; i++ {
+		mr := miniredis.RunT(t)
+		c := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+		t.Cleanup(func() { c.Close() })
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// testLocker checks the behavior every Locker must share
+func testLocker(t *testing.T, newLocker func(t *testing.T) Locker) {
+	ctx := context.Background()
+
+	t.Run("exclusive", func(t *testing.T) {
+		l := newLocker(t)
+		held, err := l.TryAcquire(ctx, "job")
+		if err != nil {
+			t.Fatalf("TryAcquire() unexpected error: %v", err)
+		}
+		if held.Key() != "job" {
+			t.Errorf("Key() = %q, want job", held.Key())
+		}
+		if _, err := l.TryAcquire(ctx, "job"); !errors.Is(err, ErrNotAcquired) {
+			t.Errorf("TryAcquire() while held error = %v, want %v", err, ErrNotAcquired)
+		}
+		other, err := l.TryAcquire(ctx, "other")
+		if err != nil {
+			t.Fatalf("TryAcquire() other key unexpected error: %v", err)
+		}
+		other.Release(ctx)
+
+		if err := held.Release(ctx); err != nil {
+			t.Fatalf("Release() unexpected error: %v", err)
+		}
+		again, err := l.TryAcquire(ctx, "job")
+		if err != nil {
+			t.Fatalf("TryAcquire() after release unexpected error: %v", err)
+		}
+		again.Release(ctx)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		l := newLocker(t)
+		err := Run(ctx, l, "job", func(ctx context.Context) error {
+			if err := Run(ctx, l, "job", func(context.Context) error { return nil }); !errors.Is(err, ErrNotAcquired) {
+				t.Errorf("nested Run() error = %v, want %v", err, ErrNotAcquired)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		if err := Run(ctx, l, "job", func(context.Context) error { return nil }); err != nil {
+			t.Errorf("Run() after release unexpected error: %v", err)
+		}
+	})
+}
+
+func TestRedisLockerMinorityDown(t *testing.T) {
+	ctx := context.Background()
+	mrs := []*miniredis.Miniredis{miniredis.RunT(t), miniredis.RunT(t), miniredis.RunT(t)}
+	var clients []redis.UniversalClient
+	for _, mr := range mrs {
+		c := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+		t.Cleanup(func() { c.Close() })
+		clients = append(clients, c)
+	}
+	l := NewRedisLocker(clients, RedisOptions{TTL: time.Second})
+
+	mrs[0].Close()
+	held, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire() with 2/3 nodes unexpected error: %v", err)
+	}
+	held.Release(ctx)
+
+	mrs[1].Close()
+	if _, err := l.TryAcquire(ctx, "job"); err == nil {
+		t.Errorf("TryAcquire() with 1/3 nodes expected error")
+	}
+}
+
+func TestRedisLockRenewalAndLoss(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	c := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { c.Close() })
+	l := NewRedisLocker([]redis.UniversalClient{c}, RedisOptions{TTL: 30 * time.Millisecond})
+
+	held, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire() unexpected error: %v", err)
+	}
+
+	// Renewal keeps the key alive well past its TTL
+	time.Sleep(100 * time.Millisecond)
+	if !mr.Exists("lock:job") {
+		t.Fatal("lock expired despite renewal")
+	}
+
+	// Someone else taking the key means we lost it
+	mr.Set("lock:job", "someone-else")
+	select {
+	case <-held.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost() did not fire")
+	}
+	held.Release(ctx)
+	if got, _ := mr.Get("lock:job"); got != "someone-else" {
+		t.Errorf("Release() removed a lock held by someone else")
+	}
+}
+
+func TestMetered(t *testing.T) {
+	ctx := context.Background()
+	m := WithMetrics(NewMemoryLocker(), nil)
+
+	held, _ := m.TryAcquire(ctx, "a")
+	m.TryAcquire(ctx, "a")
+	if got := m.HeldSince(); len(got) != 1 || got["a"].IsZero() {
+		t.Errorf("HeldSince() = %v, want a", got)
+	}
+	held.Release(ctx)
+	held.Release(ctx)
+
+	stats := m.Stats()
+	if stats.Held != 0 || stats.Acquired != 1 || stats.Contended != 1 || stats.Released != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestElector(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	a := NewElector(locker, "scheduler/")
+	b := NewElector(locker, "scheduler/")
+
+	for _, tt := range []struct {
+		elector *Elector
+		job     string
+		want    bool
+	}{
+		{a, "cleanup", true},
+		{b, "cleanup", false},
+		{a, "cleanup", true},
+		{b, "report", true},
+		{a, "report", false},
+	} {
+		got, err := tt.elector.IsLeader(ctx, tt.job)
+		if err != nil || got != tt.want {
+			t.Errorf("IsLeader(%s) = %v, %v, want %v", tt.job, got, err, tt.want)
+		}
+	}
+
+	a.Close(ctx)
+	if got, _ := b.IsLeader(ctx, "cleanup"); !got {
+		t.Errorf("IsLeader() after the leader closed = false, want true")
+	}
+}
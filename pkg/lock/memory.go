@@ -0,0 +1,56 @@
+package lock
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryLocker is an in-process Locker. It only excludes holders within the
+// same process, so use it for single-replica deployments and tests.
+type MemoryLocker struct {
+	mu   sync.Mutex
+	held map[string]*memoryLock
+}
+
+// NewMemoryLocker creates a MemoryLocker
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{held: make(map[string]*memoryLock)}
+}
+
+// TryAcquire takes the lock for key if it is free
+func (l *MemoryLocker) TryAcquire(ctx context.Context, key string) (Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.held[key]; ok {
+		return nil, ErrNotAcquired
+	}
+	m := &memoryLock{locker: l, key: key, lost: make(chan struct{})}
+	l.held[key] = m
+	return m, nil
+}
+
+type memoryLock struct {
+	locker *MemoryLocker
+	key    string
+	lost   chan struct{}
+}
+
+func (m *memoryLock) Key() string {
+	return m.key
+}
+
+// Lost never fires, an in-process lock cannot expire
+func (m *memoryLock) Lost() <-chan struct{} {
+	return m.lost
+}
+
+func (m *memoryLock) Release(ctx context.Context) error {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+
+	if m.locker.held[m.key] == m {
+		delete(m.locker.held, m.key)
+	}
+	return nil
+}
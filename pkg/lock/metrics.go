@@ -0,0 +1,123 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+)
+
+// Stats is a snapshot of lock activity
+type Stats struct {
+	// Held is the number of locks currently held
+	Held int
+
+	Acquired  uint64
+	Contended uint64
+	Lost      uint64
+	Released  uint64
+
+	// HeldDuration is the total time released or lost locks were held
+	HeldDuration time.Duration
+}
+
+// Metered wraps a Locker and records lock-held metrics
+type Metered struct {
+	locker Locker
+	clock  clock.Clock
+
+	mu    sync.Mutex
+	held  map[*meteredLock]time.Time
+	stats Stats
+}
+
+// WithMetrics wraps l so its activity is reported by Stats and HeldSince
+func WithMetrics(l Locker, c clock.Clock) *Metered {
+	if c == nil {
+		c = clock.Real()
+	}
+	return &Metered{locker: l, clock: c, held: make(map[*meteredLock]time.Time)}
+}
+
+// TryAcquire takes the lock through the wrapped Locker
+func (m *Metered) TryAcquire(ctx context.Context, key string) (Lock, error) {
+	l, err := m.locker.TryAcquire(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotAcquired) {
+			m.mu.Lock()
+			m.stats.Contended++
+			m.mu.Unlock()
+		}
+		return nil, err
+	}
+
+	ml := &meteredLock{Lock: l, metered: m, done: make(chan struct{})}
+	m.mu.Lock()
+	m.held[ml] = m.clock.Now()
+	m.stats.Acquired++
+	m.mu.Unlock()
+
+	go func() {
+		select {
+		case <-l.Lost():
+			m.finish(ml, true)
+		case <-ml.done:
+		}
+	}()
+	return ml, nil
+}
+
+// Stats returns a snapshot of lock activity
+func (m *Metered) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stats
+	s.Held = len(m.held)
+	return s
+}
+
+// HeldSince returns the keys of held locks and when each was acquired
+func (m *Metered) HeldSince() map[string]time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	held := make(map[string]time.Time, len(m.held))
+	for l, since := range m.held {
+		held[l.Key()] = since
+	}
+	return held
+}
+
+// finish records the end of a hold, once per lock
+func (m *Metered) finish(l *meteredLock, lost bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	since, ok := m.held[l]
+	if !ok {
+		return
+	}
+	delete(m.held, l)
+	m.stats.HeldDuration += m.clock.Now().Sub(since)
+	if lost {
+		m.stats.Lost++
+	} else {
+		m.stats.Released++
+	}
+}
+
+type meteredLock struct {
+	Lock
+	metered  *Metered
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func (l *meteredLock) Release(ctx context.Context) error {
+	l.doneOnce.Do(func() { close(l.done) })
+	l.metered.finish(l, false)
+	return l.Lock.Release(ctx)
+}
@@ -0,0 +1,187 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// extendScript renews the lock only if it still holds our token
+var extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lock only if it still holds our token
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisOptions configures a RedisLocker
+type RedisOptions struct {
+	// TTL is how long a lock survives without renewal (default 30s). Locks
+	// are renewed every TTL/3.
+	TTL time.Duration
+
+	// Prefix is prepended to lock keys (default "lock:")
+	Prefix string
+}
+
+// RedisLocker implements the Redlock algorithm: a lock is held when it was
+// set on a majority of independent Redis nodes within its TTL. With a single
+// client it degrades to a plain SET NX lock.
+type RedisLocker struct {
+	clients []redis.UniversalClient
+	opts    RedisOptions
+}
+
+// NewRedisLocker creates a RedisLocker over independent Redis nodes
+func NewRedisLocker(clients []redis.UniversalClient, opts RedisOptions) *RedisLocker {
+	if opts.TTL <= 0 {
+		opts.TTL = 30 * time.Second
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "lock:"
+	}
+	return &RedisLocker{clients: clients, opts: opts}
+}
+
+func (l *RedisLocker) quorum() int {
+	return len(l.clients)/2 + 1
+}
+
+// TryAcquire takes the lock for key on a majority of nodes
+func (l *RedisLocker) TryAcquire(ctx context.Context, key string) (Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	redisKey := l.opts.Prefix + key
+
+	start := time.Now()
+	var acquired int
+	var lastErr error
+	for _, c := range l.clients {
+		ok, err := c.SetNX(ctx, redisKey, token, l.opts.TTL).Result()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ok {
+			acquired++
+		}
+	}
+
+	// Allow for clock drift between nodes as the Redlock paper suggests
+	drift := l.opts.TTL/100 + 2*time.Millisecond
+	validity := l.opts.TTL - time.Since(start) - drift
+	if acquired < l.quorum() || validity <= 0 {
+		l.release(context.WithoutCancel(ctx), redisKey, token)
+		if lastErr != nil && acquired == 0 {
+			return nil, lastErr
+		}
+		return nil, ErrNotAcquired
+	}
+
+	r := &redisLock{
+		locker: l,
+		key:    key,
+		rkey:   redisKey,
+		token:  token,
+		lost:   make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.renew()
+	return r, nil
+}
+
+// extend renews the lock on every node and reports whether a majority still
+// holds it
+func (l *RedisLocker) extend(ctx context.Context, key, token string) bool {
+	var extended int
+	for _, c := range l.clients {
+		n, err := extendScript.Run(ctx, c, []string{key}, token, l.opts.TTL.Milliseconds()).Int()
+		if err == nil && n == 1 {
+			extended++
+		}
+	}
+	return extended >= l.quorum()
+}
+
+func (l *RedisLocker) release(ctx context.Context, key, token string) error {
+	var errs []error
+	for _, c := range l.clients {
+		if err := releaseScript.Run(ctx, c, []string{key}, token).Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type redisLock struct {
+	locker *RedisLocker
+	key    string
+	rkey   string
+	token  string
+
+	lost     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func (r *redisLock) Key() string {
+	return r.key
+}
+
+func (r *redisLock) Lost() <-chan struct{} {
+	return r.lost
+}
+
+func (r *redisLock) Release(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	r.wg.Wait()
+	return r.locker.release(ctx, r.rkey, r.token)
+}
+
+func (r *redisLock) renew() {
+	defer r.wg.Done()
+
+	interval := r.locker.opts.TTL / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			ok := r.locker.extend(ctx, r.rkey, r.token)
+			cancel()
+			if !ok {
+				close(r.lost)
+				return
+			}
+		}
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,120 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// EventLogger writes to the Windows event log, for processes running as a
+// service where standard output goes nowhere. Debug messages are written
+// as information events.
+type EventLogger struct {
+	level atomic.Int32
+	log   *eventlog.Log
+}
+
+// NewEventLogger opens the event log for source, usually the service name.
+// Without a registered source, events are still written but Event Viewer
+// shows them with a generic message prefix.
+func NewEventLogger(source string) (*EventLogger, error) {
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("open event log %q: %w", source, err)
+	}
+	return &EventLogger{log: l}, nil
+}
+
+// Close closes the event log
+func (l *EventLogger) Close() error {
+	return l.log.Close()
+}
+
+// Level returns the minimum level written
+func (l *EventLogger) Level() Level {
+	return Level(l.level.Load())
+}
+
+// SetLevel changes the minimum level written
+func (l *EventLogger) SetLevel(level Level) {
+	l.level.Store(int32(level))
+}
+
+// Event IDs, one per level, for filtering in Event Viewer
+const (
+	eventDebug uint32 = 1 + iota
+	eventInfo
+	eventWarn
+	eventError
+)
+
+// Info logs an info message
+func (l *EventLogger) Info(msg string, args ...interface{}) {
+	if l.Level() <= LevelInfo {
+		l.log.Info(eventInfo, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Error logs an error message
+func (l *EventLogger) Error(msg string, args ...interface{}) {
+	if l.Level() <= LevelError {
+		l.log.Error(eventError, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Debug logs a debug message
+func (l *EventLogger) Debug(msg string, args ...interface{}) {
+	if l.Level() <= LevelDebug {
+		l.log.Info(eventDebug, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Warn logs a warning message
+func (l *EventLogger) Warn(msg string, args ...interface{}) {
+	if l.Level() <= LevelWarn {
+		l.log.Warning(eventWarn, fmt.Sprintf(msg, args...))
+	}
+}
+
+// WithFields returns a logger appending fields to every message as
+// key=value, since the event log takes plain text
+func (l *EventLogger) WithFields(fields Fields) Logger {
+	return &eventFieldLogger{EventLogger: l, suffix: formatFields(fields)}
+}
+
+// eventFieldLogger is an EventLogger with fields
+type eventFieldLogger struct {
+	*EventLogger
+	suffix string
+}
+
+func (l *eventFieldLogger) Info(msg string, args ...interface{}) {
+	l.EventLogger.Info("%s%s", fmt.Sprintf(msg, args...), l.suffix)
+}
+
+func (l *eventFieldLogger) Error(msg string, args ...interface{}) {
+	l.EventLogger.Error("%s%s", fmt.Sprintf(msg, args...), l.suffix)
+}
+
+func (l *eventFieldLogger) Debug(msg string, args ...interface{}) {
+	l.EventLogger.Debug("%s%s", fmt.Sprintf(msg, args...), l.suffix)
+}
+
+func (l *eventFieldLogger) Warn(msg string, args ...interface{}) {
+	l.EventLogger.Warn("%s%s", fmt.Sprintf(msg, args...), l.suffix)
+}
+
+func (l *eventFieldLogger) WithFields(fields Fields) Logger {
+	return &eventFieldLogger{EventLogger: l.EventLogger, suffix: l.suffix + formatFields(fields)}
+}
+
+// formatFields formats fields as " key=value" pairs
+func formatFields(fields Fields) string {
+	var b strings.Builder
+	for _, k := range fields.keys() {
+		fmt.Fprintf(&b, " %s=%v", k, fields[k])
+	}
+	return b.String()
+}
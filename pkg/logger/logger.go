@@ -1,8 +1,10 @@
 package logger
 
 import (
-	"log"
-	"os"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
 )
 
 // Logger interface
@@ -11,42 +13,102 @@ type Logger interface {
 	Error(msg string, args ...interface{})
 	Debug(msg string, args ...interface{})
 	Warn(msg string, args ...interface{})
+
+	// WithFields returns a logger adding fields to every entry, after the
+	// fields of this logger
+	WithFields(fields Fields) Logger
+}
+
+// Fields are the contextual key-value pairs of log entries, such as the
+// RPC method a request logger logs for
+type Fields map[string]interface{}
+
+// keys returns the field names, sorted so entries list them in a stable
+// order
+func (f Fields) keys() []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
-// SimpleLogger is a simple logger implementation
-type SimpleLogger struct {
-	infoLog  *log.Logger
-	errorLog *log.Logger
-	debugLog *log.Logger
-	warnLog  *log.Logger
+// Level is the minimum severity a logger writes
+type Level int32
+
+// Levels in increasing severity
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the level's name
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("Level(%d)", l)
+	}
+	return levelNames[l]
 }
 
-// NewLogger creates a new logger
-func NewLogger() Logger {
-	return &SimpleLogger{
-		infoLog:  log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
-		errorLog: log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile),
-		debugLog: log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile),
-		warnLog:  log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime|log.Lshortfile),
+// ParseLevel parses a level name: debug, info, warn or error
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
 	}
+	return 0, fmt.Errorf("unknown log level %q", s)
 }
 
-// Info logs an info message
-func (l *SimpleLogger) Info(msg string, args ...interface{}) {
-	l.infoLog.Printf(msg, args...)
+// Leveled is a logger whose level can change at runtime
+type Leveled interface {
+	Level() Level
+	SetLevel(level Level)
 }
 
-// Error logs an error message
-func (l *SimpleLogger) Error(msg string, args ...interface{}) {
-	l.errorLog.Printf(msg, args...)
+// Output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Formatted is a logger whose output format can change at runtime
+type Formatted interface {
+	SetFormat(format string) error
 }
 
-// Debug logs a debug message
-func (l *SimpleLogger) Debug(msg string, args ...interface{}) {
-	l.debugLog.Printf(msg, args...)
+type contextKey struct{}
+
+// WithContext returns a copy of ctx carrying l, so code handling a request
+// logs with the request's fields
+func WithContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
 }
 
-// Warn logs a warning message
-func (l *SimpleLogger) Warn(msg string, args ...interface{}) {
-	l.warnLog.Printf(msg, args...)
+// FromContext returns the logger in ctx, or one discarding everything
+func FromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return l
+	}
+	return Nop()
 }
+
+// nopLogger discards all log output
+type nopLogger struct{}
+
+// Nop returns a logger that discards everything. Packages that cannot import
+// testutil use it to keep test output clean.
+func Nop() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (l nopLogger) WithFields(Fields) Logger            { return l }
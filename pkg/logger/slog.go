@@ -0,0 +1,166 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// SlogLogger writes leveled entries with log/slog, as JSON or as text.
+// Errors go to their own writer, stderr by default. Loggers made with
+// WithFields share the level and format of the logger they came from.
+type SlogLogger struct {
+	state *slogState
+	attrs []slog.Attr
+}
+
+// slogState is what a logger and the loggers made from it share
+type slogState struct {
+	level    slog.LevelVar
+	out, err io.Writer
+	handlers atomic.Pointer[slogHandlers]
+}
+
+// slogHandlers write entries below and at error level
+type slogHandlers struct {
+	out, err slog.Handler
+}
+
+// NewLogger creates a logger writing every level as text to stdout, and
+// errors to stderr
+func NewLogger() Logger {
+	l, _ := New(os.Stdout, os.Stderr, FormatText)
+	return l
+}
+
+// New creates a logger writing every level in format to out, and errors to
+// errOut
+func New(out, errOut io.Writer, format string) (*SlogLogger, error) {
+	l := &SlogLogger{state: &slogState{out: out, err: errOut}}
+	l.state.level.Set(slog.LevelDebug)
+	if err := l.SetFormat(format); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetFormat switches the output to json or text. It is safe to call while
+// logging.
+func (l *SlogLogger) SetFormat(format string) error {
+	opts := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       &l.state.level,
+		ReplaceAttr: shortSource,
+	}
+	var hs slogHandlers
+	switch format {
+	case FormatJSON:
+		hs.out, hs.err = slog.NewJSONHandler(l.state.out, opts), slog.NewJSONHandler(l.state.err, opts)
+	case FormatText:
+		hs.out, hs.err = slog.NewTextHandler(l.state.out, opts), slog.NewTextHandler(l.state.err, opts)
+	default:
+		return fmt.Errorf("unknown log format %q, expected json or text", format)
+	}
+	l.state.handlers.Store(&hs)
+	return nil
+}
+
+// Level returns the minimum level written
+func (l *SlogLogger) Level() Level {
+	switch level := l.state.level.Level(); {
+	case level <= slog.LevelDebug:
+		return LevelDebug
+	case level <= slog.LevelInfo:
+		return LevelInfo
+	case level <= slog.LevelWarn:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+// SetLevel changes the minimum level written. It is safe to call while
+// logging.
+func (l *SlogLogger) SetLevel(level Level) {
+	l.state.level.Set(slogLevel(level))
+}
+
+// WithFields returns a logger adding fields to every entry
+func (l *SlogLogger) WithFields(fields Fields) Logger {
+	attrs := make([]slog.Attr, len(l.attrs), len(l.attrs)+len(fields))
+	copy(attrs, l.attrs)
+	for _, k := range fields.keys() {
+		attrs = append(attrs, slog.Any(k, fields[k]))
+	}
+	return &SlogLogger{state: l.state, attrs: attrs}
+}
+
+// Info logs an info message
+func (l *SlogLogger) Info(msg string, args ...interface{}) {
+	l.log(slog.LevelInfo, msg, args)
+}
+
+// Error logs an error message
+func (l *SlogLogger) Error(msg string, args ...interface{}) {
+	l.log(slog.LevelError, msg, args)
+}
+
+// Debug logs a debug message
+func (l *SlogLogger) Debug(msg string, args ...interface{}) {
+	l.log(slog.LevelDebug, msg, args)
+}
+
+// Warn logs a warning message
+func (l *SlogLogger) Warn(msg string, args ...interface{}) {
+	l.log(slog.LevelWarn, msg, args)
+}
+
+// log writes an entry attributed to the caller of Info, Error, Debug or
+// Warn
+func (l *SlogLogger) log(level slog.Level, msg string, args []interface{}) {
+	if level < l.state.level.Level() {
+		return
+	}
+	hs := l.state.handlers.Load()
+	h := hs.out
+	if level >= slog.LevelError {
+		h = hs.err
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // skip Callers, log and the level method
+	r := slog.NewRecord(time.Now(), level, fmt.Sprintf(msg, args...), pcs[0])
+	r.AddAttrs(l.attrs...)
+	_ = h.Handle(context.Background(), r)
+}
+
+// slogLevel returns the slog level of level
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// shortSource writes the source of entries as file:line, without the
+// directory
+func shortSource(groups []string, a slog.Attr) slog.Attr {
+	if a.Key != slog.SourceKey || len(groups) > 0 {
+		return a
+	}
+	if src, ok := a.Value.Any().(*slog.Source); ok {
+		a.Value = slog.StringValue(fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+	}
+	return a
+}
@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSlogLoggerJSON(t *testing.T) {
+	var out, errOut bytes.Buffer
+	l, err := New(&out, &errOut, FormatJSON)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+
+	l.WithFields(Fields{"method": "/api.v1.UserService/GetUser"}).
+		WithFields(Fields{"attempt": 2}).
+		Info("served %s", "users/1")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("entry %q is not JSON: %v", out.String(), err)
+	}
+	want := map[string]interface{}{
+		"level":   "INFO",
+		"msg":     "served users/1",
+		"method":  "/api.v1.UserService/GetUser",
+		"attempt": float64(2),
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("entry[%q] = %v, want %v", k, entry[k], v)
+		}
+	}
+	if src, _ := entry["source"].(string); !strings.HasPrefix(src, "slog_test.go:") {
+		t.Errorf("entry source = %q, want the caller's file:line", entry["source"])
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("info entry written to the error output: %q", errOut.String())
+	}
+
+	l.Error("failed")
+	if !strings.Contains(errOut.String(), `"level":"ERROR"`) {
+		t.Errorf("error output = %q, want the error entry", errOut.String())
+	}
+}
+
+func TestSlogLoggerLevel(t *testing.T) {
+	var out bytes.Buffer
+	l, err := New(&out, &out, FormatText)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	child := l.WithFields(Fields{"component": "worker"})
+
+	l.SetLevel(LevelWarn)
+	if l.Level() != LevelWarn {
+		t.Errorf("Level() = %v, want warn", l.Level())
+	}
+	child.Debug("hidden")
+	child.Info("hidden")
+	child.Warn("shown")
+	if strings.Contains(out.String(), "hidden") {
+		t.Errorf("output %q has entries below the level", out.String())
+	}
+	if !strings.Contains(out.String(), "msg=shown component=worker") {
+		t.Errorf("output %q, want the warning with its fields", out.String())
+	}
+}
+
+func TestSlogLoggerFormat(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, &bytes.Buffer{}, "xml"); err == nil {
+		t.Error("New() with an unknown format expected error")
+	}
+}
+
+func TestContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()).(nopLogger); !ok {
+		t.Error("FromContext() without a logger, want the nop logger")
+	}
+
+	var out bytes.Buffer
+	l, _ := New(&out, &out, FormatText)
+	ctx := WithContext(context.Background(), l.WithFields(Fields{"request_id": "r1"}))
+	FromContext(ctx).Info("handled")
+	if !strings.Contains(out.String(), "request_id=r1") {
+		t.Errorf("output %q, want the context logger's fields", out.String())
+	}
+}
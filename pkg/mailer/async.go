@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+)
+
+// TaskSendEmail is the job kind used for queued email
+const TaskSendEmail = "email.send"
+
+// Async queues messages as jobs and sends them with the wrapped Mailer, so
+// callers do not wait on SMTP and failed sends are retried with backoff
+type Async struct {
+	queue  *queue.Queue
+	mailer Mailer
+}
+
+// NewAsync creates an Async mailer and registers its handler on q. Call it
+// before q.Start.
+func NewAsync(q *queue.Queue, m Mailer) *Async {
+	a := &Async{queue: q, mailer: m}
+	q.Register(TaskSendEmail, a.handle)
+	return a
+}
+
+// Send validates msg and queues it for delivery
+func (a *Async) Send(ctx context.Context, msg *Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	_, err := a.queue.Enqueue(ctx, TaskSendEmail, msg)
+	return err
+}
+
+func (a *Async) handle(ctx context.Context, job *queue.Job) error {
+	var msg Message
+	if err := job.Decode(&msg); err != nil {
+		return err
+	}
+	return a.mailer.Send(ctx, &msg)
+}
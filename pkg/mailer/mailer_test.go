@@ -0,0 +1,337 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+)
+
+// smtpServer is a minimal SMTP server that records delivered messages
+type smtpServer struct {
+	ln    net.Listener
+	conns atomic.Int64
+
+	mu       sync.Mutex
+	auth     []string
+	messages []string
+	rcpts    [][]string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &smtpServer{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.conns.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	var rcpts []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		switch verb := strings.ToUpper(strings.SplitN(cmd, " ", 2)[0]); verb {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			s.mu.Lock()
+			s.auth = append(s.auth, cmd)
+			s.mu.Unlock()
+			reply("235 Authenticated")
+		case "MAIL", "NOOP":
+			reply("250 OK")
+		case "RSET":
+			rcpts = nil
+			reply("250 OK")
+		case "RCPT":
+			rcpts = append(rcpts, cmd)
+			reply("250 OK")
+		case "DATA":
+			reply("354 Go ahead")
+			var body strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				body.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, body.String())
+			s.rcpts = append(s.rcpts, rcpts)
+			s.mu.Unlock()
+			rcpts = nil
+			reply("250 Queued")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Unknown command")
+		}
+	}
+}
+
+func (s *smtpServer) delivered() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func newTestMailer(t *testing.T, s *smtpServer) *SMTPMailer {
+	t.Helper()
+	m, err := NewSMTPMailer(SMTPConfig{
+		Host:     "localhost",
+		Port:     s.port(),
+		Username: "app",
+		Password: "secret",
+		From:     "noreply@example.com",
+		TLS:      TLSNone,
+		Timeout:  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() unexpected error: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestMessageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     Message
+		wantErr bool
+	}{
+		{"valid", Message{To: []string{"alice@example.com"}, Text: "hi"}, false},
+		{"named address", Message{To: []string{"Alice <alice@example.com>"}, HTML: "<p>hi</p>"}, false},
+		{"no recipients", Message{Text: "hi"}, true},
+		{"bad recipient", Message{To: []string{"not-an-address"}, Text: "hi"}, true},
+		{"bad sender", Message{From: "nope", To: []string{"alice@example.com"}, Text: "hi"}, true},
+		{"no body", Message{To: []string{"alice@example.com"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.msg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("text only", func(t *testing.T) {
+		body, err := encode(&Message{
+			From:    "noreply@example.com",
+			To:      []string{"alice@example.com"},
+			Subject: "Héllo",
+			Text:    "plain body",
+			Headers: map[string]string{"X-Request-Id": "abc"},
+		}, now)
+		if err != nil {
+			t.Fatalf("encode() unexpected error: %v", err)
+		}
+		got := string(body)
+		for _, want := range []string{
+			"Date: Tue, 02 Jan 2024 03:04:05 +0000\r\n",
+			"Subject: =?utf-8?q?H=C3=A9llo?=\r\n",
+			"X-Request-Id: abc\r\n",
+			"Content-Type: text/plain; charset=utf-8\r\n",
+			"plain body",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("encode() missing %q in:\n%s", want, got)
+			}
+		}
+		if strings.Contains(got, "multipart") {
+			t.Errorf("encode() text-only message is multipart:\n%s", got)
+		}
+	})
+
+	t.Run("alternative", func(t *testing.T) {
+		body, err := encode(&Message{
+			From: "noreply@example.com",
+			To:   []string{"alice@example.com"},
+			Text: "plain body",
+			HTML: "<p>html body</p>",
+		}, now)
+		if err != nil {
+			t.Fatalf("encode() unexpected error: %v", err)
+		}
+		got := string(body)
+		text := strings.Index(got, "text/plain")
+		html := strings.Index(got, "text/html")
+		if !strings.Contains(got, "multipart/alternative") || text < 0 || html < text {
+			t.Errorf("encode() want multipart/alternative with text before html, got:\n%s", got)
+		}
+	})
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	s := newSMTPServer(t)
+	m := newTestMailer(t, s)
+
+	err := m.Send(context.Background(), &Message{
+		To:      []string{"Alice <alice@example.com>", "bob@example.com"},
+		Subject: "Welcome",
+		Text:    "Hello there",
+	})
+	if err != nil {
+		t.Fatalf("Send() unexpected error: %v", err)
+	}
+
+	msgs := s.delivered()
+	if len(msgs) != 1 {
+		t.Fatalf("delivered %d messages, want 1", len(msgs))
+	}
+	if !strings.Contains(msgs[0], "From: noreply@example.com") || !strings.Contains(msgs[0], "Hello there") {
+		t.Errorf("delivered message = %q, want default sender and body", msgs[0])
+	}
+	s.mu.Lock()
+	rcpts, auth := s.rcpts[0], s.auth
+	s.mu.Unlock()
+	if len(rcpts) != 2 || !strings.Contains(rcpts[0], "<alice@example.com>") {
+		t.Errorf("RCPT commands = %v, want both bare addresses", rcpts)
+	}
+	if len(auth) != 1 {
+		t.Errorf("AUTH commands = %v, want 1", auth)
+	}
+
+	if err := m.Send(context.Background(), &Message{To: []string{"alice@example.com"}}); err == nil {
+		t.Error("Send() without a body error = nil, want error")
+	}
+}
+
+func TestSMTPMailerReusesConnections(t *testing.T) {
+	s := newSMTPServer(t)
+	m := newTestMailer(t, s)
+
+	for i := 0; i < 5; i++ {
+		err := m.Send(context.Background(), &Message{To: []string{"alice@example.com"}, Text: "hi"})
+		if err != nil {
+			t.Fatalf("Send() unexpected error: %v", err)
+		}
+	}
+	if got := len(s.delivered()); got != 5 {
+		t.Errorf("delivered %d messages, want 5", got)
+	}
+	if got := s.conns.Load(); got != 1 {
+		t.Errorf("opened %d connections, want 1", got)
+	}
+}
+
+func TestNewSMTPMailerValidatesConfig(t *testing.T) {
+	if _, err := NewSMTPMailer(SMTPConfig{}); err == nil {
+		t.Error("NewSMTPMailer() without host error = nil, want error")
+	}
+	if _, err := NewSMTPMailer(SMTPConfig{Host: "localhost", TLS: "ssl3"}); err == nil {
+		t.Error("NewSMTPMailer() with unknown tls mode error = nil, want error")
+	}
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	tmpl := DefaultTemplates()
+	data := map[string]string{
+		"DisplayName": "<Alice>",
+		"Link":        "https://example.com/verify?token=abc",
+		"ExpiresIn":   "1 hour",
+	}
+
+	for _, name := range []string{TemplateVerifyEmail, TemplatePasswordReset} {
+		t.Run(name, func(t *testing.T) {
+			msg, err := tmpl.Render(name, data)
+			if err != nil {
+				t.Fatalf("Render() unexpected error: %v", err)
+			}
+			if msg.Subject == "" || strings.Contains(msg.Subject, "\n") {
+				t.Errorf("Subject = %q, want a single line", msg.Subject)
+			}
+			if !strings.Contains(msg.Text, "Hi <Alice>,") {
+				t.Errorf("Text = %q, want unescaped display name", msg.Text)
+			}
+			if !strings.Contains(msg.HTML, "Hi &lt;Alice&gt;,") {
+				t.Errorf("HTML = %q, want escaped display name", msg.HTML)
+			}
+			if !strings.Contains(msg.HTML, `href="https://example.com/verify?token=abc"`) {
+				t.Errorf("HTML = %q, want link", msg.HTML)
+			}
+		})
+	}
+
+	if _, err := tmpl.Render("missing", data); err == nil {
+		t.Error("Render() unknown template error = nil, want error")
+	}
+}
+
+func TestAsyncSendsThroughQueue(t *testing.T) {
+	s := newSMTPServer(t)
+	m := newTestMailer(t, s)
+
+	q := queue.New(queue.NewMemoryStore(), logger.Nop(), queue.Options{
+		Workers:      1,
+		PollInterval: time.Millisecond,
+		IDs:          idgen.NewSequential(),
+	})
+	async := NewAsync(q, m)
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	if err := async.Send(context.Background(), &Message{To: []string{"alice@example.com"}}); err == nil {
+		t.Error("Send() invalid message error = nil, want error")
+	}
+	if err := async.Send(context.Background(), &Message{To: []string{"alice@example.com"}, Text: "queued"}); err != nil {
+		t.Fatalf("Send() unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.delivered()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("queued message was not delivered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := s.delivered()[0]; !strings.Contains(got, "queued") {
+		t.Errorf("delivered message = %q, want queued body", got)
+	}
+}
@@ -0,0 +1,235 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+)
+
+// TLS modes
+const (
+	// TLSStartTLS upgrades a plain connection with STARTTLS (port 587)
+	TLSStartTLS = "starttls"
+
+	// TLSImplicit connects over TLS from the start (port 465)
+	TLSImplicit = "tls"
+
+	// TLSNone sends in the clear, for local relays and tests only
+	TLSNone = "none"
+)
+
+// SMTPConfig configures an SMTPMailer
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	// From is the default sender address
+	From string
+
+	// TLS is one of TLSStartTLS (default), TLSImplicit or TLSNone
+	TLS string
+
+	// PoolSize is the number of idle connections kept open (default 2)
+	PoolSize int
+
+	// Timeout bounds dialing and each message (default 10s)
+	Timeout time.Duration
+
+	// Clock stamps the Date header, defaults to the real clock
+	Clock clock.Clock
+}
+
+// SMTPMailer sends email over SMTP, reusing connections between messages
+type SMTPMailer struct {
+	cfg  SMTPConfig
+	idle chan *smtpConn
+}
+
+// smtpConn keeps the raw connection next to the client so deadlines can be
+// set per message
+type smtpConn struct {
+	*smtp.Client
+	conn net.Conn
+}
+
+// NewSMTPMailer creates an SMTPMailer. Connections are opened lazily.
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("mailer: smtp host is required")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = TLSStartTLS
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("mailer: unknown tls mode %q", cfg.TLS)
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 2
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clock.Real()
+	}
+	return &SMTPMailer{cfg: cfg, idle: make(chan *smtpConn, cfg.PoolSize)}, nil
+}
+
+// Send delivers msg
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	if msg.From == "" {
+		c := *msg
+		c.From = m.cfg.From
+		msg = &c
+	}
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	body, err := encode(msg, m.cfg.Clock.Now())
+	if err != nil {
+		return err
+	}
+
+	client, err := m.conn(ctx)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(m.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	client.conn.SetDeadline(deadline)
+	if err := m.deliver(client.Client, msg, body); err != nil {
+		// The connection state is unknown, never reuse it
+		client.Close()
+		return err
+	}
+	m.release(client)
+	return nil
+}
+
+// Close closes idle connections
+func (m *SMTPMailer) Close() error {
+	for {
+		select {
+		case c := <-m.idle:
+			c.Quit()
+		default:
+			return nil
+		}
+	}
+}
+
+func (m *SMTPMailer) deliver(c *smtp.Client, msg *Message, body []byte) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid sender: %w", err)
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("mailer: MAIL FROM: %w", err)
+	}
+	for _, to := range msg.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("mailer: invalid recipient: %w", err)
+		}
+		if err := c.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("mailer: RCPT TO %s: %w", addr.Address, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: DATA: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("mailer: write body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mailer: send: %w", err)
+	}
+	return nil
+}
+
+// conn returns a healthy idle connection or dials a new one
+func (m *SMTPMailer) conn(ctx context.Context) (*smtpConn, error) {
+	for {
+		select {
+		case c := <-m.idle:
+			c.conn.SetDeadline(time.Now().Add(m.cfg.Timeout))
+			if c.Reset() == nil {
+				return c, nil
+			}
+			c.Close()
+		default:
+			return m.dial(ctx)
+		}
+	}
+}
+
+// release returns a connection to the pool, closing it if the pool is full
+func (m *SMTPMailer) release(c *smtpConn) {
+	select {
+	case m.idle <- c:
+	default:
+		c.Quit()
+	}
+}
+
+func (m *SMTPMailer) dial(ctx context.Context) (*smtpConn, error) {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if m.cfg.TLS == TLSImplicit {
+		d := &tls.Dialer{Config: tlsConfig}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mailer: dial %s: %w", addr, err)
+	}
+
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mailer: smtp handshake: %w", err)
+	}
+
+	if m.cfg.TLS == TLSStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("mailer: STARTTLS: %w", err)
+		}
+	}
+
+	if m.cfg.Username != "" {
+		auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+		if err := c.Auth(auth); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("mailer: auth: %w", err)
+		}
+	}
+	return &smtpConn{Client: c, conn: conn}, nil
+}
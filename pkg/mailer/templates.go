@@ -0,0 +1,110 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Built-in template names
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplatePasswordReset = "password_reset"
+)
+
+// Templates renders messages from named templates. Each template file defines
+// a "subject" and a "text" block and optionally an "html" block, which is
+// escaped for HTML.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// DefaultTemplates returns the built-in templates used by the verification
+// and password reset flows
+func DefaultTemplates() *Templates {
+	t, err := ParseTemplates(defaultTemplates, "templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// ParseTemplates parses the files matching pattern in fsys. A template is
+// named after its file without the extension.
+func ParseTemplates(fsys fs.FS, pattern string) (*Templates, error) {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+
+		text, err := texttemplate.ParseFS(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("mailer: parse template %s: %w", name, err)
+		}
+		if text.Lookup("subject") == nil || text.Lookup("text") == nil {
+			return nil, fmt.Errorf("mailer: template %s must define subject and text", name)
+		}
+		t.text[name] = text
+
+		if text.Lookup("html") != nil {
+			html, err := htmltemplate.ParseFS(fsys, file)
+			if err != nil {
+				return nil, fmt.Errorf("mailer: parse template %s: %w", name, err)
+			}
+			t.html[name] = html
+		}
+	}
+	return t, nil
+}
+
+// Has reports whether a template named name exists
+func (t *Templates) Has(name string) bool {
+	_, ok := t.text[name]
+	return ok
+}
+
+// Render builds a message from the named template. Recipients are left for
+// the caller to set.
+func (t *Templates) Render(name string, data interface{}) (*Message, error) {
+	text, ok := t.text[name]
+	if !ok {
+		return nil, fmt.Errorf("mailer: unknown template %q", name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("mailer: render %s subject: %w", name, err)
+	}
+	if err := text.ExecuteTemplate(&body, "text", data); err != nil {
+		return nil, fmt.Errorf("mailer: render %s text: %w", name, err)
+	}
+	msg := &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    body.String(),
+	}
+
+	if html, ok := t.html[name]; ok {
+		var buf bytes.Buffer
+		if err := html.ExecuteTemplate(&buf, "html", data); err != nil {
+			return nil, fmt.Errorf("mailer: render %s html: %w", name, err)
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
@@ -0,0 +1,93 @@
+package maintenance_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/maintenance"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mutation"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestModeSet(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	m := maintenance.New(0, fake)
+	if m.RetryAfter() != time.Minute {
+		t.Errorf("RetryAfter() = %v, want the 1m default", m.RetryAfter())
+	}
+
+	fake.Advance(time.Hour)
+	if state := m.Set(true, "migrating users"); !state.Enabled || state.Reason != "migrating users" || !state.Since.Equal(start.Add(time.Hour)) {
+		t.Errorf("Set(true) = %+v, want enabled since the change", state)
+	}
+	fake.Advance(time.Hour)
+	if state := m.Set(true, "still migrating"); !state.Since.Equal(start.Add(time.Hour)) {
+		t.Errorf("Set(true) again moved Since to %v, want it kept", state.Since)
+	}
+	if state := m.Toggle("ignored"); state.Enabled || state.Reason != "" {
+		t.Errorf("Toggle() = %+v, want disabled without a reason", state)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	m := maintenance.New(30*time.Second, nil)
+	srv := testutil.NewServer(t, testutil.WithServerOptions(
+		grpc.ChainUnaryInterceptor(m.UnaryServerInterceptor(mutation.NewSet(config.Default().Mutations...), "/api.v1.UserService/UpdateUser")),
+	))
+	ctx := context.Background()
+
+	created, err := srv.Client.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "a@example.com", DisplayName: "A"}})
+	if err != nil {
+		t.Fatalf("CreateUser() before maintenance unexpected error: %v", err)
+	}
+	name := created.GetData().GetFields()["result"].GetStructValue().GetFields()["name"].GetStringValue()
+
+	m.Set(true, "migrating users")
+
+	_, err = srv.Client.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: name})
+	st := status.Convert(err)
+	if st.Code() != codes.Unavailable || !strings.Contains(st.Message(), "migrating users") {
+		t.Errorf("DeleteUser() in maintenance error = %v, want %v with the reason", err, codes.Unavailable)
+	}
+	var retry *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if r, ok := d.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	if retry.GetRetryDelay().AsDuration() != 30*time.Second {
+		t.Errorf("RetryInfo delay = %v, want 30s", retry.GetRetryDelay().AsDuration())
+	}
+
+	if _, err := srv.Client.GetUser(ctx, &apiv1.GetUserRequest{Name: name}); err != nil {
+		t.Errorf("GetUser() in maintenance error = %v, want reads served", err)
+	}
+	if _, err := srv.Client.UpdateUser(ctx, &apiv1.UpdateUserRequest{User: &apiv1.User{Name: name}}); err != nil {
+		t.Errorf("UpdateUser() is exempt, got error %v", err)
+	}
+
+	resp, err := srv.HTTPClient.Post(srv.URL+"/v1/users", "application/json", strings.NewReader(`{"user":{"email":"b@example.com"}}`))
+	if err != nil {
+		t.Fatalf("POST /v1/users unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "30" {
+		t.Errorf("POST /v1/users in maintenance = %d with Retry-After %q, want 503 with 30", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	m.Set(false, "")
+	if _, err := srv.Client.DeleteUser(ctx, &apiv1.DeleteUserRequest{Name: name}); err != nil {
+		t.Errorf("DeleteUser() after maintenance unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+// Package metrics records gRPC and HTTP request metrics and serves them in
+// the Prometheus exposition format.
+//
+// gRPC requests are counted per method and status code, with their latency
+// and the number in flight. Services report errors in CommonResponse with
+// an OK status, so those codes are counted separately per method. HTTP
+// requests are labeled by verb and status only: paths carry resource IDs
+// and would make a series per resource.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Path is where Handler is conventionally served
+const Path = "/metrics"
+
+// Metrics holds the request metrics of a server and the registry they are
+// exported from
+type Metrics struct {
+	registry *prometheus.Registry
+
+	grpcRequests       *prometheus.CounterVec
+	grpcDuration       *prometheus.HistogramVec
+	grpcInFlight       *prometheus.GaugeVec
+	grpcResponseErrors *prometheus.CounterVec
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	httpInFlight prometheus.Gauge
+}
+
+// New creates the metrics with names prefixed by namespace, in a registry
+// of their own that also exports the Go runtime and process metrics
+func New(namespace string) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "requests_total",
+			Help:      "gRPC requests completed, by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "request_duration_seconds",
+			Help:      "Time to handle gRPC requests, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		grpcInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "requests_in_flight",
+			Help:      "gRPC requests being handled, by method.",
+		}, []string{"method"}),
+		grpcResponseErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "response_errors_total",
+			Help:      "Error codes returned in CommonResponse, by method and code.",
+		}, []string{"method", "code"}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests completed, by verb and status code.",
+		}, []string{"method", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Time to handle HTTP requests, by verb.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "HTTP requests being handled.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.grpcRequests, m.grpcDuration, m.grpcInFlight, m.grpcResponseErrors,
+		m.httpRequests, m.httpDuration, m.httpInFlight,
+	)
+	return m
+}
+
+// Registry returns the registry the metrics are exported from, for
+// components adding metrics of their own
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the metrics for Prometheus to scrape
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// codedResponse is a response reporting errors in a code of its own, like
+// CommonResponse
+type codedResponse interface {
+	GetErrorCode() int32
+}
+
+// UnaryServerInterceptor records unary requests
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		done := m.startRPC(info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		if r, ok := resp.(codedResponse); ok && err == nil && r.GetErrorCode() != 0 {
+			m.grpcResponseErrors.WithLabelValues(info.FullMethod, strconv.Itoa(int(r.GetErrorCode()))).Inc()
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records streams, timed until the handler returns
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := m.startRPC(info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+		return err
+	}
+}
+
+// startRPC counts a request of method in flight, and returns the func
+// recording its outcome
+func (m *Metrics) startRPC(method string) func(err error) {
+	start := time.Now()
+	inFlight := m.grpcInFlight.WithLabelValues(method)
+	inFlight.Inc()
+	return func(err error) {
+		inFlight.Dec()
+		m.grpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		m.grpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	}
+}
+
+// Middleware records the HTTP requests next handles
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.httpInFlight.Inc()
+		defer m.httpInFlight.Dec()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		m.httpDuration.WithLabelValues(r.Method).Observe(time.Since(start).Seconds())
+		m.httpRequests.WithLabelValues(r.Method, strconv.Itoa(sw.status)).Inc()
+	})
+}
+
+// statusWriter remembers the status code written through it
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes flushes through for streaming responses
+func (w *statusWriter) Flush() {
+	w.wroteHeader = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	m := New("test")
+	intercept := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/api.v1.UserService/GetUser"}
+	call := func(resp interface{}, err error) {
+		intercept(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			if got := promtest.ToFloat64(m.grpcInFlight.WithLabelValues(info.FullMethod)); got != 1 {
+				t.Errorf("requests in flight during the call = %v, want 1", got)
+			}
+			return resp, err
+		})
+	}
+
+	call(&apiv1.CommonResponse{}, nil)
+	call(&apiv1.CommonResponse{ErrorCode: 404}, nil)
+	call(nil, status.Error(codes.Unavailable, "draining"))
+
+	for _, tt := range []struct {
+		code string
+		want float64
+	}{
+		{"OK", 2},
+		{"Unavailable", 1},
+	} {
+		if got := promtest.ToFloat64(m.grpcRequests.WithLabelValues(info.FullMethod, tt.code)); got != tt.want {
+			t.Errorf("requests with code %s = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+	if got := promtest.ToFloat64(m.grpcResponseErrors.WithLabelValues(info.FullMethod, "404")); got != 1 {
+		t.Errorf("response errors with code 404 = %v, want 1", got)
+	}
+	if got := promtest.CollectAndCount(m.grpcResponseErrors); got != 1 {
+		t.Errorf("response error series = %d, want only the 404", got)
+	}
+	if got := promtest.ToFloat64(m.grpcInFlight.WithLabelValues(info.FullMethod)); got != 0 {
+		t.Errorf("requests in flight after the calls = %v, want 0", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New("test")
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	for _, path := range []string{"/v1/users", "/v1/users/1", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := promtest.ToFloat64(m.httpRequests.WithLabelValues("GET", "200")); got != 2 {
+		t.Errorf("GET requests with status 200 = %v, want 2", got)
+	}
+	if got := promtest.ToFloat64(m.httpRequests.WithLabelValues("GET", "404")); got != 1 {
+		t.Errorf("GET requests with status 404 = %v, want 1", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New("test")
+	m.Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		`test_http_requests_total{code="404",method="GET"} 1`,
+		"test_http_request_duration_seconds_bucket",
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("GET %s missing %q", Path, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package middleware composes the gRPC server interceptors. Each one is
+// registered under a name with an order, so the chain is declared in one
+// place, and the configuration can disable or reorder them by name.
+package middleware
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"google.golang.org/grpc"
+)
+
+// Interceptor is a named server interceptor for unary calls, streams or
+// both
+type Interceptor struct {
+	Name string
+
+	// Order places the interceptor in the chain: lower runs first and
+	// wraps those after it. Equal orders keep their registration order.
+	Order int
+
+	Unary  grpc.UnaryServerInterceptor
+	Stream grpc.StreamServerInterceptor
+}
+
+// Registry holds the interceptors of a server. It is built at startup and
+// is not safe for concurrent use.
+type Registry struct {
+	interceptors []Interceptor
+	disabled     map[string]bool
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{disabled: make(map[string]bool)}
+}
+
+// Register adds i to the chain. It panics if i has no name, no
+// interceptor or a name already registered, which are programming errors.
+func (r *Registry) Register(i Interceptor) {
+	if i.Name == "" {
+		panic("middleware: Register interceptor has no name")
+	}
+	if i.Unary == nil && i.Stream == nil {
+		panic("middleware: Register interceptor " + i.Name + " intercepts nothing")
+	}
+	if r.index(i.Name) >= 0 {
+		panic("middleware: Register called twice for interceptor " + i.Name)
+	}
+	r.interceptors = append(r.interceptors, i)
+}
+
+// Configure disables and reorders the registered interceptors as cfg
+// says. Naming an interceptor that is not registered is an error, so a
+// typo does not leave one silently enabled.
+func (r *Registry) Configure(cfg config.InterceptorsConfig) error {
+	for _, name := range cfg.Disabled {
+		if r.index(name) < 0 {
+			return fmt.Errorf("middleware: cannot disable unknown interceptor %q, expected one of %v", name, r.Names())
+		}
+	}
+	for name := range cfg.Order {
+		if r.index(name) < 0 {
+			return fmt.Errorf("middleware: cannot order unknown interceptor %q, expected one of %v", name, r.Names())
+		}
+	}
+	for _, name := range cfg.Disabled {
+		r.disabled[name] = true
+	}
+	for name, order := range cfg.Order {
+		r.interceptors[r.index(name)].Order = order
+	}
+	return nil
+}
+
+// Names returns the names of the registered interceptors, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.interceptors))
+	for _, i := range r.interceptors {
+		names = append(names, i.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Chain returns the enabled interceptors in the order they run
+func (r *Registry) Chain() []Interceptor {
+	chain := make([]Interceptor, 0, len(r.interceptors))
+	for _, i := range r.interceptors {
+		if !r.disabled[i.Name] {
+			chain = append(chain, i)
+		}
+	}
+	slices.SortStableFunc(chain, func(a, b Interceptor) int { return a.Order - b.Order })
+	return chain
+}
+
+// ServerOptions returns the options installing the chain on a server
+func (r *Registry) ServerOptions() []grpc.ServerOption {
+	return ServerOptions(r.Chain())
+}
+
+// ServerOptions returns the options installing chain on a server, in the
+// order given. Interceptors of other options given to grpc.NewServer after
+// these run after the chain.
+func ServerOptions(chain []Interceptor) []grpc.ServerOption {
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	for _, i := range chain {
+		if i.Unary != nil {
+			unary = append(unary, i.Unary)
+		}
+		if i.Stream != nil {
+			stream = append(stream, i.Stream)
+		}
+	}
+	return []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...)}
+}
+
+func (r *Registry) index(name string) int {
+	return slices.IndexFunc(r.interceptors, func(i Interceptor) bool { return i.Name == name })
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recording returns an interceptor appending its name to calls
+func recording(name string, order int, calls *[]string) Interceptor {
+	return Interceptor{
+		Name:  name,
+		Order: order,
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			*calls = append(*calls, name)
+			return handler(ctx, req)
+		},
+	}
+}
+
+// call runs a unary call through the chain of r, the way grpc.NewServer
+// composes it
+func call(r *Registry, handler grpc.UnaryHandler) (interface{}, error) {
+	chain := r.Chain()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Call"}
+	next := handler
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].Unary == nil {
+			continue
+		}
+		interceptor, inner := chain[i].Unary, next
+		next = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, inner)
+		}
+	}
+	return next(context.Background(), "request")
+}
+
+func TestRegistryChain(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	r.Register(recording("auth", 20, &calls))
+	r.Register(recording("logging", 10, &calls))
+	r.Register(recording("metrics", 20, &calls))
+	r.Register(Interceptor{Name: "streams", Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, ss)
+	}})
+
+	call(r, func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+	// Equal orders keep their registration order
+	if want := []string{"logging", "auth", "metrics"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if got, want := r.Names(), []string{"auth", "logging", "metrics", "streams"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
+
+func TestRegistryConfigure(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	r.Register(recording("logging", 10, &calls))
+	r.Register(recording("auth", 20, &calls))
+	r.Register(recording("ratelimit", 30, &calls))
+
+	if err := r.Configure(config.InterceptorsConfig{Disabled: []string{"logging"}, Order: map[string]int{"ratelimit": 15}}); err != nil {
+		t.Fatalf("Configure() unexpected error: %v", err)
+	}
+	call(r, func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+	if want := []string{"ratelimit", "auth"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	for _, cfg := range []config.InterceptorsConfig{
+		{Disabled: []string{"auht"}},
+		{Order: map[string]int{"auht": 1}},
+	} {
+		if err := r.Configure(cfg); err == nil {
+			t.Errorf("Configure(%+v) expected error for an unknown interceptor", cfg)
+		}
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(ctx, req)
+	}
+	for name, i := range map[string]Interceptor{
+		"no name":     {Unary: unary},
+		"nothing":     {Name: "empty"},
+		"a duplicate": {Name: "logging", Unary: unary},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := NewRegistry()
+			r.Register(Interceptor{Name: "logging", Unary: unary})
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register() of %s did not panic", name)
+				}
+			}()
+			r.Register(i)
+		})
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Recovery(logger.Nop()))
+	_, err := call(r, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("panicking handler error = %v, want %v", err, codes.Internal)
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/requestid"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Recovery returns the interceptor turning a handler panic into an
+// INTERNAL error, logged with its stack, instead of crashing the server.
+// Interceptors after it in the chain are covered too.
+func Recovery(log logger.Logger) Interceptor {
+	return Interceptor{
+		Name: "recovery",
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+			defer recoverPanic(ctx, log, info.FullMethod, &err)
+			return handler(ctx, req)
+		},
+		Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+			defer recoverPanic(ss.Context(), log, info.FullMethod, &err)
+			return handler(srv, ss)
+		},
+	}
+}
+
+func recoverPanic(ctx context.Context, log logger.Logger, method string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.WithFields(logger.Fields{"method": method, "request_id": requestid.FromContext(ctx)}).
+		Error("gRPC %s panicked: %v\n%s", method, r, debug.Stack())
+	*err = status.Error(codes.Internal, response.MsgInternalError)
+}
@@ -0,0 +1,22 @@
+// Package mutation tells the RPCs that change the system from reads. The
+// freeze, maintenance and audit interceptors share one Set, built from the
+// configured list, so a new mutating RPC is declared in a single place.
+package mutation
+
+// Set is a set of full method names, e.g. "/api.v1.UserService/UpdateUser"
+type Set map[string]bool
+
+// NewSet creates a Set of the given full methods
+func NewSet(methods ...string) Set {
+	s := make(Set, len(methods))
+	for _, m := range methods {
+		s[m] = true
+	}
+	return s
+}
+
+// Contains reports whether fullMethod changes the system. A nil Set
+// contains nothing.
+func (s Set) Contains(fullMethod string) bool {
+	return s[fullMethod]
+}
@@ -0,0 +1,21 @@
+package mutation
+
+import "testing"
+
+func TestSet(t *testing.T) {
+	s := NewSet("/api.v1.UserService/UpdateUser", "/api.v1.AdminService/RetryJob")
+	for method, want := range map[string]bool{
+		"/api.v1.UserService/UpdateUser": true,
+		"/api.v1.AdminService/RetryJob":  true,
+		"/api.v1.UserService/GetUser":    false,
+		"/api.v1.UserService/":           false,
+	} {
+		if got := s.Contains(method); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", method, got, want)
+		}
+	}
+	var empty Set
+	if empty.Contains("/api.v1.UserService/UpdateUser") {
+		t.Error("nil Set Contains() = true, want false")
+	}
+}
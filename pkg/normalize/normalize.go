@@ -0,0 +1,259 @@
+// Package normalize rewrites requests into their canonical form before
+// handlers see them: trimmed and lowercased strings, resource names with
+// their collections spelled as in the API, e.g. Users/1 as users/1, and
+// defaults for unset fields. Rules name fields by their full proto name,
+// such as api.v1.User.email, and apply wherever the message appears in a
+// request.
+package normalize
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Rule normalizes one field
+type Rule struct {
+	// Field is the field's full proto name, e.g. api.v1.User.email
+	Field string
+
+	// Trim removes leading and trailing white space
+	Trim bool
+
+	// Lowercase lowercases the value
+	Lowercase bool
+
+	// ResourcePattern is the pattern of the resource names the field
+	// holds, e.g. users/{user}. Collection segments matching the pattern
+	// in another case are spelled as in the pattern.
+	ResourcePattern string
+
+	// Default is set when the field is unset or zero. It is parsed for the
+	// field's kind, e.g. "50" for an int32 field.
+	Default string
+}
+
+// fieldRule is a Rule resolved against the field's descriptor
+type fieldRule struct {
+	fd         protoreflect.FieldDescriptor
+	trim       bool
+	lowercase  bool
+	pattern    []string
+	def        protoreflect.Value
+	hasDefault bool
+}
+
+// Normalizer applies rules to request messages
+type Normalizer struct {
+	// rules by the full name of the message holding the field
+	rules map[protoreflect.FullName][]fieldRule
+}
+
+// New creates a Normalizer applying rules. Fields are looked up in the
+// linked proto files, and string rules only apply to string fields.
+func New(rules []Rule) (*Normalizer, error) {
+	n := &Normalizer{rules: make(map[protoreflect.FullName][]fieldRule)}
+	for _, r := range rules {
+		fr, err := resolve(r)
+		if err != nil {
+			return nil, fmt.Errorf("normalize: %s: %w", r.Field, err)
+		}
+		parent := fr.fd.ContainingMessage().FullName()
+		n.rules[parent] = append(n.rules[parent], fr)
+	}
+	return n, nil
+}
+
+// Apply normalizes msg in place
+func (n *Normalizer) Apply(msg proto.Message) {
+	if len(n.rules) > 0 && msg != nil {
+		n.apply(msg.ProtoReflect())
+	}
+}
+
+// UnaryServerInterceptor normalizes requests before the handler runs
+func (n *Normalizer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if msg, ok := req.(proto.Message); ok {
+			n.Apply(msg)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor normalizes each message a stream receives
+func (n *Normalizer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &normalizedStream{ServerStream: ss, n: n})
+	}
+}
+
+// normalizedStream normalizes the messages it receives
+type normalizedStream struct {
+	grpc.ServerStream
+	n *Normalizer
+}
+
+func (s *normalizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if msg, ok := m.(proto.Message); ok {
+		s.n.Apply(msg)
+	}
+	return nil
+}
+
+// apply normalizes m's fields, then the messages within it
+func (n *Normalizer) apply(m protoreflect.Message) {
+	for _, r := range n.rules[m.Descriptor().FullName()] {
+		r.apply(m)
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				n.apply(list.Get(i).Message())
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				n.apply(v.Message())
+				return true
+			})
+		case fd.Message() != nil && !fd.IsList() && !fd.IsMap():
+			n.apply(v.Message())
+		}
+		return true
+	})
+}
+
+// apply normalizes r's field of m
+func (r fieldRule) apply(m protoreflect.Message) {
+	if r.fd.IsList() {
+		if !m.Has(r.fd) {
+			return
+		}
+		list := m.Mutable(r.fd).List()
+		for i := 0; i < list.Len(); i++ {
+			list.Set(i, protoreflect.ValueOfString(r.normalize(list.Get(i).String())))
+		}
+		return
+	}
+	if m.Has(r.fd) && r.fd.Kind() == protoreflect.StringKind {
+		if s := r.normalize(m.Get(r.fd).String()); s != "" {
+			m.Set(r.fd, protoreflect.ValueOfString(s))
+		} else {
+			m.Clear(r.fd)
+		}
+	}
+	// After normalizing, so a value of white space gets the default too
+	if !m.Has(r.fd) && r.hasDefault {
+		m.Set(r.fd, r.def)
+	}
+}
+
+// normalize applies r's string rules to s
+func (r fieldRule) normalize(s string) string {
+	if r.trim {
+		s = strings.TrimSpace(s)
+	}
+	if r.lowercase {
+		s = strings.ToLower(s)
+	}
+	if r.pattern != nil {
+		s = canonicalName(s, r.pattern)
+	}
+	return s
+}
+
+// canonicalName spells the collection segments of name as in pattern.
+// Names not of the pattern's shape are left for the handler to reject.
+func canonicalName(name string, pattern []string) string {
+	segments := strings.Split(name, "/")
+	if len(segments) != len(pattern) {
+		return name
+	}
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") {
+			continue
+		}
+		if !strings.EqualFold(segments[i], p) {
+			return name
+		}
+		segments[i] = p
+	}
+	return strings.Join(segments, "/")
+}
+
+// resolve looks up r's field and checks r fits it
+func resolve(r Rule) (fieldRule, error) {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(r.Field))
+	if err != nil {
+		return fieldRule{}, err
+	}
+	fd, ok := d.(protoreflect.FieldDescriptor)
+	if !ok || fd.IsMap() {
+		return fieldRule{}, fmt.Errorf("not a singular or repeated field")
+	}
+	fr := fieldRule{fd: fd, trim: r.Trim, lowercase: r.Lowercase}
+	if r.ResourcePattern != "" {
+		fr.pattern = strings.Split(r.ResourcePattern, "/")
+	}
+	if (fr.trim || fr.lowercase || fr.pattern != nil) && fd.Kind() != protoreflect.StringKind {
+		return fieldRule{}, fmt.Errorf("trim, lowercase and resource_pattern need a string field, not %s", fd.Kind())
+	}
+	if r.Default != "" {
+		if fd.IsList() {
+			return fieldRule{}, fmt.Errorf("repeated fields cannot have a default")
+		}
+		if fr.def, err = parseDefault(fd, r.Default); err != nil {
+			return fieldRule{}, fmt.Errorf("default: %w", err)
+		}
+		fr.hasDefault = true
+	}
+	return fr, nil
+}
+
+// parseDefault parses s as a value of fd's kind
+func parseDefault(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(i)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(i), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		u, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(u)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		u, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(u), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.EnumKind:
+		v := fd.Enum().Values().ByName(protoreflect.Name(s))
+		if v == nil {
+			return protoreflect.Value{}, fmt.Errorf("%s has no value %s", fd.Enum().FullName(), s)
+		}
+		return protoreflect.ValueOfEnum(v.Number()), nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("%s fields cannot have a default", fd.Kind())
+	}
+}
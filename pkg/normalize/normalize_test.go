@@ -0,0 +1,123 @@
+package normalize
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestNormalizer(t *testing.T) *Normalizer {
+	t.Helper()
+	n, err := New([]Rule{
+		{Field: "api.v1.User.email", Trim: true, Lowercase: true},
+		{Field: "api.v1.User.name", ResourcePattern: "users/{user}"},
+		{Field: "api.v1.GetUserRequest.name", Trim: true, ResourcePattern: "users/{user}"},
+		{Field: "api.v1.BatchGetUsersRequest.names", ResourcePattern: "users/{user}"},
+		{Field: "api.v1.ListUsersRequest.page_size", Default: "50"},
+		{Field: "api.v1.ListUsersRequest.order_by", Trim: true, Default: "create_time"},
+	})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	return n
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"unknown field", Rule{Field: "api.v1.User.nickname"}},
+		{"a message", Rule{Field: "api.v1.User"}},
+		{"string rule on a number", Rule{Field: "api.v1.ListUsersRequest.page_size", Trim: true}},
+		{"default of the wrong kind", Rule{Field: "api.v1.ListUsersRequest.page_size", Default: "fifty"}},
+		{"default for a repeated field", Rule{Field: "api.v1.BatchGetUsersRequest.names", Default: "users/1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]Rule{tt.rule}); err == nil {
+				t.Errorf("New(%+v) expected error", tt.rule)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	n := newTestNormalizer(t)
+	tests := []struct {
+		name string
+		in   proto.Message
+		want proto.Message
+	}{
+		{
+			name: "nested email",
+			in:   &apiv1.CreateUserRequest{User: &apiv1.User{Email: "  Ada@Example.COM ", DisplayName: " Ada "}},
+			want: &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada@example.com", DisplayName: " Ada "}},
+		},
+		{
+			name: "resource name",
+			in:   &apiv1.GetUserRequest{Name: " Users/AbC "},
+			want: &apiv1.GetUserRequest{Name: "users/AbC"},
+		},
+		{
+			name: "names of another shape",
+			in:   &apiv1.BatchGetUsersRequest{Names: []string{"USERS/1", "tasks/2", "users/3/x"}},
+			want: &apiv1.BatchGetUsersRequest{Names: []string{"users/1", "tasks/2", "users/3/x"}},
+		},
+		{
+			name: "defaults",
+			in:   &apiv1.ListUsersRequest{OrderBy: "   "},
+			want: &apiv1.ListUsersRequest{PageSize: 50, OrderBy: "create_time"},
+		},
+		{
+			name: "values kept",
+			in:   &apiv1.ListUsersRequest{PageSize: 10, OrderBy: "email"},
+			want: &apiv1.ListUsersRequest{PageSize: 10, OrderBy: "email"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n.Apply(tt.in)
+			if !proto.Equal(tt.in, tt.want) {
+				t.Errorf("Apply() = %v, want %v", tt.in, tt.want)
+			}
+		})
+	}
+}
+
+type testStream struct {
+	grpc.ServerStream
+	recv *apiv1.StreamUsersRequest
+}
+
+func (s *testStream) RecvMsg(m interface{}) error {
+	proto.Merge(m.(proto.Message), s.recv)
+	return nil
+}
+
+func TestInterceptors(t *testing.T) {
+	n := newTestNormalizer(t)
+
+	var got *apiv1.ListUsersRequest
+	n.UnaryServerInterceptor()(context.Background(), &apiv1.ListUsersRequest{}, &grpc.UnaryServerInfo{}, func(_ context.Context, req interface{}) (interface{}, error) {
+		got = req.(*apiv1.ListUsersRequest)
+		return nil, nil
+	})
+	if got.GetPageSize() != 50 {
+		t.Errorf("handler got page_size %d, want the default 50", got.GetPageSize())
+	}
+
+	n, _ = New([]Rule{{Field: "api.v1.StreamUsersRequest.chunk_size", Default: "500"}})
+	stream := &testStream{recv: &apiv1.StreamUsersRequest{}}
+	n.StreamServerInterceptor()(nil, stream, &grpc.StreamServerInfo{}, func(_ interface{}, ss grpc.ServerStream) error {
+		var req apiv1.StreamUsersRequest
+		ss.RecvMsg(&req)
+		if req.GetChunkSize() != 500 {
+			t.Errorf("stream handler got chunk_size %d, want the default 500", req.GetChunkSize())
+		}
+		return nil
+	})
+}
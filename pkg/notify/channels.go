@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mailer"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/webhook"
+)
+
+// EmailChannel sends notifications as email
+func EmailChannel(m mailer.Mailer) Channel {
+	return emailChannel{mailer: m}
+}
+
+type emailChannel struct {
+	mailer mailer.Mailer
+}
+
+func (emailChannel) Name() string { return ChannelEmail }
+
+func (e emailChannel) Send(ctx context.Context, to string, msg *Message) error {
+	return e.mailer.Send(ctx, &mailer.Message{
+		To:      []string{to},
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+	})
+}
+
+// WebhookChannel POSTs notifications as JSON to the user's URL
+func WebhookChannel(s webhook.Sender) Channel {
+	return webhookChannel{sender: s}
+}
+
+type webhookChannel struct {
+	sender webhook.Sender
+}
+
+func (webhookChannel) Name() string { return ChannelWebhook }
+
+func (w webhookChannel) Send(ctx context.Context, to string, msg *Message) error {
+	return w.sender.Send(ctx, to, msg.Event, msg)
+}
+
+// SlackChannel posts notifications to a Slack-compatible incoming webhook
+func SlackChannel(s webhook.Sender) Channel {
+	return slackChannel{sender: s}
+}
+
+type slackChannel struct {
+	sender webhook.Sender
+}
+
+func (slackChannel) Name() string { return ChannelSlack }
+
+func (s slackChannel) Send(ctx context.Context, to string, msg *Message) error {
+	return s.sender.Send(ctx, to, msg.Event, map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", msg.Subject, msg.Text),
+	})
+}
@@ -0,0 +1,128 @@
+// Package notify delivers user-facing notifications over the channels each
+// user has chosen: email, generic webhooks and Slack incoming webhooks.
+package notify
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mailer"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Channel names
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack"
+)
+
+// Event is something a user may be notified about. It is also the data
+// passed to the event's template.
+type Event struct {
+	// Type selects the template, e.g. "user.created"
+	Type string
+
+	// User is the resource name of the user to notify
+	User        string
+	Email       string
+	DisplayName string
+
+	// Data holds event specific template values
+	Data map[string]string
+}
+
+// Message is a rendered notification
+type Message struct {
+	Event   string `json:"event"`
+	User    string `json:"user"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"-"`
+}
+
+// Channel sends a message to an address on one medium
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, to string, msg *Message) error
+}
+
+// Notifier renders events and sends them over each user's channels
+type Notifier struct {
+	channels  map[string]Channel
+	templates *mailer.Templates
+	prefs     PreferenceStore
+	log       logger.Logger
+}
+
+// New creates a Notifier. Events without a template in templates are
+// ignored, so callers can pass every event through.
+func New(templates *mailer.Templates, prefs PreferenceStore, log logger.Logger, channels ...Channel) *Notifier {
+	n := &Notifier{
+		channels:  make(map[string]Channel, len(channels)),
+		templates: templates,
+		prefs:     prefs,
+		log:       log,
+	}
+	for _, c := range channels {
+		n.channels[c.Name()] = c
+	}
+	return n
+}
+
+// DefaultTemplates returns the built-in user lifecycle templates
+func DefaultTemplates() *mailer.Templates {
+	t, err := mailer.ParseTemplates(defaultTemplates, "templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Notify sends ev to the user over each of their channels. A failing channel
+// does not stop the others; all failures are returned together.
+func (n *Notifier) Notify(ctx context.Context, ev Event) error {
+	if !n.templates.Has(ev.Type) {
+		return nil
+	}
+
+	prefs, err := n.prefs.Get(ctx, ev.User)
+	if errors.Is(err, ErrNotFound) {
+		prefs = DefaultPreferences(ev.Email)
+	} else if err != nil {
+		return fmt.Errorf("notify: load preferences: %w", err)
+	}
+	if prefs.IsMuted(ev.Type) {
+		return nil
+	}
+
+	rendered, err := n.templates.Render(ev.Type, ev)
+	if err != nil {
+		return err
+	}
+	msg := &Message{
+		Event:   ev.Type,
+		User:    ev.User,
+		Subject: rendered.Subject,
+		Text:    rendered.Text,
+		HTML:    rendered.HTML,
+	}
+
+	var errs []error
+	for name, to := range prefs.Channels {
+		channel, ok := n.channels[name]
+		if !ok {
+			n.log.Warn("Notification channel %q for %s is not configured", name, ev.User)
+			continue
+		}
+		if err := channel.Send(ctx, to, msg); err != nil {
+			errs = append(errs, fmt.Errorf("notify: %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
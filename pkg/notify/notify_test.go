@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/mailer"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/webhook"
+)
+
+// recordingMailer keeps sent messages instead of delivering them
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []*mailer.Message
+}
+
+func (r *recordingMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, msg)
+	return nil
+}
+
+type failingChannel struct{ name string }
+
+func (f failingChannel) Name() string { return f.name }
+
+func (f failingChannel) Send(ctx context.Context, to string, msg *Message) error {
+	return errors.New("unreachable")
+}
+
+var created = Event{
+	Type:        "user.created",
+	User:        "users/1",
+	Email:       "alice@example.com",
+	DisplayName: "Alice",
+}
+
+func TestNotifyDefaultsToEmail(t *testing.T) {
+	m := &recordingMailer{}
+	n := New(DefaultTemplates(), NewMemoryPreferences(), logger.Nop(), EmailChannel(m))
+
+	if err := n.Notify(context.Background(), created); err != nil {
+		t.Fatalf("Notify() unexpected error: %v", err)
+	}
+	if len(m.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(m.sent))
+	}
+	got := m.sent[0]
+	if got.To[0] != "alice@example.com" || got.Subject != "Welcome, Alice" {
+		t.Errorf("email = %+v, want welcome to alice@example.com", got)
+	}
+	if got.Text == "" || got.HTML == "" {
+		t.Errorf("email = %+v, want text and HTML bodies", got)
+	}
+}
+
+func TestNotifyUsesPreferences(t *testing.T) {
+	var mu sync.Mutex
+	bodies := map[string]map[string]interface{}{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		bodies[r.URL.Path] = body
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	m := &recordingMailer{}
+	prefs := NewMemoryPreferences()
+	prefs.Set(context.Background(), "users/1", Preferences{
+		Channels: map[string]string{
+			ChannelWebhook: srv.URL + "/hook",
+			ChannelSlack:   srv.URL + "/slack",
+		},
+	})
+	client := webhook.NewClient(srv.Client())
+	n := New(DefaultTemplates(), prefs, logger.Nop(), EmailChannel(m), WebhookChannel(client), SlackChannel(client))
+
+	if err := n.Notify(context.Background(), created); err != nil {
+		t.Fatalf("Notify() unexpected error: %v", err)
+	}
+	if len(m.sent) != 0 {
+		t.Errorf("sent %d emails, want 0 when email is not chosen", len(m.sent))
+	}
+	if hook := bodies["/hook"]; hook["event"] != "user.created" || hook["user"] != "users/1" {
+		t.Errorf("webhook body = %v, want event and user", hook)
+	}
+	if text, _ := bodies["/slack"]["text"].(string); !strings.HasPrefix(text, "*Welcome, Alice*") {
+		t.Errorf("slack text = %q, want bold subject first", text)
+	}
+}
+
+func TestNotifySkips(t *testing.T) {
+	m := &recordingMailer{}
+	prefs := NewMemoryPreferences()
+	prefs.Set(context.Background(), "users/2", Preferences{
+		Channels: map[string]string{ChannelEmail: "bob@example.com"},
+		Muted:    []string{"user.created"},
+	})
+	n := New(DefaultTemplates(), prefs, logger.Nop(), EmailChannel(m))
+
+	tests := []struct {
+		name string
+		ev   Event
+	}{
+		{"no template", Event{Type: "user.updated", User: "users/1", Email: "alice@example.com"}},
+		{"muted", Event{Type: "user.created", User: "users/2", Email: "bob@example.com"}},
+		{"no address", Event{Type: "user.created", User: "users/3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := n.Notify(context.Background(), tt.ev); err != nil {
+				t.Errorf("Notify() unexpected error: %v", err)
+			}
+		})
+	}
+	if len(m.sent) != 0 {
+		t.Errorf("sent %d emails, want 0", len(m.sent))
+	}
+}
+
+func TestNotifyReportsChannelFailures(t *testing.T) {
+	m := &recordingMailer{}
+	prefs := NewMemoryPreferences()
+	prefs.Set(context.Background(), "users/1", Preferences{
+		Channels: map[string]string{
+			ChannelEmail:   "alice@example.com",
+			ChannelWebhook: "http://example.invalid",
+		},
+	})
+	n := New(DefaultTemplates(), prefs, logger.Nop(), EmailChannel(m), failingChannel{name: ChannelWebhook})
+
+	err := n.Notify(context.Background(), created)
+	if err == nil || !strings.Contains(err.Error(), "webhook") {
+		t.Errorf("Notify() error = %v, want webhook failure", err)
+	}
+	if len(m.sent) != 1 {
+		t.Errorf("sent %d emails, want 1 despite the webhook failure", len(m.sent))
+	}
+}
+
+func TestMemoryPreferences(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryPreferences()
+
+	if _, err := s.Get(ctx, "users/1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+	channels := map[string]string{ChannelEmail: "alice@example.com"}
+	s.Set(ctx, "users/1", Preferences{Channels: channels})
+	channels[ChannelEmail] = "changed@example.com"
+
+	got, err := s.Get(ctx, "users/1")
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	if got.Channels[ChannelEmail] != "alice@example.com" {
+		t.Errorf("Get() = %+v, want a copy unaffected by the caller", got)
+	}
+
+	s.Delete(ctx, "users/1")
+	if _, err := s.Get(ctx, "users/1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, ErrNotFound)
+	}
+}
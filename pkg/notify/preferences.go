@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned when a user has no stored preferences
+var ErrNotFound = errors.New("notify: preferences not found")
+
+// Preferences are a user's notification settings
+type Preferences struct {
+	// Channels maps a channel name to the user's address on it: an email
+	// address, a webhook URL or a Slack incoming webhook URL
+	Channels map[string]string `json:"channels"`
+
+	// Muted lists event types the user does not want to hear about
+	Muted []string `json:"muted,omitempty"`
+}
+
+// DefaultPreferences are used for users who have not chosen any: email to
+// their account address
+func DefaultPreferences(email string) Preferences {
+	if email == "" {
+		return Preferences{}
+	}
+	return Preferences{Channels: map[string]string{ChannelEmail: email}}
+}
+
+// IsMuted reports whether the user opted out of the event type
+func (p Preferences) IsMuted(event string) bool {
+	for _, m := range p.Muted {
+		if m == event {
+			return true
+		}
+	}
+	return false
+}
+
+// PreferenceStore stores notification preferences by user resource name
+type PreferenceStore interface {
+	Get(ctx context.Context, user string) (Preferences, error)
+	Set(ctx context.Context, user string, prefs Preferences) error
+	Delete(ctx context.Context, user string) error
+}
+
+// MemoryPreferences is an in-memory PreferenceStore
+type MemoryPreferences struct {
+	mu    sync.RWMutex
+	prefs map[string]Preferences
+}
+
+// NewMemoryPreferences creates an empty MemoryPreferences
+func NewMemoryPreferences() *MemoryPreferences {
+	return &MemoryPreferences{prefs: make(map[string]Preferences)}
+}
+
+// Get returns the user's preferences
+func (m *MemoryPreferences) Get(ctx context.Context, user string) (Preferences, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.prefs[user]
+	if !ok {
+		return Preferences{}, ErrNotFound
+	}
+	return p.clone(), nil
+}
+
+// Set replaces the user's preferences
+func (m *MemoryPreferences) Set(ctx context.Context, user string, prefs Preferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prefs[user] = prefs.clone()
+	return nil
+}
+
+// Delete removes the user's preferences
+func (m *MemoryPreferences) Delete(ctx context.Context, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.prefs, user)
+	return nil
+}
+
+func (p Preferences) clone() Preferences {
+	c := Preferences{Muted: append([]string(nil), p.Muted...)}
+	if p.Channels != nil {
+		c.Channels = make(map[string]string, len(p.Channels))
+		for k, v := range p.Channels {
+			c.Channels[k] = v
+		}
+	}
+	return c
+}
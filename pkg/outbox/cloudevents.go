@@ -0,0 +1,53 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ContentType is the content type of CloudEvents in the structured JSON
+// format, the payload of messages made by NewCloudEvent
+const ContentType = "application/cloudevents+json"
+
+// CloudEvent is a CloudEvents 1.0 event in the structured JSON format:
+// the attributes and the data travel together in the payload, so every
+// transport carries them the same way
+type CloudEvent struct {
+	SpecVersion string `json:"specversion"`
+	ID          string `json:"id"`
+
+	// Source identifies the producer, e.g. "//users.example.com"
+	Source string `json:"source"`
+
+	// Type is the kind of event, e.g. "com.example.user.created"
+	Type string `json:"type"`
+
+	// Subject is what the event is about within the source, e.g. a
+	// resource name
+	Subject string    `json:"subject,omitempty"`
+	Time    time.Time `json:"time"`
+
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// NewCloudEvent returns the message publishing ev on topic under key. The
+// message has the event's ID, so a transport that deduplicates by ID drops
+// the copies at-least-once delivery may send.
+func NewCloudEvent(topic, key string, ev CloudEvent) (*Message, error) {
+	if ev.SpecVersion == "" {
+		ev.SpecVersion = "1.0"
+	}
+	if ev.ID == "" || ev.Source == "" || ev.Type == "" {
+		return nil, fmt.Errorf("outbox: cloud event needs an id, source and type")
+	}
+	if ev.Data != nil && ev.DataContentType == "" {
+		ev.DataContentType = "application/json"
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: encode cloud event %s: %w", ev.ID, err)
+	}
+	return &Message{ID: ev.ID, Topic: topic, Key: key, Payload: payload, CreateTime: ev.Time}, nil
+}
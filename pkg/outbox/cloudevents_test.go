@@ -0,0 +1,54 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNewCloudEvent(t *testing.T) {
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	msg, err := NewCloudEvent("users", "users/1", CloudEvent{
+		ID:      "e1",
+		Source:  "//users",
+		Type:    "user.created",
+		Subject: "users/1",
+		Time:    at,
+		Data:    json.RawMessage(`{"name":"users/1"}`),
+	})
+	if err != nil {
+		t.Fatalf("NewCloudEvent() unexpected error: %v", err)
+	}
+	if msg.ID != "e1" || msg.Topic != "users" || msg.Key != "users/1" || !msg.CreateTime.Equal(at) {
+		t.Errorf("NewCloudEvent() = %+v, want the event's ID and time on users under users/1", msg)
+	}
+	want := `{"specversion":"1.0","id":"e1","source":"//users","type":"user.created","subject":"users/1","time":"2025-01-01T00:00:00Z","datacontenttype":"application/json","data":{"name":"users/1"}}`
+	if string(msg.Payload) != want {
+		t.Errorf("payload = %s, want %s", msg.Payload, want)
+	}
+
+	if _, err := NewCloudEvent("users", "", CloudEvent{ID: "e2", Type: "user.created"}); err == nil {
+		t.Error("NewCloudEvent() without a source expected error")
+	}
+}
+
+func TestWithMessages(t *testing.T) {
+	ctx := context.Background()
+	if got := Messages(ctx); len(got) != 0 {
+		t.Errorf("Messages() = %v, want none", got)
+	}
+	parent := WithMessages(ctx, &Message{ID: "a"})
+	child := WithMessages(parent, &Message{ID: "b"})
+	sibling := WithMessages(parent, &Message{ID: "c"})
+
+	if got := Messages(child); len(got) != 2 || got[0].ID != "a" || got[1].ID != "b" {
+		t.Errorf("Messages(child) = %v, want a, b", got)
+	}
+	if got := Messages(sibling); len(got) != 2 || got[1].ID != "c" {
+		t.Errorf("Messages(sibling) = %v, want a, c", got)
+	}
+	if got := Messages(parent); len(got) != 1 {
+		t.Errorf("Messages(parent) = %v, want a only", got)
+	}
+}
@@ -0,0 +1,22 @@
+package outbox
+
+import "context"
+
+type messagesKey struct{}
+
+// WithMessages returns a context carrying msgs, to be added to the outbox
+// by a store write made with it in the same transaction as the write. See
+// Messages.
+func WithMessages(ctx context.Context, msgs ...*Message) context.Context {
+	if len(msgs) == 0 {
+		return ctx
+	}
+	all := append(Messages(ctx), msgs...)
+	return context.WithValue(ctx, messagesKey{}, all[:len(all):len(all)])
+}
+
+// Messages returns the messages ctx carries for the outbox
+func Messages(ctx context.Context) []*Message {
+	msgs, _ := ctx.Value(messagesKey{}).([]*Message)
+	return msgs
+}
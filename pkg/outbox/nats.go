@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/nats-io/nats.go"
+)
+
+func init() {
+	RegisterTransport("nats", openNATS)
+}
+
+// openNATS connects to cfg.NATSURL. A server that is down at startup is
+// retried in the background, failing publishes until it is up, rather than
+// failing startup.
+func openNATS(cfg config.OutboxConfig, log logger.Logger) (Publisher, func() error, error) {
+	nc, err := nats.Connect(cfg.NATSURL,
+		nats.Name("outbox-relay"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Warn("Outbox lost its NATS connection: %v", err)
+			}
+		}),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+	return NewNATSPublisher(js), func() error { nc.Close(); return nil }, nil
+}
+
+// NATSPublisher publishes messages to NATS JetStream on the subject of
+// their topic. JetStream acknowledges a message once a stream stored it,
+// so the relay only marks stored messages delivered. The message ID is
+// sent as Nats-Msg-Id: JetStream drops the copy of a message the relay
+// publishes again within the stream's duplicate window.
+type NATSPublisher struct {
+	js nats.JetStreamContext
+}
+
+// NewNATSPublisher creates a NATSPublisher on js
+func NewNATSPublisher(js nats.JetStreamContext) *NATSPublisher {
+	return &NATSPublisher{js: js}
+}
+
+// Publish publishes msg and waits for JetStream to store it
+func (p *NATSPublisher) Publish(ctx context.Context, msg *Message) error {
+	m := nats.NewMsg(msg.Topic)
+	m.Data = msg.Payload
+	m.Header.Set(nats.MsgIdHdr, msg.ID)
+	if _, err := p.js.PublishMsg(m, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+	return nil
+}
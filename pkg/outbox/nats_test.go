@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// fakeNATS speaks enough of the NATS protocol to acknowledge JetStream
+// publishes, failing those to subjects without a stream
+type fakeNATS struct {
+	lis    net.Listener
+	stream string
+
+	mu       sync.Mutex
+	received []*nats.Msg
+}
+
+func startFakeNATS(t *testing.T, stream string) *fakeNATS {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	s := &fakeNATS{lis: lis, stream: stream}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATS) url() string { return "nats://" + s.lis.Addr().String() }
+
+func (s *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	var sid string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case "SUB":
+			sid = fields[len(fields)-1]
+		case "HPUB":
+			// HPUB <subject> <reply> <header size> <total size>
+			hdrLen, _ := strconv.Atoi(fields[3])
+			total, _ := strconv.Atoi(fields[4])
+			buf := make([]byte, total+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			hdr := parseHeader(string(buf[:hdrLen]))
+			s.mu.Lock()
+			s.received = append(s.received, &nats.Msg{Subject: fields[1], Header: hdr, Data: buf[hdrLen:total]})
+			s.mu.Unlock()
+
+			ack := fmt.Sprintf(`{"stream":%q,"seq":1}`, s.stream)
+			if fields[1] != s.stream {
+				ack = `{"error":{"code":503,"err_code":10039,"description":"no responders"}}`
+			}
+			fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", fields[2], sid, len(ack), ack)
+		}
+	}
+}
+
+// parseHeader reads the NATS/1.0 header block of an HPUB
+func parseHeader(block string) nats.Header {
+	hdr := nats.Header{}
+	for _, line := range strings.Split(block, "\r\n")[1:] {
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			hdr.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+	return hdr
+}
+
+func TestNATSPublisher(t *testing.T) {
+	server := startFakeNATS(t, "users")
+	nc, err := nats.Connect(server.url())
+	if err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := NewNATSPublisher(js)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg := &Message{ID: "e1", Topic: "users", Key: "users/1", Payload: []byte(`{"id":"e1"}`)}
+	if err := pub.Publish(ctx, msg); err != nil {
+		t.Fatalf("Publish() unexpected error: %v", err)
+	}
+	server.mu.Lock()
+	got := server.received[0]
+	server.mu.Unlock()
+	if got.Subject != "users" || string(got.Data) != `{"id":"e1"}` || got.Header.Get(nats.MsgIdHdr) != "e1" {
+		t.Errorf("published %s %q %v, want the payload on users with Nats-Msg-Id e1", got.Subject, got.Data, got.Header)
+	}
+
+	// A message no stream stores is not acknowledged, so the relay retries
+	if err := pub.Publish(ctx, &Message{ID: "e2", Topic: "orders", Payload: []byte("{}")}); err == nil {
+		t.Error("Publish() without a stream expected error")
+	}
+}
@@ -0,0 +1,145 @@
+// Package outbox relays messages recorded in an outbox table to an event
+// transport, so events are published if and only if the change that produced
+// them was committed.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when marking an unknown message
+var ErrNotFound = errors.New("outbox: message not found")
+
+// Message is an event waiting to be published
+type Message struct {
+	ID string
+
+	// Topic and Key select where the transport publishes the message
+	Topic string
+	Key   string
+
+	Payload    []byte
+	CreateTime time.Time
+
+	// DeliverTime is zero until the message is published
+	DeliverTime time.Time
+
+	// Attempts counts failed publish attempts
+	Attempts  int
+	LastError string
+}
+
+// Store holds outbox messages
+type Store interface {
+	// Add records a new undelivered message
+	Add(ctx context.Context, msg *Message) error
+
+	// Pending returns up to limit undelivered messages, oldest first
+	Pending(ctx context.Context, limit int) ([]*Message, error)
+
+	// MarkDelivered records that the message was published at t
+	MarkDelivered(ctx context.Context, id string, t time.Time) error
+
+	// MarkFailed records a failed publish attempt
+	MarkFailed(ctx context.Context, id string, err error) error
+}
+
+// MemoryStore is an in-process Store for tests and local development
+type MemoryStore struct {
+	mu       sync.Mutex
+	messages map[string]*Message
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{messages: make(map[string]*Message)}
+}
+
+// Add records a new undelivered message
+func (s *MemoryStore) Add(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.messages[msg.ID]; ok {
+		return fmt.Errorf("outbox: message %s already exists", msg.ID)
+	}
+	c := *msg
+	s.messages[msg.ID] = &c
+	return nil
+}
+
+// Pending returns up to limit undelivered messages, oldest first
+func (s *MemoryStore) Pending(ctx context.Context, limit int) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending []*Message
+	for _, msg := range s.messages {
+		if msg.DeliverTime.IsZero() {
+			c := *msg
+			pending = append(pending, &c)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].CreateTime.Equal(pending[j].CreateTime) {
+			return pending[i].CreateTime.Before(pending[j].CreateTime)
+		}
+		return pending[i].ID < pending[j].ID
+	})
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+// MarkDelivered records that the message was published at t
+func (s *MemoryStore) MarkDelivered(ctx context.Context, id string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, ok := s.messages[id]
+	if !ok {
+		return ErrNotFound
+	}
+	msg.DeliverTime = t
+	return nil
+}
+
+// MarkFailed records a failed publish attempt
+func (s *MemoryStore) MarkFailed(ctx context.Context, id string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, ok := s.messages[id]
+	if !ok {
+		return ErrNotFound
+	}
+	msg.Attempts++
+	msg.LastError = err.Error()
+	return nil
+}
+
+// Purge deletes the messages delivered before cutoff and returns how many
+// it deleted, or with dryRun only counts them. Undelivered messages are
+// kept however old.
+func (s *MemoryStore) Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, msg := range s.messages {
+		if msg.DeliverTime.IsZero() || !msg.DeliverTime.Before(cutoff) {
+			continue
+		}
+		purged++
+		if !dryRun {
+			delete(s.messages, id)
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,96 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Publisher delivers messages to an event transport
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, msg *Message) error
+
+// Publish calls f(ctx, msg)
+func (f PublisherFunc) Publish(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// Transport opens a Publisher from the outbox configuration, connecting to
+// the broker if it has one. The returned func closes the connections it
+// opened.
+type Transport func(cfg config.OutboxConfig, log logger.Logger) (Publisher, func() error, error)
+
+var (
+	transportsMu sync.RWMutex
+	transports   = make(map[string]Transport)
+)
+
+func init() {
+	RegisterTransport("log", func(cfg config.OutboxConfig, log logger.Logger) (Publisher, func() error, error) {
+		return LogPublisher(log), func() error { return nil }, nil
+	})
+}
+
+// RegisterTransport makes a transport available by name to NewPublisher,
+// so brokers such as Kafka plug in without changes here. It panics if the
+// name is taken, like database/sql.Register.
+func RegisterTransport(name string, t Transport) {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if t == nil {
+		panic("outbox: RegisterTransport transport is nil")
+	}
+	if _, dup := transports[name]; dup {
+		panic("outbox: RegisterTransport called twice for transport " + name)
+	}
+	transports[name] = t
+}
+
+// Transports returns the names of the registered transports, sorted
+func Transports() []string {
+	transportsMu.RLock()
+	defer transportsMu.RUnlock()
+	names := make([]string, 0, len(transports))
+	for name := range transports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPublisher opens the Publisher of cfg.Transport, "log" when it is
+// empty. An unknown transport fails with the names of the registered ones.
+func NewPublisher(cfg config.OutboxConfig, log logger.Logger) (Publisher, func() error, error) {
+	name := cfg.Transport
+	if name == "" {
+		name = "log"
+	}
+	transportsMu.RLock()
+	t, ok := transports[name]
+	transportsMu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("outbox: unknown transport %q, expected one of %s", name, strings.Join(Transports(), ", "))
+	}
+	pub, closePub, err := t(cfg, log)
+	if err != nil {
+		return nil, nil, fmt.Errorf("outbox: open %s transport: %w", name, err)
+	}
+	return pub, closePub, nil
+}
+
+// LogPublisher "publishes" messages by logging them, for local development
+func LogPublisher(log logger.Logger) Publisher {
+	return PublisherFunc(func(ctx context.Context, msg *Message) error {
+		log.Info("Outbox message %s on topic %s (key %q): %s", msg.ID, msg.Topic, msg.Key, msg.Payload)
+		return nil
+	})
+}
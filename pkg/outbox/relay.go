@@ -0,0 +1,121 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Options configures a Relay
+type Options struct {
+	// BatchSize is the number of messages read from the store at once
+	// (default 100)
+	BatchSize int
+
+	// Clock defaults to the real clock
+	Clock clock.Clock
+}
+
+// Stats is a snapshot of relay activity
+type Stats struct {
+	Published uint64
+	Failed    uint64
+
+	// Lag is the age of the oldest undelivered message at the end of the
+	// last run, zero when the outbox was drained
+	Lag     time.Duration
+	LastRun time.Time
+}
+
+// Relay publishes pending outbox messages in order. It keeps no goroutines of
+// its own: run RunOnce periodically, e.g. as a scheduler job, which also
+// provides leader election and graceful shutdown.
+type Relay struct {
+	store Store
+	pub   Publisher
+	log   logger.Logger
+	opts  Options
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewRelay creates a Relay
+func NewRelay(store Store, pub Publisher, log logger.Logger, opts Options) *Relay {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.Real()
+	}
+	return &Relay{store: store, pub: pub, log: log, opts: opts}
+}
+
+// RunOnce publishes pending messages until the outbox is empty. It stops at
+// the first failure so messages are never published out of order; the
+// failed message is retried on the next run.
+func (r *Relay) RunOnce(ctx context.Context) error {
+	var published, failed uint64
+	defer func() {
+		r.mu.Lock()
+		r.stats.Published += published
+		r.stats.Failed += failed
+		r.stats.LastRun = r.opts.Clock.Now()
+		r.mu.Unlock()
+	}()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch, err := r.store.Pending(ctx, r.opts.BatchSize)
+		if err != nil {
+			return fmt.Errorf("outbox: read pending messages: %w", err)
+		}
+
+		for _, msg := range batch {
+			if err := r.pub.Publish(ctx, msg); err != nil {
+				failed++
+				r.setLag(msg)
+				if markErr := r.store.MarkFailed(ctx, msg.ID, err); markErr != nil {
+					r.log.Error("Failed to record outbox failure for %s: %v", msg.ID, markErr)
+				}
+				return fmt.Errorf("outbox: publish message %s: %w", msg.ID, err)
+			}
+			if err := r.store.MarkDelivered(ctx, msg.ID, r.opts.Clock.Now()); err != nil {
+				// The message will be published again; consumers must be
+				// idempotent anyway
+				return fmt.Errorf("outbox: mark message %s delivered: %w", msg.ID, err)
+			}
+			published++
+		}
+
+		if len(batch) < r.opts.BatchSize {
+			r.setLag(nil)
+			return nil
+		}
+	}
+}
+
+// Stats returns a snapshot of relay activity
+func (r *Relay) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// setLag records the age of oldest, or zero if nothing is pending
+func (r *Relay) setLag(oldest *Message) {
+	var lag time.Duration
+	if oldest != nil {
+		lag = r.opts.Clock.Now().Sub(oldest.CreateTime)
+	}
+	r.mu.Lock()
+	r.stats.Lag = lag
+	r.mu.Unlock()
+}
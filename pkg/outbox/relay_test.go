@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+func seed(t *testing.T, store Store, base time.Time, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		msg := &Message{ID: fmt.Sprintf("m%02d", i), Topic: "users", Payload: []byte("{}"), CreateTime: base.Add(time.Duration(i) * time.Second)}
+		if err := store.Add(context.Background(), msg); err != nil {
+			t.Fatalf("Add() unexpected error: %v", err)
+		}
+	}
+}
+
+func TestRelayPublishesInOrder(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	seed(t, store, base, 5)
+
+	var got []string
+	pub := PublisherFunc(func(ctx context.Context, msg *Message) error {
+		got = append(got, msg.ID)
+		return nil
+	})
+	relay := NewRelay(store, pub, logger.Nop(), Options{BatchSize: 2, Clock: clock.NewFake(base.Add(time.Minute))})
+
+	if err := relay.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() unexpected error: %v", err)
+	}
+	if fmt.Sprint(got) != "[m00 m01 m02 m03 m04]" {
+		t.Errorf("published %v, want m00..m04 in order", got)
+	}
+	if pending, _ := store.Pending(context.Background(), 10); len(pending) != 0 {
+		t.Errorf("Pending() = %d messages, want 0", len(pending))
+	}
+	if stats := relay.Stats(); stats.Published != 5 || stats.Lag != 0 {
+		t.Errorf("Stats() = %+v, want 5 published and no lag", stats)
+	}
+}
+
+func TestRelayStopsAtFailure(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	seed(t, store, base, 3)
+
+	fail := true
+	pub := PublisherFunc(func(ctx context.Context, msg *Message) error {
+		if msg.ID == "m01" && fail {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	})
+	relay := NewRelay(store, pub, logger.Nop(), Options{Clock: clock.NewFake(base.Add(time.Minute))})
+
+	if err := relay.RunOnce(context.Background()); err == nil {
+		t.Fatal("RunOnce() expected error")
+	}
+	pending, _ := store.Pending(context.Background(), 10)
+	if len(pending) != 2 || pending[0].ID != "m01" || pending[0].Attempts != 1 {
+		t.Fatalf("Pending() = %+v, want m01 (1 attempt) and m02", pending)
+	}
+	if stats := relay.Stats(); stats.Published != 1 || stats.Failed != 1 || stats.Lag != 59*time.Second {
+		t.Errorf("Stats() = %+v, want 1 published, 1 failed, 59s lag", stats)
+	}
+
+	fail = false
+	if err := relay.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() unexpected error: %v", err)
+	}
+	if stats := relay.Stats(); stats.Published != 3 || stats.Lag != 0 {
+		t.Errorf("Stats() = %+v, want 3 published and no lag", stats)
+	}
+}
+
+func TestNewPublisher(t *testing.T) {
+	if _, _, err := NewPublisher(config.OutboxConfig{Transport: "log"}, logger.Nop()); err != nil {
+		t.Errorf("NewPublisher(log) unexpected error: %v", err)
+	}
+	if _, _, err := NewPublisher(config.OutboxConfig{Transport: "carrier-pigeon"}, logger.Nop()); err == nil {
+		t.Errorf("NewPublisher() expected error for unknown transport")
+	}
+}
+
+func TestMemoryStorePurge(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	seed(t, store, base, 3)
+	store.MarkDelivered(ctx, "m00", base)
+	store.MarkDelivered(ctx, "m01", base.Add(time.Hour))
+
+	if n, err := store.Purge(ctx, base.Add(time.Minute), true); err != nil || n != 1 {
+		t.Errorf("Purge() dry run = %d, %v, want 1", n, err)
+	}
+	if n, err := store.Purge(ctx, base.Add(time.Minute), false); err != nil || n != 1 {
+		t.Errorf("Purge() = %d, %v, want 1", n, err)
+	}
+	// Undelivered messages are kept however old
+	if n, _ := store.Purge(ctx, base.Add(24*time.Hour), false); n != 1 {
+		t.Errorf("Purge() later = %d, want only the other delivered message", n)
+	}
+	if pending, _ := store.Pending(ctx, 10); len(pending) != 1 || pending[0].ID != "m02" {
+		t.Errorf("Pending() = %v, want m02", pending)
+	}
+}
@@ -0,0 +1,78 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+type cursor struct {
+	Time int64  `json:"t"`
+	Name string `json:"n"`
+}
+
+func TestTokensRoundTrip(t *testing.T) {
+	tokens := NewTokens([]byte("secret"))
+	want := cursor{Time: 42, Name: "users/1"}
+	token, err := tokens.Encode("filter=a", want)
+	if err != nil {
+		t.Fatalf("Encode() unexpected error: %v", err)
+	}
+
+	var got cursor
+	if err := tokens.Decode(token, "filter=a", &got); err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+
+	// Replicas sharing the key accept each other's tokens
+	if err := NewTokens([]byte("secret")).Decode(token, "filter=a", &got); err != nil {
+		t.Errorf("Decode() with the same key unexpected error: %v", err)
+	}
+}
+
+func TestTokensRejectInvalid(t *testing.T) {
+	tokens := NewTokens([]byte("secret"))
+	token, _ := tokens.Encode("filter=a", cursor{Time: 42, Name: "users/1"})
+	raw, _ := base64.RawURLEncoding.DecodeString(token)
+	tampered := append([]byte(nil), raw...)
+	tampered[3] ^= 1
+
+	tests := []struct {
+		name   string
+		tokens *Tokens
+		token  string
+		params string
+	}{
+		{"other parameters", tokens, token, "filter=b"},
+		{"other key", NewTokens([]byte("other")), token, "filter=a"},
+		{"random key", NewTokens(nil), token, "filter=a"},
+		{"tampered", tokens, base64.RawURLEncoding.EncodeToString(tampered), "filter=a"},
+		{"truncated", tokens, token[:10], "filter=a"},
+		{"offset", tokens, "20", "filter=a"},
+		{"not base64", tokens, "!!!", "filter=a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got cursor
+			if err := tt.tokens.Decode(tt.token, tt.params, &got); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Decode() error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	for _, tt := range []struct {
+		requested int32
+		want      int
+	}{
+		{0, 50}, {-1, 50}, {10, 10}, {1000, 1000}, {1001, 1000},
+	} {
+		if got := PageSize(tt.requested, 50, 1000); got != tt.want {
+			t.Errorf("PageSize(%d) = %d, want %d", tt.requested, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package profiling attributes CPU and allocation profiles to RPC methods
+// and serves them for continuous profilers.
+//
+// Handlers run with the pprof label grpc_method set to the full method name,
+// so any profile, whether captured by hand or scraped by Parca or Grafana
+// Pyroscope in pull mode, can be broken down per RPC.
+package profiling
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+
+	"google.golang.org/grpc"
+)
+
+// LabelMethod is the pprof label holding the full gRPC method name
+const LabelMethod = "grpc_method"
+
+// UnaryServerInterceptor runs unary handlers with the method label
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		runtimepprof.Do(ctx, runtimepprof.Labels(LabelMethod, info.FullMethod), func(ctx context.Context) {
+			resp, err = handler(ctx, req)
+		})
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor runs stream handlers with the method label
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		runtimepprof.Do(ss.Context(), runtimepprof.Labels(LabelMethod, info.FullMethod), func(ctx context.Context) {
+			err = handler(srv, &labeledStream{ServerStream: ss, ctx: ctx})
+		})
+		return err
+	}
+}
+
+// labeledStream carries the labeled context to the stream handler
+type labeledStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *labeledStream) Context() context.Context { return s.ctx }
+
+// Handler serves the net/http/pprof endpoints under /debug/pprof/. Serve it
+// on a separate, internal-only listener: profiles expose program internals.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,56 @@
+package profiling
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context { return s.ctx }
+
+func TestInterceptorsLabelMethod(t *testing.T) {
+	const method = "/api.v1.UserService/GetUser"
+
+	var unary string
+	UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		unary, _ = pprof.Label(ctx, LabelMethod)
+		return nil, nil
+	})
+	if unary != method {
+		t.Errorf("unary handler label %s = %q, want %q", LabelMethod, unary, method)
+	}
+
+	var stream string
+	StreamServerInterceptor()(nil, &testStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: method}, func(srv interface{}, ss grpc.ServerStream) error {
+		stream, _ = pprof.Label(ss.Context(), LabelMethod)
+		return nil
+	})
+	if stream != method {
+		t.Errorf("stream handler label %s = %q, want %q", LabelMethod, stream, method)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/goroutine?debug=1"} {
+		resp, err := srv.Client().Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s status = %d, want %d", path, resp.StatusCode, http.StatusOK)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package queue provides a durable job queue with retries and dead-lettering.
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Errors returned by a Store
+var (
+	// ErrNotFound is returned when no job has the requested ID
+	ErrNotFound = errors.New("queue: job not found")
+
+	// ErrEmpty is returned by Claim when no job is due
+	ErrEmpty = errors.New("queue: no job due")
+
+	// ErrInvalidState is returned when a transition does not apply to the
+	// job's current state, e.g. retrying a job that is not dead
+	ErrInvalidState = errors.New("queue: invalid job state")
+)
+
+// State is the lifecycle state of a job
+type State string
+
+// Job states
+const (
+	// StatePending jobs wait for RunAt to pass
+	StatePending State = "pending"
+
+	// StateRunning jobs are claimed by a worker until their lease expires
+	StateRunning State = "running"
+
+	// StateSucceeded jobs completed without error
+	StateSucceeded State = "succeeded"
+
+	// StateDead jobs failed MaxAttempts times, or had no handler, and wait
+	// for an operator to retry them
+	StateDead State = "dead"
+
+	// StateCancelled jobs were cancelled before they ran
+	StateCancelled State = "cancelled"
+)
+
+// Job is a unit of work stored in the queue
+type Job struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+
+	// Payload is opaque to the queue, handlers usually hold JSON
+	Payload []byte `json:"payload"`
+
+	State       State  `json:"state"`
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"max_attempts"`
+	LastError   string `json:"last_error,omitempty"`
+
+	// Progress is the percentage of work done, reported by the handler with
+	// ReportProgress, and ProgressMessage describes the current step
+	Progress        int    `json:"progress,omitempty"`
+	ProgressMessage string `json:"progress_message,omitempty"`
+
+	// Result is the JSON result set by the handler with SetResult
+	Result []byte `json:"result,omitempty"`
+
+	// RunAt is when a pending job becomes due, or when a running job's lease
+	// expires
+	RunAt      time.Time `json:"run_at"`
+	CreateTime time.Time `json:"create_time"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// Decode unmarshals the JSON payload into v
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// SetResult encodes v as JSON and keeps it as the job's result, stored with
+// the job once the handler returns
+func (j *Job) SetResult(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("queue: encode result: %w", err)
+	}
+	j.Result = data
+	return nil
+}
+
+func (j *Job) clone() *Job {
+	c := *j
+	c.Payload = append([]byte(nil), j.Payload...)
+	if j.Result != nil {
+		c.Result = append([]byte(nil), j.Result...)
+	}
+	return &c
+}
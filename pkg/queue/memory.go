@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store. Jobs do not survive a restart, so use
+// it for tests and local development only.
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]*Job)}
+}
+
+// Add stores a new pending job
+func (s *MemoryStore) Add(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; ok {
+		return fmt.Errorf("queue: job %s already exists", job.ID)
+	}
+	s.jobs[job.ID] = job.clone()
+	return nil
+}
+
+// Get returns the job with the given ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return job.clone(), nil
+}
+
+// Claim marks the earliest due job as running
+func (s *MemoryStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next *Job
+	for _, job := range s.jobs {
+		if job.State != StatePending && job.State != StateRunning {
+			continue
+		}
+		if job.RunAt.After(now) {
+			continue
+		}
+		if next == nil || lessByRunAt(job, next) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, ErrEmpty
+	}
+
+	next.State = StateRunning
+	next.RunAt = now.Add(lease)
+	next.UpdateTime = now
+	return next.clone(), nil
+}
+
+// Save writes back a claimed job
+func (s *MemoryStore) Save(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; !ok {
+		return ErrNotFound
+	}
+	s.jobs[job.ID] = job.clone()
+	return nil
+}
+
+// Cancel moves a pending job to StateCancelled
+func (s *MemoryStore) Cancel(ctx context.Context, id string, now time.Time) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if job.State != StatePending {
+		return nil, fmt.Errorf("%w: job %s is %s", ErrInvalidState, id, job.State)
+	}
+	job.State = StateCancelled
+	job.UpdateTime = now
+	return job.clone(), nil
+}
+
+// List returns jobs in the given state ordered by RunAt
+func (s *MemoryStore) List(ctx context.Context, state State, offset, limit int) ([]*Job, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*Job
+	for _, job := range s.jobs {
+		if job.State == state {
+			matched = append(matched, job)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return lessByRunAt(matched[i], matched[j]) })
+
+	total := len(matched)
+	if offset >= total {
+		return []*Job{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	page := make([]*Job, 0, end-offset)
+	for _, job := range matched[offset:end] {
+		page = append(page, job.clone())
+	}
+	return page, total, nil
+}
+
+func lessByRunAt(a, b *Job) bool {
+	if !a.RunAt.Equal(b.RunAt) {
+		return a.RunAt.Before(b.RunAt)
+	}
+	return a.ID < b.ID
+}
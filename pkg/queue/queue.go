@@ -0,0 +1,402 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Handler processes jobs of one kind. Returning an error schedules a retry,
+// or dead-letters the job once it has used up its attempts. Wrap the error
+// with Permanent to dead-letter the job right away.
+type Handler func(ctx context.Context, job *Job) error
+
+// Permanent marks err as one that retrying cannot fix
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// progressKey is the context key of the job being run
+type progressKey struct{}
+
+// progressReporter saves progress updates of the running job
+type progressReporter struct {
+	queue *Queue
+	job   *Job
+}
+
+// ReportProgress records how far the running job has got, as a percentage
+// from 0 to 100, and saves it so clients polling the job can see it. It
+// does nothing when ctx does not belong to a handler.
+func ReportProgress(ctx context.Context, percent int, message string) error {
+	r, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok {
+		return nil
+	}
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	r.job.Progress = percent
+	r.job.ProgressMessage = message
+	r.job.UpdateTime = r.queue.opts.Clock.Now()
+	return r.queue.store.Save(ctx, r.job)
+}
+
+// Backoff computes exponential retry delays
+type Backoff struct {
+	// Initial is the delay before the first retry (default 1s)
+	Initial time.Duration
+
+	// Max caps the delay (default 5m)
+	Max time.Duration
+}
+
+// Delay returns the delay before retrying a job that failed attempt times:
+// Initial, 2*Initial, 4*Initial and so on, capped at Max
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := b.Initial
+	for i := 1; i < attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// Options configures a Queue
+type Options struct {
+	// Workers is the number of goroutines consuming jobs (default 2)
+	Workers int
+
+	// PollInterval is how long an idle worker waits before checking the
+	// store again (default 1s)
+	PollInterval time.Duration
+
+	// Lease is how long a claimed job may run before another worker may
+	// claim it again (default 5m). Handlers are cancelled when it expires.
+	Lease time.Duration
+
+	// MaxAttempts is the default number of attempts per job (default 5)
+	MaxAttempts int
+
+	Backoff Backoff
+
+	// Clock and IDs default to the real clock and UUIDs
+	Clock clock.Clock
+	IDs   idgen.Generator
+}
+
+// EnqueueOption customizes a single job
+type EnqueueOption func(*Job)
+
+// WithMaxAttempts overrides the queue's default number of attempts
+func WithMaxAttempts(n int) EnqueueOption {
+	return func(j *Job) {
+		j.MaxAttempts = n
+	}
+}
+
+// WithDelay makes the job due after d instead of immediately
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(j *Job) {
+		j.RunAt = j.RunAt.Add(d)
+	}
+}
+
+// WithRunAt makes the job due at t, e.g. to deactivate a user in 30 days.
+// Such jobs survive restarts with a durable store and can be cancelled until
+// they start.
+func WithRunAt(t time.Time) EnqueueOption {
+	return func(j *Job) {
+		j.RunAt = t
+	}
+}
+
+// Queue enqueues jobs into a Store and runs them with registered handlers
+type Queue struct {
+	store Store
+	log   logger.Logger
+	opts  Options
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	started  bool
+	stopped  bool
+
+	// ctx is passed to handlers and cancelled when Stop runs out of time
+	ctx      context.Context
+	cancel   context.CancelFunc
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New creates a Queue. Register handlers, then call Start to consume jobs.
+func New(store Store, log logger.Logger, opts Options) *Queue {
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = 5 * time.Minute
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Backoff.Initial <= 0 {
+		opts.Backoff.Initial = time.Second
+	}
+	if opts.Backoff.Max <= 0 {
+		opts.Backoff.Max = 5 * time.Minute
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.Real()
+	}
+	if opts.IDs == nil {
+		opts.IDs = idgen.NewUUID()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		store:    store,
+		log:      log,
+		opts:     opts,
+		handlers: make(map[string]Handler),
+		ctx:      ctx,
+		cancel:   cancel,
+		quit:     make(chan struct{}),
+	}
+}
+
+// Store returns the queue's store, e.g. for admin inspection
+func (q *Queue) Store() Store {
+	return q.store
+}
+
+// Register sets the handler for jobs of the given kind
+func (q *Queue) Register(kind string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+}
+
+// Enqueue stores a job of the given kind. A []byte payload is stored as is,
+// anything else is encoded as JSON.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload interface{}, opts ...EnqueueOption) (*Job, error) {
+	if kind == "" {
+		return nil, errors.New("queue: job kind is required")
+	}
+
+	data, ok := payload.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, fmt.Errorf("queue: encode payload: %w", err)
+		}
+	}
+
+	now := q.opts.Clock.Now()
+	job := &Job{
+		ID:          q.opts.IDs.NewID(),
+		Kind:        kind,
+		Payload:     data,
+		State:       StatePending,
+		MaxAttempts: q.opts.MaxAttempts,
+		RunAt:       now,
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	if err := q.store.Add(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Retry moves a dead job back to pending with a fresh set of attempts
+func (q *Queue) Retry(ctx context.Context, id string) (*Job, error) {
+	job, err := q.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.State != StateDead {
+		return nil, fmt.Errorf("%w: job %s is %s, not %s", ErrInvalidState, id, job.State, StateDead)
+	}
+
+	now := q.opts.Clock.Now()
+	job.State = StatePending
+	job.Attempts = 0
+	job.RunAt = now
+	job.UpdateTime = now
+	if err := q.store.Save(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Cancel cancels a job that has not started yet. It returns ErrInvalidState
+// if the job is already running or finished.
+func (q *Queue) Cancel(ctx context.Context, id string) (*Job, error) {
+	return q.store.Cancel(ctx, id, q.opts.Clock.Now())
+}
+
+// Start launches the consumer goroutines. Handlers do not inherit ctx, so a
+// cancelled startup context does not abort the drain in Stop.
+func (q *Queue) Start(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return errors.New("queue: stopped")
+	}
+	if q.started {
+		return nil
+	}
+	q.started = true
+
+	for i := 0; i < q.opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.consume()
+	}
+	return nil
+}
+
+// Stop stops claiming jobs and waits for running handlers. If ctx ends
+// first, handlers are cancelled and ctx's error is returned; their jobs go
+// back to the queue without counting the interrupted attempt.
+func (q *Queue) Stop(ctx context.Context) error {
+	q.mu.Lock()
+	q.stopped = true
+	q.mu.Unlock()
+	q.stopOnce.Do(func() { close(q.quit) })
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) consume() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.quit:
+			return
+		default:
+		}
+
+		job, err := q.store.Claim(q.ctx, q.opts.Clock.Now(), q.opts.Lease)
+		if err == nil {
+			q.process(job)
+			continue
+		}
+		if !errors.Is(err, ErrEmpty) && q.ctx.Err() == nil {
+			q.log.Error("Failed to claim job: %v", err)
+		}
+
+		select {
+		case <-q.quit:
+			return
+		case <-time.After(q.opts.PollInterval):
+		}
+	}
+}
+
+// process runs a claimed job and records the outcome
+func (q *Queue) process(job *Job) {
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Kind]
+	q.mu.RUnlock()
+
+	job.Attempts++
+	var err error
+	if ok {
+		ctx, cancel := context.WithTimeout(q.ctx, q.opts.Lease)
+		ctx = context.WithValue(ctx, progressKey{}, &progressReporter{queue: q, job: job})
+		err = q.run(ctx, handler, job)
+		cancel()
+	} else {
+		err = fmt.Errorf("no handler registered for kind %q", job.Kind)
+		job.Attempts = job.MaxAttempts
+	}
+
+	now := q.opts.Clock.Now()
+	job.UpdateTime = now
+	switch {
+	case err == nil:
+		job.State = StateSucceeded
+		job.LastError = ""
+		job.Progress = 100
+		job.RunAt = now
+	case ok && q.ctx.Err() != nil:
+		// Interrupted by Stop: checkpoint the job so it runs again right
+		// away, without using up an attempt
+		job.Attempts--
+		job.State = StatePending
+		job.RunAt = now
+		q.log.Warn("Job %s (%s) interrupted by shutdown, returned to the queue", job.ID, job.Kind)
+	case job.Attempts >= job.MaxAttempts || errors.As(err, new(*permanentError)):
+		job.State = StateDead
+		job.LastError = err.Error()
+		job.RunAt = now
+		q.log.Error("Job %s (%s) dead-lettered after %d attempt(s): %v", job.ID, job.Kind, job.Attempts, err)
+	default:
+		delay := q.opts.Backoff.Delay(job.Attempts)
+		job.State = StatePending
+		job.LastError = err.Error()
+		job.RunAt = now.Add(delay)
+		q.log.Warn("Job %s (%s) failed on attempt %d, retrying in %v: %v", job.ID, job.Kind, job.Attempts, delay, err)
+	}
+
+	// Use a fresh context so the outcome is recorded even while draining
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.store.Save(saveCtx, job); err != nil {
+		q.log.Error("Failed to save job %s: %v", job.ID, err)
+	}
+}
+
+// run calls the handler, turning a panic into an error
+func (q *Queue) run(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
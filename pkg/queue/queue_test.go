@@ -0,0 +1,304 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+func newTestQueue(store Store) *Queue {
+	return New(store, logger.Nop(), Options{
+		Workers:      2,
+		PollInterval: time.Millisecond,
+		MaxAttempts:  3,
+		Backoff:      Backoff{Initial: time.Millisecond, Max: 4 * time.Millisecond},
+		IDs:          idgen.NewSequential(),
+	})
+}
+
+// waitForState polls the store until the job reaches state
+func waitForState(t *testing.T, s Store, id string, state State) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := s.Get(context.Background(), id)
+		if err == nil && job.State == state {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s did not reach state %s, last = %+v", id, state, job)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 10 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := b.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestQueueRunsJobs(t *testing.T) {
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+
+	type email struct{ To string }
+	got := make(chan string, 1)
+	q.Register("email", func(ctx context.Context, job *Job) error {
+		var e email
+		if err := job.Decode(&e); err != nil {
+			return err
+		}
+		got <- e.To
+		return nil
+	})
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	job, err := q.Enqueue(context.Background(), "email", email{To: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Enqueue() unexpected error: %v", err)
+	}
+	if to := <-got; to != "alice@example.com" {
+		t.Errorf("handler got %q, want alice@example.com", to)
+	}
+	done := waitForState(t, store, job.ID, StateSucceeded)
+	if done.Attempts != 1 {
+		t.Errorf("Attempts = %d, want 1", done.Attempts)
+	}
+}
+
+func TestQueueRetriesThenSucceeds(t *testing.T) {
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+
+	var calls atomic.Int64
+	q.Register("flaky", func(ctx context.Context, job *Job) error {
+		if calls.Add(1) < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	job, _ := q.Enqueue(context.Background(), "flaky", nil)
+	done := waitForState(t, store, job.ID, StateSucceeded)
+	if done.Attempts != 3 || done.LastError != "" {
+		t.Errorf("job = %+v, want 3 attempts and no error", done)
+	}
+}
+
+func TestQueueDeadLetterAndRetry(t *testing.T) {
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+
+	var fail atomic.Bool
+	fail.Store(true)
+	q.Register("webhook", func(ctx context.Context, job *Job) error {
+		if fail.Load() {
+			panic("endpoint exploded")
+		}
+		return nil
+	})
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	job, _ := q.Enqueue(context.Background(), "webhook", []byte(`{}`), WithMaxAttempts(2))
+	dead := waitForState(t, store, job.ID, StateDead)
+	if dead.Attempts != 2 || dead.LastError == "" {
+		t.Errorf("dead job = %+v, want 2 attempts and an error", dead)
+	}
+
+	if _, err := q.Retry(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Retry() error = %v, want %v", err, ErrNotFound)
+	}
+
+	fail.Store(false)
+	if _, err := q.Retry(context.Background(), job.ID); err != nil {
+		t.Fatalf("Retry() unexpected error: %v", err)
+	}
+	waitForState(t, store, job.ID, StateSucceeded)
+
+	if _, err := q.Retry(context.Background(), job.ID); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Retry() of succeeded job error = %v, want %v", err, ErrInvalidState)
+	}
+}
+
+func TestQueueUnknownKindIsDeadLettered(t *testing.T) {
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	job, _ := q.Enqueue(context.Background(), "unknown", nil)
+	if dead := waitForState(t, store, job.ID, StateDead); dead.LastError == "" {
+		t.Errorf("dead job has no error")
+	}
+}
+
+func TestQueueDelayedJob(t *testing.T) {
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+	q.Register("later", func(ctx context.Context, job *Job) error { return nil })
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	job, _ := q.Enqueue(context.Background(), "later", nil, WithDelay(time.Hour))
+	time.Sleep(20 * time.Millisecond)
+	if got, _ := store.Get(context.Background(), job.ID); got.State != StatePending {
+		t.Errorf("delayed job state = %s, want %s", got.State, StatePending)
+	}
+}
+
+func TestQueueScheduledJobCancel(t *testing.T) {
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+
+	var ran atomic.Bool
+	q.Register("deactivate", func(ctx context.Context, job *Job) error {
+		ran.Store(true)
+		return nil
+	})
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	job, err := q.Enqueue(context.Background(), "deactivate", nil, WithRunAt(time.Now().Add(30*24*time.Hour)))
+	if err != nil {
+		t.Fatalf("Enqueue() unexpected error: %v", err)
+	}
+	if _, err := q.Cancel(context.Background(), job.ID); err != nil {
+		t.Fatalf("Cancel() unexpected error: %v", err)
+	}
+	if _, err := q.Cancel(context.Background(), job.ID); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Cancel() twice error = %v, want %v", err, ErrInvalidState)
+	}
+
+	soon, _ := q.Enqueue(context.Background(), "deactivate", nil, WithRunAt(time.Now().Add(10*time.Millisecond)))
+	waitForState(t, store, soon.ID, StateSucceeded)
+	if got, _ := store.Get(context.Background(), job.ID); got.State != StateCancelled {
+		t.Errorf("cancelled job state = %s, want %s", got.State, StateCancelled)
+	}
+}
+
+func TestQueueStopDeadline(t *testing.T) {
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+
+	started := make(chan struct{})
+	q.Register("stuck", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	q.Start(context.Background())
+	q.Enqueue(context.Background(), "stuck", nil, WithMaxAttempts(1))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestQueueStopCheckpointsInterruptedJobs(t *testing.T) {
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+
+	started := make(chan struct{})
+	q.Register("slow", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	q.Start(context.Background())
+
+	job, _ := q.Enqueue(context.Background(), "slow", nil)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	got, err := store.Get(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	if got.State != StatePending || got.Attempts != 0 {
+		t.Errorf("interrupted job = %+v, want pending with 0 attempts", got)
+	}
+}
+
+func TestQueuePermanentErrorSkipsRetries(t *testing.T) {
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+
+	q.Register("reject", func(ctx context.Context, job *Job) error {
+		return Permanent(errors.New("404 Not Found"))
+	})
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	job, _ := q.Enqueue(context.Background(), "reject", nil)
+	dead := waitForState(t, store, job.ID, StateDead)
+	if dead.Attempts != 1 || dead.LastError != "404 Not Found" {
+		t.Errorf("dead job = %+v, want 1 attempt and the handler error", dead)
+	}
+}
+
+func TestQueueReportsProgressAndResult(t *testing.T) {
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+
+	halfway := make(chan struct{})
+	resume := make(chan struct{})
+	q.Register("import", func(ctx context.Context, job *Job) error {
+		if err := ReportProgress(ctx, 50, "imported 5 of 10"); err != nil {
+			return err
+		}
+		close(halfway)
+		<-resume
+		return job.SetResult(map[string]int{"imported": 10})
+	})
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	job, _ := q.Enqueue(context.Background(), "import", nil)
+	<-halfway
+	running, _ := store.Get(context.Background(), job.ID)
+	if running.Progress != 50 || running.ProgressMessage != "imported 5 of 10" {
+		t.Errorf("running job = %+v, want progress 50 with message", running)
+	}
+	close(resume)
+
+	done := waitForState(t, store, job.ID, StateSucceeded)
+	if done.Progress != 100 || string(done.Result) != `{"imported":10}` {
+		t.Errorf("finished job progress = %d result = %s, want 100 and the result", done.Progress, done.Result)
+	}
+
+	if err := ReportProgress(context.Background(), 10, ""); err != nil {
+		t.Errorf("ReportProgress() outside a handler error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,242 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// claimScript atomically moves the earliest due job, pending or with an
+// expired lease, into the running set and returns its ID
+var claimScript = redis.NewScript(`
+local now = ARGV[1]
+for _, key in ipairs({KEYS[1], KEYS[2]}) do
+	local ids = redis.call('ZRANGEBYSCORE', key, '-inf', now, 'LIMIT', 0, 1)
+	if #ids > 0 then
+		redis.call('ZREM', key, ids[1])
+		redis.call('ZADD', KEYS[2], ARGV[2], ids[1])
+		return ids[1]
+	end
+end
+return false
+`)
+
+// cancelScript atomically moves a job from the pending to the cancelled set,
+// returning 0 if it was not pending
+var cancelScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+return 1
+`)
+
+var allStates = []State{StatePending, StateRunning, StateSucceeded, StateDead, StateCancelled}
+
+// RedisStore is a Store backed by Redis. Jobs are kept as JSON in a hash,
+// with one sorted set per state indexed by RunAt.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore creates a RedisStore whose keys start with prefix
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "queue"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) jobsKey() string {
+	return s.prefix + ":jobs"
+}
+
+func (s *RedisStore) stateKey(state State) string {
+	return s.prefix + ":state:" + string(state)
+}
+
+// Add stores a new pending job
+func (s *RedisStore) Add(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("queue: encode job %s: %w", job.ID, err)
+	}
+
+	added, err := s.client.HSetNX(ctx, s.jobsKey(), job.ID, data).Result()
+	if err != nil {
+		return fmt.Errorf("queue: add job %s: %w", job.ID, err)
+	}
+	if !added {
+		return fmt.Errorf("queue: job %s already exists", job.ID)
+	}
+	if err := s.client.ZAdd(ctx, s.stateKey(job.State), score(job.RunAt, job.ID)).Err(); err != nil {
+		return fmt.Errorf("queue: add job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// Get returns the job with the given ID
+func (s *RedisStore) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := s.client.HGet(ctx, s.jobsKey(), id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("queue: get job %s: %w", id, err)
+	}
+	return decodeJob(data)
+}
+
+// Claim marks the earliest due job as running
+func (s *RedisStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (*Job, error) {
+	expiry := now.Add(lease)
+	keys := []string{s.stateKey(StatePending), s.stateKey(StateRunning)}
+	id, err := claimScript.Run(ctx, s.client, keys,
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(expiry.UnixMilli(), 10),
+	).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrEmpty
+	}
+	if err != nil {
+		return nil, fmt.Errorf("queue: claim: %w", err)
+	}
+
+	job, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	job.State = StateRunning
+	job.RunAt = expiry
+	job.UpdateTime = now
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("queue: encode job %s: %w", job.ID, err)
+	}
+	if err := s.client.HSet(ctx, s.jobsKey(), job.ID, data).Err(); err != nil {
+		return nil, fmt.Errorf("queue: claim job %s: %w", job.ID, err)
+	}
+	return job, nil
+}
+
+// Cancel moves a pending job to StateCancelled
+func (s *RedisStore) Cancel(ctx context.Context, id string, now time.Time) (*Job, error) {
+	job, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{s.stateKey(StatePending), s.stateKey(StateCancelled)}
+	moved, err := cancelScript.Run(ctx, s.client, keys, id, strconv.FormatInt(job.RunAt.UnixMilli(), 10)).Int()
+	if err != nil {
+		return nil, fmt.Errorf("queue: cancel job %s: %w", id, err)
+	}
+	if moved == 0 {
+		// Re-read so the error reports the state that won the race
+		if current, err := s.Get(ctx, id); err == nil {
+			job = current
+		}
+		return nil, fmt.Errorf("%w: job %s is %s", ErrInvalidState, id, job.State)
+	}
+
+	job.State = StateCancelled
+	job.UpdateTime = now
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("queue: encode job %s: %w", id, err)
+	}
+	if err := s.client.HSet(ctx, s.jobsKey(), id, data).Err(); err != nil {
+		return nil, fmt.Errorf("queue: cancel job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+// Save writes back a claimed job
+func (s *RedisStore) Save(ctx context.Context, job *Job) error {
+	exists, err := s.client.HExists(ctx, s.jobsKey(), job.ID).Result()
+	if err != nil {
+		return fmt.Errorf("queue: save job %s: %w", job.ID, err)
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("queue: encode job %s: %w", job.ID, err)
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, state := range allStates {
+			if state != job.State {
+				pipe.ZRem(ctx, s.stateKey(state), job.ID)
+			}
+		}
+		pipe.ZAdd(ctx, s.stateKey(job.State), score(job.RunAt, job.ID))
+		pipe.HSet(ctx, s.jobsKey(), job.ID, data)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("queue: save job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// List returns jobs in the given state ordered by RunAt
+func (s *RedisStore) List(ctx context.Context, state State, offset, limit int) ([]*Job, int, error) {
+	key := s.stateKey(state)
+	total, err := s.client.ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("queue: list %s jobs: %w", state, err)
+	}
+	if limit <= 0 || int64(offset) >= total {
+		return []*Job{}, int(total), nil
+	}
+
+	ids, err := s.client.ZRange(ctx, key, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("queue: list %s jobs: %w", state, err)
+	}
+	if len(ids) == 0 {
+		return []*Job{}, int(total), nil
+	}
+
+	values, err := s.client.HMGet(ctx, s.jobsKey(), ids...).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("queue: list %s jobs: %w", state, err)
+	}
+
+	jobs := make([]*Job, 0, len(values))
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			// Removed between the two calls
+			continue
+		}
+		job, err := decodeJob([]byte(data))
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, int(total), nil
+}
+
+func score(t time.Time, id string) redis.Z {
+	return redis.Z{Score: float64(t.UnixMilli()), Member: id}
+}
+
+func decodeJob(data []byte) (*Job, error) {
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("queue: decode job: %w", err)
+	}
+	return &job, nil
+}
@@ -0,0 +1,33 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Store persists jobs. Claim must be safe for concurrent use by several
+// processes sharing the same backend.
+type Store interface {
+	// Add stores a new pending job
+	Add(ctx context.Context, job *Job) error
+
+	// Get returns the job with the given ID
+	Get(ctx context.Context, id string) (*Job, error)
+
+	// Claim marks the earliest due pending job as running until now+lease
+	// and returns it. Running jobs whose lease expired are claimed again, so
+	// a crashed worker does not lose its job. Returns ErrEmpty if none is due.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (*Job, error)
+
+	// Save writes back a job previously returned by Claim after its state,
+	// attempts, error and run time were updated
+	Save(ctx context.Context, job *Job) error
+
+	// Cancel moves a pending job to StateCancelled at time now. It returns
+	// ErrInvalidState if the job is no longer pending, e.g. already claimed.
+	Cancel(ctx context.Context, id string, now time.Time) (*Job, error)
+
+	// List returns jobs in the given state ordered by RunAt, and the total
+	// number of jobs in that state
+	List(ctx context.Context, state State, offset, limit int) ([]*Job, int, error)
+}
@@ -0,0 +1,147 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return NewMemoryStore() })
+}
+
+func TestRedisStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		mr := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewRedisStore(client, "test")
+	})
+}
+
+// testStore checks the behavior every Store implementation must share
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	ctx := context.Background()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newJob := func(id string, runAt time.Time) *Job {
+		return &Job{ID: id, Kind: "test", Payload: []byte(`{"n":1}`), State: StatePending, MaxAttempts: 3, RunAt: runAt, CreateTime: base, UpdateTime: base}
+	}
+
+	t.Run("add and get", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Add(ctx, newJob("a", base)); err != nil {
+			t.Fatalf("Add() unexpected error: %v", err)
+		}
+		if err := s.Add(ctx, newJob("a", base)); err == nil {
+			t.Errorf("Add() duplicate expected error")
+		}
+		got, err := s.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Get() unexpected error: %v", err)
+		}
+		if got.Kind != "test" || string(got.Payload) != `{"n":1}` || !got.RunAt.Equal(base) {
+			t.Errorf("Get() = %+v", got)
+		}
+		if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("claim due jobs in order", func(t *testing.T) {
+		s := newStore(t)
+		s.Add(ctx, newJob("later", base.Add(time.Minute)))
+		s.Add(ctx, newJob("first", base.Add(-time.Minute)))
+		s.Add(ctx, newJob("second", base))
+
+		for _, want := range []string{"first", "second"} {
+			job, err := s.Claim(ctx, base, time.Minute)
+			if err != nil {
+				t.Fatalf("Claim() unexpected error: %v", err)
+			}
+			if job.ID != want || job.State != StateRunning || !job.RunAt.Equal(base.Add(time.Minute)) {
+				t.Errorf("Claim() = %s %s %v, want %s running until lease end", job.ID, job.State, job.RunAt, want)
+			}
+		}
+		if _, err := s.Claim(ctx, base, time.Minute); !errors.Is(err, ErrEmpty) {
+			t.Errorf("Claim() error = %v, want %v", err, ErrEmpty)
+		}
+	})
+
+	t.Run("expired lease is claimed again", func(t *testing.T) {
+		s := newStore(t)
+		s.Add(ctx, newJob("a", base))
+		if _, err := s.Claim(ctx, base, time.Minute); err != nil {
+			t.Fatalf("Claim() unexpected error: %v", err)
+		}
+		if _, err := s.Claim(ctx, base.Add(30*time.Second), time.Minute); !errors.Is(err, ErrEmpty) {
+			t.Errorf("Claim() during lease error = %v, want %v", err, ErrEmpty)
+		}
+		job, err := s.Claim(ctx, base.Add(2*time.Minute), time.Minute)
+		if err != nil || job.ID != "a" {
+			t.Errorf("Claim() after lease = %v, %v, want job a", job, err)
+		}
+	})
+
+	t.Run("save and list by state", func(t *testing.T) {
+		s := newStore(t)
+		s.Add(ctx, newJob("a", base))
+		s.Add(ctx, newJob("b", base.Add(time.Second)))
+		s.Add(ctx, newJob("c", base.Add(2*time.Second)))
+
+		job, _ := s.Claim(ctx, base, time.Minute)
+		job.State = StateDead
+		job.LastError = "boom"
+		if err := s.Save(ctx, job); err != nil {
+			t.Fatalf("Save() unexpected error: %v", err)
+		}
+		if err := s.Save(ctx, newJob("missing", base)); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Save() error = %v, want %v", err, ErrNotFound)
+		}
+
+		dead, total, err := s.List(ctx, StateDead, 0, 10)
+		if err != nil || total != 1 || len(dead) != 1 || dead[0].LastError != "boom" {
+			t.Errorf("List(dead) = %v, %d, %v", dead, total, err)
+		}
+		pending, total, err := s.List(ctx, StatePending, 1, 10)
+		if err != nil || total != 2 || len(pending) != 1 || pending[0].ID != "c" {
+			t.Errorf("List(pending, offset 1) = %v, %d, %v", pending, total, err)
+		}
+		if running, total, _ := s.List(ctx, StateRunning, 0, 10); total != 0 || len(running) != 0 {
+			t.Errorf("List(running) = %v, %d, want none", running, total)
+		}
+	})
+
+	t.Run("cancel pending only", func(t *testing.T) {
+		s := newStore(t)
+		s.Add(ctx, newJob("a", base.Add(time.Hour)))
+		s.Add(ctx, newJob("b", base))
+
+		job, err := s.Cancel(ctx, "a", base)
+		if err != nil || job.State != StateCancelled {
+			t.Fatalf("Cancel() = %v, %v, want cancelled job", job, err)
+		}
+		if got, _ := s.Get(ctx, "a"); got.State != StateCancelled {
+			t.Errorf("Get() state = %s, want %s", got.State, StateCancelled)
+		}
+		if _, err := s.Claim(ctx, base.Add(2*time.Hour), time.Minute); err != nil {
+			t.Fatalf("Claim() unexpected error: %v", err)
+		}
+		if _, err := s.Claim(ctx, base.Add(2*time.Hour), time.Minute); !errors.Is(err, ErrEmpty) {
+			t.Errorf("Claim() claimed a cancelled job, error = %v", err)
+		}
+		if _, err := s.Cancel(ctx, "b", base); !errors.Is(err, ErrInvalidState) {
+			t.Errorf("Cancel() running job error = %v, want %v", err, ErrInvalidState)
+		}
+		if _, err := s.Cancel(ctx, "missing", base); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Cancel() error = %v, want %v", err, ErrNotFound)
+		}
+		if cancelled, total, _ := s.List(ctx, StateCancelled, 0, 10); total != 1 || cancelled[0].ID != "a" {
+			t.Errorf("List(cancelled) = %v, %d, want job a", cancelled, total)
+		}
+	})
+}
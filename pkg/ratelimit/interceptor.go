@@ -0,0 +1,290 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RetryAfterHeader is the response header carrying the retry delay in
+// seconds. The HTTP gateway forwards it as Retry-After.
+const RetryAfterHeader = "retry-after"
+
+// Ways a Rule tells callers apart
+const (
+	// ByCaller limits each authenticated identity, else each IP
+	ByCaller = "caller"
+
+	// ByIP limits each client IP
+	ByIP = "ip"
+
+	// ByGlobal limits all callers together
+	ByGlobal = "global"
+
+	// ByMetadata followed by a metadata key, or an HTTP header, limits
+	// each value of it, e.g. "metadata:x-api-key". Callers without one are
+	// limited by caller.
+	ByMetadata = "metadata:"
+)
+
+// Rule limits each caller to Limit calls per Window on methods under
+// Method, a full method or a prefix such as "/api.v1.UserService/". For
+// the HTTP middleware Method is a URL path prefix such as "/v1/users".
+type Rule struct {
+	Method string
+	Limit  int
+	Window time.Duration
+
+	// Strategy is SlidingWindow (default) or TokenBucket
+	Strategy string
+
+	// Burst is how many calls a token bucket allows at once (default
+	// Limit)
+	Burst int
+
+	// By is ByCaller (default), ByIP, ByGlobal or ByMetadata and a key
+	By string
+}
+
+// Stats counts the interceptor's decisions
+type Stats struct {
+	Allowed uint64
+	Limited uint64
+
+	// Errors counts backend failures. Those calls are allowed.
+	Errors uint64
+}
+
+// Interceptor applies rules to calls, keyed by caller
+type Interceptor struct {
+	log     logger.Logger
+	limiter Limiter
+
+	// rules are swapped whole by SetRules, longest Method first
+	rules atomic.Pointer[[]Rule]
+
+	allowed atomic.Uint64
+	limited atomic.Uint64
+	errors  atomic.Uint64
+}
+
+// NewInterceptor creates an Interceptor counting in limiter. Rules without
+// a positive Limit and Window are ignored.
+func NewInterceptor(log logger.Logger, limiter Limiter, rules []Rule) (*Interceptor, error) {
+	i := &Interceptor{log: log, limiter: limiter}
+	if err := i.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// SetRules replaces the rules, leaving them as they were if any is
+// invalid. Calls already counted stay counted: a caller keeps the calls it
+// made under a rule whose Method is unchanged.
+func (i *Interceptor) SetRules(rules []Rule) error {
+	var checked []Rule
+	for _, r := range rules {
+		if r.Limit <= 0 || r.Window <= 0 {
+			continue
+		}
+		switch r.Strategy {
+		case "":
+			r.Strategy = SlidingWindow
+		case SlidingWindow, TokenBucket:
+		default:
+			return fmt.Errorf("ratelimit: rule %s: unknown strategy %q", r.Method, r.Strategy)
+		}
+		if r.Burst < 0 {
+			return fmt.Errorf("ratelimit: rule %s: negative burst", r.Method)
+		}
+		if r.Burst == 0 {
+			r.Burst = r.Limit
+		}
+		switch {
+		case r.By == "":
+			r.By = ByCaller
+		case r.By == ByCaller, r.By == ByIP, r.By == ByGlobal:
+		case strings.HasPrefix(r.By, ByMetadata) && len(r.By) > len(ByMetadata):
+			r.By = strings.ToLower(r.By)
+		default:
+			return fmt.Errorf("ratelimit: rule %s: unknown by %q", r.Method, r.By)
+		}
+		checked = append(checked, r)
+	}
+	// Longest first so the most specific rule wins
+	sort.SliceStable(checked, func(a, b int) bool { return len(checked[a].Method) > len(checked[b].Method) })
+	i.rules.Store(&checked)
+	return nil
+}
+
+// Stats returns the decision counts
+func (i *Interceptor) Stats() Stats {
+	return Stats{Allowed: i.allowed.Load(), Limited: i.limited.Load(), Errors: i.errors.Load()}
+}
+
+// UnaryServerInterceptor limits unary calls
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := i.allow(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor limits streaming calls when they start
+func (i *Interceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := i.allow(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// allow counts the call against its rule, returning the rejection when the
+// caller is over the limit. Backend failures fail open: an unavailable
+// Redis should not take the service down with it.
+func (i *Interceptor) allow(ctx context.Context, fullMethod string) error {
+	rule, ok := i.rule(fullMethod)
+	if !ok {
+		return nil
+	}
+	r, ok := i.take(ctx, rule, rule.Method+"|"+subject(ctx, rule.By), fullMethod)
+	if ok {
+		return nil
+	}
+	return exhausted(ctx, rule, r.RetryAfter)
+}
+
+// take counts a call under key with the rule's strategy, reporting whether
+// it is allowed
+func (i *Interceptor) take(ctx context.Context, rule Rule, key, target string) (Result, bool) {
+	var r Result
+	var err error
+	if rule.Strategy == TokenBucket {
+		r, err = i.limiter.Take(ctx, key, rule.Limit, rule.Window, rule.Burst)
+	} else {
+		r, err = i.limiter.Allow(ctx, key, rule.Limit, rule.Window)
+	}
+	if err != nil {
+		i.errors.Add(1)
+		i.log.Warn("Rate limiter failed for %s, allowing: %v", target, err)
+		return r, true
+	}
+	if r.Allowed {
+		i.allowed.Add(1)
+		return r, true
+	}
+	i.limited.Add(1)
+	return r, false
+}
+
+func (i *Interceptor) rule(fullMethod string) (Rule, bool) {
+	for _, r := range *i.rules.Load() {
+		if strings.HasPrefix(fullMethod, r.Method) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// exhausted builds the rejection, telling callers when to retry
+func exhausted(ctx context.Context, rule Rule, retryAfter time.Duration) error {
+	return Exhausted(ctx, limitMessage(rule), retryAfter)
+}
+
+func limitMessage(rule Rule) string {
+	return fmt.Sprintf("rate limit of %d per %v exceeded", rule.Limit, rule.Window)
+}
+
+// Exhausted builds a RESOURCE_EXHAUSTED rejection with msg, telling callers
+// when to retry with RetryInfo and the retry-after header, for limits
+// enforced outside an Interceptor
+func Exhausted(ctx context.Context, msg string, retryAfter time.Duration) error {
+	grpc.SetHeader(ctx, metadata.Pairs(RetryAfterHeader, retrySeconds(retryAfter)))
+	return exhaustedStatus(msg, retryAfter).Err()
+}
+
+func exhaustedStatus(msg string, retryAfter time.Duration) *status.Status {
+	st := status.New(codes.ResourceExhausted, msg)
+	if withInfo, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+		st = withInfo
+	}
+	return st
+}
+
+// retrySeconds rounds retryAfter up to whole seconds, at least one
+func retrySeconds(retryAfter time.Duration) string {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	return strconv.FormatInt(max(seconds, 1), 10)
+}
+
+// subject identifies who a call is counted against, told apart by
+func subject(ctx context.Context, by string) string {
+	switch {
+	case by == ByGlobal:
+		return "global"
+	case by == ByIP:
+		return "ip:" + clientIP(ctx)
+	case strings.HasPrefix(by, ByMetadata):
+		md, _ := metadata.FromIncomingContext(ctx)
+		if v := md.Get(strings.TrimPrefix(by, ByMetadata)); len(v) > 0 && v[0] != "" {
+			return "md:" + v[0]
+		}
+	}
+	return caller(ctx)
+}
+
+// caller identifies who is limited: the authenticated identity, else the
+// client's IP. Calls through the HTTP gateway arrive from loopback, so for
+// those the address the gateway saw, appended last to x-forwarded-for, is
+// used instead.
+func caller(ctx context.Context) string {
+	if name, ok := auth.IdentityFromContext(ctx); ok {
+		return "id:" + name
+	}
+	return "ip:" + clientIP(ctx)
+}
+
+// clientIP returns the IP of the client, or of the client of the HTTP
+// gateway for calls through it
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return forwardedIP(p.Addr.String(), md.Get("x-forwarded-for"))
+}
+
+// forwardedIP returns the host of addr, or when that is loopback, as for
+// calls from the gateway or a local proxy, the last hop of forwarded
+func forwardedIP(addr string, forwarded []string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() && len(forwarded) > 0 {
+		hops := strings.Split(forwarded[len(forwarded)-1], ",")
+		if last := strings.TrimSpace(hops[len(hops)-1]); last != "" {
+			return last
+		}
+	}
+	return host
+}
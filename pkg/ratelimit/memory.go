@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+)
+
+// sweepEvery is how many calls pass between sweeps of expired counters
+const sweepEvery = 1024
+
+// MemoryLimiter counts in process memory. Each replica enforces its own
+// limits, so a fleet of n replicas allows up to n times the limit.
+type MemoryLimiter struct {
+	clock clock.Clock
+
+	mu       sync.Mutex
+	counters map[string]*counter
+	buckets  map[string]*bucket
+	calls    int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+
+	// expires is when the bucket is full again
+	expires time.Time
+}
+
+type counter struct {
+	window     int64
+	prev, curr int
+
+	// expires is when both counts have aged out of the sliding window
+	expires time.Time
+}
+
+// NewMemoryLimiter creates a MemoryLimiter. A nil clock uses the real one.
+func NewMemoryLimiter(c clock.Clock) *MemoryLimiter {
+	if c == nil {
+		c = clock.Real()
+	}
+	return &MemoryLimiter{clock: c, counters: make(map[string]*counter), buckets: make(map[string]*bucket)}
+}
+
+// Allow counts a request under key
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	now := l.clock.Now()
+	idx, elapsed := windowOf(now, window)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count(now)
+
+	c, ok := l.counters[key]
+	if !ok {
+		c = &counter{window: idx}
+		l.counters[key] = c
+	}
+	switch {
+	case idx == c.window+1:
+		c.prev, c.curr = c.curr, 0
+	case idx > c.window+1:
+		c.prev, c.curr = 0, 0
+	}
+	c.window = idx
+	c.expires = now.Add(2*window - elapsed)
+
+	r := decide(c.prev, c.curr, limit, elapsed, window)
+	if r.Allowed {
+		c.curr++
+	}
+	return r, nil
+}
+
+// Take takes a token from the bucket under key
+func (l *MemoryLimiter) Take(ctx context.Context, key string, limit int, window time.Duration, burst int) (Result, error) {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	var r Result
+	r, b.tokens = take(refill(b.tokens, now.Sub(b.last), limit, window, burst), limit, window)
+	b.last = now
+	b.expires = now.Add(fullIn(b.tokens, limit, window, burst))
+	return r, nil
+}
+
+// count counts a call, sweeping every sweepEvery calls. l.mu must be held.
+func (l *MemoryLimiter) count(now time.Time) {
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweep(now)
+	}
+}
+
+// sweep drops expired counters and full buckets so idle callers do not
+// accumulate
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, c := range l.counters {
+		if !now.Before(c.expires) {
+			delete(l.counters, key)
+		}
+	}
+	for key, b := range l.buckets {
+		if !now.Before(b.expires) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Middleware limits HTTP requests by the rules, whose Method is a URL path
+// prefix. Requests over a limit get 429 Too Many Requests with Retry-After
+// and the status body the gateway sends for RESOURCE_EXHAUSTED. Callers are
+// told apart by IP, as identities are only known past the gateway; ByCaller
+// is ByIP here and ByMetadata reads a header.
+func (i *Interceptor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := i.rule(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		res, ok := i.take(r.Context(), rule, "http:"+rule.Method+"|"+requestSubject(r, rule.By), r.URL.Path)
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, _ := protojson.Marshal(exhaustedStatus(limitMessage(rule), res.RetryAfter).Proto())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", retrySeconds(res.RetryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write(body)
+	})
+}
+
+// requestSubject identifies who a request is counted against
+func requestSubject(r *http.Request, by string) string {
+	switch {
+	case by == ByGlobal:
+		return "global"
+	case strings.HasPrefix(by, ByMetadata):
+		if v := r.Header.Get(strings.TrimPrefix(by, ByMetadata)); v != "" {
+			return "md:" + v
+		}
+	}
+	return "ip:" + forwardedIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+}
@@ -0,0 +1,96 @@
+// Package ratelimit limits how often callers may call methods. Limits use a
+// sliding window counter by default: the count of the current fixed window
+// plus the previous window's count weighted by how much of it the sliding
+// window still covers. It needs two counters per key whatever the limit, so
+// the same limiter serves per-second rates and daily quotas. A token bucket
+// instead lets callers burst above the rate, then paces them to it. The
+// Redis backend shares the counters between replicas so limits hold
+// fleet-wide.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Strategies of a Rule
+const (
+	// SlidingWindow allows limit calls in any window
+	SlidingWindow = "sliding_window"
+
+	// TokenBucket allows bursts of up to burst calls, refilled at limit
+	// per window
+	TokenBucket = "token_bucket"
+)
+
+// Limiter counts requests per key
+type Limiter interface {
+	// Allow counts a request under key if fewer than limit were counted in
+	// the last window, and reports the outcome
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error)
+
+	// Take takes a token from the bucket under key, which holds up to
+	// burst tokens and gains limit tokens per window, and reports the
+	// outcome. A new bucket is full.
+	Take(ctx context.Context, key string, limit int, window time.Duration, burst int) (Result, error)
+}
+
+// Result is the outcome of Allow
+type Result struct {
+	Allowed bool
+
+	// Remaining is how many more requests the window allows now
+	Remaining int
+
+	// RetryAfter is when a denied request would next be allowed
+	RetryAfter time.Duration
+}
+
+// decide applies the sliding window to the previous and current fixed
+// window counts, elapsed into the current window
+func decide(prev, curr, limit int, elapsed, window time.Duration) Result {
+	weight := 1 - float64(elapsed)/float64(window)
+	estimate := float64(prev)*weight + float64(curr)
+	if estimate+1 <= float64(limit) {
+		return Result{Allowed: true, Remaining: int(math.Floor(float64(limit) - estimate - 1))}
+	}
+
+	// Denied: wait until the previous window's share has decayed enough,
+	// or until the next window when the current one alone is full
+	retry := window - elapsed
+	if curr < limit && prev > 0 {
+		needed := 1 - float64(limit-1-curr)/float64(prev)
+		retry = time.Duration((needed - (1 - weight)) * float64(window))
+	}
+	return Result{RetryAfter: max(retry, time.Millisecond)}
+}
+
+// windowOf returns the index of the fixed window now falls in and how far
+// into it now is
+func windowOf(now time.Time, window time.Duration) (int64, time.Duration) {
+	n := now.UnixNano()
+	return n / int64(window), time.Duration(n % int64(window))
+}
+
+// refill returns the tokens of a bucket that held tokens elapsed ago,
+// gaining limit per window up to burst
+func refill(tokens float64, elapsed time.Duration, limit int, window time.Duration, burst int) float64 {
+	return min(tokens+float64(limit)*float64(elapsed)/float64(window), float64(burst))
+}
+
+// take takes a token from a bucket holding tokens, returning the outcome
+// and the tokens left
+func take(tokens float64, limit int, window time.Duration) (Result, float64) {
+	if tokens >= 1 {
+		return Result{Allowed: true, Remaining: int(math.Floor(tokens - 1))}, tokens - 1
+	}
+	retry := time.Duration((1 - tokens) * float64(window) / float64(limit))
+	return Result{RetryAfter: max(retry, time.Millisecond)}, tokens
+}
+
+// fullIn returns how long a bucket holding tokens takes to fill up, after
+// which it need not be kept
+func fullIn(tokens float64, limit int, window time.Duration, burst int) time.Duration {
+	return time.Duration((float64(burst) - tokens) * float64(window) / float64(limit))
+}
@@ -0,0 +1,357 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/ratelimit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		name        string
+		advance     time.Duration
+		wantAllowed bool
+		wantRemain  int
+	}{
+		{name: "first", wantAllowed: true, wantRemain: 2},
+		{name: "second", advance: 10 * time.Second, wantAllowed: true, wantRemain: 1},
+		{name: "third", advance: 10 * time.Second, wantAllowed: true, wantRemain: 0},
+		{name: "over the limit", advance: 10 * time.Second, wantAllowed: false},
+		// 30s into the next window half of the previous 3 still counts
+		{name: "previous window weighs", advance: 60 * time.Second, wantAllowed: true, wantRemain: 0},
+		{name: "still weighed", advance: time.Second, wantAllowed: false},
+		// Two windows later nothing counts
+		{name: "idle", advance: 2 * time.Minute, wantAllowed: true, wantRemain: 2},
+	}
+
+	fake := clock.NewFake(start)
+	l := ratelimit.NewMemoryLimiter(fake)
+	for _, step := range steps {
+		fake.Advance(step.advance)
+		r, err := l.Allow(context.Background(), "caller", 3, time.Minute)
+		if err != nil {
+			t.Fatalf("%s: Allow() unexpected error: %v", step.name, err)
+		}
+		if r.Allowed != step.wantAllowed || (r.Allowed && r.Remaining != step.wantRemain) {
+			t.Errorf("%s: Allow() = %+v, want allowed %v with %d remaining", step.name, r, step.wantAllowed, step.wantRemain)
+		}
+		if !r.Allowed && r.RetryAfter <= 0 {
+			t.Errorf("%s: Allow() denied without a retry delay", step.name)
+		}
+	}
+
+	if r, _ := l.Allow(context.Background(), "other", 3, time.Minute); !r.Allowed {
+		t.Errorf("Allow() for another key denied, want keys counted apart")
+	}
+}
+
+func TestMemoryTokenBucket(t *testing.T) {
+	// 1 token per second, bursts of 3
+	steps := []struct {
+		name        string
+		advance     time.Duration
+		wantAllowed bool
+		wantRemain  int
+	}{
+		{name: "full bucket", wantAllowed: true, wantRemain: 2},
+		{name: "burst", wantAllowed: true, wantRemain: 1},
+		{name: "burst end", wantAllowed: true, wantRemain: 0},
+		{name: "empty", wantAllowed: false},
+		{name: "half a token", advance: 500 * time.Millisecond, wantAllowed: false},
+		{name: "refilled one", advance: 500 * time.Millisecond, wantAllowed: true, wantRemain: 0},
+		// Idle buckets refill up to the burst, no further
+		{name: "idle", advance: time.Hour, wantAllowed: true, wantRemain: 2},
+	}
+
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := ratelimit.NewMemoryLimiter(fake)
+	for _, step := range steps {
+		fake.Advance(step.advance)
+		r, err := l.Take(context.Background(), "caller", 1, time.Second, 3)
+		if err != nil {
+			t.Fatalf("%s: Take() unexpected error: %v", step.name, err)
+		}
+		if r.Allowed != step.wantAllowed || (r.Allowed && r.Remaining != step.wantRemain) {
+			t.Errorf("%s: Take() = %+v, want allowed %v with %d remaining", step.name, r, step.wantAllowed, step.wantRemain)
+		}
+		if !r.Allowed && (r.RetryAfter <= 0 || r.RetryAfter > time.Second) {
+			t.Errorf("%s: Take() denied with retry delay %v, want up to 1s", step.name, r.RetryAfter)
+		}
+	}
+}
+
+func TestRedisLimiterSharesLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	newReplica := func() *ratelimit.RedisLimiter {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return ratelimit.NewRedisLimiter(client, ratelimit.RedisOptions{Clock: fake})
+	}
+	replicas := []*ratelimit.RedisLimiter{newReplica(), newReplica()}
+
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		r, err := replicas[i%2].Allow(ctx, "caller", 4, time.Minute)
+		if err != nil {
+			t.Fatalf("Allow() unexpected error: %v", err)
+		}
+		if !r.Allowed || r.Remaining != 3-i {
+			t.Errorf("Allow() #%d = %+v, want allowed with %d remaining", i+1, r, 3-i)
+		}
+	}
+	for _, l := range replicas {
+		r, err := l.Allow(ctx, "caller", 4, time.Minute)
+		if err != nil {
+			t.Fatalf("Allow() unexpected error: %v", err)
+		}
+		if r.Allowed || r.RetryAfter <= 0 {
+			t.Errorf("Allow() over the fleet-wide limit = %+v, want denied with a retry delay", r)
+		}
+	}
+
+	fake.Advance(2 * time.Minute)
+	if r, err := replicas[0].Allow(ctx, "caller", 4, time.Minute); err != nil || !r.Allowed {
+		t.Errorf("Allow() two windows later = %+v, %v, want allowed", r, err)
+	}
+
+	mr.Close()
+	if _, err := replicas[0].Allow(ctx, "caller", 4, time.Minute); err == nil {
+		t.Errorf("Allow() with Redis down returned no error")
+	}
+}
+
+func TestRedisTokenBucket(t *testing.T) {
+	mr := miniredis.RunT(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	l := ratelimit.NewRedisLimiter(client, ratelimit.RedisOptions{Clock: fake})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if r, err := l.Take(ctx, "caller", 1, time.Second, 2); err != nil || !r.Allowed || r.Remaining != 1-i {
+			t.Errorf("Take() #%d = %+v, %v, want allowed with %d remaining", i+1, r, err, 1-i)
+		}
+	}
+	if r, err := l.Take(ctx, "caller", 1, time.Second, 2); err != nil || r.Allowed || r.RetryAfter <= 0 {
+		t.Errorf("Take() from an empty bucket = %+v, %v, want denied with a retry delay", r, err)
+	}
+	fake.Advance(time.Second)
+	if r, err := l.Take(ctx, "caller", 1, time.Second, 2); err != nil || !r.Allowed {
+		t.Errorf("Take() a second later = %+v, %v, want allowed", r, err)
+	}
+}
+
+// failingLimiter always fails, as when Redis is unreachable
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, int, time.Duration) (ratelimit.Result, error) {
+	return ratelimit.Result{}, context.DeadlineExceeded
+}
+
+func (failingLimiter) Take(context.Context, string, int, time.Duration, int) (ratelimit.Result, error) {
+	return ratelimit.Result{}, context.DeadlineExceeded
+}
+
+func newInterceptor(t *testing.T, limiter ratelimit.Limiter, rules ...ratelimit.Rule) *ratelimit.Interceptor {
+	t.Helper()
+	limits, err := ratelimit.NewInterceptor(logger.Nop(), limiter, rules)
+	if err != nil {
+		t.Fatalf("NewInterceptor() unexpected error: %v", err)
+	}
+	return limits
+}
+
+func TestInterceptor(t *testing.T) {
+	limits := newInterceptor(t, ratelimit.NewMemoryLimiter(nil),
+		ratelimit.Rule{Method: "/api.v1.UserService/", Limit: 100, Window: time.Minute},
+		ratelimit.Rule{Method: "/api.v1.UserService/CreateUser", Limit: 1, Window: time.Minute},
+	)
+	srv := testutil.NewServer(t, testutil.WithServerOptions(
+		grpc.ChainUnaryInterceptor(limits.UnaryServerInterceptor()),
+	))
+	ctx := context.Background()
+
+	if _, err := srv.Client.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "a@example.com", DisplayName: "A"}}); err != nil {
+		t.Fatalf("CreateUser() unexpected error: %v", err)
+	}
+	_, err := srv.Client.CreateUser(ctx, &apiv1.CreateUserRequest{User: &apiv1.User{Email: "b@example.com", DisplayName: "B"}})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("CreateUser() over the limit error = %v, want %v", err, codes.ResourceExhausted)
+	}
+	var retry *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if r, ok := d.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	if retry.GetRetryDelay().AsDuration() <= 0 {
+		t.Errorf("RetryInfo delay = %v, want positive", retry.GetRetryDelay().AsDuration())
+	}
+
+	// The most specific rule applies; the prefix rule still has room
+	if _, err := srv.Client.ListUsers(ctx, &apiv1.ListUsersRequest{}); err != nil {
+		t.Errorf("ListUsers() unexpected error: %v", err)
+	}
+
+	// Gateway callers are limited by the address the gateway saw, here the
+	// same loopback address as the gRPC caller
+	resp, err := srv.HTTPClient.Post(srv.URL+"/v1/users", "application/json", strings.NewReader(`{"user":{"email":"c@example.com"}}`))
+	if err != nil {
+		t.Fatalf("POST /v1/users unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("POST /v1/users over the limit = %d with Retry-After %q, want 429 with a delay", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	if stats := limits.Stats(); stats.Limited != 2 || stats.Errors != 0 {
+		t.Errorf("Stats() = %+v, want 2 limited", stats)
+	}
+}
+
+func TestInterceptorFailsOpen(t *testing.T) {
+	limits := newInterceptor(t, failingLimiter{}, ratelimit.Rule{Method: "/api.v1.UserService/", Limit: 1, Window: time.Minute})
+	srv := testutil.NewServer(t, testutil.WithServerOptions(
+		grpc.ChainUnaryInterceptor(limits.UnaryServerInterceptor()),
+	))
+	for i := 0; i < 3; i++ {
+		if _, err := srv.Client.ListUsers(context.Background(), &apiv1.ListUsersRequest{}); err != nil {
+			t.Errorf("ListUsers() with the backend failing error = %v, want allowed", err)
+		}
+	}
+	if stats := limits.Stats(); stats.Errors != 3 {
+		t.Errorf("Stats().Errors = %d, want 3", stats.Errors)
+	}
+}
+
+func TestInterceptorBy(t *testing.T) {
+	limits := newInterceptor(t, ratelimit.NewMemoryLimiter(nil),
+		ratelimit.Rule{Method: "/api.v1.UserService/ListUsers", Limit: 1, Window: time.Minute, By: "metadata:X-API-Key"},
+		ratelimit.Rule{Method: "/api.v1.UserService/GetUser", Limit: 1, Window: time.Minute, By: ratelimit.ByGlobal, Strategy: ratelimit.TokenBucket},
+	)
+	srv := testutil.NewServer(t, testutil.WithServerOptions(
+		grpc.ChainUnaryInterceptor(limits.UnaryServerInterceptor()),
+	))
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+	}
+
+	if _, err := srv.Client.ListUsers(withKey("a"), &apiv1.ListUsersRequest{}); err != nil {
+		t.Fatalf("ListUsers() unexpected error: %v", err)
+	}
+	if _, err := srv.Client.ListUsers(withKey("b"), &apiv1.ListUsersRequest{}); err != nil {
+		t.Errorf("ListUsers() with another key error = %v, want keys limited apart", err)
+	}
+	if _, err := srv.Client.ListUsers(withKey("a"), &apiv1.ListUsersRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("ListUsers() with the same key error = %v, want %v", err, codes.ResourceExhausted)
+	}
+
+	// One bucket for everyone: the second caller is limited whatever its key
+	srv.Client.GetUser(withKey("a"), &apiv1.GetUserRequest{Name: "users/missing"})
+	if _, err := srv.Client.GetUser(withKey("b"), &apiv1.GetUserRequest{Name: "users/missing"}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("GetUser() past the global limit error = %v, want %v", err, codes.ResourceExhausted)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limits := newInterceptor(t, ratelimit.NewMemoryLimiter(nil),
+		ratelimit.Rule{Method: "/v1/users", Limit: 1, Window: time.Minute, Strategy: ratelimit.TokenBucket, Burst: 2},
+	)
+	handler := limits.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(path, addr string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = addr
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := serve("/v1/users", "192.0.2.1:1234"); rec.Code != http.StatusOK {
+			t.Errorf("GET /v1/users #%d = %d, want 200 within the burst", i+1, rec.Code)
+		}
+	}
+	rec := serve("/v1/users/1", "192.0.2.1:1234")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("GET /v1/users/1 past the burst = %d with Retry-After %q, want 429 with a delay", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rec.Body.String(), "rate limit") {
+		t.Errorf("429 body = %q, want the status message", rec.Body.String())
+	}
+	if rec := serve("/v1/users", "192.0.2.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("GET /v1/users from another IP = %d, want 200", rec.Code)
+	}
+	if rec := serve("/v1/tasks", "192.0.2.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("GET /v1/tasks without a rule = %d, want 200", rec.Code)
+	}
+}
+
+func TestNewInterceptorInvalid(t *testing.T) {
+	for name, rule := range map[string]ratelimit.Rule{
+		"unknown strategy": {Strategy: "leaky_bucket"},
+		"negative burst":   {Strategy: ratelimit.TokenBucket, Burst: -1},
+		"unknown by":       {By: "user"},
+		"metadata key":     {By: ratelimit.ByMetadata},
+	} {
+		rule.Method, rule.Limit, rule.Window = "/api.v1.UserService/", 1, time.Minute
+		if _, err := ratelimit.NewInterceptor(logger.Nop(), ratelimit.NewMemoryLimiter(nil), []ratelimit.Rule{rule}); err == nil {
+			t.Errorf("NewInterceptor() with %s expected error", name)
+		}
+	}
+}
+
+func TestSetRules(t *testing.T) {
+	limits := newInterceptor(t, ratelimit.NewMemoryLimiter(nil),
+		ratelimit.Rule{Method: "/api.v1.UserService/", Limit: 1, Window: time.Minute},
+	)
+	call := func() error {
+		_, err := limits.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/api.v1.UserService/GetUser"},
+			func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+		return err
+	}
+	call()
+	if err := call(); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("call over the limit error = %v, want %v", err, codes.ResourceExhausted)
+	}
+
+	if err := limits.SetRules([]ratelimit.Rule{{Method: "/api.v1.UserService/", Limit: 1, Window: time.Minute, By: "user"}}); err == nil {
+		t.Error("SetRules() with an invalid rule expected error")
+	}
+	if err := call(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("call after rejected SetRules() error = %v, want the old rule kept", err)
+	}
+
+	// The caller keeps its count under the same method, with the new limit
+	if err := limits.SetRules([]ratelimit.Rule{{Method: "/api.v1.UserService/", Limit: 5, Window: time.Minute}}); err != nil {
+		t.Fatalf("SetRules() unexpected error: %v", err)
+	}
+	if err := call(); err != nil {
+		t.Errorf("call under the raised limit unexpected error: %v", err)
+	}
+	limits.SetRules(nil)
+	for i := 0; i < 10; i++ {
+		if err := call(); err != nil {
+			t.Fatalf("call without rules unexpected error: %v", err)
+		}
+	}
+}
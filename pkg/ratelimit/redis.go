@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+// allowScript reads the current and previous window counts and counts the
+// request if the weighted estimate leaves room. Both keys share a hash tag
+// so the script also runs on Redis Cluster.
+var allowScript = redis.NewScript(`
+local curr = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+if prev * tonumber(ARGV[1]) + curr + 1 > tonumber(ARGV[2]) then
+	return {0, curr, prev}
+end
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {1, curr, prev}
+`)
+
+// takeScript refills the bucket for the time since it was last taken from,
+// as seen by the callers' clocks, and takes a token if one is left. The
+// bucket expires once it would be full again.
+var takeScript = redis.NewScript(`
+local now, limit, window, burst = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(tokens + math.max(now - ts, 0) * limit / window, burst)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(math.max(now, ts)))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * window / limit) + 1)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisOptions configures a RedisLimiter
+type RedisOptions struct {
+	// Prefix is prepended to counter keys (default "ratelimit:")
+	Prefix string
+
+	// Clock places requests in windows (default the real clock). Replicas
+	// should keep their clocks in sync; skew only shifts the window
+	// boundaries a replica sees.
+	Clock clock.Clock
+}
+
+// RedisLimiter counts in Redis, so every replica sharing the Redis enforces
+// the same limits
+type RedisLimiter struct {
+	client redis.UniversalClient
+	opts   RedisOptions
+}
+
+// NewRedisLimiter creates a RedisLimiter
+func NewRedisLimiter(client redis.UniversalClient, opts RedisOptions) *RedisLimiter {
+	if opts.Prefix == "" {
+		opts.Prefix = "ratelimit:"
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.Real()
+	}
+	return &RedisLimiter{client: client, opts: opts}
+}
+
+// Allow counts a request under key
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	idx, elapsed := windowOf(l.opts.Clock.Now(), window)
+	base := l.opts.Prefix + "{" + key + "}:" + strconv.FormatInt(int64(window/time.Millisecond), 10) + ":"
+	weight := 1 - float64(elapsed)/float64(window)
+
+	// Counters live for two windows: one as current, one as previous
+	values, err := allowScript.Run(ctx, l.client,
+		[]string{base + strconv.FormatInt(idx, 10), base + strconv.FormatInt(idx-1, 10)},
+		strconv.FormatFloat(weight, 'g', -1, 64), limit, (2 * window).Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	r := decide(int(values[2]), int(values[1]), limit, elapsed, window)
+	// The script decided atomically; decide only fills in the details
+	if allowed := values[0] == 1; allowed != r.Allowed {
+		if allowed {
+			r = Result{Allowed: true}
+		} else {
+			r = Result{RetryAfter: time.Millisecond}
+		}
+	}
+	return r, nil
+}
+
+// Take takes a token from the bucket under key
+func (l *RedisLimiter) Take(ctx context.Context, key string, limit int, window time.Duration, burst int) (Result, error) {
+	now := float64(l.opts.Clock.Now().UnixMicro()) / 1000
+	values, err := takeScript.Run(ctx, l.client,
+		[]string{l.opts.Prefix + "{" + key + "}:bucket"},
+		strconv.FormatFloat(now, 'f', 3, 64), limit, window.Milliseconds(), burst,
+	).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	allowed, _ := values[0].(int64)
+	left, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: bucket of %s holds %q tokens: %w", key, left, err)
+	}
+	if allowed == 1 {
+		return Result{Allowed: true, Remaining: int(math.Floor(tokens))}, nil
+	}
+	r, _ := take(tokens, limit, window)
+	return r, nil
+}
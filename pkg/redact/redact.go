@@ -0,0 +1,206 @@
+// Package redact strips sensitive fields from responses unless the caller
+// holds a scope that reveals them, so one API serves both privileged and
+// public consumers. Rules name fields by their proto name, e.g.
+// phone_number, and apply to every message and object in a response: the
+// loosely typed data.result, typed payloads and streamed messages alike.
+package redact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Rule hides Field from callers holding none of Scopes. A rule without
+// scopes hides the field from everyone.
+type Rule struct {
+	Field  string
+	Scopes []string
+}
+
+// ScopeFunc returns the scopes of the caller in ctx
+type ScopeFunc func(ctx context.Context) []string
+
+// Filter strips the fields the caller may not see from responses
+type Filter struct {
+	rules  []Rule
+	scopes ScopeFunc
+}
+
+// New creates a Filter applying rules, finding callers' scopes with scopes
+func New(rules []Rule, scopes ScopeFunc) (*Filter, error) {
+	seen := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if r.Field == "" {
+			return nil, errors.New("redact: a rule needs a field")
+		}
+		if seen[r.Field] {
+			return nil, fmt.Errorf("redact: field %q has two rules", r.Field)
+		}
+		seen[r.Field] = true
+	}
+	return &Filter{rules: rules, scopes: scopes}, nil
+}
+
+// Hidden returns the fields the caller in ctx may not see
+func (f *Filter) Hidden(ctx context.Context) map[string]bool {
+	var scopes []string
+	if f.scopes != nil {
+		scopes = f.scopes(ctx)
+	}
+	var hidden map[string]bool
+	for _, r := range f.rules {
+		if slices.ContainsFunc(r.Scopes, func(s string) bool { return slices.Contains(scopes, s) }) {
+			continue
+		}
+		if hidden == nil {
+			hidden = make(map[string]bool)
+		}
+		hidden[r.Field] = true
+	}
+	return hidden
+}
+
+// Apply returns msg without the fields the caller in ctx may not see. msg
+// is left as it is; a copy is stripped when there is anything to hide.
+func (f *Filter) Apply(ctx context.Context, msg proto.Message) (proto.Message, error) {
+	hidden := f.Hidden(ctx)
+	if len(hidden) == 0 || msg == nil {
+		return msg, nil
+	}
+	msg = proto.Clone(msg)
+	if err := strip(msg.ProtoReflect(), hidden); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// UnaryServerInterceptor redacts unary responses
+func (f *Filter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		msg, ok := resp.(proto.Message)
+		if err != nil || !ok {
+			return resp, err
+		}
+		return f.Apply(ctx, msg)
+	}
+}
+
+// StreamServerInterceptor redacts each message a stream sends
+func (f *Filter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		hidden := f.Hidden(ss.Context())
+		if len(hidden) == 0 {
+			return handler(srv, ss)
+		}
+		return handler(srv, &redactedStream{ServerStream: ss, hidden: hidden})
+	}
+}
+
+// redactedStream strips hidden fields from the messages it sends
+type redactedStream struct {
+	grpc.ServerStream
+	hidden map[string]bool
+}
+
+func (s *redactedStream) SendMsg(m interface{}) error {
+	if msg, ok := m.(proto.Message); ok {
+		msg = proto.Clone(msg)
+		if err := strip(msg.ProtoReflect(), s.hidden); err != nil {
+			return err
+		}
+		m = msg
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// strip clears the hidden fields of m and of every message within it.
+// Structs lose hidden keys, and Any values are unpacked, stripped and
+// packed again.
+func strip(m protoreflect.Message, hidden map[string]bool) error {
+	switch v := m.Interface().(type) {
+	case *structpb.Struct:
+		stripStruct(v, hidden)
+		return nil
+	case *anypb.Any:
+		return stripAny(v, hidden)
+	case *apiv1.CommonResponse:
+		// The common case, without reflection
+		stripStruct(v.GetData(), hidden)
+		if v.GetPayload() != nil {
+			return stripAny(v.GetPayload(), hidden)
+		}
+		return nil
+	}
+
+	var err error
+	var clear []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		if hidden[string(fd.Name())] {
+			clear = append(clear, fd)
+			return true
+		}
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := val.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = strip(list.Get(i).Message(), hidden)
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			val.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				err = strip(v.Message(), hidden)
+				return err == nil
+			})
+		case fd.Message() != nil && !fd.IsList() && !fd.IsMap():
+			err = strip(val.Message(), hidden)
+		}
+		return err == nil
+	})
+	// Cleared after ranging, which must not change the message
+	for _, fd := range clear {
+		m.Clear(fd)
+	}
+	return err
+}
+
+func stripStruct(s *structpb.Struct, hidden map[string]bool) {
+	for key, v := range s.GetFields() {
+		if hidden[key] {
+			delete(s.Fields, key)
+			continue
+		}
+		stripValue(v, hidden)
+	}
+}
+
+func stripValue(v *structpb.Value, hidden map[string]bool) {
+	switch k := v.GetKind().(type) {
+	case *structpb.Value_StructValue:
+		stripStruct(k.StructValue, hidden)
+	case *structpb.Value_ListValue:
+		for _, item := range k.ListValue.GetValues() {
+			stripValue(item, hidden)
+		}
+	}
+}
+
+func stripAny(a *anypb.Any, hidden map[string]bool) error {
+	msg, err := anypb.UnmarshalNew(a, proto.UnmarshalOptions{Resolver: response.Resolver})
+	if err != nil {
+		return fmt.Errorf("redact: %w", err)
+	}
+	if err := strip(msg.ProtoReflect(), hidden); err != nil {
+		return err
+	}
+	return anypb.MarshalFrom(a, msg, proto.MarshalOptions{Deterministic: true})
+}
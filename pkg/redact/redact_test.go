@@ -0,0 +1,126 @@
+package redact
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+type scopesKey struct{}
+
+func withScopes(scopes ...string) context.Context {
+	return context.WithValue(context.Background(), scopesKey{}, scopes)
+}
+
+func newTestFilter(t *testing.T) *Filter {
+	t.Helper()
+	f, err := New([]Rule{
+		{Field: "email", Scopes: []string{"users:pii", "admin"}},
+		{Field: "phone_number", Scopes: []string{"users:pii"}},
+	}, func(ctx context.Context) []string {
+		scopes, _ := ctx.Value(scopesKey{}).([]string)
+		return scopes
+	})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	return f
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New([]Rule{{Field: "email"}, {Field: "email"}}, nil); err == nil {
+		t.Error("New() duplicate field expected error")
+	}
+	if _, err := New([]Rule{{}}, nil); err == nil {
+		t.Error("New() rule without a field expected error")
+	}
+}
+
+func TestApply(t *testing.T) {
+	f := newTestFilter(t)
+	user := &apiv1.User{Name: "users/1", Email: "a@example.com", PhoneNumber: "555-0100"}
+	data, err := response.Success(map[string]interface{}{"users": []*apiv1.User{user}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := f.Apply(withScopes(), data)
+	if err != nil {
+		t.Fatalf("Apply() unexpected error: %v", err)
+	}
+	fields := got.(*apiv1.CommonResponse).GetData().GetFields()["result"].GetStructValue().GetFields()["users"].GetListValue().GetValues()[0].GetStructValue().GetFields()
+	if fields["email"] != nil || fields["phone_number"] != nil || fields["name"] == nil {
+		t.Errorf("public data.result = %v, want email and phone_number stripped", fields)
+	}
+	if data.GetData().GetFields()["result"].GetStructValue().GetFields()["users"].GetListValue().GetValues()[0].GetStructValue().GetFields()["email"] == nil {
+		t.Error("Apply() changed its argument, want a stripped copy")
+	}
+
+	got, _ = f.Apply(withScopes("admin"), data)
+	fields = got.(*apiv1.CommonResponse).GetData().GetFields()["result"].GetStructValue().GetFields()["users"].GetListValue().GetValues()[0].GetStructValue().GetFields()
+	if fields["email"] == nil || fields["phone_number"] != nil {
+		t.Errorf("admin data.result = %v, want email kept and phone_number stripped", fields)
+	}
+
+	if got, _ := f.Apply(withScopes("users:pii"), data); got != data {
+		t.Error("Apply() with every scope copied the response, want it returned as is")
+	}
+}
+
+func TestApplyPayload(t *testing.T) {
+	if err := response.RegisterPayload(&apiv1.User{}); err != nil {
+		t.Fatal(err)
+	}
+	f := newTestFilter(t)
+	resp, err := response.Payload(&apiv1.User{Name: "users/1", Email: "a@example.com", PhoneNumber: "555-0100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Apply(withScopes("admin"), resp)
+	if err != nil {
+		t.Fatalf("Apply() unexpected error: %v", err)
+	}
+	var user apiv1.User
+	if err := anypb.UnmarshalTo(got.(*apiv1.CommonResponse).GetPayload(), &user, proto.UnmarshalOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if user.GetEmail() == "" || user.GetPhoneNumber() != "" || user.GetName() != "users/1" {
+		t.Errorf("payload = %v, want phone_number stripped only", &user)
+	}
+}
+
+type testStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []interface{}
+}
+
+func (s *testStream) Context() context.Context { return s.ctx }
+
+func (s *testStream) SendMsg(m interface{}) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	f := newTestFilter(t)
+	user := &apiv1.User{Name: "users/1", Email: "a@example.com", PhoneNumber: "555-0100"}
+	stream := &testStream{ctx: withScopes()}
+	err := f.StreamServerInterceptor()(nil, stream, &grpc.StreamServerInfo{}, func(_ interface{}, ss grpc.ServerStream) error {
+		return ss.SendMsg(user)
+	})
+	if err != nil {
+		t.Fatalf("interceptor unexpected error: %v", err)
+	}
+	if sent := stream.sent[0].(*apiv1.User); sent.GetEmail() != "" || sent.GetPhoneNumber() != "" || sent.GetName() != "users/1" {
+		t.Errorf("sent %v, want email and phone_number stripped", sent)
+	}
+	if user.GetEmail() == "" {
+		t.Error("stream changed the handler's message, want a stripped copy sent")
+	}
+}
@@ -0,0 +1,148 @@
+// Package requestid correlates the work done for one request. The HTTP
+// middleware and the gRPC server interceptors take the caller's request
+// ID, or generate one, put it in the context for log lines and send it
+// back. The client interceptors pass it on with the calls a request makes,
+// so a REST call keeps its ID through the gateway to the gRPC server.
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Header is the metadata key carrying the request ID. Over HTTP it is the
+// X-Request-Id header.
+const Header = "x-request-id"
+
+// HTTPHeader is the canonical form of Header for HTTP
+const HTTPHeader = "X-Request-Id"
+
+// maxLen bounds the request IDs accepted from callers
+const maxLen = 128
+
+// generator makes the IDs of requests that come without one
+var generator idgen.Generator = idgen.NewUUID()
+
+type idKey struct{}
+
+// WithID returns a context carrying id
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// FromContext returns the request ID in ctx, empty when there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// New returns a new request ID
+func New() string {
+	return generator.NewID()
+}
+
+// Valid reports whether id may be used as a request ID: not empty, at
+// most 128 characters, and printable ASCII without spaces, so it is safe
+// in headers and log lines
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// orNew returns id if it is valid, else a new ID
+func orNew(id string) string {
+	if Valid(id) {
+		return id
+	}
+	return New()
+}
+
+// Middleware gives each request an ID: the X-Request-Id header the client
+// sent, if valid, else a new one. The ID is in the request's context and
+// header, for the gateway to forward, and in the response's header.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := orNew(r.Header.Get(HTTPHeader))
+		r.Header.Set(HTTPHeader, id)
+		w.Header().Set(HTTPHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithID(r.Context(), id)))
+	})
+}
+
+// UnaryServerInterceptor gives each call an ID, the caller's if valid, and
+// sends it back in the response header
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, id := fromIncoming(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(Header, id))
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor gives each stream an ID, the caller's if valid,
+// and sends it back in the response header
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, id := fromIncoming(ss.Context())
+		ss.SetHeader(metadata.Pairs(Header, id))
+		return handler(srv, &idStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// fromIncoming returns the context of a call carrying its ID, and the ID
+func fromIncoming(ctx context.Context) (context.Context, string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var id string
+	if v := md.Get(Header); len(v) > 0 {
+		id = v[0]
+	}
+	id = orNew(id)
+	return WithID(ctx, id), id
+}
+
+// UnaryClientInterceptor sends the request ID in the call's context with
+// calls that do not carry one already
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor sends the request ID in the stream's context
+// with streams that do not carry one already
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoing(ctx), desc, cc, method, opts...)
+	}
+}
+
+// outgoing adds the request ID in ctx to its outgoing metadata
+func outgoing(ctx context.Context) context.Context {
+	id := FromContext(ctx)
+	if id == "" {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(Header)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, Header, id)
+}
+
+// idStream carries the context with the request ID to the stream handler
+type idStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *idStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,84 @@
+package requestid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/requestid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"req-1", true},
+		{"0b9e1a3c-5d6f-4e2a-9c7b-1f2e3d4c5b6a", true},
+		{"", false},
+		{"req 1", false},
+		{"req\n1", false},
+		{"réq", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		if got := requestid.Valid(tt.id); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+	if id := requestid.New(); !requestid.Valid(id) || id == requestid.New() {
+		t.Errorf("New() = %q, want a valid, unique ID", id)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var inHeader, inContext string
+	h := requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inHeader, inContext = r.Header.Get(requestid.HTTPHeader), requestid.FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestid.HTTPHeader, "req-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get(requestid.HTTPHeader); got != "req-1" || inHeader != "req-1" || inContext != "req-1" {
+		t.Errorf("response %q, request header %q, context %q, want req-1", got, inHeader, inContext)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get(requestid.HTTPHeader); got == "" || inHeader != got || inContext != got {
+		t.Errorf("response %q, request header %q, context %q, want one new ID", got, inHeader, inContext)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	intercept := requestid.UnaryClientInterceptor()
+	sent := func(ctx context.Context) []string {
+		var got []string
+		_ = intercept(ctx, "/svc/Method", nil, nil, nil, func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			got = md.Get(requestid.Header)
+			return nil
+		})
+		return got
+	}
+
+	if got := sent(context.Background()); len(got) != 0 {
+		t.Errorf("x-request-id without a request = %q, want none", got)
+	}
+	ctx := requestid.WithID(context.Background(), "req-1")
+	if got := sent(ctx); len(got) != 1 || got[0] != "req-1" {
+		t.Errorf("x-request-id = %q, want req-1", got)
+	}
+	// An ID the caller set already is kept
+	ctx = metadata.AppendToOutgoingContext(ctx, requestid.Header, "req-2")
+	if got := sent(ctx); len(got) != 1 || got[0] != "req-2" {
+		t.Errorf("x-request-id = %q, want req-2", got)
+	}
+}
@@ -0,0 +1,249 @@
+package response
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// marshalOptions is how messages appear in the data field
+var marshalOptions = protojson.MarshalOptions{UseProtoNames: true}
+
+// jsonBuffers holds the buffers used to marshal messages that have no fast
+// path
+var jsonBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+// Valid range of google.protobuf.Timestamp seconds, 0001-01-01 to 9999-12-31
+const (
+	minTimestampSeconds = -62135596800
+	maxTimestampSeconds = 253402300799
+)
+
+// toValue converts data into a structpb value. Proto messages are walked
+// with reflection and produce the same value as their protojson encoding,
+// without encoding and decoding JSON in between.
+func toValue(data interface{}) (*structpb.Value, error) {
+	switch v := data.(type) {
+	case nil:
+		return structpb.NewNullValue(), nil
+	case proto.Message:
+		return messageValue(v.ProtoReflect())
+	case map[string]interface{}:
+		fields := make(map[string]*structpb.Value, len(v))
+		for key, val := range v {
+			n, err := toValue(val)
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = n
+		}
+		return structpb.NewStructValue(&structpb.Struct{Fields: fields}), nil
+	}
+
+	rv := reflect.ValueOf(data)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		values := make([]*structpb.Value, rv.Len())
+		for i := range values {
+			n, err := toValue(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			values[i] = n
+		}
+		return structpb.NewListValue(&structpb.ListValue{Values: values}), nil
+	}
+
+	return structpb.NewValue(data)
+}
+
+// messageValue converts a message the way protojson encodes it: populated
+// fields only, keyed by their proto names
+func messageValue(m protoreflect.Message) (*structpb.Value, error) {
+	switch m.Descriptor().FullName() {
+	case "google.protobuf.Timestamp":
+		if s, ok := formatTimestamp(m); ok {
+			return structpb.NewStringValue(s), nil
+		}
+		return jsonValue(m)
+	case "google.protobuf.Struct":
+		return structpb.NewStructValue(proto.Clone(m.Interface()).(*structpb.Struct)), nil
+	case "google.protobuf.Value":
+		return proto.Clone(m.Interface()).(*structpb.Value), nil
+	case "google.protobuf.ListValue":
+		return structpb.NewListValue(proto.Clone(m.Interface()).(*structpb.ListValue)), nil
+	}
+	if m.Descriptor().FullName().Parent() == "google.protobuf" {
+		// Other well-known types have their own JSON forms
+		return jsonValue(m)
+	}
+
+	fields := make(map[string]*structpb.Value, m.Descriptor().Fields().Len())
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsExtension() {
+			// Extensions are keyed by their full name in brackets, leave
+			// them to protojson
+			err = errFallback
+			return false
+		}
+		var val *structpb.Value
+		switch {
+		case fd.IsList():
+			val, err = listValue(fd, v.List())
+		case fd.IsMap():
+			val, err = mapValue(fd, v.Map())
+		default:
+			val, err = fieldValue(fd, v)
+		}
+		if err != nil {
+			return false
+		}
+		fields[string(fd.Name())] = val
+		return true
+	})
+	if err == errFallback {
+		return jsonValue(m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return structpb.NewStructValue(&structpb.Struct{Fields: fields}), nil
+}
+
+// errFallback stops the fast path for messages it does not handle
+var errFallback = errors.New("response: fallback to protojson")
+
+func listValue(fd protoreflect.FieldDescriptor, list protoreflect.List) (*structpb.Value, error) {
+	values := make([]*structpb.Value, list.Len())
+	for i := range values {
+		v, err := fieldValue(fd, list.Get(i))
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return structpb.NewListValue(&structpb.ListValue{Values: values}), nil
+}
+
+func mapValue(fd protoreflect.FieldDescriptor, m protoreflect.Map) (*structpb.Value, error) {
+	fields := make(map[string]*structpb.Value, m.Len())
+	var err error
+	m.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+		var val *structpb.Value
+		if val, err = fieldValue(fd.MapValue(), v); err != nil {
+			return false
+		}
+		fields[k.String()] = val
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return structpb.NewStructValue(&structpb.Struct{Fields: fields}), nil
+}
+
+// fieldValue converts one singular value of fd
+func fieldValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) (*structpb.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return structpb.NewBoolValue(v.Bool()), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return structpb.NewNumberValue(float64(v.Int())), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return structpb.NewNumberValue(float64(v.Uint())), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson quotes 64-bit integers, which float64 cannot hold
+		return structpb.NewStringValue(v.String()), nil
+	case protoreflect.FloatKind:
+		return floatValue(v.Float(), 32), nil
+	case protoreflect.DoubleKind:
+		return floatValue(v.Float(), 64), nil
+	case protoreflect.StringKind:
+		return structpb.NewStringValue(v.String()), nil
+	case protoreflect.BytesKind:
+		return structpb.NewStringValue(base64.StdEncoding.EncodeToString(v.Bytes())), nil
+	case protoreflect.EnumKind:
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			return structpb.NewNullValue(), nil
+		}
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return structpb.NewStringValue(string(ev.Name())), nil
+		}
+		return structpb.NewNumberValue(float64(v.Enum())), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageValue(v.Message())
+	}
+	return nil, errFallback
+}
+
+// floatValue mirrors protojson, which writes non-finite numbers as strings
+// and floats with the shortest decimal that round-trips at their precision
+func floatValue(f float64, bits int) *structpb.Value {
+	switch {
+	case math.IsNaN(f):
+		return structpb.NewStringValue("NaN")
+	case math.IsInf(f, 1):
+		return structpb.NewStringValue("Infinity")
+	case math.IsInf(f, -1):
+		return structpb.NewStringValue("-Infinity")
+	}
+	if bits == 32 {
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', -1, 32), 64)
+	}
+	return structpb.NewNumberValue(f)
+}
+
+// formatTimestamp formats a valid Timestamp as protojson does: RFC 3339 in
+// UTC with 0, 3, 6 or 9 fractional digits
+func formatTimestamp(m protoreflect.Message) (string, bool) {
+	ts, ok := m.Interface().(*timestamppb.Timestamp)
+	if !ok {
+		return "", false
+	}
+	secs, nanos := ts.GetSeconds(), ts.GetNanos()
+	if secs < minTimestampSeconds || secs > maxTimestampSeconds || nanos < 0 || nanos > 999999999 {
+		return "", false
+	}
+	s := time.Unix(secs, int64(nanos)).UTC().Format("2006-01-02T15:04:05.000000000")
+	s = strings.TrimSuffix(s, "000")
+	s = strings.TrimSuffix(s, "000")
+	s = strings.TrimSuffix(s, ".000")
+	return s + "Z", true
+}
+
+// jsonValue converts a message through its protojson encoding, reusing
+// pooled buffers
+func jsonValue(m protoreflect.Message) (*structpb.Value, error) {
+	bp := jsonBuffers.Get().(*[]byte)
+	defer jsonBuffers.Put(bp)
+
+	b, err := marshalOptions.MarshalAppend((*bp)[:0], m.Interface())
+	if err != nil {
+		return nil, err
+	}
+	*bp = b
+
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return structpb.NewValue(out)
+}
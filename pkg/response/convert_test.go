@@ -0,0 +1,186 @@
+package response
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// scalarsMessage builds a dynamic message with one field of every kind the
+// fast path converts itself
+func scalarsMessage(t *testing.T) protoreflect.Message {
+	t.Helper()
+
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(num),
+			Type:     typ.Enum(),
+			Label:    label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("convert_test.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto", "google/protobuf/duration.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Color"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("COLOR_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("RED"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Scalars"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("b", 1, descriptorpb.FieldDescriptorProto_TYPE_BOOL, optional, ""),
+				field("i32", 2, descriptorpb.FieldDescriptorProto_TYPE_SINT32, optional, ""),
+				field("u32", 3, descriptorpb.FieldDescriptorProto_TYPE_FIXED32, optional, ""),
+				field("i64", 4, descriptorpb.FieldDescriptorProto_TYPE_INT64, optional, ""),
+				field("u64", 5, descriptorpb.FieldDescriptorProto_TYPE_UINT64, optional, ""),
+				field("f", 6, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, optional, ""),
+				field("d", 7, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, optional, ""),
+				field("nan", 8, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, optional, ""),
+				field("raw", 9, descriptorpb.FieldDescriptorProto_TYPE_BYTES, optional, ""),
+				field("color", 10, descriptorpb.FieldDescriptorProto_TYPE_ENUM, optional, ".test.Color"),
+				field("unknown_color", 11, descriptorpb.FieldDescriptorProto_TYPE_ENUM, optional, ".test.Color"),
+				field("tags", 12, descriptorpb.FieldDescriptorProto_TYPE_STRING, repeated, ""),
+				field("labels", 13, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, repeated, ".test.Scalars.LabelsEntry"),
+				field("when", 14, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".google.protobuf.Timestamp"),
+				field("timeout", 15, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".google.protobuf.Duration"),
+				field("child", 16, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".test.Scalars"),
+				field("empty", 17, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name:    proto.String("LabelsEntry"),
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_INT32, optional, ""),
+					field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+				},
+			}},
+		}},
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistryFiles(t))
+	if err != nil {
+		t.Fatalf("protodesc.NewFile() error = %v", err)
+	}
+
+	md := fd.Messages().ByName("Scalars")
+	m := dynamicpb.NewMessage(md)
+	set := func(name string, v protoreflect.Value) { m.Set(md.Fields().ByName(protoreflect.Name(name)), v) }
+	set("b", protoreflect.ValueOfBool(true))
+	set("i32", protoreflect.ValueOfInt32(-7))
+	set("u32", protoreflect.ValueOfUint32(7))
+	set("i64", protoreflect.ValueOfInt64(math.MinInt64))
+	set("u64", protoreflect.ValueOfUint64(math.MaxUint64))
+	set("f", protoreflect.ValueOfFloat32(1.1))
+	set("d", protoreflect.ValueOfFloat64(2.5e-300))
+	set("nan", protoreflect.ValueOfFloat64(math.Inf(-1)))
+	set("raw", protoreflect.ValueOfBytes([]byte{0, 1, 0xfe}))
+	set("color", protoreflect.ValueOfEnum(1))
+	set("unknown_color", protoreflect.ValueOfEnum(9))
+	set("when", protoreflect.ValueOfMessage(timestamppb.New(time.Date(2025, 1, 2, 3, 4, 5, 600000, time.UTC)).ProtoReflect()))
+	set("timeout", protoreflect.ValueOfMessage(durationpb.New(1500*time.Millisecond).ProtoReflect()))
+
+	tags := m.NewField(md.Fields().ByName("tags")).List()
+	tags.Append(protoreflect.ValueOfString("a"))
+	tags.Append(protoreflect.ValueOfString("b"))
+	set("tags", protoreflect.ValueOfList(tags))
+
+	labels := m.NewField(md.Fields().ByName("labels")).Map()
+	labels.Set(protoreflect.ValueOfInt32(3).MapKey(), protoreflect.ValueOfString("three"))
+	set("labels", protoreflect.ValueOfMap(labels))
+
+	child := dynamicpb.NewMessage(md)
+	child.Set(md.Fields().ByName("b"), protoreflect.ValueOfBool(true))
+	set("child", protoreflect.ValueOfMessage(child))
+	return m
+}
+
+func TestToValueMatchesProtoJSON(t *testing.T) {
+	now := timestamppb.New(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	data, _ := structpb.NewStruct(map[string]interface{}{"k": []interface{}{1.0, "v", nil}})
+
+	tests := []struct {
+		name string
+		msg  proto.Message
+	}{
+		{"user", &apiv1.User{Name: "users/1", Email: "a@example.com", CreateTime: now, IsActive: true}},
+		{"empty user", &apiv1.User{}},
+		{"job with payload", &apiv1.Job{Name: "jobs/1", Payload: []byte(`{"to":"a"}`), Attempts: 2, RunTime: now}},
+		{"nested struct", &apiv1.CommonResponse{ErrorMsg: "ok", Data: data}},
+		{"field mask", &fieldmaskpb.FieldMask{Paths: []string{"display_name", "user.email"}}},
+		{"timestamp nanos", timestamppb.New(time.Date(2025, 1, 1, 0, 0, 0, 120, time.UTC))},
+		{"all kinds", scalarsMessage(t).Interface()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toValue(tt.msg)
+			if err != nil {
+				t.Fatalf("toValue() unexpected error: %v", err)
+			}
+			want, err := jsonValue(tt.msg.ProtoReflect())
+			if err != nil {
+				t.Fatalf("jsonValue() unexpected error: %v", err)
+			}
+			if !proto.Equal(got, want) {
+				g, _ := json.Marshal(got.AsInterface())
+				w, _ := json.Marshal(want.AsInterface())
+				t.Errorf("toValue() = %s, want %s", g, w)
+			}
+		})
+	}
+}
+
+func TestSuccessNestsMessages(t *testing.T) {
+	resp, err := Success(map[string]interface{}{
+		"users":      []*apiv1.User{{Name: "users/1"}},
+		"total_size": 1,
+		"token":      "",
+	})
+	if err != nil {
+		t.Fatalf("Success() unexpected error: %v", err)
+	}
+	result := resp.GetData().GetFields()["result"].GetStructValue().GetFields()
+	users := result["users"].GetListValue().GetValues()
+	if len(users) != 1 || users[0].GetStructValue().GetFields()["name"].GetStringValue() != "users/1" {
+		t.Errorf("users = %v, want users/1", users)
+	}
+	if result["total_size"].GetNumberValue() != 1 {
+		t.Errorf("total_size = %v, want 1", result["total_size"])
+	}
+}
+
+func protoregistryFiles(t *testing.T) *protoregistry.Files {
+	t.Helper()
+	files := new(protoregistry.Files)
+	for _, fd := range []protoreflect.FileDescriptor{timestamppb.File_google_protobuf_timestamp_proto, durationpb.File_google_protobuf_duration_proto} {
+		if err := files.RegisterFile(fd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
@@ -0,0 +1,248 @@
+package response
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"golang.org/x/text/language"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// LanguageHeader is the metadata key holding the caller's preferred
+// languages, in the form of an HTTP Accept-Language header
+const LanguageHeader = "accept-language"
+
+// ContentLanguageHeader is the header metadata key naming the language of
+// a translated error message
+const ContentLanguageHeader = "content-language"
+
+// locales holds a catalog per language, e.g. zh.json, mapping English
+// error messages to their translations. Messages built with fmt take the
+// English format string as their key, e.g. "user %s not found", and the
+// translation formats the same arguments, in another order with explicit
+// indexes such as %[2]s.
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+// catalog is the translations of one language
+type catalog struct {
+	tag      language.Tag
+	messages map[string]string
+}
+
+// messageFormat matches messages built from one English format string
+type messageFormat struct {
+	format  string
+	pattern *regexp.Regexp
+	verbs   []byte
+	literal int
+}
+
+// catalogs are the embedded catalogs. English, the language of the
+// messages, is first and has no translations.
+var catalogs, formats, matcher = mustLoadCatalogs()
+
+// formatVerb matches the verbs messageFormat can take arguments back out
+// of messages for
+var formatVerb = regexp.MustCompile(`%[sqdv]`)
+
+// Language returns the catalog language best matching the caller's
+// preferred languages, English when none matches
+func Language(ctx context.Context) language.Tag {
+	return catalogFor(ctx).tag
+}
+
+// Localize translates msg, an error message, into the caller's preferred
+// language. Messages with no translation are returned unchanged, in
+// English.
+func Localize(ctx context.Context, msg string) string {
+	translated, _ := catalogFor(ctx).translate(msg)
+	return translated
+}
+
+// UnaryServerInterceptor translates the error messages of the responses
+// and statuses handlers return into the language the caller asks for with
+// LanguageHeader, and names it in ContentLanguageHeader
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if st, ok := status.FromError(err); ok && err != nil {
+			c := catalogFor(ctx)
+			if msg, ok := c.translate(st.Message()); ok {
+				// Details are kept, only the message changes
+				p := st.Proto()
+				p.Message = msg
+				grpc.SetHeader(ctx, metadata.Pairs(ContentLanguageHeader, c.tag.String()))
+				return resp, status.FromProto(p).Err()
+			}
+			return resp, err
+		}
+		common, ok := resp.(*apiv1.CommonResponse)
+		if !ok || common.GetErrorCode() == CodeSuccess {
+			return resp, err
+		}
+		c := catalogFor(ctx)
+		if msg, ok := c.translate(common.GetErrorMsg()); ok {
+			common.ErrorMsg = msg
+			grpc.SetHeader(ctx, metadata.Pairs(ContentLanguageHeader, c.tag.String()))
+		}
+		return resp, err
+	}
+}
+
+// catalogFor returns the catalog for the caller's preferred languages
+func catalogFor(ctx context.Context) catalog {
+	md, _ := metadata.FromIncomingContext(ctx)
+	accept := md.Get(LanguageHeader)
+	if len(accept) == 0 {
+		return catalogs[0]
+	}
+	tags, _, err := language.ParseAcceptLanguage(strings.Join(accept, ","))
+	if err != nil || len(tags) == 0 {
+		return catalogs[0]
+	}
+	_, i, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return catalogs[0]
+	}
+	return catalogs[i]
+}
+
+// translate returns msg in c's language, and whether it has a translation
+func (c catalog) translate(msg string) (string, bool) {
+	if len(c.messages) == 0 {
+		return msg, false
+	}
+	if t, ok := c.messages[msg]; ok {
+		return t, true
+	}
+	for _, f := range formats {
+		t, ok := c.messages[f.format]
+		if !ok {
+			continue
+		}
+		if args, ok := f.parse(msg); ok {
+			return fmt.Sprintf(t, args...), true
+		}
+	}
+	return msg, false
+}
+
+// parse returns the arguments msg was formatted with, if it was formatted
+// with f
+func (f messageFormat) parse(msg string) ([]interface{}, bool) {
+	m := f.pattern.FindStringSubmatch(msg)
+	if m == nil {
+		return nil, false
+	}
+	args := make([]interface{}, len(f.verbs))
+	for i, verb := range f.verbs {
+		s := m[i+1]
+		switch verb {
+		case 'q':
+			unquoted, err := strconv.Unquote(s)
+			if err != nil {
+				return nil, false
+			}
+			args[i] = unquoted
+		case 'd':
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, false
+			}
+			args[i] = n
+		default:
+			args[i] = s
+		}
+	}
+	return args, true
+}
+
+// newMessageFormat compiles format into a pattern matching the messages it
+// formats
+func newMessageFormat(format string) messageFormat {
+	f := messageFormat{format: format}
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, loc := range formatVerb.FindAllStringIndex(format, -1) {
+		literal := format[last:loc[0]]
+		pattern.WriteString(regexp.QuoteMeta(literal))
+		f.literal += len(literal)
+		verb := format[loc[1]-1]
+		switch verb {
+		case 'q':
+			pattern.WriteString(`("(?:[^"\\]|\\.)*")`)
+		case 'd':
+			pattern.WriteString(`(-?\d+)`)
+		default:
+			pattern.WriteString(`(.+?)`)
+		}
+		f.verbs = append(f.verbs, verb)
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(format[last:]) + "$")
+	f.literal += len(format) - last
+	f.pattern = regexp.MustCompile(pattern.String())
+	return f
+}
+
+// mustLoadCatalogs loads the embedded catalogs. They are part of the
+// binary, so a malformed one is a programming error.
+func mustLoadCatalogs() ([]catalog, []messageFormat, language.Matcher) {
+	names, err := locales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := []catalog{{tag: language.English}}
+	seen := make(map[string]bool)
+	var formats []messageFormat
+	for _, name := range names {
+		tag, err := language.Parse(strings.TrimSuffix(name.Name(), ".json"))
+		if err != nil {
+			panic(fmt.Sprintf("response: catalog %s: %v", name.Name(), err))
+		}
+		data, err := locales.ReadFile(path.Join("locales", name.Name()))
+		if err != nil {
+			panic(err)
+		}
+		c := catalog{tag: tag}
+		if err := json.Unmarshal(data, &c.messages); err != nil {
+			panic(fmt.Sprintf("response: catalog %s: %v", name.Name(), err))
+		}
+		catalogs = append(catalogs, c)
+
+		for format := range c.messages {
+			if !seen[format] && formatVerb.MatchString(format) {
+				seen[format] = true
+				formats = append(formats, newMessageFormat(format))
+			}
+		}
+	}
+
+	// The format with the most literal text wins, so "user %s not found"
+	// matches before "%s not found" would
+	sort.Slice(formats, func(i, j int) bool {
+		if formats[i].literal != formats[j].literal {
+			return formats[i].literal > formats[j].literal
+		}
+		return formats[i].format < formats[j].format
+	})
+
+	tags := make([]language.Tag, len(catalogs))
+	for i, c := range catalogs {
+		tags[i] = c.tag
+	}
+	return catalogs, formats, language.NewMatcher(tags)
+}
@@ -0,0 +1,95 @@
+package response
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLocalize(t *testing.T) {
+	tests := []struct {
+		accept string
+		msg    string
+		want   string
+	}{
+		{accept: "", msg: "user users/1 not found", want: "user users/1 not found"},
+		{accept: "zh-CN,zh;q=0.9,en;q=0.8", msg: "user users/1 not found", want: "用户 users/1 不存在"},
+		{accept: "es-MX", msg: MsgInternalError, want: "error interno del servidor"},
+		{accept: "es", msg: `invalid page_token "a\"b"`, want: `page_token "a\"b" no válido`},
+		{accept: "zh", msg: "name must have the form tasks/{id}", want: "name 的格式必须为 tasks/{id}"},
+		{accept: "zh", msg: "job jobs/7 is not dead", want: "作业 jobs/7 不处于失败状态"},
+		// Messages and languages without a catalog fall back to English
+		{accept: "zh", msg: "something new went wrong", want: "something new went wrong"},
+		{accept: "fr-FR, de;q=0.5", msg: MsgNotFound, want: MsgNotFound},
+		{accept: "not a language", msg: MsgNotFound, want: MsgNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept+"/"+tt.msg, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(LanguageHeader, tt.accept))
+			if got := Localize(ctx, tt.msg); got != tt.want {
+				t.Errorf("Localize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatalogs(t *testing.T) {
+	for _, c := range catalogs[1:] {
+		for format, translation := range c.messages {
+			f := newMessageFormat(format)
+			args := make([]interface{}, len(f.verbs))
+			for i, verb := range f.verbs {
+				args[i] = "x"
+				if verb == 'd' {
+					args[i] = 1
+				}
+			}
+			if got := fmt.Sprintf(translation, args...); strings.Contains(got, "%!") {
+				t.Errorf("%s: %q formats as %q, want the arguments of %q", c.tag, translation, got, format)
+			}
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	intercept := UnaryServerInterceptor()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(LanguageHeader, "zh"))
+	call := func(resp *apiv1.CommonResponse) string {
+		got, err := intercept(ctx, nil, &grpc.UnaryServerInfo{}, func(context.Context, interface{}) (interface{}, error) {
+			return resp, nil
+		})
+		if err != nil {
+			t.Fatalf("interceptor unexpected error: %v", err)
+		}
+		return got.(*apiv1.CommonResponse).GetErrorMsg()
+	}
+
+	if got := call(NotFound("")); got != "资源不存在" {
+		t.Errorf("error message = %q, want it translated", got)
+	}
+	if got := call(SuccessEmpty()); got != MsgSuccess {
+		t.Errorf("success message = %q, want it untouched", got)
+	}
+}
+
+func TestUnaryServerInterceptorStatus(t *testing.T) {
+	intercept := UnaryServerInterceptor()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(LanguageHeader, "zh"))
+	st, _ := status.New(codes.NotFound, "user users/1 not found").WithDetails(&errdetails.ResourceInfo{ResourceName: "users/1"})
+
+	_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, st.Err()
+	})
+	got := status.Convert(err)
+	if got.Code() != codes.NotFound || got.Message() != "用户 users/1 不存在" || len(got.Details()) != 1 {
+		t.Errorf("status = %v %q %v, want NotFound translated with its details", got.Code(), got.Message(), got.Details())
+	}
+}
@@ -0,0 +1,110 @@
+package response
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// PayloadHeader is the metadata key callers set to PayloadAny to receive
+// results as a typed payload
+const PayloadHeader = "x-response-payload"
+
+// PayloadAny asks for the result in CommonResponse.payload, as an Any,
+// instead of in data.result
+const PayloadAny = "any"
+
+// Types holds the message types a payload may hold. Only registered types
+// are sent as payloads.
+var Types = new(protoregistry.Types)
+
+// Resolver resolves the types of Any values when marshaling responses:
+// payload types first, then the types linked into the binary, such as the
+// error details of a status
+var Resolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+} = resolver{}
+
+type resolver struct{}
+
+func (resolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	if mt, err := Types.FindMessageByName(name); err == nil {
+		return mt, nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(name)
+}
+
+func (resolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	if mt, err := Types.FindMessageByURL(url); err == nil {
+		return mt, nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByURL(url)
+}
+
+func (resolver) FindExtensionByName(name protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByName(name)
+}
+
+func (resolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
+
+// RegisterPayload adds the types of msgs to Types. Registering a type
+// twice is not an error.
+func RegisterPayload(msgs ...proto.Message) error {
+	for _, m := range msgs {
+		mt := m.ProtoReflect().Type()
+		if _, err := Types.FindMessageByName(mt.Descriptor().FullName()); err == nil {
+			continue
+		}
+		if err := Types.RegisterMessage(mt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PayloadRequested reports whether the caller asked for a typed payload
+func PayloadRequested(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get(PayloadHeader) {
+		if v == PayloadAny {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload creates a successful response with msg as its typed payload.
+// msg's type must be registered.
+func Payload(msg proto.Message) (*apiv1.CommonResponse, error) {
+	name := msg.ProtoReflect().Descriptor().FullName()
+	if _, err := Types.FindMessageByName(name); err != nil {
+		return nil, fmt.Errorf("response: payload type %s is not registered", name)
+	}
+	payload, err := anypb.New(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &apiv1.CommonResponse{
+		ErrorCode: CodeSuccess,
+		ErrorMsg:  MsgSuccess,
+		Payload:   payload,
+	}, nil
+}
+
+// Typed creates a successful response holding msg: as a typed payload when
+// the caller asked for one, else in data.result like Success
+func Typed(ctx context.Context, msg proto.Message) (*apiv1.CommonResponse, error) {
+	if PayloadRequested(ctx) {
+		return Payload(msg)
+	}
+	return Success(msg)
+}
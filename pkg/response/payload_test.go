@@ -0,0 +1,46 @@
+package response
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTyped(t *testing.T) {
+	if err := RegisterPayload(&apiv1.User{}, &apiv1.User{}); err != nil {
+		t.Fatalf("RegisterPayload() twice error = %v", err)
+	}
+	user := &apiv1.User{Name: "users/1", Email: "a@example.com"}
+
+	resp, err := Typed(context.Background(), user)
+	if err != nil || resp.GetPayload() != nil || resp.GetData().GetFields()["result"] == nil {
+		t.Fatalf("Typed() without the header = %v, %v, want data.result only", resp, err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(PayloadHeader, PayloadAny))
+	resp, err = Typed(ctx, user)
+	if err != nil {
+		t.Fatalf("Typed() error = %v", err)
+	}
+	if resp.GetData() != nil {
+		t.Errorf("Typed() data = %v, want none alongside the payload", resp.GetData())
+	}
+	got, err := resp.GetPayload().UnmarshalNew()
+	if err != nil || !proto.Equal(got, user) {
+		t.Errorf("Typed() payload = %v, %v, want %v", got, err, user)
+	}
+
+	out, err := protojson.MarshalOptions{Resolver: Resolver}.Marshal(resp)
+	if err != nil || !strings.Contains(string(out), `"@type":"type.googleapis.com/api.v1.User"`) {
+		t.Errorf("marshal = %s, %v, want the payload's type", out, err)
+	}
+
+	if _, err := Payload(&apiv1.Task{}); err == nil {
+		t.Error("Payload() of an unregistered type error = nil, want error")
+	}
+}
@@ -1,21 +1,25 @@
 package response
 
 import (
+	"net/http"
+
 	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // Error codes
 const (
-	CodeSuccess            = 0
-	CodeInvalidArgument    = 400
-	CodeNotFound           = 404
-	CodeInternalError      = 500
-	CodeAlreadyExists      = 409
-	CodePermissionDenied   = 403
-	CodeUnauthenticated    = 401
-	CodeResourceExhausted  = 429
-	CodeUnimplemented      = 501
+	CodeSuccess           = 0
+	CodeInvalidArgument   = 400
+	CodeNotFound          = 404
+	CodeInternalError     = 500
+	CodeAlreadyExists     = 409
+	CodePermissionDenied  = 403
+	CodeUnauthenticated   = 401
+	CodeResourceExhausted = 429
+	CodeUnimplemented     = 501
 )
 
 // Error messages
@@ -31,11 +35,11 @@ const (
 	MsgUnimplemented     = "unimplemented"
 )
 
-// Success creates a successful response with data
+// Success creates a successful response with data. data may be a proto
+// message, a map or slice holding messages, or any value structpb accepts;
+// messages appear as in their protojson encoding with proto field names.
 func Success(data interface{}) (*apiv1.CommonResponse, error) {
-	structData, err := structpb.NewStruct(map[string]interface{}{
-		"result": data,
-	})
+	result, err := toValue(data)
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +47,9 @@ func Success(data interface{}) (*apiv1.CommonResponse, error) {
 	return &apiv1.CommonResponse{
 		ErrorCode: CodeSuccess,
 		ErrorMsg:  MsgSuccess,
-		Data:      structData,
+		Data: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"result": result,
+		}},
 	}, nil
 }
 
@@ -88,6 +94,69 @@ func AlreadyExists(message string) *apiv1.CommonResponse {
 	return Error(CodeAlreadyExists, message)
 }
 
+// HTTPStatus returns the HTTP status matching an error code. The codes
+// above follow HTTP, so 4xx and 5xx codes are their own status; success is
+// 200 and any other code 500.
+func HTTPStatus(code int32) int {
+	switch {
+	case code == CodeSuccess:
+		return http.StatusOK
+	case code >= 400 && code <= 599:
+		return int(code)
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// statusCodes maps gRPC codes to the error codes above. ABORTED, a
+// concurrent modification, is a conflict like ALREADY_EXISTS.
+var statusCodes = map[codes.Code]int32{
+	codes.OK:                CodeSuccess,
+	codes.InvalidArgument:   CodeInvalidArgument,
+	codes.NotFound:          CodeNotFound,
+	codes.AlreadyExists:     CodeAlreadyExists,
+	codes.Aborted:           CodeAlreadyExists,
+	codes.PermissionDenied:  CodePermissionDenied,
+	codes.Unauthenticated:   CodeUnauthenticated,
+	codes.ResourceExhausted: CodeResourceExhausted,
+	codes.Unimplemented:     CodeUnimplemented,
+}
+
+// FromStatus converts a gRPC status to a response with the matching error
+// code and its message, for CommonResponse handlers sharing code with
+// handlers that return statuses. Codes without a match are internal
+// errors, and an OK status is an empty success.
+func FromStatus(st *status.Status) *apiv1.CommonResponse {
+	code, ok := statusCodes[st.Code()]
+	switch {
+	case code == CodeSuccess && ok:
+		return SuccessEmpty()
+	case !ok:
+		return InternalError(st.Message())
+	}
+	return Error(code, st.Message())
+}
+
+// ToStatus converts resp back to a gRPC status, for clients of
+// CommonResponse methods: a success is OK, and an error code the status of
+// the matching gRPC code with resp's message. Conflicts are ALREADY_EXISTS
+// and codes without a match are INTERNAL.
+func ToStatus(resp *apiv1.CommonResponse) *status.Status {
+	code := resp.GetErrorCode()
+	switch code {
+	case CodeSuccess:
+		return status.New(codes.OK, "")
+	case CodeAlreadyExists:
+		return status.New(codes.AlreadyExists, resp.GetErrorMsg())
+	}
+	for c, ec := range statusCodes {
+		if ec == code {
+			return status.New(c, resp.GetErrorMsg())
+		}
+	}
+	return status.New(codes.Internal, resp.GetErrorMsg())
+}
+
 // SuccessEmpty creates a successful response with empty data
 func SuccessEmpty() *apiv1.CommonResponse {
 	return &apiv1.CommonResponse{
@@ -0,0 +1,79 @@
+package response
+
+import (
+	"fmt"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func benchUser(i int) *apiv1.User {
+	now := timestamppb.Now()
+	return &apiv1.User{
+		Name:        fmt.Sprintf("users/%d", i),
+		Email:       fmt.Sprintf("user%d@example.com", i),
+		DisplayName: "Bench User",
+		PhoneNumber: "+1234567890",
+		CreateTime:  now,
+		UpdateTime:  now,
+		IsActive:    true,
+	}
+}
+
+func BenchmarkSuccessUser(b *testing.B) {
+	user := benchUser(1)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Success(user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkProtoJSONUser converts through the protojson encoding, the path
+// messages without a fast path take, for comparison with BenchmarkSuccessUser
+func BenchmarkProtoJSONUser(b *testing.B) {
+	m := benchUser(1).ProtoReflect()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := jsonValue(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSuccessUserList(b *testing.B) {
+	for _, size := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("users=%d", size), func(b *testing.B) {
+			users := make([]*apiv1.User, size)
+			for i := range users {
+				users[i] = benchUser(i)
+			}
+			data := map[string]interface{}{
+				"users":           users,
+				"next_page_token": "50",
+				"total_size":      size,
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := Success(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkError(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = NotFound("user users/1 not found")
+	}
+}
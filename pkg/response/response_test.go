@@ -0,0 +1,66 @@
+package response
+
+import (
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	for code, want := range map[int32]int{
+		CodeSuccess:           200,
+		CodeInvalidArgument:   400,
+		CodeNotFound:          404,
+		CodeAlreadyExists:     409,
+		CodeResourceExhausted: 429,
+		CodeUnimplemented:     501,
+		1001:                  500,
+		-1:                    500,
+	} {
+		if got := HTTPStatus(code); got != want {
+			t.Errorf("HTTPStatus(%d) = %d, want %d", code, got, want)
+		}
+	}
+}
+
+func TestFromStatus(t *testing.T) {
+	for _, tt := range []struct {
+		st       *status.Status
+		wantCode int32
+		wantMsg  string
+	}{
+		{status.New(codes.OK, ""), CodeSuccess, MsgSuccess},
+		{status.New(codes.NotFound, "user users/1 not found"), CodeNotFound, "user users/1 not found"},
+		{status.New(codes.Aborted, "user users/1 was modified concurrently"), CodeAlreadyExists, "user users/1 was modified concurrently"},
+		{status.New(codes.PermissionDenied, "denied"), CodePermissionDenied, "denied"},
+		{status.New(codes.Unavailable, "shutting down"), CodeInternalError, "shutting down"},
+		{status.New(codes.Internal, ""), CodeInternalError, MsgInternalError},
+	} {
+		got := FromStatus(tt.st)
+		if got.GetErrorCode() != tt.wantCode || got.GetErrorMsg() != tt.wantMsg {
+			t.Errorf("FromStatus(%v) = %d %q, want %d %q", tt.st.Code(), got.GetErrorCode(), got.GetErrorMsg(), tt.wantCode, tt.wantMsg)
+		}
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	for _, tt := range []struct {
+		resp *apiv1.CommonResponse
+		want codes.Code
+	}{
+		{SuccessEmpty(), codes.OK},
+		{NotFound("user users/1 not found"), codes.NotFound},
+		{AlreadyExists("email a@example.com is already taken"), codes.AlreadyExists},
+		{Error(CodeUnauthenticated, "no token"), codes.Unauthenticated},
+		{InternalError(""), codes.Internal},
+		{Error(418, "teapot"), codes.Internal},
+	} {
+		got := ToStatus(tt.resp)
+		if got.Code() != tt.want || (tt.want != codes.OK && got.Message() != tt.resp.GetErrorMsg()) {
+			t.Errorf("ToStatus(%d %q) = %v %q, want %v", tt.resp.GetErrorCode(), tt.resp.GetErrorMsg(), got.Code(), got.Message(), tt.want)
+		}
+	}
+}
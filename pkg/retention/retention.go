@@ -0,0 +1,128 @@
+// Package retention purges data that is older than its category's
+// retention period. It runs as a scheduled job and can report what it would
+// purge without deleting anything.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Purger deletes one category of data
+type Purger interface {
+	// Purge deletes records last changed before cutoff and returns how many
+	// it deleted. With dryRun it only counts them.
+	Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error)
+}
+
+// PurgerFunc adapts a function to the Purger interface
+type PurgerFunc func(ctx context.Context, cutoff time.Time, dryRun bool) (int, error)
+
+// Purge calls f(ctx, cutoff, dryRun)
+func (f PurgerFunc) Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	return f(ctx, cutoff, dryRun)
+}
+
+// Report describes one run
+type Report struct {
+	DryRun     bool
+	Time       time.Time
+	Categories []CategoryReport
+}
+
+// CategoryReport describes the outcome for one category
+type CategoryReport struct {
+	Category string
+	Cutoff   time.Time
+
+	// Purged is the number of records deleted, or that would be deleted in
+	// a dry run
+	Purged int
+	Err    error
+}
+
+// Policy is the retention period of one category
+type Policy struct {
+	Category string
+	MaxAge   time.Duration
+}
+
+// Retention applies retention policies with registered purgers
+type Retention struct {
+	log     logger.Logger
+	clock   clock.Clock
+	purgers map[string]Purger
+	dryRun  bool
+
+	policies []Policy
+}
+
+// New creates a Retention. With dryRun, runs only report what they would
+// purge.
+func New(log logger.Logger, clk clock.Clock, dryRun bool) *Retention {
+	if clk == nil {
+		clk = clock.Real()
+	}
+	return &Retention{log: log, clock: clk, purgers: make(map[string]Purger), dryRun: dryRun}
+}
+
+// Register adds the purger for a category
+func (r *Retention) Register(category string, p Purger) {
+	r.purgers[category] = p
+}
+
+// Configure sets the retention policies. Every category must have a
+// registered purger and a positive MaxAge.
+func (r *Retention) Configure(policies []Policy) error {
+	for _, p := range policies {
+		if _, ok := r.purgers[p.Category]; !ok {
+			return fmt.Errorf("retention: unknown category %q", p.Category)
+		}
+		if p.MaxAge <= 0 {
+			return fmt.Errorf("retention: category %q needs a positive max age", p.Category)
+		}
+	}
+	r.policies = append([]Policy(nil), policies...)
+	sort.Slice(r.policies, func(i, j int) bool { return r.policies[i].Category < r.policies[j].Category })
+	return nil
+}
+
+// Run applies every policy once and logs the report. A failing category
+// does not stop the others.
+func (r *Retention) Run(ctx context.Context) error {
+	report := r.Apply(ctx, r.dryRun)
+
+	var failed int
+	for _, c := range report.Categories {
+		switch {
+		case c.Err != nil:
+			failed++
+			r.log.Error("Retention: failed to purge %s older than %s: %v", c.Category, c.Cutoff.Format(time.RFC3339), c.Err)
+		case report.DryRun:
+			r.log.Info("Retention (dry run): would purge %d %s record(s) older than %s", c.Purged, c.Category, c.Cutoff.Format(time.RFC3339))
+		default:
+			r.log.Info("Retention: purged %d %s record(s) older than %s", c.Purged, c.Category, c.Cutoff.Format(time.RFC3339))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("retention: %d of %d categories failed", failed, len(report.Categories))
+	}
+	return nil
+}
+
+// Apply applies every policy once and returns the report
+func (r *Retention) Apply(ctx context.Context, dryRun bool) Report {
+	now := r.clock.Now()
+	report := Report{DryRun: dryRun, Time: now}
+	for _, p := range r.policies {
+		c := CategoryReport{Category: p.Category, Cutoff: now.Add(-p.MaxAge)}
+		c.Purged, c.Err = r.purgers[p.Category].Purge(ctx, c.Cutoff, dryRun)
+		report.Categories = append(report.Categories, c)
+	}
+	return report
+}
@@ -0,0 +1,91 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// agedRecords is a purger over records identified by their timestamps
+type agedRecords struct {
+	times []time.Time
+}
+
+func (a *agedRecords) Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	var kept []time.Time
+	for _, t := range a.times {
+		if !t.Before(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	purged := len(a.times) - len(kept)
+	if !dryRun {
+		a.times = kept
+	}
+	return purged, nil
+}
+
+func TestRetentionApply(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	audit := &agedRecords{times: []time.Time{
+		now.Add(-100 * 24 * time.Hour),
+		now.Add(-91 * 24 * time.Hour),
+		now.Add(-time.Hour),
+	}}
+	r := New(logger.Nop(), clock.NewFake(now), false)
+	r.Register("audit", audit)
+	r.Register("sessions", PurgerFunc(func(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+		return 0, errors.New("store unavailable")
+	}))
+	if err := r.Configure([]Policy{
+		{Category: "sessions", MaxAge: time.Hour},
+		{Category: "audit", MaxAge: 90 * 24 * time.Hour},
+	}); err != nil {
+		t.Fatalf("Configure() unexpected error: %v", err)
+	}
+
+	dry := r.Apply(context.Background(), true)
+	if !dry.DryRun || len(dry.Categories) != 2 {
+		t.Fatalf("Apply(dryRun) = %+v, want a dry run report for 2 categories", dry)
+	}
+	if c := dry.Categories[0]; c.Category != "audit" || c.Purged != 2 || !c.Cutoff.Equal(now.Add(-90*24*time.Hour)) {
+		t.Errorf("dry run audit report = %+v, want 2 records before the 90 day cutoff", c)
+	}
+	if len(audit.times) != 3 {
+		t.Errorf("dry run purged records, %d left, want 3", len(audit.times))
+	}
+
+	if err := r.Run(context.Background()); err == nil {
+		t.Error("Run() error = nil, want the sessions failure")
+	}
+	if len(audit.times) != 1 {
+		t.Errorf("%d audit records left after Run(), want 1 despite the sessions failure", len(audit.times))
+	}
+}
+
+func TestRetentionConfigure(t *testing.T) {
+	r := New(logger.Nop(), nil, true)
+	r.Register("audit", &agedRecords{})
+
+	tests := []struct {
+		name     string
+		policies []Policy
+		wantErr  bool
+	}{
+		{"valid", []Policy{{Category: "audit", MaxAge: time.Hour}}, false},
+		{"unknown category", []Policy{{Category: "revisions", MaxAge: time.Hour}}, true},
+		{"zero max age", []Policy{{Category: "audit"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Configure(tt.policies)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Configure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
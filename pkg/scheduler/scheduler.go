@@ -0,0 +1,419 @@
+// Package scheduler runs jobs on cron schedules.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/robfig/cron/v3"
+)
+
+// Errors returned by the Scheduler
+var (
+	// ErrJobExists is returned when a job name is registered twice
+	ErrJobExists = errors.New("scheduler: job already registered")
+
+	// ErrJobNotFound is returned for an unknown job name
+	ErrJobNotFound = errors.New("scheduler: job not found")
+
+	// ErrStarted is returned when registering jobs after Start
+	ErrStarted = errors.New("scheduler: already started")
+
+	// ErrStopped is returned once the scheduler has been stopped
+	ErrStopped = errors.New("scheduler: stopped")
+)
+
+// JobFunc is the work performed by a scheduled job
+type JobFunc func(ctx context.Context) error
+
+// Job describes a scheduled job
+type Job struct {
+	// Name identifies the job in logs, stats, config and leader election
+	Name string
+
+	// Schedule is a standard 5-field cron expression (minute hour
+	// day-of-month month day-of-week), a descriptor such as @hourly or
+	// "@every <duration>"
+	Schedule string
+
+	// Jitter delays each run by a random duration in [0, Jitter) so replicas
+	// and jobs sharing a schedule do not fire at the same instant
+	Jitter time.Duration
+
+	// Timeout bounds a single run; zero means no timeout
+	Timeout time.Duration
+
+	// AllowOverlap lets a run start while the previous one is still going.
+	// By default such runs are skipped.
+	AllowOverlap bool
+
+	// Disabled keeps the job registered but never triggers it on schedule
+	Disabled bool
+
+	Run JobFunc
+}
+
+// LeaderElector decides whether this replica should run a job. Implementations
+// backed by a shared lock make sure only one replica runs each job.
+type LeaderElector interface {
+	IsLeader(ctx context.Context, job string) (bool, error)
+}
+
+// AlwaysLeader is a LeaderElector for single-replica deployments
+type AlwaysLeader struct{}
+
+// IsLeader always returns true
+func (AlwaysLeader) IsLeader(context.Context, string) (bool, error) {
+	return true, nil
+}
+
+// JobStats is a snapshot of a job's activity
+type JobStats struct {
+	Name string
+
+	// Runs counts completed runs, Failures those that returned an error
+	Runs     uint64
+	Failures uint64
+
+	// SkippedOverlap counts triggers dropped because the job was running,
+	// SkippedNotLeader those dropped because another replica leads
+	SkippedOverlap   uint64
+	SkippedNotLeader uint64
+
+	Running      bool
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+	NextRun      time.Time
+}
+
+// Option configures a Scheduler
+type Option func(*Scheduler)
+
+// WithClock sets the clock used to compute run times
+func WithClock(c clock.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// WithLeaderElector sets the leader election used to gate runs
+func WithLeaderElector(e LeaderElector) Option {
+	return func(s *Scheduler) {
+		s.leader = e
+	}
+}
+
+// Scheduler triggers registered jobs on their schedules
+type Scheduler struct {
+	log    logger.Logger
+	clock  clock.Clock
+	leader LeaderElector
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	started bool
+	stopped bool
+
+	// ctx is passed to runs and cancelled when Stop runs out of time
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	quit     chan struct{}
+	stopOnce sync.Once
+	loops    sync.WaitGroup
+	runs     sync.WaitGroup
+}
+
+type entry struct {
+	job      Job
+	schedule cron.Schedule
+	stats    JobStats
+	running  int
+}
+
+// New creates a Scheduler
+func New(log logger.Logger, opts ...Option) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		log:    log,
+		clock:  clock.Real(),
+		leader: AlwaysLeader{},
+		jobs:   make(map[string]*entry),
+		ctx:    ctx,
+		cancel: cancel,
+		quit:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register adds a job. Jobs must be registered before Start.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" {
+		return errors.New("scheduler: job name is required")
+	}
+	if job.Run == nil {
+		return fmt.Errorf("scheduler: job %q has no Run function", job.Name)
+	}
+	schedule, err := parse(job)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return ErrStarted
+	}
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrJobExists, job.Name)
+	}
+	s.jobs[job.Name] = &entry{job: job, schedule: schedule, stats: JobStats{Name: job.Name}}
+	return nil
+}
+
+// Configure applies config overrides to registered jobs. Job bodies live in
+// code, so every configured name must match a registered job.
+func (s *Scheduler) Configure(cfg config.SchedulerConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return ErrStarted
+	}
+	for _, jc := range cfg.Jobs {
+		e, ok := s.jobs[jc.Name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrJobNotFound, jc.Name)
+		}
+		job := e.job
+		if jc.Schedule != "" {
+			job.Schedule = jc.Schedule
+		}
+		if jc.Jitter != 0 {
+			job.Jitter = jc.Jitter
+		}
+		if jc.Timeout != 0 {
+			job.Timeout = jc.Timeout
+		}
+		job.Disabled = jc.Disabled
+
+		schedule, err := parse(job)
+		if err != nil {
+			return err
+		}
+		e.job = job
+		e.schedule = schedule
+	}
+	return nil
+}
+
+func parse(job Job) (cron.Schedule, error) {
+	if job.Jitter < 0 || job.Timeout < 0 {
+		return nil, fmt.Errorf("scheduler: job %q: jitter and timeout must not be negative", job.Name)
+	}
+	schedule, err := cron.ParseStandard(job.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: job %q: invalid schedule %q: %w", job.Name, job.Schedule, err)
+	}
+	return schedule, nil
+}
+
+// Start begins triggering jobs on their schedules. Runs do not inherit ctx,
+// so a cancelled startup context does not abort the drain in Stop.
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return ErrStopped
+	}
+	if s.started {
+		return nil
+	}
+	s.started = true
+
+	for _, e := range s.jobs {
+		if e.job.Disabled {
+			s.log.Info("Scheduled job %s is disabled", e.job.Name)
+			continue
+		}
+		s.loops.Add(1)
+		go s.loop(e)
+	}
+	return nil
+}
+
+// Stop stops triggering jobs and waits for running ones to finish. If ctx
+// ends first, running jobs are cancelled and ctx's error is returned.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	// quit is separate from s.ctx, which stays alive so running jobs are not
+	// cancelled before the deadline
+	s.stopOnce.Do(func() { close(s.quit) })
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// RunNow triggers a job immediately, subject to the same overlap and leader
+// checks as a scheduled run. It does not wait for the run to finish.
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	e, ok := s.jobs[name]
+	stopped := s.stopped
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	if stopped {
+		return ErrStopped
+	}
+	s.trigger(e)
+	return nil
+}
+
+// Stats returns a snapshot of every job, sorted by name
+func (s *Scheduler) Stats() []JobStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]JobStats, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		st := e.stats
+		st.Running = e.running > 0
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+func (s *Scheduler) loop(e *entry) {
+	defer s.loops.Done()
+
+	for {
+		next := e.schedule.Next(s.clock.Now())
+		if e.job.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(e.job.Jitter))))
+		}
+		s.mu.Lock()
+		e.stats.NextRun = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(next.Sub(s.clock.Now()))
+		select {
+		case <-timer.C:
+			s.trigger(e)
+		case <-s.quit:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// trigger starts a run unless the job is already running or another replica
+// leads it
+func (s *Scheduler) trigger(e *entry) {
+	name := e.job.Name
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	if e.running > 0 && !e.job.AllowOverlap {
+		e.stats.SkippedOverlap++
+		s.mu.Unlock()
+		s.log.Warn("Skipping scheduled job %s: previous run still in progress", name)
+		return
+	}
+	e.running++
+	s.runs.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.runs.Done()
+
+		leader, err := s.leader.IsLeader(s.ctx, name)
+		if err != nil || !leader {
+			s.mu.Lock()
+			e.running--
+			e.stats.SkippedNotLeader++
+			s.mu.Unlock()
+			if err != nil {
+				s.log.Warn("Skipping scheduled job %s: leader election failed: %v", name, err)
+			}
+			return
+		}
+
+		ctx := s.ctx
+		if e.job.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, e.job.Timeout)
+			defer cancel()
+		}
+
+		start := s.clock.Now()
+		err = s.run(ctx, e.job)
+		duration := s.clock.Now().Sub(start)
+
+		s.mu.Lock()
+		e.running--
+		e.stats.Runs++
+		e.stats.LastRun = start
+		e.stats.LastDuration = duration
+		e.stats.LastError = ""
+		if err != nil {
+			e.stats.Failures++
+			e.stats.LastError = err.Error()
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			s.log.Error("Scheduled job %s failed after %v: %v", name, duration, err)
+			return
+		}
+		s.log.Debug("Scheduled job %s completed in %v", name, duration)
+	}()
+}
+
+// run calls the job, turning a panic into an error so one bad job cannot
+// take down the scheduler
+func (s *Scheduler) run(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("scheduler: job panicked: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
@@ -0,0 +1,201 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+)
+
+func noop(ctx context.Context) error { return nil }
+
+type leaderFunc func(job string) (bool, error)
+
+func (f leaderFunc) IsLeader(_ context.Context, job string) (bool, error) {
+	return f(job)
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		job  Job
+	}{
+		{name: "missing name", job: Job{Schedule: "@hourly", Run: noop}},
+		{name: "missing run", job: Job{Name: "a", Schedule: "@hourly"}},
+		{name: "bad schedule", job: Job{Name: "a", Schedule: "61 * * * *", Run: noop}},
+		{name: "negative jitter", job: Job{Name: "a", Schedule: "@hourly", Jitter: -time.Second, Run: noop}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := New(testutil.NopLogger()).Register(tt.job); err == nil {
+				t.Errorf("Register() expected error")
+			}
+		})
+	}
+
+	s := New(testutil.NopLogger())
+	if err := s.Register(Job{Name: "a", Schedule: "*/5 * * * *", Run: noop}); err != nil {
+		t.Fatalf("Register() unexpected error: %v", err)
+	}
+	if err := s.Register(Job{Name: "a", Schedule: "@daily", Run: noop}); !errors.Is(err, ErrJobExists) {
+		t.Errorf("Register() duplicate error = %v, want %v", err, ErrJobExists)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	s := New(testutil.NopLogger())
+	if err := s.Register(Job{Name: "cleanup", Schedule: "@hourly", Run: noop}); err != nil {
+		t.Fatalf("Register() unexpected error: %v", err)
+	}
+
+	err := s.Configure(config.SchedulerConfig{Jobs: []config.ScheduledJobConfig{{Name: "missing"}}})
+	if !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Configure() error = %v, want %v", err, ErrJobNotFound)
+	}
+	err = s.Configure(config.SchedulerConfig{Jobs: []config.ScheduledJobConfig{{Name: "cleanup", Schedule: "not cron"}}})
+	if err == nil {
+		t.Errorf("Configure() expected error for invalid schedule")
+	}
+	err = s.Configure(config.SchedulerConfig{Jobs: []config.ScheduledJobConfig{{Name: "cleanup", Schedule: "@daily", Disabled: true}}})
+	if err != nil {
+		t.Fatalf("Configure() unexpected error: %v", err)
+	}
+	if job := s.jobs["cleanup"].job; job.Schedule != "@daily" || !job.Disabled {
+		t.Errorf("Configure() job = %+v, want @daily and disabled", job)
+	}
+}
+
+func TestScheduledRuns(t *testing.T) {
+	var runs atomic.Int64
+	s := New(testutil.NopLogger())
+	// @every is rounded up to whole seconds, the smallest cron interval
+	s.Register(Job{Name: "tick", Schedule: "@every 1s", Run: func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}})
+	s.Start(context.Background())
+
+	waitFor(t, func() bool { return runs.Load() >= 1 })
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() unexpected error: %v", err)
+	}
+	stats := s.Stats()
+	if len(stats) != 1 || stats[0].Runs < 1 || stats[0].NextRun.IsZero() {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	if err := s.RunNow("tick"); !errors.Is(err, ErrStopped) {
+		t.Errorf("RunNow() after Stop error = %v, want %v", err, ErrStopped)
+	}
+}
+
+func TestOverlapPrevention(t *testing.T) {
+	release := make(chan struct{})
+	var runs atomic.Int64
+	s := New(testutil.NopLogger())
+	s.Register(Job{Name: "slow", Schedule: "@yearly", Run: func(ctx context.Context) error {
+		runs.Add(1)
+		<-release
+		return nil
+	}})
+
+	s.RunNow("slow")
+	waitFor(t, func() bool { return runs.Load() == 1 })
+	s.RunNow("slow")
+	close(release)
+	s.Stop(context.Background())
+
+	stats := s.Stats()[0]
+	if stats.Runs != 1 || stats.SkippedOverlap != 1 {
+		t.Errorf("Stats() runs = %d, skipped = %d, want 1 and 1", stats.Runs, stats.SkippedOverlap)
+	}
+}
+
+func TestLeaderGating(t *testing.T) {
+	var runs atomic.Int64
+	leader := leaderFunc(func(job string) (bool, error) {
+		switch job {
+		case "mine":
+			return true, nil
+		case "broken":
+			return false, errors.New("lock unavailable")
+		}
+		return false, nil
+	})
+	s := New(testutil.NopLogger(), WithLeaderElector(leader))
+	for _, name := range []string{"mine", "theirs", "broken"} {
+		s.Register(Job{Name: name, Schedule: "@yearly", Run: func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		}})
+		s.RunNow(name)
+	}
+	s.Stop(context.Background())
+
+	if runs.Load() != 1 {
+		t.Errorf("ran %d jobs, want 1", runs.Load())
+	}
+	for _, st := range s.Stats() {
+		wantSkipped := uint64(1)
+		if st.Name == "mine" {
+			wantSkipped = 0
+		}
+		if st.SkippedNotLeader != wantSkipped {
+			t.Errorf("job %s skipped = %d, want %d", st.Name, st.SkippedNotLeader, wantSkipped)
+		}
+	}
+}
+
+func TestFailuresAndPanics(t *testing.T) {
+	s := New(testutil.NopLogger())
+	s.Register(Job{Name: "fails", Schedule: "@yearly", Run: func(ctx context.Context) error {
+		return errors.New("boom")
+	}})
+	s.Register(Job{Name: "panics", Schedule: "@yearly", Run: func(ctx context.Context) error {
+		panic("boom")
+	}})
+	s.RunNow("fails")
+	s.RunNow("panics")
+	s.Stop(context.Background())
+
+	for _, st := range s.Stats() {
+		if st.Runs != 1 || st.Failures != 1 || st.LastError == "" {
+			t.Errorf("job %s stats = %+v, want 1 failed run", st.Name, st)
+		}
+	}
+}
+
+func TestStopDeadlineCancelsRuns(t *testing.T) {
+	started := make(chan struct{})
+	s := New(testutil.NopLogger())
+	s.Register(Job{Name: "stuck", Schedule: "@yearly", Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	s.RunNow("stuck")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,108 @@
+// Package settings exposes selected runtime settings, such as the log level
+// or maintenance mode, so operators can inspect and change them without a
+// restart. Changes are not persisted: a restart goes back to the
+// configuration file.
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned for an unregistered setting
+	ErrNotFound = errors.New("setting not found")
+
+	// ErrInvalidValue wraps the error of a rejected value
+	ErrInvalidValue = errors.New("invalid setting value")
+)
+
+// Setting is a named runtime setting. Values are strings so every setting
+// can be listed and changed the same way.
+type Setting struct {
+	Name        string
+	Description string
+
+	// Get returns the current value
+	Get func() string
+
+	// Set validates and applies value
+	Set func(value string) error
+}
+
+// Value is a setting's current value
+type Value struct {
+	Name        string
+	Description string
+	Value       string
+}
+
+// Registry holds the runtime settings. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	settings map[string]Setting
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{settings: make(map[string]Setting)}
+}
+
+// Register adds a setting. Names must be unique.
+func (r *Registry) Register(s Setting) error {
+	if s.Name == "" || s.Get == nil || s.Set == nil {
+		return fmt.Errorf("settings: %q needs a name, Get and Set", s.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.settings[s.Name]; ok {
+		return fmt.Errorf("settings: %q already registered", s.Name)
+	}
+	r.settings[s.Name] = s
+	return nil
+}
+
+// List returns every setting's value, sorted by name
+func (r *Registry) List() []Value {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := make([]Value, 0, len(r.settings))
+	for _, s := range r.settings {
+		values = append(values, value(s))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+// Get returns the named setting's value
+func (r *Registry) Get(name string) (Value, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.settings[name]
+	if !ok {
+		return Value{}, ErrNotFound
+	}
+	return value(s), nil
+}
+
+// Set changes the named setting and returns its values before and after.
+// Changes are serialized so the old value is the one replaced.
+func (r *Registry) Set(name, v string) (old, updated Value, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.settings[name]
+	if !ok {
+		return Value{}, Value{}, ErrNotFound
+	}
+	old = value(s)
+	if err := s.Set(v); err != nil {
+		return Value{}, Value{}, fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	return old, value(s), nil
+}
+
+func value(s Setting) Value {
+	return Value{Name: s.Name, Description: s.Description, Value: s.Get()}
+}
@@ -0,0 +1,54 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	level := "info"
+	r := NewRegistry()
+	for _, s := range []Setting{
+		{
+			Name: "log_level",
+			Get:  func() string { return level },
+			Set: func(v string) error {
+				if v != "debug" && v != "info" {
+					return fmt.Errorf("unknown level %q", v)
+				}
+				level = v
+				return nil
+			},
+		},
+		{Name: "a_flag", Get: func() string { return "on" }, Set: func(string) error { return nil }},
+	} {
+		if err := r.Register(s); err != nil {
+			t.Fatalf("Register(%s) unexpected error: %v", s.Name, err)
+		}
+	}
+	if err := r.Register(Setting{Name: "a_flag", Get: func() string { return "" }, Set: func(string) error { return nil }}); err == nil {
+		t.Errorf("Register() duplicate expected error")
+	}
+	if err := r.Register(Setting{Name: "no_funcs"}); err == nil {
+		t.Errorf("Register() without Get and Set expected error")
+	}
+
+	if values := r.List(); len(values) != 2 || values[0].Name != "a_flag" || values[1].Value != "info" {
+		t.Errorf("List() = %+v, want both settings sorted by name", values)
+	}
+
+	old, updated, err := r.Set("log_level", "debug")
+	if err != nil || old.Value != "info" || updated.Value != "debug" {
+		t.Errorf("Set() = %+v, %+v, %v, want info then debug", old, updated, err)
+	}
+	if _, _, err := r.Set("log_level", "loud"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Set() invalid value error = %v, want %v", err, ErrInvalidValue)
+	}
+	if _, err := r.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() missing error = %v, want %v", err, ErrNotFound)
+	}
+	if v, _ := r.Get("log_level"); v.Value != "debug" {
+		t.Errorf("Get() = %q after the invalid Set(), want debug kept", v.Value)
+	}
+}
@@ -0,0 +1,87 @@
+package shed
+
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+// runtimeSampler reads the pressure signals from runtime/metrics. GC CPU
+// and scheduling latency are cumulative, so each sample covers the time
+// since the previous one.
+type runtimeSampler struct {
+	samples []metrics.Sample
+
+	gcCPU, totalCPU float64
+	sched           []uint64
+}
+
+const (
+	metricMemoryTotal    = "/memory/classes/total:bytes"
+	metricMemoryReleased = "/memory/classes/heap/released:bytes"
+	metricMemoryLimit    = "/gc/gomemlimit:bytes"
+	metricGCCPU          = "/cpu/classes/gc/total:cpu-seconds"
+	metricTotalCPU       = "/cpu/classes/total:cpu-seconds"
+	metricSchedLatency   = "/sched/latencies:seconds"
+)
+
+func newRuntimeSampler() *runtimeSampler {
+	names := []string{metricMemoryTotal, metricMemoryReleased, metricMemoryLimit, metricGCCPU, metricTotalCPU, metricSchedLatency}
+	r := &runtimeSampler{samples: make([]metrics.Sample, len(names))}
+	for i, name := range names {
+		r.samples[i].Name = name
+	}
+	return r
+}
+
+// Sample reads the runtime metrics. It is not safe for concurrent use.
+func (r *runtimeSampler) Sample() Sample {
+	metrics.Read(r.samples)
+	var s Sample
+
+	// The runtime counts all mapped memory but released heap against
+	// GOMEMLIMIT, which is math.MaxInt64 when unset
+	total, released := r.samples[0].Value.Uint64(), r.samples[1].Value.Uint64()
+	s.MemoryUsed = total - released
+	if limit := r.samples[2].Value.Uint64(); limit < math.MaxInt64 {
+		s.MemoryLimit = limit
+	}
+
+	gcCPU, totalCPU := r.samples[3].Value.Float64(), r.samples[4].Value.Float64()
+	if d := totalCPU - r.totalCPU; d > 0 {
+		s.GCFraction = (gcCPU - r.gcCPU) / d
+	}
+	r.gcCPU, r.totalCPU = gcCPU, totalCPU
+
+	hist := r.samples[5].Value.Float64Histogram()
+	if len(r.sched) == len(hist.Counts) {
+		s.SchedLatency = percentile(hist, r.sched, 0.99)
+	}
+	r.sched = append(r.sched[:0], hist.Counts...)
+	return s
+}
+
+// percentile returns the p-th percentile of the observations added to hist
+// since prev, using each bucket's upper bound
+func percentile(hist *metrics.Float64Histogram, prev []uint64, p float64) time.Duration {
+	var total uint64
+	for i, c := range hist.Counts {
+		total += c - prev[i]
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p * float64(total)))
+	var seen uint64
+	for i, c := range hist.Counts {
+		seen += c - prev[i]
+		if seen >= rank {
+			upper := hist.Buckets[i+1]
+			if math.IsInf(upper, 1) {
+				upper = hist.Buckets[i]
+			}
+			return time.Duration(upper * float64(time.Second))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,281 @@
+// Package shed rejects low-priority requests while the process is under
+// pressure, so the requests that matter keep being served instead of the
+// instance falling over. Pressure is sampled from the Go runtime: memory use
+// against GOMEMLIMIT, the share of CPU spent in GC and how long runnable
+// goroutines wait for a thread.
+package shed
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RetryAfterHeader is the response header carrying the retry delay in
+// seconds. The HTTP gateway forwards it as Retry-After.
+const RetryAfterHeader = "retry-after"
+
+// Priority orders requests for shedding. Higher priorities are shed later;
+// Critical requests never are.
+type Priority int
+
+// Priorities in increasing importance. The zero value is unset.
+const (
+	Low Priority = iota + 1
+	Normal
+	High
+	Critical
+)
+
+var priorityNames = []string{"low", "normal", "high", "critical"}
+
+// String returns the priority's name
+func (p Priority) String() string {
+	if p < Low || p > Critical {
+		return fmt.Sprintf("Priority(%d)", p)
+	}
+	return priorityNames[p-1]
+}
+
+// ParsePriority parses a priority name: low, normal, high or critical
+func ParsePriority(s string) (Priority, error) {
+	for i, name := range priorityNames {
+		if strings.EqualFold(s, name) {
+			return Priority(i + 1), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority %q", s)
+}
+
+// Sample is a reading of the process's pressure signals
+type Sample struct {
+	// MemoryUsed and MemoryLimit are the bytes counted against GOMEMLIMIT
+	// and the limit, 0 when there is none
+	MemoryUsed  uint64
+	MemoryLimit uint64
+
+	// GCFraction is the share of CPU time spent in GC since the last sample
+	GCFraction float64
+
+	// SchedLatency is the 99th percentile time goroutines waited to run
+	// since the last sample
+	SchedLatency time.Duration
+}
+
+// Options configures a Shedder
+type Options struct {
+	// Interval is how often pressure is sampled (default 1s)
+	Interval time.Duration
+
+	// MaxMemoryRatio is the share of GOMEMLIMIT in use that counts as
+	// pressure (default 0.9). Without a limit memory is not considered.
+	MaxMemoryRatio float64
+
+	// MaxGCFraction is the share of CPU in GC that counts as pressure
+	// (default 0.25)
+	MaxGCFraction float64
+
+	// MaxSchedLatency is the scheduling latency that counts as pressure
+	// (default 50ms)
+	MaxSchedLatency time.Duration
+
+	// Priorities maps full methods or method prefixes, such as
+	// "/api.v1.AdminService/", to a priority. The longest match wins.
+	Priorities map[string]Priority
+
+	// Default is the priority of unmapped methods (default Normal)
+	Default Priority
+
+	// Sample reads the pressure signals (default ReadRuntime)
+	Sample func() Sample
+}
+
+// Stats is a snapshot of the shedder
+type Stats struct {
+	// Level is how many pressure signals are breached. Requests whose
+	// priority is at most Level are shed.
+	Level  int
+	Sample Sample
+	Shed   uint64
+}
+
+// Shedder samples pressure and sheds requests by priority
+type Shedder struct {
+	log      logger.Logger
+	opts     Options
+	prefixes []string
+
+	level atomic.Int32
+	shed  atomic.Uint64
+
+	mu     sync.Mutex
+	sample Sample
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a Shedder. It sheds nothing until Start samples pressure.
+func New(log logger.Logger, opts Options) *Shedder {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.MaxMemoryRatio <= 0 {
+		opts.MaxMemoryRatio = 0.9
+	}
+	if opts.MaxGCFraction <= 0 {
+		opts.MaxGCFraction = 0.25
+	}
+	if opts.MaxSchedLatency <= 0 {
+		opts.MaxSchedLatency = 50 * time.Millisecond
+	}
+	if opts.Sample == nil {
+		opts.Sample = newRuntimeSampler().Sample
+	}
+	if opts.Default == 0 {
+		opts.Default = Normal
+	}
+	s := &Shedder{log: log, opts: opts}
+	for prefix := range opts.Priorities {
+		s.prefixes = append(s.prefixes, prefix)
+	}
+	// Longest first so the most specific mapping wins
+	sort.Slice(s.prefixes, func(i, j int) bool { return len(s.prefixes[i]) > len(s.prefixes[j]) })
+	return s
+}
+
+// Start samples pressure every Interval until Stop is called or ctx is done
+func (s *Shedder) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	// The first sample is a baseline for the cumulative signals
+	s.opts.Sample()
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.update(s.opts.Sample())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends sampling, waiting until ctx is done
+func (s *Shedder) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of the shedder
+func (s *Shedder) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Level: int(s.level.Load()), Sample: s.sample, Shed: s.shed.Load()}
+}
+
+// update sets the shedding level from sample, one level per breached signal
+func (s *Shedder) update(sample Sample) {
+	var breached []string
+	if sample.MemoryLimit > 0 && float64(sample.MemoryUsed) > s.opts.MaxMemoryRatio*float64(sample.MemoryLimit) {
+		breached = append(breached, fmt.Sprintf("memory %d of %d bytes", sample.MemoryUsed, sample.MemoryLimit))
+	}
+	if sample.GCFraction > s.opts.MaxGCFraction {
+		breached = append(breached, fmt.Sprintf("GC at %.0f%% of CPU", sample.GCFraction*100))
+	}
+	if sample.SchedLatency > s.opts.MaxSchedLatency {
+		breached = append(breached, fmt.Sprintf("scheduling latency %v", sample.SchedLatency))
+	}
+
+	s.mu.Lock()
+	s.sample = sample
+	s.mu.Unlock()
+
+	level := int32(len(breached))
+	if prev := s.level.Swap(level); prev != level {
+		if level > 0 {
+			s.log.Warn("Shedding %v priority requests and below: %s", Priority(level), strings.Join(breached, ", "))
+		} else {
+			s.log.Info("Pressure relieved, no longer shedding requests")
+		}
+	}
+}
+
+// Priority returns the priority of fullMethod
+func (s *Shedder) Priority(fullMethod string) Priority {
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return s.opts.Priorities[prefix]
+		}
+	}
+	return s.opts.Default
+}
+
+// Allow reports whether a call to fullMethod is served at the current
+// pressure
+func (s *Shedder) Allow(fullMethod string) bool {
+	p := s.Priority(fullMethod)
+	if p >= Critical || int32(p) > s.level.Load() {
+		return true
+	}
+	s.shed.Add(1)
+	return false
+}
+
+// UnaryServerInterceptor sheds unary calls
+func (s *Shedder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !s.Allow(info.FullMethod) {
+			return nil, s.overloaded(ctx)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor sheds streaming calls when they start
+func (s *Shedder) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !s.Allow(info.FullMethod) {
+			return s.overloaded(ss.Context())
+		}
+		return handler(srv, ss)
+	}
+}
+
+// overloaded builds the rejection, telling callers to retry after the next
+// sample
+func (s *Shedder) overloaded(ctx context.Context) error {
+	seconds := int64(s.opts.Interval.Round(time.Second) / time.Second)
+	grpc.SetHeader(ctx, metadata.Pairs(RetryAfterHeader, strconv.FormatInt(max(seconds, 1), 10)))
+
+	st := status.New(codes.Unavailable, "server overloaded, request shed")
+	if withInfo, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(s.opts.Interval)}); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
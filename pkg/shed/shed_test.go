@@ -0,0 +1,115 @@
+package shed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestShedderAllow(t *testing.T) {
+	s := New(logger.Nop(), Options{
+		Priorities: map[string]Priority{
+			"/api.v1.AdminService/":         Critical,
+			"/api.v1.UserService/":          High,
+			"/api.v1.UserService/ListUsers": Low,
+		},
+	})
+	const (
+		admin  = "/api.v1.AdminService/ListJobs"
+		get    = "/api.v1.UserService/GetUser"
+		list   = "/api.v1.UserService/ListUsers"
+		health = "/grpc.health.v1.Health/Check"
+	)
+
+	tests := []struct {
+		name    string
+		sample  Sample
+		allowed map[string]bool
+	}{
+		{
+			name:    "no pressure",
+			sample:  Sample{MemoryUsed: 100, MemoryLimit: 1000},
+			allowed: map[string]bool{admin: true, get: true, list: true, health: true},
+		},
+		{
+			name:    "memory",
+			sample:  Sample{MemoryUsed: 950, MemoryLimit: 1000},
+			allowed: map[string]bool{admin: true, get: true, list: false, health: true},
+		},
+		{
+			name:    "memory and GC",
+			sample:  Sample{MemoryUsed: 950, MemoryLimit: 1000, GCFraction: 0.5},
+			allowed: map[string]bool{admin: true, get: true, list: false, health: false},
+		},
+		{
+			name:    "every signal",
+			sample:  Sample{MemoryUsed: 950, MemoryLimit: 1000, GCFraction: 0.5, SchedLatency: time.Second},
+			allowed: map[string]bool{admin: true, get: false, list: false, health: false},
+		},
+		{
+			name:    "no memory limit",
+			sample:  Sample{MemoryUsed: 1 << 40},
+			allowed: map[string]bool{admin: true, get: true, list: true, health: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.update(tt.sample)
+			for method, want := range tt.allowed {
+				if got := s.Allow(method); got != want {
+					t.Errorf("Allow(%s) = %v, want %v", method, got, want)
+				}
+			}
+		})
+	}
+	if stats := s.Stats(); stats.Shed != 6 || stats.Level != 0 {
+		t.Errorf("Stats() = %+v, want 6 shed at level 0", stats)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	s := New(logger.Nop(), Options{Interval: 2 * time.Second, Default: Low})
+	s.update(Sample{GCFraction: 0.9})
+
+	_, err := s.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/api.v1.UserService/GetUser"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			t.Error("handler called for a shed request")
+			return nil, nil
+		})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("interceptor error = %v, want %v", err, codes.Unavailable)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	for _, want := range []Priority{Low, Normal, High, Critical} {
+		got, err := ParsePriority(want.String())
+		if err != nil || got != want {
+			t.Errorf("ParsePriority(%q) = %v, %v, want %v", want.String(), got, err, want)
+		}
+	}
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Error("ParsePriority(urgent) error = nil, want an error")
+	}
+}
+
+func TestRuntimeSampler(t *testing.T) {
+	r := newRuntimeSampler()
+	r.Sample()
+	done := make(chan struct{})
+	for i := 0; i < 100; i++ {
+		go func() { done <- struct{}{} }()
+	}
+	for i := 0; i < 100; i++ {
+		<-done
+	}
+	s := r.Sample()
+	if s.MemoryUsed == 0 || s.GCFraction < 0 || s.GCFraction > 1 {
+		t.Errorf("Sample() = %+v, want memory in use and a GC fraction between 0 and 1", s)
+	}
+}
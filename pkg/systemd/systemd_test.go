@@ -0,0 +1,130 @@
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// notifySocket listens where Notify sends and returns the received states
+func notifySocket(t *testing.T) <-chan string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram() unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	states := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			states <- string(buf[:n])
+		}
+	}()
+	return states
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify(Ready); sent || err != nil {
+		t.Errorf("Notify() outside systemd = %v, %v, want false, nil", sent, err)
+	}
+
+	states := notifySocket(t)
+	if sent, err := Notify(Ready); !sent || err != nil {
+		t.Fatalf("Notify() = %v, %v, want true, nil", sent, err)
+	}
+	select {
+	case got := <-states:
+		if got != Ready {
+			t.Errorf("received %q, want %q", got, Ready)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no notification received")
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name    string
+		usec    string
+		pid     string
+		want    time.Duration
+		enabled bool
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "enabled", usec: "30000000", want: 30 * time.Second, enabled: true},
+		{name: "this process", usec: "1000000", pid: pid, want: time.Second, enabled: true},
+		{name: "other process", usec: "1000000", pid: "1"},
+		{name: "invalid", usec: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			got, enabled, err := WatchdogInterval()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WatchdogInterval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || enabled != tt.enabled {
+				t.Errorf("WatchdogInterval() = %v, %v, want %v, %v", got, enabled, tt.want, tt.enabled)
+			}
+		})
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	states := notifySocket(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	healthy := make(chan bool, 1)
+	healthy <- false
+	done := make(chan error)
+	go func() {
+		done <- Keepalive(ctx, 10*time.Millisecond, func() bool {
+			select {
+			case h := <-healthy:
+				return h
+			default:
+				return true
+			}
+		})
+	}()
+
+	select {
+	case got := <-states:
+		if got != Watchdog {
+			t.Errorf("received %q, want %q", got, Watchdog)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no keepalive received")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Keepalive() unexpected error: %v", err)
+	}
+}
+
+func TestListenersNotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "2")
+	listeners, err := Listeners()
+	if listeners != nil || err != nil {
+		t.Errorf("Listeners() for another process = %v, %v, want nil, nil", listeners, err)
+	}
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Error("Listeners() left LISTEN_FDS set")
+	}
+}
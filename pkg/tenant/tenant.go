@@ -0,0 +1,343 @@
+// Package tenant attributes calls to tenants. A Resolver reads the tenant
+// from the x-tenant-id header, the subdomain of the host the client called
+// or the tenant claim of the caller's token, checks it against a Registry,
+// and holds the call to the tenant's rate limit and feature flags. Handlers
+// find the tenant in their context, and calls they make carry it on.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Header is the metadata key naming the tenant. The HTTP gateway forwards
+// the X-Tenant-Id header as this key.
+const Header = "x-tenant-id"
+
+// Where a Resolver reads the tenant from
+const (
+	// SourceHeader is the Header metadata
+	SourceHeader = "header"
+
+	// SourceSubdomain is the first label of the host the client called,
+	// below Options.Domain
+	SourceSubdomain = "subdomain"
+
+	// SourceClaim is the tenant of the caller's bearer token
+	SourceClaim = "claim"
+)
+
+// DefaultSources are read when Options.Sources is empty
+var DefaultSources = []string{SourceHeader, SourceSubdomain, SourceClaim}
+
+// DefaultExempt are the methods always served without a tenant: health
+// checks and reflection
+var DefaultExempt = []string{"/grpc.health.", "/grpc.reflection."}
+
+// Tenant is a registered tenant
+type Tenant struct {
+	ID string
+
+	// RateLimit caps the tenant's calls to RateLimit per RateWindow, all
+	// methods together. Zero is unlimited.
+	RateLimit  int
+	RateWindow time.Duration
+
+	// Features are the feature flags on for the tenant
+	Features []string
+}
+
+// HasFeature reports whether flag is on for the tenant
+func (t Tenant) HasFeature(flag string) bool {
+	return slices.Contains(t.Features, flag)
+}
+
+// Registry holds the known tenants
+type Registry struct {
+	tenants map[string]Tenant
+}
+
+// NewRegistry creates a Registry of tenants. IDs must be unique and not
+// empty.
+func NewRegistry(tenants ...Tenant) (*Registry, error) {
+	r := &Registry{tenants: make(map[string]Tenant, len(tenants))}
+	for _, t := range tenants {
+		if t.ID == "" {
+			return nil, errors.New("tenant: a tenant needs an ID")
+		}
+		if _, ok := r.tenants[t.ID]; ok {
+			return nil, fmt.Errorf("tenant: %q registered twice", t.ID)
+		}
+		r.tenants[t.ID] = t
+	}
+	return r, nil
+}
+
+// Lookup returns the tenant with id
+func (r *Registry) Lookup(id string) (Tenant, bool) {
+	t, ok := r.tenants[id]
+	return t, ok
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a context carrying t
+func WithTenant(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// FromContext returns the call's tenant, if it has one
+func FromContext(ctx context.Context) (Tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(Tenant)
+	return t, ok
+}
+
+// FeatureEnabled reports whether flag is on for the call's tenant. Calls
+// without a tenant have no flags.
+func FeatureEnabled(ctx context.Context, flag string) bool {
+	t, ok := FromContext(ctx)
+	return ok && t.HasFeature(flag)
+}
+
+// Options configures a Resolver
+type Options struct {
+	// Sources are read in order and the first that names a tenant wins.
+	// Empty reads DefaultSources.
+	Sources []string
+
+	// Domain is the parent domain of tenant subdomains, e.g. example.com
+	// for acme.example.com. The subdomain source needs it.
+	Domain string
+
+	// Required rejects calls naming no tenant. Otherwise they run without
+	// one.
+	Required bool
+
+	// Exempt are full methods or prefixes served without a tenant, in
+	// addition to DefaultExempt
+	Exempt []string
+
+	// Gates maps a feature flag to the full methods or prefixes only
+	// tenants with the flag may call
+	Gates map[string][]string
+
+	// Auth finds the tokens whose tenant claim the claim source reads
+	Auth *auth.TokenAuthenticator
+
+	// Limiter counts calls for the tenants' rate limits. Nil leaves them
+	// unlimited.
+	Limiter ratelimit.Limiter
+}
+
+// gate restricts methods to tenants with flag
+type gate struct {
+	flag    string
+	methods []string
+}
+
+// Resolver attributes calls to tenants and enforces their limits
+type Resolver struct {
+	log      logger.Logger
+	registry *Registry
+	opts     Options
+	gates    []gate
+}
+
+// NewResolver creates a Resolver for the tenants in registry
+func NewResolver(log logger.Logger, registry *Registry, opts Options) (*Resolver, error) {
+	if len(opts.Sources) == 0 {
+		opts.Sources = DefaultSources
+	}
+	for _, src := range opts.Sources {
+		switch src {
+		case SourceHeader, SourceClaim:
+		case SourceSubdomain:
+			if opts.Domain == "" {
+				return nil, errors.New("tenant: the subdomain source needs a domain")
+			}
+		default:
+			return nil, fmt.Errorf("tenant: unknown source %q", src)
+		}
+	}
+	opts.Domain = strings.ToLower(strings.Trim(opts.Domain, "."))
+	opts.Exempt = append(slices.Clone(DefaultExempt), opts.Exempt...)
+
+	r := &Resolver{log: log, registry: registry, opts: opts}
+	for flag, methods := range opts.Gates {
+		r.gates = append(r.gates, gate{flag: flag, methods: methods})
+	}
+	// Sorted so a call failing several gates always names the same flag
+	sort.Slice(r.gates, func(i, j int) bool { return r.gates[i].flag < r.gates[j].flag })
+	return r, nil
+}
+
+// Resolve returns the tenant the call in ctx names, ok false when it names
+// none. A tenant that is not registered, or that differs from the tenant
+// claim of the caller's token, is an error.
+func (r *Resolver) Resolve(ctx context.Context) (t Tenant, ok bool, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var id, claim string
+	for _, src := range r.opts.Sources {
+		var v string
+		switch src {
+		case SourceHeader:
+			v = first(md, Header)
+		case SourceSubdomain:
+			v = r.subdomain(md)
+		case SourceClaim:
+			claim = r.claim(ctx)
+			v = claim
+		}
+		if id == "" {
+			id = v
+		}
+	}
+
+	if claim != "" && claim != id {
+		return Tenant{}, false, status.Errorf(codes.PermissionDenied, "the token is not valid for tenant %q", id)
+	}
+	if id == "" {
+		if r.opts.Required {
+			return Tenant{}, false, status.Errorf(codes.InvalidArgument, "a tenant is required, set the %s header", Header)
+		}
+		return Tenant{}, false, nil
+	}
+	t, ok = r.registry.Lookup(id)
+	if !ok {
+		return Tenant{}, false, status.Errorf(codes.PermissionDenied, "unknown tenant %q", id)
+	}
+	return t, true, nil
+}
+
+// UnaryServerInterceptor attributes unary calls to their tenant
+func (r *Resolver) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := r.admit(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor attributes streaming calls to their tenant when
+// they start
+func (r *Resolver) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := r.admit(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &tenantStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// admit resolves the call's tenant, checks the tenant may call fullMethod
+// and is within its rate limit, and returns the context carrying it
+func (r *Resolver) admit(ctx context.Context, fullMethod string) (context.Context, error) {
+	if hasAnyPrefix(fullMethod, r.opts.Exempt) {
+		return ctx, nil
+	}
+	t, ok, err := r.Resolve(ctx)
+	if err != nil || !ok {
+		return ctx, err
+	}
+
+	for _, g := range r.gates {
+		if hasAnyPrefix(fullMethod, g.methods) && !t.HasFeature(g.flag) {
+			return nil, status.Errorf(codes.PermissionDenied, "%s is not enabled for tenant %q", g.flag, t.ID)
+		}
+	}
+
+	// Like per-caller limits, a failing backend lets calls through
+	if r.opts.Limiter != nil && t.RateLimit > 0 && t.RateWindow > 0 {
+		res, err := r.opts.Limiter.Allow(ctx, "tenant|"+t.ID, t.RateLimit, t.RateWindow)
+		switch {
+		case err != nil:
+			r.log.Warn("Tenant rate limiter failed for %s, allowing: %v", t.ID, err)
+		case !res.Allowed:
+			return nil, ratelimit.Exhausted(ctx, fmt.Sprintf("rate limit of %d per %v exceeded for tenant %q", t.RateLimit, t.RateWindow, t.ID), res.RetryAfter)
+		}
+	}
+
+	// The resolved ID replaces whatever named the tenant, so handlers and
+	// the calls they make see it however the client sent it
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+	md.Set(Header, t.ID)
+	ctx = metadata.NewIncomingContext(ctx, md)
+	ctx = metadata.AppendToOutgoingContext(ctx, Header, t.ID)
+	return WithTenant(ctx, t), nil
+}
+
+// subdomain returns the label below the domain of the host the client
+// called: the gateway's x-forwarded-host, else the gRPC authority
+func (r *Resolver) subdomain(md metadata.MD) string {
+	host := first(md, "x-forwarded-host")
+	if host == "" {
+		host = first(md, ":authority")
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	label, ok := strings.CutSuffix(strings.ToLower(host), "."+r.opts.Domain)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+// claim returns the tenant of the caller's bearer token, if it is valid
+// and has one
+func (r *Resolver) claim(ctx context.Context) string {
+	if r.opts.Auth == nil {
+		return ""
+	}
+	secret, ok := auth.BearerToken(ctx)
+	if !ok {
+		return ""
+	}
+	t, ok := r.opts.Auth.Lookup(secret)
+	if !ok {
+		return ""
+	}
+	return t.Tenant
+}
+
+// tenantStream carries the context with the tenant to the stream handler
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantStream) Context() context.Context { return s.ctx }
+
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
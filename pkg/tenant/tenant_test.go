@@ -0,0 +1,141 @@
+package tenant_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/auth"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/ratelimit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/tenant"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewRegistry(t *testing.T) {
+	if _, err := tenant.NewRegistry(tenant.Tenant{ID: "acme"}, tenant.Tenant{ID: "acme"}); err == nil {
+		t.Error("NewRegistry() duplicate expected error")
+	}
+	if _, err := tenant.NewRegistry(tenant.Tenant{}); err == nil {
+		t.Error("NewRegistry() without an ID expected error")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	reg, _ := tenant.NewRegistry(tenant.Tenant{ID: "acme"}, tenant.Tenant{ID: "globex"})
+	authn := auth.NewTokenAuthenticator([]auth.Token{
+		{Name: "acme-ci", Token: "acme-secret", Tenant: "acme"},
+		{Name: "ops", Token: "ops-secret"},
+	})
+	r, err := tenant.NewResolver(testutil.NopLogger(), reg, tenant.Options{Domain: "example.com", Auth: authn})
+	if err != nil {
+		t.Fatalf("NewResolver() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		md       metadata.MD
+		wantID   string
+		wantCode codes.Code
+	}{
+		{name: "none", md: metadata.MD{}},
+		{name: "header", md: metadata.Pairs(tenant.Header, "acme"), wantID: "acme"},
+		{name: "forwarded host", md: metadata.Pairs("x-forwarded-host", "Globex.example.com:8080"), wantID: "globex"},
+		{name: "authority", md: metadata.Pairs(":authority", "acme.example.com"), wantID: "acme"},
+		{name: "host outside the domain", md: metadata.Pairs(":authority", "acme.example.org")},
+		{name: "nested subdomain", md: metadata.Pairs(":authority", "a.acme.example.com")},
+		{name: "claim", md: metadata.Pairs("authorization", "Bearer acme-secret"), wantID: "acme"},
+		{name: "header over subdomain", md: metadata.Pairs(tenant.Header, "acme", "x-forwarded-host", "globex.example.com"), wantID: "acme"},
+		{name: "token without a claim", md: metadata.Pairs(tenant.Header, "globex", "authorization", "Bearer ops-secret"), wantID: "globex"},
+		{name: "claim for another tenant", md: metadata.Pairs(tenant.Header, "globex", "authorization", "Bearer acme-secret"), wantCode: codes.PermissionDenied},
+		{name: "unknown", md: metadata.Pairs(tenant.Header, "initech"), wantCode: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := r.Resolve(metadata.NewIncomingContext(context.Background(), tt.md))
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("Resolve() error = %v, want %v", err, tt.wantCode)
+			}
+			if ok != (tt.wantID != "") || got.ID != tt.wantID {
+				t.Errorf("Resolve() = %q, %v, want %q", got.ID, ok, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestNewResolverOptions(t *testing.T) {
+	reg, _ := tenant.NewRegistry()
+	if _, err := tenant.NewResolver(testutil.NopLogger(), reg, tenant.Options{Sources: []string{tenant.SourceSubdomain}}); err == nil {
+		t.Error("NewResolver() subdomain without a domain expected error")
+	}
+	if _, err := tenant.NewResolver(testutil.NopLogger(), reg, tenant.Options{Sources: []string{"cookie"}}); err == nil {
+		t.Error("NewResolver() unknown source expected error")
+	}
+	r, _ := tenant.NewResolver(testutil.NopLogger(), reg, tenant.Options{Sources: []string{tenant.SourceHeader}, Required: true})
+	if _, _, err := r.Resolve(context.Background()); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Resolve() without a tenant error = %v, want %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	reg, _ := tenant.NewRegistry(
+		tenant.Tenant{ID: "acme", RateLimit: 2, RateWindow: time.Minute, Features: []string{"exports"}},
+		tenant.Tenant{ID: "globex"},
+	)
+	r, err := tenant.NewResolver(testutil.NopLogger(), reg, tenant.Options{
+		Sources:  []string{tenant.SourceHeader},
+		Required: true,
+		Gates:    map[string][]string{"exports": {"/api.v1.TaskService/"}},
+		Limiter:  ratelimit.NewMemoryLimiter(clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))),
+	})
+	if err != nil {
+		t.Fatalf("NewResolver() unexpected error: %v", err)
+	}
+	intercept := r.UnaryServerInterceptor()
+	call := func(method, id string) (context.Context, error) {
+		ctx := context.Background()
+		if id != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(tenant.Header, id))
+		}
+		var got context.Context
+		_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+			got = ctx
+			return nil, nil
+		})
+		return got, err
+	}
+
+	ctx, err := call("/api.v1.TaskService/CreateTask", "acme")
+	if err != nil {
+		t.Fatalf("gated call for a tenant with the flag = %v, want served", err)
+	}
+	if got, _ := tenant.FromContext(ctx); got.ID != "acme" || !tenant.FeatureEnabled(ctx, "exports") {
+		t.Errorf("handler context tenant = %+v, want acme with exports", got)
+	}
+	if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(tenant.Header)) != 1 || md.Get(tenant.Header)[0] != "acme" {
+		t.Errorf("outgoing metadata = %v, want the tenant propagated", md)
+	}
+
+	if _, err := call("/api.v1.TaskService/CreateTask", "globex"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("gated call for a tenant without the flag = %v, want %v", err, codes.PermissionDenied)
+	}
+	if _, err := call("/api.v1.UserService/GetUser", "acme"); err != nil {
+		t.Errorf("second call within the limit = %v, want served", err)
+	}
+	if _, err := call("/api.v1.UserService/GetUser", "acme"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("call over the tenant's limit = %v, want %v", err, codes.ResourceExhausted)
+	}
+	if _, err := call("/api.v1.UserService/GetUser", "globex"); err != nil {
+		t.Errorf("call for an unlimited tenant = %v, want served", err)
+	}
+	if _, err := call("/api.v1.UserService/GetUser", ""); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("call without a tenant = %v, want %v", err, codes.InvalidArgument)
+	}
+	if _, err := call("/grpc.health.v1.Health/Check", ""); err != nil {
+		t.Errorf("health check without a tenant = %v, want exempt", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Package builder provides test data builders for API resources and helpers
+// to seed and decode them through the service layer.
+package builder
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// sequence makes default emails unique across builders
+var sequence atomic.Int64
+
+// UserBuilder builds apiv1.User values with sensible defaults
+type UserBuilder struct {
+	user *apiv1.User
+}
+
+// NewUserBuilder creates a builder for an active user with a unique email
+func NewUserBuilder() *UserBuilder {
+	n := sequence.Add(1)
+	return &UserBuilder{
+		user: &apiv1.User{
+			Email:       fmt.Sprintf("user%d@example.com", n),
+			DisplayName: fmt.Sprintf("Test User %d", n),
+			IsActive:    true,
+		},
+	}
+}
+
+// WithName sets the resource name
+func (b *UserBuilder) WithName(name string) *UserBuilder {
+	b.user.Name = name
+	return b
+}
+
+// WithEmail sets the email address
+func (b *UserBuilder) WithEmail(email string) *UserBuilder {
+	b.user.Email = email
+	return b
+}
+
+// WithDisplayName sets the display name
+func (b *UserBuilder) WithDisplayName(displayName string) *UserBuilder {
+	b.user.DisplayName = displayName
+	return b
+}
+
+// WithPhoneNumber sets the phone number
+func (b *UserBuilder) WithPhoneNumber(phoneNumber string) *UserBuilder {
+	b.user.PhoneNumber = phoneNumber
+	return b
+}
+
+// WithActive sets whether the user is active
+func (b *UserBuilder) WithActive(active bool) *UserBuilder {
+	b.user.IsActive = active
+	return b
+}
+
+// WithCreateTime sets both create and update time
+func (b *UserBuilder) WithCreateTime(t time.Time) *UserBuilder {
+	b.user.CreateTime = timestamppb.New(t)
+	b.user.UpdateTime = timestamppb.New(t)
+	return b
+}
+
+// Build returns a copy of the built user
+func (b *UserBuilder) Build() *apiv1.User {
+	return proto.Clone(b.user).(*apiv1.User)
+}
+
+// CreateRequest returns a CreateUserRequest for the built user
+func (b *UserBuilder) CreateRequest() *apiv1.CreateUserRequest {
+	return &apiv1.CreateUserRequest{User: b.Build()}
+}
@@ -0,0 +1,107 @@
+package builder
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// UserCreator is implemented by UserService servers
+type UserCreator interface {
+	CreateUser(ctx context.Context, req *apiv1.CreateUserRequest) (*apiv1.CommonResponse, error)
+}
+
+// CreateUser creates the built user through svc and returns the stored user
+func CreateUser(tb testing.TB, svc UserCreator, b *UserBuilder) *apiv1.User {
+	tb.Helper()
+
+	resp, err := svc.CreateUser(context.Background(), b.CreateRequest())
+	if err != nil {
+		tb.Fatalf("CreateUser() unexpected error: %v", err)
+	}
+	return DecodeUser(tb, resp)
+}
+
+// SeedUsers creates n users through svc. customize, if not nil, is called
+// with each user's index and builder before it is created.
+func SeedUsers(tb testing.TB, svc UserCreator, n int, customize func(i int, b *UserBuilder)) []*apiv1.User {
+	tb.Helper()
+
+	users := make([]*apiv1.User, 0, n)
+	for i := 0; i < n; i++ {
+		b := NewUserBuilder()
+		if customize != nil {
+			customize(i, b)
+		}
+		users = append(users, CreateUser(tb, svc, b))
+	}
+	return users
+}
+
+// DecodeUser decodes the user in a successful response's data.result
+func DecodeUser(tb testing.TB, resp *apiv1.CommonResponse) *apiv1.User {
+	tb.Helper()
+
+	user := &apiv1.User{}
+	decode(tb, result(tb, resp), user)
+	return user
+}
+
+// DecodeUsers decodes the users list in a successful response's data.result.users
+func DecodeUsers(tb testing.TB, resp *apiv1.CommonResponse) []*apiv1.User {
+	tb.Helper()
+
+	list := result(tb, resp).GetStructValue().GetFields()["users"].GetListValue()
+	users := make([]*apiv1.User, 0, len(list.GetValues()))
+	for _, v := range list.GetValues() {
+		user := &apiv1.User{}
+		decode(tb, v, user)
+		users = append(users, user)
+	}
+	return users
+}
+
+// DecodeUserList decodes the ListUsers page in a successful response's
+// data.result, with its next_page_token and total_size
+func DecodeUserList(tb testing.TB, resp *apiv1.CommonResponse) *apiv1.ListUsersResponse {
+	tb.Helper()
+
+	list := &apiv1.ListUsersResponse{}
+	decode(tb, result(tb, resp), list)
+	return list
+}
+
+// result returns data.result, failing the test on an error response
+func result(tb testing.TB, resp *apiv1.CommonResponse) *structpb.Value {
+	tb.Helper()
+
+	if resp == nil {
+		tb.Fatalf("nil response")
+	}
+	if resp.GetErrorCode() != response.CodeSuccess {
+		tb.Fatalf("error_code = %d, msg = %s, want success", resp.GetErrorCode(), resp.GetErrorMsg())
+	}
+	v, ok := resp.GetData().GetFields()["result"]
+	if !ok {
+		tb.Fatalf("response has no data.result")
+	}
+	return v
+}
+
+// decode converts a structpb value back into a message via its JSON form
+func decode(tb testing.TB, v *structpb.Value, msg proto.Message) {
+	tb.Helper()
+
+	b, err := v.MarshalJSON()
+	if err != nil {
+		tb.Fatalf("failed to marshal result: %v", err)
+	}
+	if err := protojson.Unmarshal(b, msg); err != nil {
+		tb.Fatalf("failed to decode %s: %v", msg.ProtoReflect().Descriptor().Name(), err)
+	}
+}
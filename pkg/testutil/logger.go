@@ -0,0 +1,8 @@
+package testutil
+
+import "github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+
+// NopLogger returns a logger that discards everything, keeping test output clean
+func NopLogger() logger.Logger {
+	return logger.Nop()
+}
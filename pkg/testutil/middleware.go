@@ -0,0 +1,196 @@
+package testutil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RecordingHandler is an http.Handler that records the request it receives,
+// for asserting what a middleware passed down the chain
+type RecordingHandler struct {
+	// Status and Body are written for every request (default 200, empty)
+	Status int
+	Body   string
+
+	mu      sync.Mutex
+	request *http.Request
+	calls   int
+}
+
+// ServeHTTP implements http.Handler
+func (h *RecordingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.request = r
+	h.calls++
+	h.mu.Unlock()
+
+	status := h.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, h.Body)
+}
+
+// Request returns the last request seen, or nil if never called
+func (h *RecordingHandler) Request() *http.Request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.request
+}
+
+// Calls returns how many requests reached the handler
+func (h *RecordingHandler) Calls() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.calls
+}
+
+// ServeMiddleware wraps a RecordingHandler with middleware, serves req and
+// returns the recorded response together with the inner handler
+func ServeMiddleware(middleware func(http.Handler) http.Handler, req *http.Request) (*httptest.ResponseRecorder, *RecordingHandler) {
+	next := &RecordingHandler{}
+	rec := httptest.NewRecorder()
+	middleware(next).ServeHTTP(rec, req)
+	return rec, next
+}
+
+// AssertHeader fails the test unless the response header key equals want
+func AssertHeader(t testing.TB, rec *httptest.ResponseRecorder, key, want string) {
+	t.Helper()
+
+	if got := rec.Header().Get(key); got != want {
+		t.Errorf("header %s = %q, want %q", key, got, want)
+	}
+}
+
+// RecordingServerStream is a grpc.ServerTransportStream that records headers
+// and trailers set by interceptors via grpc.SetHeader/SendHeader/SetTrailer
+type RecordingServerStream struct {
+	method string
+
+	mu      sync.Mutex
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+// Method implements grpc.ServerTransportStream
+func (s *RecordingServerStream) Method() string {
+	return s.method
+}
+
+// SetHeader implements grpc.ServerTransportStream
+func (s *RecordingServerStream) SetHeader(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+// SendHeader implements grpc.ServerTransportStream
+func (s *RecordingServerStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+// SetTrailer implements grpc.ServerTransportStream
+func (s *RecordingServerStream) SetTrailer(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+// Header returns the recorded response headers
+func (s *RecordingServerStream) Header() metadata.MD {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.header.Copy()
+}
+
+// Trailer returns the recorded response trailers
+func (s *RecordingServerStream) Trailer() metadata.MD {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trailer.Copy()
+}
+
+// UnaryCall describes a unary call made through an interceptor
+type UnaryCall struct {
+	// Method is the full method name, e.g. /api.v1.UserService/GetUser
+	Method string
+
+	// Metadata is sent as incoming request metadata
+	Metadata metadata.MD
+
+	// Request is passed to the interceptor
+	Request interface{}
+
+	// Response and Err are returned by the fake handler
+	Response interface{}
+	Err      error
+}
+
+// UnaryResult records what happened during InvokeUnary
+type UnaryResult struct {
+	// Response and Err are what the interceptor returned
+	Response interface{}
+	Err      error
+
+	// HandlerCalled reports whether the interceptor invoked the handler
+	HandlerCalled bool
+
+	// HandlerContext is the context the handler received
+	HandlerContext context.Context
+
+	// Stream holds headers and trailers set during the call
+	Stream *RecordingServerStream
+}
+
+// Code returns the gRPC status code of Err
+func (r *UnaryResult) Code() codes.Code {
+	return status.Code(r.Err)
+}
+
+// IncomingMetadata returns the metadata the handler saw
+func (r *UnaryResult) IncomingMetadata() metadata.MD {
+	if r.HandlerContext == nil {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(r.HandlerContext)
+	return md
+}
+
+// InvokeUnary runs interceptor with a recorded context and fake handler
+func InvokeUnary(ctx context.Context, interceptor grpc.UnaryServerInterceptor, call UnaryCall) *UnaryResult {
+	if call.Method == "" {
+		call.Method = "/test.Service/Method"
+	}
+
+	result := &UnaryResult{
+		Stream: &RecordingServerStream{method: call.Method},
+	}
+
+	ctx = grpc.NewContextWithServerTransportStream(ctx, result.Stream)
+	if call.Metadata != nil {
+		ctx = metadata.NewIncomingContext(ctx, call.Metadata)
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		result.HandlerCalled = true
+		result.HandlerContext = ctx
+		return call.Response, call.Err
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: call.Method}
+	result.Response, result.Err = interceptor(ctx, call.Request, info, handler)
+	return result
+}
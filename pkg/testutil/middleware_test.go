@@ -0,0 +1,76 @@
+package testutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestServeMiddleware(t *testing.T) {
+	middleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Frame-Options", "DENY")
+			r.Header.Set("X-Forwarded-By", "middleware")
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	rec, next := ServeMiddleware(middleware, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	AssertHeader(t, rec, "X-Frame-Options", "DENY")
+	if next.Calls() != 1 {
+		t.Fatalf("next handler called %d times, want 1", next.Calls())
+	}
+	if got := next.Request().Header.Get("X-Forwarded-By"); got != "middleware" {
+		t.Errorf("propagated header = %q, want %q", got, "middleware")
+	}
+}
+
+func TestInvokeUnary(t *testing.T) {
+	// An interceptor that requires a token, propagates a tenant and echoes a header
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if len(md.Get("authorization")) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "missing token")
+		}
+		grpc.SetHeader(ctx, metadata.Pairs("x-served-by", info.FullMethod))
+		return handler(metadata.AppendToOutgoingContext(ctx, "tenant", "acme"), req)
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		result := InvokeUnary(context.Background(), interceptor, UnaryCall{})
+		if result.Code() != codes.Unauthenticated {
+			t.Errorf("code = %v, want %v", result.Code(), codes.Unauthenticated)
+		}
+		if result.HandlerCalled {
+			t.Errorf("handler should not be called")
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		result := InvokeUnary(context.Background(), interceptor, UnaryCall{
+			Method:   "/api.v1.UserService/GetUser",
+			Metadata: metadata.Pairs("authorization", "Bearer token"),
+			Response: "ok",
+		})
+		if result.Err != nil || result.Response != "ok" {
+			t.Fatalf("result = %v, %v, want ok", result.Response, result.Err)
+		}
+		if got := result.IncomingMetadata().Get("authorization"); len(got) != 1 {
+			t.Errorf("handler incoming metadata = %v, want authorization", got)
+		}
+		out, _ := metadata.FromOutgoingContext(result.HandlerContext)
+		if got := out.Get("tenant"); len(got) != 1 || got[0] != "acme" {
+			t.Errorf("handler outgoing tenant = %v, want acme", got)
+		}
+		if got := result.Stream.Header().Get("x-served-by"); len(got) != 1 || got[0] != "/api.v1.UserService/GetUser" {
+			t.Errorf("response header x-served-by = %v", got)
+		}
+	})
+}
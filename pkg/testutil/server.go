@@ -0,0 +1,173 @@
+// Package testutil provides helpers for integration-style tests that need the
+// full gRPC server and gateway without binding real ports.
+package testutil
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	apiv2 "github.com/ChyiYaqing/go-microservice-template/api/proto/v2"
+	"github.com/ChyiYaqing/go-microservice-template/internal/app"
+	"github.com/ChyiYaqing/go-microservice-template/internal/server"
+	"github.com/ChyiYaqing/go-microservice-template/internal/service"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufSize = 1024 * 1024
+
+// Server is an in-process instance of the gRPC server and HTTP gateway
+type Server struct {
+	// GRPCServer is the underlying gRPC server
+	GRPCServer *grpc.Server
+
+	// Conn is a client connection to the gRPC server over bufconn
+	Conn *grpc.ClientConn
+
+	// Services are the services the servers expose
+	Services *app.Registry
+
+	// Client is a ready-to-use UserService gRPC client
+	Client apiv1.UserServiceClient
+
+	// ClientV2 is an api.v2 UserService client. It is served unless
+	// WithUserService replaced the service.
+	ClientV2 apiv2.UserServiceClient
+
+	// HTTPServer serves the gateway, Swagger and health routes over
+	// bufconn
+	HTTPServer *http.Server
+
+	// HTTPClient is a client for HTTPServer, dialing it over bufconn. Other
+	// clients cannot reach it.
+	HTTPClient *http.Client
+
+	// URL is the base URL of HTTPServer for HTTPClient
+	URL string
+}
+
+// Option configures the test server
+type Option func(*options)
+
+type options struct {
+	userService   apiv1.UserServiceServer
+	log           logger.Logger
+	serverOptions []grpc.ServerOption
+	httpOptions   []server.HTTPOption
+}
+
+// WithUserService overrides the UserService implementation
+func WithUserService(svc apiv1.UserServiceServer) Option {
+	return func(o *options) {
+		o.userService = svc
+	}
+}
+
+// WithLogger overrides the logger, which discards output by default
+func WithLogger(log logger.Logger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+// WithServerOptions appends extra gRPC server options (e.g. interceptors)
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(o *options) {
+		o.serverOptions = append(o.serverOptions, opts...)
+	}
+}
+
+// WithHTTPOptions appends options for the HTTP handler
+func WithHTTPOptions(opts ...server.HTTPOption) Option {
+	return func(o *options) {
+		o.httpOptions = append(o.httpOptions, opts...)
+	}
+}
+
+// NewServer starts the gRPC server and gateway in-process and registers
+// cleanup with t so everything is torn down when the test finishes
+func NewServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	o := &options{
+		log: NopLogger(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.userService == nil {
+		o.userService = service.NewUserService()
+	}
+
+	services := []app.Service{app.NewService(&apiv1.UserService_ServiceDesc, o.userService, apiv1.RegisterUserServiceHandler)}
+	// api.v2 is served over the same users, when they are the real service's
+	if users, ok := o.userService.(*service.UserService); ok {
+		services = append(services, app.NewService(&apiv2.UserService_ServiceDesc, service.NewUserServiceV2(users), apiv2.RegisterUserServiceHandler))
+	}
+	registry, err := app.NewRegistry(services...)
+	if err != nil {
+		t.Fatalf("testutil: failed to register services: %v", err)
+	}
+
+	lis := bufconn.Listen(bufSize)
+	grpcServer := server.NewGRPCServer(o.log, registry, nil, nil, o.serverOptions...)
+	go func() {
+		_ = grpcServer.Serve(lis)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := server.DialGateway(ctx, "passthrough:///bufnet", server.GatewayOptions{},
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		cancel()
+		grpcServer.Stop()
+		t.Fatalf("testutil: failed to create gRPC client: %v", err)
+	}
+
+	handler, err := server.NewHTTPHandler(ctx, conn, o.log, registry, o.httpOptions...)
+	if err != nil {
+		cancel()
+		conn.Close()
+		grpcServer.Stop()
+		t.Fatalf("testutil: failed to create HTTP handler: %v", err)
+	}
+	httpLis := bufconn.Listen(bufSize)
+	httpServer := &http.Server{Handler: handler}
+	go func() {
+		_ = httpServer.Serve(httpLis)
+	}()
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return httpLis.DialContext(ctx)
+		},
+	}
+
+	t.Cleanup(func() {
+		transport.CloseIdleConnections()
+		httpServer.Close()
+		cancel()
+		conn.Close()
+		grpcServer.Stop()
+		lis.Close()
+	})
+
+	return &Server{
+		GRPCServer: grpcServer,
+		Conn:       conn,
+		Services:   registry,
+		Client:     apiv1.NewUserServiceClient(conn),
+		ClientV2:   apiv2.NewUserServiceClient(conn),
+		HTTPServer: httpServer,
+		HTTPClient: &http.Client{Transport: transport},
+		URL:        "http://bufnet",
+	}
+}
@@ -0,0 +1,43 @@
+package testutil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+)
+
+func TestNewServer(t *testing.T) {
+	srv := NewServer(t)
+	ctx := context.Background()
+
+	// gRPC path
+	resp, err := srv.Client.CreateUser(ctx, &apiv1.CreateUserRequest{
+		User: &apiv1.User{Email: "grpc@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("CreateUser() unexpected error: %v", err)
+	}
+	if resp.ErrorCode != response.CodeSuccess {
+		t.Fatalf("CreateUser() error_code = %d, want %d", resp.ErrorCode, response.CodeSuccess)
+	}
+
+	// REST path through the gateway
+	httpResp, err := srv.HTTPClient.Get(srv.URL + "/v1/users/1")
+	if err != nil {
+		t.Fatalf("GET /v1/users/1 unexpected error: %v", err)
+	}
+	defer httpResp.Body.Close()
+
+	body, _ := io.ReadAll(httpResp.Body)
+	if httpResp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /v1/users/1 status = %d, want %d", httpResp.StatusCode, http.StatusOK)
+	}
+	if !strings.Contains(string(body), "grpc@example.com") {
+		t.Errorf("GET /v1/users/1 body = %s, want created user", body)
+	}
+}
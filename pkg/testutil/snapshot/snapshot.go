@@ -0,0 +1,183 @@
+// Package snapshot canonicalizes and diffs CommonResponse payloads so tests
+// can assert on whole responses instead of digging through structpb fields.
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// UpdateEnv is the environment variable that rewrites snapshot files when set
+const UpdateEnv = "UPDATE_SNAPSHOTS"
+
+// Mask is the placeholder substituted for masked field values
+const Mask = "<masked>"
+
+// DefaultMaskedFields are volatile fields masked unless overridden
+var DefaultMaskedFields = []string{"create_time", "update_time"}
+
+// Option configures canonicalization
+type Option func(*options)
+
+type options struct {
+	masked map[string]bool
+}
+
+// WithMaskedFields replaces the set of masked field names. Pass no names to
+// disable masking.
+func WithMaskedFields(names ...string) Option {
+	return func(o *options) {
+		o.masked = make(map[string]bool, len(names))
+		for _, name := range names {
+			o.masked[name] = true
+		}
+	}
+}
+
+// Canonicalize renders resp as indented JSON with sorted keys, snake_case
+// field names and masked volatile fields
+func Canonicalize(resp *apiv1.CommonResponse, opts ...Option) (string, error) {
+	raw, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(resp)
+	if err != nil {
+		return "", err
+	}
+	return CanonicalizeJSON(raw, opts...)
+}
+
+// CanonicalizeJSON canonicalizes an arbitrary JSON document the same way
+func CanonicalizeJSON(raw []byte, opts ...Option) (string, error) {
+	o := &options{}
+	WithMaskedFields(DefaultMaskedFields...)(o)
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(mask(v, o.masked)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// AssertResponse fails the test unless resp canonicalizes to the same JSON
+// as want, printing a line diff on mismatch
+func AssertResponse(t testing.TB, resp *apiv1.CommonResponse, want string, opts ...Option) {
+	t.Helper()
+
+	got, err := Canonicalize(resp, opts...)
+	if err != nil {
+		t.Fatalf("failed to canonicalize response: %v", err)
+	}
+	wantCanon, err := CanonicalizeJSON([]byte(want), opts...)
+	if err != nil {
+		t.Fatalf("invalid expected JSON: %v", err)
+	}
+	if got != wantCanon {
+		t.Errorf("response mismatch (-want +got):\n%s", Diff(wantCanon, got))
+	}
+}
+
+// Match compares resp with testdata/snapshots/<name>.json, creating or
+// rewriting the file when UPDATE_SNAPSHOTS is set
+func Match(t testing.TB, name string, resp *apiv1.CommonResponse, opts ...Option) {
+	t.Helper()
+
+	got, err := Canonicalize(resp, opts...)
+	if err != nil {
+		t.Fatalf("failed to canonicalize response: %v", err)
+	}
+
+	path := filepath.Join("testdata", "snapshots", name+".json")
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create snapshot dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("failed to write snapshot: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read snapshot (run with %s=1 to create): %v", UpdateEnv, err)
+	}
+	if got != string(want) {
+		t.Errorf("snapshot %s mismatch (-want +got):\n%s", path, Diff(string(want), got))
+	}
+}
+
+// Diff returns a line diff of two texts, prefixing removed lines with "-"
+// and added lines with "+"
+func Diff(want, got string) string {
+	a := strings.Split(strings.TrimSuffix(want, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(&out, "  %s\n", a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Fprintf(&out, "+ %s\n", b[j])
+			j++
+		default:
+			fmt.Fprintf(&out, "- %s\n", a[i])
+			i++
+		}
+	}
+	return out.String()
+}
+
+// mask replaces values of masked fields anywhere in v
+func mask(v interface{}, masked map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if masked[key] && val != nil {
+				v[key] = Mask
+				continue
+			}
+			v[key] = mask(val, masked)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = mask(v[i], masked)
+		}
+	}
+	return v
+}
@@ -0,0 +1,57 @@
+package snapshot
+
+import (
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestAssertResponse(t *testing.T) {
+	resp, err := response.Success(&apiv1.User{
+		Name:       "users/1",
+		Email:      "a@example.com",
+		CreateTime: timestamppb.Now(),
+		IsActive:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Key order and whitespace in the expectation do not matter
+	AssertResponse(t, resp, `{
+		"error_msg": "success",
+		"error_code": 0,
+		"data": {"result": {"is_active": true, "email": "a@example.com", "name": "users/1", "create_time": "ignored"}},
+		"payload": null
+	}`)
+
+	AssertResponse(t, response.NotFound("user users/2 not found"),
+		`{"error_code": 404, "error_msg": "user users/2 not found", "data": null, "payload": null}`)
+}
+
+func TestCanonicalizeMasking(t *testing.T) {
+	data, _ := structpb.NewStruct(map[string]interface{}{"create_time": "2025-01-01T00:00:00Z"})
+	resp := &apiv1.CommonResponse{Data: data}
+
+	masked, _ := Canonicalize(resp)
+	if !strings.Contains(masked, Mask) {
+		t.Errorf("Canonicalize() = %s, want create_time masked", masked)
+	}
+
+	unmasked, _ := Canonicalize(resp, WithMaskedFields())
+	if !strings.Contains(unmasked, "2025-01-01T00:00:00Z") {
+		t.Errorf("Canonicalize(WithMaskedFields()) = %s, want create_time kept", unmasked)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	got := Diff("a\nb\nc\n", "a\nx\nc\n")
+	want := "  a\n+ x\n- b\n  c\n"
+	if got != want {
+		t.Errorf("Diff() =\n%s\nwant\n%s", got, want)
+	}
+}
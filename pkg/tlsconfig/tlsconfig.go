@@ -0,0 +1,136 @@
+// Package tlsconfig builds the TLS configurations of the listeners and of
+// the gateway's connection to the gRPC server from config.TLSConfig, and
+// those of other clients of the gRPC server.
+package tlsconfig
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+)
+
+// Server returns the TLS configuration of a listener serving cfg's
+// certificate. With verifyClients and a client CA bundle, clients must
+// present a certificate signed by one of its CAs.
+func Server(cfg config.TLSConfig, verifyClients bool) (*tls.Config, error) {
+	minVersion, err := parseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := loadKeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	c := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+	}
+	if verifyClients && cfg.ClientCAFile != "" {
+		pool, err := loadPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.ClientCAs = pool
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return c, nil
+}
+
+// Gateway returns the TLS configuration the gateway dials the gRPC server
+// with. The gateway dials its own process by an address the certificate
+// need not name, so rather than verify names it trusts exactly the
+// certificate the server serves. Under mutual TLS it presents the gateway
+// certificate.
+func Gateway(cfg config.TLSConfig) (*tls.Config, error) {
+	minVersion, err := parseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	server, err := loadKeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	leaf := server.Certificate[0]
+	c := &tls.Config{
+		MinVersion:         minVersion,
+		InsecureSkipVerify: true, // replaced by the check of VerifyConnection
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || !bytes.Equal(cs.PeerCertificates[0].Raw, leaf) {
+				return errors.New("tlsconfig: the gRPC server presented a certificate other than server.tls.cert_file")
+			}
+			return nil
+		},
+	}
+	if cfg.ClientCAFile != "" {
+		client := server
+		if cfg.GatewayCertFile != "" || cfg.GatewayKeyFile != "" {
+			if client, err = loadKeyPair(cfg.GatewayCertFile, cfg.GatewayKeyFile); err != nil {
+				return nil, err
+			}
+		}
+		c.Certificates = []tls.Certificate{client}
+	}
+	return c, nil
+}
+
+// Client returns the TLS configuration of another client of the gRPC
+// server, such as pkg/client. It trusts the CAs of caFile, or the system's
+// without one, and verifies the server is serverName, by default the host
+// dialed. With certFile and keyFile it presents that certificate, for
+// mutual TLS.
+func Client(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	c := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: serverName}
+	if caFile != "" {
+		pool, err := loadPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := loadKeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+func loadKeyPair(certFile, keyFile string) (tls.Certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return tls.Certificate{}, errors.New("tlsconfig: a certificate and a key file are required")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("tlsconfig: %w", err)
+	}
+	return cert, nil
+}
+
+func loadPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("tlsconfig: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tlsconfig: no certificates in %s", file)
+	}
+	return pool, nil
+}
+
+func parseVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("tlsconfig: unknown min_version %q, want 1.2 or 1.3", v)
+}
@@ -0,0 +1,227 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// issuer signs test certificates
+type issuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T, name string) *issuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &issuer{cert: cert, key: key}
+}
+
+// write issues a certificate for name with usages, writing it and its key
+// to dir, and returns the paths
+func (ca *issuer) write(t *testing.T, dir, name string, usages ...x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usages,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func (ca *issuer) writeCA(t *testing.T, dir string) string {
+	t.Helper()
+	file := filepath.Join(dir, ca.cert.Subject.CommonName+".crt")
+	writePEM(t, file, "CERTIFICATE", ca.cert.Raw)
+	return file
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve starts a gRPC server with the health service over TLS, returning
+// its address
+func serve(t *testing.T, tlsConfig *tls.Config) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+// check calls the health service at addr with tlsConfig
+func check(t *testing.T, addr string, tlsConfig *tls.Config) error {
+	t.Helper()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	certFile, keyFile := ca.write(t, dir, "server", x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth)
+	cfg := config.TLSConfig{
+		Enabled:      true,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: ca.writeCA(t, dir),
+	}
+	serverTLS, err := Server(cfg, true)
+	if err != nil {
+		t.Fatalf("Server() unexpected error: %v", err)
+	}
+	addr := serve(t, serverTLS)
+
+	gatewayTLS, err := Gateway(cfg)
+	if err != nil {
+		t.Fatalf("Gateway() unexpected error: %v", err)
+	}
+	if err := check(t, addr, gatewayTLS); err != nil {
+		t.Errorf("gateway call unexpected error: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if err := check(t, addr, &tls.Config{RootCAs: roots, ServerName: "server"}); err == nil {
+		t.Error("call without a client certificate expected error")
+	}
+
+	stranger := newCA(t, "stranger")
+	strangerCert, strangerKey := stranger.write(t, dir, "client", x509.ExtKeyUsageClientAuth)
+	cert, err := tls.LoadX509KeyPair(strangerCert, strangerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check(t, addr, &tls.Config{RootCAs: roots, ServerName: "server", Certificates: []tls.Certificate{cert}}); err == nil {
+		t.Error("call with a certificate of another CA expected error")
+	}
+
+	clientCert, clientKey := ca.write(t, dir, "client", x509.ExtKeyUsageClientAuth)
+	clientTLS, err := Client(cfg.ClientCAFile, clientCert, clientKey, "server")
+	if err != nil {
+		t.Fatalf("Client() unexpected error: %v", err)
+	}
+	if err := check(t, addr, clientTLS); err != nil {
+		t.Errorf("call with a client certificate unexpected error: %v", err)
+	}
+	if clientTLS, err = Client(cfg.ClientCAFile, clientCert, clientKey, "other"); err != nil {
+		t.Fatalf("Client() unexpected error: %v", err)
+	}
+	if err := check(t, addr, clientTLS); err == nil {
+		t.Error("call to a server with another name expected error")
+	}
+	if _, err := Client(cfg.ClientCAFile, clientCert, "", ""); err == nil {
+		t.Error("Client() with a certificate but no key expected error")
+	}
+}
+
+// TestGatewayPinsServer checks the gateway only trusts the configured
+// server certificate, even one signed by the same CA
+func TestGatewayPinsServer(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	certFile, keyFile := ca.write(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	otherCert, otherKey := ca.write(t, dir, "other", x509.ExtKeyUsageServerAuth)
+
+	gatewayTLS, err := Gateway(config.TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("Gateway() unexpected error: %v", err)
+	}
+	if gatewayTLS.Certificates != nil {
+		t.Error("Gateway() without a client CA presents a certificate")
+	}
+
+	serverTLS, err := Server(config.TLSConfig{Enabled: true, CertFile: otherCert, KeyFile: otherKey}, true)
+	if err != nil {
+		t.Fatalf("Server() unexpected error: %v", err)
+	}
+	if err := check(t, serve(t, serverTLS), gatewayTLS); err == nil {
+		t.Error("gateway call to a server with another certificate expected error")
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := newCA(t, "ca").write(t, dir, "server", x509.ExtKeyUsageServerAuth)
+
+	for name, cfg := range map[string]config.TLSConfig{
+		"no key":              {CertFile: certFile},
+		"missing certificate": {CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile},
+		"unknown version":     {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.1"},
+		"empty CA bundle":     {CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile},
+	} {
+		if _, err := Server(cfg, true); err == nil {
+			t.Errorf("Server() with %s expected error", name)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package toggle provides debug switches, such as gRPC reflection, that
+// operators can flip at runtime for a limited time. Each toggle starts at
+// its configured value. An override lasts until its TTL passes, then the
+// toggle reverts on its own, so a debugging session cannot leave a
+// production server exposed.
+package toggle
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrNotFound is returned for an unregistered toggle
+	ErrNotFound = errors.New("toggle not found")
+
+	// ErrInvalidTTL is returned for a negative TTL or one over the maximum
+	ErrInvalidTTL = errors.New("invalid toggle TTL")
+)
+
+// DefaultMaxTTL bounds overrides when New is given no maximum
+const DefaultMaxTTL = time.Hour
+
+// State describes a toggle
+type State struct {
+	Name        string
+	Description string
+	Enabled     bool
+
+	// Until is when the override reverts to the configured value, zero
+	// when the toggle follows its configuration
+	Until time.Time
+}
+
+// Toggle is a debug switch. It is safe for concurrent use.
+type Toggle struct {
+	name        string
+	description string
+	configured  bool
+	maxTTL      time.Duration
+	clock       clock.Clock
+
+	mu       sync.Mutex
+	override bool
+	until    time.Time
+}
+
+// New creates a Toggle with its configured value. Overrides last at most
+// maxTTL, DefaultMaxTTL when it is not positive.
+func New(name, description string, configured bool, maxTTL time.Duration, c clock.Clock) *Toggle {
+	if maxTTL <= 0 {
+		maxTTL = DefaultMaxTTL
+	}
+	if c == nil {
+		c = clock.Real()
+	}
+	return &Toggle{name: name, description: description, configured: configured, maxTTL: maxTTL, clock: c}
+}
+
+// Enabled reports whether the toggle is on now
+func (t *Toggle) Enabled() bool {
+	return t.State().Enabled
+}
+
+// State returns the current state
+func (t *Toggle) State() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state()
+}
+
+// Set overrides the toggle for ttl, the maximum TTL when ttl is zero, and
+// returns the new state. Setting the configured value drops the override.
+func (t *Toggle) Set(enabled bool, ttl time.Duration) (State, error) {
+	if ttl < 0 || ttl > t.maxTTL {
+		return State{}, fmt.Errorf("%w: must be between 0 and %s", ErrInvalidTTL, t.maxTTL)
+	}
+	if ttl == 0 {
+		ttl = t.maxTTL
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if enabled == t.configured {
+		t.until = time.Time{}
+	} else {
+		t.override, t.until = enabled, t.clock.Now().Add(ttl)
+	}
+	return t.state(), nil
+}
+
+// MaxTTL returns the longest an override lasts
+func (t *Toggle) MaxTTL() time.Duration {
+	return t.maxTTL
+}
+
+// StreamServerInterceptor hides the streaming services under prefix, e.g.
+// "/grpc.reflection.", while the toggle is off. Callers get the error of a
+// service that is not registered, so the service can stay registered and
+// be turned on without a restart.
+func (t *Toggle) StreamServerInterceptor(prefix string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !strings.HasPrefix(info.FullMethod, prefix) || t.Enabled() {
+			return handler(srv, ss)
+		}
+		service, _, _ := strings.Cut(strings.TrimPrefix(info.FullMethod, "/"), "/")
+		return status.Errorf(codes.Unimplemented, "unknown service %v", service)
+	}
+}
+
+// state returns the state, dropping an expired override. t.mu must be
+// held.
+func (t *Toggle) state() State {
+	if !t.until.IsZero() && !t.clock.Now().Before(t.until) {
+		t.until = time.Time{}
+	}
+	s := State{Name: t.name, Description: t.description, Enabled: t.configured}
+	if !t.until.IsZero() {
+		s.Enabled, s.Until = t.override, t.until
+	}
+	return s
+}
+
+// Registry holds the toggles the admin API can change. It is safe for
+// concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	toggles map[string]*Toggle
+}
+
+// NewRegistry creates a Registry holding toggles
+func NewRegistry(toggles ...*Toggle) (*Registry, error) {
+	r := &Registry{toggles: make(map[string]*Toggle)}
+	for _, t := range toggles {
+		if err := r.Register(t); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds a toggle. Names must be unique.
+func (r *Registry) Register(t *Toggle) error {
+	if t.name == "" {
+		return errors.New("toggle: a toggle needs a name")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.toggles[t.name]; ok {
+		return fmt.Errorf("toggle: %q already registered", t.name)
+	}
+	r.toggles[t.name] = t
+	return nil
+}
+
+// List returns every toggle's state, sorted by name
+func (r *Registry) List() []State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := make([]State, 0, len(r.toggles))
+	for _, t := range r.toggles {
+		states = append(states, t.State())
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// Get returns the named toggle
+func (r *Registry) Get(name string) (*Toggle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.toggles[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return t, nil
+}
@@ -0,0 +1,84 @@
+package toggle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/clock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToggle(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	tg := New("reflection", "gRPC reflection", false, 30*time.Minute, fake)
+	if tg.Enabled() {
+		t.Fatal("Enabled() = true, want the configured false")
+	}
+
+	state, err := tg.Set(true, 10*time.Minute)
+	if err != nil || !state.Enabled || !state.Until.Equal(fake.Now().Add(10*time.Minute)) {
+		t.Fatalf("Set(true, 10m) = %+v, %v, want enabled for 10m", state, err)
+	}
+	fake.Advance(9 * time.Minute)
+	if !tg.Enabled() {
+		t.Error("Enabled() = false before the TTL passed")
+	}
+	fake.Advance(time.Minute)
+	if state := tg.State(); state.Enabled || !state.Until.IsZero() {
+		t.Errorf("State() = %+v after the TTL, want reverted to the configuration", state)
+	}
+
+	if state, _ := tg.Set(true, 0); !state.Until.Equal(fake.Now().Add(30 * time.Minute)) {
+		t.Errorf("Set(true, 0) until %v, want the maximum TTL", state.Until)
+	}
+	if state, _ := tg.Set(false, 0); state.Enabled || !state.Until.IsZero() {
+		t.Errorf("Set(false, 0) = %+v, want the override dropped", state)
+	}
+	for _, ttl := range []time.Duration{-time.Second, time.Hour} {
+		if _, err := tg.Set(true, ttl); !errors.Is(err, ErrInvalidTTL) {
+			t.Errorf("Set(true, %s) error = %v, want %v", ttl, err, ErrInvalidTTL)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(New("reflection", "", true, 0, nil), New("a_toggle", "", false, 0, nil))
+	if err != nil {
+		t.Fatalf("NewRegistry() unexpected error: %v", err)
+	}
+	if err := r.Register(New("reflection", "", false, 0, nil)); err == nil {
+		t.Error("Register() duplicate expected error")
+	}
+	if states := r.List(); len(states) != 2 || states[0].Name != "a_toggle" || !states[1].Enabled {
+		t.Errorf("List() = %+v, want both toggles sorted by name", states)
+	}
+	if _, err := r.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() missing error = %v, want %v", err, ErrNotFound)
+	}
+	if tg, err := r.Get("reflection"); err != nil || tg.MaxTTL() != DefaultMaxTTL {
+		t.Errorf("Get(reflection) = %v, %v, want the toggle with the default maximum TTL", tg, err)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	tg := New("reflection", "", false, 0, nil)
+	intercept := tg.StreamServerInterceptor("/grpc.reflection.")
+	call := func(method string) error {
+		return intercept(nil, nil, &grpc.StreamServerInfo{FullMethod: method}, func(interface{}, grpc.ServerStream) error { return nil })
+	}
+
+	err := call("/grpc.reflection.v1.ServerReflection/ServerReflectionInfo")
+	if status.Code(err) != codes.Unimplemented || status.Convert(err).Message() != "unknown service grpc.reflection.v1.ServerReflection" {
+		t.Errorf("reflection while off = %v, want the unknown service error", err)
+	}
+	if err := call("/api.v1.UserService/StreamUsers"); err != nil {
+		t.Errorf("other streams while off = %v, want served", err)
+	}
+	tg.Set(true, time.Minute)
+	if err := call("/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"); err != nil {
+		t.Errorf("reflection while on = %v, want served", err)
+	}
+}
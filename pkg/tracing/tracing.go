@@ -0,0 +1,353 @@
+// Package tracing traces requests with OpenTelemetry and exports the spans
+// to an OTLP collector.
+//
+// Server interceptors and the HTTP middleware continue the caller's trace,
+// read from the W3C traceparent header or metadata, and client interceptors
+// pass it on, so a call through the gateway and on to other services is a
+// single trace. RPC spans carry the method, the gRPC status code, the error
+// code of a CommonResponse and the resource name the request targets.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/audit"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Span attributes beyond the OpenTelemetry semantic conventions
+const (
+	// AttrResourceName is the resource name the request targets, such as
+	// users/123
+	AttrResourceName = attribute.Key("app.resource.name")
+
+	// AttrErrorCode is the error code of a CommonResponse, set when it is
+	// not 0
+	AttrErrorCode = attribute.Key("app.response.error_code")
+)
+
+// DefaultServiceName names the service in traces when the configuration
+// does not
+const DefaultServiceName = "go-microservice-template"
+
+// instrumentationName identifies the spans this package starts
+const instrumentationName = "github.com/ChyiYaqing/go-microservice-template/pkg/tracing"
+
+// Tracer starts the spans of a server and the calls it makes
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New creates a Tracer starting spans with tp, propagating the W3C trace
+// context and baggage
+func New(tp trace.TracerProvider) *Tracer {
+	return &Tracer{
+		tracer:     tp.Tracer(instrumentationName),
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}
+}
+
+// Setup creates a Tracer exporting spans to the OTLP collector of cfg, and
+// installs its provider and propagator as the global ones for libraries
+// that trace on their own. The returned func flushes the spans not yet
+// exported and stops the exporter.
+func Setup(ctx context.Context, cfg config.TracingConfig) (*Tracer, func(context.Context) error, error) {
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := cfg.ServiceName
+	if name == "" {
+		name = DefaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(name)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("tracing: resource: %w", err)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// Requests continuing a trace follow the caller's decision
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+
+	t := New(tp)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(t.propagator)
+	return t, tp.Shutdown, nil
+}
+
+// newExporter creates the OTLP exporter of cfg.Protocol. It connects
+// lazily, so a collector that is down does not fail startup.
+func newExporter(ctx context.Context, cfg config.TracingConfig) (*otlptrace.Exporter, error) {
+	switch cfg.Protocol {
+	case "grpc", "":
+		var opts []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case "http":
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing protocol %q, expected grpc or http", cfg.Protocol)
+	}
+}
+
+// UnaryServerInterceptor traces unary requests, continuing the caller's
+// trace
+func (t *Tracer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := t.startServer(ctx, info.FullMethod, req)
+		defer span.End()
+		resp, err := handler(ctx, req)
+		finish(span, resp, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor traces streams until the handler returns
+func (t *Tracer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := t.startServer(ss.Context(), info.FullMethod, nil)
+		defer span.End()
+		err := handler(srv, &tracedServerStream{ServerStream: ss, ctx: ctx})
+		finish(span, nil, err)
+		return err
+	}
+}
+
+// startServer starts the server span of method, as a child of the span in
+// the incoming metadata
+func (t *Tracer) startServer(ctx context.Context, method string, req interface{}) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = t.propagator.Extract(ctx, metadataCarrier(md))
+	return t.tracer.Start(ctx, spanName(method),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(rpcAttributes(method, req)...),
+	)
+}
+
+// tracedServerStream hands the handler the context holding the span
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context { return s.ctx }
+
+// UnaryClientInterceptor traces calls, passing the trace on in the outgoing
+// metadata
+func (t *Tracer) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := t.startClient(ctx, method, req)
+		defer span.End()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		finish(span, reply, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor traces streams until they end with an error or
+// io.EOF. Streams the caller abandons without reading to the end are not
+// exported.
+func (t *Tracer) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := t.startClient(ctx, method, nil)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			finish(span, nil, err)
+			span.End()
+			return nil, err
+		}
+		return &tracedClientStream{ClientStream: cs, span: span}, nil
+	}
+}
+
+// startClient starts the client span of method and adds its context to the
+// outgoing metadata
+func (t *Tracer) startClient(ctx context.Context, method string, req interface{}) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, spanName(method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(rpcAttributes(method, req)...),
+	)
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	t.propagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// tracedClientStream ends its span when the stream ends
+type tracedClientStream struct {
+	grpc.ClientStream
+	span trace.Span
+}
+
+func (s *tracedClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		finish(s.span, nil, err)
+		s.span.End()
+	}
+	return err
+}
+
+// Middleware traces HTTP requests, continuing the caller's trace. The
+// gateway's client interceptor passes it on to the gRPC server.
+func (t *Tracer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		// Paths carry resource IDs, so spans are named by method only
+		ctx, span := t.tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(otelcodes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// spanName returns the span name of a full gRPC method name, without the
+// leading slash as the conventions ask
+func spanName(method string) string {
+	return strings.TrimPrefix(method, "/")
+}
+
+// rpcAttributes returns the attributes of a call to method with req
+func rpcAttributes(method string, req interface{}) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.RPCSystemGRPC}
+	if service, name, ok := strings.Cut(spanName(method), "/"); ok {
+		attrs = append(attrs, semconv.RPCService(service), semconv.RPCMethod(name))
+	}
+	if name := audit.ResourceName(req); name != "" {
+		attrs = append(attrs, AttrResourceName.String(name))
+	}
+	return attrs
+}
+
+// codedResponse is a response reporting errors in a code of its own, like
+// CommonResponse
+type codedResponse interface {
+	GetErrorCode() int32
+}
+
+// finish records the outcome of a call on its span
+func finish(span trace.Span, resp interface{}, err error) {
+	st, _ := status.FromError(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(st.Code())))
+	if err != nil {
+		span.SetStatus(otelcodes.Error, st.Message())
+		return
+	}
+	if r, ok := resp.(codedResponse); ok && r.GetErrorCode() != 0 {
+		span.SetAttributes(AttrErrorCode.Int(int(r.GetErrorCode())))
+	}
+}
+
+// metadataCarrier reads and writes the trace context in gRPC metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// statusWriter remembers the status code written through it
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes flushes through for streaming responses
+func (w *statusWriter) Flush() {
+	w.wroteHeader = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,138 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/config"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestTracer() (*Tracer, *tracetest.SpanRecorder) {
+	rec := tracetest.NewSpanRecorder()
+	return New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))), rec
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// TestPropagation follows a call from the HTTP middleware through the
+// gateway's client interceptor to the gRPC server
+func TestPropagation(t *testing.T) {
+	tracer, rec := newTestTracer()
+	const method = "/api.v1.UserService/GetUser"
+	req := &apiv1.GetUserRequest{Name: "users/42"}
+
+	server := tracer.UnaryServerInterceptor()
+	client := tracer.UnaryClientInterceptor()
+	// The invoker hands the outgoing metadata to the server, as the
+	// connection would
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewIncomingContext(context.Background(), md)
+		_, err := server(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &apiv1.CommonResponse{ErrorCode: 404}, nil
+		})
+		return err
+	}
+	handler := tracer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := client(r.Context(), method, req, &apiv1.CommonResponse{}, nil, invoker); err != nil {
+			t.Errorf("client interceptor unexpected error: %v", err)
+		}
+	}))
+
+	httpReq := httptest.NewRequest(http.MethodGet, "/v1/users/42", nil)
+	httpReq.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), httpReq)
+
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("ended %d spans, want server, client and HTTP", len(spans))
+	}
+	grpcServer, grpcClient, httpServer := spans[0], spans[1], spans[2]
+	for _, span := range spans {
+		if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("span %q trace ID = %s, want the caller's", span.Name(), got)
+		}
+	}
+	if got := httpServer.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("HTTP span parent = %s, want the caller's span", got)
+	}
+	if grpcClient.Parent().SpanID() != httpServer.SpanContext().SpanID() {
+		t.Error("client span is not a child of the HTTP span")
+	}
+	if grpcServer.Parent().SpanID() != grpcClient.SpanContext().SpanID() {
+		t.Error("server span is not a child of the client span")
+	}
+
+	if grpcServer.Name() != "api.v1.UserService/GetUser" {
+		t.Errorf("server span name = %q", grpcServer.Name())
+	}
+	for key, want := range map[attribute.Key]attribute.Value{
+		"rpc.service":          attribute.StringValue("api.v1.UserService"),
+		"rpc.method":           attribute.StringValue("GetUser"),
+		"rpc.grpc.status_code": attribute.IntValue(0),
+		AttrResourceName:       attribute.StringValue("users/42"),
+		AttrErrorCode:          attribute.IntValue(404),
+	} {
+		if got, _ := attr(grpcServer, key); got != want {
+			t.Errorf("server span %s = %v, want %v", key, got.Emit(), want.Emit())
+		}
+	}
+	if got, _ := attr(httpServer, "http.response.status_code"); got.AsInt64() != http.StatusOK {
+		t.Errorf("HTTP span status code = %v, want 200", got.Emit())
+	}
+}
+
+func TestUnaryServerInterceptorError(t *testing.T) {
+	tracer, rec := newTestTracer()
+	tracer.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/api.v1.TaskService/GetTask"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, status.Error(codes.Unavailable, "draining")
+		})
+
+	span := rec.Ended()[0]
+	if span.Status().Code != otelcodes.Error || span.Status().Description != "draining" {
+		t.Errorf("span status = %+v, want the error", span.Status())
+	}
+	if got, _ := attr(span, "rpc.grpc.status_code"); got.AsInt64() != int64(codes.Unavailable) {
+		t.Errorf("span status code = %v, want Unavailable", got.Emit())
+	}
+	if _, ok := attr(span, AttrResourceName); ok {
+		t.Error("span without a request has a resource name")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	if _, _, err := Setup(context.Background(), config.TracingConfig{Protocol: "zipkin"}); err == nil {
+		t.Error("Setup() with an unknown protocol expected error")
+	}
+
+	tracer, shutdown, err := Setup(context.Background(), config.TracingConfig{Protocol: "http", Endpoint: "localhost:4318", Insecure: true})
+	if err != nil {
+		t.Fatalf("Setup() unexpected error: %v", err)
+	}
+	if tracer == nil {
+		t.Fatal("Setup() returned no tracer")
+	}
+	// Nothing was traced, so shutting down exports nothing
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown unexpected error: %v", err)
+	}
+}
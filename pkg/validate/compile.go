@@ -0,0 +1,543 @@
+package validate
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	validatepb "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// messagePlan is what to check in a message
+type messagePlan struct {
+	fields []*fieldPlan
+	cel    []*celRule
+}
+
+// fieldPlan is what to check in a field: its own rules, and the messages
+// it holds when those have rules
+type fieldPlan struct {
+	fd         protoreflect.FieldDescriptor
+	required   bool
+	ignoreZero bool
+	checks     checks
+	cel        []*celRule
+
+	// items checks each item of a repeated field
+	items checks
+}
+
+// check is one standard rule. fail returns the violation message, or ""
+// when v passes.
+type check struct {
+	rule string
+	fail func(v protoreflect.Value) string
+}
+
+type checks []check
+
+func (cs checks) apply(v protoreflect.Value, path string, violations *[]Violation) {
+	for _, c := range cs {
+		if msg := c.fail(v); msg != "" {
+			*violations = append(*violations, Violation{Field: path, Rule: c.rule, Message: msg})
+		}
+	}
+}
+
+// compiler builds the plans of messages
+type compiler struct {
+	plans map[protoreflect.FullName]*messagePlan
+
+	// done holds messages compiled or being compiled, for recursive types
+	done map[protoreflect.FullName]bool
+}
+
+func (c *compiler) file(fd protoreflect.FileDescriptor) error {
+	return c.messages(fd.Messages())
+}
+
+func (c *compiler) messages(mds protoreflect.MessageDescriptors) error {
+	for i := 0; i < mds.Len(); i++ {
+		if _, err := c.message(mds.Get(i)); err != nil {
+			return err
+		}
+		if err := c.messages(mds.Get(i).Messages()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// message compiles md's plan, reporting whether it checks anything. A
+// message being compiled further up a recursive type counts as checking
+// nothing for now.
+func (c *compiler) message(md protoreflect.MessageDescriptor) (bool, error) {
+	if c.done[md.FullName()] {
+		return c.plans[md.FullName()] != nil, nil
+	}
+	c.done[md.FullName()] = true
+
+	plan := &messagePlan{}
+	if proto.HasExtension(md.Options(), validatepb.E_Message) {
+		rules := proto.GetExtension(md.Options(), validatepb.E_Message).(*validatepb.MessageRules)
+		if err := supported(rules, "cel"); err != nil {
+			return false, fmt.Errorf("validate: %s: %w", md.FullName(), err)
+		}
+		for _, r := range rules.GetCel() {
+			compiled, err := compileCEL(r, md, nil)
+			if err != nil {
+				return false, fmt.Errorf("validate: %s: %w", md.FullName(), err)
+			}
+			plan.cel = append(plan.cel, compiled)
+		}
+	}
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		f, err := c.field(fields.Get(i))
+		if err != nil {
+			return false, fmt.Errorf("validate: %s: %w", fields.Get(i).FullName(), err)
+		}
+		if f != nil {
+			plan.fields = append(plan.fields, f)
+		}
+	}
+	if len(plan.fields) == 0 && len(plan.cel) == 0 {
+		return false, nil
+	}
+	c.plans[md.FullName()] = plan
+	return true, nil
+}
+
+// field compiles fd's rules, nil when neither it nor the messages it holds
+// have any
+func (c *compiler) field(fd protoreflect.FieldDescriptor) (*fieldPlan, error) {
+	nested := false
+	if msg := messageOf(fd); msg != nil {
+		var err error
+		if nested, err = c.message(msg); err != nil {
+			return nil, err
+		}
+	}
+	rules := rulesOf(fd)
+	if rules == nil {
+		if nested {
+			return &fieldPlan{fd: fd}, nil
+		}
+		return nil, nil
+	}
+	if err := supported(rules, "cel", "required", "ignore", "string", "int32", "int64", "uint32", "uint64", "repeated"); err != nil {
+		return nil, err
+	}
+
+	f := &fieldPlan{fd: fd, required: rules.GetRequired()}
+	switch rules.GetIgnore() {
+	case validatepb.Ignore_IGNORE_UNSPECIFIED:
+	case validatepb.Ignore_IGNORE_IF_ZERO_VALUE:
+		f.ignoreZero = true
+	case validatepb.Ignore_IGNORE_ALWAYS:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("ignore %v is not supported", rules.GetIgnore())
+	}
+	for _, r := range rules.GetCel() {
+		if fd.IsList() || fd.IsMap() {
+			return nil, fmt.Errorf("cel rules on repeated fields are not supported")
+		}
+		compiled, err := compileCEL(r, fd.ContainingMessage(), fd)
+		if err != nil {
+			return nil, err
+		}
+		f.cel = append(f.cel, compiled)
+	}
+
+	if fd.IsList() {
+		if rules.HasRepeated() {
+			list, items, err := repeatedChecks(rules.GetRepeated(), fd)
+			if err != nil {
+				return nil, err
+			}
+			f.checks, f.items = list, items
+		} else if rules.HasType() {
+			return nil, fmt.Errorf("rules for %v on a repeated field, want repeated.items", fd.Kind())
+		}
+		return f, nil
+	}
+	checks, err := valueChecks(rules, fd)
+	if err != nil {
+		return nil, err
+	}
+	f.checks = checks
+	return f, nil
+}
+
+// messageOf returns the message a field holds, as a value, item or map
+// value, nil for scalars
+func messageOf(fd protoreflect.FieldDescriptor) protoreflect.MessageDescriptor {
+	if fd.IsMap() {
+		return fd.MapValue().Message()
+	}
+	return fd.Message()
+}
+
+// valueChecks compiles the rules of a single value of fd
+func valueChecks(rules *validatepb.FieldRules, fd protoreflect.FieldDescriptor) (checks, error) {
+	switch {
+	case rules.HasString():
+		if fd.Kind() != protoreflect.StringKind {
+			return nil, fmt.Errorf("string rules on a %v field", fd.Kind())
+		}
+		return stringChecks(rules.GetString())
+	case rules.HasInt32(), rules.HasInt64(), rules.HasUint32(), rules.HasUint64():
+		return intChecks(rules, fd)
+	case rules.HasRepeated():
+		return nil, fmt.Errorf("repeated rules on a singular field")
+	}
+	return nil, nil
+}
+
+// Formats of the well-known string rules, as protovalidate checks them
+var (
+	// emailPattern is the HTML5 definition of a valid email address
+	emailPattern = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+	uuidPattern  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+func stringChecks(r *validatepb.StringRules) (checks, error) {
+	if err := supported(r, "len", "min_len", "max_len", "pattern", "prefix", "suffix", "contains", "in", "not_in", "email", "uuid"); err != nil {
+		return nil, err
+	}
+	var cs checks
+	str := func(rule string, fail func(s string) string) {
+		cs = append(cs, check{rule: "string." + rule, fail: func(v protoreflect.Value) string { return fail(v.String()) }})
+	}
+	if r.HasLen() {
+		n := r.GetLen()
+		str("len", func(s string) string {
+			if uint64(utf8.RuneCountInString(s)) != n {
+				return fmt.Sprintf("value length must be %d characters", n)
+			}
+			return ""
+		})
+	}
+	if r.HasMinLen() {
+		n := r.GetMinLen()
+		str("min_len", func(s string) string {
+			if uint64(utf8.RuneCountInString(s)) < n {
+				return fmt.Sprintf("value length must be at least %d characters", n)
+			}
+			return ""
+		})
+	}
+	if r.HasMaxLen() {
+		n := r.GetMaxLen()
+		str("max_len", func(s string) string {
+			if uint64(utf8.RuneCountInString(s)) > n {
+				return fmt.Sprintf("value length must be at most %d characters", n)
+			}
+			return ""
+		})
+	}
+	if r.HasPattern() {
+		re, err := regexp.Compile(r.GetPattern())
+		if err != nil {
+			return nil, fmt.Errorf("string.pattern: %w", err)
+		}
+		str("pattern", func(s string) string {
+			if !re.MatchString(s) {
+				return fmt.Sprintf("value does not match regex pattern `%s`", re)
+			}
+			return ""
+		})
+	}
+	if r.HasPrefix() {
+		p := r.GetPrefix()
+		str("prefix", func(s string) string {
+			if !strings.HasPrefix(s, p) {
+				return fmt.Sprintf("value does not have prefix `%s`", p)
+			}
+			return ""
+		})
+	}
+	if r.HasSuffix() {
+		p := r.GetSuffix()
+		str("suffix", func(s string) string {
+			if !strings.HasSuffix(s, p) {
+				return fmt.Sprintf("value does not have suffix `%s`", p)
+			}
+			return ""
+		})
+	}
+	if r.HasContains() {
+		p := r.GetContains()
+		str("contains", func(s string) string {
+			if !strings.Contains(s, p) {
+				return fmt.Sprintf("value does not contain substring `%s`", p)
+			}
+			return ""
+		})
+	}
+	if in := r.GetIn(); len(in) > 0 {
+		str("in", func(s string) string {
+			for _, want := range in {
+				if s == want {
+					return ""
+				}
+			}
+			return fmt.Sprintf("value must be in list %v", in)
+		})
+	}
+	if notIn := r.GetNotIn(); len(notIn) > 0 {
+		str("not_in", func(s string) string {
+			for _, bad := range notIn {
+				if s == bad {
+					return fmt.Sprintf("value must not be in list %v", notIn)
+				}
+			}
+			return ""
+		})
+	}
+	if r.GetEmail() {
+		str("email", func(s string) string {
+			if !emailPattern.MatchString(s) {
+				return "value must be a valid email address"
+			}
+			return ""
+		})
+	}
+	if r.GetUuid() {
+		str("uuid", func(s string) string {
+			if !uuidPattern.MatchString(s) {
+				return "value must be a valid UUID"
+			}
+			return ""
+		})
+	}
+	return cs, nil
+}
+
+// intChecks compiles integer bounds. The bounds of every integer type
+// share their names, so they are read by reflection.
+func intChecks(rules *validatepb.FieldRules, fd protoreflect.FieldDescriptor) (checks, error) {
+	var r proto.Message
+	var kind protoreflect.Kind
+	var typ string
+	switch {
+	case rules.HasInt32():
+		r, typ, kind = rules.GetInt32(), "int32", protoreflect.Int32Kind
+	case rules.HasInt64():
+		r, typ, kind = rules.GetInt64(), "int64", protoreflect.Int64Kind
+	case rules.HasUint32():
+		r, typ, kind = rules.GetUint32(), "uint32", protoreflect.Uint32Kind
+	default:
+		r, typ, kind = rules.GetUint64(), "uint64", protoreflect.Uint64Kind
+	}
+	if fd.Kind() != kind {
+		return nil, fmt.Errorf("%s rules on a %v field", typ, fd.Kind())
+	}
+	if err := supported(r, "gt", "gte", "lt", "lte"); err != nil {
+		return nil, err
+	}
+
+	// Compare as float64 after converting both sides the same way: exact
+	// for the 32-bit types, and for 64-bit bounds below 2^53
+	asFloat := func(v protoreflect.Value) float64 {
+		switch x := v.Interface().(type) {
+		case int32:
+			return float64(x)
+		case int64:
+			return float64(x)
+		case uint32:
+			return float64(x)
+		case uint64:
+			return float64(x)
+		}
+		return math.NaN()
+	}
+	var cs checks
+	bounds := []struct {
+		name, phrase string
+		ok           func(v, bound float64) bool
+	}{
+		{"gt", "greater than", func(v, b float64) bool { return v > b }},
+		{"gte", "greater than or equal to", func(v, b float64) bool { return v >= b }},
+		{"lt", "less than", func(v, b float64) bool { return v < b }},
+		{"lte", "less than or equal to", func(v, b float64) bool { return v <= b }},
+	}
+	rm := r.ProtoReflect()
+	for _, b := range bounds {
+		bfd := rm.Descriptor().Fields().ByName(protoreflect.Name(b.name))
+		if bfd == nil || !rm.Has(bfd) {
+			continue
+		}
+		bound, shown, ok := asFloat(rm.Get(bfd)), rm.Get(bfd).Interface(), b.ok
+		msg := fmt.Sprintf("value must be %s %v", b.phrase, shown)
+		cs = append(cs, check{rule: typ + "." + b.name, fail: func(v protoreflect.Value) string {
+			if !ok(asFloat(v), bound) {
+				return msg
+			}
+			return ""
+		}})
+	}
+	return cs, nil
+}
+
+// repeatedChecks compiles the rules of a repeated field: counts on the
+// list, and the rules of each item
+func repeatedChecks(r *validatepb.RepeatedRules, fd protoreflect.FieldDescriptor) (checks, checks, error) {
+	if err := supported(r, "min_items", "max_items", "unique", "items"); err != nil {
+		return nil, nil, err
+	}
+	var cs checks
+	if r.HasMinItems() {
+		n := r.GetMinItems()
+		cs = append(cs, check{rule: "repeated.min_items", fail: func(v protoreflect.Value) string {
+			if uint64(v.List().Len()) < n {
+				return fmt.Sprintf("value must contain at least %d item(s)", n)
+			}
+			return ""
+		}})
+	}
+	if r.HasMaxItems() {
+		n := r.GetMaxItems()
+		cs = append(cs, check{rule: "repeated.max_items", fail: func(v protoreflect.Value) string {
+			if uint64(v.List().Len()) > n {
+				return fmt.Sprintf("value must contain no more than %d item(s)", n)
+			}
+			return ""
+		}})
+	}
+	if r.GetUnique() {
+		if fd.Kind() == protoreflect.MessageKind {
+			return nil, nil, fmt.Errorf("repeated.unique on a message field")
+		}
+		cs = append(cs, check{rule: "repeated.unique", fail: func(v protoreflect.Value) string {
+			list := v.List()
+			seen := make(map[interface{}]bool, list.Len())
+			for i := 0; i < list.Len(); i++ {
+				key := list.Get(i).Interface()
+				if b, ok := key.([]byte); ok {
+					key = string(b)
+				}
+				if seen[key] {
+					return "repeated value must contain unique items"
+				}
+				seen[key] = true
+			}
+			return ""
+		}})
+	}
+	if !r.HasItems() {
+		return cs, nil, nil
+	}
+	items := r.GetItems()
+	if err := supported(items, "string", "int32", "int64", "uint32", "uint64"); err != nil {
+		return nil, nil, fmt.Errorf("repeated.items: %w", err)
+	}
+	itemChecks, err := valueChecks(items, fd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("repeated.items: %w", err)
+	}
+	return cs, itemChecks, nil
+}
+
+// supported returns an error naming the first rule set in rules that is
+// not among names
+func supported(rules proto.Message, names ...string) error {
+	var err error
+	rules.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		for _, name := range names {
+			if string(fd.Name()) == name {
+				return true
+			}
+		}
+		err = fmt.Errorf("rule %s.%s is not supported", rules.ProtoReflect().Descriptor().Name(), fd.Name())
+		return false
+	})
+	return err
+}
+
+// celRule is a compiled CEL rule
+type celRule struct {
+	id      string
+	message string
+	expr    string
+	prg     cel.Program
+}
+
+// compileCEL compiles r with this bound to a message of type md, or to the
+// value of field fd of md when fd is set
+func compileCEL(r *validatepb.Rule, md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) (*celRule, error) {
+	typ := cel.ObjectType(string(md.FullName()))
+	if fd != nil {
+		var err error
+		if typ, err = celType(fd); err != nil {
+			return nil, fmt.Errorf("cel %s: %w", r.GetId(), err)
+		}
+	}
+	env, err := cel.NewEnv(cel.TypeDescs(md.ParentFile()), cel.Variable("this", typ))
+	if err != nil {
+		return nil, fmt.Errorf("cel %s: %w", r.GetId(), err)
+	}
+	ast, iss := env.Compile(r.GetExpression())
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("cel %s: %w", r.GetId(), iss.Err())
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) && !ast.OutputType().IsExactType(cel.StringType) {
+		return nil, fmt.Errorf("cel %s: expression returns %v, want bool or string", r.GetId(), ast.OutputType())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("cel %s: %w", r.GetId(), err)
+	}
+	return &celRule{id: r.GetId(), message: r.GetMessage(), expr: r.GetExpression(), prg: prg}, nil
+}
+
+func celType(fd protoreflect.FieldDescriptor) (*cel.Type, error) {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return cel.ObjectType(string(fd.Message().FullName())), nil
+	case protoreflect.StringKind:
+		return cel.StringType, nil
+	case protoreflect.BytesKind:
+		return cel.BytesType, nil
+	case protoreflect.BoolKind:
+		return cel.BoolType, nil
+	case protoreflect.DoubleKind, protoreflect.FloatKind:
+		return cel.DoubleType, nil
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind, protoreflect.EnumKind:
+		return cel.IntType, nil
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return cel.UintType, nil
+	}
+	return nil, fmt.Errorf("fields of kind %v are not supported", fd.Kind())
+}
+
+// eval runs the rule on this, returning the violation message or "" when
+// it passes. Bool expressions fail with the rule's message, string ones
+// with the string they return unless empty.
+func (r *celRule) eval(this interface{}) string {
+	out, _, err := r.prg.Eval(map[string]interface{}{"this": this})
+	if err != nil {
+		return fmt.Sprintf("rule %s failed: %v", r.id, err)
+	}
+	switch v := out.Value().(type) {
+	case bool:
+		if v {
+			return ""
+		}
+		if r.message != "" {
+			return r.message
+		}
+		return fmt.Sprintf("%q returned false", r.expr)
+	case string:
+		return v
+	}
+	return fmt.Sprintf("rule %s returned %v", r.id, out.Value())
+}
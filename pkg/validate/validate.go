@@ -0,0 +1,281 @@
+// Package validate checks requests against the buf.validate rules
+// annotated on their messages in the proto files, the rules protovalidate
+// defines, and rejects invalid ones with every field violation before
+// handlers run. Methods returning CommonResponse answer with an
+// INVALID_ARGUMENT error code like their handlers do, listing the
+// violations under data.violations; others fail with INVALID_ARGUMENT and a
+// BadRequest detail.
+//
+// It evaluates the standard rules the API uses: required, ignore, string
+// lengths, patterns and formats, integer bounds, repeated item counts and
+// item rules, and CEL expressions on fields and messages. New fails on any
+// other rule rather than skip it, so an annotation never silently goes
+// unchecked.
+package validate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	validatepb "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Violation is a field breaking one of its rules
+type Violation struct {
+	// Field is the path to the field, e.g. user.email or names[2]. Empty
+	// for rules on the request as a whole.
+	Field string
+
+	// Rule identifies the rule, e.g. string.email or the id of a CEL rule
+	Rule string
+
+	Message string
+}
+
+// Error lists the violations of an invalid message
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		if v.Field == "" {
+			parts = append(parts, v.Message)
+		} else {
+			parts = append(parts, v.Field+": "+v.Message)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Response converts e to an INVALID_ARGUMENT CommonResponse listing the
+// field violations in data.violations
+func (e *Error) Response() *apiv1.CommonResponse {
+	violations := make([]interface{}, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		violations = append(violations, map[string]interface{}{"field": v.Field, "rule": v.Rule, "message": v.Message})
+	}
+	resp := response.InvalidArgument(e.Error())
+	resp.Data, _ = structpb.NewStruct(map[string]interface{}{"violations": violations})
+	return resp
+}
+
+// Status converts e to an INVALID_ARGUMENT status with a BadRequest detail
+// listing the field violations
+func (e *Error) Status() *status.Status {
+	st := status.New(codes.InvalidArgument, e.Error())
+	br := &errdetails.BadRequest{}
+	for _, v := range e.Violations {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Message,
+			Reason:      v.Rule,
+		})
+	}
+	if withDetails, err := st.WithDetails(br); err == nil {
+		st = withDetails
+	}
+	return st
+}
+
+// Validator checks messages against their rules
+type Validator struct {
+	// plans by message full name; messages without rules have none
+	plans map[protoreflect.FullName]*messagePlan
+}
+
+// New compiles the rules of every message in the linked proto files
+func New() (*Validator, error) {
+	c := &compiler{
+		plans: make(map[protoreflect.FullName]*messagePlan),
+		done:  make(map[protoreflect.FullName]bool),
+	}
+	var err error
+	protoregistry.GlobalFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		err = c.file(fd)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{plans: c.plans}, nil
+}
+
+var defaultValidator = sync.OnceValues(New)
+
+// Default returns the Validator of the linked proto files, compiled once.
+// The rules are compiled into the binary, so like regexp.MustCompile it
+// panics on rules it cannot check.
+func Default() *Validator {
+	v, err := defaultValidator()
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Validate returns an *Error listing the violations of msg, or nil when it
+// is valid
+func (v *Validator) Validate(msg proto.Message) error {
+	if msg == nil {
+		return nil
+	}
+	var violations []Violation
+	v.message(msg.ProtoReflect(), "", &violations)
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+// UnaryServerInterceptor rejects invalid requests with INVALID_ARGUMENT
+// before the handler runs
+func (v *Validator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+		if err := v.Validate(msg); err != nil {
+			if returnsCommonResponse(info.FullMethod) {
+				return err.(*Error).Response(), nil
+			}
+			return nil, err.(*Error).Status().Err()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects invalid messages received on streams
+func (v *Validator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ServerStream: ss, v: v})
+	}
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+	v *Validator
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if msg, ok := m.(proto.Message); ok {
+		if err := s.v.Validate(msg); err != nil {
+			return err.(*Error).Status().Err()
+		}
+	}
+	return nil
+}
+
+// returnsCommonResponse reports whether fullMethod, e.g.
+// /api.v1.UserService/GetUser, returns a CommonResponse
+func returnsCommonResponse(fullMethod string) bool {
+	name := protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", "."))
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return false
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	return ok && md.Output().FullName() == commonResponse
+}
+
+var commonResponse = (&apiv1.CommonResponse{}).ProtoReflect().Descriptor().FullName()
+
+// message appends the violations of m, whose fields are under path
+func (v *Validator) message(m protoreflect.Message, path string, violations *[]Violation) {
+	plan := v.plans[m.Descriptor().FullName()]
+	if plan == nil {
+		return
+	}
+	for _, f := range plan.fields {
+		v.field(m, f, path, violations)
+	}
+	for _, r := range plan.cel {
+		if msg := r.eval(m.Interface()); msg != "" {
+			*violations = append(*violations, Violation{Field: path, Rule: r.id, Message: msg})
+		}
+	}
+}
+
+func (v *Validator) field(m protoreflect.Message, f *fieldPlan, path string, violations *[]Violation) {
+	fd := f.fd
+	path = join(path, string(fd.Name()))
+	populated := m.Has(fd)
+	if f.required && !populated {
+		*violations = append(*violations, Violation{Field: path, Rule: "required", Message: "value is required"})
+		return
+	}
+	if !populated && (f.ignoreZero || fd.HasPresence()) {
+		return
+	}
+	val := m.Get(fd)
+
+	switch {
+	case fd.IsList():
+		list := val.List()
+		f.checks.apply(protoreflect.ValueOfList(list), path, violations)
+		for i := 0; i < list.Len(); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			if f.items != nil {
+				f.items.apply(list.Get(i), itemPath, violations)
+			}
+			if fd.Kind() == protoreflect.MessageKind {
+				v.message(list.Get(i).Message(), itemPath, violations)
+			}
+		}
+	case fd.IsMap():
+		if fd.MapValue().Kind() == protoreflect.MessageKind {
+			val.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				v.message(mv.Message(), fmt.Sprintf("%s[%q]", path, k.String()), violations)
+				return true
+			})
+		}
+	default:
+		f.checks.apply(val, path, violations)
+		if fd.Kind() == protoreflect.MessageKind && populated {
+			for _, r := range f.cel {
+				if msg := r.eval(val.Message().Interface()); msg != "" {
+					*violations = append(*violations, Violation{Field: path, Rule: r.id, Message: msg})
+				}
+			}
+			v.message(val.Message(), path, violations)
+			return
+		}
+		for _, r := range f.cel {
+			if msg := r.eval(val.Interface()); msg != "" {
+				*violations = append(*violations, Violation{Field: path, Rule: r.id, Message: msg})
+			}
+		}
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// rulesOf returns the buf.validate rules of a field, nil when it has none
+func rulesOf(fd protoreflect.FieldDescriptor) *validatepb.FieldRules {
+	if !proto.HasExtension(fd.Options(), validatepb.E_Field) {
+		return nil
+	}
+	return proto.GetExtension(fd.Options(), validatepb.E_Field).(*validatepb.FieldRules)
+}
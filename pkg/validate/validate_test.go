@@ -0,0 +1,160 @@
+package validate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	validatepb "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestUserRequests(t *testing.T) {
+	names := make([]string, 1001)
+	for i := range names {
+		names[i] = "users/1"
+	}
+	tests := []struct {
+		name string
+		req  proto.Message
+		want []string // field and rule of each violation
+	}{
+		{name: "valid create", req: &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada@example.com", DisplayName: "Ada"}}},
+		{name: "nil user", req: &apiv1.CreateUserRequest{}, want: []string{"user required"}},
+		{name: "missing email", req: &apiv1.CreateUserRequest{User: &apiv1.User{DisplayName: "Ada"}}, want: []string{"user user.email_required"}},
+		{
+			name: "invalid fields",
+			req:  &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada", DisplayName: strings.Repeat("a", 101)}},
+			want: []string{"user.email string.email", "user.display_name string.max_len"},
+		},
+		{name: "multibyte within max_len", req: &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada@example.com", DisplayName: strings.Repeat("é", 100)}}},
+		{name: "empty name", req: &apiv1.GetUserRequest{}, want: []string{"name required"}},
+		{name: "long name", req: &apiv1.DeleteUserRequest{Name: strings.Repeat("a", 257)}, want: []string{"name string.max_len"}},
+		// Partial updates leave the email out
+		{name: "update without email", req: &apiv1.UpdateUserRequest{User: &apiv1.User{Name: "users/1", IsActive: true}}},
+		{name: "update without name", req: &apiv1.UpdateUserRequest{User: &apiv1.User{Email: "ada@example.com"}}, want: []string{"user user.name_required"}},
+		{name: "no names", req: &apiv1.BatchGetUsersRequest{}, want: []string{"names repeated.min_items"}},
+		{name: "empty item", req: &apiv1.BatchGetUsersRequest{Names: []string{"users/1", ""}}, want: []string{"names[1] string.min_len"}},
+		{name: "too many names", req: &apiv1.BatchGetUsersRequest{Names: names}, want: []string{"names repeated.max_items"}},
+		{name: "unknown event type", req: &apiv1.WatchUsersRequest{Types: []string{"user.created", "user.renamed"}}, want: []string{"types[1] string.in"}},
+		{name: "no rules", req: &apiv1.ListUsersRequest{PageSize: -1}},
+	}
+
+	v := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(tt.req)
+			var got []string
+			if err != nil {
+				for _, violation := range err.(*Error).Violations {
+					got = append(got, violation.Field+" "+violation.Rule)
+				}
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("Validate() violations = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	intercept := Default().UnaryServerInterceptor()
+	called := false
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		called = true
+		return response.SuccessEmpty(), nil
+	}
+	req := &apiv1.CreateUserRequest{User: &apiv1.User{Email: "ada"}}
+
+	resp, err := intercept(context.Background(), req, &grpc.UnaryServerInfo{FullMethod: "/api.v1.UserService/CreateUser"}, handler)
+	if err != nil {
+		t.Fatalf("interceptor unexpected error: %v", err)
+	}
+	common := resp.(*apiv1.CommonResponse)
+	if called || common.GetErrorCode() != response.CodeInvalidArgument || common.GetErrorMsg() != "user.email: value must be a valid email address" {
+		t.Errorf("interceptor = %d %q, handler called %v, want INVALID_ARGUMENT without calling the handler", common.GetErrorCode(), common.GetErrorMsg(), called)
+	}
+	violations := common.GetData().GetFields()["violations"].GetListValue().GetValues()
+	if len(violations) != 1 || violations[0].GetStructValue().GetFields()["field"].GetStringValue() != "user.email" {
+		t.Errorf("data.violations = %v, want user.email", violations)
+	}
+
+	// Methods without the CommonResponse envelope fail with a status
+	_, err = intercept(context.Background(), req, &grpc.UnaryServerInfo{FullMethod: "/api.v1.Other/Method"}, handler)
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument || len(st.Details()) != 1 {
+		t.Fatalf("interceptor error = %v, want INVALID_ARGUMENT with details", err)
+	}
+	if br, ok := st.Details()[0].(*errdetails.BadRequest); !ok || br.GetFieldViolations()[0].GetField() != "user.email" {
+		t.Errorf("details = %v, want a BadRequest for user.email", st.Details())
+	}
+
+	if _, err := intercept(context.Background(), &apiv1.GetUserRequest{Name: "users/1"}, &grpc.UnaryServerInfo{FullMethod: "/api.v1.UserService/GetUser"}, handler); err != nil || !called {
+		t.Errorf("interceptor with a valid request = %v, handler called %v, want passed on", err, called)
+	}
+}
+
+// compileField compiles a message with one string field carrying rules
+func compileField(t *testing.T, rules *validatepb.FieldRules) error {
+	t.Helper()
+	opts := &descriptorpb.FieldOptions{}
+	proto.SetExtension(opts, validatepb.E_Field, rules)
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test/rules.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"buf/validate/validate.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Request"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("value"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				JsonName: proto.String("value"),
+				Options:  opts,
+			}},
+		}},
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &compiler{plans: make(map[protoreflect.FullName]*messagePlan), done: make(map[protoreflect.FullName]bool)}
+	return c.file(fd)
+}
+
+func TestInvalidRules(t *testing.T) {
+	for name, rules := range map[string]*validatepb.FieldRules{
+		"unsupported rule": validatepb.FieldRules_builder{String: validatepb.StringRules_builder{Hostname: proto.Bool(true)}.Build()}.Build(),
+		"wrong type":       validatepb.FieldRules_builder{Int32: validatepb.Int32Rules_builder{Gte: proto.Int32(1)}.Build()}.Build(),
+		"bad pattern":      validatepb.FieldRules_builder{String: validatepb.StringRules_builder{Pattern: proto.String("(")}.Build()}.Build(),
+		"bad expression": validatepb.FieldRules_builder{Cel: []*validatepb.Rule{
+			validatepb.Rule_builder{Id: proto.String("bad"), Expression: proto.String("this +")}.Build(),
+		}}.Build(),
+		"non-bool expression": validatepb.FieldRules_builder{Cel: []*validatepb.Rule{
+			validatepb.Rule_builder{Id: proto.String("size"), Expression: proto.String("size(this)")}.Build(),
+		}}.Build(),
+	} {
+		if err := compileField(t, rules); err == nil {
+			t.Errorf("compiling %s expected error", name)
+		}
+	}
+
+	valid := validatepb.FieldRules_builder{Cel: []*validatepb.Rule{
+		validatepb.Rule_builder{Id: proto.String("no_x"), Expression: proto.String("this.startsWith('x') ? 'value must not start with x' : ''")}.Build(),
+	}}.Build()
+	if err := compileField(t, valid); err != nil {
+		t.Errorf("compiling a string CEL rule unexpected error: %v", err)
+	}
+}
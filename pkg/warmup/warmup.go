@@ -0,0 +1,61 @@
+// Package warmup runs the steps that take a fresh instance from cold to
+// serving at full speed, such as connecting to stores, filling caches and
+// exercising request paths, before it reports ready.
+package warmup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Step is one part of warmup
+type Step struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Options configures Run
+type Options struct {
+	// Timeout bounds the whole warmup (default 30s)
+	Timeout time.Duration
+
+	// RetryInterval is the wait before a failed step is retried
+	// (default 1s)
+	RetryInterval time.Duration
+}
+
+// Run runs steps in order, retrying a failed step until it succeeds or the
+// timeout expires. It returns the error of the step that did not finish.
+func Run(ctx context.Context, log logger.Logger, opts Options, steps ...Step) error {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	for _, step := range steps {
+		stepStart := time.Now()
+		for attempt := 1; ; attempt++ {
+			err := step.Run(ctx)
+			if err == nil {
+				log.Debug("Warmup step %s done in %v", step.Name, time.Since(stepStart).Round(time.Millisecond))
+				break
+			}
+			log.Warn("Warmup step %s failed (attempt %d): %v", step.Name, attempt, err)
+			select {
+			case <-time.After(opts.RetryInterval):
+			case <-ctx.Done():
+				return fmt.Errorf("warmup step %s: %w", step.Name, err)
+			}
+		}
+	}
+	log.Info("Warmup done in %v", time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,54 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+func TestRun(t *testing.T) {
+	var order []string
+	step := func(name string, failures int) Step {
+		return Step{Name: name, Run: func(ctx context.Context) error {
+			order = append(order, name)
+			if failures > 0 {
+				failures--
+				return errors.New("connection refused")
+			}
+			return nil
+		}}
+	}
+
+	err := Run(context.Background(), logger.Nop(), Options{RetryInterval: time.Millisecond},
+		step("stores", 2), step("cache", 0))
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	want := []string{"stores", "stores", "stores", "cache"}
+	if len(order) != len(want) {
+		t.Fatalf("Run() ran %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("Run() ran %v, want %v", order, want)
+			break
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	var cacheRan bool
+	err := Run(context.Background(), logger.Nop(), Options{Timeout: 20 * time.Millisecond, RetryInterval: time.Millisecond},
+		Step{Name: "stores", Run: func(ctx context.Context) error { return errors.New("connection refused") }},
+		Step{Name: "cache", Run: func(ctx context.Context) error { cacheRan = true; return nil }},
+	)
+	if err == nil || err.Error() != "warmup step stores: connection refused" {
+		t.Errorf("Run() error = %v, want the stores step's error", err)
+	}
+	if cacheRan {
+		t.Error("Run() continued past the step that timed out")
+	}
+}
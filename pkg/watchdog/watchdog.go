@@ -0,0 +1,229 @@
+// Package watchdog monitors the process itself: how late its timers fire,
+// how many goroutines it runs and whether its stores respond. Breaches are
+// logged as warnings and counted in Stats, and can optionally shut the
+// process down so the orchestrator replaces it.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Check reports whether a dependency, such as a store, is healthy
+type Check func(ctx context.Context) error
+
+// Options configures a Watchdog
+type Options struct {
+	// Interval is how often the process is checked (default 10s)
+	Interval time.Duration
+
+	// MaxSchedulingDelay is how late the check timer may fire before the
+	// process counts as unresponsive, e.g. starved of CPU or stalled in GC
+	// (default 1s)
+	MaxSchedulingDelay time.Duration
+
+	// MaxGoroutines is the goroutine count that counts as a breach
+	// (default 10000)
+	MaxGoroutines int
+
+	// GrowthChecks warns when the goroutine count has grown at this many
+	// checks in a row, a sign of a leak (default 6, 0 disables)
+	GrowthChecks int
+
+	// CheckTimeout bounds each Check (default 2s)
+	CheckTimeout time.Duration
+
+	// FailureThreshold is how many breached checks in a row call OnFatal
+	// (default 3)
+	FailureThreshold int
+
+	// OnFatal is called once FailureThreshold is reached, e.g. to start a
+	// graceful shutdown. Nil only logs.
+	OnFatal func(reason string)
+}
+
+// Stats is a snapshot of the watchdog's findings
+type Stats struct {
+	Checks   uint64
+	Breaches uint64
+
+	// Consecutive is the number of breached checks in a row
+	Consecutive int
+
+	// SchedulingDelay and Goroutines are from the last check
+	SchedulingDelay time.Duration
+	Goroutines      int
+
+	// LastBreach describes the most recent breach
+	LastBreach string
+}
+
+// Watchdog periodically checks the process
+type Watchdog struct {
+	log    logger.Logger
+	opts   Options
+	checks map[string]Check
+
+	mu     sync.Mutex
+	stats  Stats
+	growth int
+	fatal  bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a Watchdog running checks, keyed by the name used in logs
+func New(log logger.Logger, opts Options, checks map[string]Check) *Watchdog {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.MaxSchedulingDelay <= 0 {
+		opts.MaxSchedulingDelay = time.Second
+	}
+	if opts.MaxGoroutines <= 0 {
+		opts.MaxGoroutines = 10000
+	}
+	if opts.GrowthChecks < 0 {
+		opts.GrowthChecks = 0
+	}
+	if opts.CheckTimeout <= 0 {
+		opts.CheckTimeout = 2 * time.Second
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 3
+	}
+	return &Watchdog{log: log, opts: opts, checks: checks}
+}
+
+// Start runs the checks until Stop is called or ctx is done
+func (w *Watchdog) Start(ctx context.Context) {
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+	go w.run(ctx)
+}
+
+// Stop ends the checks, waiting for one in progress until ctx is done
+func (w *Watchdog) Stop(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of the findings
+func (w *Watchdog) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+// Healthy reports whether fewer than FailureThreshold checks in a row have
+// breached
+func (w *Watchdog) Healthy() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats.Consecutive < w.opts.FailureThreshold
+}
+
+func (w *Watchdog) run(ctx context.Context) {
+	defer close(w.done)
+	for {
+		scheduled := time.Now()
+		timer := time.NewTimer(w.opts.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case fired := <-timer.C:
+			w.check(ctx, max(fired.Sub(scheduled)-w.opts.Interval, 0))
+		}
+	}
+}
+
+// check runs one round and escalates on breaches. delay is how late the
+// round started.
+func (w *Watchdog) check(ctx context.Context, delay time.Duration) {
+	goroutines := runtime.NumGoroutine()
+
+	var breaches []string
+	if delay > w.opts.MaxSchedulingDelay {
+		breaches = append(breaches, fmt.Sprintf("timer fired %v late, more than %v", delay.Round(time.Millisecond), w.opts.MaxSchedulingDelay))
+	}
+	if goroutines > w.opts.MaxGoroutines {
+		breaches = append(breaches, fmt.Sprintf("%d goroutines, more than %d", goroutines, w.opts.MaxGoroutines))
+	}
+	for _, name := range w.checkNames() {
+		checkCtx, cancel := context.WithTimeout(ctx, w.opts.CheckTimeout)
+		err := w.checks[name](checkCtx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			breaches = append(breaches, fmt.Sprintf("%s unhealthy: %v", name, err))
+		}
+	}
+
+	w.mu.Lock()
+	prev := w.stats.Goroutines
+	w.stats.Checks++
+	w.stats.SchedulingDelay, w.stats.Goroutines = delay, goroutines
+	if w.stats.Checks > 1 && goroutines > prev {
+		w.growth++
+	} else {
+		w.growth = 0
+	}
+	growing := w.opts.GrowthChecks > 0 && w.growth >= w.opts.GrowthChecks
+	if growing {
+		w.growth = 0
+	}
+	if len(breaches) == 0 {
+		w.stats.Consecutive = 0
+		w.mu.Unlock()
+		if growing {
+			w.log.Warn("Watchdog: goroutines grew at %d checks in a row to %d, possible leak", w.opts.GrowthChecks, goroutines)
+		}
+		return
+	}
+	reason := strings.Join(breaches, "; ")
+	w.stats.Breaches++
+	w.stats.Consecutive++
+	w.stats.LastBreach = reason
+	consecutive := w.stats.Consecutive
+	fatal := consecutive >= w.opts.FailureThreshold && !w.fatal
+	if fatal {
+		w.fatal = true
+	}
+	w.mu.Unlock()
+
+	if growing {
+		w.log.Warn("Watchdog: goroutines grew at %d checks in a row to %d, possible leak", w.opts.GrowthChecks, goroutines)
+	}
+	w.log.Warn("Watchdog: %s (%d in a row)", reason, consecutive)
+	if fatal {
+		w.log.Error("Watchdog: unhealthy for %d checks in a row", consecutive)
+		if w.opts.OnFatal != nil {
+			w.opts.OnFatal(reason)
+		}
+	}
+}
+
+func (w *Watchdog) checkNames() []string {
+	names := make([]string, 0, len(w.checks))
+	for name := range w.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,103 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+func TestWatchdogEscalates(t *testing.T) {
+	var healthy atomic.Bool
+	fatal := make(chan string, 1)
+	w := New(logger.Nop(), Options{
+		FailureThreshold: 2,
+		OnFatal:          func(reason string) { fatal <- reason },
+	}, map[string]Check{
+		"store": func(ctx context.Context) error {
+			if healthy.Load() {
+				return nil
+			}
+			return errors.New("connection refused")
+		},
+	})
+	ctx := context.Background()
+
+	w.check(ctx, 0)
+	if stats := w.Stats(); stats.Breaches != 1 || stats.Consecutive != 1 || stats.LastBreach != "store unhealthy: connection refused" {
+		t.Errorf("Stats() after a failed check = %+v", stats)
+	}
+	select {
+	case <-fatal:
+		t.Fatal("OnFatal called before the threshold")
+	default:
+	}
+
+	if !w.Healthy() {
+		t.Error("Healthy() = false below the threshold")
+	}
+	w.check(ctx, 0)
+	if w.Healthy() {
+		t.Error("Healthy() = true at the threshold")
+	}
+	select {
+	case reason := <-fatal:
+		if reason != "store unhealthy: connection refused" {
+			t.Errorf("OnFatal() reason = %q", reason)
+		}
+	default:
+		t.Fatal("OnFatal not called at the threshold")
+	}
+
+	w.check(ctx, 0)
+	if len(fatal) != 0 {
+		t.Errorf("OnFatal called again, want once")
+	}
+
+	healthy.Store(true)
+	w.check(ctx, 0)
+	if stats := w.Stats(); stats.Consecutive != 0 || stats.Breaches != 3 {
+		t.Errorf("Stats() after recovery = %+v, want the run reset", stats)
+	}
+	if !w.Healthy() {
+		t.Error("Healthy() = false after recovery")
+	}
+}
+
+func TestWatchdogThresholds(t *testing.T) {
+	w := New(logger.Nop(), Options{MaxSchedulingDelay: 100 * time.Millisecond, MaxGoroutines: 1}, nil)
+
+	w.check(context.Background(), 200*time.Millisecond)
+	stats := w.Stats()
+	if stats.SchedulingDelay != 200*time.Millisecond || stats.Goroutines < 2 {
+		t.Errorf("Stats() = %+v, want the delay and goroutine count recorded", stats)
+	}
+	want := "timer fired 200ms late, more than 100ms; "
+	if len(stats.LastBreach) < len(want) || stats.LastBreach[:len(want)] != want {
+		t.Errorf("LastBreach = %q, want the delay and goroutine breaches", stats.LastBreach)
+	}
+}
+
+func TestWatchdogStartStop(t *testing.T) {
+	var checks atomic.Int32
+	w := New(logger.Nop(), Options{Interval: time.Millisecond}, map[string]Check{
+		"store": func(ctx context.Context) error {
+			checks.Add(1)
+			return nil
+		},
+	})
+	w.Start(context.Background())
+	deadline := time.Now().Add(time.Second)
+	for checks.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() unexpected error: %v", err)
+	}
+	if checks.Load() < 3 {
+		t.Errorf("ran %d checks, want periodic checks", checks.Load())
+	}
+}
@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+)
+
+// TaskDeliver is the job kind of a queued delivery
+const TaskDeliver = "webhook.deliver"
+
+// Delivery is the payload of a TaskDeliver job
+type Delivery struct {
+	URL   string          `json:"url"`
+	Event string          `json:"event"`
+	Body  json.RawMessage `json:"body"`
+}
+
+// Async delivers webhooks at least once. Deliveries are queued jobs retried
+// with the queue's capped exponential backoff; a delivery the receiver
+// rejects outright, or that runs out of attempts, is dead-lettered and can
+// be replayed with the queue's Retry.
+type Async struct {
+	queue  *queue.Queue
+	client *Client
+}
+
+// NewAsync creates an Async sender and registers its handler on q. Give
+// webhooks their own queue so dead-lettered deliveries can be listed apart
+// from other jobs. Call it before q.Start.
+func NewAsync(q *queue.Queue, c *Client) *Async {
+	a := &Async{queue: q, client: c}
+	q.Register(TaskDeliver, a.handle)
+	return a
+}
+
+// Send queues body for delivery to url
+func (a *Async) Send(ctx context.Context, url, event string, body interface{}) error {
+	_, err := a.Enqueue(ctx, url, event, body)
+	return err
+}
+
+// Enqueue queues body for delivery to url and returns the delivery job
+func (a *Async) Enqueue(ctx context.Context, rawURL, event string, body interface{}) (*queue.Job, error) {
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("webhook: url must be an absolute http(s) URL")
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return a.queue.Enqueue(ctx, TaskDeliver, Delivery{URL: rawURL, Event: event, Body: data})
+}
+
+func (a *Async) handle(ctx context.Context, job *queue.Job) error {
+	var d Delivery
+	if err := job.Decode(&d); err != nil {
+		return queue.Permanent(err)
+	}
+
+	err := a.client.send(ctx, d.URL, d.Event, job.ID, d.Body)
+	var status *StatusError
+	if errors.As(err, &status) && !status.Temporary() {
+		return queue.Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+// Package webhook POSTs JSON events to subscriber URLs, directly or with
+// at-least-once delivery through the job queue.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Headers set on every delivery. Deliveries may repeat, so receivers should
+// deduplicate on the delivery ID.
+const (
+	HeaderEvent    = "X-Webhook-Event"
+	HeaderDelivery = "X-Webhook-Delivery"
+)
+
+// Sender delivers a webhook
+type Sender interface {
+	Send(ctx context.Context, url, event string, body interface{}) error
+}
+
+// StatusError is returned for a non-2xx response
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook: POST %s: unexpected status %s", e.URL, e.Status)
+}
+
+// Temporary reports whether the receiver may accept the delivery later:
+// timeouts, rate limiting and server errors
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= 500
+}
+
+// Client sends webhooks synchronously
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a Client using c for requests
+func NewClient(c *http.Client) *Client {
+	return &Client{http: c}
+}
+
+// Send POSTs body as JSON to url
+func (c *Client) Send(ctx context.Context, url, event string, body interface{}) error {
+	return c.send(ctx, url, event, "", body)
+}
+
+func (c *Client) send(ctx context.Context, url, event, delivery string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event)
+	if delivery != "" {
+		req.Header.Set(HeaderDelivery, delivery)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/idgen"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+)
+
+func TestClientSend(t *testing.T) {
+	var gotEvent, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEvent = r.Header.Get(HeaderEvent)
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	}))
+	defer srv.Close()
+
+	err := NewClient(srv.Client()).Send(context.Background(), srv.URL, "user.created", map[string]string{"user": "users/1"})
+	if err != nil {
+		t.Fatalf("Send() unexpected error: %v", err)
+	}
+	if gotEvent != "user.created" || gotBody != `{"user":"users/1"}` {
+		t.Errorf("received event %q body %q, want user.created and JSON body", gotEvent, gotBody)
+	}
+}
+
+func TestStatusErrorTemporary(t *testing.T) {
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusNotFound, false},
+		{http.StatusGone, false},
+		{http.StatusRequestTimeout, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+	}
+	for _, tt := range tests {
+		err := &StatusError{StatusCode: tt.code}
+		if got := err.Temporary(); got != tt.want {
+			t.Errorf("StatusError{%d}.Temporary() = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func newTestAsync(t *testing.T, srv *httptest.Server) (*Async, queue.Store) {
+	t.Helper()
+	store := queue.NewMemoryStore()
+	q := queue.New(store, logger.Nop(), queue.Options{
+		Workers:      1,
+		PollInterval: time.Millisecond,
+		MaxAttempts:  3,
+		Backoff:      queue.Backoff{Initial: time.Millisecond, Max: 2 * time.Millisecond},
+		IDs:          idgen.NewSequential(),
+	})
+	a := NewAsync(q, NewClient(srv.Client()))
+	q.Start(context.Background())
+	t.Cleanup(func() { q.Stop(context.Background()) })
+	return a, store
+}
+
+func waitForState(t *testing.T, s queue.Store, id string, state queue.State) *queue.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := s.Get(context.Background(), id)
+		if err == nil && job.State == state {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery %s did not reach state %s, last = %+v", id, state, job)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAsyncRetriesTemporaryFailures(t *testing.T) {
+	var calls atomic.Int64
+	var delivery atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivery.Store(r.Header.Get(HeaderDelivery))
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	a, store := newTestAsync(t, srv)
+
+	job, err := a.Enqueue(context.Background(), srv.URL, "user.created", map[string]string{})
+	if err != nil {
+		t.Fatalf("Enqueue() unexpected error: %v", err)
+	}
+	done := waitForState(t, store, job.ID, queue.StateSucceeded)
+	if done.Attempts != 3 {
+		t.Errorf("Attempts = %d, want 3", done.Attempts)
+	}
+	if got := delivery.Load(); got != job.ID {
+		t.Errorf("%s = %v, want the job ID %s", HeaderDelivery, got, job.ID)
+	}
+}
+
+func TestAsyncDeadLettersAndReplays(t *testing.T) {
+	var accept atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !accept.Load() {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer srv.Close()
+	a, store := newTestAsync(t, srv)
+
+	job, _ := a.Enqueue(context.Background(), srv.URL, "user.deleted", nil)
+	dead := waitForState(t, store, job.ID, queue.StateDead)
+	if dead.Attempts != 1 {
+		t.Errorf("Attempts = %d, want 1 for a permanent rejection", dead.Attempts)
+	}
+
+	accept.Store(true)
+	if _, err := a.queue.Retry(context.Background(), job.ID); err != nil {
+		t.Fatalf("Retry() unexpected error: %v", err)
+	}
+	waitForState(t, store, job.ID, queue.StateSucceeded)
+}
+
+func TestAsyncRejectsInvalidURL(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	a, _ := newTestAsync(t, srv)
+
+	for _, url := range []string{"", "ftp://example.com", "/relative", "http://"} {
+		if err := a.Send(context.Background(), url, "user.created", nil); err == nil {
+			t.Errorf("Send(%q) error = nil, want error", url)
+		}
+	}
+	if _, err := a.Enqueue(context.Background(), srv.URL, "bad", func() {}); err == nil {
+		t.Error("Enqueue() with unmarshalable body error = nil, want error")
+	}
+}
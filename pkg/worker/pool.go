@@ -0,0 +1,277 @@
+// Package worker provides a bounded goroutine pool for background jobs.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+)
+
+// Errors returned by Submit
+var (
+	// ErrQueueFull is returned when the queue has no free slot
+	ErrQueueFull = errors.New("worker: queue full")
+
+	// ErrPoolClosed is returned once the pool has started stopping
+	ErrPoolClosed = errors.New("worker: pool closed")
+)
+
+// Job is a unit of background work
+type Job interface {
+	Run(ctx context.Context) error
+}
+
+// JobFunc adapts a function to the Job interface
+type JobFunc func(ctx context.Context) error
+
+// Run calls f(ctx)
+func (f JobFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// PanicError wraps a panic recovered from a job
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("worker: job panicked: %v", e.Value)
+}
+
+// Options configures a Pool
+type Options struct {
+	// Name identifies the pool in logs
+	Name string
+
+	// Workers is the number of goroutines processing jobs (default 4)
+	Workers int
+
+	// QueueSize is the number of jobs that can wait (default 100)
+	QueueSize int
+
+	// OnJobDone, if set, is called after every job with its processing time
+	// and result, e.g. to feed metrics
+	OnJobDone func(d time.Duration, err error)
+}
+
+// Stats is a snapshot of pool activity
+type Stats struct {
+	QueueDepth    int
+	InFlight      int64
+	Processed     uint64
+	Failed        uint64
+	Panicked      uint64
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+}
+
+// Pool runs jobs on a bounded number of goroutines
+type Pool struct {
+	opts  Options
+	log   logger.Logger
+	queue chan Job
+
+	// ctx is passed to jobs and cancelled when a drain runs out of time
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.RWMutex
+	started bool
+	closed  bool
+	wg      sync.WaitGroup
+
+	inFlight      atomic.Int64
+	processed     atomic.Uint64
+	failed        atomic.Uint64
+	panicked      atomic.Uint64
+	totalDuration atomic.Int64
+	maxDuration   atomic.Int64
+}
+
+// NewPool creates a Pool. Call Start to begin processing.
+func NewPool(opts Options, log logger.Logger) *Pool {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+	if opts.Name == "" {
+		opts.Name = "worker"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{
+		opts:   opts,
+		log:    log,
+		queue:  make(chan Job, opts.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start launches the worker goroutines. Jobs do not inherit ctx, so a
+// cancelled startup context does not abort the drain in Stop.
+func (p *Pool) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+	if p.started {
+		return nil
+	}
+	p.started = true
+
+	for i := 0; i < p.opts.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return nil
+}
+
+// Submit enqueues job without blocking
+func (p *Pool) Submit(job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case p.queue <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// SubmitWait enqueues job, waiting for a free slot until ctx is done
+func (p *Pool) SubmitWait(ctx context.Context, job Job) error {
+	for {
+		err := p.Submit(job)
+		if !errors.Is(err, ErrQueueFull) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// Stop stops accepting jobs and waits for queued and in-flight jobs to
+// finish. If ctx ends first, running jobs are cancelled, remaining queued
+// jobs are dropped and ctx's error is returned.
+func (p *Pool) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.queue)
+	started := p.started
+	p.mu.Unlock()
+
+	if !started {
+		p.cancel()
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		dropped := len(p.queue)
+		p.log.Warn("Worker pool %s drain deadline exceeded, cancelling in-flight jobs and dropping %d queued", p.opts.Name, dropped)
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of pool activity
+func (p *Pool) Stats() Stats {
+	return Stats{
+		QueueDepth:    len(p.queue),
+		InFlight:      p.inFlight.Load(),
+		Processed:     p.processed.Load(),
+		Failed:        p.failed.Load(),
+		Panicked:      p.panicked.Load(),
+		TotalDuration: time.Duration(p.totalDuration.Load()),
+		MaxDuration:   time.Duration(p.maxDuration.Load()),
+	}
+}
+
+// work processes jobs until the queue is closed and drained
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for job := range p.queue {
+		// Once the drain deadline passed, skip what is still queued
+		if p.ctx.Err() != nil {
+			continue
+		}
+		p.run(job)
+	}
+}
+
+// run executes one job with panic isolation and bookkeeping
+func (p *Pool) run(job Job) {
+	p.inFlight.Add(1)
+	start := time.Now()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				p.panicked.Add(1)
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		return job.Run(p.ctx)
+	}()
+
+	d := time.Since(start)
+	p.inFlight.Add(-1)
+	p.processed.Add(1)
+	p.totalDuration.Add(int64(d))
+	for {
+		cur := p.maxDuration.Load()
+		if int64(d) <= cur || p.maxDuration.CompareAndSwap(cur, int64(d)) {
+			break
+		}
+	}
+
+	if err != nil {
+		p.failed.Add(1)
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			p.log.Error("Worker pool %s: %v\n%s", p.opts.Name, panicErr, panicErr.Stack)
+		} else {
+			p.log.Warn("Worker pool %s: job failed: %v", p.opts.Name, err)
+		}
+	}
+
+	if p.opts.OnJobDone != nil {
+		p.opts.OnJobDone(d, err)
+	}
+}
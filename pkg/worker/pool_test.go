@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+)
+
+func TestPoolProcessesJobs(t *testing.T) {
+	var done atomic.Int64
+	var observed atomic.Int64
+	pool := NewPool(Options{Workers: 3, QueueSize: 50, OnJobDone: func(time.Duration, error) {
+		observed.Add(1)
+	}}, testutil.NopLogger())
+	pool.Start(context.Background())
+
+	for i := 0; i < 50; i++ {
+		if err := pool.Submit(JobFunc(func(ctx context.Context) error {
+			done.Add(1)
+			return nil
+		})); err != nil {
+			t.Fatalf("Submit() unexpected error: %v", err)
+		}
+	}
+
+	if err := pool.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() unexpected error: %v", err)
+	}
+	if done.Load() != 50 || observed.Load() != 50 {
+		t.Errorf("ran %d jobs, observed %d, want 50", done.Load(), observed.Load())
+	}
+	if stats := pool.Stats(); stats.Processed != 50 || stats.QueueDepth != 0 || stats.InFlight != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	if err := pool.Submit(JobFunc(func(ctx context.Context) error { return nil })); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Submit() after Stop error = %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestPoolQueueFull(t *testing.T) {
+	pool := NewPool(Options{Workers: 1, QueueSize: 1}, testutil.NopLogger())
+
+	// Not started, so the single slot fills up
+	noop := JobFunc(func(ctx context.Context) error { return nil })
+	if err := pool.Submit(noop); err != nil {
+		t.Fatalf("Submit() unexpected error: %v", err)
+	}
+	if err := pool.Submit(noop); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit() error = %v, want %v", err, ErrQueueFull)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.SubmitWait(ctx, noop); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SubmitWait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestPoolPanicIsolation(t *testing.T) {
+	pool := NewPool(Options{Workers: 1}, testutil.NopLogger())
+	pool.Start(context.Background())
+
+	var ran atomic.Bool
+	pool.Submit(JobFunc(func(ctx context.Context) error { panic("boom") }))
+	pool.Submit(JobFunc(func(ctx context.Context) error { return errors.New("failed") }))
+	pool.Submit(JobFunc(func(ctx context.Context) error { ran.Store(true); return nil }))
+	pool.Stop(context.Background())
+
+	if !ran.Load() {
+		t.Errorf("job after a panic did not run")
+	}
+	if stats := pool.Stats(); stats.Panicked != 1 || stats.Failed != 2 || stats.Processed != 3 {
+		t.Errorf("Stats() = %+v, want 1 panicked, 2 failed, 3 processed", stats)
+	}
+}
+
+func TestPoolStopDeadline(t *testing.T) {
+	pool := NewPool(Options{Workers: 1}, testutil.NopLogger())
+	pool.Start(context.Background())
+
+	started := make(chan struct{})
+	var cancelled atomic.Bool
+	var queuedRan atomic.Bool
+	pool.Submit(JobFunc(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		cancelled.Store(true)
+		return ctx.Err()
+	}))
+	pool.Submit(JobFunc(func(ctx context.Context) error {
+		queuedRan.Store(true)
+		return nil
+	}))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !cancelled.Load() {
+		t.Errorf("in-flight job was not cancelled")
+	}
+	if queuedRan.Load() {
+		t.Errorf("queued job ran after the drain deadline")
+	}
+}
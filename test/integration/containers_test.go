@@ -0,0 +1,124 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	postgresImage = "postgres:16-alpine"
+	mysqlImage    = "mysql:8.4"
+	redisImage    = "redis:7-alpine"
+	etcdImage     = "quay.io/coreos/etcd:v3.5.9"
+)
+
+// startContainer starts a container and terminates it when the test finishes
+func startContainer(t *testing.T, req testcontainers.ContainerRequest) testcontainers.Container {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		t.Fatalf("failed to start %s: %v", req.Image, err)
+	}
+
+	t.Cleanup(func() {
+		if err := container.Terminate(context.Background()); err != nil {
+			t.Logf("failed to terminate %s: %v", req.Image, err)
+		}
+	})
+
+	return container
+}
+
+// endpoint returns host:port of the container's first exposed port
+func endpoint(t *testing.T, container testcontainers.Container) string {
+	t.Helper()
+
+	addr, err := container.Endpoint(context.Background(), "")
+	if err != nil {
+		t.Fatalf("failed to get container endpoint: %v", err)
+	}
+	return addr
+}
+
+// startPostgres boots a PostgreSQL container and returns its connection string
+func startPostgres(t *testing.T) string {
+	t.Helper()
+
+	container := startContainer(t, testcontainers.ContainerRequest{
+		Image:        postgresImage,
+		ExposedPorts: []string{"5432/tcp"},
+		Env: map[string]string{
+			"POSTGRES_USER":     "test",
+			"POSTGRES_PASSWORD": "test",
+			"POSTGRES_DB":       "users",
+		},
+		WaitingFor: wait.ForLog("database system is ready to accept connections").
+			WithOccurrence(2).
+			WithStartupTimeout(time.Minute),
+	})
+
+	return fmt.Sprintf("postgres://test:test@%s/users?sslmode=disable", endpoint(t, container))
+}
+
+// startMySQL boots a MySQL container and returns its data source name
+func startMySQL(t *testing.T) string {
+	t.Helper()
+
+	container := startContainer(t, testcontainers.ContainerRequest{
+		Image:        mysqlImage,
+		ExposedPorts: []string{"3306/tcp"},
+		Env: map[string]string{
+			"MYSQL_ROOT_PASSWORD": "test",
+			"MYSQL_DATABASE":      "users",
+		},
+		WaitingFor: wait.ForLog("port: 3306  MySQL Community Server").
+			WithStartupTimeout(2 * time.Minute),
+	})
+
+	return fmt.Sprintf("root:test@tcp(%s)/users", endpoint(t, container))
+}
+
+// startRedis boots a Redis container and returns its address
+func startRedis(t *testing.T) string {
+	t.Helper()
+
+	container := startContainer(t, testcontainers.ContainerRequest{
+		Image:        redisImage,
+		ExposedPorts: []string{"6379/tcp"},
+		WaitingFor:   wait.ForLog("Ready to accept connections").WithStartupTimeout(time.Minute),
+	})
+
+	return endpoint(t, container)
+}
+
+// startEtcd boots a single-node etcd container and returns its client endpoint
+func startEtcd(t *testing.T) string {
+	t.Helper()
+
+	container := startContainer(t, testcontainers.ContainerRequest{
+		Image:        etcdImage,
+		ExposedPorts: []string{"2379/tcp"},
+		Cmd: []string{
+			"etcd",
+			"--listen-client-urls=http://0.0.0.0:2379",
+			"--advertise-client-urls=http://0.0.0.0:2379",
+		},
+		WaitingFor: wait.ForLog("ready to serve client requests").WithStartupTimeout(time.Minute),
+	})
+
+	return endpoint(t, container)
+}
@@ -0,0 +1,56 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/lock"
+	"github.com/redis/go-redis/v9"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestRedisLock(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: startRedis(t)})
+	t.Cleanup(func() { client.Close() })
+
+	runLockSuite(t, lock.NewRedisLocker([]redis.UniversalClient{client}, lock.RedisOptions{TTL: time.Second}))
+}
+
+func TestEtcdLock(t *testing.T) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{startEtcd(t)},
+		DialTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to connect to etcd: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	runLockSuite(t, lock.NewEtcdLocker(client, lock.EtcdOptions{TTL: 5 * time.Second}))
+}
+
+// runLockSuite checks mutual exclusion against a real backend
+func runLockSuite(t *testing.T, l lock.Locker) {
+	ctx := context.Background()
+
+	held, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire() unexpected error: %v", err)
+	}
+	if _, err := l.TryAcquire(ctx, "job"); !errors.Is(err, lock.ErrNotAcquired) {
+		t.Errorf("TryAcquire() while held error = %v, want %v", err, lock.ErrNotAcquired)
+	}
+	if err := held.Release(ctx); err != nil {
+		t.Fatalf("Release() unexpected error: %v", err)
+	}
+
+	again, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire() after release unexpected error: %v", err)
+	}
+	again.Release(ctx)
+}
@@ -0,0 +1,63 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ChyiYaqing/go-microservice-template/pkg/logger"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisQueue(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: startRedis(t)})
+	t.Cleanup(func() { client.Close() })
+
+	store := queue.NewRedisStore(client, "integration")
+	q := queue.New(store, logger.Nop(), queue.Options{
+		PollInterval: 10 * time.Millisecond,
+		Backoff:      queue.Backoff{Initial: 10 * time.Millisecond, Max: 10 * time.Millisecond},
+	})
+
+	attempts := 0
+	done := make(chan struct{})
+	q.Register("webhook", func(ctx context.Context, job *queue.Job) error {
+		attempts++
+		if attempts == 1 {
+			return context.DeadlineExceeded
+		}
+		close(done)
+		return nil
+	})
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	job, err := q.Enqueue(context.Background(), "webhook", map[string]string{"url": "http://example.com"})
+	if err != nil {
+		t.Fatalf("Enqueue() unexpected error: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("job did not succeed")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := store.Get(context.Background(), job.ID)
+		if err == nil && got.State == queue.StateSucceeded {
+			if got.Attempts != 2 {
+				t.Errorf("Attempts = %d, want 2", got.Attempts)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job state = %+v, %v, want succeeded", got, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/cache"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	runRepositorySuite(t, func(t *testing.T) repository.UserRepository {
+		return repository.NewMemoryRepository()
+	})
+}
+
+func TestCachedRepository(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: startRedis(t)})
+	t.Cleanup(func() { client.Close() })
+
+	runRepositorySuite(t, func(t *testing.T) repository.UserRepository {
+		// A fresh prefix per repository keeps subtests from sharing entries
+		return repository.NewCachedRepository(repository.NewMemoryRepository(), cache.NewRedisCache(client), repository.CacheOptions{
+			KeyPrefix: "integration:" + t.Name(),
+		})
+	})
+}
+
+func TestPostgresRepository(t *testing.T) {
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, startPostgres(t))
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	runRepositorySuite(t, func(t *testing.T) repository.UserRepository {
+		repo, err := repository.NewPostgresRepository(ctx, pool)
+		if err != nil {
+			t.Fatalf("NewPostgresRepository() unexpected error: %v", err)
+		}
+		// Subtests share the database, each starts from empty tables
+		if _, err := pool.Exec(ctx, "TRUNCATE users, outbox"); err != nil {
+			t.Fatalf("failed to truncate tables: %v", err)
+		}
+		return repo
+	})
+}
+
+func TestMySQLRepository(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("mysql", startMySQL(t))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	runRepositorySuite(t, func(t *testing.T) repository.UserRepository {
+		repo, err := repository.NewMySQLRepository(ctx, db)
+		if err != nil {
+			t.Fatalf("NewMySQLRepository() unexpected error: %v", err)
+		}
+		// Subtests share the database, each starts from empty tables
+		for _, table := range []string{"users", "outbox"} {
+			if _, err := db.ExecContext(ctx, "TRUNCATE "+table); err != nil {
+				t.Fatalf("failed to truncate %s: %v", table, err)
+			}
+		}
+		return repo
+	})
+}
@@ -0,0 +1,64 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/response"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/testutil/builder"
+)
+
+// TestServerCRUD drives a full CRUD scenario through both gRPC and REST
+func TestServerCRUD(t *testing.T) {
+	srv := testutil.NewServer(t)
+	ctx := context.Background()
+
+	createResp, err := srv.Client.CreateUser(ctx, builder.NewUserBuilder().CreateRequest())
+	if err != nil {
+		t.Fatalf("CreateUser() unexpected error: %v", err)
+	}
+	name := builder.DecodeUser(t, createResp).GetName()
+
+	req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/v1/"+name,
+		strings.NewReader(`{"display_name":"Renamed","is_active":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	httpResp, err := srv.HTTPClient.Do(req)
+	if err != nil {
+		t.Fatalf("PATCH /v1/%s unexpected error: %v", name, err)
+	}
+	var body struct {
+		ErrorCode int32 `json:"errorCode"`
+	}
+	json.NewDecoder(httpResp.Body).Decode(&body)
+	httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK || body.ErrorCode != response.CodeSuccess {
+		t.Fatalf("PATCH /v1/%s status = %d, error_code = %d", name, httpResp.StatusCode, body.ErrorCode)
+	}
+
+	getResp, err := srv.Client.GetUser(ctx, &apiv1.GetUserRequest{Name: name})
+	if err != nil {
+		t.Fatalf("GetUser() unexpected error: %v", err)
+	}
+	if got := builder.DecodeUser(t, getResp).GetDisplayName(); got != "Renamed" {
+		t.Errorf("GetUser() display_name = %q, want %q", got, "Renamed")
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, srv.URL+"/v1/"+name, nil)
+	httpResp, err = srv.HTTPClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE /v1/%s unexpected error: %v", name, err)
+	}
+	httpResp.Body.Close()
+
+	getResp, _ = srv.Client.GetUser(ctx, &apiv1.GetUserRequest{Name: name})
+	if getResp.ErrorCode != response.CodeNotFound {
+		t.Errorf("GetUser() after delete error_code = %d, want %d", getResp.ErrorCode, response.CodeNotFound)
+	}
+}
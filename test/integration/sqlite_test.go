@@ -0,0 +1,27 @@
+//go:build integration && cgo
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+)
+
+func TestSQLiteRepository(t *testing.T) {
+	runRepositorySuite(t, func(t *testing.T) repository.UserRepository {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "users.db"))
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		repo, err := repository.NewSQLiteRepository(context.Background(), db)
+		if err != nil {
+			t.Fatalf("NewSQLiteRepository() unexpected error: %v", err)
+		}
+		return repo
+	})
+}
@@ -0,0 +1,190 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	apiv1 "github.com/ChyiYaqing/go-microservice-template/api/proto/v1"
+	"github.com/ChyiYaqing/go-microservice-template/internal/repository"
+	"github.com/ChyiYaqing/go-microservice-template/pkg/outbox"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// runRepositorySuite runs the CRUD contract every UserRepository must satisfy.
+// newRepo must return an empty repository.
+func runRepositorySuite(t *testing.T, newRepo func(t *testing.T) repository.UserRepository) {
+	ctx := context.Background()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newUser := func(i int) *apiv1.User {
+		ts := timestamppb.New(base.Add(time.Duration(i) * time.Second))
+		return &apiv1.User{
+			Name:        fmt.Sprintf("users/%d", i),
+			Email:       fmt.Sprintf("user%d@example.com", i),
+			DisplayName: fmt.Sprintf("User %d", i),
+			CreateTime:  ts,
+			UpdateTime:  ts,
+			IsActive:    true,
+		}
+	}
+
+	t.Run("create and get", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.Create(ctx, newUser(1)); err != nil {
+			t.Fatalf("Create() unexpected error: %v", err)
+		}
+
+		got, err := repo.Get(ctx, "users/1")
+		if err != nil {
+			t.Fatalf("Get() unexpected error: %v", err)
+		}
+		if got.GetEmail() != "user1@example.com" {
+			t.Errorf("Get() email = %q, want %q", got.GetEmail(), "user1@example.com")
+		}
+		if !got.GetCreateTime().AsTime().Equal(base.Add(time.Second)) {
+			t.Errorf("Get() create_time = %v, want %v", got.GetCreateTime().AsTime(), base.Add(time.Second))
+		}
+	})
+
+	t.Run("create duplicate", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Create(ctx, newUser(1))
+		if _, err := repo.Create(ctx, newUser(1)); !errors.Is(err, repository.ErrAlreadyExists) {
+			t.Errorf("Create() error = %v, want %v", err, repository.ErrAlreadyExists)
+		}
+	})
+
+	t.Run("unique emails", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Create(ctx, newUser(1))
+		taken := newUser(2)
+		taken.Email = "user1@example.com"
+		if _, err := repo.Create(ctx, taken); !errors.Is(err, repository.ErrEmailTaken) {
+			t.Errorf("Create() with a taken email error = %v, want %v", err, repository.ErrEmailTaken)
+		}
+		repo.Create(ctx, newUser(2))
+		if _, err := repo.Update(ctx, taken); !errors.Is(err, repository.ErrEmailTaken) {
+			t.Errorf("Update() to a taken email error = %v, want %v", err, repository.ErrEmailTaken)
+		}
+	})
+
+	t.Run("get missing", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.Get(ctx, "users/999"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Get() error = %v, want %v", err, repository.ErrNotFound)
+		}
+	})
+
+	t.Run("list pages in creation order", func(t *testing.T) {
+		repo := newRepo(t)
+		for i := 1; i <= 5; i++ {
+			repo.Create(ctx, newUser(i))
+		}
+
+		var names []string
+		for offset := 0; ; offset += 2 {
+			users, err := repo.List(ctx, offset, 2)
+			if err != nil {
+				t.Fatalf("List() unexpected error: %v", err)
+			}
+			if len(users) == 0 {
+				break
+			}
+			for _, u := range users {
+				names = append(names, u.GetName())
+			}
+		}
+
+		want := []string{"users/1", "users/2", "users/3", "users/4", "users/5"}
+		if fmt.Sprint(names) != fmt.Sprint(want) {
+			t.Errorf("List() names = %v, want %v", names, want)
+		}
+	})
+
+	t.Run("count follows writes", func(t *testing.T) {
+		repo := newRepo(t)
+		for i := 1; i <= 3; i++ {
+			repo.Create(ctx, newUser(i))
+		}
+		repo.Update(ctx, newUser(2))
+		repo.Delete(ctx, "users/1")
+
+		if total, err := repo.Count(ctx); err != nil || total != 2 {
+			t.Errorf("Count() = %d, %v, want 2", total, err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Create(ctx, newUser(1))
+
+		user := newUser(1)
+		user.DisplayName = "Updated"
+		if _, err := repo.Update(ctx, user); err != nil {
+			t.Fatalf("Update() unexpected error: %v", err)
+		}
+
+		got, _ := repo.Get(ctx, "users/1")
+		if got.GetDisplayName() != "Updated" {
+			t.Errorf("Get() display_name = %q, want %q", got.GetDisplayName(), "Updated")
+		}
+
+		if _, err := repo.Update(ctx, newUser(2)); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Update() missing error = %v, want %v", err, repository.ErrNotFound)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Create(ctx, newUser(1))
+
+		if err := repo.Delete(ctx, "users/1"); err != nil {
+			t.Fatalf("Delete() unexpected error: %v", err)
+		}
+		if err := repo.Delete(ctx, "users/1"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Delete() twice error = %v, want %v", err, repository.ErrNotFound)
+		}
+	})
+
+	t.Run("batch get", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Create(ctx, newUser(1))
+		repo.Create(ctx, newUser(2))
+
+		users, err := repo.BatchGet(ctx, []string{"users/2", "users/999", "users/1"})
+		if err != nil {
+			t.Fatalf("BatchGet() unexpected error: %v", err)
+		}
+		if len(users) != 2 || users[0].GetName() != "users/2" || users[1].GetName() != "users/1" {
+			t.Errorf("BatchGet() = %v, want users/2 and users/1 in request order", users)
+		}
+	})
+
+	t.Run("outbox", func(t *testing.T) {
+		repo := newRepo(t)
+		store := repository.OutboxOf(repo)
+		if store == nil {
+			t.Skip("repository keeps no outbox")
+		}
+		with := func(id string) context.Context {
+			return outbox.WithMessages(ctx, &outbox.Message{ID: id, Topic: "users", Key: "users/1", Payload: []byte("{}"), CreateTime: base})
+		}
+		repo.Create(with("created"), newUser(1))
+		repo.Create(with("duplicate"), newUser(1))
+		repo.Delete(with("deleted"), "users/1")
+		repo.Delete(with("missing"), "users/1")
+
+		pending, err := store.Pending(ctx, 10)
+		if err != nil {
+			t.Fatalf("Pending() unexpected error: %v", err)
+		}
+		if len(pending) != 2 || pending[0].ID != "created" || pending[1].ID != "deleted" {
+			t.Errorf("Pending() = %v, want the messages of the committed writes", pending)
+		}
+	})
+}